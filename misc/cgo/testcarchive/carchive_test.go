@@ -787,7 +787,7 @@ func TestCompileWithoutShared(t *testing.T) {
 		}()
 	}
 
-	cmd := exec.Command("go", "build", "-buildmode=c-archive", "-gcflags=-shared=false", "-o", "libgo2.a", "./libgo2")
+	cmd := exec.Command("go", "build", "-buildmode=c-archive", "-gcflags=-shared=false", "-ldflags=-skip-pic-check", "-o", "libgo2.a", "./libgo2")
 	t.Log(cmd.Args)
 	out, err := cmd.CombinedOutput()
 	t.Logf("%s", out)
@@ -931,3 +931,62 @@ func TestManyCalls(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestInterpose(t *testing.T) {
+	if GOOS != "linux" || runtime.Compiler == "gccgo" {
+		t.Skipf("skipping -interpose test on %s/%s", GOOS, runtime.Compiler)
+	}
+	t.Parallel()
+
+	if !testWork {
+		defer func() {
+			os.Remove("testp8" + exeSuffix)
+			os.Remove("libgo8.a")
+			os.Remove("libgo8.h")
+			os.Remove("libshim8.so")
+			os.Remove("interpose8.txt")
+		}()
+	}
+
+	cmd := exec.Command("go", "build", "-buildmode=c-archive", "-ldflags=-interpose -interposereport=interpose8.txt", "-o", "libgo8.a", "./libgo8")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("%s", out)
+		t.Fatal(err)
+	}
+	checkLineComments(t, "libgo8.h")
+
+	report, err := os.ReadFile("interpose8.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(report, []byte("Cfunc_getaddrinfo")) {
+		t.Errorf("-interposereport output does not mention getaddrinfo:\n%s", report)
+	}
+
+	ccArgs := append(cc, "-o", "testp8"+exeSuffix, "main8.c", "libgo8.a")
+	if out, err := exec.Command(ccArgs[0], ccArgs[1:]...).CombinedOutput(); err != nil {
+		t.Logf("%s", out)
+		t.Fatal(err)
+	}
+	ccArgs = append(cc, "-shared", "-fPIC", "-o", "libshim8.so", "shim8.c")
+	if out, err := exec.Command(ccArgs[0], ccArgs[1:]...).CombinedOutput(); err != nil {
+		t.Logf("%s", out)
+		t.Fatal(err)
+	}
+
+	shim, err := filepath.Abs("libshim8.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argv := cmdToRun("./testp8")
+	cmd = exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "LD_PRELOAD="+shim)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Logf("%s", out)
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte("shim getaddrinfo(interpose.invalid)")) {
+		t.Errorf("preloaded getaddrinfo was not called; output:\n%s", out)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+/*
+#include <stdlib.h>
+#include <sys/types.h>
+#include <sys/socket.h>
+#include <netdb.h>
+*/
+import "C"
+
+import "unsafe"
+
+// GoLookup calls getaddrinfo from Go through cgo.
+//export GoLookup
+func GoLookup() C.int {
+	host := C.CString("interpose.invalid")
+	defer C.free(unsafe.Pointer(host))
+	var res *C.struct_addrinfo
+	r := C.getaddrinfo(host, nil, nil, &res)
+	if r == 0 {
+		C.freeaddrinfo(res)
+	}
+	return r
+}
+
+func main() {
+}
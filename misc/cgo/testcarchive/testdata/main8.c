@@ -0,0 +1,15 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test that a preloaded library can interpose on libc calls made
+// from Go code through cgo.
+
+#include <stdio.h>
+
+#include "libgo8.h"
+
+int main() {
+	printf("GoLookup returned %d\n", GoLookup());
+	return 0;
+}
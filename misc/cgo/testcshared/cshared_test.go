@@ -835,3 +835,35 @@ func TestGo2C2Go(t *testing.T) {
 	run(t, goenv, "go", "build", "-o", bin, "./go2c2go/m2")
 	runExe(t, runenv, bin)
 }
+
+// test6: tests that the linker reports a cgo export that has the
+// name of a C library function.
+func TestExportCollision(t *testing.T) {
+	switch GOOS {
+	case "windows", "android":
+		t.Skipf("skipping on %s", GOOS)
+	}
+
+	t.Parallel()
+
+	tmpdir, err := os.MkdirTemp("", "cshared-TestExportCollision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	lib := filepath.Join(tmpdir, "libgo6."+libSuffix)
+	out := run(t, nil, "go", "build", "-buildmode=c-shared", "-o", lib, "./libgo6")
+	want := "cgo export getpid collides with symbol getpid in libc"
+	if !strings.Contains(out, "warning: "+want) {
+		t.Errorf("go build output does not contain %q:\n%s", "warning: "+want, out)
+	}
+
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-ldflags=-strictwarnings", "-o", lib, "./libgo6")
+	out2, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("go build -ldflags=-strictwarnings succeeded unexpectedly:\n%s", out2)
+	} else if !strings.Contains(string(out2), want) {
+		t.Errorf("go build -ldflags=-strictwarnings output does not contain %q:\n%s", want, out2)
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "C"
+
+// getpid has the name of a C library function, so exporting it
+// interposes on the C library's getpid.
+//export getpid
+func getpid() C.int {
+	return 0
+}
+
+func main() {}
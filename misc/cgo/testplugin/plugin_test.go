@@ -79,6 +79,7 @@ func testMain(m *testing.M) int {
 	}
 	os.Setenv("PWD", altRoot)
 	goCmd(nil, "build", "-buildmode=plugin", "-o", filepath.Join(modRoot, "plugin-mismatch.so"), "./plugin-mismatch")
+	goCmd(nil, "build", "-buildmode=plugin", "-ldflags=-plugin-compat=loose", "-o", filepath.Join(modRoot, "plugin-mismatch-loose.so"), "./plugin-mismatch")
 
 	os.Setenv("GOPATH", GOPATH)
 	if err := os.Chdir(modRoot); err != nil {
@@ -287,9 +288,113 @@ func TestMethod2(t *testing.T) {
 	run(t, "./method2.exe")
 }
 
+func TestPluginHost(t *testing.T) {
+	goCmd(t, "build", "-o", "typeimports.exe", "./typeimports/main.go")
+	host, err := filepath.Abs("typeimports.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goCmd(t, "build", "-buildmode=plugin", "-o", "typeimports.so", "./typeimports/plugin.go")
+	goCmd(t, "build", "-buildmode=plugin", "-ldflags=-pluginhost="+host, "-o", "typeimports-host.so", "./typeimports/plugin.go")
+	run(t, "./typeimports.exe", "typeimports.so")
+	run(t, "./typeimports.exe", "typeimports-host.so")
+
+	full, err := os.Stat("typeimports.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, err := os.Stat("typeimports-host.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("plugin size: %d bytes, %d with -pluginhost", full.Size(), small.Size())
+	if small.Size() >= full.Size() {
+		t.Errorf("plugin linked with -pluginhost is not smaller")
+	}
+}
+
 func TestIssue44956(t *testing.T) {
 	goCmd(t, "build", "-buildmode=plugin", "-o", "issue44956p1.so", "./issue44956/plugin1.go")
 	goCmd(t, "build", "-buildmode=plugin", "-o", "issue44956p2.so", "./issue44956/plugin2.go")
 	goCmd(t, "build", "-o", "issue44956.exe", "./issue44956/main.go")
 	run(t, "./issue44956.exe")
 }
+
+func TestPluginCompatLoose(t *testing.T) {
+	// plugin-mismatch.so differs from the host only in the body of an
+	// init function, which does not change the loose package hash.
+	goCmd(t, "build", "-ldflags=-plugin-compat=loose", "-o", "pluginmismatch-loose.exe", "./pluginmismatch")
+	run(t, "./pluginmismatch-loose.exe", "plugin-mismatch-loose.so")
+}
+
+func TestPluginMismatchGODEBUG(t *testing.T) {
+	goCmd(t, "build", "-o", "pluginmismatch.exe", "./pluginmismatch")
+
+	cmd := exec.Command("./pluginmismatch.exe", "plugin-mismatch.so")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(out, []byte("different version")) {
+		t.Fatalf("%s: expected different version error, got %v\n%s", strings.Join(cmd.Args, " "), err, out)
+	}
+
+	cmd = exec.Command("./pluginmismatch.exe", "plugin-mismatch.so")
+	cmd.Env = append(os.Environ(), "GODEBUG=pluginmismatch=1")
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", strings.Join(cmd.Args, " "), err, out)
+	}
+	if !bytes.Contains(out, []byte("WARNING: plugin")) || !bytes.Contains(out, []byte("corrupt memory")) {
+		t.Errorf("%s: missing mismatch warning in output:\n%s", strings.Join(cmd.Args, " "), out)
+	}
+}
+
+func TestPluginCompatLooseLayout(t *testing.T) {
+	// Changing the type of a struct field keeps the names and sizes
+	// of the package's symbols, but not the layout of the struct.
+	testPluginCompatLooseChange(t, "F int32", "F uint32")
+}
+
+func TestPluginCompatLooseParam(t *testing.T) {
+	// Changing the type of a parameter keeps the size and the pointer
+	// maps of the function's arguments, but not its type.
+	testPluginCompatLooseChange(t, "Scale(x int32)", "Scale(x uint32)")
+}
+
+// testPluginCompatLooseChange checks that a plugin built with
+// -plugin-compat=loose is rejected by a host built after replacing old
+// with new in package pluginlayout/layout.
+func testPluginCompatLooseChange(t *testing.T, old, new string) {
+	goCmd(t, "build", "-buildmode=plugin", "-ldflags=-plugin-compat=loose", "-o", "pluginlayout.so", "./pluginlayout/plugin")
+	goCmd(t, "build", "-ldflags=-plugin-compat=loose", "-o", "pluginlayout.exe", "./pluginlayout")
+	run(t, "./pluginlayout.exe", "pluginlayout.so")
+
+	// Rebuild only the host with the change.
+	src := filepath.Join("pluginlayout", "layout", "layout.go")
+	orig, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := bytes.Replace(orig, []byte(old), []byte(new), 1)
+	if bytes.Equal(changed, orig) {
+		t.Fatalf("%s: %q not found", src, old)
+	}
+	if err := os.WriteFile(src, changed, 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.WriteFile(src, orig, 0666)
+	goCmd(t, "build", "-ldflags=-plugin-compat=loose", "-o", "pluginlayout-changed.exe", "./pluginlayout")
+
+	cmd := exec.Command("./pluginlayout-changed.exe", "pluginlayout.so")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !bytes.Contains(out, []byte("different version of package testplugin/pluginlayout/layout")) {
+		t.Fatalf("%s: expected different version error, got %v\n%s", strings.Join(cmd.Args, " "), err, out)
+	}
+}
+
+func TestGuardModuledata(t *testing.T) {
+	// The moduledata of the program and of the plugin are read-only;
+	// the runtime adds the plugin to the list of modules through the
+	// program's modulestate.
+	goCmd(t, "build", "-buildmode=plugin", "-ldflags=-guard-moduledata", "-o", "guardmoduledata.so", "./pluginlayout/plugin")
+	goCmd(t, "build", "-ldflags=-guard-moduledata", "-o", "guardmoduledata.exe", "./pluginlayout")
+	run(t, "./guardmoduledata.exe", "guardmoduledata.so")
+}
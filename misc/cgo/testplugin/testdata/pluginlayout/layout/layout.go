@@ -0,0 +1,20 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package layout is shared by the host and the plugin.
+// TestPluginCompatLooseLayout changes the type of T.F,
+// and TestPluginCompatLooseParam the parameter of Scale,
+// for the host only.
+package layout
+
+type T struct {
+	F int32
+	G string
+}
+
+var V = T{F: 1, G: "v"}
+
+func Scale(x int32) int {
+	return int(x) * 2
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"plugin"
+
+	"testplugin/pluginlayout/layout"
+)
+
+func main() {
+	p, err := plugin.Open(os.Args[1])
+	if err != nil {
+		panic(err)
+	}
+
+	sym, err := p.Lookup("ReadF")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(layout.V.F, sym.(func() int32)())
+}
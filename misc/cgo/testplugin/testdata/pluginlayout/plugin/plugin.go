@@ -0,0 +1,13 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testplugin/pluginlayout/layout"
+
+func ReadF() int32 {
+	return layout.V.F
+}
+
+func main() {}
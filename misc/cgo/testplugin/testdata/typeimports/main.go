@@ -0,0 +1,66 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The plugin may be linked with -pluginhost naming this program, and
+// then uses the type descriptors of the program instead of its own.
+// The types must be the same on both sides.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"plugin"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+func main() {
+	p, err := plugin.Open(os.Args[1])
+	if err != nil {
+		panic(err)
+	}
+	lookup := func(name string) plugin.Symbol {
+		s, err := p.Lookup(name)
+		if err != nil {
+			panic(err)
+		}
+		return s
+	}
+
+	var numErr *strconv.NumError
+	if err := lookup("Atoi").(func(string) error)("x"); !errors.As(err, &numErr) || !errors.Is(err, strconv.ErrSyntax) {
+		panic(fmt.Sprintf("Atoi(\"x\") = %v, want a *strconv.NumError", err))
+	}
+	if !lookup("IsBuffer").(func(interface{}) bool)(new(bytes.Buffer)) {
+		panic("IsBuffer(new(bytes.Buffer)) = false")
+	}
+
+	want := []reflect.Type{
+		reflect.TypeOf(map[string][]int(nil)),
+		reflect.TypeOf(time.Second),
+		reflect.TypeOf(new(bytes.Buffer)),
+	}
+	for i, typ := range lookup("Types").(func() []reflect.Type)() {
+		if typ != want[i] {
+			panic(fmt.Sprintf("plugin type %v is not the type %v of the program", typ, want[i]))
+		}
+	}
+
+	// The method type is found by its offset from the types of the
+	// plugin.
+	m := reflect.ValueOf(lookup("V")).Elem().MethodByName("Err")
+	if typ, want := m.Type(), reflect.TypeOf((func() error)(nil)); typ != want {
+		panic(fmt.Sprintf("method type %v is not the type %v of the program", typ, want))
+	}
+	if err, ok := m.Call(nil)[0].Interface().(error); !ok || !errors.As(err, &numErr) {
+		panic(fmt.Sprintf("V.Err() = %v, want a *strconv.NumError", err))
+	}
+	if d := reflect.ValueOf(lookup("V")).Elem().Field(0).Interface().(time.Duration); d != 0 {
+		panic(fmt.Sprintf("V.D = %v, want 0", d))
+	}
+}
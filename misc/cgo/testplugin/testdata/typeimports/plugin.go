@@ -0,0 +1,41 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+type T struct{ D time.Duration }
+
+func (T) Err() error {
+	_, err := strconv.Atoi("x")
+	return err
+}
+
+var V T
+
+func Atoi(s string) error {
+	_, err := strconv.Atoi(s)
+	return err
+}
+
+func IsBuffer(x interface{}) bool {
+	_, ok := x.(*bytes.Buffer)
+	return ok
+}
+
+func Types() []reflect.Type {
+	return []reflect.Type{
+		reflect.TypeOf(map[string][]int(nil)),
+		reflect.TypeOf(time.Second),
+		reflect.TypeOf(new(bytes.Buffer)),
+	}
+}
+
+func main() {}
@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sanitizers_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestASAN(t *testing.T) {
+	goos, err := goEnv("GOOS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goarch, err := goEnv("GOARCH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The asan tests require support for the -asan option.
+	if !aSanSupported(goos, goarch) {
+		t.Skipf("skipping on %s/%s; -asan option is not supported.", goos, goarch)
+	}
+
+	t.Parallel()
+	requireOvercommit(t)
+	config := configure("address")
+	config.skipIfCSanitizerBroken(t)
+
+	mustRun(t, config.goCmd("build", "std"))
+
+	cases := []struct {
+		src               string
+		memoryAccessError string
+	}{
+		{src: "asan.go"},
+		{src: "asan1_fail.go", memoryAccessError: "heap-use-after-free"},
+		{src: "asan2_fail.go", memoryAccessError: "heap-buffer-overflow"},
+	}
+	linkmodes := []string{"auto"}
+	if goos == "linux" && goarch == "amd64" {
+		// -asan programs can also be linked internally.
+		linkmodes = append(linkmodes, "internal")
+	}
+	for _, linkmode := range linkmodes {
+		for _, tc := range cases {
+			tc := tc
+			linkmode := linkmode
+			name := strings.TrimSuffix(tc.src, ".go") + "_" + linkmode
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				dir := newTempDir(t)
+				defer dir.RemoveAll(t)
+
+				outPath := dir.Join(name)
+				mustRun(t, config.goCmd("build", "-ldflags=-linkmode="+linkmode, "-o", outPath, srcPath(tc.src)))
+
+				cmd := hangProneCmd(outPath)
+				if tc.memoryAccessError != "" {
+					out, err := cmd.CombinedOutput()
+					if err != nil && strings.Contains(string(out), tc.memoryAccessError) {
+						return
+					}
+					t.Fatalf("%#q exited without expected memory access error\n%s; got failure\n%s", strings.Join(cmd.Args, " "), tc.memoryAccessError, out)
+				}
+				mustRun(t, cmd)
+			})
+		}
+	}
+}
+
+func TestASANStaticRuntimeInternal(t *testing.T) {
+	goos, err := goEnv("GOOS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goarch, err := goEnv("GOARCH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goos != "linux" || goarch != "amd64" {
+		t.Skipf("skipping on %s/%s; -asan programs are only linked internally on linux/amd64.", goos, goarch)
+	}
+	// Only GCC links a static ASan runtime with -static-libasan.
+	if compiler, _ := compilerVersion(); compiler.name != "gcc" {
+		t.Skipf("skipping with %s; -static-libasan is a GCC option.", compiler.name)
+	}
+
+	t.Parallel()
+	requireOvercommit(t)
+	config := configure("address")
+	config.skipIfCSanitizerBroken(t)
+
+	dir := newTempDir(t)
+	defer dir.RemoveAll(t)
+
+	// Internal linking only supports a shared ASan runtime.
+	cmd := config.goCmd("build", "-ldflags=-linkmode=internal", "-o", dir.Join("asan"), srcPath("asan.go"))
+	replaceEnv(cmd, "CGO_LDFLAGS", strings.Join(config.ldFlags, " ")+" -static-libasan")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("%#q succeeded, want error", strings.Join(cmd.Args, " "))
+	}
+	if want := "internal linking does not support a static ASan runtime"; !strings.Contains(string(out), want) {
+		t.Errorf("%#q output does not contain %q:\n%s", strings.Join(cmd.Args, " "), want, out)
+	}
+}
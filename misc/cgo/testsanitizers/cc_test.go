@@ -259,6 +259,9 @@ func configure(sanitizer string) *config {
 	case "memory":
 		c.goFlags = append(c.goFlags, "-msan")
 
+	case "address":
+		c.goFlags = append(c.goFlags, "-asan")
+
 	case "thread":
 		c.goFlags = append(c.goFlags, "--installsuffix=tsan")
 		compiler, _ := compilerVersion()
@@ -440,6 +443,17 @@ func hangProneCmd(name string, arg ...string) *exec.Cmd {
 	return cmd
 }
 
+// aSanSupported is a copy of the function cmd/internal/sys.ASanSupported,
+// because the internal pacakage can't be used here.
+func aSanSupported(goos, goarch string) bool {
+	switch goos {
+	case "linux":
+		return goarch == "amd64" || goarch == "arm64"
+	default:
+		return false
+	}
+}
+
 // mSanSupported is a copy of the function cmd/internal/sys.MSanSupported,
 // because the internal pacakage can't be used here.
 func mSanSupported(goos, goarch string) bool {
@@ -0,0 +1,32 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+/*
+#include <stdlib.h>
+
+int *p;
+int *f() {
+  p = (int *)malloc(2 * sizeof(int));
+  p[0] = 1;
+  p[1] = 2;
+  return p;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func main() {
+	p := C.f()
+	q := (*[2]C.int)(unsafe.Pointer(p))
+	if q[0]+q[1] != 3 {
+		panic(fmt.Sprintf("got %d, %d; want 1, 2", q[0], q[1]))
+	}
+	C.free(unsafe.Pointer(p))
+}
@@ -1989,6 +1989,24 @@ func MarkTypeUsedInInterface(t *types.Type, from *obj.LSym) {
 	r.Type = objabi.R_USEIFACE
 }
 
+// MarkFuncType records the type of fn, with its receiver as the first
+// parameter, in a marker relocation on fn's symbol. The relocation does
+// not make the type reachable; the linker hashes the type descriptor
+// into the package's ABI for -plugin-compat=loose.
+func MarkFuncType(fn *ir.Func) {
+	t := fn.Type()
+	if t.HasShape() {
+		return
+	}
+	var recv *types.Type
+	if r := t.Recv(); r != nil {
+		recv = r.Type
+	}
+	r := obj.Addrel(fn.LSym)
+	r.Sym = TypeLinksym(typecheck.NewMethodType(t, recv))
+	r.Type = objabi.R_USETYPE
+}
+
 // MarkUsedIfaceMethod marks that an interface method is used in the current
 // function. n is OCALLINTER node.
 func MarkUsedIfaceMethod(n *ir.CallExpr) {
@@ -63,6 +63,7 @@ func InitSliceBytes(nam *ir.Name, off int64, s string) {
 const (
 	stringSymPrefix  = "go.string."
 	stringSymPattern = ".gostring.%d.%x"
+	embedSymPattern  = ".goembed.%d.%x"
 )
 
 // StringSym returns a symbol containing the string s.
@@ -73,7 +74,6 @@ func StringSym(pos src.XPos, s string) (data *obj.LSym) {
 		// Huge strings are hashed to avoid long names in object files.
 		// Indulge in some paranoia by writing the length of s, too,
 		// as protection against length extension attacks.
-		// Same pattern is known to fileStringSym below.
 		h := sha256.New()
 		io.WriteString(h, s)
 		symname = fmt.Sprintf(stringSymPattern, len(s), h.Sum(nil))
@@ -97,8 +97,10 @@ func StringSym(pos src.XPos, s string) (data *obj.LSym) {
 const maxFileSize = int64(2e9)
 
 // fileStringSym returns a symbol for the contents and the size of file.
-// If readonly is true, the symbol shares storage with any literal string
-// or other file with the same content and is placed in a read-only section.
+// If readonly is true, the symbol shares storage with any other file
+// with the same content and is placed in a read-only section.
+// It is kept apart from literal strings so that the linker can tell
+// file contents from other data (see -compress-sections).
 // If readonly is false, the symbol is a read-write copy separate from any other,
 // for use as the backing store of a []byte.
 // The content hash of file is copied into hash. (If hash is nil, nothing is copied.)
@@ -125,16 +127,19 @@ func fileStringSym(pos src.XPos, file string, readonly bool, hash []byte) (*obj.
 		if int64(len(data)) != size {
 			return nil, 0, fmt.Errorf("file changed between reads")
 		}
+		sum := sha256.Sum256(data)
 		var sym *obj.LSym
 		if readonly {
-			sym = StringSym(pos, string(data))
+			sym = base.Ctxt.Lookup(stringSymPrefix + fmt.Sprintf(embedSymPattern, size, sum))
+			if !sym.OnList() {
+				off := dstringdata(sym, 0, string(data), pos, "file")
+				objw.Global(sym, int32(off), obj.DUPOK|obj.RODATA|obj.LOCAL)
+			}
 		} else {
 			sym = slicedata(pos, string(data)).Linksym()
 		}
-		if len(hash) > 0 {
-			sum := sha256.Sum256(data)
-			copy(hash, sum[:])
-		}
+		sym.Set(obj.AttrEmbed, true)
+		copy(hash, sum[:])
 		return sym, size, nil
 	}
 	if size > maxFileSize {
@@ -163,7 +168,7 @@ func fileStringSym(pos src.XPos, file string, readonly bool, hash []byte) (*obj.
 
 	var symdata *obj.LSym
 	if readonly {
-		symname := fmt.Sprintf(stringSymPattern, size, sum)
+		symname := fmt.Sprintf(embedSymPattern, size, sum)
 		symdata = base.Ctxt.Lookup(stringSymPrefix + symname)
 		if !symdata.OnList() {
 			info := symdata.NewFileInfo()
@@ -184,6 +189,7 @@ func fileStringSym(pos src.XPos, file string, readonly bool, hash []byte) (*obj.
 		info.Name = file
 		info.Size = size
 	}
+	symdata.Set(obj.AttrEmbed, true)
 
 	return symdata, size, nil
 }
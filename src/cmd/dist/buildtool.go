@@ -65,6 +65,7 @@ var bootstrapDirs = []string{
 	"internal/race",
 	"internal/unsafeheader",
 	"internal/xcoff",
+	"internal/zstd",
 	"math/big",
 	"math/bits",
 	"sort",
@@ -1254,6 +1254,12 @@ func (b *Builder) linkActionID(a *Action) cache.ActionID {
 	// Toolchain-dependent configuration, shared with b.linkSharedActionID.
 	b.printLinkerConfig(h, p)
 
+	// The files added to the output with -addsection, which the flags
+	// only name.
+	for _, file := range addSectionFiles(p.Internal.Ldflags) {
+		fmt.Fprintf(h, "addsection %q %s\n", file, b.fileHash(file))
+	}
+
 	// Input files.
 	for _, a1 := range a.Deps {
 		p1 := a1.Package
@@ -1279,6 +1285,29 @@ func (b *Builder) linkActionID(a *Action) cache.ActionID {
 	return h.Sum()
 }
 
+// addSectionFiles returns the files named by the linker flags
+// -addsection name=file[,alloc] in ldflags.
+func addSectionFiles(ldflags []string) []string {
+	var files []string
+	for i := 0; i < len(ldflags); i++ {
+		arg := strings.TrimPrefix(strings.TrimPrefix(ldflags[i], "-"), "-")
+		var val string
+		switch {
+		case arg == "addsection" && i+1 < len(ldflags):
+			i++
+			val = ldflags[i]
+		case strings.HasPrefix(arg, "addsection="):
+			val = strings.TrimPrefix(arg, "addsection=")
+		default:
+			continue
+		}
+		if eq := strings.Index(val, "="); eq >= 0 {
+			files = append(files, strings.TrimSuffix(val[eq+1:], ",alloc"))
+		}
+	}
+	return files
+}
+
 // printLinkerConfig prints the linker config into the hash h,
 // as part of the computation of a linker-related action ID.
 func (b *Builder) printLinkerConfig(h io.Writer, p *load.Package) {
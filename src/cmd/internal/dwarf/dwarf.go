@@ -900,6 +900,49 @@ var abbrevs = [DW_NABRV]dwAbbrev{
 	},
 }
 
+// abbrevs5 are the entries of abbrevs that differ in DWARF 5 units,
+// which the linker writes with -dwarf=5: the compile unit DIEs refer
+// to their strings and their base address by index, in the unit's
+// part of .debug_str_offsets and .debug_addr.
+var abbrevs5 = map[int]dwAbbrev{
+	DW_ABRV_COMPUNIT: {
+		DW_TAG_compile_unit,
+		DW_CHILDREN_yes,
+		[]dwAttrForm{
+			{DW_AT_name, DW_FORM_strx},
+			{DW_AT_language, DW_FORM_data1},
+			{DW_AT_stmt_list, DW_FORM_sec_offset},
+			{DW_AT_low_pc, DW_FORM_addrx},
+			{DW_AT_ranges, DW_FORM_sec_offset},
+			{DW_AT_comp_dir, DW_FORM_strx},
+			{DW_AT_producer, DW_FORM_strx},
+			{DW_AT_go_package_name, DW_FORM_strx},
+			{DW_AT_str_offsets_base, DW_FORM_sec_offset},
+			{DW_AT_addr_base, DW_FORM_sec_offset},
+		},
+	},
+	DW_ABRV_COMPUNIT_TEXTLESS: {
+		DW_TAG_compile_unit,
+		DW_CHILDREN_yes,
+		[]dwAttrForm{
+			{DW_AT_name, DW_FORM_strx},
+			{DW_AT_language, DW_FORM_data1},
+			{DW_AT_comp_dir, DW_FORM_strx},
+			{DW_AT_producer, DW_FORM_strx},
+			{DW_AT_go_package_name, DW_FORM_strx},
+			{DW_AT_str_offsets_base, DW_FORM_sec_offset},
+		},
+	},
+}
+
+// UseVersion5 replaces the abbrev entries that differ in DWARF 5
+// units with their DWARF 5 versions, for the rest of the process.
+func UseVersion5() {
+	for i, a := range abbrevs5 {
+		abbrevs[i] = a
+	}
+}
+
 // GetAbbrev returns the contents of the .debug_abbrev section.
 func GetAbbrev() []byte {
 	abbrevs := Abbrevs()
@@ -1014,6 +1057,10 @@ func putattr(ctxt Context, s Sym, abbrev int, form int, cls int, value int64, da
 	case DW_FORM_udata: // constant
 		Uleb128put(ctxt, s, value)
 
+	case DW_FORM_strx, // string
+		DW_FORM_addrx: // address
+		Uleb128put(ctxt, s, value)
+
 	case DW_FORM_string: // string
 		str := data.(string)
 		ctxt.AddString(s, str)
@@ -187,6 +187,9 @@ const (
 	DW_AT_elemental      = 0x66 // flag
 	DW_AT_pure           = 0x67 // flag
 	DW_AT_recursive      = 0x68 // flag
+	// Dwarf5
+	DW_AT_str_offsets_base = 0x72 // stroffsetsptr
+	DW_AT_addr_base        = 0x73 // addrptr
 
 	DW_AT_lo_user = 0x2000 // ---
 	DW_AT_hi_user = 0x3fff // ---
@@ -220,6 +223,9 @@ const (
 	DW_FORM_exprloc      = 0x18 // exprloc
 	DW_FORM_flag_present = 0x19 // flag
 	DW_FORM_ref_sig8     = 0x20 // reference
+	// Dwarf5
+	DW_FORM_strx  = 0x1a // string
+	DW_FORM_addrx = 0x1b // address
 	// Pseudo-form: expanded to data4 on IOS, udata elsewhere.
 	DW_FORM_udata_pseudo = 0x99
 )
@@ -446,6 +452,44 @@ const (
 	DW_LNE_hi_user      = 0xff
 )
 
+// Dwarf5 line number header entry formats.
+const (
+	DW_LNCT_path            = 0x1
+	DW_LNCT_directory_index = 0x2
+)
+
+// Dwarf5 unit header unit types.
+const (
+	DW_UT_compile = 0x01
+)
+
+// Dwarf5 name index attributes.
+const (
+	DW_IDX_compile_unit = 0x1
+	DW_IDX_type_unit    = 0x2
+	DW_IDX_die_offset   = 0x3
+	DW_IDX_parent       = 0x4
+	DW_IDX_type_hash    = 0x5
+)
+
+// Dwarf5 range list entries.
+const (
+	DW_RLE_end_of_list  = 0x00
+	DW_RLE_offset_pair  = 0x04
+	DW_RLE_base_address = 0x05
+	DW_RLE_start_end    = 0x06
+	DW_RLE_start_length = 0x07
+)
+
+// Dwarf5 location list entries.
+const (
+	DW_LLE_end_of_list  = 0x00
+	DW_LLE_offset_pair  = 0x04
+	DW_LLE_base_address = 0x06
+	DW_LLE_start_end    = 0x07
+	DW_LLE_start_length = 0x08
+)
+
 // Table 39
 const (
 	DW_MACINFO_define     = 0x01
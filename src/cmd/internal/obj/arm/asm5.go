@@ -565,10 +565,22 @@ func span5(ctxt *obj.Link, cursym *obj.LSym, newprog obj.ProgAlloc) {
 	bp := c.cursym.P
 	pc = int32(p.Pc) // even p->link might need extra padding
 	var v int
+	inPool := false
 	for p = p.Link; p != nil; p = p.Link {
 		c.pc = p.Pc
 		o = c.oplook(p)
 		opc = int32(p.Pc)
+
+		// Mark the bounds of the literal pools, for the linker to
+		// write mapping symbols. The padding before p is code.
+		if p.Mark&POOL != 0 && !inPool {
+			c.addmapsym(p.Pc, 'd')
+			inPool = true
+		} else if p.Mark&POOL == 0 && o.size != 0 && inPool {
+			c.addmapsym(int64(pc), 'a')
+			inPool = false
+		}
+
 		c.asmout(p, o, out[:])
 		m = int(o.size)
 
@@ -609,6 +621,15 @@ func span5(ctxt *obj.Link, cursym *obj.LSym, newprog obj.ProgAlloc) {
 	}
 }
 
+// addmapsym adds an R_MAPSYM relocation marking the start of Arm code
+// (kind 'a') or of data (kind 'd') at pc.
+func (c *ctxt5) addmapsym(pc int64, kind byte) {
+	rel := obj.Addrel(c.cursym)
+	rel.Off = int32(pc)
+	rel.Type = objabi.R_MAPSYM
+	rel.Add = int64(kind)
+}
+
 // checkpool flushes the literal pool when the first reference to
 // it threatens to go out of range of a 12-bit PC-relative offset.
 //
@@ -714,6 +735,7 @@ func (c *ctxt5) addpool(p *obj.Prog, a *obj.Addr) {
 	q := c.newprog()
 	*q = *t
 	q.Pc = int64(c.pool.size)
+	q.Mark |= POOL
 
 	if c.blitrl == nil {
 		c.blitrl = q
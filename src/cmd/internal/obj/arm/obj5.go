@@ -246,6 +246,7 @@ const (
 	FOLL  = 1 << 0
 	LABEL = 1 << 1
 	LEAF  = 1 << 2
+	POOL  = 1 << 3 // literal pool entry
 )
 
 func preprocess(ctxt *obj.Link, cursym *obj.LSym, newprog obj.ProgAlloc) {
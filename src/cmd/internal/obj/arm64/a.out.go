@@ -373,6 +373,7 @@ const (
 	LIST
 	FOLL
 	NOSCHED
+	POOL // literal pool entry
 )
 
 const (
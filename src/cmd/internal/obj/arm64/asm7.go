@@ -1063,10 +1063,22 @@ func span7(ctxt *obj.Link, cursym *obj.LSym, newprog obj.ProgAlloc) {
 	psz := int32(0)
 	var i int
 	var out [6]uint32
+	inData := false
 	for p := c.cursym.Func().Text.Link; p != nil; p = p.Link {
 		c.pc = p.Pc
 		o = c.oplook(p)
 
+		// Mark the bounds of the literal pools, for the linker to
+		// write mapping symbols. The padding that aligns the
+		// first DWORD of a pool is data.
+		if p.Mark&POOL != 0 && !inData {
+			c.addmapsym(psz, 'd')
+			inData = true
+		} else if p.Mark&POOL == 0 && (o.size != 0 || p.As == obj.APCALIGN) && inData {
+			c.addmapsym(psz, 'x')
+			inData = false
+		}
+
 		// need to align DWORDs on 8-byte boundary. The ISA doesn't
 		// require it, but the various 64-bit loads we generate assume it.
 		if o.as == ADWORD && psz%8 != 0 {
@@ -1099,6 +1111,10 @@ func span7(ctxt *obj.Link, cursym *obj.LSym, newprog obj.ProgAlloc) {
 			}
 		}
 	}
+	if int64(psz) < c.cursym.Size && !inData {
+		// The padding to funcAlign.
+		c.addmapsym(psz, 'd')
+	}
 
 	// Mark nonpreemptible instruction sequences.
 	// We use REGTMP as a scratch register during call injection,
@@ -1191,6 +1207,8 @@ func (c *ctxt7) addpool128(p *obj.Prog, al, ah *obj.Addr) {
 	t.To.Type = obj.TYPE_CONST
 	t.To.Offset = ah.Offset
 
+	q.Mark |= POOL
+	t.Mark |= POOL
 	q.Link = t
 
 	if c.blitrl == nil {
@@ -1246,6 +1264,7 @@ func (c *ctxt7) addpool(p *obj.Prog, a *obj.Addr) {
 
 	q := c.newprog()
 	*q = *t
+	q.Mark |= POOL
 	if c.blitrl == nil {
 		c.blitrl = q
 		c.pool.start = uint32(p.Pc)
@@ -1263,6 +1282,15 @@ func (c *ctxt7) addpool(p *obj.Prog, a *obj.Addr) {
 	p.Pool = q
 }
 
+// addmapsym adds an R_MAPSYM relocation marking the start of A64 code
+// (kind 'x') or of data (kind 'd') at off.
+func (c *ctxt7) addmapsym(off int32, kind byte) {
+	rel := obj.Addrel(c.cursym)
+	rel.Off = off
+	rel.Type = objabi.R_MAPSYM
+	rel.Add = int64(kind)
+}
+
 // roundUp rounds up x to "to".
 func roundUp(x, to uint32) uint32 {
 	if to == 0 || to&(to-1) != 0 {
@@ -636,6 +636,18 @@ var unaryDst = map[obj.As]bool{
 
 // Instruction encoding masks.
 const (
+	// BTypeImmMask is a mask including only the immediate portion of
+	// B-type instructions.
+	BTypeImmMask = 0xfe000f80
+
+	// CBTypeImmMask is a mask including only the immediate portion of
+	// CB-type instructions.
+	CBTypeImmMask = 0x1c7c
+
+	// CJTypeImmMask is a mask including only the immediate portion of
+	// CJ-type instructions.
+	CJTypeImmMask = 0x1ffc
+
 	// JTypeImmMask is a mask including only the immediate portion of
 	// J-type instructions.
 	JTypeImmMask = 0xfffff000
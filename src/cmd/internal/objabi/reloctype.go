@@ -81,6 +81,7 @@ const (
 	// linker uses this as a signal that the pointed-to type information
 	// should be linked into the final binary, even if there are no other
 	// direct references. (This is used for types reachable by reflection.)
+	// On a function symbol, it names the type of the function.
 	R_USETYPE
 	// R_USEIFACE marks a type is converted to an interface in the function this
 	// relocation is applied to. The target is a type descriptor.
@@ -246,6 +247,50 @@ const (
 	// address using an AUIPC + S-type instruction pair.
 	R_RISCV_TLS_IE_STYPE
 
+	// R_RISCV_PCREL_HI20 resolves the high 20 bits of a 32-bit PC-relative
+	// address into an AUIPC instruction.
+	R_RISCV_PCREL_HI20
+
+	// R_RISCV_PCREL_LO12_I resolves the low 12 bits of the PC-relative
+	// address of the R_RISCV_PCREL_HI20 relocation at the address of its
+	// symbol into an I-type instruction.
+	R_RISCV_PCREL_LO12_I
+
+	// R_RISCV_PCREL_LO12_S resolves the low 12 bits of the PC-relative
+	// address of the R_RISCV_PCREL_HI20 relocation at the address of its
+	// symbol into an S-type instruction.
+	R_RISCV_PCREL_LO12_S
+
+	// R_RISCV_BRANCH resolves a 13-bit PC-relative branch offset into a
+	// B-type instruction.
+	R_RISCV_BRANCH
+
+	// R_RISCV_RVC_BRANCH resolves a 9-bit PC-relative branch offset into
+	// a compressed CB-type instruction.
+	R_RISCV_RVC_BRANCH
+
+	// R_RISCV_RVC_JUMP resolves a 12-bit PC-relative jump offset into a
+	// compressed CJ-type instruction.
+	R_RISCV_RVC_JUMP
+
+	// R_RISCV_ADD adds the address of the symbol to the value at the
+	// relocated location. Host objects pair it with R_RISCV_SUB to compute
+	// the distance between two labels, which the assembler cannot know if
+	// the linker may relax the code between them.
+	R_RISCV_ADD
+
+	// R_RISCV_SUB subtracts the address of the symbol from the value at
+	// the relocated location.
+	R_RISCV_SUB
+
+	// R_RISCV_SET6 sets the low 6 bits of a byte to the address of the
+	// symbol, leaving its high 2 bits unchanged.
+	R_RISCV_SET6
+
+	// R_RISCV_SUB6 subtracts the address of the symbol from the low 6 bits
+	// of a byte, leaving its high 2 bits unchanged.
+	R_RISCV_SUB6
+
 	// R_PCRELDBL relocates s390x 2-byte aligned PC-relative addresses.
 	// TODO(mundaym): remove once variants can be serialized - see issue 14218.
 	R_PCRELDBL
@@ -269,6 +314,16 @@ const (
 	// in a symbol and target any symbols.
 	R_XCOFFREF
 
+	// R_MAPSYM (only used on arm and arm64) marks the start of a region of
+	// the text of a function holding Arm code, Thumb code, A64 code or
+	// data, such as a literal pool, as Add is 'a', 't', 'x' or 'd'. The
+	// region extends to the next R_MAPSYM relocation or the end of the
+	// function, which starts with Arm or A64 code. This is a marker
+	// relocation (0-sized), from which the linker writes the $a, $t, $x
+	// and $d mapping symbols of the ELF symbol table, so that
+	// disassemblers do not decode data as instructions.
+	R_MAPSYM
+
 	// R_WEAK marks the relocation as a weak reference.
 	// A weak relocation does not make the symbol it refers to reachable,
 	// and is only honored by the linker if the symbol is in some other way
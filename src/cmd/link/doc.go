@@ -17,7 +17,11 @@ Flags:
 
 	-B note
 		Add an ELF_NT_GNU_BUILD_ID note when using ELF.
-		The value should start with 0x and be an even number of hex digits.
+		The value should start with 0x and be an even number of hex digits,
+		or be gobuildid, to derive a 20-byte note from the Go build ID
+		(see -buildid), which is the same for identical builds and changes
+		when the build changes. When linking externally, the note is
+		passed to the external linker with --build-id.
 	-D address
 		Set data segment address.
 	-E entry
@@ -27,7 +31,7 @@ Flags:
 		The default format is inferred from GOOS and GOARCH.
 		On Windows, -H windowsgui writes a "GUI binary" instead of a "console binary."
 	-I interpreter
-		Set the ELF dynamic linker to use.
+		Set the ELF dynamic linker to use. Same as -interp.
 	-L dir1 -L dir2
 		Search for imported packages in dir1, dir2, etc,
 		after consulting $GOROOT/pkg/$GOOS_$GOARCH.
@@ -45,18 +49,88 @@ Flags:
 		Note that before Go 1.5 this option took two separate arguments.
 	-a
 		Disassemble output.
+	-abiwrapper-alias
+		In the ELF symbol table, give the ABI wrappers the names of
+		the functions they wrap, so that profilers such as perf
+		attribute the samples in a wrapper to its function, and mark
+		each wrapper with a zero-size local alias named after its
+		ABI, such as f.abi0. Without this flag, the function of the
+		pair in ABI0 is named with an .abi0 suffix instead.
+	-addsection name=file[,alloc]
+		Add the contents of file to the output as a section named name,
+		as objcopy --add-section would. The section is not loaded, and
+		is appended to the output after any external link. With flag
+		alloc, it is loaded read-only, name must be a C identifier, and
+		the program finds the section between the symbols __start_name
+		and __stop_name. The go command includes the contents of file
+		in the build ID. Can be repeated. Only supported for ELF.
+	-allow-textrel
+		When linking a PIE internally, allow host object code compiled
+		without -fPIC to hold 64-bit absolute addresses, which the dynamic
+		linker then fixes up by writing to the text segment (DT_TEXTREL).
+		Without this flag, such a relocation is an error.
+	-allow-wx
+		Allow the output to contain a segment that is both writable and
+		executable. Such a segment is only created for a host object
+		section that is writable and executable and defines both code
+		and data, which makes the whole text segment writable; without
+		this flag, linking such an object is an error naming the section.
+		The linker also checks the final loadable segments, and fails if
+		any page would be mapped both writable and executable.
 	-asan
 		Link with C/C++ address sanitizer support.
+		Such programs are linked externally by default; on linux/amd64
+		they can also be linked with -linkmode=internal, if the C
+		compiler links them with a shared ASan runtime (libasan.so or
+		libclang_rt.asan-x86_64.so), not a static one.
+	-bindnow
+		Have the dynamic linker bind all dynamic symbols when the program
+		starts, rather than on first call (DT_FLAGS DF_BIND_NOW), so that
+		the GOT and PLT entries can be read-only once bound, which is
+		known as full RELRO. This makes startup slower for programs that
+		import many C functions. When linking internally, .got and
+		.got.plt are placed in the PT_GNU_RELRO segment; when linking
+		externally, -z now is passed to the host linker. ELF only.
 	-buildid id
 		Record id as Go toolchain build id.
 	-buildmode mode
 		Set build mode (default exe).
+		On ELF systems on amd64 and arm64, a c-archive is checked for
+		relocations that cannot be used in a PIE or shared library,
+		such as those in packages not compiled with -shared, and the
+		link fails if there are any, unless -skip-pic-check is given.
 	-c
 		Dump call graphs.
-	-compressdwarf
-		Compress DWARF if possible (default true).
+	-cfprotection features
+		Assert that the Go code supports the comma-separated
+		control-flow protection features: bti and pac on arm64, ibt
+		and shstk on amd64 and 386.
+		When linking internally, they are recorded in a
+		.note.gnu.property note and PT_GNU_PROPERTY segment, less those
+		that a host object does not declare in its own property note.
+		When linking externally, they are recorded in the note of the
+		Go object, for the host linker to merge with the other notes.
+	-compress-sections
+		Write the contents of the files embedded with //go:embed
+		compressed, and inflate them in memory when the program or
+		plugin starts, before any package is initialized. This makes
+		the output smaller at the cost of startup time, and the memory
+		the data uses is no longer shared between processes. Has no
+		effect if the data does not compress.
+	-compressdwarf=method
+		Compress DWARF if possible, with method zlib, zstd or none
+		(default zlib). On ELF the sections are marked SHF_COMPRESSED;
+		reading zstd sections needs tools that support zstd. When
+		linking externally, zstd falls back to zlib if the host linker
+		does not support it. -compressdwarf=false is the same as none.
 	-cpuprofile file
-		Write CPU profile to file.
+		Write a CPU profile of the link to file, for go tool pprof. The
+		profile covers the whole link, including the wait for the
+		external linker, but not the CPU time of the external linker
+		itself. It is written even if the link fails. -benchmark can be
+		used with -cpuprofile, but -benchmarkprofile then writes only the
+		memory profiles of the phases, as only one CPU profile can run
+		at a time.
 	-d
 		Disable generation of dynamic executables.
 		The emitted code is the same in either case; the option
@@ -64,10 +138,110 @@ Flags:
 		The dynamic header is on by default, even without any
 		references to dynamic libraries, because many common
 		system tools now assume the presence of the header.
+	-debug-prefix-map old=new
+		Replace the leading old in the file paths written to the output,
+		the source file names of the symbol and DWARF tables and the
+		GOROOT reported by runtime.GOROOT, with new. Can be repeated,
+		the last matching option is used. With -trimpath, which hides
+		GOROOT, this lets builds in different directories produce the
+		same output.
+	-debugarglen n
+		Debug the response file of the external linker: pass it the
+		arguments in a response file once they exceed n bytes, rather
+		than 30 KB. The file, hostlink.rsp, is written to the -tmpdir.
+	-debugearlygot symbol
+		Debug the check of the -static-pie startup code: make the
+		entry point load the address of symbol from the GOT, which
+		the check reports. Only supported on linux/amd64.
 	-debugtramp int
 		Debug trampolines.
-	-dumpdep
-		Dump symbol dependency graph.
+	-dumpdep[=format[:file]]
+		Dump symbol dependency graph, as the dead code pass reaches
+		each symbol, to standard output or to file. The format is text
+		(the default), one "from -> to" line per edge, or json, one
+		object per line with the name, package and size of both
+		symbols, and the reason the symbol is reached: root, reloc,
+		aux, usediface, method or carrier.
+	-dumpdepfilter regexp
+		With -dumpdep, only dump the edges with a symbol whose name
+		matches regexp.
+	-dumpgot file
+		Write the GOT and PLT entries the linker creates to file, one
+		per line: got or plt, the symbol, why it is reached through
+		the entry (dynimport, ifunc, tls, weakundef, unresolved or
+		unrelaxed), and the packages referring to it. Comment lines
+		at the top count the entries for each reason. When linking externally, the
+		external linker creates the GOT and PLT, and the file lists no
+		entries.
+	-dumpreloc file
+		Write the relocations passed to the external linker to file,
+		one per line: the section, the symbol and offset being
+		relocated, the target symbol and addend, the Go relocation
+		type, and the object file relocation types chosen for it.
+		The output is sorted, so that it can be compared across links.
+	-dwarf version
+		Write DWARF version 4 (the default) or 5. Version 5 is only
+		supported for ELF. Its line tables, range and location lists
+		use the DWARF 5 encodings, in .debug_rnglists and
+		.debug_loclists, and the compilation units refer to their
+		strings and base address through .debug_str_offsets and
+		.debug_addr. The line tables have no MD5 checksums.
+	-dwarfnames
+		With -dwarf=5, also write a .debug_names index of the named
+		types, functions, inlined calls and global variables of the
+		Go compilation units, which debuggers use to look up names
+		without reading all of the DWARF first. Inlined calls are
+		indexed under the name of the function called.
+	-ehframe
+		Write the call frame information of the Go functions to a loaded
+		.eh_frame section, with an .eh_frame_hdr index found through the
+		PT_GNU_EH_FRAME segment, so that unwinders such as those of
+		libgcc, libunwind and perf can unwind through Go code at run
+		time. When linking externally, the index is built by the
+		external linker, with --eh-frame-hdr. Only supported for ELF
+		on amd64 and arm64.
+	-emitreloc
+		Keep the relocations applied to the allocated sections in the
+		output, in non-allocated .rela sections referring to .symtab,
+		like the --emit-relocs option of the GNU linkers, so that
+		post-link optimizers such as BOLT can move the code around.
+		Relocations that compute offsets rather than addresses, such
+		as those of thread-local variables, are left out. When linking
+		externally, --emit-relocs is passed to the external linker,
+		and its symbol table, which the relocations refer to, is kept
+		as is. ELF only, and on amd64 and arm64 when linking
+		internally. It cannot be used with -s.
+	-errorlimit n
+		Stop after n errors, or never if n is 0. By default the linker
+		stops after 20 errors. The symbols that are referenced but not
+		defined are reported together as one error, listing each once
+		for each package referring to it; by default all of them are
+		listed, and with -errorlimit at most n, followed by the number
+		of the others.
+	-exportdynamic
+		Export from the executable, in addition to the functions
+		exported with //export, every global symbol of default
+		visibility defined by the C code of the packages and by the
+		.syso files, as the -rdynamic option of the C compilers does,
+		so that the shared libraries the program opens with dlopen can
+		look them up. When linking externally, -rdynamic is passed to
+		the external linker regardless. Combine with -exportsymbols to
+		export only some of them. Only supported with -buildmode=exe
+		and pie for ELF targets, and not with -d.
+	-exportsymbols file
+		Export from the C shared library only the symbols listed in
+		file, one name per line, with comments starting with #. Every
+		other symbol, including the C symbols of runtime/cgo and of
+		the packages, is made local with a version script passed to
+		the external linker. A listed symbol the library does not
+		define is reported. A name may be followed by @version, as in
+		Add@LIBFOO_1.0, to attach the symbol to that version node;
+		the versions inherit from each other in the order they first
+		appear, and either every symbol has a version or none has.
+		With -buildmode=exe or pie, limits the symbols the executable
+		exports the same way; when linking internally, the names
+		cannot have versions. Only supported with -buildmode=exe, pie
+		and c-shared for ELF targets.
 	-extar ar
 		Set the external archive program (default "ar").
 		Used only for -buildmode=c-archive.
@@ -77,14 +251,62 @@ Flags:
 		Set space-separated flags to pass to the external linker.
 	-f
 		Ignore version mismatch in the linked archives.
+	-funcalign n
+		Align each function in the text section to n bytes instead of the
+		architecture's default, such as 32 bytes on amd64 and 16 bytes on
+		arm64, for example to measure the effect of the alignment on
+		instruction fetch and branch prediction. n must be a power of two
+		no smaller than the default. It also applies to functions that
+		ask for a smaller alignment of their own, and to trampolines. The
+		padding between functions is filled with the architecture's trap
+		instruction or with zeros.
 	-g
 		Disable Go package data checks.
+	-guard-moduledata
+		Place runtime.firstmoduledata, the structure describing the
+		program to the runtime, in read-only memory, with the pclntab and
+		the typelink and itablink tables it points to: the read-only data
+		segment, or the relro segment, which the dynamic linker makes
+		read-only once it has relocated it, when building a position
+		independent executable or a shared object. A stray write to any
+		of them then faults immediately. The state the runtime keeps
+		about the module is allocated separately. Only supported on
+		linux/amd64 and linux/arm64.
+	-hash-style style
+		Set the hash tables written for the dynamic symbols of an ELF
+		output: sysv writes .hash, gnu writes .gnu.hash, which dynamic
+		linkers search faster, and both writes the two. The default is
+		both, except on mips and mips64, where only sysv is supported.
+		When linking externally, the style is passed on to the external
+		linker only if set.
+	-ignore-experiment-mismatch
+		Link packages compiled with different GOEXPERIMENT settings.
+		By default the linker refuses them, listing the packages whose
+		experiments differ from those of the main package.
 	-importcfg file
 		Read import configuration from file.
 		In the file, set packagefile, packageshlib to specify import resolution.
 	-installsuffix suffix
 		Look for packages in $GOROOT/pkg/$GOOS_$GOARCH_suffix
 		instead of $GOROOT/pkg/$GOOS_$GOARCH.
+	-interpose
+		Keep references from Go code to symbols in host libraries
+		preemptible, so that a library loaded with LD_PRELOAD can
+		interpose on them. Calls are made through the PLT and
+		-Bsymbolic is not passed to the external linker. The link
+		fails if a reference would be bound directly.
+		Only supported with -buildmode=c-archive and c-shared on ELF.
+	-interposereport file
+		Write the references from Go code to symbols defined outside
+		the Go object to file, one per line, with how each is bound:
+		plt, got, abs (dynamic relocation), or direct.
+	-interp path
+		Use path as the ELF program interpreter (PT_INTERP) of the
+		executable instead of the default for the target, such as
+		/lib/ld-musl-x86_64.so.1. Also passed to the external linker
+		and used for programs linked with -linkshared. Only supported
+		with -buildmode=exe and pie; statically linked programs have
+		no interpreter.
 	-k symbol
 		Set field tracking symbol. Use this flag when GOEXPERIMENT=fieldtrack is set.
 	-libgcc file
@@ -99,33 +321,287 @@ Flags:
 	-linkshared
 		Link against installed Go shared libraries (experimental).
 	-memprofile file
-		Write memory profile to file.
+		Write a profile of the memory allocated during the link to file,
+		for go tool pprof, at the end of the link, even if it fails.
+		-benchmark and -benchmarkprofile can be used with -memprofile;
+		-benchmark=mem collects garbage between the phases, which does
+		not change the allocations profiled.
 	-memprofilerate rate
-		Set runtime.MemProfileRate to rate.
+		Set runtime.MemProfileRate to rate, for -memprofile and the
+		memory profiles of -benchmarkprofile.
+	-metadata file
+		Write to file a zip archive of JSON tables describing the output,
+		for binary analysis tools: build.json (the target, build settings
+		and build ID), symbols.json (each symbol in the output with its
+		package, kind, section, address and size), roots.json (the symbols
+		dead code elimination started from), itabs.json (each itab with its
+		interface and type), typelinks.json (the types in the typelinks
+		table) and xflags.json (the string variables set with -X). Each
+		file is an object with a "schema" version; fields are only added
+		within a version.
 	-msan
 		Link with C/C++ memory sanitizer support.
 	-n
 		Dump symbol table.
 	-o file
 		Write output to file (default a.out, or a.out.exe on Windows).
+	-o-stripped file
+		Also write a copy of the output without the symbol table and
+		DWARF debug information to file. The copy is made from the
+		output, so its code and data are identical, and it has the same
+		build IDs, including the one the go command records. Only
+		supported for ELF and Mach-O executables and shared libraries.
+	-orderfile file
+		Place the functions listed in file, one symbol name per line as
+		shown by go tool nm, first in the text section, in the order
+		listed, for example to group the functions that a profile shows
+		to be hot. The other functions follow in their usual order.
+		Blank lines and lines starting with # are ignored. Names that
+		match no function are reported with a warning.
+	-pack-relative-relocs
+		Pack the relative dynamic relocations of a position-independent
+		executable, which are most of them, into a compact DT_RELR table
+		(.relr.dyn) instead of .rela. The dynamic linker must support
+		DT_RELR, as glibc 2.36, musl 1.2.4 and Android do. With external
+		linking, -z pack-relative-relocs is passed to the linker if it
+		supports it. Only supported for ELF; internal linking packs them
+		on amd64 and arm64.
+	-package-note json
+		Add a .note.package note, in its own PT_NOTE segment, with the
+		package metadata json, a JSON object such as
+		{"type":"rpm","name":"foo","version":"1.0-1"}, as specified by
+		https://systemd.io/ELF_PACKAGE_METADATA/. The value may also be
+		@file, to read the metadata from file. When linking externally,
+		the note is added to the Go object for the host linker to keep.
+		Only supported for ELF.
+	-plugin-compat mode
+		Set how package hashes are recorded for the plugin version check.
+		The default, strict, records the package fingerprint, so any
+		change to a package causes a mismatch. In loose mode, only the
+		names of a package's symbols, the sizes of its data, its type
+		descriptors and the types and argument frames of its functions are
+		hashed, so changes that do not affect the ABI, such as function
+		bodies, file paths or debug flags, do not. The host program and
+		its plugins must agree.
+	-pluginhost file
+		When linking a plugin, leave out the type descriptors that the
+		program in file exports, along with the code and data only they
+		refer to, and use the program's descriptors when the plugin is
+		loaded. The packages the plugin and the program share must be
+		the same, and the plugin then fails to open in a program that
+		does not export these descriptors. Only supported for ELF.
 	-pluginpath path
 		The path name used to prefix exported plugin symbols.
+	-print-config mode
+		Once the inputs are loaded and the link mode is decided, print
+		as JSON on standard output the effective value of every flag,
+		the flags set on the command line, the decisions derived from
+		them, such as the link mode and why it was chosen, the ELF
+		interpreter and the DWARF compression, and the packages, host
+		objects and shared libraries loaded, with their SHA-256.
+		With mode continue the link then proceeds; with mode exit the
+		linker stops without writing the output file.
 	-r dir1:dir2:...
 		Set the ELF dynamic linker search path.
 	-race
 		Link with race detection libraries.
+	-randlayout seed
+		Shuffle the functions in the text section in an order determined
+		by seed, to measure how much the performance of a program depends
+		on its code layout by benchmarking builds with different seeds.
+		The output is reproducible for a given seed. A seed of 0, the
+		default, keeps the usual order. With -orderfile, the functions
+		not listed in the order file are shuffled.
+	-reserve-section name=size[,flags]
+		Reserve a zero-filled, page-aligned section named name, such as
+		.license, of size bytes, for data written into the output file
+		after linking. The section is read-only, or writable with flag rw.
+		The program finds it through the uintptr variables
+		go.reserve.license.start and go.reserve.license.size, which it
+		declares with //go:linkname. Writing the section does not change
+		the build ID. On darwin the output must be signed again, for
+		example with codesign -f -s -. Can be repeated. Only supported for
+		ELF, and for Mach-O when linking internally.
 	-s
-		Omit the symbol table and debug information.
+		Omit the symbol table and debug information. Same as
+		-strip=symtab,dwarf, except on darwin, where it is the same as
+		-strip=symtab.
+	-sectlayout file
+		Place sections of host objects in output sections of their own,
+		as described by file, a restricted GNU ld linker script of the form
+		"SECTIONS { .name [address] : [ALIGN(n)] { [KEEP](*(pattern ...)) ... } }
+		INSERT AFTER|BEFORE .section;". The output sections are placed next
+		to the named data section of the Go program, in its segment, at the
+		given address if any. Input sections in KEEP are kept even if unused.
+		Only supported for ELF targets when linking internally.
+	-separate-code
+		Map the ELF and program headers, the interpreter name and the
+		notes on pages of their own, read-only, rather than as part of
+		the text segment, so that only code is executable, as with the
+		-z separate-code option of GNU ld. The read-only and writable
+		data already have segments of their own. This adds at most a
+		page (-R) to the file. When linking externally, -z separate-code
+		is passed to the host linker. ELF only; cannot be used with
+		-allow-wx.
 	-shared
 		Generated shared object (implies -linkmode external; experimental).
+	-skip-extlink-check
+		Do not check the output of the external linker. By default, after
+		linking externally, the linker checks that the sections and symbols
+		the Go runtime depends on, such as the build information, the
+		pclntab and the module data, are still present and intact.
+	-skip-pic-check
+		Do not check that a c-archive can be linked into a PIE or a shared
+		library (see -buildmode), for an archive that is only linked into
+		programs that are not position independent.
+	-sizecheck file
+		Fail if the output exceeds one of the size limits in file, given
+		one per line as "total <= size", "section name <= size" or
+		"package path <= size", where path may end in "/..." to include
+		the packages below it, and size may have a suffix B, KB, MB, GB,
+		KiB, MiB or GiB. Each limit exceeded is reported with the largest
+		contributors to its size.
+	-sizereport file
+		Write a JSON report of the size of the output to file, by section
+		and by package, once it is laid out. The size of each section is
+		split between the packages of its symbols and the padding between
+		them. Symbols created by the linker are reported as "(linker)",
+		the DWARF sections as "(DWARF)", and the symbols of host objects
+		as "pkg(file.o)". When linking externally, the report is of the
+		Go code passed to the external linker.
+	-soname name
+		Record name as the DT_SONAME of the shared library, the name
+		under which programs linked against it look for it at run time.
+		When linking externally, the external linker is passed -soname.
+		Only supported with -buildmode=c-shared and -buildmode=shared
+		for ELF targets.
+	-splitdwarf file
+		Move the DWARF debug information and a copy of the symbol table
+		of the output to file, and add a .gnu_debuglink section naming
+		file to the output, like objcopy --only-keep-debug and
+		--add-gnu-debuglink. Debuggers load file when it is next to the
+		output. The DWARF is compressed in file as -compressdwarf says.
+		file has the ELF build ID note of the output, if any. As the go
+		command completes the Go build ID of the output after the link,
+		that of file is the build ID given to the linker. With
+		-strip=symtab, the symbol table is only in file. ELF only, and
+		not with -buildmode=c-archive.
+	-splittextsize size
+		Split the text into sections of at most size bytes, each with a
+		runtime.text.N symbol at its start, or do not split it if size
+		is 0. By default, the text is split only when linking externally
+		on ppc64 and ppc64le, and on darwin/arm64, so that the external
+		linker can insert its stubs for the calls between the sections.
+		size can be at most 0x1c00000 on ppc64 and ppc64le and 0x7c00000
+		on arm64, so that the direct calls within a section reach. On
+		ppc64 and ppc64le, the text cannot go unsplit when linking
+		externally. Only ppc64, ppc64le and arm64.
+	-static-pie
+		With -buildmode=pie, link an executable that can be loaded at any
+		address but needs no dynamic linker: it has no program interpreter
+		and needs no shared libraries. When linking internally, the
+		executable applies its relative relocations itself before the
+		runtime starts, so it cannot import symbols of shared libraries,
+		and its read-only relocated data (relro) stays writable. The
+		linker reports the references of the startup code through the
+		GOT or PLT that the executable would read before, or without,
+		their relocation. When
+		linking externally, which needs cgo, the external linker is
+		passed -static-pie and the C library relocates the executable.
+		Only supported on linux/amd64 and linux/arm64.
+	-strictwarnings
+		Treat warnings as errors. The linker warns, for example, when a
+		cgo export has the name of a function or variable of the C
+		library, or of a symbol imported from a shared library, since
+		the export would interpose on it, and when the external linker
+		hid or discarded a function of a C shared library exported with
+		//export, for example with a version script.
+	-strip parts
+		Leave the comma-separated parts out of the output. Can be
+		repeated. The parts are:
+			sections
+				The section header table and the sections that are
+				not loaded, like objcopy --strip-sections, for the
+				smallest binary that runs. It implies -s and -w. The
+				program headers, the dynamic section and the notes,
+				including the build ID ones that go version and go tool
+				buildid read, are kept. Tools that find the Go tables
+				by section name, such as go tool nm and objdump and the
+				debug/gosym package, cannot read the output. When
+				linking externally, the output of the external linker
+				is rewritten. ELF only, and not with -buildmode=c-archive
+				or shared.
+			symtab
+				The symbol table, keeping the DWARF data, which
+				debuggers use instead. ELF only.
+			locals
+				The symbols the compiler and the linker generate for
+				their own use, such as floating-point constants
+				($f64.*), static temporaries (..stmp_*) and mapping
+				symbols, from the symbol table. ELF only.
+			dwarf
+				The DWARF data, like -w.
+		The pclntab, which the runtime uses, and the dynamic symbol
+		table are never stripped. When linking externally, the parts
+		are removed from the output of the external linker.
+	-sysoselect file
+		Load the .syso files named in file only when linking for one of
+		their targets. The file is a JSON object mapping file names to
+		lists of GOOS/GOARCH targets, such as
+		{"blake3-x86.syso": ["linux/amd64", "windows/amd64"]}. Archive
+		members are matched on the first 16 bytes of their names. Other
+		.syso files whose names end in _GOOS_GOARCH, _GOOS or _GOARCH
+		are loaded only for those targets, as in the go command. With
+		-v, the linker reports the objects it skips.
+	-textalign n
+		Align the text segment, which holds the code and, unless
+		-separate-code is given, the ELF headers before it, to n bytes
+		both in memory and in the file, and record n as its alignment in
+		the program header, so that the kernel can map the code with
+		huge pages of that size, for example -textalign=0x200000 for the
+		2MB pages of amd64. n must be a power of two no smaller than the
+		-R rounding quantum. The default text address is rounded up to a
+		multiple of n; an address given with -T must already be one.
+		When linking externally, -z max-page-size=n is passed to the host
+		linker instead, which aligns all the segments. ELF only.
 	-tmpdir dir
 		Write temporary files to dir.
 		Temporary files are only used in external linking mode.
+	-tracefile file
+		Write the time each phase of the link takes to file, in the
+		Chrome trace event format that chrome://tracing and Perfetto
+		display, with the memory allocated during the phase and the size
+		of the heap at its end. The phases are those timed by -benchmark.
+		The runs of the external linker and of the tools run after it are
+		sub-phases of the hostlink phase. If the link fails, the phases
+		up to the failure are written.
 	-u
 		Reject unsafe packages.
+	-unresolved mode
+		Set what to do with symbols that host objects refer to but no
+		object or library defines: error, the default, reports them;
+		warn prints a warning for each; warn and ignore complete the
+		link. When linking internally, such a symbol has address 0 in
+		an executable, and is left for the dynamic linker to bind in
+		other build modes, which fails for a function only once it is
+		called. When linking externally, the external linker is passed
+		--warn-unresolved-symbols or --unresolved-symbols=ignore-all.
+		Undefined symbols of Go code are always an error. ELF only.
 	-v
 		Print trace of linker operations.
 	-w
-		Omit the DWARF symbol table.
+		Omit the DWARF symbol table. Same as -strip=dwarf.
+	-wholearchive pattern
+		Link in all members of the host archives named in cgo LDFLAGS
+		whose file name matches pattern (see path/filepath.Match), even
+		those that define no referenced symbol. With external linking,
+		the archives are passed with --whole-archive (-force_load on
+		darwin). May be repeated.
+	-whyalive pattern
+		Print, at the end of the link, why each symbol whose name
+		matches pattern (see path/filepath.Match) is in the output: the
+		shortest chain of calls and references from the entry point or
+		another root of the dead code elimination, or that no matching
+		symbol is reachable. May be repeated.
 */
 package main
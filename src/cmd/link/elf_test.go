@@ -8,15 +8,25 @@
 package main
 
 import (
+	"bytes"
 	"cmd/internal/sys"
+	"cmd/link/internal/loadelf"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"debug/dwarf"
 	"debug/elf"
+	"debug/gosym"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"internal/testenv"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -44,6 +54,77 @@ func getCCAndCCFLAGS(t *testing.T, env []string) (string, []string) {
 	return cc, cflags
 }
 
+// writeTestFiles writes files, by slash-separated name, to a new
+// directory and returns the directory.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		name = filepath.FromSlash(name)
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// goBuildCmd returns the command running go build with args in dir,
+// with env added to the environment.
+func goBuildCmd(t *testing.T, dir string, env []string, args ...string) *exec.Cmd {
+	cmd := exec.Command(testenv.GoToolPath(t), append([]string{"build"}, args...)...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// goBuild runs go build with args in dir, with env added to the
+// environment, and fails t if it fails.
+func goBuild(t *testing.T, dir string, env []string, args ...string) {
+	t.Helper()
+	cmd := goBuildCmd(t, dir, env, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+}
+
+// buildTestProgram writes files, by name, to a new directory, builds
+// the program in it with -ldflags=ldflags and returns the directory
+// and the path of the program.
+func buildTestProgram(t *testing.T, files map[string]string, ldflags string) (dir, exe string) {
+	t.Helper()
+	dir = writeTestFiles(t, files)
+	exe = filepath.Join(dir, "main")
+	goBuild(t, dir, nil, "-ldflags="+ldflags, "-o", exe)
+	return dir, exe
+}
+
+// runTestProgram runs exe and returns its output, without the white
+// space around it, failing t if exe fails.
+func runTestProgram(t *testing.T, exe string) string {
+	t.Helper()
+	out, err := exec.Command(exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", exe, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// openELF opens the ELF file, which is closed when t finishes.
+func openELF(t *testing.T, file string) *elf.File {
+	t.Helper()
+	ef, err := elf.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ef.Close() })
+	return ef
+}
+
 var asmSource = `
 	.section .text1,"ax"
 s1:
@@ -201,6 +282,83 @@ func TestMinusRSymsWithSameName(t *testing.T) {
 	}
 }
 
+// TestDuplicateHostSymbols checks that a symbol defined both by Go and
+// a host object, or by two host objects, is reported with the objects
+// defining it.
+func TestDuplicateHostSymbols(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		gosrc string
+		csrcs map[string]string
+		want  []string
+	}{
+		{
+			name: "go-c",
+			gosrc: `package main
+
+import _ "unsafe"
+
+//go:linkname goDup dup
+func goDup() int { return 2 }
+
+func main() { println(goDup()) }
+`,
+			csrcs: map[string]string{"c.syso": "int dup(void) { return 1; }\n"},
+			want:  []string{"duplicate symbol dup:", "defined by Go package main", "main.go:6", "c.syso), section .text", "strong"},
+		},
+		{
+			name:  "c-c",
+			gosrc: goSource,
+			csrcs: map[string]string{
+				"a.syso": "__attribute__((weak)) int dup(void) { return 1; }\n",
+				"b.syso": "int dup(void) { return 2; }\n",
+			},
+			want: []string{"duplicate symbol dup:", "a.syso), section .text", "weak", "b.syso), section .text", "strong"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			env := append(os.Environ(), "GOPATH="+filepath.Join(dir, "GOPATH"))
+			cc, cflags := getCCAndCCFLAGS(t, env)
+			for name, src := range test.csrcs {
+				csrc := filepath.Join(t.TempDir(), "x.c")
+				if err := ioutil.WriteFile(csrc, []byte(src), 0666); err != nil {
+					t.Fatal(err)
+				}
+				if out, err := exec.Command(cc, append(cflags, "-c", "-o", filepath.Join(dir, name), csrc)...).CombinedOutput(); err != nil {
+					t.Fatalf("%s: %v\n%s", cc, err, out)
+				}
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module dup\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(test.gosrc), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-linkmode=internal", "-o", os.DevNull)
+			cmd.Dir = dir
+			cmd.Env = env
+			out, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("link succeeded:\n%s", out)
+			}
+			for _, want := range test.want {
+				if !bytes.Contains(out, []byte(want)) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
 const pieSourceTemplate = `
 package main
 
@@ -251,8 +409,13 @@ func TestPIESize(t *testing.T) {
 		}
 	}
 
-	for _, external := range []bool{false, true} {
-		external := external
+	for _, test := range []struct{ external, separateCode bool }{
+		{false, false},
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		external, separateCode := test.external, test.separateCode
 
 		name := "TestPieSize-"
 		if external {
@@ -260,6 +423,9 @@ func TestPIESize(t *testing.T) {
 		} else {
 			name += "internal"
 		}
+		if separateCode {
+			name += "-separate-code"
+		}
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
@@ -276,8 +442,15 @@ func TestPIESize(t *testing.T) {
 
 			build := func(bin, mode string) error {
 				cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", bin, "-buildmode="+mode)
+				var ldflags []string
 				if external {
-					cmd.Args = append(cmd.Args, "-ldflags=-linkmode=external")
+					ldflags = append(ldflags, "-linkmode=external")
+				}
+				if separateCode {
+					ldflags = append(ldflags, "-separate-code")
+				}
+				if ldflags != nil {
+					cmd.Args = append(cmd.Args, "-ldflags="+strings.Join(ldflags, " "))
 				}
 				cmd.Args = append(cmd.Args, "pie.go")
 				cmd.Dir = dir
@@ -320,17 +493,9 @@ func TestPIESize(t *testing.T) {
 				sizepie = uint64(fi.Size())
 			}
 
-			elfexe, err := elf.Open(binexe)
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer elfexe.Close()
+			elfexe := openELF(t, binexe)
 
-			elfpie, err := elf.Open(binpie)
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer elfpie.Close()
+			elfpie := openELF(t, binpie)
 
 			// The difference in size between exe and PIE
 			// should be approximately the difference in
@@ -411,3 +576,5573 @@ func TestPIESize(t *testing.T) {
 		})
 	}
 }
+
+func TestPackRelativeRelocs(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "pie.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := template.Must(template.New("pie").Parse(pieSourceTemplate))
+	if err := tmpl.Execute(f, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// relocs returns the number of relative relocations in the SHT_RELA
+	// sections of the file, and the SHT_RELR section, if any.
+	relocs := func(t *testing.T, ef *elf.File) (int, *elf.Section) {
+		var relative uint32
+		switch ef.Machine {
+		case elf.EM_X86_64:
+			relative = uint32(elf.R_X86_64_RELATIVE)
+		case elf.EM_AARCH64:
+			relative = uint32(elf.R_AARCH64_RELATIVE)
+		}
+		n := 0
+		var relr *elf.Section
+		for _, s := range ef.Sections {
+			switch s.Type {
+			case elf.SHT_RELA:
+				data, err := s.Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for ; len(data) >= 24; data = data[24:] {
+					if elf.R_TYPE64(ef.ByteOrder.Uint64(data[8:])) == relative {
+						n++
+					}
+				}
+			case 19: // SHT_RELR
+				relr = s
+			}
+		}
+		return n, relr
+	}
+
+	hasDynTag := func(t *testing.T, ef *elf.File, tag elf.DynTag) bool {
+		ds := ef.SectionByType(elf.SHT_DYNAMIC)
+		if ds == nil {
+			t.Fatal("no dynamic section")
+		}
+		d, err := ds.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ; len(d) >= 16; d = d[16:] {
+			if elf.DynTag(ef.ByteOrder.Uint64(d)) == tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, mode := range []string{"internal", "external"} {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+
+			build := func(bin, ldflags string) (*elf.File, int64, string) {
+				cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", bin, "-buildmode=pie", "-ldflags=-linkmode="+mode+" "+ldflags, "pie.go")
+				cmd.Dir = dir
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("build %s failed: %v\n%s", bin, err, out)
+				}
+				out, err := exec.Command(bin).CombinedOutput()
+				if err != nil {
+					t.Fatalf("%s: %v\n%s", bin, err, out)
+				}
+				fi, err := os.Stat(bin)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ef, err := elf.Open(bin)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { ef.Close() })
+				return ef, fi.Size(), string(out)
+			}
+
+			plain, plainSize, plainOut := build(filepath.Join(dir, mode+"-rela"), "")
+			packed, packedSize, packedOut := build(filepath.Join(dir, mode+"-relr"), "-pack-relative-relocs")
+			if packedOut != plainOut {
+				t.Errorf("program with packed relocations printed\n%s\nwant\n%s", packedOut, plainOut)
+			}
+
+			plainN, plainRelr := relocs(t, plain)
+			packedN, relr := relocs(t, packed)
+			if plainRelr != nil {
+				t.Errorf("program linked without -pack-relative-relocs has section %s", plainRelr.Name)
+			}
+			if relr == nil {
+				if mode == "external" {
+					t.Skip("external linker does not support -z pack-relative-relocs")
+				}
+				t.Fatal("no SHT_RELR section")
+			}
+			for _, tag := range []elf.DynTag{35, 36, 37} { // DT_RELRSZ, DT_RELR, DT_RELRENT
+				if !hasDynTag(t, packed, tag) {
+					t.Errorf("no dynamic tag %d", tag)
+				}
+			}
+			t.Logf("%d relative relocations in SHT_RELA (%d bytes) became %d, and %d bytes of SHT_RELR; file size %d -> %d",
+				plainN, plainN*24, packedN, relr.Size, plainSize, packedSize)
+			if plainN < 1000 || packedN > plainN/100 {
+				t.Errorf("%d relative relocations in SHT_RELA, down from %d; want almost none", packedN, plainN)
+			}
+			if relr.Size*10 > uint64(plainN*24) {
+				t.Errorf("SHT_RELR section is %d bytes, want under a tenth of %d", relr.Size, plainN*24)
+			}
+			if packedSize >= plainSize {
+				t.Errorf("program with packed relocations is %d bytes, want less than %d", packedSize, plainSize)
+			}
+		})
+	}
+}
+
+const cArchivePIESource = `
+package main
+
+import "C"
+
+import "fmt"
+
+var table = map[int]string{1: "one", 2: "two"}
+
+//export Hello
+func Hello(i C.int) {
+	fmt.Println("hello", table[int(i)])
+}
+
+func main() {}
+`
+
+const cArchivePIEMain = `
+extern void Hello(int);
+
+int main(void) {
+	Hello(2);
+	return 0;
+}
+`
+
+// TestCArchivePIE checks that a c-archive can be linked into a host
+// PIE, and that the linker rejects one that cannot be, rather than
+// leave the error to the host link.
+func TestCArchivePIE(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module carchive\n",
+		"lib.go": cArchivePIESource,
+	})
+	// The C program is not in the package directory, where cgo would
+	// compile it.
+	csrc := filepath.Join(t.TempDir(), "main.c")
+	if err := ioutil.WriteFile(csrc, []byte(cArchivePIEMain), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("pic", func(t *testing.T) {
+		t.Parallel()
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-buildmode=c-archive", "-o", "libpic.a")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("build failed: %v\n%s", err, out)
+		}
+
+		cc, cflags := getCCAndCCFLAGS(t, os.Environ())
+		exe := filepath.Join(dir, "main")
+		args := append(cflags, "-o", exe, "-fPIE", "-pie", "-Wl,-z,text", csrc, filepath.Join(dir, "libpic.a"), "-lpthread")
+		if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+			t.Fatalf("%s %s failed: %v\n%s", cc, strings.Join(args, " "), err, out)
+		}
+		ef := openELF(t, exe)
+		if ef.Type != elf.ET_DYN {
+			t.Errorf("%s has type %v, want %v", exe, ef.Type, elf.ET_DYN)
+		}
+		out, err := exec.Command(exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", exe, err, out)
+		}
+		if got, want := string(out), "hello two\n"; got != want {
+			t.Errorf("%s printed %q, want %q", exe, got, want)
+		}
+	})
+
+	t.Run("nonpic", func(t *testing.T) {
+		t.Parallel()
+		// Without -shared, the runtime accesses its thread-local
+		// storage with the local-exec model, which is only valid in
+		// an executable.
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-buildmode=c-archive", "-o", "libnonpic.a",
+			"-gcflags=all=-shared=false", "-asmflags=all=-shared=false")
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("build succeeded, want error\n%s", out)
+		}
+		for _, want := range []string{"cannot be used in a PIE or shared library", "runtime.", "packages compiled without -shared:"} {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("build output does not contain %q:\n%s", want, out)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "libnonpic.a")); err == nil {
+			t.Errorf("failed build left libnonpic.a behind")
+		}
+
+		// The archive can still be built for programs that are not
+		// position independent.
+		cmd = exec.Command(testenv.GoToolPath(t), "build", "-buildmode=c-archive", "-o", "libnonpic.a",
+			"-gcflags=all=-shared=false", "-asmflags=all=-shared=false", "-ldflags=-skip-pic-check")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("build with -skip-pic-check failed: %v\n%s", err, out)
+		}
+	})
+}
+
+func TestCompressDWARF(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("test only works on little-endian 64-bit targets")
+	}
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "hello.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nfunc main() { println(\"hello\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// build links src with -compressdwarf=method and returns the
+	// .debug_info section of the result, and its raw contents.
+	build := func(t *testing.T, method, linkmode string) (*elf.Section, []byte) {
+		exe := filepath.Join(t.TempDir(), "hello")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-compressdwarf="+method+" -linkmode="+linkmode, "-o", exe, src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("build failed: %v\n%s", err, out)
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := ef.Section(".debug_info")
+		if s == nil {
+			if linkmode == "external" && ef.Section(".zdebug_info") != nil {
+				// The host linker only supports zlib-gnu.
+				t.Skip("host linker does not support SHF_COMPRESSED")
+			}
+			t.Fatal("no .debug_info section")
+		}
+		raw := make([]byte, s.FileSize)
+		if _, err := f.ReadAt(raw, int64(s.Offset)); err != nil {
+			t.Fatal(err)
+		}
+		return s, raw
+	}
+
+	// chdr returns the compression header of a compressed section,
+	// and the compressed contents.
+	chdr := func(t *testing.T, s *elf.Section, raw []byte) (elf.Chdr64, []byte) {
+		if s.Flags&elf.SHF_COMPRESSED == 0 {
+			t.Fatalf("%s is not compressed: flags %v", s.Name, s.Flags)
+		}
+		var ch elf.Chdr64
+		if err := binary.Read(bytes.NewReader(raw), binary.LittleEndian, &ch); err != nil {
+			t.Fatal(err)
+		}
+		if s.Offset%8 != 0 {
+			t.Errorf("%s is at offset %#x, not aligned for its compression header", s.Name, s.Offset)
+		}
+		return ch, raw[binary.Size(ch):]
+	}
+
+	s, plain := build(t, "none", "internal")
+	if s.Flags&elf.SHF_COMPRESSED != 0 {
+		t.Fatalf("-compressdwarf=none: %s is compressed", s.Name)
+	}
+
+	t.Run("zlib", func(t *testing.T) {
+		t.Parallel()
+		s, raw := build(t, "zlib", "internal")
+		ch, _ := chdr(t, s, raw)
+		if elf.CompressionType(ch.Type) != elf.COMPRESS_ZLIB || ch.Size != uint64(len(plain)) {
+			t.Errorf("compression header is type %d, size %d; want %d, %d", ch.Type, ch.Size, elf.COMPRESS_ZLIB, len(plain))
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, plain) {
+			t.Errorf("decompressed %s differs from -compressdwarf=none", s.Name)
+		}
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		t.Parallel()
+		s, raw := build(t, "zstd", "internal")
+		ch, _ := chdr(t, s, raw)
+		if elf.CompressionType(ch.Type) != elf.COMPRESS_ZSTD || ch.Size != uint64(len(plain)) {
+			t.Errorf("compression header is type %d, size %d; want %d, %d", ch.Type, ch.Size, elf.COMPRESS_ZSTD, len(plain))
+		}
+		data, _, err := loadelf.Decompress(binary.LittleEndian, true, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, plain) {
+			t.Errorf("decompressed %s differs from -compressdwarf=none", s.Name)
+		}
+	})
+
+	t.Run("zstd-external", func(t *testing.T) {
+		testenv.MustHaveCGO(t)
+		t.Parallel()
+		// The host linker compresses the sections with zstd, or
+		// with zlib if it does not support zstd.
+		s, raw := build(t, "zstd", "external")
+		ch, _ := chdr(t, s, raw)
+		if ch.Type != 2 && elf.CompressionType(ch.Type) != elf.COMPRESS_ZLIB {
+			t.Errorf("compression header is type %d, want 2 or %d", ch.Type, elf.COMPRESS_ZLIB)
+		}
+	})
+}
+
+// writeARM64Object writes to file a minimal arm64 ELF relocatable
+// object with a text section, and, if note is not nil, a
+// .note.gnu.property section with the contents note.
+func writeARM64Object(t *testing.T, file string, note []byte) {
+	const ret = 0xd65f03c0
+	text := []byte{ret & 0xff, ret >> 8 & 0xff, ret >> 16 & 0xff, ret >> 24}
+	var extra *elf.Section64
+	if note != nil {
+		extra = &elf.Section64{
+			Type:      uint32(elf.SHT_NOTE),
+			Flags:     uint64(elf.SHF_ALLOC),
+			Addralign: 8,
+		}
+	}
+	writeELFObject(t, file, elf.EM_AARCH64, text, ".note.gnu.property", extra, note)
+}
+
+// writeELFObject writes to file a minimal little-endian relocatable
+// object for machine, ELF32 for arm and ELF64 otherwise, with a text
+// section holding text, and, if extra is not nil, a section with that
+// header, the name name and the contents contents.
+func writeELFObject(t *testing.T, file string, machine elf.Machine, text []byte, name string, extra *elf.Section64, contents []byte) {
+	shstrtab := []byte("\x00.text\x00.shstrtab\x00")
+
+	sects := []elf.Section64{{}, {
+		Name:      1,
+		Type:      uint32(elf.SHT_PROGBITS),
+		Flags:     uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+		Size:      uint64(len(text)),
+		Addralign: 4,
+	}}
+	data := [][]byte{nil, text}
+	if extra != nil {
+		sh := *extra
+		sh.Name = uint32(len(shstrtab))
+		sh.Size = uint64(len(contents))
+		shstrtab = append(append(shstrtab, name...), 0)
+		sects = append(sects, sh)
+		data = append(data, contents)
+	}
+	sects = append(sects, elf.Section64{
+		Name:      7,
+		Type:      uint32(elf.SHT_STRTAB),
+		Size:      uint64(len(shstrtab)),
+		Addralign: 1,
+	})
+	data = append(data, shstrtab)
+
+	var buf bytes.Buffer
+	is32 := machine == elf.EM_ARM
+	hdrSize, shSize := binary.Size(elf.Header64{}), binary.Size(elf.Section64{})
+	if is32 {
+		hdrSize, shSize = binary.Size(elf.Header32{}), binary.Size(elf.Section32{})
+	}
+	off := uint64(hdrSize)
+	for i := range sects {
+		off = (off + 7) &^ 7
+		sects[i].Off = off
+		off += uint64(len(data[i]))
+	}
+	off = (off + 7) &^ 7
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     off,
+		Ehsize:    uint16(hdrSize),
+		Shentsize: uint16(shSize),
+		Shnum:     uint16(len(sects)),
+		Shstrndx:  uint16(len(sects) - 1),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if is32 {
+		hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+		binary.Write(&buf, binary.LittleEndian, &elf.Header32{
+			Ident:     hdr.Ident,
+			Type:      hdr.Type,
+			Machine:   hdr.Machine,
+			Version:   hdr.Version,
+			Shoff:     uint32(hdr.Shoff),
+			Flags:     0x5000000, // Version5 EABI
+			Ehsize:    hdr.Ehsize,
+			Shentsize: hdr.Shentsize,
+			Shnum:     hdr.Shnum,
+			Shstrndx:  hdr.Shstrndx,
+		})
+	} else {
+		binary.Write(&buf, binary.LittleEndian, &hdr)
+	}
+	for i := range sects {
+		buf.Write(make([]byte, int(sects[i].Off)-buf.Len()))
+		buf.Write(data[i])
+	}
+	buf.Write(make([]byte, int(off)-buf.Len()))
+	if is32 {
+		for _, sh := range sects {
+			binary.Write(&buf, binary.LittleEndian, &elf.Section32{
+				Name:      sh.Name,
+				Type:      sh.Type,
+				Flags:     uint32(sh.Flags),
+				Off:       uint32(sh.Off),
+				Size:      uint32(sh.Size),
+				Addralign: uint32(sh.Addralign),
+			})
+		}
+	} else {
+		binary.Write(&buf, binary.LittleEndian, sects)
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gnuPropertyNote returns the contents of an ELF64 .note.gnu.property
+// section holding a property of type typ with value val.
+func gnuPropertyNote(typ, val uint32) []byte {
+	var b bytes.Buffer
+	for _, v := range []uint32{4, 16, 5} { // namesz, descsz, NT_GNU_PROPERTY_TYPE_0
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("GNU\x00")
+	for _, v := range []uint32{typ, 4, val, 0} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+// gnuProperty returns the value of the property of type typ in the
+// .note.gnu.property note of ef, which must be an ELF64 file, and
+// whether ef has the property, in a note with a PT_GNU_PROPERTY segment
+// holding it.
+func gnuProperty(t *testing.T, ef *elf.File, typ uint32) (uint32, bool) {
+	var seg *elf.Prog
+	for _, p := range ef.Progs {
+		if p.Type == elf.PT_GNU_PROPERTY {
+			seg = p
+		}
+	}
+	sect := ef.Section(".note.gnu.property")
+	if seg == nil || sect == nil {
+		if seg != nil || sect != nil {
+			t.Errorf("PT_GNU_PROPERTY is %v, .note.gnu.property is %v; want both or neither", seg, sect)
+		}
+		return 0, false
+	}
+	if seg.Off != sect.Offset || seg.Filesz != sect.Size || seg.Align != 8 || sect.Offset%8 != 0 {
+		t.Errorf("PT_GNU_PROPERTY %+v does not match aligned .note.gnu.property %+v", seg.ProgHeader, sect.SectionHeader)
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 16 || string(data[12:16]) != "GNU\x00" || ef.ByteOrder.Uint32(data[8:]) != 5 {
+		t.Fatalf("bad .note.gnu.property: % x", data)
+	}
+	// The properties are sorted by type, each padded to 8 bytes.
+	desc := data[16:]
+	if n := int(ef.ByteOrder.Uint32(data[4:])); n <= len(desc) {
+		desc = desc[:n]
+	}
+	for len(desc) >= 8 {
+		pt, sz := ef.ByteOrder.Uint32(desc), int(ef.ByteOrder.Uint32(desc[4:]))
+		if pt == typ && sz == 4 && len(desc) >= 12 {
+			return ef.ByteOrder.Uint32(desc[8:]), true
+		}
+		if n := 8 + (sz+7)&^7; n < len(desc) {
+			desc = desc[n:]
+		} else {
+			desc = nil
+		}
+	}
+	return 0, false
+}
+
+func TestGNUPropertyARM64(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	const (
+		featureAnd = 0xc0000000 // GNU_PROPERTY_AARCH64_FEATURE_1_AND
+		bti        = 1 << 0
+		pac        = 1 << 1
+	)
+
+	tests := []struct {
+		name     string
+		flag     string
+		note     []byte // host object property note, if any
+		syso     bool
+		features uint32 // 0 for no note
+	}{
+		{name: "none"},
+		{name: "bti-pac", flag: "bti,pac", features: bti | pac},
+		{name: "syso-bti", flag: "bti,pac", syso: true, note: gnuPropertyNote(featureAnd, bti), features: bti},
+		{name: "syso-nonote", flag: "bti,pac", syso: true},
+		{name: "syso-other", flag: "bti", syso: true, note: gnuPropertyNote(0xc0000002, 3)},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTestFiles(t, map[string]string{
+				"go.mod":  "module prop\n",
+				"main.go": "package main\n\nfunc main() {}\n",
+			})
+			if test.syso {
+				writeARM64Object(t, filepath.Join(dir, "obj_linux_arm64.syso"), test.note)
+			}
+			for _, mode := range []string{"exe", "pie"} {
+				exe := filepath.Join(dir, mode)
+				args := []string{"build", "-buildmode=" + mode, "-o", exe}
+				if test.flag != "" {
+					args = append(args, "-ldflags=-cfprotection="+test.flag)
+				}
+				cmd := exec.Command(testenv.GoToolPath(t), args...)
+				cmd.Dir = dir
+				cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0")
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("%s: %v\n%s", cmd, err, out)
+				}
+				ef, err := elf.Open(exe)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, ok := gnuProperty(t, ef, featureAnd)
+				ef.Close()
+				if test.features == 0 && ok {
+					t.Errorf("buildmode=%s: has a .note.gnu.property note with features %#x, want none", mode, got)
+				} else if test.features != 0 && got != test.features {
+					t.Errorf("buildmode=%s: .note.gnu.property has features %#x, want %#x", mode, got, test.features)
+				}
+			}
+		})
+	}
+}
+
+func TestGNUPropertyExternal(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	const (
+		featureAnd = 0xc0000000 // GNU_PROPERTY_AARCH64_FEATURE_1_AND
+		bti        = 1 << 0
+		pac        = 1 << 1
+	)
+
+	t.Run("goobj", func(t *testing.T) {
+		// Check the note in the go.o handed to the host linker,
+		// which need not be able to link for arm64.
+		falsePath, err := exec.LookPath("false")
+		if err != nil {
+			t.Skip("false not found")
+		}
+		t.Parallel()
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		tmpdir := t.TempDir()
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "main"),
+			"-ldflags=-linkmode=external -extld="+falsePath+" -tmpdir="+tmpdir+" -cfprotection=bti,pac", "main.go")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0")
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("link with -extld=false succeeded\n%s", out)
+		}
+		ef, err := elf.Open(filepath.Join(tmpdir, "go.o"))
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		defer ef.Close()
+		sect := ef.Section(".note.gnu.property")
+		if sect == nil {
+			t.Fatal("go.o has no .note.gnu.property section")
+		}
+		if sect.Type != elf.SHT_NOTE || sect.Addralign != 8 || sect.Offset%8 != 0 {
+			t.Errorf("bad .note.gnu.property section: %+v", sect.SectionHeader)
+		}
+		data, err := sect.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 32 || string(data[12:16]) != "GNU\x00" ||
+			ef.ByteOrder.Uint32(data[16:]) != featureAnd || ef.ByteOrder.Uint32(data[24:]) != bti|pac {
+			t.Errorf("bad .note.gnu.property: % x", data)
+		}
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		// Link a cgo program whose C code has the features,
+		// with each host linker that is available.
+		testenv.MustHaveCGO(t)
+		var cfprotection, cgoCFLAGS string
+		var prType, want uint32
+		switch {
+		case runtime.GOOS == "linux" && runtime.GOARCH == "arm64":
+			cfprotection, cgoCFLAGS = "bti,pac", "-mbranch-protection=standard"
+			prType, want = featureAnd, bti
+		case runtime.GOOS == "linux" && runtime.GOARCH == "amd64":
+			cfprotection, cgoCFLAGS = "ibt,shstk", "-fcf-protection"
+			prType, want = 0xc0000002, 1<<0|1<<1 // GNU_PROPERTY_X86_FEATURE_1_AND, IBT|SHSTK
+		default:
+			t.Skip("test only works on linux/amd64 and linux/arm64")
+		}
+		t.Parallel()
+		cc, cflags := getCCAndCCFLAGS(t, os.Environ())
+		dir := t.TempDir()
+		src := "package main\n\n// int f(void) { return 1; }\nimport \"C\"\n\nfunc main() { println(C.f()) }\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		features := func(t *testing.T, exe string) uint32 {
+			ef := openELF(t, exe)
+			got, _ := gnuProperty(t, ef, prType)
+			return got
+		}
+		for _, ld := range []string{"bfd", "lld"} {
+			// The C startup files of the system must have the
+			// features too, for any output to have them.
+			cexe := filepath.Join(dir, "c-"+ld)
+			args := append(cflags, "-fuse-ld="+ld, cgoCFLAGS, "-o", cexe, "-x", "c", "-")
+			c := exec.Command(cc, args...)
+			c.Stdin = strings.NewReader("int main(void) { return 0; }\n")
+			if out, err := c.CombinedOutput(); err != nil {
+				t.Logf("skipping -fuse-ld=%s: %v\n%s", ld, err, out)
+				continue
+			}
+			if got := features(t, cexe); got&want != want {
+				t.Logf("skipping -fuse-ld=%s: C programs have features %#x, not %#x", ld, got, want)
+				continue
+			}
+
+			exe := filepath.Join(dir, ld)
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe,
+				"-ldflags=-linkmode=external -cfprotection="+cfprotection+" -extldflags=-fuse-ld="+ld)
+			cmd.Dir = dir
+			// runtime/cgo is rebuilt with the features too.
+			cmd.Env = append(os.Environ(), "CGO_CFLAGS="+cgoCFLAGS)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("-fuse-ld=%s: %v\n%s", ld, err, out)
+			}
+			if got := features(t, exe); got&want != want {
+				t.Errorf("-fuse-ld=%s: output has features %#x, want %#x", ld, got, want)
+			}
+		}
+	})
+}
+
+func TestGNUPropertyX86(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	const (
+		featureAnd = 0xc0000002 // GNU_PROPERTY_X86_FEATURE_1_AND
+		ibt        = 1 << 0
+		shstk      = 1 << 1
+	)
+
+	// Compile the host objects outside of the package directories,
+	// where cgo would compile them.
+	cc, cflags := getCCAndCCFLAGS(t, os.Environ())
+	objdir := t.TempDir()
+	compile := func(name, protection string) string {
+		src := filepath.Join(objdir, name+".c")
+		if err := ioutil.WriteFile(src, []byte("int "+name+"(void) { return 1; }\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		obj := filepath.Join(objdir, name+".o")
+		args := append(cflags, "-fcf-protection="+protection, "-c", "-o", obj, src)
+		if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+			t.Skipf("%s does not support -fcf-protection: %v\n%s", cc, err, out)
+		}
+		return obj
+	}
+	full := compile("full", "full")
+	branch := compile("branch", "branch")
+	none := compile("none", "none")
+
+	tests := []struct {
+		name     string
+		flag     string
+		objs     []string
+		features uint32 // 0 for no note
+	}{
+		{name: "full", flag: "ibt,shstk", objs: []string{full}, features: ibt | shstk},
+		{name: "branch", flag: "ibt,shstk", objs: []string{branch}, features: ibt},
+		{name: "mixed", flag: "ibt,shstk", objs: []string{full, branch}, features: ibt},
+		{name: "nonote", flag: "ibt,shstk", objs: []string{full, none}},
+		{name: "noflag", objs: []string{full}},
+		{name: "ibt", flag: "ibt", objs: []string{full}, features: ibt},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTestFiles(t, map[string]string{
+				"go.mod":  "module prop\n",
+				"main.go": "package main\n\nfunc main() {}\n",
+			})
+			for i, obj := range test.objs {
+				data, err := ioutil.ReadFile(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("obj%d_linux_amd64.syso", i)), data, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			exe := filepath.Join(dir, "main")
+			args := []string{"build", "-o", exe}
+			if test.flag != "" {
+				args = append(args, "-ldflags=-cfprotection="+test.flag)
+			}
+			cmd := exec.Command(testenv.GoToolPath(t), args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%s: %v\n%s", cmd, err, out)
+			}
+			ef := openELF(t, exe)
+			got, ok := gnuProperty(t, ef, featureAnd)
+			if test.features == 0 && ok {
+				t.Errorf("has a .note.gnu.property note with features %#x, want none", got)
+			} else if test.features != 0 && got != test.features {
+				t.Errorf(".note.gnu.property has features %#x, want %#x", got, test.features)
+			}
+		})
+	}
+}
+
+func TestABIWrapperAlias(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "hello.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "hello")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-abiwrapper-alias", "-o", exe, src)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+
+	ef := openELF(t, exe)
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := make(map[uint64][]elf.Symbol)
+	named := make(map[string]int) // number of functions with each name
+	for _, s := range syms {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC {
+			funcs[s.Value] = append(funcs[s.Value], s)
+			if s.Size != 0 {
+				named[s.Name]++
+			}
+		}
+	}
+
+	pcln := ef.Section(".gopclntab")
+	text := ef.Section(".text")
+	if pcln == nil || text == nil {
+		t.Fatal("missing .gopclntab or .text")
+	}
+	pclndata, err := pcln.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := gosym.NewTable(nil, gosym.NewLineTable(pclndata, text.Addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases := 0
+	for _, s := range syms {
+		name := strings.TrimSuffix(strings.TrimSuffix(s.Name, ".abi0"), ".abiinternal")
+		if name == s.Name || elf.ST_TYPE(s.Info) != elf.STT_FUNC {
+			continue
+		}
+		if s.Size != 0 {
+			// Not a wrapper: a function of a pair without
+			// a reachable wrapper keeps its mangled name.
+			continue
+		}
+		aliases++
+		// The wrapper has the name of the function it wraps, and
+		// so does its pclntab entry.
+		found := false
+		for _, w := range funcs[s.Value] {
+			if w.Name == name && w.Size != 0 && elf.ST_BIND(w.Info) == elf.STB_LOCAL {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("alias %s at %#x has no local wrapper named %s: %v", s.Name, s.Value, name, funcs[s.Value])
+		}
+		if named[name] != 2 {
+			t.Errorf("%d functions named %s, want the wrapper and the function", named[name], name)
+		}
+		if fn := tab.PCToFunc(s.Value); fn == nil || fn.Name != name {
+			t.Errorf("pclntab function at %#x is %v, want %s", s.Value, fn, name)
+		}
+	}
+	if aliases == 0 {
+		t.Error("no ABI wrapper aliases")
+	}
+}
+
+const gotpcrelxSource = `package main
+
+/*
+#cgo CFLAGS: -O2 -fno-plt
+
+#ifdef GX_HIDDEN
+#define GX_VIS __attribute__((visibility("hidden")))
+#else
+#define GX_VIS
+#endif
+
+GX_VIS int gxCounter = 40;
+
+GX_VIS int gxIncr(int x) { return x + 1; }
+
+GX_VIS int *gxAddr(void) { return &gxCounter; }
+
+// The calls to gxAddr and gxIncr go through the GOT, unless the
+// symbols are hidden.
+GX_VIS int gxCall(void) { return gxIncr(*gxAddr()) + 1; }
+
+// The tail call to gxIncr jumps through the GOT.
+GX_VIS int gxTail(int x) { return gxIncr(x); }
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.gxCall(), C.gxTail(41))
+}
+`
+
+// TestGOTPCRELX checks that the MOV, CALL and JMP instructions of a host
+// object that load a locally defined symbol from the GOT are relaxed
+// when linking internally, so that the program needs no GOT entries
+// for them.
+func TestGOTPCRELX(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module gotpcrelx\n",
+		"main.go": gotpcrelxSource,
+	})
+
+	// build links the program and returns the size of its GOT.
+	build := func(t *testing.T, buildmode string, hidden bool) uint64 {
+		exe := filepath.Join(t.TempDir(), "main")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-buildmode="+buildmode, "-ldflags=-linkmode=internal", "-o", exe)
+		cmd.Dir = dir
+		cmd.Env = os.Environ()
+		if hidden {
+			cmd.Env = append(cmd.Env, "CGO_CFLAGS=-DGX_HIDDEN")
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		if got, want := runTestProgram(t, exe), "42 42"; got != want {
+			t.Errorf("%s printed %q, want %q", exe, got, want)
+		}
+		ef := openELF(t, exe)
+		if ef.Section(".got") == nil {
+			return 0
+		}
+		return ef.Section(".got").Size
+	}
+
+	for _, buildmode := range []string{"exe", "pie"} {
+		buildmode := buildmode
+		t.Run(buildmode, func(t *testing.T) {
+			t.Parallel()
+			got := build(t, buildmode, false)
+			want := build(t, buildmode, true)
+			if got != want {
+				t.Errorf("GOT has %d bytes, want %d as without GOT references", got, want)
+			}
+		})
+	}
+}
+
+// TestExternalRelocDeterministic checks that the relocations of the
+// object handed to the external linker, which are converted in
+// parallel, are the same as when they are converted serially.
+func TestExternalRelocDeterministic(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	falsePath, err := exec.LookPath("false")
+	if err != nil {
+		t.Skip("false not found")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n"})
+	src := filepath.Join(dir, "main.go")
+
+	// goobj links the program with GOMAXPROCS set to procs and
+	// returns the contents of go.o. The links share a temporary
+	// directory, as its name is recorded in the build information.
+	tmpdir := t.TempDir()
+	goobj := func(procs int) []byte {
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "main"),
+			"-ldflags=-linkmode=external -extld="+falsePath+" -tmpdir="+tmpdir, src)
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0", fmt.Sprintf("GOMAXPROCS=%d", procs))
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("link with -extld=false succeeded\n%s", out)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(tmpdir, "go.o"))
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		if err := os.Remove(filepath.Join(tmpdir, "go.o")); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	serial := goobj(1)
+	parallel := goobj(8)
+	if !bytes.Equal(serial, parallel) {
+		t.Errorf("go.o differs between serial and parallel relocation conversion")
+	}
+}
+
+// BenchmarkExternalReloc measures linking a program for external
+// linking, up to running the external linker.
+func BenchmarkExternalReloc(b *testing.B) {
+	testenv.MustHaveGoBuild(b)
+
+	falsePath, err := exec.LookPath("false")
+	if err != nil {
+		b.Skip("false not found")
+	}
+
+	dir := b.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nimport \"net/http\"\n\nfunc main() { http.ListenAndServe(\":0\", nil) }\n"), 0666); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The link fails at running the external linker, after
+		// writing go.o. Each link uses a new temporary directory,
+		// so that the link is not cached.
+		cmd := exec.Command(testenv.GoToolPath(b), "build", "-o", filepath.Join(dir, "main"),
+			"-ldflags=-linkmode=external -extld="+falsePath+" -tmpdir="+b.TempDir(), src)
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err == nil {
+			b.Fatalf("link with -extld=false succeeded\n%s", out)
+		}
+	}
+}
+
+const tlsDescSource = `package main
+
+/*
+__thread int tlsInit = 40;
+__thread int tlsZero;
+
+int tlsGet(void) {
+	tlsZero++;
+	return tlsInit + tlsZero;
+}
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	C.tlsGet()
+	fmt.Println(C.tlsGet())
+}
+`
+
+// TestTLSDescARM64 checks that a cgo program whose C code accesses
+// thread-local variables through TLS descriptors, as clang compiles
+// position-independent code by default on linux/arm64, can be linked
+// internally.
+func TestTLSDescARM64(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "arm64" {
+		t.Skip("test only works on linux/arm64")
+	}
+	clang, err := exec.LookPath("clang")
+	if err != nil {
+		t.Skip("clang not found")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module tlsdesc\n",
+		"main.go": tlsDescSource,
+	})
+
+	for _, buildmode := range []string{"exe", "pie"} {
+		buildmode := buildmode
+		t.Run(buildmode, func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			goBuild(t, dir, []string{"CC=" + clang}, "-buildmode="+buildmode, "-ldflags=-linkmode=internal", "-o", exe)
+			if got, want := runTestProgram(t, exe), "42"; got != want {
+				t.Errorf("%s printed %q, want %q", exe, got, want)
+			}
+		})
+	}
+}
+
+const hostTLSC = `#include <pthread.h>
+#include <stdint.h>
+
+__thread long tlsInit = 40;
+__thread long tlsZero;
+static __thread char tlsLocal[3];
+static __thread long tlsAligned __attribute__((aligned(64))) = 7;
+
+static void *tlsThread(void *arg) {
+	long *out = arg;
+
+	tlsZero++;
+	tlsLocal[1] += 2;
+	tlsAligned++;
+	out[0] = tlsInit + tlsZero + tlsLocal[1];
+	out[1] = tlsAligned;
+	out[2] = (uintptr_t)&tlsAligned % 64;
+	return 0;
+}
+
+// tlsRead returns the values of the thread-local variables, each
+// updated once, as seen by a new thread.
+void tlsRead(long *out) {
+	pthread_t t;
+
+	pthread_create(&t, 0, tlsThread, out);
+	pthread_join(t, 0);
+}
+`
+
+const hostTLSGo = `package main
+
+/*
+#cgo LDFLAGS: -lpthread
+
+extern __thread long tlsInit;
+extern __thread long tlsZero;
+
+void tlsRead(long *out);
+
+static long tlsGet(void) {
+	tlsZero++;
+	return tlsInit + tlsZero;
+}
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	var out [3]C.long
+	C.tlsGet()
+	C.tlsRead(&out[0])
+	fmt.Println(C.tlsGet(), out[0], out[1], out[2])
+}
+`
+
+// TestHostTLS checks that thread-local variables defined in host
+// objects, with and without initial values, can be linked internally,
+// whichever TLS access model the C compiler uses for them.
+func TestHostTLS(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module hosttls\n",
+		"main.go": hostTLSGo,
+		"tls.c":   hostTLSC,
+	})
+
+	for _, buildmode := range []string{"exe", "pie"} {
+		// Position-independent code accesses the variables with the
+		// general and local dynamic models, other code with the
+		// initial and local exec models.
+		for _, cflags := range []string{"-O2", "-O2 -fPIC"} {
+			buildmode, cflags := buildmode, cflags
+			t.Run(buildmode+" "+cflags, func(t *testing.T) {
+				t.Parallel()
+				exe := filepath.Join(t.TempDir(), "main")
+				goBuild(t, dir, []string{"CGO_CFLAGS=" + cflags}, "-buildmode="+buildmode, "-ldflags=-linkmode=internal", "-o", exe)
+				if got, want := runTestProgram(t, exe), "42 43 8 0"; got != want {
+					t.Errorf("%s printed %q, want %q", exe, got, want)
+				}
+
+				ef := openELF(t, exe)
+				for _, p := range ef.Progs {
+					if p.Type != elf.PT_TLS {
+						continue
+					}
+					if p.Filesz == 0 || p.Memsz <= p.Filesz || p.Align < 64 {
+						t.Errorf("PT_TLS has filesz %d, memsz %d and align %d, want initial values, zero-initialized variables and align 64", p.Filesz, p.Memsz, p.Align)
+					}
+					return
+				}
+				t.Error("no PT_TLS segment")
+			})
+		}
+	}
+}
+
+const hostCommonC1 = `int counter;
+long big[2];
+int defLate;
+int defEarly = 3;
+
+int *counter1(void) { counter++; return &counter; }
+long *big1(void) { return big; }
+int *defLate1(void) { return &defLate; }
+int *defEarly1(void) { return &defEarly; }
+`
+
+const hostCommonC2 = `int counter;
+long big[4] __attribute__((aligned(4096)));
+int defLate = 5;
+long defEarly[4];
+
+int *counter2(void) { counter += 10; return &counter; }
+long *big2(void) { big[3] = 1; return big; }
+int *defLate2(void) { return &defLate; }
+int *defEarly2(void) { return (int*)defEarly; }
+`
+
+const hostCommonGo = `package main
+
+/*
+#cgo CFLAGS: -fcommon
+
+int *counter1(void);
+int *counter2(void);
+long *big1(void);
+long *big2(void);
+int *defLate1(void);
+int *defLate2(void);
+int *defEarly1(void);
+int *defEarly2(void);
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func main() {
+	c1, c2 := C.counter1(), C.counter2()
+	b1, b2 := C.big1(), C.big2()
+	fmt.Println(c1 == c2, *c1, b1 == b2, uintptr(unsafe.Pointer(b1))%4096)
+	fmt.Println(C.defLate1() == C.defLate2(), *C.defLate1(), C.defEarly1() == C.defEarly2(), *C.defEarly1())
+}
+`
+
+// TestHostCommonSymbols checks that common symbols in host objects
+// compiled with -fcommon are merged into one variable, with the largest
+// size and alignment, and that a real definition takes precedence over
+// them, whether it is loaded before or after them.
+func TestHostCommonSymbols(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	_, exe := buildTestProgram(t, map[string]string{
+		"go.mod":  "module hostcommon\n",
+		"main.go": hostCommonGo,
+		"c1.c":    hostCommonC1,
+		"c2.c":    hostCommonC2,
+	}, "-linkmode=internal")
+	if got, want := runTestProgram(t, exe), "true 11 true 0\ntrue 5 true 3"; got != want {
+		t.Errorf("%s printed %q, want %q", exe, got, want)
+	}
+
+	ef := openELF(t, exe)
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"big": 32, "defEarly": 4}
+	for _, s := range syms {
+		if size, ok := want[s.Name]; ok {
+			if s.Size != size {
+				t.Errorf("%s has size %d, want %d", s.Name, s.Size, size)
+			}
+			delete(want, s.Name)
+		}
+	}
+	for name := range want {
+		t.Errorf("no symbol %s", name)
+	}
+}
+
+// TestSysoSelect checks that -sysoselect loads only the host objects
+// built for the target, from a package with objects for three of them.
+func TestSysoSelect(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	pkg := writeTestFiles(t, map[string]string{
+		"go.mod":  "module sysoselect\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+	// The names do not follow the go/build convention, so the go
+	// command passes all the objects to the linker.
+	objs := map[string]elf.Machine{
+		"amd64":   elf.EM_X86_64,
+		"arm64":   elf.EM_AARCH64,
+		"riscv64": elf.EM_RISCV,
+	}
+	for goarch, machine := range objs {
+		file := filepath.Join(pkg, "hw-"+goarch+".syso")
+		writeARM64Object(t, file, nil)
+		f, err := os.OpenFile(file, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], uint16(machine))
+		_, err = f.WriteAt(b[:], 18) // e_machine
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := filepath.Join(t.TempDir(), "syso.json")
+	const targets = `{
+	"hw-amd64.syso": ["linux/amd64", "windows/amd64"],
+	"hw-arm64.syso": ["linux/arm64"],
+	"hw-riscv64.syso": ["linux/riscv64"]
+}`
+	if err := ioutil.WriteFile(manifest, []byte(targets), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(goarch, ldflags string) ([]byte, error) {
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags="+ldflags, "-o", filepath.Join(t.TempDir(), "main"))
+		cmd.Dir = pkg
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+goarch, "CGO_ENABLED=0")
+		return cmd.CombinedOutput()
+	}
+
+	for goarch := range objs {
+		goarch := goarch
+		t.Run(goarch, func(t *testing.T) {
+			t.Parallel()
+			out, err := build(goarch, "-v -sysoselect="+manifest)
+			if err != nil {
+				t.Fatalf("build: %v\n%s", err, out)
+			}
+			for other := range objs {
+				skipped := bytes.Contains(out, []byte("(hw-"+other+".syso), built for"))
+				if other == goarch && skipped {
+					t.Errorf("hw-%s.syso skipped when linking for %s\n%s", other, goarch, out)
+				} else if other != goarch && !skipped {
+					t.Errorf("hw-%s.syso not skipped when linking for %s\n%s", other, goarch, out)
+				}
+			}
+		})
+	}
+
+	t.Run("none", func(t *testing.T) {
+		t.Parallel()
+		out, err := build("amd64", "")
+		if err == nil {
+			t.Fatalf("build without -sysoselect succeeded\n%s", out)
+		}
+		if !bytes.Contains(out, []byte("hw-arm64.syso")) {
+			t.Errorf("build without -sysoselect failed with no error for hw-arm64.syso\n%s", out)
+		}
+	})
+}
+
+const hostCOMDATHeader = `inline int *counter() { static int n; return &n; }
+inline int add(int a, int b) { return a + b + *counter(); }
+`
+
+const hostCOMDATGo = `package main
+
+/*
+#cgo CXXFLAGS: -O1 -fno-exceptions -fno-rtti
+
+int add1(int);
+int add2(int);
+void *addr1(void);
+void *addr2(void);
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.add1(1), C.add2(1), C.addr1() == C.addr2())
+}
+`
+
+// TestHostCOMDAT checks that only the first copy of a COMDAT group, here
+// of an inline C++ function and of its static variable, is loaded from
+// host objects.
+func TestHostCOMDAT(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+	out, err := exec.Command(testenv.GoToolPath(t), "env", "CXX").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cxx := strings.Fields(string(out)); len(cxx) == 0 {
+		t.Skip("no C++ compiler")
+	} else if _, err := exec.LookPath(cxx[0]); err != nil {
+		t.Skipf("C++ compiler %s not found", cxx[0])
+	}
+
+	t.Parallel()
+
+	_, exe := buildTestProgram(t, map[string]string{
+		"go.mod":  "module hostcomdat\n",
+		"main.go": hostCOMDATGo,
+		"inl.h":   hostCOMDATHeader,
+		"c1.cc":   "#include \"inl.h\"\nextern \"C\" int add1(int x) { ++*counter(); return add(x, 1); }\nextern \"C\" void *addr1(void) { return (void*)add; }\n",
+		"c2.cc":   "#include \"inl.h\"\nextern \"C\" int add2(int x) { ++*counter(); return add(x, 2); }\nextern \"C\" void *addr2(void) { return (void*)add; }\n",
+	}, "-linkmode=internal")
+	// Both functions increment the same counter.
+	if got, want := runTestProgram(t, exe), "3 5 true"; got != want {
+		t.Errorf("%s printed %q, want %q", exe, got, want)
+	}
+
+	ef := openELF(t, exe)
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for _, s := range syms {
+		count[s.Name]++
+	}
+	for _, name := range []string{"_Z3addii", "main(.text._Z3addii)", "_ZZ7countervE1n"} {
+		if count[name] != 1 {
+			t.Errorf("%d symbols %s, want 1", count[name], name)
+		}
+	}
+}
+
+// hostCompressedDebugC has enough debug information for the assembler
+// to compress it.
+const hostCompressedDebugC = `struct point {
+	long x, y, z;
+	double weight;
+	const char *label;
+	struct point *next, *prev;
+};
+
+static long norm(struct point *p) { return p->x*p->x + p->y*p->y + p->z*p->z; }
+
+long add(long a, long b) {
+	struct point p = {a, b, a + b, 1.5, "sum", 0, 0};
+	return norm(&p) > 0 ? a + b : 0;
+}
+`
+
+const hostCompressedDebugGo = `package main
+
+/*
+#cgo CFLAGS: -g -gz=zlib
+
+long add(long a, long b);
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.add(1, 2))
+}
+`
+
+// TestHostCompressedDebug checks that host objects with compressed
+// debug sections link internally into a binary with readable DWARF.
+func TestHostCompressedDebug(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	cc, cflags := getCCAndCCFLAGS(t, os.Environ())
+	obj := filepath.Join(t.TempDir(), "x.o")
+	args := append(cflags, "-g", "-gz=zlib", "-c", "-x", "c", "-o", obj, "-")
+	cmd := exec.Command(cc, args...)
+	cmd.Stdin = strings.NewReader(hostCompressedDebugC)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("%s does not support -gz=zlib: %v\n%s", cc, err, out)
+	}
+	ef, err := elf.Open(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ef.Section(".debug_info")
+	ef.Close()
+	if s == nil || s.Flags&elf.SHF_COMPRESSED == 0 {
+		t.Skipf("%s -gz=zlib does not write SHF_COMPRESSED sections", cc)
+	}
+
+	_, exe := buildTestProgram(t, map[string]string{
+		"go.mod":  "module hostgz\n",
+		"main.go": hostCompressedDebugGo,
+		"add.c":   hostCompressedDebugC,
+	}, "-linkmode=internal")
+	if got, want := runTestProgram(t, exe), "3"; got != want {
+		t.Errorf("%s printed %q, want %q", exe, got, want)
+	}
+
+	d, err := openELF(t, exe).DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := d.Reader()
+	found := false
+	for {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			break
+		}
+		if name, _ := e.Val(dwarf.AttrName).(string); e.Tag == dwarf.TagSubprogram && name == "main.main" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("no DWARF entry for main.main")
+	}
+}
+
+// TestHostLTO checks that the linker recognizes host objects compiled
+// for link-time optimization: it links them externally, and reports
+// them by name when linking internally.
+func TestHostLTO(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	// build builds the package made of files, and returns the build
+	// output and error.
+	build := func(t *testing.T, files map[string]string, ldflags string) ([]byte, string, error) {
+		files["go.mod"] = "module hostlto\n"
+		dir := writeTestFiles(t, files)
+		exe := filepath.Join(dir, "main")
+		out, err := goBuildCmd(t, dir, nil, "-ldflags="+ldflags, "-o", exe).CombinedOutput()
+		return out, exe, err
+	}
+
+	t.Run("bitcode", func(t *testing.T) {
+		t.Parallel()
+		files := map[string]string{
+			"main.go":      "package main\n\nfunc main() {}\n",
+			"bitcode.syso": "BC\xc0\xde\x35\x14\x00\x00\x05\x00\x00\x00",
+		}
+		out, _, err := build(t, files, "-linkmode=internal")
+		if err == nil {
+			t.Fatal("internal linking succeeded")
+		}
+		if want := "(bitcode.syso) holds LLVM bitcode for link-time optimization"; !bytes.Contains(out, []byte(want)) {
+			t.Errorf("build failed with\n%s\nwant the error to contain %q", out, want)
+		}
+	})
+
+	testenv.MustHaveCGO(t)
+	cc, cflags := getCCAndCCFLAGS(t, os.Environ())
+	dir := t.TempDir()
+	obj := filepath.Join(dir, "lto.o")
+	args := append(cflags, "-flto", "-fno-fat-lto-objects", "-c", "-x", "c", "-o", obj, "-")
+	cmd := exec.Command(cc, args...)
+	cmd.Stdin = strings.NewReader("int ltoadd(int a, int b) { return a + b; }\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("%s does not support -flto: %v\n%s", cc, err, out)
+	}
+	lto, err := ioutil.ReadFile(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ef, err := elf.NewFile(bytes.NewReader(lto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ef.Section(".gnu.lto_.opts") == nil {
+		t.Skipf("%s -flto does not write GCC LTO objects", cc)
+	}
+
+	const callLTO = `package main
+
+// int ltoadd(int a, int b);
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.ltoadd(1, 2))
+}
+`
+
+	t.Run("syso", func(t *testing.T) {
+		t.Parallel()
+		files := map[string]string{
+			"main.go":  callLTO,
+			"lto.syso": string(lto),
+		}
+		out, _, err := build(t, files, "-linkmode=internal")
+		if err == nil {
+			t.Fatal("internal linking succeeded")
+		}
+		if want := "(lto.syso) holds GCC LTO bytecode for link-time optimization"; !bytes.Contains(out, []byte(want)) {
+			t.Errorf("build failed with\n%s\nwant the error to contain %q", out, want)
+		}
+
+		// The default link mode falls back to external linking.
+		out, exe, err := build(t, files, "")
+		if err != nil {
+			t.Fatalf("build failed: %v\n%s", err, out)
+		}
+		if got := runTestProgram(t, exe); got != "3" {
+			t.Errorf("%s printed %q, want \"3\"", exe, got)
+		}
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		// The object is found by looking up undefined symbols in
+		// the archive given with -libgcc.
+		gccar, err := exec.LookPath("gcc-ar")
+		if err != nil {
+			t.Skip("gcc-ar not found")
+		}
+		t.Parallel()
+		lib := filepath.Join(t.TempDir(), "liblto.a")
+		if out, err := exec.Command(gccar, "rcs", lib, obj).CombinedOutput(); err != nil {
+			t.Fatalf("gcc-ar: %v\n%s", err, out)
+		}
+		files := map[string]string{
+			"main.go": strings.Replace(callLTO, "// int ltoadd", "// #cgo LDFLAGS: "+lib+"\n// int ltoadd", 1),
+		}
+		out, _, err := build(t, files, "-linkmode=internal -libgcc="+lib)
+		if err == nil {
+			t.Fatal("internal linking succeeded")
+		}
+		if want := "GCC LTO bytecode for link-time optimization cannot be linked internally, use -linkmode=external"; !bytes.Contains(out, []byte(want)) {
+			t.Errorf("build failed with\n%s\nwant the error to contain %q", out, want)
+		}
+	})
+}
+
+const reserveSectionSrc = `package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+//go:linkname licenseStart go.reserve.license.start
+var licenseStart uintptr
+
+//go:linkname licenseSize go.reserve.license.size
+var licenseSize uintptr
+
+func main() {
+	b := unsafe.Slice((*byte)(unsafe.Pointer(licenseStart)), licenseSize)
+	n := 0
+	for n < len(b) && b[n] != 0 {
+		n++
+	}
+	fmt.Printf("%d %q\n", len(b), b[:n])
+}
+`
+
+func TestReserveSection(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	src := filepath.Join(writeTestFiles(t, map[string]string{"main.go": reserveSectionSrc}), "main.go")
+
+	buildID := func(t *testing.T, exe string) string {
+		out, err := exec.Command(testenv.GoToolPath(t), "tool", "buildid", exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("go tool buildid %s: %v\n%s", exe, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	modes := []string{"internal"}
+	if testenv.HasCGO() {
+		modes = append(modes, "external")
+	}
+	for _, mode := range modes {
+		for _, flags := range []string{"", ",rw"} {
+			mode, flags := mode, flags
+			t.Run(mode+flags, func(t *testing.T) {
+				t.Parallel()
+				exe := filepath.Join(t.TempDir(), "main")
+				ldflags := "-linkmode=" + mode + " -reserve-section=.license=0x2000" + flags
+				goBuild(t, "", nil, "-ldflags="+ldflags, "-o", exe, src)
+
+				sect := openELF(t, exe).Section(".license")
+				if sect == nil {
+					t.Fatal("no .license section")
+				}
+				if sect.Type != elf.SHT_PROGBITS || sect.Size != 0x2000 {
+					t.Errorf(".license section is %v of size %#x, want SHT_PROGBITS of size 0x2000", sect.Type, sect.Size)
+				}
+				if sect.Addralign < 4096 || sect.Addr%4096 != 0 || sect.Offset%4096 != 0 {
+					t.Errorf(".license section at address %#x, offset %#x, alignment %#x, want page-aligned", sect.Addr, sect.Offset, sect.Addralign)
+				}
+				if writable := sect.Flags&elf.SHF_WRITE != 0; writable != (flags == ",rw") {
+					t.Errorf(".license section flags %v", sect.Flags)
+				}
+
+				if got, want := runTestProgram(t, exe), `8192 ""`; got != want {
+					t.Errorf("before patching: got %s, want %s", got, want)
+				}
+				id := buildID(t, exe)
+
+				const license = "licensed to gopher"
+				if dd, err := exec.LookPath("dd"); err == nil {
+					cmd := exec.Command(dd, "of="+exe, "bs=1", fmt.Sprintf("seek=%d", sect.Offset), "conv=notrunc")
+					cmd.Stdin = strings.NewReader(license)
+					if out, err := cmd.CombinedOutput(); err != nil {
+						t.Fatalf("dd: %v\n%s", err, out)
+					}
+				} else {
+					f, err := os.OpenFile(exe, os.O_WRONLY, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, err := f.WriteAt([]byte(license), int64(sect.Offset)); err != nil {
+						t.Fatal(err)
+					}
+					f.Close()
+				}
+
+				if got, want := runTestProgram(t, exe), `8192 "`+license+`"`; got != want {
+					t.Errorf("after patching: got %s, want %s", got, want)
+				}
+				if got := buildID(t, exe); got != id {
+					t.Errorf("after patching: build ID %s, want %s", got, id)
+				}
+			})
+		}
+	}
+
+	t.Run("clash", func(t *testing.T) {
+		t.Parallel()
+		exe := filepath.Join(t.TempDir(), "main")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-linkmode=internal -reserve-section=.rodata=16", "-o", exe, src)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatal("reserving .rodata succeeded")
+		}
+		if want := "section .rodata already exists"; !bytes.Contains(out, []byte(want)) {
+			t.Errorf("build failed with\n%s\nwant the error to contain %q", out, want)
+		}
+	})
+}
+
+const weakUndefC = `
+extern void hook(void) __attribute__((weak));
+extern int weakvar __attribute__((weak));
+extern int getpid(void) __attribute__((weak));
+
+int callhooks(void) {
+	int r = 0;
+	if (hook) {
+		hook();
+		r |= 1;
+	}
+	if (&weakvar) {
+		r |= 2;
+	}
+	if (getpid) {
+		r |= 4;
+	}
+	return r;
+}
+`
+
+const weakUndefGo = `package main
+
+// int callhooks(void);
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.callhooks())
+}
+`
+
+// TestWeakUndefined checks that weak undefined symbols of host objects
+// that nothing defines are resolved to 0 when linking internally, so
+// that the C code sees them as NULL, while those defined in the C
+// library are still bound to it.
+func TestWeakUndefined(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module weakundef\n",
+		"main.go": weakUndefGo,
+		"hook.c":  weakUndefC,
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		internal bool
+	}{
+		{"internal", []string{"-ldflags=-linkmode=internal"}, true},
+		{"internal-pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal"}, true},
+		{"external", []string{"-ldflags=-linkmode=external"}, false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			exe := filepath.Join(dir, test.name)
+			goBuild(t, dir, nil, append([]string{"-o", exe}, test.args...)...)
+			if got, want := runTestProgram(t, exe), "4"; got != want {
+				t.Errorf("%s printed %q, want %q", exe, got, want)
+			}
+			if !test.internal {
+				return
+			}
+
+			syms, err := openELF(t, exe).DynamicSymbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range syms {
+				switch s.Name {
+				case "hook", "weakvar":
+					if bind := elf.ST_BIND(s.Info); bind != elf.STB_WEAK || s.Section != elf.SHN_UNDEF {
+						t.Errorf("dynamic symbol %s is %v in section %v, want an undefined STB_WEAK symbol", s.Name, bind, s.Section)
+					}
+				}
+			}
+		})
+	}
+}
+
+const unresolvedGo = `package main
+
+/*
+void missing(void);
+static void callmissing(void) { missing(); }
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		C.callmissing()
+	}
+	fmt.Println("ok")
+}
+`
+
+// TestUnresolvedFlag checks that -unresolved=warn and ignore let a program
+// whose C code calls a function nothing defines link and run, as long
+// as the call is not made, and that the default is still an error.
+func TestUnresolvedFlag(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module unresolved\n",
+		"main.go": unresolvedGo,
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string // in the output of a failed link
+		warning string // in the output of the link
+	}{
+		{"error", []string{"-ldflags=-linkmode=internal"}, "missing, referenced by", ""},
+		{"internal", []string{"-ldflags=-linkmode=internal -unresolved=warn"}, "", "warning: undefined symbol missing resolved to 0"},
+		{"internal-ignore", []string{"-ldflags=-linkmode=internal -unresolved=ignore"}, "", ""},
+		{"internal-pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -unresolved=warn"}, "", "warning: undefined symbol missing left to the dynamic linker"},
+		{"external", []string{"-ldflags=-linkmode=external -unresolved=warn"}, "", ""},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			exe := filepath.Join(dir, test.name)
+			// cmd/go links the C code with the host linker to find its
+			// dynamic imports, which fails without CGO_LDFLAGS.
+			cmd := goBuildCmd(t, dir, []string{"CGO_LDFLAGS=-Wl,--unresolved-symbols=ignore-all"}, append([]string{"-o", exe}, test.args...)...)
+			out, err := cmd.CombinedOutput()
+			if test.wantErr != "" {
+				if err == nil {
+					t.Fatalf("%s succeeded, want an error", cmd)
+				}
+				if !strings.Contains(string(out), test.wantErr) {
+					t.Errorf("%s: output does not contain %q:\n%s", cmd, test.wantErr, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", cmd, err, out)
+			}
+			if test.warning != "" && !strings.Contains(string(out), test.warning) {
+				t.Errorf("%s: output does not contain %q:\n%s", cmd, test.warning, out)
+			}
+			if test.warning == "" && strings.Contains(string(out), "warning: undefined symbol") {
+				t.Errorf("%s: unexpected warning:\n%s", cmd, out)
+			}
+
+			if got, want := runTestProgram(t, exe), "ok"; got != want {
+				t.Errorf("%s printed %q, want %q", exe, got, want)
+			}
+		})
+	}
+}
+
+const exportLintGo = `package main
+
+import "C"
+
+//export Kept
+func Kept() {}
+
+//export Hidden
+func Hidden() {}
+
+func main() {}
+`
+
+const exportLintExcludedGo = `//go:build withexcluded
+
+package main
+
+import "C"
+
+//export Excluded
+func Excluded() {}
+`
+
+// TestExportLint checks that the linker reports the cgo exports of a
+// C shared library that the external linker hid, and not those that
+// were never compiled because build constraints excluded their file.
+func TestExportLint(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":      "module exportlint\n",
+		"main.go":     exportLintGo,
+		"excluded.go": exportLintExcludedGo,
+		"exports.map": "{ global: Kept; local: Hidden; };\n",
+	})
+
+	extld := "-extldflags=-Wl,--version-script=" + filepath.Join(dir, "exports.map")
+	lib := filepath.Join(dir, "libexport.so")
+	cmd := goBuildCmd(t, dir, nil, "-buildmode=c-shared", "-ldflags="+extld, "-o", lib)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+	want := "warning: cgo export Hidden of package main is not exported by the output: the external linker made it local"
+	if !bytes.Contains(out, []byte(want)) {
+		t.Errorf("build printed\n%s\nwant it to contain %q", out, want)
+	}
+	for _, name := range []string{"Kept", "Excluded"} {
+		if bytes.Contains(out, []byte("cgo export "+name)) {
+			t.Errorf("build printed\n%s\nwant no report for %s", out, name)
+		}
+	}
+
+	syms, err := openELF(t, lib).DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := make(map[string]bool)
+	for _, s := range syms {
+		if s.Section != elf.SHN_UNDEF {
+			exported[s.Name] = true
+		}
+	}
+	if !exported["Kept"] || exported["Hidden"] || exported["Excluded"] {
+		t.Errorf("library exports Kept %v, Hidden %v, Excluded %v; want true, false, false", exported["Kept"], exported["Hidden"], exported["Excluded"])
+	}
+
+	// With -strictwarnings, the report is an error.
+	os.Remove(lib)
+	cmd = goBuildCmd(t, dir, nil, "-buildmode=c-shared", "-ldflags=-strictwarnings "+extld, "-o", lib)
+	out, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("%s succeeded, want an error\n%s", cmd, out)
+	}
+	if want := "cgo export Hidden of package main is not exported"; !bytes.Contains(out, []byte(want)) {
+		t.Errorf("build failed with\n%s\nwant the error to contain %q", out, want)
+	}
+	if _, err := os.Stat(lib); err == nil {
+		t.Errorf("%s was written despite the error", lib)
+	}
+}
+
+const ifuncC = `
+static int implA(void) { return 1; }
+static int implB(void) { return 2; }
+
+static int pick = 2;
+
+static int (*resolveF(void))(void) {
+	return pick == 2 ? implB : implA;
+}
+
+int f(void) __attribute__((ifunc("resolveF")));
+
+int (*fp)(void) = f;
+
+int callf(void) {
+	int (*volatile p)(void) = f;
+	return f()*100 + p()*10 + fp();
+}
+`
+
+const ifuncGo = `package main
+
+// #cgo CFLAGS: {{.CFLAGS}}
+// int callf(void);
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.callf())
+}
+`
+
+// TestIFunc checks that an indirect function (STT_GNU_IFUNC) of a host
+// object linked internally is called, and its address taken, through
+// an IRELATIVE relocation, so that the implementation its resolver
+// selects is the one used.
+func TestIFunc(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	tmpl := template.Must(template.New("main").Parse(ifuncGo))
+	for _, cflags := range []string{"-fPIE", "-fPIC"} {
+		for _, mode := range []string{"exe", "pie"} {
+			cflags, mode := cflags, mode
+			t.Run(cflags+"-"+mode, func(t *testing.T) {
+				t.Parallel()
+
+				var main bytes.Buffer
+				if err := tmpl.Execute(&main, map[string]string{"CFLAGS": cflags}); err != nil {
+					t.Fatal(err)
+				}
+				dir := writeTestFiles(t, map[string]string{
+					"go.mod":  "module ifunc\n",
+					"main.go": main.String(),
+					"ifunc.c": ifuncC,
+				})
+				exe := filepath.Join(dir, "main")
+				goBuild(t, dir, nil, "-buildmode="+mode, "-ldflags=-linkmode=internal", "-o", exe)
+				if got, want := runTestProgram(t, exe), "222"; got != want {
+					t.Errorf("%s printed %q, want %q", exe, got, want)
+				}
+
+				ef := openELF(t, exe)
+				n := 0
+				for _, s := range ef.Sections {
+					if s.Type != elf.SHT_RELA {
+						continue
+					}
+					data, err := s.Data()
+					if err != nil {
+						t.Fatal(err)
+					}
+					for ; len(data) >= 24; data = data[24:] {
+						if elf.R_X86_64(elf.R_TYPE64(ef.ByteOrder.Uint64(data[8:]))) == elf.R_X86_64_IRELATIVE {
+							n++
+						}
+					}
+				}
+				if n != 1 {
+					t.Errorf("%d R_X86_64_IRELATIVE relocations, want 1", n)
+				}
+			})
+		}
+	}
+}
+
+const staticPIEGo = `package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var answer = &struct{ n int }{42}
+
+func main() {
+	fmt.Println(answer.n)
+	fmt.Printf("%#x\n", reflect.ValueOf(main).Pointer())
+}
+`
+
+func TestStaticPIE(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		linkmode string
+		cgo      bool
+	}{
+		{"internal", "internal", false},
+		{"external", "external", true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cgoEnabled := "CGO_ENABLED=0"
+			if test.cgo {
+				testenv.MustHaveCGO(t)
+				cgoEnabled = "CGO_ENABLED=1"
+				cc, cflags := getCCAndCCFLAGS(t, append(os.Environ(), cgoEnabled))
+				args := append(cflags, "-static-pie", "-o", filepath.Join(t.TempDir(), "a.out"), "-x", "c", "-")
+				cmd := exec.Command(cc, args...)
+				cmd.Stdin = strings.NewReader("int main(void) { return 0; }\n")
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Skipf("%s does not support -static-pie: %v\n%s", cc, err, out)
+				}
+			}
+
+			files := map[string]string{
+				"go.mod":  "module staticpie\n",
+				"main.go": staticPIEGo,
+			}
+			if test.cgo {
+				files["cgo.go"] = "package main\n\nimport \"C\"\n"
+			}
+			dir := writeTestFiles(t, files)
+			exe := filepath.Join(dir, "main")
+			goBuild(t, dir, []string{cgoEnabled}, "-buildmode=pie", "-ldflags=-static-pie -linkmode="+test.linkmode, "-o", exe)
+
+			ef := openELF(t, exe)
+			if ef.Type != elf.ET_DYN {
+				t.Errorf("ELF type %v, want %v", ef.Type, elf.ET_DYN)
+			}
+			hasDynamic := false
+			for _, p := range ef.Progs {
+				switch p.Type {
+				case elf.PT_INTERP:
+					t.Errorf("static PIE has a PT_INTERP program header")
+				case elf.PT_DYNAMIC:
+					hasDynamic = true
+				}
+			}
+			if !hasDynamic {
+				t.Errorf("static PIE has no PT_DYNAMIC program header")
+			}
+			libs, err := ef.ImportedLibraries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(libs) != 0 {
+				t.Errorf("static PIE needs libraries %v", libs)
+			}
+			syms, err := ef.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var linkAddr uint64
+			for _, s := range syms {
+				if s.Name == "main.main" {
+					linkAddr = s.Value
+				}
+			}
+
+			// Run the executable where the kernel chooses to load it,
+			// and, if setarch is there, without address space
+			// randomization, at an address that differs anyway from
+			// the link address.
+			runs := [][]string{{exe}}
+			if setarch, err := exec.LookPath("setarch"); err == nil && exec.Command(setarch, "-R", "true").Run() == nil {
+				runs = append(runs, []string{setarch, "-R", exe})
+			}
+			for _, args := range runs {
+				out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+				if err != nil {
+					t.Fatalf("%s: %v\n%s", args, err, out)
+				}
+				lines := strings.Fields(string(out))
+				if len(lines) != 2 || lines[0] != "42" {
+					t.Fatalf("%s printed %q, want 42 and the address of main.main", args, out)
+				}
+				if lines[1] == fmt.Sprintf("%#x", linkAddr) {
+					t.Errorf("%s: main.main at its link address %s, want it relocated", args, lines[1])
+				}
+			}
+		})
+	}
+}
+
+func TestStaticPIEEarlyGOT(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	// -debugearlygot makes the entry point of the static PIE load
+	// an address from the GOT before it has relocated itself.
+	cmd := goBuildCmd(t, dir, []string{"CGO_ENABLED=0"}, "-buildmode=pie", "-ldflags=-static-pie -debugearlygot=runtime.firstmoduledata", "-o", filepath.Join(dir, "main"), "main.go")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("%s succeeded, want an error", cmd)
+	}
+	want := "go.link.selfreloc: refers to runtime.firstmoduledata through the GOT before the static PIE has relocated itself"
+	if !bytes.Contains(out, []byte(want)) {
+		t.Errorf("%s: output does not contain %q:\n%s", cmd, want, out)
+	}
+}
+
+const sonameGo = `package main
+
+import "C"
+
+//export Hello
+func Hello() int { return 1 }
+
+func main() {}
+`
+
+func TestSoname(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module soname\n",
+		"main.go": sonameGo,
+	})
+
+	lib := filepath.Join(dir, "libhello.so.1.0.0")
+	goBuild(t, dir, nil, "-buildmode=c-shared", "-ldflags=-soname=libhello.so.1", "-o", lib)
+	soname, err := openELF(t, lib).DynString(elf.DT_SONAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"libhello.so.1"}; !reflect.DeepEqual(soname, want) {
+		t.Errorf("DT_SONAME = %q, want %q", soname, want)
+	}
+
+	// An executable has no use for a DT_SONAME.
+	cmd := goBuildCmd(t, dir, nil, "-ldflags=-soname=libhello.so.1", "-o", filepath.Join(dir, "hello"))
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("%s succeeded, want error", cmd)
+	}
+	if want := "-buildmode=exe cannot be used with -soname"; !bytes.Contains(out, []byte(want)) {
+		t.Errorf("%s printed\n%s\nwant it to contain %q", cmd, out, want)
+	}
+}
+
+const exportSymbolsGo = `package main
+
+import "C"
+
+//export Add
+func Add(a, b C.int) C.int { return a + b }
+
+//export Internal
+func Internal() {}
+
+func main() {}
+`
+
+const exportSymbolsC = `#include <stdio.h>
+#include "libexport.h"
+
+int main(void) {
+	printf("%d\n", Add(2, 3));
+	return 0;
+}
+`
+
+// TestExportSymbols checks that -exportsymbols limits the dynamic
+// symbols a C shared library defines to those listed, and that the
+// library still works.
+func TestExportSymbols(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":      "module exportsymbols\n",
+		"main.go":     exportSymbolsGo,
+		"main.c.txt":  exportSymbolsC,
+		"exports.txt": "# The API of the library.\nAdd\nMissing\n",
+	})
+
+	lib := filepath.Join(dir, "libexport.so")
+	cmd := goBuildCmd(t, dir, nil, "-buildmode=c-shared", "-ldflags=-exportsymbols=exports.txt", "-o", lib)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+	// Internal is left out on purpose, Missing is a mistake.
+	if want := "exports.txt lists Missing, which is not defined by the output"; !bytes.Contains(out, []byte(want)) {
+		t.Errorf("build printed\n%s\nwant it to contain %q", out, want)
+	}
+	if bytes.Contains(out, []byte("Internal")) {
+		t.Errorf("build printed\n%s\nwant no report for Internal", out)
+	}
+
+	syms, err := openELF(t, lib).DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported []string
+	for _, s := range syms {
+		if s.Section != elf.SHN_UNDEF && elf.ST_BIND(s.Info) != elf.STB_LOCAL {
+			exported = append(exported, s.Name)
+		}
+	}
+	if want := []string{"Add"}; !reflect.DeepEqual(exported, want) {
+		t.Errorf("library exports %q, want %q", exported, want)
+	}
+
+	env := append(os.Environ(), "CGO_ENABLED=1")
+	cc, cflags := getCCAndCCFLAGS(t, env)
+	exe := filepath.Join(dir, "main")
+	args := append(cflags, "-o", exe, "-x", "c", "main.c.txt", "-x", "none", lib)
+	cmd = exec.Command(cc, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+	cmd = exec.Command(exe)
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+	if string(out) != "5\n" {
+		t.Errorf("%s printed %q, want %q", exe, out, "5\n")
+	}
+}
+
+const exportSymbolVersionsGo = `package main
+
+import "C"
+
+//export Add
+func Add(a, b C.int) C.int { return a + b }
+
+//export Sub
+func Sub(a, b C.int) C.int { return a - b }
+
+func main() {}
+`
+
+// TestExportSymbolVersions checks that -exportsymbols attaches the
+// listed versions to the symbols of a C shared library.
+func TestExportSymbolVersions(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":      "module exportsymbolversions\n",
+		"main.go":     exportSymbolVersionsGo,
+		"exports.txt": "Add@LIBX_1.0\nSub@LIBX_2.0\n",
+	})
+
+	lib := filepath.Join(dir, "libx.so")
+	goBuild(t, dir, nil, "-buildmode=c-shared", "-ldflags=-exportsymbols=exports.txt", "-o", lib)
+
+	ef := openELF(t, lib)
+	if ef.SectionByType(elf.SHT_GNU_VERDEF) == nil {
+		t.Fatal("no version definitions")
+	}
+	syms, err := ef.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make(map[string]string)
+	for _, s := range syms {
+		if s.Section != elf.SHN_UNDEF && elf.ST_TYPE(s.Info) == elf.STT_FUNC {
+			versions[s.Name] = s.Version
+		}
+	}
+	if want := map[string]string{"Add": "LIBX_1.0", "Sub": "LIBX_2.0"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("library exports functions with versions %v, want %v", versions, want)
+	}
+}
+
+const exportDynamicGo = `package main
+
+// int callLib(const char *path);
+import "C"
+
+import (
+	"fmt"
+	"os"
+)
+
+//export GoAdd
+func GoAdd(a, b C.int) C.int { return a + b }
+
+func main() {
+	fmt.Println(C.callLib(C.CString(os.Args[1])))
+}
+`
+
+const exportDynamicC = `#include <dlfcn.h>
+#include <stdio.h>
+
+int hostHelper(int x) { return x * 10; }
+
+int callLib(const char *path) {
+	void *h = dlopen(path, RTLD_NOW);
+	if (h == NULL) {
+		fprintf(stderr, "%s\n", dlerror());
+		return -1;
+	}
+	int (*run)(void) = (int (*)(void))dlsym(h, "run");
+	return run();
+}
+`
+
+const exportDynamicLibC = `#define _GNU_SOURCE
+#include <dlfcn.h>
+#include <stddef.h>
+
+int run(void) {
+	int (*add)(int, int) = (int (*)(int, int))dlsym(RTLD_DEFAULT, "GoAdd");
+	int (*helper)(int) = (int (*)(int))dlsym(RTLD_DEFAULT, "hostHelper");
+	if (add == NULL) {
+		return -10;
+	}
+	if (helper == NULL) {
+		return -20;
+	}
+	return helper(add(2, 3));
+}
+`
+
+// TestExportDynamic checks that a library the program opens finds the
+// functions the program exports with //export and, with -exportdynamic,
+// the other C functions it defines, unless -exportsymbols leaves them
+// out.
+func TestExportDynamic(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":      "module exportdynamic\n",
+		"main.go":     exportDynamicGo,
+		"helper.c":    exportDynamicC,
+		"lib.c.txt":   exportDynamicLibC,
+		"exports.txt": "GoAdd\n",
+	})
+
+	env := append(os.Environ(), "CGO_ENABLED=1")
+	cc, cflags := getCCAndCCFLAGS(t, env)
+	lib := filepath.Join(dir, "lib.so")
+	cmd := exec.Command(cc, append(cflags, "-shared", "-o", lib, "-x", "c", "lib.c.txt")...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+
+	tests := []struct {
+		ldflags string
+		want    string
+	}{
+		{"-linkmode=internal", "-20"},
+		{"-linkmode=internal -exportdynamic", "50"},
+		{"-linkmode=internal -exportdynamic -exportsymbols=exports.txt", "-20"},
+		{"-linkmode=external", "50"},
+		{"-linkmode=external -exportdynamic", "50"},
+		{"-linkmode=external -exportsymbols=exports.txt", "-20"},
+	}
+	for _, test := range tests {
+		exe := filepath.Join(t.TempDir(), "main")
+		goBuild(t, dir, []string{"CGO_ENABLED=1"}, "-ldflags="+test.ldflags, "-o", exe)
+		out, err := exec.Command(exe, lib).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", exe, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != test.want {
+			t.Errorf("with %s, the library returned %s, want %s", test.ldflags, got, test.want)
+		}
+	}
+}
+
+const symbolicGo = `package main
+
+// int helper(int);
+import "C"
+
+//export Add
+func Add(a, b C.int) C.int { return C.helper(a) + b }
+
+func main() {}
+`
+
+// TestCSharedSymbolic checks that a C shared library binds the
+// references to its own functions and data when it is linked, as the
+// external linker is passed -Bsymbolic, so the dynamic linker only
+// resolves the symbols of other libraries.
+func TestCSharedSymbolic(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":   "module symbolic\n",
+		"main.go":  symbolicGo,
+		"helper.c": "int helper(int x) { return 2*x; }\n",
+	})
+
+	lib := filepath.Join(dir, "libsymbolic.so")
+	goBuild(t, dir, nil, "-buildmode=c-shared", "-o", lib)
+
+	ef := openELF(t, lib)
+	ds := ef.SectionByType(elf.SHT_DYNAMIC)
+	if ds == nil {
+		t.Fatal("no dynamic section")
+	}
+	d, err := ds.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbolic := false
+	for ; len(d) >= 16; d = d[16:] {
+		tag, val := elf.DynTag(ef.ByteOrder.Uint64(d)), ef.ByteOrder.Uint64(d[8:])
+		if tag == elf.DT_SYMBOLIC || tag == elf.DT_FLAGS && val&uint64(elf.DF_SYMBOLIC) != 0 {
+			symbolic = true
+		}
+	}
+	if !symbolic {
+		t.Error("library is not marked DF_SYMBOLIC")
+	}
+
+	syms, err := ef.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, s := range ef.Sections {
+		if s.Type != elf.SHT_RELA || s.Link == 0 || ef.Sections[s.Link].Type != elf.SHT_DYNSYM {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ; len(data) >= 24; data = data[24:] {
+			i := elf.R_SYM64(ef.ByteOrder.Uint64(data[8:]))
+			if i == 0 || int(i) > len(syms) {
+				continue
+			}
+			n++
+			if sym := syms[i-1]; sym.Section != elf.SHN_UNDEF {
+				t.Errorf("%s: dynamic relocation to %s, which the library defines", s.Name, sym.Name)
+			}
+		}
+	}
+	if n == 0 {
+		t.Error("no dynamic relocations to symbols")
+	}
+}
+
+const dumpGOTCgo = `package main
+
+// #include <stdio.h>
+// static void hello(void) { puts("hello"); fflush(stdout); }
+import "C"
+
+func main() { C.hello() }
+`
+
+// TestDumpGOT checks the GOT and PLT entries that -dumpgot reports for
+// internally linked PIEs: a Go program needs none, and a cgo program
+// only needs them for the symbols of the C library. A new entry of
+// another kind means the linker failed to relax an access.
+func TestDumpGOT(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		src  string
+		cgo  bool
+	}{
+		{"go", "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n", false},
+		{"cgo", dumpGOTCgo, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cgoEnabled := "CGO_ENABLED=0"
+			if test.cgo {
+				testenv.MustHaveCGO(t)
+				cgoEnabled = "CGO_ENABLED=1"
+			}
+			dir := writeTestFiles(t, map[string]string{"main.go": test.src})
+			exe := filepath.Join(dir, "main")
+			dump := filepath.Join(dir, "got.txt")
+			goBuild(t, dir, []string{cgoEnabled}, "-buildmode=pie", "-ldflags=-linkmode=internal -dumpgot="+dump, "-o", exe, "main.go")
+			if got := runTestProgram(t, exe); got != "hello" {
+				t.Fatalf("%s printed %q, want %q", exe, got, "hello")
+			}
+
+			data, err := ioutil.ReadFile(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entries int
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				if strings.HasPrefix(line, "#") {
+					continue
+				}
+				entries++
+				f := strings.Split(line, "\t")
+				if len(f) != 4 || f[0] != "got" && f[0] != "plt" {
+					t.Errorf("malformed line %q", line)
+					continue
+				}
+				if f[2] != "dynimport" {
+					t.Errorf("%s entry for %s: reason %s, want dynimport", f[0], f[1], f[2])
+				}
+				if f[3] == "-" {
+					t.Errorf("%s entry for %s has no referencing package", f[0], f[1])
+				}
+			}
+			switch {
+			case !test.cgo && entries != 0:
+				t.Errorf("Go program has %d GOT and PLT entries, want none:\n%s", entries, data)
+			case test.cgo && entries == 0:
+				t.Errorf("cgo program has no GOT and PLT entries:\n%s", data)
+			}
+			if !strings.Contains(string(data), "\n# total: ") {
+				t.Errorf("no summary in\n%s", data)
+			}
+		})
+	}
+}
+
+func TestInterp(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const interp = "/lib/ld-custom.so.1"
+	tests := []struct {
+		name    string
+		args    []string
+		cgo     bool
+		wantErr string
+	}{
+		{"pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -interp=" + interp}, false, ""},
+		{"external", []string{"-ldflags=-linkmode=external -interp=" + interp}, true, ""},
+		{"static", []string{"-ldflags=-interp=" + interp}, false, "statically linked"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cgoEnabled := "CGO_ENABLED=0"
+			if test.cgo {
+				testenv.MustHaveCGO(t)
+				cgoEnabled = "CGO_ENABLED=1"
+			}
+			dir := writeTestFiles(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+			exe := filepath.Join(dir, "main")
+			cmd := goBuildCmd(t, dir, []string{cgoEnabled}, append(append([]string{"-o", exe}, test.args...), "main.go")...)
+			out, err := cmd.CombinedOutput()
+			if test.wantErr != "" {
+				if err == nil || !bytes.Contains(out, []byte(test.wantErr)) {
+					t.Fatalf("%s: got %v, want error containing %q\n%s", cmd, err, test.wantErr, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", cmd, err, out)
+			}
+
+			ef := openELF(t, exe)
+			sect := ef.Section(".interp")
+			if sect == nil {
+				t.Fatal("no .interp section")
+			}
+			data, err := sect.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != interp+"\x00" {
+				t.Errorf(".interp is %q, want %q", data, interp+"\x00")
+			}
+		})
+	}
+}
+
+func TestSeparateCode(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+// #include <stdio.h>
+// static void hello(void) { puts("hello"); fflush(stdout); }
+import "C"
+
+func main() { C.hello() }
+`
+	tests := []struct {
+		name string
+		args []string
+		run  bool
+	}{
+		{"exe", []string{"-ldflags=-linkmode=internal -separate-code"}, true},
+		{"pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -separate-code"}, true},
+		{"external", []string{"-buildmode=pie", "-ldflags=-linkmode=external -separate-code"}, true},
+		{"c-shared", []string{"-buildmode=c-shared", "-ldflags=-separate-code"}, false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			bin := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", bin}, test.args...), src)...)
+			if test.run {
+				if got, want := runTestProgram(t, bin), "hello"; got != want {
+					t.Fatalf("%s printed %q, want %q", bin, got, want)
+				}
+			}
+
+			ef := openELF(t, bin)
+			for _, p := range ef.Progs {
+				if p.Type != elf.PT_LOAD || p.Flags&elf.PF_X == 0 {
+					continue
+				}
+				if p.Flags&elf.PF_W != 0 {
+					t.Errorf("segment at %#x is writable and executable", p.Vaddr)
+				}
+				if p.Off%p.Align != 0 || p.Vaddr%p.Align != 0 {
+					t.Errorf("executable segment at %#x, offset %#x, does not start a page of %#x bytes", p.Vaddr, p.Off, p.Align)
+				}
+				// Only code may share the pages of the segment.
+				start, end := p.Vaddr&^(p.Align-1), (p.Vaddr+p.Memsz+p.Align-1)&^(p.Align-1)
+				for _, sect := range ef.Sections {
+					if sect.Flags&elf.SHF_ALLOC == 0 || sect.Size == 0 || sect.Type == elf.SHT_NOBITS {
+						continue
+					}
+					if sect.Addr < end && sect.Addr+sect.Size > start && sect.Flags&elf.SHF_EXECINSTR == 0 {
+						t.Errorf("section %s at %#x is in or next to the executable segment [%#x, %#x)", sect.Name, sect.Addr, p.Vaddr, p.Vaddr+p.Memsz)
+					}
+				}
+				// Nor may the headers.
+				if p.Off == 0 {
+					t.Errorf("executable segment at %#x holds the ELF headers", p.Vaddr)
+				}
+			}
+		})
+	}
+}
+
+func TestBindNow(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+// #include <stdio.h>
+// static void hello(void) { puts("hello"); fflush(stdout); }
+import "C"
+
+func main() { C.hello() }
+`
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -bindnow"}},
+		{"exe", []string{"-ldflags=-linkmode=internal -bindnow"}},
+		{"external", []string{"-buildmode=pie", "-ldflags=-linkmode=external -bindnow"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			exe := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", exe}, test.args...), src)...)
+			if got, want := runTestProgram(t, exe), "hello"; got != want {
+				t.Fatalf("%s printed %q, want %q", exe, got, want)
+			}
+
+			ef := openELF(t, exe)
+			ds := ef.SectionByType(elf.SHT_DYNAMIC)
+			if ds == nil {
+				t.Fatal("no dynamic section")
+			}
+			d, err := ds.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			const DF_1_NOW = 1
+			var flags, flags1 uint64
+			for ; len(d) >= 16; d = d[16:] {
+				switch tag, val := elf.DynTag(ef.ByteOrder.Uint64(d)), ef.ByteOrder.Uint64(d[8:]); tag {
+				case elf.DT_FLAGS:
+					flags = val
+				case elf.DT_FLAGS_1:
+					flags1 = val
+				}
+			}
+			if flags&uint64(elf.DF_BIND_NOW) == 0 {
+				t.Errorf("DT_FLAGS is %#x, want DF_BIND_NOW", flags)
+			}
+			if flags1&DF_1_NOW == 0 {
+				t.Errorf("DT_FLAGS_1 is %#x, want DF_1_NOW", flags1)
+			}
+
+			// The dynamic linker makes the relro segment read-only
+			// after binding, and all of the GOT must be in it.
+			var relro *elf.Prog
+			for _, p := range ef.Progs {
+				if p.Type == elf.PT_GNU_RELRO {
+					relro = p
+				}
+			}
+			if relro == nil {
+				t.Fatal("no PT_GNU_RELRO segment")
+			}
+			for _, name := range []string{".got", ".got.plt"} {
+				sect := ef.Section(name)
+				if sect == nil {
+					continue
+				}
+				if sect.Addr < relro.Vaddr || sect.Addr+sect.Size > relro.Vaddr+relro.Memsz {
+					t.Errorf("%s [%#x, %#x) is not in PT_GNU_RELRO [%#x, %#x)", name, sect.Addr, sect.Addr+sect.Size, relro.Vaddr, relro.Vaddr+relro.Memsz)
+				}
+			}
+		})
+	}
+}
+
+func TestPclntabRelro(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+//export F
+func F() {}
+
+func main() {
+	pc, _, _, _ := runtime.Caller(0)
+	fmt.Println(runtime.FuncForPC(pc).Name())
+}
+`
+	tests := []struct {
+		name  string
+		args  []string
+		relro bool // whether the tables must be in PT_GNU_RELRO
+		cgo   bool
+	}{
+		{"exe", []string{"-ldflags=-linkmode=internal"}, false, false},
+		{"pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal"}, true, false},
+		{"external", []string{"-buildmode=pie", "-ldflags=-linkmode=external"}, true, true},
+		{"c-shared", []string{"-buildmode=c-shared"}, true, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if test.cgo {
+				testenv.MustHaveCGO(t)
+			}
+			t.Parallel()
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			exe := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", exe}, test.args...), src)...)
+			if test.name != "c-shared" {
+				// The runtime still finds its functions.
+				if got, want := runTestProgram(t, exe), "main.main"; got != want {
+					t.Fatalf("%s printed %q, want %q", exe, got, want)
+				}
+			}
+
+			ef := openELF(t, exe)
+			syms, err := ef.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := make(map[string]elf.Symbol)
+			for _, s := range syms {
+				addr[s.Name] = s
+			}
+			var relro *elf.Prog
+			for _, p := range ef.Progs {
+				if p.Type == elf.PT_GNU_RELRO {
+					relro = p
+				}
+			}
+			if test.relro && relro == nil {
+				t.Fatal("no PT_GNU_RELRO segment")
+			}
+			inRelro := func(start, end uint64) bool {
+				return relro != nil && relro.Vaddr <= start && end <= relro.Vaddr+relro.Memsz
+			}
+			// readOnly reports whether [start, end) is in a
+			// segment that is never writable.
+			readOnly := func(start, end uint64) bool {
+				for _, p := range ef.Progs {
+					if p.Type == elf.PT_LOAD && p.Flags&elf.PF_W == 0 && p.Vaddr <= start && end <= p.Vaddr+p.Memsz {
+						return true
+					}
+				}
+				return false
+			}
+
+			pclntab, ok1 := addr["runtime.pclntab"]
+			epclntab, ok2 := addr["runtime.epclntab"]
+			if !ok1 || !ok2 {
+				t.Fatal("missing runtime.pclntab or runtime.epclntab")
+			}
+			if test.relro {
+				// The pcHeader is relocated by the dynamic
+				// linker, and so in relro rather than in a
+				// read-only segment.
+				if !inRelro(pclntab.Value, epclntab.Value) {
+					t.Errorf("pclntab [%#x, %#x) is not in PT_GNU_RELRO [%#x, %#x)", pclntab.Value, epclntab.Value, relro.Vaddr, relro.Vaddr+relro.Memsz)
+				}
+			} else if !readOnly(pclntab.Value, epclntab.Value) {
+				t.Errorf("pclntab [%#x, %#x) is not in a read-only segment", pclntab.Value, epclntab.Value)
+			}
+
+			// The findfunctab has no relocations, and is
+			// read-only either way.
+			ff, ok := addr["runtime.findfunctab"]
+			if !ok {
+				t.Fatal("missing runtime.findfunctab")
+			}
+			if end := ff.Value + ff.Size; !readOnly(ff.Value, end) && !inRelro(ff.Value, end) {
+				t.Errorf("findfunctab [%#x, %#x) is writable", ff.Value, end)
+			}
+
+			// The runtime writes to the moduledata, which must
+			// stay out of relro.
+			md, ok := addr["runtime.firstmoduledata"]
+			if !ok {
+				t.Fatal("missing runtime.firstmoduledata")
+			}
+			if end := md.Value + md.Size; inRelro(md.Value, end) || readOnly(md.Value, end) {
+				t.Errorf("firstmoduledata [%#x, %#x) is read-only", md.Value, end)
+			}
+		})
+	}
+}
+
+func TestTextAlign(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+// #include <stdio.h>
+// static void hello(void) { puts("hello"); fflush(stdout); }
+import "C"
+
+func main() { C.hello() }
+`
+	const align = 0x200000
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"exe", []string{"-ldflags=-linkmode=internal -textalign=0x200000"}},
+		{"pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -textalign=0x200000"}},
+		{"separate-code", []string{"-ldflags=-linkmode=internal -textalign=0x200000 -separate-code"}},
+		{"external", []string{"-buildmode=pie", "-ldflags=-linkmode=external -textalign=0x200000"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			bin := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", bin}, test.args...), src)...)
+			if got, want := runTestProgram(t, bin), "hello"; got != want {
+				t.Fatalf("%s printed %q, want %q", bin, got, want)
+			}
+
+			ef := openELF(t, bin)
+			var text *elf.Prog
+			for _, p := range ef.Progs {
+				if p.Type == elf.PT_LOAD && p.Flags&elf.PF_X != 0 {
+					if text != nil {
+						t.Fatalf("more than one executable segment")
+					}
+					text = p
+				}
+			}
+			if text == nil {
+				t.Fatalf("no executable segment")
+			}
+			if text.Align != align {
+				t.Errorf("text segment alignment is %#x, want %#x", text.Align, align)
+			}
+			if text.Off%align != 0 || text.Vaddr%align != 0 {
+				t.Errorf("text segment at %#x, offset %#x, is not aligned to %#x", text.Vaddr, text.Off, align)
+			}
+			for _, p := range ef.Progs {
+				if p.Type == elf.PT_LOAD && p.Off%p.Align != p.Vaddr%p.Align {
+					t.Errorf("segment at %#x, offset %#x, is not congruent modulo its alignment %#x", p.Vaddr, p.Off, p.Align)
+				}
+			}
+		})
+	}
+}
+
+func TestHashStyle(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	// The program looks up its own exported functions, which the
+	// dynamic linker finds through the hash tables.
+	var prog strings.Builder
+	prog.WriteString(`package main
+
+// #cgo LDFLAGS: -ldl
+// #include <dlfcn.h>
+// static int lookup(const char *name) { return dlsym(dlopen(NULL, RTLD_NOW), name) != 0; }
+import "C"
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	for _, name := range os.Args[1:] {
+		fmt.Println(name, C.lookup(C.CString(name)))
+	}
+}
+`)
+	var names []string
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("GoFunc%d", i)
+		fmt.Fprintf(&prog, "\n//export %s\nfunc %s() {}\n", name, name)
+		names = append(names, name)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		sysv, gnu bool
+	}{
+		{"default", []string{"-ldflags=-linkmode=internal"}, true, true},
+		{"sysv", []string{"-ldflags=-linkmode=internal -hash-style=sysv"}, true, false},
+		{"gnu", []string{"-ldflags=-linkmode=internal -hash-style=gnu"}, false, true},
+		{"both-pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -hash-style=both"}, true, true},
+		{"gnu-external", []string{"-ldflags=-linkmode=external -hash-style=gnu"}, false, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog.String()})
+			src := filepath.Join(dir, "main.go")
+			bin := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", bin}, test.args...), src)...)
+			out, err := exec.Command(bin, append(names, "NoSuchFunc")...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", bin, err, out)
+			}
+			var want strings.Builder
+			for _, name := range names {
+				fmt.Fprintf(&want, "%s 1\n", name)
+			}
+			want.WriteString("NoSuchFunc 0\n")
+			if string(out) != want.String() {
+				t.Errorf("%s: got\n%s\nwant\n%s", bin, out, want.String())
+			}
+
+			ef := openELF(t, bin)
+			if got := ef.Section(".hash") != nil; got != test.sysv {
+				t.Errorf("has .hash: %v, want %v", got, test.sysv)
+			}
+			gnuHash := ef.Section(".gnu.hash")
+			if got := gnuHash != nil; got != test.gnu {
+				t.Errorf("has .gnu.hash: %v, want %v", got, test.gnu)
+			}
+			if gnuHash == nil {
+				return
+			}
+			if gnuHash.Type != elf.SHT_GNU_HASH {
+				t.Errorf(".gnu.hash has type %v, want %v", gnuHash.Type, elf.SHT_GNU_HASH)
+			}
+			syms, err := ef.DynamicSymbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := gnuHash.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGNUHash(t, ef, data, syms)
+		})
+	}
+}
+
+// checkGNUHash checks that every defined symbol of syms, the dynamic
+// symbols without the null symbol, can be found in the GNU hash table
+// data, and that the undefined ones come before all the others.
+func checkGNUHash(t *testing.T, ef *elf.File, data []byte, syms []elf.Symbol) {
+	gnuhash := func(name string) uint32 {
+		h := uint32(5381)
+		for i := 0; i < len(name); i++ {
+			h = h*33 + uint32(name[i])
+		}
+		return h
+	}
+	bo := ef.ByteOrder
+	nbucket := bo.Uint32(data)
+	symoffset := bo.Uint32(data[4:])
+	maskwords := bo.Uint32(data[8:])
+	shift2 := bo.Uint32(data[12:])
+	wordBits := uint32(64)
+	if ef.Class == elf.ELFCLASS32 {
+		wordBits = 32
+	}
+	bloom := data[16:]
+	buckets := bloom[maskwords*wordBits/8:]
+	chain := buckets[nbucket*4:]
+	for i, s := range syms {
+		dynid := uint32(i + 1)
+		if s.Section == elf.SHN_UNDEF {
+			if dynid >= symoffset {
+				t.Errorf("undefined symbol %s is number %d, in the GNU hash table from %d", s.Name, dynid, symoffset)
+			}
+			continue
+		}
+		h := gnuhash(s.Name)
+		word := bloom[h/wordBits%maskwords*wordBits/8:]
+		var w uint64
+		if wordBits == 64 {
+			w = bo.Uint64(word)
+		} else {
+			w = uint64(bo.Uint32(word))
+		}
+		if w>>(h%wordBits)&1 == 0 || w>>(h>>shift2%wordBits)&1 == 0 {
+			t.Errorf("symbol %s is not in the Bloom filter", s.Name)
+			continue
+		}
+		found := false
+		for j := bo.Uint32(buckets[h%nbucket*4:]); j != 0 && j >= symoffset; j++ {
+			c := bo.Uint32(chain[(j-symoffset)*4:])
+			if c|1 == h|1 && j == dynid {
+				found = true
+				break
+			}
+			if c&1 != 0 {
+				break
+			}
+		}
+		if !found {
+			t.Errorf("symbol %s (number %d) is not in the GNU hash table", s.Name, dynid)
+		}
+	}
+}
+
+func TestEmitReloc(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+var hello = "hello"
+
+//go:noinline
+func greet() { fmt.Println(hello) }
+
+func main() { greet() }
+`
+
+	tests := []struct {
+		name     string
+		args     []string
+		external bool
+	}{
+		{"exe", []string{"-ldflags=-linkmode=internal -emitreloc"}, false},
+		{"pie", []string{"-buildmode=pie", "-ldflags=-linkmode=internal -emitreloc"}, false},
+		{"external", []string{"-ldflags=-linkmode=external -emitreloc"}, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if test.external {
+				testenv.MustHaveCGO(t)
+			}
+			t.Parallel()
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			bin := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", bin}, test.args...), src)...)
+			if got, want := runTestProgram(t, bin), "hello"; got != want {
+				t.Fatalf("%s printed %q, want %q", bin, got, want)
+			}
+
+			ef := openELF(t, bin)
+			checkEmitReloc(t, ef)
+		})
+	}
+}
+
+// checkEmitReloc checks that the relocations kept by -emitreloc for
+// .text and .data compute the values found in the output, and that
+// there is one for the call of main.greet by main.main.
+func checkEmitReloc(t *testing.T, ef *elf.File) {
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mainSym elf.Symbol
+	for _, s := range syms {
+		if s.Name == "main.main" {
+			mainSym = s
+		}
+	}
+
+	bo := ef.ByteOrder
+	checked := make(map[string]int)
+	call := false
+	for _, name := range []string{".text", ".data"} {
+		sect := ef.Section(name)
+		rsect := ef.Section(".rela" + name)
+		if sect == nil || rsect == nil {
+			t.Fatalf("missing %s or its relocations", name)
+		}
+		if rsect.Type != elf.SHT_RELA || rsect.Flags&elf.SHF_ALLOC != 0 || ef.Sections[rsect.Link].Type != elf.SHT_SYMTAB {
+			t.Errorf("%s: type %v, flags %v, link %d, want non-allocated SHT_RELA linked to .symtab", rsect.Name, rsect.Type, rsect.Flags, rsect.Link)
+		}
+		data, err := sect.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rdata, err := rsect.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for len(rdata) >= 24 {
+			off := bo.Uint64(rdata)
+			info := bo.Uint64(rdata[8:])
+			addend := int64(bo.Uint64(rdata[16:]))
+			rdata = rdata[24:]
+
+			if off < sect.Addr || off >= sect.Addr+sect.Size || info>>32 == 0 || int(info>>32) > len(syms) {
+				t.Fatalf("%s: bad relocation at %#x, info %#x", rsect.Name, off, info)
+			}
+			s := syms[info>>32-1]
+			if s.Section == elf.SHN_UNDEF {
+				continue
+			}
+			p := int64(off)
+			sa := int64(s.Value) + addend
+			field := data[off-sect.Addr:]
+			var typ string
+			var got, want int64
+			switch ef.Machine {
+			case elf.EM_X86_64:
+				switch rt := elf.R_X86_64(info & 0xffffffff); rt {
+				case elf.R_X86_64_64:
+					got, want = int64(bo.Uint64(field)), sa
+				case elf.R_X86_64_PC32, elf.R_X86_64_PLT32:
+					got, want = int64(int32(bo.Uint32(field))), sa-p
+					call = call || s.Name == "main.greet" && off-mainSym.Value < mainSym.Size
+				default:
+					continue
+				}
+				typ = elf.R_X86_64(info & 0xffffffff).String()
+			case elf.EM_AARCH64:
+				switch rt := elf.R_AARCH64(info & 0xffffffff); rt {
+				case elf.R_AARCH64_ABS64:
+					got, want = int64(bo.Uint64(field)), sa
+				case elf.R_AARCH64_CALL26:
+					got, want = int64(int32(bo.Uint32(field)<<6)>>4), sa-p
+					call = call || s.Name == "main.greet" && off-mainSym.Value < mainSym.Size
+				case elf.R_AARCH64_ADR_PREL_PG_HI21:
+					ins := bo.Uint32(field)
+					got, want = int64(int32((ins>>5&0x7ffff)<<2|ins>>29&3)<<11>>11)<<12, sa&^0xfff-p&^0xfff
+				case elf.R_AARCH64_ADD_ABS_LO12_NC:
+					got, want = int64(bo.Uint32(field)>>10&0xfff), sa&0xfff
+				default:
+					continue
+				}
+				typ = elf.R_AARCH64(info & 0xffffffff).String()
+			}
+			checked[typ]++
+			if got != want {
+				t.Errorf("%s at %#x against %s%+d: value %#x, want %#x", typ, off, s.Name, addend, got, want)
+			}
+		}
+	}
+	if len(checked) == 0 {
+		t.Errorf("no relocations checked")
+	}
+	if !call {
+		t.Errorf("no relocation for the call of main.greet by main.main")
+	}
+	t.Logf("checked relocations: %v", checked)
+}
+
+func TestFuncAlignFlag(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skip("test only works on linux")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+//go:noinline
+func f(s string) { fmt.Println(s) }
+
+func main() { f("hello") }
+`
+	const align = 64
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"exe", []string{"-ldflags=-funcalign=64"}},
+		{"pie", []string{"-buildmode=pie", "-ldflags=-funcalign=64"}},
+		{"external", []string{"-ldflags=-linkmode=external -funcalign=64"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if test.name == "external" {
+				testenv.MustHaveCGO(t)
+			}
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			bin := filepath.Join(dir, "main")
+			goBuild(t, "", nil, append(append([]string{"-o", bin}, test.args...), src)...)
+			if got, want := runTestProgram(t, bin), "hello"; got != want {
+				t.Fatalf("%s printed %q, want %q", bin, got, want)
+			}
+
+			ef := openELF(t, bin)
+			syms, err := ef.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Check the Go functions, between runtime.text and
+			// runtime.etext; when linking externally, the C
+			// functions around them keep their own alignment.
+			var text, etext uint64
+			for _, s := range syms {
+				switch s.Name {
+				case "runtime.text":
+					text = s.Value
+				case "runtime.etext":
+					etext = s.Value
+				}
+			}
+			if text == 0 || etext == 0 {
+				t.Fatalf("runtime.text or runtime.etext not found")
+			}
+			n := 0
+			for _, s := range syms {
+				if elf.ST_TYPE(s.Info) != elf.STT_FUNC || s.Value < text || s.Value >= etext {
+					continue
+				}
+				n++
+				if s.Value%align != 0 {
+					t.Errorf("%s at %#x is not %d-byte aligned", s.Name, s.Value, align)
+				}
+			}
+			if n == 0 {
+				t.Errorf("no functions found in the text")
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeTestFiles(t, map[string]string{"main.go": prog})
+		src := filepath.Join(dir, "main.go")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "main"), "-ldflags=-funcalign=48", src)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("%s succeeded, want error", cmd)
+		}
+		if want := "-funcalign=48 must be a power of two"; !strings.Contains(string(out), want) {
+			t.Errorf("%s: output does not contain %q:\n%s", cmd, want, out)
+		}
+	})
+}
+
+func TestStripSections(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+func main() { fmt.Println("hello") }
+`
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"exe", nil},
+		{"pie", []string{"-buildmode=pie"}},
+		{"external", []string{"-ldflags=-linkmode=external"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if test.name == "external" {
+				testenv.MustHaveCGO(t)
+			}
+
+			dir := writeTestFiles(t, map[string]string{"main.go": prog})
+			src := filepath.Join(dir, "main.go")
+			build := func(name, ldflags string) string {
+				bin := filepath.Join(dir, name)
+				args := []string{"build", "-o", bin}
+				for _, arg := range test.args {
+					if strings.HasPrefix(arg, "-ldflags=") {
+						ldflags = arg[len("-ldflags="):] + " " + ldflags
+					} else {
+						args = append(args, arg)
+					}
+				}
+				cmd := exec.Command(testenv.GoToolPath(t), append(args, "-ldflags="+ldflags, src)...)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("%s: %v\n%s", cmd, err, out)
+				}
+				return bin
+			}
+			full := build("full", "")
+			bin := build("stripped", "-strip=sections")
+
+			if got, want := runTestProgram(t, bin), "hello"; got != want {
+				t.Fatalf("%s printed %q, want %q", bin, got, want)
+			}
+
+			ef := openELF(t, bin)
+			if len(ef.Sections) != 0 {
+				t.Errorf("output has %d sections, want none", len(ef.Sections))
+			}
+			hasNote := false
+			for _, p := range ef.Progs {
+				if p.Type == elf.PT_NOTE {
+					hasNote = true
+				}
+			}
+			if !hasNote {
+				t.Errorf("output has no PT_NOTE segment")
+			}
+
+			// The output lacks at least the symbol table and the DWARF
+			// sections of the full one.
+			fullef := openELF(t, full)
+			var want int64
+			for _, s := range fullef.Sections {
+				if s.Type == elf.SHT_SYMTAB || s.Type == elf.SHT_STRTAB && s.Name == ".strtab" || strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+					want += int64(s.FileSize)
+				}
+			}
+			fullfi, err := os.Stat(full)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(bin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved := fullfi.Size() - fi.Size(); saved < want {
+				t.Errorf("-strip=sections saved %d bytes, want at least %d", saved, want)
+			}
+
+			// The go command finds the build information and the build
+			// ID without the sections.
+			info, err := buildinfo.ReadFile(bin)
+			if err != nil {
+				t.Errorf("reading build info: %v", err)
+			} else if info.Path != "command-line-arguments" {
+				t.Errorf("build info path is %q, want command-line-arguments", info.Path)
+			}
+			cmd := exec.Command(testenv.GoToolPath(t), "tool", "buildid", bin)
+			if out, err := cmd.CombinedOutput(); err != nil || len(bytes.TrimSpace(out)) == 0 {
+				t.Errorf("%s: %v\n%s", cmd, err, out)
+			}
+		})
+	}
+}
+
+func TestStripSymtab(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+var f = 1.5
+
+func main() {
+	fmt.Println("hello", f*3.25)
+}
+`
+	dir := writeTestFiles(t, map[string]string{"main.go": prog})
+	src := filepath.Join(dir, "main.go")
+
+	tests := []struct {
+		name     string
+		ldflags  string
+		symtab   bool // output has .symtab
+		dwarf    bool // output has DWARF
+		locals   bool // .symtab has generated locals
+		external bool
+	}{
+		{"symtab", "-strip=symtab", false, true, false, false},
+		{"locals", "-strip=locals", true, true, false, false},
+		{"dwarf", "-strip=dwarf", true, false, true, false},
+		{"symtab,locals", "-strip=symtab,locals", false, true, false, false},
+		{"s", "-s", false, false, false, false},
+		{"w", "-w", true, false, true, false},
+		{"external-symtab", "-linkmode=external -strip=symtab", false, true, false, true},
+		{"external-locals", "-linkmode=external -strip=locals", true, true, false, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if test.external {
+				testenv.MustHaveCGO(t)
+			}
+			bin := filepath.Join(dir, strings.Replace(test.name, ",", "-", -1))
+			goBuild(t, "", nil, "-o", bin, "-ldflags="+test.ldflags, src)
+			if got, want := runTestProgram(t, bin), "hello 4.875"; got != want {
+				t.Fatalf("%s printed %q, want %q", bin, got, want)
+			}
+
+			ef := openELF(t, bin)
+			if ef.Section(".gopclntab") == nil {
+				t.Errorf("output has no .gopclntab")
+			}
+			if test.external && ef.SectionByType(elf.SHT_DYNSYM) == nil {
+				t.Errorf("output has no dynamic symbol table")
+			}
+
+			syms, err := ef.Symbols()
+			if (err == nil) != test.symtab {
+				t.Errorf("reading symbol table: got error %v, want symbol table %v", err, test.symtab)
+			}
+			if test.symtab {
+				hasMain, hasLocals := false, false
+				for _, s := range syms {
+					switch {
+					case s.Name == "main.main":
+						hasMain = true
+					case strings.HasPrefix(s.Name, "$f64."), strings.Contains(s.Name, "..stmp_"), strings.Contains(s.Name, "..gobytes."):
+						hasLocals = true
+					}
+				}
+				if !hasMain {
+					t.Errorf("symbol table has no main.main")
+				}
+				if hasLocals != test.locals {
+					t.Errorf("symbol table has generated locals: %v, want %v", hasLocals, test.locals)
+				}
+			}
+
+			d, err := ef.DWARF()
+			if (err == nil) != test.dwarf {
+				t.Fatalf("reading DWARF: got error %v, want DWARF %v", err, test.dwarf)
+			}
+			if !test.dwarf {
+				return
+			}
+			// A debugger sets a breakpoint in main.main from the
+			// DWARF alone: find its entry and the line table row
+			// for its body.
+			r := d.Reader()
+			var pc uint64
+			for {
+				e, err := r.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e == nil {
+					break
+				}
+				if e.Tag == dwarf.TagSubprogram && e.Val(dwarf.AttrName) == "main.main" {
+					pc, _ = e.Val(dwarf.AttrLowpc).(uint64)
+					break
+				}
+			}
+			if pc == 0 {
+				t.Fatalf("no DWARF entry with an address for main.main")
+			}
+			r.Seek(0)
+			found := false
+			for !found {
+				cu, err := r.Next()
+				if err != nil || cu == nil {
+					break
+				}
+				if cu.Tag != dwarf.TagCompileUnit {
+					r.SkipChildren()
+					continue
+				}
+				lr, err := d.LineReader(cu)
+				if err != nil || lr == nil {
+					r.SkipChildren()
+					continue
+				}
+				var le dwarf.LineEntry
+				for lr.Next(&le) == nil {
+					if filepath.Base(le.File.Name) == "main.go" && le.Line == 8 && le.Address >= pc {
+						found = true
+						break
+					}
+				}
+				r.SkipChildren()
+			}
+			if !found {
+				t.Errorf("no line table entry for main.go:8 in main.main")
+			}
+		})
+	}
+}
+
+const fileSymsGo = `package main
+
+import "filesyms/p"
+
+func main() { println(p.Tab()) }
+`
+
+const fileSymsPkgGo = `package p
+
+func Tab() int64
+`
+
+const fileSymsAMD64 = `#include "textflag.h"
+
+DATA tab<>+0(SB)/8, $42
+GLOBL tab<>(SB), RODATA, $8
+
+TEXT ·Tab(SB),NOSPLIT,$0-8
+	MOVQ tab<>(SB), AX
+	MOVQ AX, ret+0(FP)
+	RET
+`
+
+const fileSymsARM64 = `#include "textflag.h"
+
+DATA tab<>+0(SB)/8, $42
+GLOBL tab<>(SB), RODATA, $8
+
+TEXT ·Tab(SB),NOSPLIT,$0-8
+	MOVD tab<>(SB), R0
+	MOVD R0, ret+0(FP)
+	RET
+`
+
+// TestFileSymbols checks that the local symbols of the symbol table
+// follow an STT_FILE symbol naming the package that defines them.
+func TestFileSymbols(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":        "module filesyms\n",
+		"main.go":       fileSymsGo,
+		"p/p.go":        fileSymsPkgGo,
+		"p/tab_amd64.s": fileSymsAMD64,
+		"p/tab_arm64.s": fileSymsARM64,
+	})
+
+	for _, goarch := range []string{"amd64", "arm64"} {
+		goarch := goarch
+		t.Run(goarch, func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			goBuild(t, dir, []string{"GOOS=linux", "GOARCH=" + goarch, "CGO_ENABLED=0"}, "-ldflags=-linkmode=internal", "-o", exe)
+			ef := openELF(t, exe)
+			syms, err := ef.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file := "" // the file of the current local symbol
+			seen := make(map[string]bool)
+			found := false
+			for i, s := range syms {
+				if elf.ST_BIND(s.Info) != elf.STB_LOCAL {
+					continue
+				}
+				if elf.ST_TYPE(s.Info) == elf.STT_FILE {
+					if s.Section != elf.SHN_ABS {
+						t.Errorf("file symbol %s in section %d, want SHN_ABS", s.Name, s.Section)
+					}
+					if file == "" && s.Name != "go.go" {
+						t.Errorf("first file symbol is %s, want go.go", s.Name)
+					}
+					if seen[s.Name] {
+						t.Errorf("more than one file symbol %s", s.Name)
+					}
+					if i+1 < len(syms) && elf.ST_TYPE(syms[i+1].Info) == elf.STT_FILE {
+						t.Errorf("no local symbols follow file symbol %s", s.Name)
+					}
+					seen[s.Name] = true
+					file = s.Name
+					continue
+				}
+				if s.Name == "tab" {
+					found = true
+					if file != "filesyms/p" {
+						t.Errorf("%s follows file symbol %s, want filesyms/p", s.Name, file)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("no local symbol tab, the tab<> of filesyms/p")
+			}
+		})
+	}
+}
+
+func TestSplitDWARF(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+func main() { fmt.Println("hello") }
+`
+	dir := writeTestFiles(t, map[string]string{"main.go": prog})
+	src := filepath.Join(dir, "main.go")
+
+	for _, linkmode := range []string{"internal", "external"} {
+		linkmode := linkmode
+		t.Run(linkmode, func(t *testing.T) {
+			t.Parallel()
+			if linkmode == "external" {
+				testenv.MustHaveCGO(t)
+			}
+			bin := filepath.Join(dir, linkmode)
+			debugFile := bin + ".debug"
+			goBuild(t, "", nil, "-o", bin, "-ldflags=-linkmode="+linkmode+" -B 0x0123456789abcdef -splitdwarf="+debugFile, src)
+			if got, want := runTestProgram(t, bin), "hello"; got != want {
+				t.Fatalf("%s printed %q, want %q", bin, got, want)
+			}
+
+			ef := openELF(t, bin)
+			def := openELF(t, debugFile)
+			debugData, err := ioutil.ReadFile(debugFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range ef.Sections {
+				if strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+					t.Errorf("output has DWARF section %s", s.Name)
+				}
+			}
+			syms, err := ef.Symbols()
+			if err != nil {
+				t.Fatalf("output has no symbol table: %v", err)
+			}
+			var mainAddr uint64
+			for _, s := range syms {
+				if s.Name == "main.main" {
+					mainAddr = s.Value
+				}
+			}
+			if _, err := def.Symbols(); err != nil {
+				t.Errorf("%s has no symbol table: %v", debugFile, err)
+			}
+
+			// .gnu_debuglink holds the name of the companion file,
+			// padded to 4 bytes, and its CRC-32.
+			link := ef.Section(".gnu_debuglink")
+			if link == nil {
+				t.Fatalf("output has no .gnu_debuglink section")
+			}
+			b, err := link.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := filepath.Base(debugFile)
+			n := (len(name) + 1 + 3) &^ 3
+			if len(b) != n+4 || string(b[:len(name)]) != name || strings.Trim(string(b[len(name):n]), "\x00") != "" {
+				t.Fatalf(".gnu_debuglink is %q, want %q and a CRC", b, name)
+			}
+			if crc, want := ef.ByteOrder.Uint32(b[n:]), crc32.ChecksumIEEE(debugData); crc != want {
+				t.Errorf(".gnu_debuglink CRC is %#x, want %#x", crc, want)
+			}
+
+			// The companion has the sections of the output, at the same
+			// addresses, and the same build IDs.
+			for _, s := range ef.Sections {
+				if s.Flags&elf.SHF_ALLOC == 0 {
+					continue
+				}
+				ds := def.Section(s.Name)
+				if ds == nil || ds.Addr != s.Addr || ds.Size != s.Size {
+					t.Errorf("%s: section %s is %+v, want address %#x and size %#x", debugFile, s.Name, ds, s.Addr, s.Size)
+				}
+			}
+			note := func(f *elf.File, name string) []byte {
+				s := f.Section(name)
+				if s == nil {
+					t.Fatalf("no %s section", name)
+				}
+				b, err := s.Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			}
+			if b, want := note(def, ".note.gnu.build-id"), note(ef, ".note.gnu.build-id"); !bytes.Equal(b, want) {
+				t.Errorf("%s: ELF build ID note is %x, want %x", debugFile, b, want)
+			}
+			// The go command completes the Go build ID of the output,
+			// but not that of the companion: only the action ID, before
+			// the slash, is the same.
+			actionID := func(b []byte) string {
+				return strings.SplitN(string(b[16:]), "/", 2)[0]
+			}
+			if id, want := actionID(note(def, ".note.go.buildid")), actionID(note(ef, ".note.go.buildid")); id != want {
+				t.Errorf("%s: Go build ID action ID is %q, want %q", debugFile, id, want)
+			}
+
+			// The DWARF of the companion describes the program.
+			d, err := def.DWARF()
+			if err != nil {
+				t.Fatalf("%s: reading DWARF: %v", debugFile, err)
+			}
+			r := d.Reader()
+			var lowpc interface{}
+			for {
+				e, err := r.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e == nil {
+					break
+				}
+				if e.Tag == dwarf.TagSubprogram && e.Val(dwarf.AttrName) == "main.main" {
+					lowpc = e.Val(dwarf.AttrLowpc)
+					break
+				}
+			}
+			if lowpc != mainAddr {
+				t.Errorf("%s: DWARF address of main.main is %v, want %#x", debugFile, lowpc, mainAddr)
+			}
+
+			// gdb finds the companion next to the output.
+			if gdb, err := exec.LookPath("gdb"); err == nil {
+				out, err := exec.Command(gdb, "-nx", "-batch", "-ex", "info line main.main", bin).CombinedOutput()
+				if err != nil || !strings.Contains(string(out), "main.go") {
+					t.Errorf("gdb did not load %s: %v\n%s", debugFile, err, out)
+				}
+			}
+		})
+	}
+}
+
+func TestGNUBuildIDFromGoBuildID(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+
+	// buildNote builds prog with ldflags and returns the description of
+	// its GNU build ID note.
+	buildNote := func(t *testing.T, name, prog, ldflags string) []byte {
+		if err := ioutil.WriteFile(src, []byte(prog), 0666); err != nil {
+			t.Fatal(err)
+		}
+		bin := filepath.Join(dir, name)
+		goBuild(t, "", nil, "-o", bin, "-ldflags="+ldflags, src)
+		ef := openELF(t, bin)
+		var note []byte
+		for _, p := range ef.Progs {
+			if p.Type != elf.PT_NOTE {
+				continue
+			}
+			data, err := ioutil.ReadAll(p.Open())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for len(data) >= 12 {
+				namesz := int(ef.ByteOrder.Uint32(data))
+				descsz := int(ef.ByteOrder.Uint32(data[4:]))
+				typ := ef.ByteOrder.Uint32(data[8:])
+				name := data[12 : 12+namesz]
+				desc := data[12+(namesz+3)&^3:]
+				if typ == 3 && string(name) == "GNU\x00" {
+					note = desc[:descsz]
+				}
+				data = desc[(descsz+3)&^3:]
+			}
+		}
+		if note == nil {
+			t.Fatalf("%s: no GNU build ID note in a PT_NOTE segment", bin)
+		}
+		if len(note) != 20 {
+			t.Errorf("%s: got a %d-byte build ID, want 20 bytes", bin, len(note))
+		}
+		if out, err := exec.Command("readelf", "-n", bin).CombinedOutput(); err == nil {
+			if want := fmt.Sprintf("Build ID: %x", note); !strings.Contains(string(out), want) {
+				t.Errorf("readelf -n %s does not report %q:\n%s", bin, want, out)
+			}
+		}
+		return note
+	}
+
+	const prog = `package main
+
+import "fmt"
+
+func main() { fmt.Println("hello") }
+`
+	const prog2 = `package main
+
+import "fmt"
+
+func main() { fmt.Println("hello, world") }
+`
+	t.Run("reproducible", func(t *testing.T) {
+		a := buildNote(t, "a", prog, "-B gobuildid")
+		b := buildNote(t, "b", prog, "-B gobuildid")
+		if !bytes.Equal(a, b) {
+			t.Errorf("identical builds have different build IDs %x and %x", a, b)
+		}
+		c := buildNote(t, "c", prog2, "-B gobuildid")
+		if bytes.Equal(a, c) {
+			t.Errorf("different builds have the same build ID %x", a)
+		}
+	})
+
+	// With the Go build ID set, the note is its hash, whichever linker
+	// writes it.
+	for _, linkmode := range []string{"internal", "external"} {
+		t.Run(linkmode, func(t *testing.T) {
+			if linkmode == "external" {
+				testenv.MustHaveCGO(t)
+			}
+			note := buildNote(t, linkmode, prog, "-B gobuildid -buildid=abc/def -linkmode="+linkmode)
+			sum := sha256.Sum256([]byte("abc/def"))
+			if want := sum[:20]; !bytes.Equal(note, want) {
+				t.Errorf("got build ID %x, want %x", note, want)
+			}
+		})
+	}
+}
+
+func TestPackageNote(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	src := filepath.Join(dir, "main.go")
+	const metadata = `{"type":"rpm","name":"hello","version":"1.0-1.fc38","architecture":"x86_64","osCpe":"cpe:/o:fedoraproject:fedora:38"}`
+	file := filepath.Join(dir, "note.json")
+	if err := ioutil.WriteFile(file, []byte(metadata+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, linkmode := range []string{"internal", "external"} {
+		t.Run(linkmode, func(t *testing.T) {
+			if linkmode == "external" {
+				testenv.MustHaveCGO(t)
+			}
+			bin := filepath.Join(dir, linkmode)
+			goBuild(t, "", nil, "-o", bin, "-ldflags=-package-note=@"+file+" -linkmode="+linkmode, src)
+
+			ef := openELF(t, bin)
+			sect := ef.Section(".note.package")
+			if sect == nil {
+				t.Fatal("no .note.package section")
+			}
+			if sect.Type != elf.SHT_NOTE {
+				t.Errorf(".note.package has type %v, want SHT_NOTE", sect.Type)
+			}
+			data, err := sect.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) < 16 {
+				t.Fatalf(".note.package is too short: %q", data)
+			}
+			namesz := ef.ByteOrder.Uint32(data)
+			descsz := ef.ByteOrder.Uint32(data[4:])
+			typ := ef.ByteOrder.Uint32(data[8:])
+			if namesz != 4 || string(data[12:16]) != "FDO\x00" || typ != 0xcafe1a7e {
+				t.Fatalf("got note with name %q and type %#x, want \"FDO\" and 0xcafe1a7e", data[12:12+namesz], typ)
+			}
+			if len(data) != 16+(int(descsz)+3)&^3 {
+				t.Errorf("note has %d bytes, want %d for a descriptor of %d bytes padded to 4", len(data), 16+(descsz+3)&^3, descsz)
+			}
+			if want := metadata + "\x00"; string(data[16:16+descsz]) != want {
+				t.Errorf("got metadata %q, want %q", data[16:16+descsz], want)
+			}
+
+			inNote := false
+			for _, p := range ef.Progs {
+				if p.Type == elf.PT_NOTE && p.Off <= sect.Offset && sect.Offset+sect.Size <= p.Off+p.Filesz {
+					inNote = true
+				}
+			}
+			if !inNote {
+				t.Error(".note.package is not in a PT_NOTE segment")
+			}
+
+			out, err := exec.Command(testenv.GoToolPath(t), "version", "-m", bin).CombinedOutput()
+			if err != nil {
+				t.Fatalf("go version -m: %v\n%s", err, out)
+			}
+			if !strings.Contains(string(out), "path\tcommand-line-arguments") {
+				t.Errorf("go version -m does not report the build information:\n%s", out)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "invalid"), `-ldflags=-package-note={"type":`, src)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("%s: unexpected success", cmd)
+		}
+		if !strings.Contains(string(out), "-package-note: invalid JSON") {
+			t.Errorf("%s: unexpected error:\n%s", cmd, out)
+		}
+	})
+}
+
+const addSectionSrc = `package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// manifest returns the bounds of the manifest section.
+func manifest() (start, stop uintptr)
+
+func main() {
+	start, stop := manifest()
+	fmt.Printf("%s", unsafe.Slice((*byte)(unsafe.Pointer(start)), stop-start))
+}
+`
+
+const addSectionAMD64 = `#include "textflag.h"
+
+TEXT ·manifest(SB),NOSPLIT,$0-16
+	MOVQ	$__start_manifest(SB), AX
+	MOVQ	AX, start+0(FP)
+	MOVQ	$__stop_manifest(SB), AX
+	MOVQ	AX, stop+8(FP)
+	RET
+`
+
+const addSectionARM64 = `#include "textflag.h"
+
+TEXT ·manifest(SB),NOSPLIT,$0-16
+	MOVD	$__start_manifest(SB), R0
+	MOVD	R0, start+0(FP)
+	MOVD	$__stop_manifest(SB), R0
+	MOVD	R0, stop+8(FP)
+	RET
+`
+
+func TestAddSection(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod":           "module addsection\n",
+		"main.go":          addSectionSrc,
+		"manifest_amd64.s": addSectionAMD64,
+		"manifest_arm64.s": addSectionARM64,
+		"sbom.json":        `{"bomFormat":"CycloneDX"}`,
+		"manifest.txt":     "name: hello\nversion: 1.0\n",
+	}
+	dir := writeTestFiles(t, files)
+
+	modes := []string{"internal"}
+	if testenv.HasCGO() {
+		modes = append(modes, "external")
+	}
+	for _, mode := range modes {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			goBuild(t, dir, nil, "-ldflags=-linkmode="+mode+" -addsection=.sbom=sbom.json -addsection=manifest=manifest.txt,alloc", "-o", exe)
+
+			f := openELF(t, exe)
+			for _, s := range []struct {
+				name, file string
+				flags      elf.SectionFlag
+			}{
+				{".sbom", "sbom.json", 0},
+				{"manifest", "manifest.txt", elf.SHF_ALLOC},
+			} {
+				sect := f.Section(s.name)
+				if sect == nil {
+					t.Errorf("no %s section", s.name)
+					continue
+				}
+				if sect.Type != elf.SHT_PROGBITS || sect.Flags&(elf.SHF_ALLOC|elf.SHF_WRITE|elf.SHF_EXECINSTR) != s.flags {
+					t.Errorf("%s section is %v with flags %v, want SHT_PROGBITS with flags %v", s.name, sect.Type, sect.Flags, s.flags)
+				}
+				data, err := sect.Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := files[s.file]; string(data) != want {
+					t.Errorf("%s section holds %q, want %q", s.name, data, want)
+				}
+			}
+
+			out, err := exec.Command(exe).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", exe, err, out)
+			}
+			if want := files["manifest.txt"]; string(out) != want {
+				t.Errorf("program read %q through __start_manifest and __stop_manifest, want %q", out, want)
+			}
+		})
+	}
+
+	t.Run("buildid", func(t *testing.T) {
+		t.Parallel()
+		tmp := t.TempDir()
+		file := filepath.Join(tmp, "manifest.txt")
+		id := func(contents string) string {
+			if err := ioutil.WriteFile(file, []byte(contents), 0666); err != nil {
+				t.Fatal(err)
+			}
+			exe := filepath.Join(tmp, "main")
+			goBuild(t, dir, nil, "-ldflags=-addsection=manifest="+file+",alloc", "-o", exe)
+			out, err := exec.Command(testenv.GoToolPath(t), "tool", "buildid", exe).CombinedOutput()
+			if err != nil {
+				t.Fatalf("go tool buildid %s: %v\n%s", exe, err, out)
+			}
+			return strings.TrimSpace(string(out))
+		}
+		a := id("version: 1.0\n")
+		b := id("version: 1.0\n")
+		c := id("version: 1.1\n")
+		if a != b {
+			t.Errorf("same contents: build IDs %s and %s differ", a, b)
+		}
+		if a == c {
+			t.Errorf("different contents: same build ID %s", a)
+		}
+	})
+
+	t.Run("clash", func(t *testing.T) {
+		t.Parallel()
+		for _, flag := range []string{"-addsection=.rodata=sbom.json", "-addsection=manifest=sbom.json"} {
+			exe := filepath.Join(t.TempDir(), "main")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-linkmode=internal -addsection=manifest=manifest.txt,alloc "+flag, "-o", exe)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Errorf("%s: unexpected success", flag)
+				continue
+			}
+			if !bytes.Contains(out, []byte("-addsection: section")) {
+				t.Errorf("%s: build failed with\n%s\nwant a section clash", flag, out)
+			}
+		}
+	})
+}
+
+const ehFrameSrc = `package main
+
+/*
+#cgo LDFLAGS: -lgcc_s
+#include <stdint.h>
+
+struct dwarf_eh_bases {
+	void *tbase;
+	void *dbase;
+	void *func;
+};
+
+extern const void *_Unwind_Find_FDE(void *pc, struct dwarf_eh_bases *bases);
+
+// fdeFunc returns the start of the function of the FDE that libgcc
+// finds for pc, or 0.
+static uintptr_t fdeFunc(uintptr_t pc) {
+	struct dwarf_eh_bases bases;
+	if (_Unwind_Find_FDE((void *)pc, &bases) == 0) {
+		return 0;
+	}
+	return (uintptr_t)bases.func;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//go:noinline
+func f(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return f(n-1) + 1
+}
+
+func main() {
+	pc := reflect.ValueOf(f).Pointer()
+	fmt.Println(uintptr(C.fdeFunc(C.uintptr_t(pc+1))) == pc, f(3))
+}
+`
+
+func TestEHFrame(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{"main.go": ehFrameSrc})
+	src := filepath.Join(dir, "main.go")
+
+	for _, mode := range []string{"internal", "external"} {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-ehframe -linkmode="+mode, "-o", exe, src)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v: %v\n%s", cmd.Args, err, out)
+			}
+
+			// libgcc finds the FDE of a Go function at run time.
+			if got := runTestProgram(t, exe); got != "true 3" {
+				t.Errorf("got %q, want the FDE of main.f to be found", got)
+			}
+
+			f := openELF(t, exe)
+			var hdr *elf.Prog
+			for _, p := range f.Progs {
+				if p.Type == elf.PT_GNU_EH_FRAME {
+					hdr = p
+				}
+			}
+			if hdr == nil {
+				t.Fatal("no PT_GNU_EH_FRAME segment")
+			}
+			sect := f.Section(".eh_frame_hdr")
+			if sect == nil || sect.Addr != hdr.Vaddr || sect.Size != hdr.Memsz {
+				t.Fatalf("PT_GNU_EH_FRAME at %#x does not cover .eh_frame_hdr", hdr.Vaddr)
+			}
+			frame := f.Section(".eh_frame")
+			if frame == nil {
+				t.Fatal("no .eh_frame section")
+			}
+			h, err := sect.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd, err := frame.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(h) < 12 || h[0] != 1 || h[1] != 0x1b || h[2] != 0x03 || h[3] != 0x3b {
+				t.Fatalf(".eh_frame_hdr starts with % x, want version 1 and encodings 1b 03 3b", h[:4])
+			}
+			bo := f.ByteOrder
+			if ptr := sect.Addr + 4 + uint64(int32(bo.Uint32(h[4:]))); ptr != frame.Addr {
+				t.Errorf(".eh_frame_hdr points to %#x, want .eh_frame at %#x", ptr, frame.Addr)
+			}
+
+			// Every entry of the table is sorted, and names the
+			// FDE of its function.
+			n := int(bo.Uint32(h[8:]))
+			if len(h) < 12+8*n {
+				t.Fatalf(".eh_frame_hdr has %d bytes, too few for %d entries", len(h), n)
+			}
+			var prev uint64
+			pcs := make(map[uint64]bool)
+			for i := 0; i < n; i++ {
+				loc := sect.Addr + uint64(int32(bo.Uint32(h[12+8*i:])))
+				fde := sect.Addr + uint64(int32(bo.Uint32(h[16+8*i:])))
+				if loc < prev {
+					t.Fatalf("entry %d at %#x is not sorted", i, loc)
+				}
+				prev = loc
+				off := fde - frame.Addr
+				if off+12 > uint64(len(fd)) {
+					t.Fatalf("entry %d: FDE at %#x is outside .eh_frame", i, fde)
+				}
+				if begin := fde + 8 + uint64(int32(bo.Uint32(fd[off+8:]))); begin != loc {
+					t.Fatalf("entry %d: FDE at %#x is for %#x, want %#x", i, fde, begin, loc)
+				}
+				pcs[loc] = true
+			}
+			syms, err := f.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range syms {
+				if (s.Name == "main.main" || s.Name == "main.f" || s.Name == "runtime.mallocgc") && !pcs[s.Value] {
+					t.Errorf("no .eh_frame_hdr entry for %s at %#x", s.Name, s.Value)
+				}
+			}
+		})
+	}
+}
+
+const riscv64CgoC = `#include <stdio.h>
+#include <string.h>
+
+static long values[4] = {1, 2, 3, 4};
+long *table[] = {&values[1], &values[3]};
+int (*putsp)(const char *) = puts;
+
+static long sum(long *v, int n) {
+	long s = 0;
+	while (n-- > 0)
+		s += *v++;
+	return s;
+}
+
+long riscv64Check(const char *msg) {
+	char buf[32];
+
+	snprintf(buf, sizeof buf, "%s %ld", msg, sum(values, 4));
+	putsp(buf);
+	fflush(stdout);
+	return *table[0] + *table[1] + strlen(buf);
+}
+`
+
+const riscv64CgoGo = `package main
+
+/*
+long riscv64Check(const char *msg);
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.riscv64Check(C.CString("sum")))
+}
+`
+
+// TestInternalLinkCgoRISCV64 checks that cgo programs link internally on
+// linux/riscv64, with calls through the PLT, PC-relative and GOT
+// accesses and absolute pointers in data in the host objects.
+func TestInternalLinkCgoRISCV64(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "riscv64" {
+		t.Skip("test only works on linux/riscv64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module riscv64cgo\n",
+		"main.go": riscv64CgoGo,
+		"check.c": riscv64CgoC,
+	})
+
+	for _, buildmode := range []string{"exe", "pie"} {
+		for _, cflags := range []string{"-O2", "-O2 -fPIC"} {
+			buildmode, cflags := buildmode, cflags
+			t.Run(buildmode+" "+cflags, func(t *testing.T) {
+				t.Parallel()
+				exe := filepath.Join(t.TempDir(), "main")
+				goBuild(t, dir, []string{"CGO_CFLAGS=" + cflags}, "-buildmode="+buildmode, "-ldflags=-linkmode=internal", "-o", exe)
+				if got, want := runTestProgram(t, exe), "sum 10\n12"; got != want {
+					t.Errorf("%s printed %q, want %q", exe, got, want)
+				}
+			})
+		}
+	}
+}
+
+// riscvAttributes returns the contents of a .riscv.attributes section
+// with the file attributes Tag_RISCV_stack_align, if stackAlign is not
+// 0, and Tag_RISCV_arch.
+func riscvAttributes(arch string, stackAlign byte) []byte {
+	var list []byte
+	if stackAlign != 0 {
+		list = append(list, 4, stackAlign)
+	}
+	list = append(append(append(list, 5), arch...), 0)
+	var b bytes.Buffer
+	b.WriteByte('A')
+	binary.Write(&b, binary.LittleEndian, uint32(4+6+1+4+len(list)))
+	b.WriteString("riscv\x00")
+	b.WriteByte(1) // Tag_File
+	binary.Write(&b, binary.LittleEndian, uint32(1+4+len(list)))
+	b.Write(list)
+	return b.Bytes()
+}
+
+// readRISCVAttributes returns the Tag_RISCV_arch and
+// Tag_RISCV_stack_align file attributes of the .riscv.attributes
+// section of the file at path.
+func readRISCVAttributes(t *testing.T, path string) (arch string, stackAlign uint64) {
+	ef := openELF(t, path)
+	sect := ef.Section(".riscv.attributes")
+	if sect == nil {
+		t.Fatalf("%s has no .riscv.attributes section", path)
+	}
+	if sect.Type != 0x70000003 || sect.Flags&elf.SHF_ALLOC != 0 { // SHT_RISCV_ATTRIBUTES
+		t.Errorf("bad .riscv.attributes section: %+v", sect.SectionHeader)
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const hdr = "riscv\x00\x01"
+	if len(data) < 1+4+len(hdr)+4 || data[0] != 'A' || string(data[5:5+len(hdr)]) != hdr {
+		t.Fatalf("bad .riscv.attributes: % x", data)
+	}
+	list := data[5+len(hdr)+4:]
+	for len(list) > 0 {
+		tag, n := binary.Uvarint(list)
+		list = list[n:]
+		if tag&1 != 0 {
+			i := bytes.IndexByte(list, 0)
+			if i < 0 {
+				t.Fatalf("bad .riscv.attributes: % x", data)
+			}
+			if tag == 5 {
+				arch = string(list[:i])
+			}
+			list = list[i+1:]
+			continue
+		}
+		v, n := binary.Uvarint(list)
+		list = list[n:]
+		if tag == 4 {
+			stackAlign = v
+		}
+	}
+	return arch, stackAlign
+}
+
+// TestRISCVAttributes checks the .riscv.attributes section of riscv64
+// binaries: the ISA and stack alignment of the Go code, merged with
+// those of the host objects when linking internally, and left for the
+// host linker to merge in go.o when linking externally.
+func TestRISCVAttributes(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	const ret = 0x00008067
+	text := []byte{ret & 0xff, ret >> 8 & 0xff, ret >> 16 & 0xff, ret >> 24}
+	attrSect := &elf.Section64{Type: 0x70000003, Addralign: 1} // SHT_RISCV_ATTRIBUTES
+	const goArch = "rv64i2p0_m2p0_a2p0_f2p0_d2p0"
+
+	tests := []struct {
+		name  string
+		attrs []byte // of the host object, if any
+		arch  string
+		err   string
+	}{
+		{name: "go", arch: goArch},
+		{name: "noattrs", attrs: []byte{}, arch: goArch},
+		{name: "rv64gc", attrs: riscvAttributes("rv64gc", 16), arch: "rv64i2p0_m2p0_a2p0_f2p0_d2p0_c2p0"},
+		{
+			name:  "versions",
+			attrs: riscvAttributes("rv64i2p1_m2p0_a2p1_f2p2_d2p2_c2p0_zicsr2p0_zifencei2p0", 16),
+			arch:  "rv64i2p1_m2p0_a2p1_f2p2_d2p2_c2p0_zicsr2p0_zifencei2p0",
+		},
+		{name: "nostackalign", attrs: riscvAttributes("rv64imac", 0), arch: "rv64i2p0_m2p0_a2p0_f2p0_d2p0_c2p0"},
+		{name: "stackalign", attrs: riscvAttributes("rv64gc", 8), err: "stack alignment 8 is incompatible with 16"},
+		{name: "rv32", attrs: riscvAttributes("rv32gc", 16), err: "ISA rv32 is incompatible with rv64"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTestFiles(t, map[string]string{
+				"main.go": "package main\n\nfunc main() {}\n",
+				"go.mod":  "module riscvattr\n",
+			})
+			if test.attrs != nil {
+				sect := attrSect
+				if len(test.attrs) == 0 {
+					sect = nil
+				}
+				writeELFObject(t, filepath.Join(dir, "obj_linux_riscv64.syso"), elf.EM_RISCV, text, ".riscv.attributes", sect, test.attrs)
+			}
+			exe := filepath.Join(dir, "main")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=internal")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=riscv64", "CGO_ENABLED=0")
+			out, err := cmd.CombinedOutput()
+			if test.err != "" {
+				if err == nil || !bytes.Contains(out, []byte(test.err)) {
+					t.Fatalf("%s: got %v\n%s\nwant error %q", cmd, err, out, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", cmd, err, out)
+			}
+			arch, stackAlign := readRISCVAttributes(t, exe)
+			if arch != test.arch || stackAlign != 16 {
+				t.Errorf("got Tag_RISCV_arch %q and Tag_RISCV_stack_align %d, want %q and 16", arch, stackAlign, test.arch)
+			}
+
+			ef := openELF(t, exe)
+			sect := ef.Section(".riscv.attributes")
+			var seg *elf.Prog
+			for _, p := range ef.Progs {
+				if p.Type == 0x70000003 { // PT_RISCV_ATTRIBUTES
+					seg = p
+				}
+			}
+			if seg == nil || seg.Off != sect.Offset || seg.Filesz != sect.Size {
+				t.Errorf("PT_RISCV_ATTRIBUTES %v does not match .riscv.attributes %+v", seg, sect.SectionHeader)
+			}
+
+			if readelf, err := exec.LookPath("readelf"); err == nil {
+				out, err := exec.Command(readelf, "-A", exe).CombinedOutput()
+				if err != nil {
+					t.Fatalf("readelf -A: %v\n%s", err, out)
+				}
+				if want := fmt.Sprintf("Tag_RISCV_arch: %q", test.arch); !bytes.Contains(out, []byte(want)) {
+					t.Errorf("readelf -A output does not contain %s\n%s", want, out)
+				}
+			}
+		})
+	}
+
+	t.Run("goobj", func(t *testing.T) {
+		// The host linker merges the attributes of go.o with those of
+		// the C objects, using its own versions of the extensions.
+		falsePath, err := exec.LookPath("false")
+		if err != nil {
+			t.Skip("false not found")
+		}
+		t.Parallel()
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		tmpdir := t.TempDir()
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "main"),
+			"-ldflags=-linkmode=external -extld="+falsePath+" -tmpdir="+tmpdir, "main.go")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=riscv64", "CGO_ENABLED=0")
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("link with -extld=false succeeded\n%s", out)
+		}
+		arch, stackAlign := readRISCVAttributes(t, filepath.Join(tmpdir, "go.o"))
+		if want := "rv64imafd"; arch != want || stackAlign != 16 {
+			t.Errorf("got Tag_RISCV_arch %q and Tag_RISCV_stack_align %d, want %q and 16", arch, stackAlign, want)
+		}
+	})
+}
+
+// armAttributes returns the contents of an .ARM.attributes section with
+// the file attributes in attrs, pairs of tags and integer values that are
+// all less than 128.
+func armAttributes(attrs ...byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte('A')
+	binary.Write(&b, binary.LittleEndian, uint32(4+6+1+4+len(attrs)))
+	b.WriteString("aeabi\x00")
+	b.WriteByte(1) // Tag_File
+	binary.Write(&b, binary.LittleEndian, uint32(1+4+len(attrs)))
+	b.Write(attrs)
+	return b.Bytes()
+}
+
+// readARMAttributes returns the file attributes of the .ARM.attributes
+// section of the file at path, which must all have integer values.
+func readARMAttributes(t *testing.T, path string) map[uint64]uint64 {
+	ef := openELF(t, path)
+	sect := ef.Section(".ARM.attributes")
+	if sect == nil {
+		t.Fatalf("%s has no .ARM.attributes section", path)
+	}
+	if sect.Type != 0x70000003 || sect.Flags&elf.SHF_ALLOC != 0 { // SHT_ARM_ATTRIBUTES
+		t.Errorf("bad .ARM.attributes section: %+v", sect.SectionHeader)
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const hdr = "aeabi\x00\x01"
+	if len(data) < 1+4+len(hdr)+4 || data[0] != 'A' || string(data[5:5+len(hdr)]) != hdr {
+		t.Fatalf("bad .ARM.attributes: % x", data)
+	}
+	attrs := make(map[uint64]uint64)
+	list := data[5+len(hdr)+4:]
+	for len(list) > 0 {
+		tag, n := binary.Uvarint(list)
+		list = list[n:]
+		v, n := binary.Uvarint(list)
+		if n <= 0 {
+			t.Fatalf("bad .ARM.attributes: % x", data)
+		}
+		list = list[n:]
+		attrs[tag] = v
+	}
+	return attrs
+}
+
+// TestARMAttributes checks the .ARM.attributes section of arm binaries:
+// the architecture of the Go code for GOARM, merged with those of the
+// host objects when linking internally, and the check that the host
+// objects agree on the float ABI.
+func TestARMAttributes(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	const (
+		cpuArch        = 6
+		cpuArchProfile = 7
+		armISAUse      = 8
+		thumbISAUse    = 9
+		fpArch         = 10
+		abiVFPArgs     = 28
+	)
+	const ret = 0xe12fff1e // bx lr
+	text := []byte{ret & 0xff, ret >> 8 & 0xff, ret >> 16 & 0xff, ret >> 24}
+	attrSect := &elf.Section64{Type: 0x70000003, Addralign: 1} // SHT_ARM_ATTRIBUTES
+	// Objects compiled for armhf and armel, which leaves out
+	// Tag_ABI_VFP_args as it is the default.
+	hard := armAttributes(cpuArch, 10, cpuArchProfile, 'A', armISAUse, 1, thumbISAUse, 2, fpArch, 3, abiVFPArgs, 1)
+	soft := armAttributes(cpuArch, 4, armISAUse, 1, thumbISAUse, 1)
+
+	tests := []struct {
+		name    string
+		goarm   string
+		objs    map[string][]byte // host objects and their attributes
+		attrs   map[uint64]uint64
+		readelf string // in the output of readelf -A
+		err     string
+	}{
+		{
+			name:    "go5",
+			goarm:   "5",
+			attrs:   map[uint64]uint64{cpuArch: 3, armISAUse: 1, abiVFPArgs: 3},
+			readelf: "Tag_CPU_arch: v5T",
+		},
+		{
+			name:    "go7",
+			goarm:   "7",
+			attrs:   map[uint64]uint64{cpuArch: 10, cpuArchProfile: 'A', armISAUse: 1, fpArch: 4, abiVFPArgs: 3},
+			readelf: "Tag_FP_arch: VFPv3-D16",
+		},
+		{
+			name:    "hard",
+			goarm:   "7",
+			objs:    map[string][]byte{"hard_arm.syso": hard},
+			attrs:   map[uint64]uint64{cpuArch: 10, cpuArchProfile: 'A', armISAUse: 1, thumbISAUse: 2, fpArch: 3, abiVFPArgs: 1},
+			readelf: "Tag_ABI_VFP_args: VFP registers",
+		},
+		{
+			name:  "soft",
+			goarm: "5",
+			objs:  map[string][]byte{"soft_arm.syso": soft},
+			attrs: map[uint64]uint64{cpuArch: 4, armISAUse: 1, thumbISAUse: 1},
+		},
+		{
+			name:  "conflict",
+			goarm: "7",
+			objs:  map[string][]byte{"hard_arm.syso": hard, "soft_arm.syso": soft},
+			err:   "hard_arm.syso) uses VFP register arguments, ",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTestFiles(t, map[string]string{
+				"main.go": "package main\n\nfunc main() {}\n",
+				"go.mod":  "module armattr\n",
+			})
+			for name, attrs := range test.objs {
+				writeELFObject(t, filepath.Join(dir, name), elf.EM_ARM, text, ".ARM.attributes", attrSect, attrs)
+			}
+			exe := filepath.Join(dir, "main")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=internal")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm", "GOARM="+test.goarm, "CGO_ENABLED=0")
+			out, err := cmd.CombinedOutput()
+			if test.err != "" {
+				if err == nil || !bytes.Contains(out, []byte(test.err)) || !bytes.Contains(out, []byte("soft_arm.syso) does not")) {
+					t.Fatalf("%s: got %v\n%s\nwant error %q", cmd, err, out, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v\n%s", cmd, err, out)
+			}
+			if got := readARMAttributes(t, exe); !reflect.DeepEqual(got, test.attrs) {
+				t.Errorf("got attributes %v, want %v", got, test.attrs)
+			}
+			data, err := ioutil.ReadFile(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The ELF header flags tell the dynamic linker the float ABI.
+			flags, want := binary.LittleEndian.Uint32(data[36:]), uint32(0x5000202)
+			if test.attrs[abiVFPArgs] == 1 {
+				want = 0x5000402
+			} else if test.objs == nil {
+				want = 0x5000002
+			}
+			if flags != want {
+				t.Errorf("ELF header flags are %#x, want %#x", flags, want)
+			}
+
+			if test.readelf == "" {
+				return
+			}
+			if readelf, err := exec.LookPath("readelf"); err == nil {
+				out, err := exec.Command(readelf, "-A", exe).CombinedOutput()
+				if err != nil {
+					t.Fatalf("readelf -A: %v\n%s", err, out)
+				}
+				if !bytes.Contains(out, []byte(test.readelf)) {
+					t.Errorf("readelf -A output does not contain %s\n%s", test.readelf, out)
+				}
+			}
+		})
+	}
+
+	t.Run("goobj", func(t *testing.T) {
+		// The host linker merges the attributes of go.o with those of
+		// the C objects.
+		falsePath, err := exec.LookPath("false")
+		if err != nil {
+			t.Skip("false not found")
+		}
+		t.Parallel()
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		tmpdir := t.TempDir()
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "main"),
+			"-ldflags=-linkmode=external -extld="+falsePath+" -tmpdir="+tmpdir, "main.go")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm", "GOARM=6", "CGO_ENABLED=0")
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("link with -extld=false succeeded\n%s", out)
+		}
+		want := map[uint64]uint64{cpuArch: 6, armISAUse: 1, fpArch: 2, abiVFPArgs: 3}
+		if got := readARMAttributes(t, filepath.Join(tmpdir, "go.o")); !reflect.DeepEqual(got, want) {
+			t.Errorf("got attributes %v, want %v", got, want)
+		}
+	})
+}
+
+const mappingSrc = `package main
+
+func pool() uint64
+func next()
+
+func main() {
+	println(pool())
+	next()
+}
+`
+
+// In mappingAsm, pool loads a constant from the literal pool that the
+// assembler places after RET, and next follows it.
+var mappingAsm = map[string]string{
+	"arm": `#include "textflag.h"
+
+TEXT ·pool(SB),NOSPLIT,$0-8
+	MOVW	$0x12345678, R0
+	MOVW	R0, ret+0(FP)
+	MOVW	$0, R0
+	MOVW	R0, ret+4(FP)
+	RET
+
+TEXT ·next(SB),NOSPLIT,$0-0
+	RET
+`,
+	"arm64": `#include "textflag.h"
+
+TEXT ·pool(SB),NOSPLIT,$0-8
+	VMOVQ	$0x1234567812345678, $0x1234567812345678, V0
+	VMOV	V0.D[0], R0
+	MOVD	R0, ret+0(FP)
+	RET
+
+TEXT ·next(SB),NOSPLIT,$0-0
+	RET
+`,
+}
+
+// checkMappingSymbols checks the mapping symbols of the ELF file built
+// from mappingSrc and mappingAsm: they must alternate between code and
+// data, the literal pool of main.pool must be data, and the rest of it
+// and main.next code.
+func checkMappingSymbols(t *testing.T, file, code string) {
+	ef := openELF(t, file)
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fn, next *elf.Symbol
+	var maps []elf.Symbol
+	for i, s := range syms {
+		switch strings.TrimSuffix(s.Name, ".abi0") {
+		case "main.pool":
+			fn = &syms[i]
+		case "main.next":
+			next = &syms[i]
+		case "$a", "$d", "$t", "$x":
+			if elf.ST_BIND(s.Info) != elf.STB_LOCAL || elf.ST_TYPE(s.Info) != elf.STT_NOTYPE || s.Size != 0 {
+				t.Errorf("mapping symbol %s at %#x: got bind %v, type %v, size %d", s.Name, s.Value, elf.ST_BIND(s.Info), elf.ST_TYPE(s.Info), s.Size)
+			}
+			if ef.Sections[s.Section].Name != ".text" {
+				t.Errorf("mapping symbol %s at %#x is in section %s", s.Name, s.Value, ef.Sections[s.Section].Name)
+			}
+			maps = append(maps, s)
+		}
+	}
+	if fn == nil || next == nil {
+		t.Fatal("main.pool or main.next not found")
+	}
+	if len(maps) == 0 {
+		t.Fatal("no mapping symbols")
+	}
+	sort.SliceStable(maps, func(i, j int) bool { return maps[i].Value < maps[j].Value })
+	for i := 1; i < len(maps); i++ {
+		if maps[i].Name == maps[i-1].Name || maps[i].Value == maps[i-1].Value {
+			t.Errorf("mapping symbols %s at %#x and %s at %#x do not alternate", maps[i-1].Name, maps[i-1].Value, maps[i].Name, maps[i].Value)
+		}
+	}
+	// kind returns the mapping symbol in effect at addr.
+	kind := func(addr uint64) string {
+		k := ""
+		for _, s := range maps {
+			if s.Value > addr {
+				break
+			}
+			k = s.Name
+		}
+		return k
+	}
+
+	text := ef.Sections[fn.Section]
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := data[fn.Value-text.Addr : fn.Value-text.Addr+fn.Size]
+	i := bytes.Index(body, []byte{0x78, 0x56, 0x34, 0x12})
+	if i < 0 || i%4 != 0 {
+		t.Fatalf("main.pool has no literal pool\n% x", body)
+	}
+	for off := uint64(0); off < fn.Size; off += 4 {
+		want := code
+		if off >= uint64(i) {
+			want = "$d"
+		} else if binary.LittleEndian.Uint32(body[off:]) == 0 {
+			continue // the padding that aligns the pool is either
+		}
+		if got := kind(fn.Value + off); got != want {
+			t.Errorf("main.pool+%#x is in a %q region, want %q", off, got, want)
+		}
+	}
+	if got := kind(next.Value); got != code {
+		t.Errorf("main.next is in a %q region, want %q", got, code)
+	}
+}
+
+func TestMappingSymbols(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	for _, goarch := range []string{"arm", "arm64"} {
+		goarch := goarch
+		code := "$a"
+		if goarch == "arm64" {
+			code = "$x"
+		}
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(mappingSrc), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "pool_"+goarch+".s"), []byte(mappingAsm[goarch]), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module mapsyms\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		build := func(t *testing.T, exe string, ldflags string) ([]byte, error) {
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags="+ldflags)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+goarch, "GOARM=7", "CGO_ENABLED=0")
+			return cmd.CombinedOutput()
+		}
+
+		t.Run(goarch+"/internal", func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			if out, err := build(t, exe, "-linkmode=internal"); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			checkMappingSymbols(t, exe, code)
+		})
+
+		t.Run(goarch+"/goobj", func(t *testing.T) {
+			falsePath, err := exec.LookPath("false")
+			if err != nil {
+				t.Skip("false not found")
+			}
+			t.Parallel()
+			tmpdir := t.TempDir()
+			out, err := build(t, filepath.Join(t.TempDir(), "main"), "-linkmode=external -extld="+falsePath+" -tmpdir="+tmpdir)
+			if err == nil {
+				t.Fatalf("link with -extld=false succeeded\n%s", out)
+			}
+			checkMappingSymbols(t, filepath.Join(tmpdir, "go.o"), code)
+		})
+
+		t.Run(goarch+"/stripped", func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			if out, err := build(t, exe, "-linkmode=internal -s"); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			ef := openELF(t, exe)
+			if syms, err := ef.Symbols(); err != elf.ErrNoSymbols {
+				t.Errorf("got %d symbols and error %v, want %v", len(syms), err, elf.ErrNoSymbols)
+			}
+		})
+	}
+}
+
+func TestSplitTextSize(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	// Generate enough code for a few sections of its own.
+	var src strings.Builder
+	src.WriteString("package main\n\nimport \"fmt\"\n\nvar fns = []func(int) int{\n")
+	const nfuncs = 500
+	for i := 0; i < nfuncs; i++ {
+		fmt.Fprintf(&src, "\tf%d,\n", i)
+	}
+	src.WriteString("}\n\n")
+	for i := 0; i < nfuncs; i++ {
+		fmt.Fprintf(&src, "func f%d(x int) int {\n\tfor i := 0; i < %d; i++ {\n\t\tx = x*%d + i>>%d\n\t}\n\treturn x\n}\n\n", i, i%7+1, i+3, i%5)
+	}
+	src.WriteString("func main() {\n\tx := 0\n\tfor _, f := range fns {\n\t\tx = f(x)\n\t}\n\tfmt.Println(\"sum\", x)\n}\n")
+	dir := writeTestFiles(t, map[string]string{
+		"main.go": src.String(),
+		"go.mod":  "module splittext\n",
+	})
+
+	const size = 0x10000
+	for _, goarch := range []string{"arm64", "ppc64le"} {
+		goarch := goarch
+		t.Run(goarch, func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, fmt.Sprintf("-ldflags=-linkmode=internal -splittextsize=%#x", size))
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+goarch, "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			checkSplitText(t, exe, size)
+
+			if runtime.GOOS == "linux" && runtime.GOARCH == goarch {
+				out, err := exec.Command(exe).CombinedOutput()
+				if err != nil || !strings.HasPrefix(string(out), "sum ") {
+					t.Errorf("%v\n%s", err, out)
+				}
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		for _, test := range []struct {
+			goarch, flag, want string
+		}{
+			{"amd64", "-splittextsize=0x10000", "only supported on ppc64, ppc64le and arm64"},
+			{"arm64", "-splittextsize=0x8000000", "must be between 0 and 0x7c00000"},
+			{"ppc64le", "-splittextsize=-2", "must be between 0 and 0x1c00000"},
+			{"ppc64le", "-linkmode=external -splittextsize=0", "cannot be used on ppc64le when linking externally"},
+			{"arm64", "-splittextsize=0x100", "text size limit 256 less than text symbol"},
+		} {
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(t.TempDir(), "main"), "-ldflags="+test.flag)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+test.goarch, "CGO_ENABLED=0")
+			out, err := cmd.CombinedOutput()
+			if err == nil || !strings.Contains(string(out), test.want) {
+				t.Errorf("%s %s: got %v, want error %q\n%s", test.goarch, test.flag, err, test.want, out)
+			}
+		}
+	})
+}
+
+// checkSplitText checks that the text of the executable file is split
+// into sections of at most size bytes, each starting with its
+// runtime.text.N symbol, and, on arm64, a mapping symbol, and that
+// runtime.textsectionmap describes them.
+func checkSplitText(t *testing.T, file string, size uint64) {
+	ef := openELF(t, file)
+
+	var texts []int // section indices
+	for i, sect := range ef.Sections {
+		if sect.Name == ".text" {
+			texts = append(texts, i)
+			if sect.Size > size {
+				t.Errorf("text section at %#x has size %#x, more than %#x", sect.Addr, sect.Size, size)
+			}
+		}
+	}
+	if len(texts) < 3 {
+		t.Fatalf("got %d text sections, want at least 3", len(texts))
+	}
+
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sectmap elf.Symbol
+	for _, s := range syms {
+		if s.Name == "runtime.textsectionmap" {
+			sectmap = s
+		}
+	}
+	text0 := ef.Sections[texts[0]].Addr
+	for n, i := range texts {
+		sect := ef.Sections[i]
+		name := "runtime.text"
+		if n > 0 {
+			name = fmt.Sprintf("runtime.text.%d", n)
+		}
+		var found, mapped bool
+		for _, s := range syms {
+			if s.Value != sect.Addr || int(s.Section) != i {
+				continue
+			}
+			found = found || s.Name == name
+			mapped = mapped || s.Name == "$x"
+		}
+		if !found {
+			t.Errorf("no %s at the start %#x of text section %d", name, sect.Addr, n)
+		}
+		if ef.Machine == elf.EM_AARCH64 && !mapped {
+			t.Errorf("no $x mapping symbol at the start %#x of text section %d", sect.Addr, n)
+		}
+	}
+
+	// Each entry of runtime.textsectionmap is the offset of the start
+	// and end of a section from the first one, and its address.
+	if sectmap.Size != uint64(3*8*len(texts)) {
+		t.Fatalf("runtime.textsectionmap has size %d, want %d", sectmap.Size, 3*8*len(texts))
+	}
+	data, err := ef.Sections[sectmap.Section].Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = data[sectmap.Value-ef.Sections[sectmap.Section].Addr:][:sectmap.Size]
+	for n, i := range texts {
+		sect := ef.Sections[i]
+		got := [3]uint64{
+			ef.ByteOrder.Uint64(data[24*n:]),
+			ef.ByteOrder.Uint64(data[24*n+8:]),
+			ef.ByteOrder.Uint64(data[24*n+16:]),
+		}
+		want := [3]uint64{sect.Addr - text0, sect.Addr - text0 + sect.Size, sect.Addr}
+		if got != want {
+			t.Errorf("runtime.textsectionmap entry %d is %#x, want %#x", n, got, want)
+		}
+	}
+}
+
+const hostInitArrayC = `int initOrder;
+
+static void record(int n) { initOrder = initOrder*10 + n; }
+
+__attribute__((constructor)) static void initDefault(void) { record(3); }
+__attribute__((constructor(200))) static void init200(void) { record(2); }
+__attribute__((constructor(101))) static void init101(void) { record(1); }
+
+int getInitOrder(void) { return initOrder; }
+`
+
+const hostInitArrayGo = `package main
+
+// int getInitOrder(void);
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.getInitOrder())
+}
+`
+
+const hostInitArraySysoGo = `package main
+
+func getInitOrder() int32
+
+func main() {
+	println(getInitOrder())
+}
+`
+
+const hostInitArraySysoAsm = `#include "textflag.h"
+
+TEXT ·getInitOrder(SB),NOSPLIT,$0-4
+	MOVL initOrder(SB), AX
+	MOVL AX, ret+0(FP)
+	RET
+`
+
+// TestHostInitArray checks that the constructors of host objects run,
+// in the order of their priorities, before main when linking internally,
+// as they do when linking externally.
+func TestHostInitArray(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	const want = "123"
+
+	run := func(t *testing.T, dir string, args ...string) {
+		exe := filepath.Join(t.TempDir(), "main")
+		cmd := exec.Command(testenv.GoToolPath(t), append(append([]string{"build"}, args...), "-o", exe)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		if got := runTestProgram(t, exe); got != want {
+			t.Errorf("%s printed %q, want %q", args, got, want)
+		}
+	}
+
+	t.Run("cgo", func(t *testing.T) {
+		t.Parallel()
+		dir := writeTestFiles(t, map[string]string{
+			"go.mod":  "module hostinitarray\n",
+			"main.go": hostInitArrayGo,
+			"init.c":  hostInitArrayC,
+		})
+		for _, ldflags := range []string{"-linkmode=internal", "-linkmode=external"} {
+			run(t, dir, "-ldflags="+ldflags)
+		}
+	})
+
+	// Without cgo, there is no C runtime at all.
+	t.Run("syso", func(t *testing.T) {
+		t.Parallel()
+		dir := writeTestFiles(t, map[string]string{
+			"go.mod":      "module hostinitarray\n",
+			"main.go":     hostInitArraySysoGo,
+			"get_amd64.s": hostInitArraySysoAsm,
+		})
+		cc, cflags := getCCAndCCFLAGS(t, os.Environ())
+		csrc := filepath.Join(t.TempDir(), "init.c")
+		if err := ioutil.WriteFile(csrc, []byte(hostInitArrayC), 0666); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(cc, append(cflags, "-c", "-o", filepath.Join(dir, "init_amd64.syso"), csrc)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		for _, buildmode := range []string{"exe", "pie"} {
+			run(t, dir, "-buildmode="+buildmode, "-ldflags=-linkmode=internal")
+		}
+	})
+}
+
+const symSizesGo = `package main
+
+// #include "sizes.h"
+import "C"
+
+var table = map[string]int{"a": 1, "b": 2}
+
+//export GoTwice
+func GoTwice(x C.int) C.int { return 2 * x }
+
+func main() {
+	println(table["a"], C.hostCounter, C.hostTwice(3))
+}
+`
+
+const symSizesH = `extern int hostCounter;
+int hostTwice(int);
+`
+
+const symSizesC = `#include "sizes.h"
+
+int hostCounter = 1;
+int hostTable[64];
+
+int hostTwice(int x) {
+	hostTable[x & 63]++;
+	return GoTwice(x);
+}
+`
+
+func TestSymbolSizes(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module symsizes\n",
+		"main.go": symSizesGo,
+		"sizes.h": symSizesH,
+		"sizes.c": symSizesC,
+	})
+	exe := filepath.Join(dir, "main")
+	goBuild(t, dir, nil, "-ldflags=-linkmode=internal -exportdynamic", "-o", exe)
+	ef := openELF(t, exe)
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bysect := make(map[elf.SectionIndex][]elf.Symbol)
+	byname := make(map[string]elf.Symbol)
+	for _, s := range syms {
+		switch elf.ST_TYPE(s.Info) {
+		case elf.STT_FILE, elf.STT_SECTION:
+			continue
+		}
+		if s.Section == elf.SHN_UNDEF || s.Section >= elf.SHN_LORESERVE {
+			continue
+		}
+		bysect[s.Section] = append(bysect[s.Section], s)
+		byname[s.Name] = s
+	}
+
+	// The markers label addresses.
+	for _, name := range []string{"runtime.text", "runtime.etext", "runtime.erodata", "runtime.edata", "runtime.end"} {
+		s, ok := byname[name]
+		if !ok {
+			t.Errorf("no symbol %s", name)
+			continue
+		}
+		if typ := elf.ST_TYPE(s.Info); typ != elf.STT_NOTYPE || s.Size != 0 {
+			t.Errorf("%s has type %v and size %d, want STT_NOTYPE and 0", name, typ, s.Size)
+		}
+	}
+
+	// The carriers span the data they group.
+	if s, e := byname["runtime.pclntab"], byname["runtime.epclntab"]; s.Size == 0 || s.Value+s.Size != e.Value {
+		t.Errorf("runtime.pclntab is [%#x, %#x), want [%#x, %#x)", s.Value, s.Value+s.Size, s.Value, e.Value)
+	}
+	for _, name := range []string{"type.*", "go.string.*", "go.func.*"} {
+		if s := byname[name]; s.Size == 0 {
+			t.Errorf("carrier %s has size 0", name)
+		}
+	}
+
+	// The TLS symbols hold their offset in the TLS block.
+	if s := byname["runtime.tlsg"]; elf.ST_TYPE(s.Info) != elf.STT_TLS || ef.Sections[s.Section].Name != ".tbss" {
+		t.Errorf("runtime.tlsg has type %v in section %s, want STT_TLS in .tbss", elf.ST_TYPE(s.Info), ef.Sections[s.Section].Name)
+	}
+
+	// No symbol runs into the next one or out of its section, and
+	// the symbols cover most of the bytes of the output.
+	var total, covered uint64
+	for i, sect := range ef.Sections {
+		if sect.Flags&elf.SHF_ALLOC == 0 || sect.Flags&elf.SHF_TLS != 0 {
+			continue
+		}
+		ss := bysect[elf.SectionIndex(i)]
+		sort.Slice(ss, func(i, j int) bool {
+			if ss[i].Value != ss[j].Value {
+				return ss[i].Value < ss[j].Value
+			}
+			return ss[i].Size > ss[j].Size
+		})
+		end := sect.Addr
+		for j, s := range ss {
+			if s.Size == 0 {
+				continue
+			}
+			if s.Value+s.Size > sect.Addr+sect.Size {
+				t.Errorf("%s [%#x, %#x) ends past %s", s.Name, s.Value, s.Value+s.Size, sect.Name)
+			}
+			// The section symbols of host objects contain the
+			// symbols defined in them.
+			if next := ss[j+1:]; len(next) > 0 && next[0].Value < s.Value+s.Size && next[0].Value+next[0].Size > s.Value+s.Size {
+				t.Errorf("%s [%#x, %#x) overlaps %s at %#x", s.Name, s.Value, s.Value+s.Size, next[0].Name, next[0].Value)
+			}
+			if lo, hi := s.Value, s.Value+s.Size; hi > end {
+				if lo < end {
+					lo = end
+				}
+				covered += hi - lo
+				end = hi
+			}
+		}
+		total += sect.Size
+	}
+	if covered*100 <= total*95 {
+		t.Errorf("symbols cover %d of %d allocated bytes, want more than 95%%", covered, total)
+	}
+
+	// The dynamic symbols match those of the symbol table.
+	dynsyms, err := ef.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, d := range dynsyms {
+		if d.Section == elf.SHN_UNDEF {
+			continue
+		}
+		found[d.Name] = true
+		s := byname[d.Name]
+		if d.Value != s.Value || d.Size != s.Size || d.Section != s.Section || elf.ST_TYPE(d.Info) != elf.ST_TYPE(s.Info) {
+			t.Errorf("dynamic symbol %s is %#x+%d %v in section %d, want %#x+%d %v in section %d",
+				d.Name, d.Value, d.Size, elf.ST_TYPE(d.Info), d.Section, s.Value, s.Size, elf.ST_TYPE(s.Info), s.Section)
+		}
+	}
+	for _, name := range []string{"GoTwice", "hostCounter", "hostTable", "hostTwice"} {
+		if !found[name] {
+			t.Errorf("no dynamic symbol %s", name)
+		}
+	}
+}
@@ -31,12 +31,14 @@
 package amd64
 
 import (
+	"bytes"
 	"cmd/internal/objabi"
 	"cmd/internal/sys"
 	"cmd/link/internal/ld"
 	"cmd/link/internal/loader"
 	"cmd/link/internal/sym"
 	"debug/elf"
+	"encoding/binary"
 	"log"
 )
 
@@ -45,6 +47,8 @@ func PADDR(x uint32) uint32 {
 }
 
 func gentext(ctxt *ld.Link, ldr *loader.Loader) {
+	genselfreloc(ctxt, ldr)
+
 	initfunc, addmoduledata := ld.PrepareAddmoduledata(ctxt)
 	if initfunc == nil {
 		return
@@ -69,6 +73,101 @@ func gentext(ctxt *ld.Link, ldr *loader.Loader) {
 	o(0xc3)
 }
 
+// genselfreloc generates the entry point of a -static-pie executable,
+// which applies the R_X86_64_RELATIVE relocations of the executable
+// before jumping to the runtime's entry point. It uses no stack, so
+// that the runtime finds the one the kernel set up.
+func genselfreloc(ctxt *ld.Link, ldr *loader.Loader) {
+	sr, zero, entry := ld.PrepareSelfReloc(ctxt)
+	if sr == nil {
+		return
+	}
+
+	o := func(op ...uint8) {
+		for _, op1 := range op {
+			sr.AddUint8(op1)
+		}
+	}
+
+	// 0000000000000000 <go.link.selfreloc>:
+	//    0:	48 8d 05 00 00 00 00 	lea    0x0(%rip),%rax        # load bias
+	// 			3: R_X86_64_PC32	go.link.zero-0x4
+	o(0x48, 0x8d, 0x05)
+	sr.AddPCRelPlus(ctxt.Arch, zero, 0)
+	//    7:	48 8d 0d 00 00 00 00 	lea    0x0(%rip),%rcx
+	// 			a: R_X86_64_PC32	.dynamic-0x4
+	o(0x48, 0x8d, 0x0d)
+	sr.AddPCRelPlus(ctxt.Arch, ctxt.Dynamic, 0)
+	//    e:	31 f6                	xor    %esi,%esi             # DT_RELA
+	//   10:	31 ff                	xor    %edi,%edi             # DT_RELASZ
+	o(0x31, 0xf6)
+	o(0x31, 0xff)
+	//   12:	48 8b 11             	mov    (%rcx),%rdx
+	//   15:	48 85 d2             	test   %rdx,%rdx
+	//   18:	74 1a                	je     34
+	//   1a:	48 83 fa 07          	cmp    $0x7,%rdx
+	//   1e:	75 04                	jne    24
+	//   20:	48 8b 71 08          	mov    0x8(%rcx),%rsi
+	//   24:	48 83 fa 08          	cmp    $0x8,%rdx
+	//   28:	75 04                	jne    2e
+	//   2a:	48 8b 79 08          	mov    0x8(%rcx),%rdi
+	//   2e:	48 83 c1 10          	add    $0x10,%rcx
+	//   32:	eb de                	jmp    12
+	o(0x48, 0x8b, 0x11)
+	o(0x48, 0x85, 0xd2)
+	o(0x74, 0x1a)
+	o(0x48, 0x83, 0xfa, byte(elf.DT_RELA))
+	o(0x75, 0x04)
+	o(0x48, 0x8b, 0x71, 0x08)
+	o(0x48, 0x83, 0xfa, byte(elf.DT_RELASZ))
+	o(0x75, 0x04)
+	o(0x48, 0x8b, 0x79, 0x08)
+	o(0x48, 0x83, 0xc1, 0x10)
+	o(0xeb, 0xde)
+	//   34:	48 01 c6             	add    %rax,%rsi
+	//   37:	48 01 f7             	add    %rsi,%rdi
+	//   3a:	48 39 fe             	cmp    %rdi,%rsi
+	//   3d:	73 1c                	jae    5b
+	//   3f:	83 7e 08 08          	cmpl   $0x8,0x8(%rsi)        # R_X86_64_RELATIVE
+	//   43:	75 10                	jne    55
+	//   45:	48 8b 16             	mov    (%rsi),%rdx
+	//   48:	48 01 c2             	add    %rax,%rdx
+	//   4b:	48 8b 4e 10          	mov    0x10(%rsi),%rcx
+	//   4f:	48 01 c1             	add    %rax,%rcx
+	//   52:	48 89 0a             	mov    %rcx,(%rdx)
+	//   55:	48 83 c6 18          	add    $0x18,%rsi
+	//   59:	eb df                	jmp    3a
+	o(0x48, 0x01, 0xc6)
+	o(0x48, 0x01, 0xf7)
+	o(0x48, 0x39, 0xfe)
+	o(0x73, 0x1c)
+	o(0x83, 0x7e, 0x08, byte(elf.R_X86_64_RELATIVE))
+	o(0x75, 0x10)
+	o(0x48, 0x8b, 0x16)
+	o(0x48, 0x01, 0xc2)
+	o(0x48, 0x8b, 0x4e, 0x10)
+	o(0x48, 0x01, 0xc1)
+	o(0x48, 0x89, 0x0a)
+	o(0x48, 0x83, 0xc6, 0x18)
+	o(0xeb, 0xdf)
+	if *ld.FlagDebugEarlyGOT != "" {
+		// A GOT reference for ld's startup check to find: an add,
+		// unlike a mov, is not relaxed to use the symbol directly.
+		//   5b:	48 03 15 00 00 00 00 	add    0x0(%rip),%rdx
+		// 			5e: R_X86_64_GOTPCREL	symbol-0x4
+		s := ldr.Lookup(*ld.FlagDebugEarlyGOT, 0)
+		if s == 0 {
+			ld.Exitf("-debugearlygot: symbol %s not defined", *ld.FlagDebugEarlyGOT)
+		}
+		o(0x48, 0x03, 0x15)
+		sr.AddSymRef(ctxt.Arch, s, -4, objabi.ElfRelocOffset+objabi.RelocType(elf.R_X86_64_GOTPCREL), 4)
+	}
+	//   5b:	e9 00 00 00 00       	jmpq   60
+	// 			5c: R_X86_64_PLT32	_rt0_amd64_linux-0x4
+	o(0xe9)
+	sr.AddSymRef(ctxt.Arch, entry, 0, objabi.R_CALL, 4)
+}
+
 func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym, r loader.Reloc, rIdx int) bool {
 	targ := r.Sym()
 	var targType sym.SymKind
@@ -76,6 +175,30 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 		targType = ldr.SymType(targ)
 	}
 
+	if targ != 0 && ldr.AttrIFunc(targ) && r.Type() >= objabi.ElfRelocOffset {
+		// An indirect function of a host object is called, and
+		// its address taken, through its PLT entry or its GOT
+		// entry, set by the dynamic linker to the address its
+		// resolver returns.
+		addipltsym(target, ldr, syms, targ)
+		su := ldr.MakeSymbolUpdater(s)
+		switch r.Type() {
+		case objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_GOTPCREL),
+			objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_GOTPCRELX),
+			objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_REX_GOTPCRELX):
+			su.SetRelocType(rIdx, objabi.R_PCREL)
+			su.SetRelocSym(rIdx, syms.GOT)
+			su.SetRelocAdd(rIdx, r.Add()+4+int64(ldr.SymGot(targ)))
+			return true
+		}
+		su.SetRelocSym(rIdx, syms.PLT)
+		su.SetRelocAdd(rIdx, r.Add()+int64(ldr.SymPlt(targ)))
+		relocs := ldr.Relocs(s)
+		r = relocs.At(rIdx)
+		targ = syms.PLT
+		targType = ldr.SymType(targ)
+	}
+
 	switch rt := r.Type(); rt {
 	default:
 		if rt >= objabi.ElfRelocOffset {
@@ -138,6 +261,29 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 				su.SetRelocAdd(rIdx, r.Add()+4)
 				return true
 			}
+			// The compiler marks the CALL and JMP through a GOT
+			// entry that may be relaxed with R_X86_64_GOTPCRELX.
+			if rt == objabi.ElfRelocOffset+objabi.RelocType(elf.R_X86_64_GOTPCRELX) && r.Off() >= 2 && sData[r.Off()-2] == 0xff {
+				var op0, op1 byte
+				switch sData[r.Off()-1] {
+				case 0x15:
+					// turn CALL *foo@GOTPCREL(%rip) into ADDR32 CALL foo
+					op0, op1 = 0x67, 0xe8
+				case 0x25:
+					// turn JMP *foo@GOTPCREL(%rip) into NOP; JMP foo,
+					// which keeps the displacement at the same offset
+					op0, op1 = 0x90, 0xe9
+				}
+				if op0 != 0 {
+					su.MakeWritable()
+					writeableData := su.Data()
+					writeableData[r.Off()-2] = op0
+					writeableData[r.Off()-1] = op1
+					su.SetRelocType(rIdx, objabi.R_PCREL)
+					su.SetRelocAdd(rIdx, r.Add()+4)
+					return true
+				}
+			}
 		}
 
 		// fall back to using GOT and hope for the best (CMOV*)
@@ -153,6 +299,20 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 		if targType == sym.SDYNIMPORT {
 			ldr.Errorf(s, "unexpected R_X86_64_64 relocation for dynamic symbol %s", ldr.SymName(targ))
 		}
+		if target.IsPIE() && target.IsInternal() && ldr.SymType(s) == sym.STEXT {
+			// An absolute address in code compiled without -fPIC.
+			// The dynamic linker can only fix it up by writing to
+			// the text segment.
+			if ld.PIEAbsReloc(target, ldr, s, r, true) {
+				rela := ldr.MakeSymbolUpdater(syms.Rela)
+				rela.AddAddrPlus(target.Arch, s, int64(r.Off()))
+				rela.AddUint64(target.Arch, elf.R_INFO(0, uint32(elf.R_X86_64_RELATIVE)))
+				rela.AddAddrPlus(target.Arch, targ, int64(r.Add()))
+			}
+			su := ldr.MakeSymbolUpdater(s)
+			su.SetRelocType(rIdx, objabi.R_ADDR)
+			return true
+		}
 		su := ldr.MakeSymbolUpdater(s)
 		su.SetRelocType(rIdx, objabi.R_ADDR)
 		if target.IsPIE() && target.IsInternal() {
@@ -163,6 +323,38 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 		}
 		return true
 
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_32),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_32S):
+		// A 32-bit absolute address, from code compiled without -fPIC.
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected %s relocation for dynamic symbol %s", sym.RelocName(target.Arch, rt), ldr.SymName(targ))
+		}
+		if target.IsPIE() && target.IsInternal() {
+			// A PIE may be loaded above 4GB, so there is no
+			// dynamic relocation for it.
+			ld.PIEAbsReloc(target, ldr, s, r, false)
+			return true
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_ADDR)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_TPOFF32),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_DTPOFF32),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_GOTTPOFF),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_TLSGD),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_X86_64_TLSLD):
+		// An access to a thread-local variable of a host object.
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected %s relocation for dynamic symbol %s", sym.RelocName(target.Arch, rt), ldr.SymName(targ))
+			return false
+		}
+		if targType != sym.STLSDATA && targType != sym.STLSBSS {
+			ldr.Errorf(s, "%s relocation for non-TLS symbol %s", sym.RelocName(target.Arch, rt), ldr.SymName(targ))
+			return false
+		}
+		return tlsToLE(target, ldr, s, r, rIdx)
+
 	// Handle relocations found in Mach-O object files.
 	case objabi.MachoRelocOffset + ld.MACHO_X86_64_RELOC_UNSIGNED*2 + 0,
 		objabi.MachoRelocOffset + ld.MACHO_X86_64_RELOC_SIGNED*2 + 0,
@@ -284,6 +476,22 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 			return true
 		}
 
+		if targType == sym.SDYNIMPORT && ldr.AttrDynAddr(s) {
+			// The data is the address of an external symbol, such
+			// as __asan_init in the .preinit_array the linker
+			// creates for -asan programs (see ld.asanPreinit).
+			// Let the dynamic linker fill it in, also for PIE.
+			ld.Adddynsym(ldr, target, syms, targ)
+			rela := ldr.MakeSymbolUpdater(syms.Rela)
+			rela.AddAddrPlus(target.Arch, s, int64(r.Off()))
+			rela.AddUint64(target.Arch, elf.R_INFO(uint32(ldr.SymDynid(targ)), uint32(elf.R_X86_64_64)))
+			rela.AddUint64(target.Arch, uint64(r.Add()))
+			su := ldr.MakeSymbolUpdater(s)
+			su.SetRelocType(rIdx, objabi.R_CONST) // write r->add during relocsym
+			su.SetRelocSym(rIdx, 0)
+			return true
+		}
+
 		// Process dynamic relocations for the data sections.
 		if target.IsPIE() && target.IsInternal() {
 			// When internally linking, generate dynamic relocations
@@ -334,6 +542,13 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 		}
 
 		if target.IsElf() {
+			// With -pack-relative-relocs, the relocation goes in
+			// the packed .relr.dyn table instead. As below, the
+			// word still gets the link-time address statically.
+			if ld.ElfAddRelr(target, ldr, s, r) {
+				return true
+			}
+
 			// Generate R_X86_64_RELATIVE relocations for best
 			// efficiency in the dynamic linker.
 			//
@@ -412,7 +627,7 @@ func elfreloc1(ctxt *ld.Link, out *ld.OutBuf, ldr *loader.Loader, s loader.Sym,
 		}
 	case objabi.R_CALL:
 		if siz == 4 {
-			if ldr.SymType(r.Xsym) == sym.SDYNIMPORT {
+			if t := ldr.SymType(r.Xsym); t == sym.SDYNIMPORT || (*ld.FlagInterpose && t == sym.SUNDEFEXT) {
 				out.Write64(uint64(elf.R_X86_64_PLT32) | uint64(elfsym)<<32)
 			} else {
 				out.Write64(uint64(elf.R_X86_64_PC32) | uint64(elfsym)<<32)
@@ -578,6 +793,35 @@ func elfsetupplt(ctxt *ld.Link, plt, got *loader.SymbolBuilder, dynamic loader.S
 	}
 }
 
+// addipltsym adds a PLT entry and a GOT entry for the indirect
+// function s of a host object. The GOT entry is set by an IRELATIVE
+// relocation, which the dynamic linker applies by calling the resolver
+// s, before the program runs: a resolver must not depend on other
+// relocations being applied, or on the C library being initialized.
+func addipltsym(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym) {
+	if ldr.SymPlt(s) >= 0 {
+		return
+	}
+
+	got := ldr.MakeSymbolUpdater(syms.GOT)
+	ldr.SetGot(s, int32(got.Size()))
+	got.AddUint64(target.Arch, 0)
+
+	rela := ldr.MakeSymbolUpdater(syms.Rela)
+	rela.AddAddrPlus(target.Arch, got.Sym(), int64(ldr.SymGot(s)))
+	rela.AddUint64(target.Arch, elf.R_INFO(0, uint32(elf.R_X86_64_IRELATIVE)))
+	rela.AddAddrPlus(target.Arch, s, 0)
+
+	// jmpq *got+off(IP); xchg %ax, %ax
+	plt := ldr.MakeSymbolUpdater(syms.PLT)
+	ldr.SetPlt(s, int32(plt.Size()))
+	plt.AddUint8(0xff)
+	plt.AddUint8(0x25)
+	plt.AddPCRelPlus(target.Arch, got.Sym(), int64(ldr.SymGot(s)))
+	plt.AddUint8(0x66)
+	plt.AddUint8(0x90)
+}
+
 func addpltsym(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym) {
 	if ldr.SymPlt(s) >= 0 {
 		return
@@ -639,6 +883,142 @@ func addpltsym(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 	}
 }
 
+// tlsToLE relaxes the access to a thread-local variable of a host
+// object at relocation rIdx of s to the local exec model, as the host
+// linkers do. We are linking an executable, so the offset of the
+// variable from the thread pointer is known: it is resolved by an
+// R_TLS_LE relocation against the merged TLS block.
+func tlsToLE(target *ld.Target, ldr *loader.Loader, s loader.Sym, r loader.Reloc, rIdx int) bool {
+	su := ldr.MakeSymbolUpdater(s)
+	off := int(r.Off())
+	switch r.Type() - objabi.ElfRelocOffset {
+	case objabi.RelocType(elf.R_X86_64_TPOFF32):
+		su.SetRelocType(rIdx, objabi.R_TLS_LE)
+		return true
+
+	case objabi.RelocType(elf.R_X86_64_DTPOFF32):
+		// The offset from the start of the module's block, which the
+		// relaxed TLSLD sequence below replaces with the thread pointer.
+		su.SetRelocType(rIdx, objabi.R_TLS_LE)
+		return true
+
+	case objabi.RelocType(elf.R_X86_64_GOTTPOFF):
+		//	movq x@gottpoff(%rip), %reg  =>  movq $x@tpoff, %reg
+		//	addq x@gottpoff(%rip), %reg  =>  addq $x@tpoff, %reg
+		if off < 3 || off+4 > len(ldr.Data(s)) {
+			break
+		}
+		su.MakeWritable()
+		tlsIEtoLE(su.Data(), off, 4)
+		su.SetRelocType(rIdx, objabi.R_TLS_LE)
+		su.SetRelocAdd(rIdx, r.Add()+4)
+		return true
+
+	case objabi.RelocType(elf.R_X86_64_TLSGD):
+		//	.byte 0x66; leaq x@tlsgd(%rip), %rdi
+		//	.word 0x6666; rex64; call __tls_get_addr@plt
+		// or
+		//	.byte 0x66; leaq x@tlsgd(%rip), %rdi
+		//	.byte 0x66; rex64; call *__tls_get_addr@gotpcrel(%rip)
+		// =>
+		//	movq %fs:0, %rax
+		//	leaq x@tpoff(%rax), %rax
+		data := ldr.Data(s)
+		if off < 4 || off+12 > len(data) || !bytes.Equal(data[off-4:off], []byte{0x66, 0x48, 0x8d, 0x3d}) {
+			break
+		}
+		call := data[off+4 : off+8]
+		if !bytes.Equal(call, []byte{0x66, 0x66, 0x48, 0xe8}) && !bytes.Equal(call, []byte{0x66, 0x48, 0xff, 0x15}) {
+			break
+		}
+		callIdx := tlsCallReloc(ldr, s, rIdx, off+8)
+		if callIdx < 0 {
+			break
+		}
+		targ, add := r.Sym(), r.Add()+4
+		su.MakeWritable()
+		data = su.Data()
+		copy(data[off-4:], []byte{
+			0x64, 0x48, 0x8b, 0x04, 0x25, 0x00, 0x00, 0x00, 0x00,
+			0x48, 0x8d, 0x80, 0x00, 0x00, 0x00, 0x00,
+		})
+		tlsConst(su, rIdx, data[off:])
+		su.SetRelocType(callIdx, objabi.R_TLS_LE)
+		su.SetRelocSym(callIdx, targ)
+		su.SetRelocAdd(callIdx, add)
+		return true
+
+	case objabi.RelocType(elf.R_X86_64_TLSLD):
+		//	leaq x@tlsld(%rip), %rdi
+		//	call __tls_get_addr@plt
+		// =>
+		//	.word 0x6666; .byte 0x66; movq %fs:0, %rax
+		//
+		// or, with a nop after it,
+		//	leaq x@tlsld(%rip), %rdi
+		//	call *__tls_get_addr@gotpcrel(%rip)
+		data := ldr.Data(s)
+		if off < 3 || off+9 > len(data) || !bytes.Equal(data[off-3:off], []byte{0x48, 0x8d, 0x3d}) {
+			break
+		}
+		seq := []byte{0x66, 0x66, 0x66, 0x64, 0x48, 0x8b, 0x04, 0x25, 0x00, 0x00, 0x00, 0x00}
+		callOff := off + 5
+		switch {
+		case data[off+4] == 0xe8:
+		case off+10 <= len(data) && data[off+4] == 0xff && data[off+5] == 0x15:
+			seq = append(seq, 0x90)
+			callOff++
+		default:
+			callOff = -1
+		}
+		if callOff < 0 {
+			break
+		}
+		callIdx := tlsCallReloc(ldr, s, rIdx, callOff)
+		if callIdx < 0 {
+			break
+		}
+		su.MakeWritable()
+		data = su.Data()
+		copy(data[off-3:], seq)
+		tlsConst(su, rIdx, data[off:])
+		tlsConst(su, callIdx, data[callOff:])
+		return true
+	}
+	ldr.Errorf(s, "unexpected %s sequence at offset %#x", sym.RelocName(target.Arch, r.Type()), off)
+	return false
+}
+
+// tlsCallReloc returns the index of the relocation of the call to
+// __tls_get_addr at offset off of s, which follows relocation rIdx of
+// a TLSGD or TLSLD sequence, or -1 if there is none.
+func tlsCallReloc(ldr *loader.Loader, s loader.Sym, rIdx, off int) int {
+	relocs := ldr.Relocs(s)
+	if rIdx+1 >= relocs.Count() {
+		return -1
+	}
+	r := relocs.At(rIdx + 1)
+	if int(r.Off()) != off || r.Siz() != 4 {
+		return -1
+	}
+	switch r.Type() - objabi.ElfRelocOffset {
+	case objabi.RelocType(elf.R_X86_64_PLT32),
+		objabi.RelocType(elf.R_X86_64_PC32),
+		objabi.RelocType(elf.R_X86_64_GOTPCREL),
+		objabi.RelocType(elf.R_X86_64_GOTPCRELX):
+		return rIdx + 1
+	}
+	return -1
+}
+
+// tlsConst turns relocation i of su into one that writes the rewritten
+// instruction bytes b it covers, so that it no longer refers to a symbol.
+func tlsConst(su *loader.SymbolBuilder, i int, b []byte) {
+	su.SetRelocType(i, objabi.R_CONST)
+	su.SetRelocSym(i, 0)
+	su.SetRelocAdd(i, int64(binary.LittleEndian.Uint32(b)))
+}
+
 func tlsIEtoLE(P []byte, off, size int) {
 	// Transform the PC-relative instruction into a constant load.
 	// That is,
@@ -653,7 +1033,15 @@ func tlsIEtoLE(P []byte, off, size int) {
 	op := P[off-3 : off]
 	reg := op[2] >> 3
 
-	if op[1] == 0x8b || reg == 4 {
+	if op[1] == 0x03 {
+		// ADDQ, which C compilers generate:
+		//	ADDQ X(IP), REG  ->  ADDQ $Y, REG
+		if op[0] == 0x4c {
+			op[0] = 0x49
+		}
+		op[1] = 0x81
+		op[2] = 0xc0 | reg
+	} else if op[1] == 0x8b || reg == 4 {
 		// MOVQ
 		if op[0] == 0x4c {
 			op[0] = 0x49
@@ -667,10 +1055,6 @@ func tlsIEtoLE(P []byte, off, size int) {
 		}
 		op[2] = 0xc0 | reg
 	} else {
-		// An alternate op is ADDQ. This is handled by GNU gold,
-		// but right now is not generated by the Go compiler:
-		//	ADDQ X(IP), REG  ->  ADDQ $Y, REG
-		// Consider adding support for it here.
-		log.Fatalf("expected TLS IE op to be MOVQ, got %v", op)
+		log.Fatalf("expected TLS IE op to be MOVQ or ADDQ, got %v", op)
 	}
 }
@@ -63,6 +63,10 @@ import (
 //                      c: R_ARM_GOT_PREL       local.moduledata
 
 func gentext(ctxt *ld.Link, ldr *loader.Loader) {
+	if ctxt.IsELF {
+		addAttributes(ctxt, ldr)
+	}
+
 	initfunc, addmoduledata := ld.PrepareAddmoduledata(ctxt)
 	if initfunc == nil {
 		return
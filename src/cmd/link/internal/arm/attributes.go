@@ -0,0 +1,159 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package arm
+
+import (
+	"bytes"
+	"cmd/link/internal/ld"
+	"cmd/link/internal/loadelf"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"encoding/binary"
+	"internal/buildcfg"
+)
+
+// Values of the build attributes, as per the Addenda to, and Errata in,
+// the ABI for the Arm Architecture.
+const (
+	cpuArchV5T = 3
+	cpuArchV6  = 6
+	cpuArchV7  = 10
+
+	fpArchVFPv2    = 2
+	fpArchVFPv3D16 = 4
+
+	vfpArgsVFP        = 1 // floating-point arguments in VFP registers
+	vfpArgsCompatible = 3 // no floating-point arguments
+)
+
+// goAttributes returns the attributes of the Go code for GOARM. The Go
+// code does not follow the AAPCS for floating-point arguments, which cgo
+// passes in memory, so it is compatible with either float ABI.
+func goAttributes() loadelf.ARMAttributes {
+	attrs := loadelf.ARMAttributes{
+		ARMISAUse:  1,
+		ABIVFPArgs: vfpArgsCompatible,
+	}
+	switch buildcfg.GOARM {
+	case 5:
+		// Floating point is done in software.
+		attrs.CPUArch = cpuArchV5T
+	case 6:
+		attrs.CPUArch = cpuArchV6
+		attrs.FPArch = fpArchVFPv2
+	default:
+		// Only D0-D15 are used.
+		attrs.CPUArch = cpuArchV7
+		attrs.CPUArchProfile = 'A'
+		attrs.FPArch = fpArchVFPv3D16
+	}
+	return attrs
+}
+
+// addAttributes creates the .ARM.attributes section of the output. It
+// holds the attributes of the Go code, merged with those of the host
+// objects when linking internally, the way GNU ld does: the output
+// requires the highest architecture and floating-point unit that any
+// object requires, and the objects must agree on whether
+// floating-point arguments are passed in VFP registers.
+func addAttributes(ctxt *ld.Link, ldr *loader.Loader) {
+	attrs := goAttributes()
+	var vfpArgsPn string // the object that set attrs.ABIVFPArgs
+	for _, h := range ctxt.HostAttrs {
+		in := &h.Attrs.ARM
+		if in.ABIVFPArgs != attrs.ABIVFPArgs && in.ABIVFPArgs != vfpArgsCompatible {
+			if attrs.ABIVFPArgs != vfpArgsCompatible {
+				hard, soft := h.Pn, vfpArgsPn
+				if in.ABIVFPArgs != vfpArgsVFP {
+					hard, soft = soft, hard
+				}
+				ld.Errorf(nil, "%s uses VFP register arguments, %s does not", hard, soft)
+				continue
+			}
+			attrs.ABIVFPArgs, vfpArgsPn = in.ABIVFPArgs, h.Pn
+		}
+		mergeAttributes(&attrs, in)
+	}
+
+	s := ldr.CreateSymForUpdate(".ARM.attributes", 0)
+	s.SetType(sym.SELFROSECT)
+	s.SetReachable(true)
+	s.SetAlign(1)
+	s.AddBytes(encodeAttributes(ctxt.Arch.ByteOrder, &attrs))
+}
+
+// fpArchs describes the values of Tag_FP_arch: the version of the
+// floating-point architecture and the number of double registers.
+var fpArchs = []struct{ version, regs uint64 }{
+	{0, 0},  // none
+	{1, 16}, // VFPv1
+	{2, 16}, // VFPv2
+	{3, 32}, // VFPv3
+	{3, 16}, // VFPv3-D16
+	{4, 32}, // VFPv4
+	{4, 16}, // VFPv4-D16
+	{8, 32}, // Armv8 FP
+	{8, 16}, // Armv8 FP-D16
+}
+
+// mergeAttributes merges the attributes of a host object, in, into out,
+// except for Tag_ABI_VFP_args.
+func mergeAttributes(out, in *loadelf.ARMAttributes) {
+	max := func(a, b uint64) uint64 {
+		if a > b {
+			return a
+		}
+		return b
+	}
+	out.CPUArch = max(out.CPUArch, in.CPUArch)
+	if out.CPUArchProfile == 0 {
+		out.CPUArchProfile = in.CPUArchProfile
+	}
+	out.ARMISAUse = max(out.ARMISAUse, in.ARMISAUse)
+	out.THUMBISAUse = max(out.THUMBISAUse, in.THUMBISAUse)
+	if in.FPArch < uint64(len(fpArchs)) && out.FPArch < uint64(len(fpArchs)) {
+		// The merged unit has the highest version and the most
+		// registers of the two.
+		a, b := fpArchs[out.FPArch], fpArchs[in.FPArch]
+		version, regs := max(a.version, b.version), max(a.regs, b.regs)
+		for i, fp := range fpArchs {
+			if fp.version == version && fp.regs == regs {
+				out.FPArch = uint64(i)
+			}
+		}
+	} else {
+		out.FPArch = max(out.FPArch, in.FPArch)
+	}
+}
+
+// encodeAttributes returns the contents of an .ARM.attributes section
+// holding the non-zero attributes in attrs.
+func encodeAttributes(e binary.ByteOrder, attrs *loadelf.ARMAttributes) []byte {
+	var list []byte
+	var buf [binary.MaxVarintLen64]byte
+	for _, a := range []struct{ tag, val uint64 }{
+		{loadelf.TagCPUArch, attrs.CPUArch},
+		{loadelf.TagCPUArchProfile, attrs.CPUArchProfile},
+		{loadelf.TagARMISAUse, attrs.ARMISAUse},
+		{loadelf.TagTHUMBISAUse, attrs.THUMBISAUse},
+		{loadelf.TagFPArch, attrs.FPArch},
+		{loadelf.TagABIVFPArgs, attrs.ABIVFPArgs},
+	} {
+		if a.val != 0 {
+			list = append(list, buf[:binary.PutUvarint(buf[:], a.tag)]...)
+			list = append(list, buf[:binary.PutUvarint(buf[:], a.val)]...)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('A')
+	const vendor = "aeabi\x00"
+	binary.Write(&b, e, uint32(4+len(vendor)+1+4+len(list)))
+	b.WriteString(vendor)
+	b.WriteByte(loadelf.TagFile)
+	binary.Write(&b, e, uint32(1+4+len(list)))
+	b.Write(list)
+	return b.Bytes()
+}
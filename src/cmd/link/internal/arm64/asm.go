@@ -42,6 +42,8 @@ import (
 )
 
 func gentext(ctxt *ld.Link, ldr *loader.Loader) {
+	genselfreloc(ctxt)
+
 	initfunc, addmoduledata := ld.PrepareAddmoduledata(ctxt)
 	if initfunc == nil {
 		return
@@ -71,6 +73,99 @@ func gentext(ctxt *ld.Link, ldr *loader.Loader) {
 	rel2.SetSym(addmoduledata)
 }
 
+// genselfreloc generates the entry point of a -static-pie executable,
+// which applies the R_AARCH64_RELATIVE relocations of the executable
+// before branching to the runtime's entry point. It uses no stack, so
+// that the runtime finds the one the kernel set up.
+func genselfreloc(ctxt *ld.Link) {
+	sr, zero, entry := ld.PrepareSelfReloc(ctxt)
+	if sr == nil {
+		return
+	}
+
+	o := func(op uint32) {
+		sr.AddUint32(ctxt.Arch, op)
+	}
+	// 0000000000000000 <go.link.selfreloc>:
+	// 0:	90000000 	adrp	x0, 0			// load bias
+	// 	0: R_AARCH64_ADR_PREL_PG_HI21	go.link.zero
+	// 4:	91000000 	add	x0, x0, #0x0
+	// 	4: R_AARCH64_ADD_ABS_LO12_NC	go.link.zero
+	o(0x90000000)
+	o(0x91000000)
+	rel, _ := sr.AddRel(objabi.R_ADDRARM64)
+	rel.SetOff(0)
+	rel.SetSiz(8)
+	rel.SetSym(zero)
+	// 8:	90000001 	adrp	x1, 0
+	// 	8: R_AARCH64_ADR_PREL_PG_HI21	.dynamic
+	// c:	91000021 	add	x1, x1, #0x0
+	// 	c: R_AARCH64_ADD_ABS_LO12_NC	.dynamic
+	o(0x90000001)
+	o(0x91000021)
+	rel, _ = sr.AddRel(objabi.R_ADDRARM64)
+	rel.SetOff(8)
+	rel.SetSiz(8)
+	rel.SetSym(ctxt.Dynamic)
+	// 10:	d2800002 	mov	x2, #0x0		// DT_RELA
+	// 14:	d2800003 	mov	x3, #0x0		// DT_RELASZ
+	o(0xd2800002)
+	o(0xd2800003)
+	// 18:	f9400024 	ldr	x4, [x1]
+	// 1c:	b4000124 	cbz	x4, 40
+	// 20:	f1001c9f 	cmp	x4, #0x7
+	// 24:	54000041 	b.ne	2c
+	// 28:	f9400422 	ldr	x2, [x1, #8]
+	// 2c:	f100209f 	cmp	x4, #0x8
+	// 30:	54000041 	b.ne	38
+	// 34:	f9400423 	ldr	x3, [x1, #8]
+	// 38:	91004021 	add	x1, x1, #0x10
+	// 3c:	17fffff7 	b	18
+	o(0xf9400024)
+	o(0xb4000124)
+	o(0xf100009f | uint32(elf.DT_RELA)<<10)
+	o(0x54000041)
+	o(0xf9400422)
+	o(0xf100009f | uint32(elf.DT_RELASZ)<<10)
+	o(0x54000041)
+	o(0xf9400423)
+	o(0x91004021)
+	o(0x17fffff7)
+	// 40:	8b000042 	add	x2, x2, x0
+	// 44:	8b020063 	add	x3, x3, x2
+	// 48:	eb03005f 	cmp	x2, x3
+	// 4c:	54000142 	b.cs	74
+	// 50:	b9400844 	ldr	w4, [x2, #8]
+	// 54:	71100c9f 	cmp	w4, #0x403		// R_AARCH64_RELATIVE
+	// 58:	540000a1 	b.ne	6c
+	// 5c:	f9400045 	ldr	x5, [x2]
+	// 60:	f9400846 	ldr	x6, [x2, #16]
+	// 64:	8b0000c6 	add	x6, x6, x0
+	// 68:	f82068a6 	str	x6, [x5, x0]
+	// 6c:	91006042 	add	x2, x2, #0x18
+	// 70:	17fffff6 	b	48
+	o(0x8b000042)
+	o(0x8b020063)
+	o(0xeb03005f)
+	o(0x54000142)
+	o(0xb9400844)
+	o(0x7100009f | uint32(elf.R_AARCH64_RELATIVE)<<10)
+	o(0x540000a1)
+	o(0xf9400045)
+	o(0xf9400846)
+	o(0x8b0000c6)
+	o(0xf82068a6)
+	o(0x91006042)
+	o(0x17fffff6)
+	// 74:	14000000 	b	0 <_rt0_arm64_linux>
+	// 	74: R_AARCH64_JUMP26	_rt0_arm64_linux
+	o(0x14000000)
+	rel, _ = sr.AddRel(objabi.R_CALLARM64)
+	rel.SetOff(0x74)
+	rel.SetSiz(4)
+	rel.SetSym(entry)
+}
+
 func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym, r loader.Reloc, rIdx int) bool {
 	targ := r.Sym()
 	var targType sym.SymKind
@@ -211,6 +306,52 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 		su.SetRelocType(rIdx, objabi.R_ARM64_LDST128)
 		return true
 
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_AARCH64_TLSDESC_ADR_PAGE21),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_AARCH64_TLSDESC_LD64_LO12_NC),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_AARCH64_TLSDESC_ADD_LO12_NC),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_AARCH64_TLSDESC_CALL):
+		// We are linking an executable, so relax the TLS descriptor
+		// sequence to the local exec model, as the host linkers do:
+		//
+		//	adrp x0, :tlsdesc:v              =>  movz x0, #:tprel_g1:v, lsl #16
+		//	ldr  x1, [x0, #:tlsdesc_lo12:v]  =>  movk x0, #:tprel_g0_nc:v
+		//	add  x0, x0, #:tlsdesc_lo12:v    =>  nop
+		//	blr  x1                          =>  nop
+		//
+		// leaving the offset of v from the thread pointer in x0.
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected TLS descriptor relocation for dynamic symbol %s", ldr.SymName(targ))
+		}
+		if targType == 0 || targType == sym.SXREF {
+			ldr.Errorf(s, "unknown symbol %s in TLS descriptor relocation", ldr.SymName(targ))
+		}
+		data := ldr.Data(s)
+		off := r.Off()
+		if int(off+3) >= len(data) {
+			ldr.Errorf(s, "TLS descriptor relocation out of range")
+			return false
+		}
+		o := target.Arch.ByteOrder.Uint32(data[off:])
+		su := ldr.MakeSymbolUpdater(s)
+		switch r.Type() - objabi.ElfRelocOffset {
+		case objabi.RelocType(elf.R_AARCH64_TLSDESC_ADR_PAGE21):
+			// The offset is known to fit in 16 bits (see
+			// R_ARM64_TLS_LE below), so the high half is 0.
+			// The instruction is rewritten by an R_CONST
+			// relocation, as it needs no other.
+			su.SetRelocType(rIdx, objabi.R_CONST)
+			su.SetRelocAdd(rIdx, int64(0xd2a00000|o&0x1f))
+		case objabi.RelocType(elf.R_AARCH64_TLSDESC_LD64_LO12_NC):
+			// The base register of the LDR is x0.
+			su.MakeWritable()
+			su.SetUint32(target.Arch, int64(off), 0xf2800000|(o>>5)&0x1f)
+			su.SetRelocType(rIdx, objabi.R_ARM64_TLS_LE)
+		default:
+			su.SetRelocType(rIdx, objabi.R_CONST)
+			su.SetRelocAdd(rIdx, 0xd503201f) // nop
+		}
+		return true
+
 	// Handle relocations found in Mach-O object files.
 	case objabi.MachoRelocOffset + ld.MACHO_ARM64_RELOC_UNSIGNED*2:
 		if targType == sym.SDYNIMPORT {
@@ -370,6 +511,13 @@ func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loade
 		}
 
 		if target.IsElf() {
+			// With -pack-relative-relocs, the relocation goes in
+			// the packed .relr.dyn table instead. As below, the
+			// word still gets the link-time address statically.
+			if ld.ElfAddRelr(target, ldr, s, r) {
+				return true
+			}
+
 			// Generate R_AARCH64_RELATIVE relocations for best
 			// efficiency in the dynamic linker.
 			//
@@ -463,6 +611,12 @@ func elfreloc1(ctxt *ld.Link, out *ld.OutBuf, ldr *loader.Loader, s loader.Sym,
 		default:
 			return false
 		}
+	case objabi.R_PCREL:
+		// Only 4-byte PC-relative data, as in .eh_frame.
+		if siz != 4 {
+			return false
+		}
+		out.Write64(uint64(elf.R_AARCH64_PREL32) | uint64(elfsym)<<32)
 	case objabi.R_ADDRARM64:
 		// two relocations: R_AARCH64_ADR_PREL_PG_HI21 and R_AARCH64_ADD_ABS_LO12_NC
 		out.Write64(uint64(elf.R_AARCH64_ADR_PREL_PG_HI21) | uint64(elfsym)<<32)
@@ -487,12 +641,47 @@ func elfreloc1(ctxt *ld.Link, out *ld.OutBuf, ldr *loader.Loader, s loader.Sym,
 		}
 		out.Write64(uint64(elf.R_AARCH64_CALL26) | uint64(elfsym)<<32)
 
+	// The relocations below are only applied by the internal linker,
+	// and written for -emitreloc. Their ELF types depend on the
+	// instruction relocated, see archreloc. R_ARM64_GOT refers to the
+	// GOT entry itself, so it is described as a PC-relative load.
+	case objabi.R_ARM64_GOT, objabi.R_ARM64_PCREL:
+		var t elf.R_AARCH64
+		ins := elfrelocins(ctxt, ldr, s, ri)
+		switch {
+		case (ins>>24)&0x9f == 0x90: // adrp
+			t = elf.R_AARCH64_ADR_PREL_PG_HI21
+		case r.Type == objabi.R_ARM64_PCREL && (ins>>24)&0x9f == 0x91: // add
+			t = elf.R_AARCH64_ADD_ABS_LO12_NC
+		case r.Type == objabi.R_ARM64_GOT && ins>>24 == 0xf9: // ldr
+			t = elf.R_AARCH64_LDST64_ABS_LO12_NC
+		default:
+			return false
+		}
+		out.Write64(uint64(t) | uint64(elfsym)<<32)
+	case objabi.R_ARM64_LDST8:
+		out.Write64(uint64(elf.R_AARCH64_LDST8_ABS_LO12_NC) | uint64(elfsym)<<32)
+	case objabi.R_ARM64_LDST16:
+		out.Write64(uint64(elf.R_AARCH64_LDST16_ABS_LO12_NC) | uint64(elfsym)<<32)
+	case objabi.R_ARM64_LDST32:
+		out.Write64(uint64(elf.R_AARCH64_LDST32_ABS_LO12_NC) | uint64(elfsym)<<32)
+	case objabi.R_ARM64_LDST64:
+		out.Write64(uint64(elf.R_AARCH64_LDST64_ABS_LO12_NC) | uint64(elfsym)<<32)
+	case objabi.R_ARM64_LDST128:
+		out.Write64(uint64(elf.R_AARCH64_LDST128_ABS_LO12_NC) | uint64(elfsym)<<32)
 	}
 	out.Write64(uint64(r.Xadd))
 
 	return true
 }
 
+// elfrelocins returns the instruction relocated by relocation ri of s.
+func elfrelocins(ctxt *ld.Link, ldr *loader.Loader, s loader.Sym, ri int) uint32 {
+	relocs := ldr.Relocs(s)
+	off := relocs.At(ri).Off()
+	return ctxt.Arch.ByteOrder.Uint32(ldr.Data(s)[off:])
+}
+
 // sign-extends from 21, 24-bit.
 func signext21(x int64) int64 { return x << (64 - 21) >> (64 - 21) }
 func signext24(x int64) int64 { return x << (64 - 24) >> (64 - 24) }
@@ -775,8 +964,9 @@ func archreloc(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, r loade
 			ldr.Errorf(s, "TLS reloc on unsupported OS %v", target.HeadType)
 		}
 		// The TCB is two pointers. This is not documented anywhere, but is
-		// de facto part of the ABI.
-		v := ldr.SymValue(rs) + int64(2*target.Arch.PtrSize)
+		// de facto part of the ABI. The TLS block follows it, aligned
+		// for the thread-local variables of host objects.
+		v := ld.TLSSymOffset(ldr, rs) + ld.Rnd(int64(2*target.Arch.PtrSize), syms.Tlsalign) + r.Add()
 		if v < 0 || v >= 32678 {
 			ldr.Errorf(s, "TLS offset out of range %d", v)
 		}
@@ -793,7 +983,7 @@ func archreloc(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, r loade
 
 			// The TCB is two pointers. This is not documented anywhere, but is
 			// de facto part of the ABI.
-			v := ldr.SymAddr(rs) + int64(2*target.Arch.PtrSize) + r.Add()
+			v := ldr.SymAddr(rs) + ld.Rnd(int64(2*target.Arch.PtrSize), syms.Tlsalign) + r.Add()
 			if v < 0 || v >= 32678 {
 				ldr.Errorf(s, "TLS offset out of range %d", v)
 			}
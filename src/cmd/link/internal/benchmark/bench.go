@@ -32,12 +32,15 @@ type Metrics struct {
 	curMark   *mark
 	filebase  string
 	pprofFile *os.File
+	trace     *os.File // for the -tracefile output, if any
+	startT    time.Time
 }
 
 type mark struct {
 	name              string
 	startM, endM, gcM runtime.MemStats
 	startT, endT      time.Time
+	subs              []*mark // sub-phases, in the order they started
 }
 
 // New creates a new Metrics object.
@@ -72,7 +75,7 @@ func New(gc Flags, filebase string) *Metrics {
 	if gc == GC {
 		runtime.GC()
 	}
-	return &Metrics{gc: gc, filebase: filebase}
+	return &Metrics{gc: gc, filebase: filebase, startT: time.Now()}
 }
 
 // Report reports the metrics.
@@ -120,9 +123,14 @@ func (m *Metrics) Start(name string) {
 		if err != nil {
 			panic(err)
 		}
-		m.pprofFile = f
-		if err = pprof.StartCPUProfile(m.pprofFile); err != nil {
-			panic(err)
+		if err = pprof.StartCPUProfile(f); err != nil {
+			// A CPU profile of the whole program, such as the
+			// linker's -cpuprofile, is running. Only write the
+			// memory profiles.
+			f.Close()
+			os.Remove(f.Name())
+		} else {
+			m.pprofFile = f
 		}
 	}
 	runtime.ReadMemStats(&m.curMark.startM)
@@ -134,12 +142,19 @@ func (m *Metrics) closeMark() {
 		return
 	}
 	m.curMark.endT = time.Now()
-	if m.shouldPProf() {
+	if m.pprofFile != nil {
 		pprof.StopCPUProfile()
 		m.pprofFile.Close()
 		m.pprofFile = nil
 	}
 	runtime.ReadMemStats(&m.curMark.endM)
+	for _, sub := range m.curMark.subs {
+		if sub.endT.IsZero() {
+			// The phase ended, or the link failed, during the
+			// sub-phase.
+			sub.endT, sub.endM = m.curMark.endT, m.curMark.endM
+		}
+	}
 	if m.gc == GC {
 		runtime.GC()
 		runtime.ReadMemStats(&m.curMark.gcM)
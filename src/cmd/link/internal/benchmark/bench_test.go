@@ -50,5 +50,9 @@ func TestPProfNames(t *testing.T) {
 func TestNilBenchmarkObject(t *testing.T) {
 	var b *Metrics
 	b.Start("TEST")
+	b.Sub("SUB")()
 	b.Report(nil)
+	if err := b.Trace(); err != nil {
+		t.Error(err)
+	}
 }
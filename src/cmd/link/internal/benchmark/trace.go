@@ -0,0 +1,127 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package benchmark
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"time"
+)
+
+// The trace of the phases is in the Chrome trace event format, which
+// chrome://tracing and Perfetto display:
+//
+//	{"traceEvents": [
+//		{"name": "loadlib", "cat": "phase", "ph": "X", "ts": 1520, "dur": 20811, "pid": 1, "tid": 1, "args": {...}},
+//		{"name": "hostlink", "cat": "phase", "ph": "X", ...},
+//		{"name": "run gcc", "cat": "subphase", "ph": "X", ...},
+//		...
+//	]}
+//
+// Each phase is a complete event, followed by the events of its
+// sub-phases, which lie within it. The times are in microseconds from
+// the creation of the Metrics. The args of an event are the bytes
+// allocated and the number of allocations during it, the live heap at
+// its end and the high-water mark of the heap so far, and, with GC
+// set, the live heap after the collection at its end.
+
+type traceFile struct {
+	TraceEvents     []traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+type traceEvent struct {
+	Name string           `json:"name"`
+	Cat  string           `json:"cat,omitempty"`
+	Ph   string           `json:"ph"`
+	Ts   int64            `json:"ts"`
+	Dur  int64            `json:"dur"`
+	Pid  int              `json:"pid"`
+	Tid  int              `json:"tid"`
+	Args map[string]int64 `json:"args,omitempty"`
+}
+
+// TraceTo makes m write a trace of the phases to file when Trace is
+// called.
+func (m *Metrics) TraceTo(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	m.trace = f
+	return nil
+}
+
+// Sub starts a sub-phase of the current phase, which ends when the
+// returned function is called, or at the latest with the phase. The
+// sub-phases only appear in the trace.
+func (m *Metrics) Sub(name string) (end func()) {
+	if m == nil || m.trace == nil || m.curMark == nil {
+		return func() {}
+	}
+	sub := &mark{name: name}
+	runtime.ReadMemStats(&sub.startM)
+	sub.startT = time.Now()
+	m.curMark.subs = append(m.curMark.subs, sub)
+	return func() {
+		if !sub.endT.IsZero() {
+			return // the phase already ended
+		}
+		sub.endT = time.Now()
+		runtime.ReadMemStats(&sub.endM)
+	}
+}
+
+// Trace closes the current phase and writes the trace of the phases so
+// far, if TraceTo was called. It does nothing if called again, so it
+// can be called both at the end of the program and on the way out when
+// it fails partway.
+func (m *Metrics) Trace() error {
+	if m == nil || m.trace == nil {
+		return nil
+	}
+	m.closeMark()
+	f := m.trace
+	m.trace = nil
+
+	t := traceFile{TraceEvents: []traceEvent{}, DisplayTimeUnit: "ms"}
+	for _, mk := range m.marks {
+		t.TraceEvents = append(t.TraceEvents, m.traceEvent(mk, "phase"))
+		for _, sub := range mk.subs {
+			t.TraceEvents = append(t.TraceEvents, m.traceEvent(sub, "subphase"))
+		}
+	}
+	data, err := json.Marshal(t)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (m *Metrics) traceEvent(mk *mark, cat string) traceEvent {
+	args := map[string]int64{
+		"alloc-B":     int64(mk.endM.TotalAlloc - mk.startM.TotalAlloc),
+		"allocs":      int64(mk.endM.Mallocs - mk.startM.Mallocs),
+		"heap-B":      int64(mk.endM.HeapAlloc),
+		"peak-heap-B": int64(mk.endM.HeapSys),
+	}
+	if m.gc == GC && cat == "phase" {
+		args["live-B"] = int64(mk.gcM.HeapAlloc)
+	}
+	return traceEvent{
+		Name: mk.name,
+		Cat:  cat,
+		Ph:   "X",
+		Ts:   mk.startT.Sub(m.startT).Microseconds(),
+		Dur:  mk.endT.Sub(mk.startT).Microseconds(),
+		Pid:  1,
+		Tid:  1,
+		Args: args,
+	}
+}
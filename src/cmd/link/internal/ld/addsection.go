@@ -0,0 +1,198 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Support for -addsection, which adds the contents of a file to the
+// output as a named section, as
+//
+//	objcopy --add-section name=file out
+//
+// would, without needing binutils for the target and before the go
+// command records the build ID. The go command adds the contents of
+// the file to the hash the build ID is computed from.
+//
+// By default the section is not loaded, and is appended to the final
+// output, after any external link. With flag alloc, it is loaded in
+// the read-only segment instead, and the program finds it through the
+// symbols __start_<name> and __stop_<name>, as with the GNU linkers,
+// which is why the name of a loaded section must be a C identifier.
+// Go code can refer to them from assembly, as in
+//
+//	MOVQ	$__start_manifest(SB), AX
+
+// An addedSection is a section added with -addsection.
+type addedSection struct {
+	name  string
+	file  string
+	alloc bool
+	data  []byte
+
+	sym         loader.Sym // the section symbol, if alloc
+	start, stop loader.Sym // __start_<name> and __stop_<name>
+}
+
+var addedSections []addedSection
+
+func addAddSection(arg string) {
+	eq := strings.Index(arg, "=")
+	if eq < 0 {
+		Exitf("-addsection argument must be of the form name=file[,alloc]: %s", arg)
+	}
+	a := addedSection{name: arg[:eq], file: arg[eq+1:]}
+	if strings.HasSuffix(a.file, ",alloc") {
+		a.file = strings.TrimSuffix(a.file, ",alloc")
+		a.alloc = true
+	}
+	if a.alloc && !validCIdentifier(a.name) {
+		Exitf("-addsection: bad section name %q: a loaded section must be named by a C identifier, for __start_%s and __stop_%s", a.name, a.name, a.name)
+	}
+	if !a.alloc && !validCIdentifier(a.name) && !validReservedName(a.name) {
+		Exitf("-addsection: bad section name %q: must be a C identifier, or a dot followed by letters, digits, underscores and dots", a.name)
+	}
+	for _, other := range addedSections {
+		if other.name == a.name {
+			Exitf("-addsection: section %s added twice", a.name)
+		}
+	}
+	for _, r := range reservedSections {
+		if r.name == a.name {
+			Exitf("-addsection: section %s already exists", a.name)
+		}
+	}
+	data, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		Exitf("-addsection: %v", err)
+	}
+	a.data = data
+	addedSections = append(addedSections, a)
+}
+
+// validCIdentifier reports whether name is a C identifier.
+func validCIdentifier(name string) bool {
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// addSections creates the loaded sections added with -addsection, and
+// the symbols marking their bounds.
+func (ctxt *Link) addSections() {
+	if len(addedSections) == 0 {
+		return
+	}
+	if !ctxt.IsELF {
+		Exitf("-addsection is only supported for ELF")
+	}
+	ldr := ctxt.loader
+	for i := range addedSections {
+		a := &addedSections[i]
+		if !a.alloc {
+			if ctxt.BuildMode == BuildModeCArchive {
+				Exitf("-addsection: section %s cannot be added to a c-archive unless it is loaded", a.name)
+			}
+			continue
+		}
+		if ldr.Lookup(a.name, 0) != 0 {
+			Exitf("-addsection: section %s already exists", a.name)
+		}
+		s := ldr.CreateSymForUpdate(a.name, 0)
+		s.SetType(sym.SELFROSECT)
+		s.SetReachable(true)
+		s.SetAlign(int32(ctxt.Arch.PtrSize))
+		s.SetData(a.data)
+		s.SetSize(int64(len(a.data)))
+		a.sym = s.Sym()
+
+		a.start = ctxt.xdefine("__start_"+a.name, sym.SELFROSECT, 0)
+		a.stop = ctxt.xdefine("__stop_"+a.name, sym.SELFROSECT, 0)
+	}
+}
+
+// setAddedSections sets the symbols marking the bounds of the loaded
+// sections added with -addsection, once the output is laid out, and
+// reports those that have the name of another section of the output.
+func (ctxt *Link) setAddedSections() {
+	if len(addedSections) == 0 {
+		return
+	}
+	count := make(map[string]int)
+	for _, seg := range Segments {
+		for _, sect := range seg.Sections {
+			count[sect.Name]++
+		}
+	}
+	ldr := ctxt.loader
+	for _, a := range addedSections {
+		if !a.alloc {
+			continue
+		}
+		if count[a.name] > 1 {
+			Errorf(nil, "-addsection: section %s already exists", a.name)
+		}
+		value := ldr.SymValue(a.sym)
+		sect := ldr.SymSect(a.sym)
+		ldr.SetSymValue(a.start, value)
+		ldr.SetSymSect(a.start, sect)
+		ldr.SetSymValue(a.stop, value+int64(len(a.data)))
+		ldr.SetSymSect(a.stop, sect)
+	}
+}
+
+// appendAddedSections appends the sections added with -addsection that
+// are not loaded to the final output.
+func (ctxt *Link) appendAddedSections() {
+	var data []byte
+	for _, a := range addedSections {
+		if a.alloc {
+			continue
+		}
+		if data == nil {
+			var err error
+			data, err = ioutil.ReadFile(*flagOutfile)
+			if err != nil {
+				Exitf("-addsection: %v", err)
+			}
+		}
+		f, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			Exitf("-addsection: %s: %v", *flagOutfile, err)
+		}
+		if f.Section(a.name) != nil {
+			Exitf("-addsection: section %s already exists", a.name)
+		}
+		data, err = elfAddSection(data, a.name, elf.SHT_PROGBITS, 1, a.data)
+		if err != nil {
+			Exitf("-addsection: %s: %v", *flagOutfile, err)
+		}
+	}
+	if data == nil {
+		return
+	}
+	mode := os.FileMode(0777)
+	if fi, err := os.Stat(*flagOutfile); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := ioutil.WriteFile(*flagOutfile, data, mode); err != nil {
+		Exitf("-addsection: %v", err)
+	}
+}
@@ -32,12 +32,16 @@ package ld
 
 import (
 	"cmd/internal/bio"
+	"cmd/link/internal/loader"
 	"cmd/link/internal/sym"
 	"encoding/binary"
 	"fmt"
 	"internal/buildcfg"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -63,11 +67,13 @@ type ArHdr struct {
 // required objects. The general format is the same as a Go archive
 // file, but it has an armap listing symbols and the objects that
 // define them. This is used for the compiler support library
-// libgcc.a.
-func hostArchive(ctxt *Link, name string) {
+// libgcc.a. If all is set, every member of the archive is linked in,
+// whether required or not, and the symbols they define are added to
+// ctxt.wholeArchiveSyms; this is used for -wholearchive.
+func hostArchive(ctxt *Link, name string, all bool) {
 	f, err := bio.Open(name)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if os.IsNotExist(err) && !all {
 			// It's OK if we don't have a libgcc file at all.
 			if ctxt.Debugvlog != 0 {
 				ctxt.Logf("skipping libgcc file: %v\n", err)
@@ -83,12 +89,59 @@ func hostArchive(ctxt *Link, name string) {
 		Exitf("file %s too short", name)
 	}
 
-	if string(magbuf[:]) != ARMAG {
+	var thin *thinArchive
+	switch string(magbuf[:]) {
+	case ARMAG:
+	case THINMAG:
+		thin = openThinArchive(name, f)
+	default:
 		Exitf("%s is not an archive file", name)
 	}
 
+	lib := sym.Library{Pkg: "libgcc"}
+	if all {
+		lib.Pkg = filepath.Base(name)
+	}
+	loadedThin := make(map[string]bool)
+
+	// loadMember links in the archive member named member, whose
+	// header, at off, is arhdr and whose contents of the given size
+	// follow at the current offset of f.
+	loadMember := func(arhdr *ArHdr, member string, off, size int64) {
+		if thin != nil {
+			thin.load(ctxt, arhdr, &lib, loadedThin)
+			return
+		}
+		pname := fmt.Sprintf("%s(%s)", name, member)
+		h := ldobj(ctxt, f, &lib, size, pname, name)
+		if h.lto != "" {
+			Errorf(nil, "%s: %s for link-time optimization cannot be linked internally, use -linkmode=external", pname, h.lto)
+			return
+		}
+		if h.ld == nil {
+			Errorf(nil, "%s unrecognized object file at offset %d", name, off)
+			return
+		}
+		f.MustSeek(h.off, 0)
+		h.ld(ctxt, f, h.pkg, h.length, h.pn)
+	}
+
 	var arhdr ArHdr
-	l := nextar(f, f.Offset(), &arhdr)
+	if all {
+		ldr := ctxt.loader
+		first := loader.Sym(ldr.NSym())
+		hostArchiveMembers(name, f, thin != nil, loadMember)
+		for s := first; s < loader.Sym(ldr.NSym()); s++ {
+			switch ldr.SymType(s) {
+			case sym.Sxxx, sym.SXREF, sym.SDYNIMPORT:
+			default:
+				ctxt.wholeArchiveSyms = append(ctxt.wholeArchiveSyms, s)
+			}
+		}
+		return
+	}
+
+	l := nextar(f, SARMAG, &arhdr)
 	if l <= 0 {
 		Exitf("%s missing armap", name)
 	}
@@ -107,6 +160,10 @@ func hostArchive(ctxt *Link, name string) {
 		returnAllUndefs := -1
 		undefs := ctxt.loader.UndefinedRelocTargets(returnAllUndefs)
 		for _, symIdx := range undefs {
+			if ctxt.loader.AttrWeakUndef(symIdx) {
+				// A weak reference does not pull in a member.
+				continue
+			}
 			name := ctxt.loader.SymName(symIdx)
 			if off := armap[name]; off != 0 && !loaded[off] {
 				load = append(load, off)
@@ -119,20 +176,57 @@ func hostArchive(ctxt *Link, name string) {
 			if l <= 0 {
 				Exitf("%s missing archive entry at offset %d", name, off)
 			}
-			pname := fmt.Sprintf("%s(%s)", name, arhdr.name)
-			l = atolwhex(arhdr.size)
+			loadMember(&arhdr, arhdr.name, int64(off), atolwhex(arhdr.size))
+		}
 
-			libgcc := sym.Library{Pkg: "libgcc"}
-			h := ldobj(ctxt, f, &libgcc, l, pname, name)
-			if h.ld == nil {
-				Errorf(nil, "%s unrecognized object file at offset %d", name, off)
-				continue
+		any = len(load) > 0
+	}
+}
+
+// hostArchiveMembers calls load for each object file member of the
+// archive f, in order. For a thin archive, the members are not stored
+// in f, and load is passed only their headers.
+func hostArchiveMembers(name string, f *bio.Reader, thin bool, load func(arhdr *ArHdr, member string, off, size int64)) {
+	var arhdr ArHdr
+	for off := int64(SARMAG); ; {
+		l := nextar(f, off, &arhdr)
+		if l == 0 {
+			break
+		}
+		if l < 0 {
+			Exitf("%s: malformed archive entry at offset %d", name, off)
+		}
+		hdr := off
+		if thin {
+			off = thinNext(arhdr.name, off, l)
+			if !thinStored(arhdr.name) {
+				load(&arhdr, arhdr.name, hdr, 0)
 			}
-			f.MustSeek(h.off, 0)
-			h.ld(ctxt, f, h.pkg, h.length, h.pn)
+			continue
 		}
+		start := f.Offset()
+		off = start + l - SAR_HDR
+		size := atolwhex(arhdr.size)
 
-		any = len(load) > 0
+		member := arhdr.name
+		switch {
+		case member == "/", member == "/SYM64/", member == "//", strings.HasPrefix(member, "__.SYMDEF"):
+			// Symbol map or GNU long name table.
+			continue
+		case strings.HasPrefix(member, "#1/"):
+			// BSD long name, stored before the member contents.
+			n, err := strconv.Atoi(member[3:])
+			if err != nil || int64(n) > size {
+				Exitf("%s: malformed archive entry at offset %d", name, hdr)
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(f, buf); err != nil {
+				Exitf("%s: short read: %v", name, err)
+			}
+			member = strings.TrimRight(string(buf), "\x00")
+			size -= int64(n)
+		}
+		load(&arhdr, strings.TrimSuffix(member, "/"), hdr, size)
 	}
 }
 
@@ -0,0 +1,74 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/sys"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"internal/buildcfg"
+	"strings"
+)
+
+// Internal linking support for -asan.
+//
+// The C parts of a program built with -asan, including runtime/asan,
+// are compiled with -fsanitize=address and refer to the ASan runtime,
+// which the C compiler links in as a shared library. When linking
+// internally, the linker has to set up the program the way the C
+// compiler driver would:
+//
+//   - the ASan runtime must come first in the list of needed
+//     libraries, or it refuses to start;
+//   - __asan_init must be called from .preinit_array, so that the
+//     runtime is initialized before any shared library constructor
+//     allocates memory.
+//
+// Only a shared ASan runtime is supported. The static one, linked in by
+// GCC's -static-libasan and by Clang by default, is a whole archive of
+// C++ objects, and such programs have to be linked externally.
+
+// asanInternalSupported reports whether -asan programs can be linked
+// internally on the target.
+func asanInternalSupported(arch *sys.Arch) bool {
+	return buildcfg.GOOS == "linux" && arch.Family == sys.AMD64
+}
+
+// isAsanRuntime reports whether lib is a shared ASan runtime, as
+// named by GCC (libasan.so.N) or Clang (libclang_rt.asan-ARCH.so).
+func isAsanRuntime(lib string) bool {
+	return strings.HasPrefix(lib, "libasan.so") || strings.HasPrefix(lib, "libclang_rt.asan")
+}
+
+// asanLibFirst moves the ASan runtime to the front of libs.
+func asanLibFirst(libs []string) []string {
+	for i, lib := range libs {
+		if isAsanRuntime(lib) {
+			copy(libs[1:i+1], libs[:i])
+			libs[0] = lib
+			break
+		}
+	}
+	return libs
+}
+
+// asanPreinit creates the .preinit_array section calling __asan_init
+// and returns its symbol.
+func (ctxt *Link) asanPreinit() loader.Sym {
+	ldr := ctxt.loader
+	init := ldr.Lookup("__asan_init", 0)
+	if init == 0 || ldr.SymType(init) != sym.SDYNIMPORT {
+		Exitf("-asan: __asan_init is not imported from a shared ASan runtime; internal linking does not support a static ASan runtime, link with -linkmode=external")
+	}
+	ldr.SetAttrReachable(init, true)
+
+	s := ldr.CreateSymForUpdate(".preinit_array", 0)
+	s.SetType(sym.SELFSECT)
+	s.SetReachable(true)
+	s.SetAlign(int32(ctxt.Arch.PtrSize))
+	s.AddAddr(ctxt.Arch, init)
+	ldr.SetAttrDynAddr(s.Sym(), true)
+	return s.Sym()
+}
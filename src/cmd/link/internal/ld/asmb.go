@@ -28,6 +28,12 @@ func asmb(ctxt *Link) {
 		Asmbelfsetup()
 	}
 
+	// The relocations are applied in parallel, see writeBlocks. The
+	// unresolved symbols they find are reported together at the end.
+	ctxt.dynimportMain()
+	defer ctxt.ErrorReporter.reportUnresolved(ctxt.loader)
+	defer ctxt.deferErrors()()
+
 	var wg sync.WaitGroup
 	f := func(ctxt *Link, out *OutBuf, start, length int64) {
 		pad := thearch.CodePad
@@ -57,9 +63,22 @@ func asmb(ctxt *Link) {
 
 	writeParallel(&wg, datblk, ctxt, Segdata.Fileoff, Segdata.Vaddr, Segdata.Filelen)
 
-	writeParallel(&wg, dwarfblk, ctxt, Segdwarf.Fileoff, Segdwarf.Vaddr, Segdwarf.Filelen)
+	if !ctxt.compressDWARFLate {
+		writeParallel(&wg, dwarfblk, ctxt, Segdwarf.Fileoff, Segdwarf.Vaddr, Segdwarf.Filelen)
+	}
 
 	wg.Wait()
+
+	if ctxt.compressDWARFLate {
+		writeDWARF(ctxt)
+	}
+}
+
+// streamTail reports whether the part of the output after the
+// allocated image, the DWARF and the symbol table, is streamed to the
+// file, see OutBuf.StreamTail.
+func (ctxt *Link) streamTail() bool {
+	return ctxt.IsELF && ctxt.IsInternal()
 }
 
 // Assembling the binary is broken into two steps:
@@ -204,3 +223,51 @@ func relocSectFn(ctxt *Link, relocSect func(*Link, *OutBuf, *sym.Section, []load
 	}
 	return fn, &wg
 }
+
+// A relocBatch is a run of symbols of a section whose external
+// relocations are converted together.
+type relocBatch struct {
+	syms   []loader.Sym
+	nreloc int // number of relocations of syms
+}
+
+// relocBatchMin is the smallest number of relocations worth
+// converting in a batch of their own.
+const relocBatchMin = 1 << 12
+
+// relocBatches splits syms, the symbols of a section, into batches
+// whose external relocations can be converted in parallel. It returns
+// a single batch if the output is not mmapped, as the relocations are
+// then written sequentially, or if there are too few relocations.
+func relocBatches(ctxt *Link, syms []loader.Sym) []relocBatch {
+	ldr := ctxt.loader
+	n := 0
+	counts := make([]int, len(syms))
+	for i, s := range syms {
+		relocs := ldr.Relocs(s)
+		counts[i] = relocs.Count()
+		n += counts[i]
+	}
+	procs := runtime.GOMAXPROCS(0)
+	if procs == 1 || !ctxt.Out.isMmapped() || n < 2*relocBatchMin {
+		return []relocBatch{{syms, n}}
+	}
+
+	size := n / (4 * procs)
+	if size < relocBatchMin {
+		size = relocBatchMin
+	}
+	var batches []relocBatch
+	start, nreloc := 0, 0
+	for i := range syms {
+		nreloc += counts[i]
+		if nreloc >= size {
+			batches = append(batches, relocBatch{syms[start : i+1], nreloc})
+			start, nreloc = i+1, 0
+		}
+	}
+	if start < len(syms) {
+		batches = append(batches, relocBatch{syms[start:], nreloc})
+	}
+	return batches
+}
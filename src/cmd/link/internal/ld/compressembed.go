@@ -0,0 +1,92 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"compress/flate"
+	"sort"
+)
+
+// With -compress-sections, the contents of the files embedded with
+// //go:embed, which the compiler marks, are written compressed and
+// inflated by the runtime at startup, trading time for file size.
+//
+// The file symbols become the parts of a single zero-filled symbol,
+// go.embed.data, so the program refers to them where they will be
+// inflated and they cost no space in the file. Their contents, in the
+// same order, are compressed as one DEFLATE stream in go.embed.z,
+// which can share the matches between files. The moduledata points
+// at both, and the runtime inflates the data before running the
+// package initializers of the module, see runtime.inflateEmbeds.
+// Only the runtime package runs before, and it embeds nothing.
+
+// compressEmbeds compresses the reachable go:embed file contents.
+func (ctxt *Link) compressEmbeds() {
+	ldr := ctxt.loader
+	var embeds []loader.Sym
+	var size int64
+	for s := loader.Sym(1); s < loader.Sym(ldr.NDef()); s++ {
+		if ldr.AttrReachable(s) && ldr.IsEmbed(s) && ldr.SymSize(s) > 0 {
+			embeds = append(embeds, s)
+			size += ldr.SymSize(s)
+		}
+	}
+	if len(embeds) == 0 {
+		return
+	}
+	// Keep the files of each package, which are the most likely to
+	// be alike, next to each other.
+	sort.SliceStable(embeds, func(i, j int) bool { return ldr.SymPkg(embeds[i]) < ldr.SymPkg(embeds[j]) })
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		Exitf("-compress-sections: %v", err)
+	}
+	for _, s := range embeds {
+		w.Write(ldr.Data(s))
+	}
+	if err := w.Close(); err != nil {
+		Exitf("-compress-sections: %v", err)
+	}
+	if int64(buf.Len()) >= size {
+		if ctxt.Debugvlog != 0 {
+			ctxt.Logf("compress-sections: go:embed data does not compress, leaving %d bytes\n", size)
+		}
+		return
+	}
+
+	z := ldr.CreateSymForUpdate("go.embed.z", 0)
+	z.SetType(sym.SRODATA)
+	z.SetLocal(true)
+	z.SetReachable(true)
+	z.AddBytes(buf.Bytes())
+	ctxt.embedz = z.Sym()
+
+	data := ldr.CreateSymForUpdate("go.embed.data", 0)
+	data.SetType(sym.SNOPTRBSS)
+	data.SetLocal(true)
+	data.SetReachable(true)
+	data.SetSize(size)
+	ctxt.embeds = data.Sym()
+
+	var off int64
+	for _, s := range embeds {
+		su := ldr.MakeSymbolUpdater(s)
+		n := su.Size()
+		su.SetData(nil)
+		su.SetSize(n)
+		su.SetType(sym.SNOPTRBSS)
+		su.SetValue(off)
+		data.AddInteriorSym(s)
+		off += n
+	}
+	if ctxt.Debugvlog != 0 {
+		ctxt.Logf("compress-sections: %d go:embed files, %d bytes compressed to %d\n", len(embeds), size, buf.Len())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"cmd/internal/sys"
 	"fmt"
 	"internal/buildcfg"
+	"strings"
 )
 
 // A BuildMode indicates the sort of object we are building.
@@ -174,6 +175,328 @@ func (mode *LinkMode) String() string {
 	return fmt.Sprintf("LinkMode(%d)", uint8(*mode))
 }
 
+// An outputOption is an option that the output cannot honor with every
+// build mode or on every target.
+type outputOption uint8
+
+const (
+	optInternal      outputOption = iota // -linkmode=internal
+	optExternal                          // -linkmode=external
+	optTextAddr                          // -T
+	optStatic                            // -d
+	optWindowsGUI                        // -H windowsgui
+	optLinkShared                        // -linkshared
+	optSoname                            // -soname
+	optExportSymbols                     // -exportsymbols
+	optExportDynamic                     // -exportdynamic
+	optPluginHost                        // -pluginhost
+	optInterp                            // -I, -interp
+	numOutputOptions
+)
+
+var outputOptionNames = [numOutputOptions]string{
+	optInternal:      "-linkmode=internal",
+	optExternal:      "-linkmode=external",
+	optTextAddr:      "-T",
+	optStatic:        "-d",
+	optWindowsGUI:    "-H windowsgui",
+	optLinkShared:    "-linkshared",
+	optSoname:        "-soname",
+	optExportSymbols: "-exportsymbols",
+	optExportDynamic: "-exportdynamic",
+	optPluginHost:    "-pluginhost",
+	optInterp:        "-interp",
+}
+
+// An optionRule returns why an option cannot be used on the target
+// goos/goarch, or "" if it can.
+type optionRule func(goos, goarch string) string
+
+func supported(goos, goarch string) string { return "" }
+
+func unsupported(why string) optionRule {
+	return func(goos, goarch string) string { return why }
+}
+
+// internalExe reports whether executables can be linked internally.
+func internalExe(goos, goarch string) string {
+	if sys.MustLinkExternal(goos, goarch) {
+		return goos + "/" + goarch + " requires external linking"
+	}
+	return ""
+}
+
+// internalPIE reports whether position-independent executables can be
+// linked internally.
+func internalPIE(goos, goarch string) string {
+	switch goos + "/" + goarch {
+	case "linux/amd64", "linux/arm64", "linux/riscv64", "android/arm64":
+	case "windows/386", "windows/amd64", "windows/arm", "windows/arm64":
+	case "darwin/amd64", "darwin/arm64":
+	default:
+		// Internal linking does not support TLS_IE.
+		return "the internal linker cannot link position-independent executables for " + goos + "/" + goarch
+	}
+	return internalExe(goos, goarch)
+}
+
+// elfSoname reports whether shared libraries record the name set by
+// -soname.
+func elfSoname(goos, goarch string) string {
+	switch goos {
+	case "aix", "darwin", "ios", "js", "plan9", "windows":
+		return "only ELF shared libraries have a DT_SONAME"
+	}
+	return ""
+}
+
+// elfVersionScript reports whether the external linker limits the
+// exports with a version script, for -exportsymbols.
+func elfVersionScript(goos, goarch string) string {
+	switch goos {
+	case "aix", "darwin", "ios", "js", "plan9", "windows":
+		return "only ELF shared libraries can limit their exports"
+	}
+	return ""
+}
+
+// elfExeExports reports whether executables have dynamic symbols the
+// libraries they open can use, for -exportdynamic and -exportsymbols.
+func elfExeExports(goos, goarch string) string {
+	switch goos {
+	case "aix", "darwin", "ios", "js", "plan9", "windows":
+		return "only ELF executables export symbols to the libraries they open"
+	}
+	return ""
+}
+
+// elfPluginHost reports whether plugins can leave type descriptors to
+// the dynamic symbols of the program, for -pluginhost.
+func elfPluginHost(goos, goarch string) string {
+	switch goos {
+	case "aix", "darwin", "ios", "js", "plan9", "windows":
+		return "only ELF plugins can use the type descriptors of the program"
+	}
+	return ""
+}
+
+// elfInterp reports whether executables have an ELF program
+// interpreter, for -interp.
+func elfInterp(goos, goarch string) string {
+	switch goos {
+	case "aix", "darwin", "ios", "js", "plan9", "windows":
+		return "only ELF executables have a program interpreter"
+	}
+	return ""
+}
+
+// external reports whether the output can be linked externally.
+func external(goos, goarch string) string {
+	if goarch == "ppc64" && goos != "aix" {
+		return "external linking is not supported for " + goos + "/ppc64"
+	}
+	return ""
+}
+
+// buildModeOptions classifies every output option for every build mode.
+// The build modes that cmd/go does not support on a target are rejected
+// by BuildMode.Set, the others are checked against this table before the
+// link starts, see checkOptions. Adding a build mode or an option means
+// classifying all its combinations, which TestBuildModeOptions checks.
+var buildModeOptions = map[BuildMode][numOutputOptions]optionRule{
+	BuildModeExe: {
+		optInternal:      internalExe,
+		optExternal:      external,
+		optTextAddr:      supported,
+		optStatic:        supported,
+		optWindowsGUI:    supported,
+		optLinkShared:    supported,
+		optSoname:        unsupported("executables are not loaded by name"),
+		optExportSymbols: elfExeExports,
+		optExportDynamic: elfExeExports,
+		optPluginHost:    unsupported("only plugins are opened by another program"),
+		optInterp:        elfInterp,
+	},
+	BuildModePIE: {
+		optInternal:      internalPIE,
+		optExternal:      external,
+		optTextAddr:      unsupported("position-independent executables are loaded at an address chosen at run time"),
+		optStatic:        unsupported("position-independent executables are relocated by the dynamic linker"),
+		optWindowsGUI:    supported,
+		optLinkShared:    supported,
+		optSoname:        unsupported("executables are not loaded by name"),
+		optExportSymbols: elfExeExports,
+		optExportDynamic: elfExeExports,
+		optPluginHost:    unsupported("only plugins are opened by another program"),
+		optInterp:        elfInterp,
+	},
+	BuildModeCArchive: {
+		optInternal:      unsupported("archives are written by the external archiver"),
+		optExternal:      external,
+		optTextAddr:      unsupported("the program the archive is linked into sets the addresses"),
+		optStatic:        unsupported("the program the archive is linked into decides how it is linked"),
+		optWindowsGUI:    unsupported("the program the archive is linked into sets the subsystem"),
+		optLinkShared:    unsupported("archives cannot depend on Go shared libraries"),
+		optSoname:        unsupported("the program the archive is linked into sets its own name"),
+		optExportSymbols: unsupported("the program the archive is linked into decides what it exports"),
+		optExportDynamic: unsupported("the program the archive is linked into decides what it exports"),
+		optPluginHost:    unsupported("only plugins are opened by another program"),
+		optInterp:        unsupported("the program the archive is linked into sets the interpreter"),
+	},
+	BuildModeCShared: {
+		optInternal:      unsupported("the internal linker cannot link C shared libraries"),
+		optExternal:      external,
+		optTextAddr:      unsupported("shared libraries are loaded at an address chosen at run time"),
+		optStatic:        unsupported("shared libraries are loaded by the dynamic linker"),
+		optWindowsGUI:    unsupported("DLLs run in the subsystem of the program that loads them"),
+		optLinkShared:    unsupported("C shared libraries cannot depend on Go shared libraries"),
+		optSoname:        elfSoname,
+		optExportSymbols: elfVersionScript,
+		optExportDynamic: unsupported("shared libraries export their global symbols anyway"),
+		optPluginHost:    unsupported("only plugins are opened by another program"),
+		optInterp:        unsupported("shared libraries are loaded by the interpreter of the program"),
+	},
+	BuildModeShared: {
+		optInternal:      unsupported("the internal linker cannot link Go shared libraries"),
+		optExternal:      external,
+		optTextAddr:      unsupported("shared libraries are loaded at an address chosen at run time"),
+		optStatic:        unsupported("shared libraries are loaded by the dynamic linker"),
+		optWindowsGUI:    unsupported("shared libraries run in the subsystem of the program that loads them"),
+		optLinkShared:    supported,
+		optSoname:        elfSoname,
+		optExportSymbols: unsupported("Go shared libraries export every Go symbol to the programs linked against them"),
+		optExportDynamic: unsupported("shared libraries export their global symbols anyway"),
+		optPluginHost:    unsupported("Go shared libraries are used by the programs linked against them"),
+		optInterp:        unsupported("shared libraries are loaded by the interpreter of the program"),
+	},
+	BuildModePlugin: {
+		optInternal:      unsupported("the internal linker cannot link plugins"),
+		optExternal:      external,
+		optTextAddr:      unsupported("plugins are loaded at an address chosen at run time"),
+		optStatic:        unsupported("plugins are loaded by the dynamic linker"),
+		optWindowsGUI:    unsupported("plugins run in the subsystem of the program that loads them"),
+		optLinkShared:    supported,
+		optSoname:        unsupported("plugins are opened by path, not by name"),
+		optExportSymbols: unsupported("plugins export every Go symbol to the program that opens them"),
+		optExportDynamic: unsupported("plugins export their global symbols anyway"),
+		optPluginHost:    elfPluginHost,
+		optInterp:        unsupported("plugins are loaded by the interpreter of the program"),
+	},
+}
+
+// optionConflicts returns an error message for each of the options opts
+// that the build mode cannot honor on the target goos/goarch, with the
+// build modes that can.
+func optionConflicts(mode BuildMode, opts []outputOption, goos, goarch string) []string {
+	var conflicts []string
+	for _, opt := range opts {
+		why := buildModeOptions[mode][opt](goos, goarch)
+		if why == "" {
+			continue
+		}
+		var alts []string
+		for m := BuildModeExe; m <= BuildModePlugin; m++ {
+			if buildModeOptions[m][opt](goos, goarch) == "" {
+				alts = append(alts, m.String())
+			}
+		}
+		msg := fmt.Sprintf("-buildmode=%s cannot be used with %s: %s", mode.String(), outputOptionNames[opt], why)
+		if alts != nil {
+			msg += fmt.Sprintf(" (%s can be used with -buildmode=%s)", outputOptionNames[opt], strings.Join(alts, ", "))
+		}
+		conflicts = append(conflicts, msg)
+	}
+	return conflicts
+}
+
+// checkOptions fails the link if the output cannot honor the options
+// given with its build mode on the target.
+func checkOptions(ctxt *Link) {
+	var opts []outputOption
+	switch ctxt.LinkMode {
+	case LinkInternal:
+		opts = append(opts, optInternal)
+	case LinkExternal:
+		opts = append(opts, optExternal)
+	}
+	if *FlagTextAddr != -1 {
+		opts = append(opts, optTextAddr)
+	}
+	if *FlagD {
+		opts = append(opts, optStatic)
+	}
+	if windowsgui {
+		opts = append(opts, optWindowsGUI)
+	}
+	if ctxt.linkShared {
+		opts = append(opts, optLinkShared)
+	}
+	if *flagSoname != "" {
+		opts = append(opts, optSoname)
+	}
+	if *flagExportSymbols != "" {
+		opts = append(opts, optExportSymbols)
+	}
+	if *flagExportDynamic {
+		opts = append(opts, optExportDynamic)
+	}
+	if *flagPluginHost != "" {
+		opts = append(opts, optPluginHost)
+	}
+	if *flagInterpreter != "" {
+		opts = append(opts, optInterp)
+	}
+	conflicts := optionConflicts(ctxt.BuildMode, opts, buildcfg.GOOS, buildcfg.GOARCH)
+	if ctxt.linkShared && ctxt.LinkMode == LinkInternal {
+		conflicts = append(conflicts, "-linkshared cannot be used with -linkmode=internal: the internal linker cannot link against Go shared libraries")
+	}
+	if *flagExportDynamic && *FlagD {
+		conflicts = append(conflicts, "-exportdynamic cannot be used with -d: a static executable has no dynamic symbols")
+	}
+	if conflicts != nil {
+		Exitf("conflicting options:\n\t%s", strings.Join(conflicts, "\n\t"))
+	}
+}
+
+// dwarfCompression is how the DWARF sections are compressed.
+type dwarfCompression uint8
+
+const (
+	dwarfCompressNone dwarfCompression = iota
+	dwarfCompressZlib
+	dwarfCompressZstd
+)
+
+func (c *dwarfCompression) Set(s string) error {
+	switch s {
+	default:
+		return fmt.Errorf("invalid compressdwarf: %q", s)
+	case "none", "false":
+		*c = dwarfCompressNone
+	case "zlib", "true":
+		*c = dwarfCompressZlib
+	case "zstd":
+		*c = dwarfCompressZstd
+	}
+	return nil
+}
+
+func (c *dwarfCompression) String() string {
+	switch *c {
+	case dwarfCompressNone:
+		return "none"
+	case dwarfCompressZlib:
+		return "zlib"
+	case dwarfCompressZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("dwarfCompression(%d)", uint8(*c))
+}
+
+// IsBoolFlag makes -compressdwarf alone mean zlib, as it meant when
+// it was a boolean flag, and -compressdwarf=false mean none.
+func (c *dwarfCompression) IsBoolFlag() bool { return true }
+
 // mustLinkExternal reports whether the program being linked requires
 // the external linker be used to complete the link.
 func mustLinkExternal(ctxt *Link) (res bool, reason string) {
@@ -193,13 +516,13 @@ func mustLinkExternal(ctxt *Link) (res bool, reason string) {
 		return true, "msan"
 	}
 
-	if *flagAsan {
+	if *flagAsan && !asanInternalSupported(ctxt.Arch) {
 		return true, "asan"
 	}
 
 	// Internally linking cgo is incomplete on some architectures.
 	// https://golang.org/issue/14449
-	if iscgo && ctxt.Arch.InFamily(sys.MIPS64, sys.MIPS, sys.RISCV64) {
+	if iscgo && ctxt.Arch.InFamily(sys.MIPS64, sys.MIPS) {
 		return true, buildcfg.GOARCH + " does not support internal cgo"
 	}
 	if iscgo && (buildcfg.GOOS == "android" || buildcfg.GOOS == "dragonfly") {
@@ -218,29 +541,16 @@ func mustLinkExternal(ctxt *Link) (res bool, reason string) {
 	}
 
 	// Some build modes require work the internal linker cannot do (yet).
-	switch ctxt.BuildMode {
-	case BuildModeCArchive:
-		return true, "buildmode=c-archive"
-	case BuildModeCShared:
-		return true, "buildmode=c-shared"
-	case BuildModePIE:
-		switch buildcfg.GOOS + "/" + buildcfg.GOARCH {
-		case "linux/amd64", "linux/arm64", "android/arm64":
-		case "windows/386", "windows/amd64", "windows/arm", "windows/arm64":
-		case "darwin/amd64", "darwin/arm64":
-		default:
-			// Internal linking does not support TLS_IE.
-			return true, "buildmode=pie"
-		}
-	case BuildModePlugin:
-		return true, "buildmode=plugin"
-	case BuildModeShared:
-		return true, "buildmode=shared"
+	if buildModeOptions[ctxt.BuildMode][optInternal](buildcfg.GOOS, buildcfg.GOARCH) != "" {
+		return true, "buildmode=" + ctxt.BuildMode.String()
 	}
 	if ctxt.linkShared {
 		return true, "dynamically linking with a shared library"
 	}
 
+	if ltoObj != "" {
+		return true, fmt.Sprintf("%s holds %s for link-time optimization, which only the external linker can link", ltoObj, ltoKind)
+	}
 	if unknownObjFormat {
 		return true, "some input objects have an unrecognized file format"
 	}
@@ -248,32 +558,47 @@ func mustLinkExternal(ctxt *Link) (res bool, reason string) {
 	return false, ""
 }
 
-// determineLinkMode sets ctxt.LinkMode.
+// determineLinkMode sets ctxt.LinkMode, and ctxt.linkModeReason.
 //
 // It is called after flags are processed and inputs are processed,
 // so the ctxt.LinkMode variable has an initial value from the -linkmode
-// flag and the iscgo, externalobj, and unknownObjFormat variables are set.
+// flag and the iscgo, externalobj, unknownObjFormat and ltoObj variables
+// are set.
 func determineLinkMode(ctxt *Link) {
 	extNeeded, extReason := mustLinkExternal(ctxt)
 	via := ""
 
+	ctxt.linkModeReason = "-linkmode"
 	if ctxt.LinkMode == LinkAuto {
 		// The environment variable GO_EXTLINK_ENABLED controls the
 		// default value of -linkmode. If it is not set when the
 		// linker is called we take the value it was set to when
 		// cmd/link was compiled. (See make.bash.)
-		switch buildcfg.Getgoextlinkenabled() {
+		switch v := buildcfg.Getgoextlinkenabled(); v {
 		case "0":
 			ctxt.LinkMode = LinkInternal
 			via = "via GO_EXTLINK_ENABLED "
+			ctxt.linkModeReason = "GO_EXTLINK_ENABLED=" + v
 		case "1":
 			ctxt.LinkMode = LinkExternal
 			via = "via GO_EXTLINK_ENABLED "
+			ctxt.linkModeReason = "GO_EXTLINK_ENABLED=" + v
 		default:
-			if extNeeded || (iscgo && externalobj) {
+			// Programs built with -asan can be linked internally
+			// on some targets, but that is only done on request.
+			switch {
+			case extNeeded:
+				ctxt.LinkMode = LinkExternal
+				ctxt.linkModeReason = extReason
+			case iscgo && externalobj:
 				ctxt.LinkMode = LinkExternal
-			} else {
+				ctxt.linkModeReason = "cgo with host objects of packages outside the standard library"
+			case *flagAsan:
+				ctxt.LinkMode = LinkExternal
+				ctxt.linkModeReason = "asan"
+			default:
 				ctxt.LinkMode = LinkInternal
+				ctxt.linkModeReason = "default"
 			}
 		}
 	}
@@ -290,3 +615,51 @@ func determineLinkMode(ctxt *Link) {
 		}
 	}
 }
+
+// A stripMode is a set of the parts of the output that -strip leaves out.
+type stripMode uint8
+
+const (
+	stripSections stripMode = 1 << iota // the section header table and the sections not loaded
+	stripSymtab                         // the symbol table
+	stripLocals                         // the generated local symbols of the symbol table
+	stripDWARF                          // the DWARF sections
+)
+
+var stripModeNames = []struct {
+	name string
+	mode stripMode
+}{
+	{"sections", stripSections},
+	{"symtab", stripSymtab},
+	{"locals", stripLocals},
+	{"dwarf", stripDWARF},
+}
+
+// Set adds the comma-separated parts in s to m, so that -strip can be
+// repeated.
+func (m *stripMode) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for _, n := range stripModeNames {
+			if n.name == name {
+				*m |= n.mode
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid strip: %q", name)
+		}
+	}
+	return nil
+}
+
+func (m *stripMode) String() string {
+	var names []string
+	for _, n := range stripModeNames {
+		if *m&n.mode != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBuildModeOptions checks that every output option is classified for
+// every build mode.
+func TestBuildModeOptions(t *testing.T) {
+	for mode := BuildModeExe; !strings.HasPrefix(mode.String(), "BuildMode("); mode++ {
+		rules, ok := buildModeOptions[mode]
+		if !ok {
+			t.Errorf("-buildmode=%s: options not classified", mode.String())
+			continue
+		}
+		for opt := outputOption(0); opt < numOutputOptions; opt++ {
+			if outputOptionNames[opt] == "" {
+				t.Errorf("option %d has no name", opt)
+			}
+			if rules[opt] == nil {
+				t.Errorf("-buildmode=%s: %s not classified", mode.String(), outputOptionNames[opt])
+			}
+		}
+	}
+}
+
+func TestOptionConflicts(t *testing.T) {
+	tests := []struct {
+		mode         BuildMode
+		opts         []outputOption
+		goos, goarch string
+		want         []string // substrings of each conflict, in order
+	}{
+		{BuildModeExe, []outputOption{optInternal, optTextAddr, optStatic}, "linux", "amd64", nil},
+		{BuildModePIE, []outputOption{optInternal}, "linux", "amd64", nil},
+		{BuildModePIE, []outputOption{optInternal}, "linux", "386", []string{"-buildmode=pie cannot be used with -linkmode=internal"}},
+		{BuildModePIE, []outputOption{optTextAddr, optStatic}, "linux", "amd64", []string{
+			"-buildmode=pie cannot be used with -T: ",
+			"-buildmode=pie cannot be used with -d: ",
+		}},
+		{BuildModeCShared, []outputOption{optInternal}, "linux", "amd64", []string{"(-linkmode=internal can be used with -buildmode=exe, pie)"}},
+		{BuildModeCArchive, []outputOption{optLinkShared}, "linux", "amd64", []string{"(-linkshared can be used with -buildmode=exe, pie, shared, plugin)"}},
+		{BuildModeExe, []outputOption{optExternal}, "linux", "ppc64", []string{"external linking is not supported for linux/ppc64"}},
+		{BuildModeCShared, []outputOption{optSoname}, "linux", "amd64", nil},
+		{BuildModeCShared, []outputOption{optSoname}, "darwin", "arm64", []string{"only ELF shared libraries have a DT_SONAME"}},
+		{BuildModePIE, []outputOption{optSoname}, "linux", "amd64", []string{"(-soname can be used with -buildmode=c-shared, shared)"}},
+		{BuildModeCShared, []outputOption{optExportSymbols}, "linux", "arm64", nil},
+		{BuildModeCShared, []outputOption{optExportSymbols}, "windows", "amd64", []string{"only ELF shared libraries can limit their exports"}},
+		{BuildModePlugin, []outputOption{optExportSymbols}, "linux", "amd64", []string{"(-exportsymbols can be used with -buildmode=exe, pie, c-shared)"}},
+		{BuildModePIE, []outputOption{optExportSymbols, optExportDynamic}, "linux", "amd64", nil},
+		{BuildModeExe, []outputOption{optExportDynamic}, "windows", "amd64", []string{"only ELF executables export symbols to the libraries they open"}},
+		{BuildModeCShared, []outputOption{optExportDynamic}, "linux", "amd64", []string{"(-exportdynamic can be used with -buildmode=exe, pie)"}},
+		{BuildModePlugin, []outputOption{optPluginHost}, "linux", "amd64", nil},
+		{BuildModePlugin, []outputOption{optPluginHost}, "darwin", "amd64", []string{"only ELF plugins can use the type descriptors of the program"}},
+		{BuildModeExe, []outputOption{optPluginHost}, "linux", "amd64", []string{"(-pluginhost can be used with -buildmode=plugin)"}},
+		{BuildModePIE, []outputOption{optInterp}, "linux", "arm64", nil},
+		{BuildModeExe, []outputOption{optInterp}, "windows", "amd64", []string{"only ELF executables have a program interpreter"}},
+		{BuildModeCShared, []outputOption{optInterp}, "linux", "amd64", []string{"(-interp can be used with -buildmode=exe, pie)"}},
+		{BuildModeExe, []outputOption{optInternal}, "ios", "arm64", []string{"ios/arm64 requires external linking"}},
+	}
+	for _, test := range tests {
+		got := optionConflicts(test.mode, test.opts, test.goos, test.goarch)
+		if len(got) != len(test.want) {
+			t.Errorf("optionConflicts(%s, %v, %s/%s) = %q, want %d conflicts", test.mode.String(), test.opts, test.goos, test.goarch, got, len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("optionConflicts(%s, %v, %s/%s)[%d] = %q, want it to contain %q", test.mode.String(), test.opts, test.goos, test.goarch, i, got[i], want)
+			}
+		}
+	}
+}
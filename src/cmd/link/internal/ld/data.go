@@ -42,6 +42,8 @@ import (
 	"debug/elf"
 	"encoding/binary"
 	"fmt"
+	"internal/zstd"
+	"io"
 	"log"
 	"os"
 	"sort"
@@ -83,13 +85,20 @@ func maxSizeTrampolines(ctxt *Link, ldr *loader.Loader, s loader.Sym, isTramp bo
 		}
 	}
 
-	if ctxt.IsPPC64() {
-		return n * 16 // Trampolines in PPC64 are 4 instructions.
+	var size int64
+	switch {
+	case ctxt.IsPPC64():
+		size = 16 // Trampolines in PPC64 are 4 instructions.
+	case ctxt.IsARM64():
+		size = 12 // Trampolines in ARM64 are 3 instructions.
+	default:
+		panic("unreachable")
 	}
-	if ctxt.IsARM64() {
-		return n * 12 // Trampolines in ARM64 are 3 instructions.
+	if *flagFuncAlign != 0 {
+		// Each trampoline is padded to the function alignment.
+		size = Rnd(size, int64(Funcalign))
 	}
-	panic("unreachable")
+	return n * uint64(size)
 }
 
 // Detect too-far jumps in function s, and add trampolines if necessary.
@@ -133,7 +142,7 @@ func trampoline(ctxt *Link, s loader.Sym) {
 }
 
 // whether rt is a (host object) relocation that will be turned into
-// a call to PLT.
+// a call to PLT, or a direct call.
 func isPLTCall(rt objabi.RelocType) bool {
 	const pcrel = 1
 	switch rt {
@@ -148,6 +157,10 @@ func isPLTCall(rt objabi.RelocType) bool {
 		objabi.ElfRelocOffset + objabi.RelocType(elf.R_ARM_PC24),
 		objabi.ElfRelocOffset + objabi.RelocType(elf.R_ARM_JUMP24):
 		return true
+
+	// RISCV64
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_JAL):
+		return true
 	}
 	// TODO: other architectures.
 	return false
@@ -166,6 +179,19 @@ func FoldSubSymbolOffset(ldr *loader.Loader, s loader.Sym) (loader.Sym, int64) {
 	return s, off
 }
 
+// TLSSymOffset returns the offset of the thread-local symbol s from
+// the start of the TLS block. The variables with initial values in
+// .tdata have addresses, which the block starts with; the others are
+// laid out at their offsets in the block.
+func TLSSymOffset(ldr *loader.Loader, s loader.Sym) int64 {
+	v := ldr.SymValue(s)
+	if ldr.SymType(s) == sym.STLSDATA {
+		outer, _ := FoldSubSymbolOffset(ldr, s)
+		v -= int64(ldr.SymSect(outer).Vaddr)
+	}
+	return v
+}
+
 // relocsym resolve relocations in "s", updating the symbol's content
 // in "P".
 // The main loop walks through the list of relocations attached to "s"
@@ -217,12 +243,10 @@ func (st *relocSymState) relocsym(s loader.Sym, P []byte) {
 
 		if rs != 0 && ((rst == sym.Sxxx && !ldr.AttrVisibilityHidden(rs)) || rst == sym.SXREF) {
 			// When putting the runtime but not main into a shared library
-			// these symbols are undefined and that's OK.
+			// these symbols are undefined and that's OK. main.main and
+			// main..inittask are made SDYNIMPORT by dynimportMain.
 			if target.IsShared() || target.IsPlugin() {
-				if ldr.SymName(rs) == "main.main" || (!target.IsPlugin() && ldr.SymName(rs) == "main..inittask") {
-					sb := ldr.MakeSymbolUpdater(rs)
-					sb.SetType(sym.SDYNIMPORT)
-				} else if strings.HasPrefix(ldr.SymName(rs), "go.info.") {
+				if strings.HasPrefix(ldr.SymName(rs), "go.info.") {
 					// Skip go.info symbols. They are only needed to communicate
 					// DWARF info between the compiler and linker.
 					continue
@@ -309,6 +333,11 @@ func (st *relocSymState) relocsym(s loader.Sym, P []byte) {
 				o = 8 + ldr.SymValue(rs)
 			} else if target.IsElf() || target.IsPlan9() || target.IsDarwin() {
 				o = int64(syms.Tlsoffset) + r.Add()
+				if target.IsElf() && rs != 0 && rs != syms.Tlsg && ldr.IsExternal(rs) {
+					// A thread-local variable of a host object,
+					// which is placed before runtime.tlsg.
+					o += TLSSymOffset(ldr, rs) - TLSSymOffset(ldr, syms.Tlsg)
+				}
 			} else if target.IsWindows() {
 				o = r.Add()
 			} else {
@@ -436,6 +465,13 @@ func (st *relocSymState) relocsym(s loader.Sym, P []byte) {
 			if weak && !ldr.AttrReachable(rs) {
 				continue
 			}
+			if rst == sym.SDYNIMPORT {
+				// A type the plugin leaves to the program, see typeimport.go.
+				if off, ok := st.typeImports.typeImportOff(ldr, rs); ok {
+					o = off + r.Add()
+					break
+				}
+			}
 			if ldr.SymSect(rs) == nil {
 				st.err.Errorf(s, "unreachable sym in relocation: %s", ldr.SymName(rs))
 				continue
@@ -472,7 +508,9 @@ func (st *relocSymState) relocsym(s loader.Sym, P []byte) {
 				o = 0
 				break
 			}
-			if target.IsExternal() && rs != 0 && (ldr.SymSect(rs) != ldr.SymSect(s) || rt == objabi.R_GOTPCREL) {
+			// With -emitreloc, the relocations within a section
+			// are kept in the output too, by the external linker.
+			if target.IsExternal() && rs != 0 && (ldr.SymSect(rs) != ldr.SymSect(s) || rt == objabi.R_GOTPCREL || *flagEmitReloc) {
 				nExtReloc++
 
 				// set up addend for eventual relocation via outer symbol.
@@ -665,7 +703,7 @@ func extreloc(ctxt *Link, ldr *loader.Loader, s loader.Sym, r loader.Reloc) (loa
 			rr.Xsym = rs
 			break
 		}
-		if rs != 0 && (ldr.SymSect(rs) != ldr.SymSect(s) || rt == objabi.R_GOTPCREL) {
+		if rs != 0 && (ldr.SymSect(rs) != ldr.SymSect(s) || rt == objabi.R_GOTPCREL || *flagEmitReloc) {
 			// set up addend for eventual relocation via outer symbol.
 			rs := rs
 			rs, off := FoldSubSymbolOffset(ldr, rs)
@@ -725,10 +763,11 @@ func ExtrelocViaOuterSym(ldr *loader.Loader, r loader.Reloc, s loader.Sym) loade
 // to relocsym happen in parallel; the assumption is that each
 // parallel thread will have its own state object.
 type relocSymState struct {
-	target *Target
-	ldr    *loader.Loader
-	err    *ErrorReporter
-	syms   *ArchSyms
+	target      *Target
+	ldr         *loader.Loader
+	err         *ErrorReporter
+	syms        *ArchSyms
+	typeImports *typeImports
 }
 
 // makeRelocSymState creates a relocSymState container object to
@@ -736,10 +775,38 @@ type relocSymState struct {
 // each parallel thread should have its own state object.
 func (ctxt *Link) makeRelocSymState() *relocSymState {
 	return &relocSymState{
-		target: &ctxt.Target,
-		ldr:    ctxt.loader,
-		err:    &ctxt.ErrorReporter,
-		syms:   &ctxt.ArchSyms,
+		target:      &ctxt.Target,
+		ldr:         ctxt.loader,
+		err:         &ctxt.ErrorReporter,
+		syms:        &ctxt.ArchSyms,
+		typeImports: &ctxt.typeImports,
+	}
+}
+
+// dynimportMain makes main.main, and main..inittask unless building a
+// plugin, SDYNIMPORT if they are referenced but undefined, as they are
+// when putting the runtime but not main into a shared library. It is
+// done before the relocations are applied, as relocsym runs in
+// parallel.
+func (ctxt *Link) dynimportMain() {
+	if !ctxt.IsShared() && !ctxt.IsPlugin() {
+		return
+	}
+	ldr := ctxt.loader
+	names := []string{"main.main"}
+	if !ctxt.IsPlugin() {
+		names = append(names, "main..inittask")
+	}
+	for _, name := range names {
+		for _, v := range []int{0, abiInternalVer} {
+			s := ldr.Lookup(name, v)
+			if s == 0 || !ldr.AttrReachable(s) {
+				continue
+			}
+			if t := ldr.SymType(s); (t == sym.Sxxx && !ldr.AttrVisibilityHidden(s)) || t == sym.SXREF {
+				ldr.MakeSymbolUpdater(s).SetType(sym.SDYNIMPORT)
+			}
+		}
 	}
 }
 
@@ -821,9 +888,7 @@ func (ctxt *Link) windynrelocsyms() {
 }
 
 func dynrelocsym(ctxt *Link, s loader.Sym) {
-	target := &ctxt.Target
 	ldr := ctxt.loader
-	syms := &ctxt.ArchSyms
 	relocs := ldr.Relocs(s)
 	for ri := 0; ri < relocs.Count(); ri++ {
 		r := relocs.At(ri)
@@ -838,7 +903,7 @@ func dynrelocsym(ctxt *Link, s loader.Sym) {
 			// It's expected that some relocations will be done
 			// later by relocsym (R_TLS_LE, R_ADDROFF), so
 			// don't worry if Adddynrel returns false.
-			thearch.Adddynrel(target, ldr, syms, s, r, ri)
+			ctxt.adddynrel(s, r, ri)
 			continue
 		}
 
@@ -846,20 +911,42 @@ func dynrelocsym(ctxt *Link, s loader.Sym) {
 			if rSym != 0 && !ldr.AttrReachable(rSym) {
 				ctxt.Errorf(s, "dynamic relocation to unreachable symbol %s", ldr.SymName(rSym))
 			}
-			if !thearch.Adddynrel(target, ldr, syms, s, r, ri) {
+			if !ctxt.adddynrel(s, r, ri) {
 				ctxt.Errorf(s, "unsupported dynamic relocation for symbol %s (type=%d (%s) stype=%d (%s))", ldr.SymName(rSym), r.Type(), sym.RelocName(ctxt.Arch, r.Type()), ldr.SymType(rSym), ldr.SymType(rSym))
 			}
 		}
 	}
 }
 
+// checkIFuncs reports the indirect functions (STT_GNU_IFUNC) of host
+// objects that the output cannot call. Their resolvers are called by
+// the dynamic linker, through IRELATIVE relocations, so a program
+// without one, linked with -d, cannot use them.
+func (ctxt *Link) checkIFuncs() {
+	ldr := ctxt.loader
+	for _, s := range ldr.IFuncSyms() {
+		if !ldr.AttrReachable(s) {
+			continue
+		}
+		switch {
+		case !ctxt.IsAMD64():
+			ctxt.Errorf(s, "indirect functions (STT_GNU_IFUNC) are only supported on amd64 when linking internally, use -linkmode=external")
+		case *FlagD, *flagStaticPIE:
+			ctxt.Errorf(s, "indirect function (STT_GNU_IFUNC) needs a dynamic linker to call its resolver, use -linkmode=external or a dynamic executable")
+		}
+	}
+}
+
 func (state *dodataState) dynreloc(ctxt *Link) {
 	if ctxt.HeadType == objabi.Hwindows {
 		return
 	}
+	ctxt.checkIFuncs()
 	// -d suppresses dynamic loader format, so we may as well not
 	// compute these sections or mark their symbols as reachable.
-	if *FlagD {
+	// When linking internally, the relocations of the host objects
+	// still need adddynrel to turn them into ones relocsym applies.
+	if *FlagD && ctxt.IsExternal() {
 		return
 	}
 
@@ -871,7 +958,7 @@ func (state *dodataState) dynreloc(ctxt *Link) {
 			dynrelocsym(ctxt, s)
 		}
 	}
-	if ctxt.IsELF {
+	if ctxt.IsELF && !*FlagD {
 		elfdynhash(ctxt)
 	}
 }
@@ -1073,8 +1160,9 @@ func dwarfblk(ctxt *Link, out *OutBuf, addr int64, size int64) {
 var zeros [512]byte
 
 var (
-	strdata  = make(map[string]string)
-	strnames []string
+	strdata    = make(map[string]string)
+	strnames   []string
+	strdataSet = make(map[string]bool) // the strnames that were set, for -metadata
 )
 
 func addstrdata1(ctxt *Link, arg string) {
@@ -1096,20 +1184,21 @@ func addstrdata1(ctxt *Link, arg string) {
 	strdata[name] = value
 }
 
-// addstrdata sets the initial value of the string variable name to value.
-func addstrdata(arch *sys.Arch, l *loader.Loader, name, value string) {
+// addstrdata sets the initial value of the string variable name to value,
+// and reports whether it did.
+func addstrdata(arch *sys.Arch, l *loader.Loader, name, value string) bool {
 	s := l.Lookup(name, 0)
 	if s == 0 {
-		return
+		return false
 	}
 	if goType := l.SymGoType(s); goType == 0 {
-		return
+		return false
 	} else if typeName := l.SymName(goType); typeName != "type.string" {
 		Errorf(nil, "%s: cannot set with -X: not a var of type string (%s)", name, typeName)
-		return
+		return false
 	}
 	if !l.AttrReachable(s) {
-		return // don't bother setting unreachable variable
+		return false // don't bother setting unreachable variable
 	}
 	bld := l.MakeSymbolUpdater(s)
 	if bld.Type() == sym.SBSS {
@@ -1127,11 +1216,14 @@ func addstrdata(arch *sys.Arch, l *loader.Loader, name, value string) {
 	bld.ResetRelocs()
 	bld.AddAddrPlus(arch, sbld.Sym(), 0)
 	bld.AddUint(arch, uint64(len(value)))
+	return true
 }
 
 func (ctxt *Link) dostrdata() {
 	for _, name := range strnames {
-		addstrdata(ctxt.Arch, ctxt.loader, name, strdata[name])
+		if addstrdata(ctxt.Arch, ctxt.loader, name, strdata[name]) {
+			strdataSet[name] = true
+		}
 	}
 }
 
@@ -1597,6 +1689,7 @@ func (ctxt *Link) dodata(symGroupType []sym.SymKind) {
 func (state *dodataState) allocateDataSectionForSym(seg *sym.Segment, s loader.Sym, rwx int) *sym.Section {
 	ldr := state.ctxt.loader
 	sname := ldr.SymName(s)
+	state.allocateLayoutSections(seg, sname)
 	sect := addsection(ldr, state.ctxt.Arch, seg, sname, rwx)
 	sect.Align = symalign(ldr, s)
 	state.datsize = Rnd(state.datsize, int64(sect.Align))
@@ -1610,6 +1703,7 @@ func (state *dodataState) allocateDataSectionForSym(seg *sym.Segment, s loader.S
 // range of symbol types to be put into the section, and "rwx"
 // contains permissions for the section.
 func (state *dodataState) allocateNamedDataSection(seg *sym.Segment, sName string, types []sym.SymKind, rwx int) *sym.Section {
+	state.allocateLayoutSections(seg, sName)
 	sect := addsection(state.ctxt.loader, state.ctxt.Arch, seg, sName, rwx)
 	if len(types) == 0 {
 		sect.Align = 1
@@ -1694,6 +1788,10 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 	// to see all symbols in the .data and .bss sections in order
 	// to generate garbage collection information.
 
+	// Sections of host objects placed by -sectlayout are allocated
+	// next to the sections named in the layout.
+	state.removeLayoutSyms()
+
 	// Writable data sections that do not need any specialized handling.
 	writable := []sym.SymKind{
 		sym.SBUILDINFO,
@@ -1702,13 +1800,46 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 		sym.SMACHOGOT,
 		sym.SWINDOWS,
 	}
+	ldr := ctxt.loader
+	// The Mach-O GOT, __nl_symbol_ptr, is only written by dyld when it
+	// binds the imported symbols, before the program runs, so when
+	// linking internally it goes in __DATA_CONST, which dyld makes
+	// read-only once it is done, instead.
+	machoGOTReadOnly := false
+	if ctxt.IsDarwin() && ctxt.IsInternal() {
+		for _, s := range state.data[sym.SMACHOGOT] {
+			if ldr.SymSize(s) > 0 {
+				machoGOTReadOnly = true
+			}
+		}
+	}
+	// Likewise, with -bindnow the dynamic linker sets the whole ELF
+	// GOT, including the PLT entries, before the program runs, so it
+	// goes in the relro segment, which it then makes read-only.
+	var elfGOTPLT []loader.Sym
+	elfGOTReadOnly := ctxt.IsELF && ctxt.IsInternal() && *flagBindNow && !*FlagD
+	if elfGOTReadOnly {
+		syms := state.data[sym.SELFSECT][:0]
+		for _, s := range state.data[sym.SELFSECT] {
+			// On ppc64, the PLT is the data the dynamic linker
+			// writes and .got.plt is not used.
+			if s == ctxt.GOTPLT || s == ctxt.PLT {
+				elfGOTPLT = append(elfGOTPLT, s)
+				continue
+			}
+			syms = append(syms, s)
+		}
+		state.data[sym.SELFSECT] = syms
+	}
 	for _, symn := range writable {
+		if symn == sym.SMACHOGOT && machoGOTReadOnly {
+			continue
+		}
 		state.allocateSingleSymSections(&Segdata, symn, sym.SDATA, 06)
 	}
-	ldr := ctxt.loader
 
 	// .got
-	if len(state.data[sym.SELFGOT]) > 0 {
+	if len(state.data[sym.SELFGOT]) > 0 && !elfGOTReadOnly {
 		state.allocateNamedSectionAndAssignSyms(&Segdata, ".got", sym.SELFGOT, sym.SDATA, 06)
 	}
 
@@ -1731,8 +1862,10 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 		}
 	}
 
-	if hasinitarr && len(state.data[sym.SINITARR]) > 0 {
-		state.allocateNamedSectionAndAssignSyms(&Segdata, ".init_array", sym.SINITARR, sym.Sxxx, 06)
+	if (hasinitarr || len(ctxt.initArray) != 0) && len(state.data[sym.SINITARR]) > 0 {
+		sect := state.allocateNamedSectionAndAssignSyms(&Segdata, ".init_array", sym.SINITARR, sym.Sxxx, 06)
+		ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.initarray", 0), sect)
+		ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.einitarray", 0), sect)
 	}
 
 	/* data */
@@ -1747,6 +1880,15 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 	state.checkdatsize(sym.SDATA)
 	sect.Length = uint64(state.datsize) - sect.Vaddr
 
+	/* initial values of the thread-local variables of host objects */
+	var tdata *sym.Section
+	if len(state.data[sym.STLSDATA]) > 0 {
+		// .tdata starts the TLS block, so it is aligned for the
+		// thread-local variables of .tbss too.
+		tdata = state.allocateNamedDataSection(&Segdata, ".tdata", []sym.SymKind{sym.STLSDATA, sym.STLSBSS}, 06)
+		state.assignToSection(tdata, sym.STLSDATA, sym.Sxxx)
+	}
+
 	/* bss */
 	sect = state.allocateNamedSectionAndAssignSyms(&Segdata, ".bss", sym.SBSS, sym.Sxxx, 06)
 	ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.bss", 0), sect)
@@ -1784,7 +1926,9 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 		ldr.SetSymSect(ldr.LookupOrCreateSym("internal/fuzz._ecounters", 0), sect)
 	}
 
-	if len(state.data[sym.STLSBSS]) > 0 {
+	state.allocateLayoutSections(&Segdata, "")
+
+	if len(state.data[sym.STLSBSS]) > 0 || tdata != nil {
 		var sect *sym.Section
 		// FIXME: not clear why it is sometimes necessary to suppress .tbss section creation.
 		if (ctxt.IsELF || ctxt.HeadType == objabi.Haix) && (ctxt.LinkMode == LinkExternal || !*FlagD) {
@@ -1795,18 +1939,67 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 		}
 		state.datsize = 0
 
+		assign := func(syms []loader.Sym) {
+			for _, s := range syms {
+				state.datsize = aligndatsize(state, state.datsize, s)
+				if sect != nil {
+					ldr.SetSymSect(s, sect)
+				}
+				ldr.SetSymValue(s, state.datsize)
+				state.datsize += ldr.SymSize(s)
+			}
+		}
+
+		// The thread-local variables of host objects follow their
+		// initial values in .tdata, and those of the Go runtime end
+		// the TLS block: on amd64, the runtime finds g at a fixed
+		// offset from the end of the block (see Tlsoffset).
+		var host, gotls []loader.Sym
 		for _, s := range state.data[sym.STLSBSS] {
-			state.datsize = aligndatsize(state, state.datsize, s)
+			if ldr.IsExternal(s) && s != ctxt.Tlsg {
+				host = append(host, s)
+			} else {
+				gotls = append(gotls, s)
+			}
+		}
+		if tdata == nil && len(host) == 0 {
+			assign(gotls)
+		} else {
+			ctxt.checkHostTLS(sect)
+			align := int64(state.dataMaxAlign[sym.STLSBSS])
+			if tdata != nil {
+				align = int64(tdata.Align)
+				state.datsize = int64(tdata.Length)
+			}
+			if align < int64(ctxt.Arch.PtrSize) {
+				align = int64(ctxt.Arch.PtrSize)
+			}
+			assign(host)
+			var gosize int64
+			for _, s := range gotls {
+				gosize = aligndatsize(state, gosize, s) + ldr.SymSize(s)
+			}
+			gosize = Rnd(gosize, int64(ctxt.Arch.PtrSize))
+			end := Rnd(state.datsize+gosize, align)
+			state.datsize = end - gosize
+			assign(gotls)
+			state.datsize = end
+			if tdata != nil {
+				tdata.Align = int32(align)
+			}
 			if sect != nil {
-				ldr.SetSymSect(s, sect)
+				sect.Align = int32(align)
 			}
-			ldr.SetSymValue(s, state.datsize)
-			state.datsize += ldr.SymSize(s)
+			ctxt.Tlsalign = align
 		}
 		state.checkdatsize(sym.STLSBSS)
 
 		if sect != nil {
 			sect.Length = uint64(state.datsize)
+			if tdata != nil {
+				// .tbss only adds to the memory size of the block.
+				sect.Length -= tdata.Length
+			}
 		}
 	}
 
@@ -1894,6 +2087,7 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 			// sort out a rel.ro segment.
 			segrelro = segro
 		} else {
+			state.allocateLayoutSections(segro, "")
 			// Reset datsize for new segment.
 			state.datsize = 0
 		}
@@ -1976,6 +2170,11 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 	ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.esymtab", 0), sect)
 
 	/* gopclntab */
+	// The pcHeader holds the address of the text, so when using relro
+	// the whole table goes in it, for the dynamic linker to relocate and
+	// then protect. The findfunctab, which has no relocations, stays in
+	// .rodata, and the moduledata in .noptrdata, unless it is made
+	// read-only by -guard-moduledata.
 	sect = state.allocateNamedSectionAndAssignSyms(seg, genrelrosecname(".gopclntab"), sym.SPCLNTAB, sym.SRODATA, relroSecPerm)
 	ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.pclntab", 0), sect)
 	ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.pcheader", 0), sect)
@@ -1990,18 +2189,78 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 		xcoffUpdateOuterSize(ctxt, int64(sect.Length), sym.SPCLNTAB)
 	}
 
+	state.allocateLayoutSections(seg, "")
+
+	if machoGOTReadOnly {
+		if !ctxt.UseRelro() {
+			// __DATA_CONST holds only the GOT.
+			state.datsize = 0
+		}
+		state.allocateSingleSymSections(&Segrelrodata, sym.SMACHOGOT, sym.SDATA, 06)
+	}
+	if elfGOTReadOnly {
+		if !ctxt.UseRelro() {
+			// The relro segment holds only the GOT.
+			state.datsize = 0
+		}
+		if len(state.data[sym.SELFGOT]) > 0 {
+			state.allocateNamedSectionAndAssignSyms(&Segrelrodata, ".got", sym.SELFGOT, sym.SDATA, 06)
+		}
+		for _, s := range elfGOTPLT {
+			sect := state.allocateDataSectionForSym(&Segrelrodata, s, 06)
+			ldr.SetSymSect(s, sect)
+			state.setSymType(s, sym.SDATA)
+			ldr.SetSymValue(s, int64(uint64(state.datsize)-sect.Vaddr))
+			state.datsize += ldr.SymSize(s)
+			sect.Length = uint64(state.datsize) - sect.Vaddr
+		}
+		state.checkdatsize(sym.SELFSECT)
+	}
+
+	// The packed relative relocations of all of the above.
+	state.allocateRelrSection(ctxt, seg)
+
 	// 6g uses 4-byte relocation offsets, so the entire segment must fit in 32 bits.
 	if state.datsize != int64(uint32(state.datsize)) {
 		Errorf(nil, "read-only data segment too large: %d", state.datsize)
 	}
 
+	state.restoreLayoutSyms()
+
 	siz := 0
 	for symn := sym.SELFRXSECT; symn < sym.SXREF; symn++ {
 		siz += len(state.data[symn])
 	}
 	ctxt.datap = make([]loader.Sym, 0, siz)
 	for symn := sym.SELFRXSECT; symn < sym.SXREF; symn++ {
+		if symn == sym.SMACHOGOT && machoGOTReadOnly || symn == sym.SELFGOT && elfGOTReadOnly {
+			continue
+		}
 		ctxt.datap = append(ctxt.datap, state.data[symn]...)
+		if symn == sym.SPCLNTAB && machoGOTReadOnly {
+			// In address order, the GOT follows them in __DATA_CONST.
+			ctxt.datap = append(ctxt.datap, state.data[sym.SMACHOGOT]...)
+		}
+		if symn == sym.SPCLNTAB && elfGOTReadOnly {
+			// Or in the relro segment.
+			ctxt.datap = append(ctxt.datap, state.data[sym.SELFGOT]...)
+			ctxt.datap = append(ctxt.datap, elfGOTPLT...)
+		}
+	}
+}
+
+// checkHostTLS reports an error if the thread-local variables of host
+// objects cannot be supported, given the .tbss section, if any.
+// Internal linking places them in the TLS block of the program, which
+// the C library sets up for each thread, so cgo is required.
+func (ctxt *Link) checkHostTLS(tbss *sym.Section) {
+	switch {
+	case !ctxt.IsELF || !ctxt.IsAMD64() && !ctxt.IsARM64() || ctxt.Tlsg == 0:
+		Errorf(nil, "thread-local variables of host objects are not supported on %v/%s", ctxt.HeadType, ctxt.Arch.Name)
+	case !iscgo:
+		Errorf(nil, "thread-local variables of host objects require cgo")
+	case tbss == nil:
+		Errorf(nil, "thread-local variables of host objects cannot be linked with -d")
 	}
 }
 
@@ -2086,7 +2345,27 @@ func (state *dodataState) dodataSect(ctxt *Link, symn sym.SymKind, syms []loader
 	checkSize := symn != sym.SELFGOT
 
 	// Perform the sort.
-	if symn != sym.SPCLNTAB {
+	switch symn {
+	case sym.SINITARR:
+		// The constructors run in the order of their priorities,
+		// then in the order of the objects.
+		for k := range sl {
+			sl[k].val = int64(initPriority(ldr, sl[k].sym))
+		}
+		sort.Slice(sl, func(i, j int) bool {
+			if sl[i].val != sl[j].val {
+				return sl[i].val < sl[j].val
+			}
+			return sl[i].sym < sl[j].sym
+		})
+	case sym.SPCLNTAB:
+		// PCLNTAB was built internally, and has the proper order based on value.
+		// Sort the symbols as such.
+		for k, s := range syms {
+			sl[k].val = ldr.SymValue(s)
+		}
+		sort.Slice(sl, func(i, j int) bool { return sl[i].val < sl[j].val })
+	default:
 		sort.Slice(sl, func(i, j int) bool {
 			si, sj := sl[i].sym, sl[j].sym
 			switch {
@@ -2109,13 +2388,6 @@ func (state *dodataState) dodataSect(ctxt *Link, symn sym.SymKind, syms []loader
 			}
 			return si < sj
 		})
-	} else {
-		// PCLNTAB was built internally, and has the proper order based on value.
-		// Sort the symbols as such.
-		for k, s := range syms {
-			sl[k].val = ldr.SymValue(s)
-		}
-		sort.Slice(sl, func(i, j int) bool { return sl[i].val < sl[j].val })
 	}
 
 	// Set alignment, construct result
@@ -2158,6 +2430,11 @@ func (ctxt *Link) textbuildid() {
 	ctxt.Textp[0] = s.Sym()
 }
 
+// buildinfomagic starts the .go.buildinfo section. The \xff is
+// invalid UTF-8, meant to make it less likely to find one of these
+// accidentally.
+const buildinfomagic = "\xff Go buildinf:"
+
 func (ctxt *Link) buildinfo() {
 	if ctxt.linkShared || ctxt.BuildMode == BuildModePlugin {
 		// -linkshared and -buildmode=plugin get confused
@@ -2174,15 +2451,12 @@ func (ctxt *Link) buildinfo() {
 	s.SetNotInSymbolTable(!ctxt.IsAIX())
 	s.SetType(sym.SBUILDINFO)
 	s.SetAlign(16)
-	// The \xff is invalid UTF-8, meant to make it less likely
-	// to find one of these accidentally.
-	const prefix = "\xff Go buildinf:" // 14 bytes, plus 2 data bytes filled in below
 	data := make([]byte, 32)
-	copy(data, prefix)
-	data[len(prefix)] = byte(ctxt.Arch.PtrSize)
-	data[len(prefix)+1] = 0
+	copy(data, buildinfomagic) // 14 bytes, plus 2 data bytes filled in below
+	data[len(buildinfomagic)] = byte(ctxt.Arch.PtrSize)
+	data[len(buildinfomagic)+1] = 0
 	if ctxt.Arch.ByteOrder == binary.BigEndian {
-		data[len(prefix)+1] = 1
+		data[len(buildinfomagic)+1] = 1
 	}
 	s.SetData(data)
 	s.SetSize(int64(len(data)))
@@ -2228,6 +2502,13 @@ func (ctxt *Link) textaddress() {
 		ctxt.Textp[0] = text
 	}
 
+	if *flagRandLayout != 0 {
+		ctxt.randomizeText()
+	}
+	if *flagOrderFile != "" {
+		ctxt.orderText()
+	}
+
 	start := uint64(Rnd(*FlagTextAddr, int64(Funcalign)))
 	va := start
 	n := 1
@@ -2240,6 +2521,9 @@ func (ctxt *Link) textaddress() {
 	if *FlagDebugTextSize != 0 {
 		limit = uint64(*FlagDebugTextSize)
 	}
+	if size := splitTextSize(ctxt); size != 0 && size < limit {
+		limit = size // the text needs splitting
+	}
 	if *FlagDebugTramp > 1 {
 		limit = 1 // debug mode, force generating trampolines for everything
 	}
@@ -2334,8 +2618,10 @@ func assignAddress(ctxt *Link, sect *sym.Section, n int, s loader.Sym, va uint64
 		return sect, n, va
 	}
 
+	// With -funcalign, functions that ask for a smaller alignment of
+	// their own get the larger one too.
 	align := ldr.SymAlign(s)
-	if align == 0 {
+	if align == 0 || *flagFuncAlign != 0 && align < int32(Funcalign) {
 		align = int32(Funcalign)
 	}
 	va = uint64(Rnd(int64(va), int64(align)))
@@ -2352,22 +2638,15 @@ func assignAddress(ctxt *Link, sect *sym.Section, n int, s loader.Sym, va uint64
 	// section, then create a new one.
 	//
 	// Only break at outermost syms.
-	if big && splitTextSections(ctxt) && ldr.OuterSym(s) == 0 {
-		// For debugging purposes, allow text size limit to be cranked down,
-		// so as to stress test the code that handles multiple text sections.
-		var textSizelimit uint64 = thearch.TrampLimit
-		if *FlagDebugTextSize != 0 {
-			textSizelimit = uint64(*FlagDebugTextSize)
-		}
-
+	if textSizelimit := splitTextSize(ctxt); big && textSizelimit != 0 && ldr.OuterSym(s) == 0 {
 		// Sanity check: make sure the limit is larger than any
 		// individual text symbol.
 		if funcsize > textSizelimit {
-			panic(fmt.Sprintf("error: text size limit %d less than text symbol %s size of %d", textSizelimit, ldr.SymName(s), funcsize))
+			Exitf("text size limit %d less than text symbol %s size of %d", textSizelimit, ldr.SymName(s), funcsize)
 		}
 
 		if va-sect.Vaddr+funcsize+maxSizeTrampolines(ctxt, ldr, s, isTramp) > textSizelimit {
-			sectAlign := int32(thearch.Funcalign)
+			sectAlign := int32(Funcalign)
 			if ctxt.IsPPC64() {
 				// Align the next text section to the worst case function alignment likely
 				// to be encountered when processing function symbols. The start address
@@ -2429,7 +2708,7 @@ func assignAddress(ctxt *Link, sect *sym.Section, n int, s loader.Sym, va uint64
 	return sect, n, va
 }
 
-// Return whether we may need to split text sections.
+// Return the maximum size of a text section, or 0 if text sections are not split.
 //
 // On PPC64x whem external linking a text section should not be larger than 2^25 bytes
 // due to the size of call target offset field in the bl instruction.  Splitting into
@@ -2438,8 +2717,24 @@ func assignAddress(ctxt *Link, sect *sym.Section, n int, s loader.Sym, va uint64
 // linker.
 //
 // The same applies to Darwin/ARM64, with 2^27 byte threshold.
-func splitTextSections(ctxt *Link) bool {
-	return (ctxt.IsPPC64() || (ctxt.IsARM64() && ctxt.IsDarwin())) && ctxt.IsExternal()
+//
+// -splittextsize sets the size, which turns splitting on or off on
+// PPC64x and ARM64 in either linking mode. It cannot be larger than
+// thearch.TrampLimit.
+func splitTextSize(ctxt *Link) uint64 {
+	size := uint64(0)
+	if (ctxt.IsPPC64() || (ctxt.IsARM64() && ctxt.IsDarwin())) && ctxt.IsExternal() {
+		size = thearch.TrampLimit
+	}
+	if *flagSplitTextSize != -1 {
+		size = uint64(*flagSplitTextSize)
+	}
+	// For debugging purposes, allow text size limit to be cranked down,
+	// so as to stress test the code that handles multiple text sections.
+	if size != 0 && *FlagDebugTextSize != 0 {
+		size = uint64(*FlagDebugTextSize)
+	}
+	return size
 }
 
 // On Wasm, we reserve 4096 bytes for zero page, then 8192 bytes for wasm_exec.js
@@ -2456,6 +2751,12 @@ func (ctxt *Link) address() []*sym.Segment {
 	va := uint64(*FlagTextAddr)
 	order = append(order, &Segtext)
 	Segtext.Rwx = 05
+	for _, s := range ctxt.wxsects {
+		if ctxt.loader.AttrReachable(s) {
+			Segtext.Rwx |= 02
+			break
+		}
+	}
 	Segtext.Vaddr = va
 	for i, s := range Segtext.Sections {
 		va = uint64(Rnd(int64(va), int64(s.Align)))
@@ -2490,6 +2791,7 @@ func (ctxt *Link) address() []*sym.Segment {
 		Segrodata.Vaddr = va
 		for _, s := range Segrodata.Sections {
 			va = uint64(Rnd(int64(va), int64(s.Align)))
+			va = ctxt.placeLayoutSection(s, va)
 			s.Vaddr = va
 			va += s.Length
 		}
@@ -2510,6 +2812,7 @@ func (ctxt *Link) address() []*sym.Segment {
 		Segrelrodata.Vaddr = va
 		for _, s := range Segrelrodata.Sections {
 			va = uint64(Rnd(int64(va), int64(s.Align)))
+			va = ctxt.placeLayoutSection(s, va)
 			s.Vaddr = va
 			va += s.Length
 		}
@@ -2532,6 +2835,7 @@ func (ctxt *Link) address() []*sym.Segment {
 	var bss *sym.Section
 	var noptrbss *sym.Section
 	var fuzzCounters *sym.Section
+	moved := false // whether a section was moved by -sectlayout
 	for i, s := range Segdata.Sections {
 		if (ctxt.IsELF || ctxt.HeadType == objabi.Haix) && s.Name == ".tbss" {
 			continue
@@ -2540,6 +2844,14 @@ func (ctxt *Link) address() []*sym.Segment {
 		if i+1 < len(Segdata.Sections) && !((ctxt.IsELF || ctxt.HeadType == objabi.Haix) && Segdata.Sections[i+1].Name == ".tbss") {
 			vlen = int64(Segdata.Sections[i+1].Vaddr - s.Vaddr)
 		}
+		if addr := ctxt.placeLayoutSection(s, va); addr != va {
+			va = addr
+			moved = true
+		} else if moved {
+			// The sections that follow are no longer where
+			// dodata aligned them.
+			va = uint64(Rnd(int64(va), int64(s.Align)))
+		}
 		s.Vaddr = va
 		va += uint64(vlen)
 		Segdata.Length = va - Segdata.Vaddr
@@ -2595,6 +2907,13 @@ func (ctxt *Link) address() []*sym.Segment {
 			ldr.AddToSymValue(sub, v)
 		}
 	}
+	if len(ctxt.sectLayout) > 0 {
+		// The symbols placed by -sectlayout are out of order, but
+		// the data must be written out in address order.
+		sort.SliceStable(ctxt.datap, func(i, j int) bool {
+			return ldr.SymValue(ctxt.datap[i]) < ldr.SymValue(ctxt.datap[j])
+		})
+	}
 
 	for _, si := range dwarfp {
 		for _, s := range si.syms {
@@ -2666,6 +2985,10 @@ func (ctxt *Link) address() []*sym.Segment {
 	ctxt.xdefine("runtime.ebss", sym.SBSS, int64(bss.Vaddr+bss.Length))
 	ctxt.xdefine("runtime.data", sym.SDATA, int64(data.Vaddr))
 	ctxt.xdefine("runtime.edata", sym.SDATA, int64(data.Vaddr+data.Length))
+	if initarray := ldr.SymSect(ldr.Lookup("runtime.initarray", 0)); initarray != nil {
+		ctxt.xdefine("runtime.initarray", sym.SINITARR, int64(initarray.Vaddr))
+		ctxt.xdefine("runtime.einitarray", sym.SINITARR, int64(initarray.Vaddr+initarray.Length))
+	}
 	ctxt.xdefine("runtime.noptrbss", sym.SNOPTRBSS, int64(noptrbss.Vaddr))
 	ctxt.xdefine("runtime.enoptrbss", sym.SNOPTRBSS, int64(noptrbss.Vaddr+noptrbss.Length))
 	ctxt.xdefine("runtime.end", sym.SBSS, int64(Segdata.Vaddr+Segdata.Length))
@@ -2711,6 +3034,8 @@ func (ctxt *Link) address() []*sym.Segment {
 		}
 	}
 
+	ctxt.relrData()
+
 	return order
 }
 
@@ -2769,23 +3094,89 @@ func compressSyms(ctxt *Link, syms []loader.Sym) []byte {
 	}
 
 	var buf bytes.Buffer
-	buf.Write([]byte("ZLIB"))
-	var sizeBytes [8]byte
-	binary.BigEndian.PutUint64(sizeBytes[:], uint64(total))
-	buf.Write(sizeBytes[:])
+	writeCompressedSyms(ctxt, &buf, syms, total)
+	if int64(buf.Len()) >= total {
+		// Compression didn't save any space.
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// writeCompressedSyms writes the contents of the compressed section
+// holding syms, whose sizes add up to total, to w.
+func writeCompressedSyms(ctxt *Link, w io.Writer, syms []loader.Sym, total int64) {
+	ldr := ctxt.loader
+
+	// Only ELF has a way to say that a section is compressed with
+	// zstd.
+	method := ctxt.compressDWARF
+	if !ctxt.IsELF {
+		method = dwarfCompressZlib
+	}
+
+	var buf bytes.Buffer
+	if ctxt.IsELF {
+		// An ELF compressed section keeps its name, and starts
+		// with an ELF compression header.
+		typ := elf.COMPRESS_ZLIB
+		if method == dwarfCompressZstd {
+			typ = elf.COMPRESS_ZSTD
+		}
+		var hdr interface{}
+		if ctxt.Arch.PtrSize == 8 {
+			hdr = &elf.Chdr64{Type: uint32(typ), Size: uint64(total), Addralign: 1}
+		} else {
+			hdr = &elf.Chdr32{Type: uint32(typ), Size: uint32(total), Addralign: 1}
+		}
+		if err := binary.Write(&buf, ctxt.Arch.ByteOrder, hdr); err != nil {
+			log.Fatalf("writing compression header failed: %s", err)
+		}
+	} else {
+		buf.Write([]byte("ZLIB"))
+		var sizeBytes [8]byte
+		binary.BigEndian.PutUint64(sizeBytes[:], uint64(total))
+		buf.Write(sizeBytes[:])
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Fatalf("compression failed: %s", err)
+	}
 
 	var relocbuf []byte // temporary buffer for applying relocations
+	var genbuf []byte   // temporary buffer for generator symbols
 
-	// Using zlib.BestSpeed achieves very nearly the same
-	// compression levels of zlib.DefaultCompression, but takes
-	// substantially less time. This is important because DWARF
-	// compression can be a significant fraction of link time.
-	z, err := zlib.NewWriterLevel(&buf, zlib.BestSpeed)
-	if err != nil {
-		log.Fatalf("NewWriterLevel failed: %s", err)
+	var z io.WriteCloser
+	switch method {
+	case dwarfCompressZstd:
+		z = zstd.NewWriter(w, total)
+	default:
+		// Using zlib.BestSpeed achieves very nearly the same
+		// compression levels of zlib.DefaultCompression, but takes
+		// substantially less time. This is important because DWARF
+		// compression can be a significant fraction of link time.
+		var err error
+		z, err = zlib.NewWriterLevel(w, zlib.BestSpeed)
+		if err != nil {
+			log.Fatalf("NewWriterLevel failed: %s", err)
+		}
 	}
 	st := ctxt.makeRelocSymState()
 	for _, s := range syms {
+		if f, ok := ctxt.generatorSyms[s]; ok {
+			// Generate the data in a temporary buffer, and
+			// immediately write it out.
+			if n := int(ldr.SymSize(s)); cap(genbuf) < n {
+				genbuf = make([]byte, n)
+			} else {
+				genbuf = genbuf[:n]
+			}
+			ldr.MakeSymbolUpdater(s).SetData(genbuf)
+			f(ctxt, s)
+			if _, err := z.Write(genbuf); err != nil {
+				log.Fatalf("compression failed: %s", err)
+			}
+			ldr.FreeData(s)
+			continue
+		}
 		// Symbol data may be read-only. Apply relocations in a
 		// temporary buffer, and immediately write it out.
 		P := ldr.Data(s)
@@ -2813,9 +3204,4 @@ func compressSyms(ctxt *Link, syms []loader.Sym) []byte {
 	if err := z.Close(); err != nil {
 		log.Fatalf("compression failed: %s", err)
 	}
-	if int64(buf.Len()) >= total {
-		// Compression didn't save any space.
-		return nil
-	}
-	return buf.Bytes()
 }
@@ -27,6 +27,8 @@ type deadcodePass struct {
 	markableMethods    []methodref        // methods of reached types
 	reflectSeen        bool               // whether we have seen a reflect method call
 	dynlink            bool
+	dump               *depDumper     // for -dumpdep, or nil
+	why                *whyAliveGraph // for -whyalive, or nil
 
 	methodsigstmp []methodsig // scratch buffer for decoding method signatures
 }
@@ -46,7 +48,7 @@ func (d *deadcodePass) init() {
 		n := d.ldr.NDef()
 		for i := 1; i < n; i++ {
 			s := loader.Sym(i)
-			d.mark(s, 0)
+			d.mark(s, 0, depRoot)
 		}
 		return
 	}
@@ -86,7 +88,7 @@ func (d *deadcodePass) init() {
 		if exportsIdx != 0 {
 			relocs := d.ldr.Relocs(exportsIdx)
 			for i := 0; i < relocs.Count(); i++ {
-				d.mark(relocs.At(i).Sym(), 0)
+				d.mark(relocs.At(i).Sym(), 0, depRoot)
 			}
 		}
 	}
@@ -97,19 +99,34 @@ func (d *deadcodePass) init() {
 
 	for _, name := range names {
 		// Mark symbol as a data/ABI0 symbol.
-		d.mark(d.ldr.Lookup(name, 0), 0)
+		d.mark(d.ldr.Lookup(name, 0), 0, depRoot)
 		if abiInternalVer != 0 {
 			// Also mark any Go functions (internal ABI).
-			d.mark(d.ldr.Lookup(name, abiInternalVer), 0)
+			d.mark(d.ldr.Lookup(name, abiInternalVer), 0, depRoot)
 		}
 	}
 
+	// Everything loaded from a -wholearchive archive is kept.
+	for _, s := range d.ctxt.wholeArchiveSyms {
+		d.mark(s, 0, depRoot)
+	}
+
+	// So is every input section -sectlayout says to keep.
+	for _, s := range d.ctxt.sectLayoutKeep {
+		d.mark(s, 0, depRoot)
+	}
+
+	// And every constructor of the host objects.
+	for _, s := range d.ctxt.initArray {
+		d.mark(s, 0, depRoot)
+	}
+
 	// All dynamic exports are roots.
 	for _, s := range d.ctxt.dynexp {
 		if d.ctxt.Debugvlog > 1 {
 			d.ctxt.Logf("deadcode start dynexp: %s<%d>\n", d.ldr.SymName(s), d.ldr.SymVersion(s))
 		}
-		d.mark(s, 0)
+		d.mark(s, 0, depRoot)
 	}
 }
 
@@ -118,6 +135,12 @@ func (d *deadcodePass) flood() {
 	for !d.wq.empty() {
 		symIdx := d.wq.pop()
 
+		if d.ctxt.typeImports.host[symIdx] {
+			// The plugin uses the program's type descriptor, see
+			// typeimport.go.
+			continue
+		}
+
 		d.reflectSeen = d.reflectSeen || d.ldr.IsReflectMethod(symIdx)
 
 		isgotype := d.ldr.IsGoType(symIdx)
@@ -159,7 +182,7 @@ func (d *deadcodePass) flood() {
 						d.ldr.SetAttrUsedInIface(rs, true)
 						if d.ldr.AttrReachable(rs) {
 							d.ldr.SetAttrReachable(rs, false)
-							d.mark(rs, symIdx)
+							d.mark(rs, symIdx, depUsedInIface)
 						}
 					}
 				}
@@ -179,7 +202,7 @@ func (d *deadcodePass) flood() {
 					d.ldr.SetAttrUsedInIface(rs, true)
 					if d.ldr.AttrReachable(rs) {
 						d.ldr.SetAttrReachable(rs, false)
-						d.mark(rs, symIdx)
+						d.mark(rs, symIdx, depUsedInIface)
 					}
 				}
 				continue
@@ -223,7 +246,7 @@ func (d *deadcodePass) flood() {
 				d.ldr.SetAttrUsedInIface(rs, true)
 				d.ldr.SetAttrReachable(rs, false)
 			}
-			d.mark(rs, symIdx)
+			d.mark(rs, symIdx, depReloc)
 		}
 		naux := d.ldr.NAux(symIdx)
 		for i := 0; i < naux; i++ {
@@ -233,7 +256,7 @@ func (d *deadcodePass) flood() {
 				// type descriptor. Don't mark it.
 				continue
 			}
-			d.mark(a.Sym(), symIdx)
+			d.mark(a.Sym(), symIdx, depAux)
 		}
 		// Some host object symbols have an outer object, which acts like a
 		// "carrier" symbol, or it holds all the symbols for a particular
@@ -242,8 +265,8 @@ func (d *deadcodePass) flood() {
 		// symbols. This is not ideal, and these carrier/section symbols could
 		// be removed.
 		if d.ldr.IsExternal(symIdx) {
-			d.mark(d.ldr.OuterSym(symIdx), symIdx)
-			d.mark(d.ldr.SubSym(symIdx), symIdx)
+			d.mark(d.ldr.OuterSym(symIdx), symIdx, depCarrier)
+			d.mark(d.ldr.SubSym(symIdx), symIdx, depCarrier)
 		}
 
 		if len(methods) != 0 {
@@ -268,37 +291,30 @@ func (d *deadcodePass) flood() {
 	}
 }
 
-func (d *deadcodePass) mark(symIdx, parent loader.Sym) {
+func (d *deadcodePass) mark(symIdx, parent loader.Sym, why depReason) {
+	if d.why != nil && symIdx != 0 {
+		d.why.edge(parent, symIdx, why)
+	}
 	if symIdx != 0 && !d.ldr.AttrReachable(symIdx) {
 		d.wq.push(symIdx)
 		d.ldr.SetAttrReachable(symIdx, true)
+		if parent == 0 && *flagMetadata != "" {
+			d.ctxt.deadcodeRoots = append(d.ctxt.deadcodeRoots, symIdx)
+		}
 		if buildcfg.Experiment.FieldTrack && d.ldr.Reachparent[symIdx] == 0 {
 			d.ldr.Reachparent[symIdx] = parent
 		}
-		if *flagDumpDep {
-			to := d.ldr.SymName(symIdx)
-			if to != "" {
-				if d.ldr.AttrUsedInIface(symIdx) {
-					to += " <UsedInIface>"
-				}
-				from := "_"
-				if parent != 0 {
-					from = d.ldr.SymName(parent)
-					if d.ldr.AttrUsedInIface(parent) {
-						from += " <UsedInIface>"
-					}
-				}
-				fmt.Printf("%s -> %s\n", from, to)
-			}
+		if d.dump != nil {
+			d.dump.edge(parent, symIdx, why)
 		}
 	}
 }
 
 func (d *deadcodePass) markMethod(m methodref) {
 	relocs := d.ldr.Relocs(m.src)
-	d.mark(relocs.At(m.r).Sym(), m.src)
-	d.mark(relocs.At(m.r+1).Sym(), m.src)
-	d.mark(relocs.At(m.r+2).Sym(), m.src)
+	d.mark(relocs.At(m.r).Sym(), m.src, depMethod)
+	d.mark(relocs.At(m.r+1).Sym(), m.src, depMethod)
+	d.mark(relocs.At(m.r+2).Sym(), m.src, depMethod)
 }
 
 // deadcode marks all reachable symbols.
@@ -336,7 +352,7 @@ func (d *deadcodePass) markMethod(m methodref) {
 // Any unreached text symbols are removed from ctxt.Textp.
 func deadcode(ctxt *Link) {
 	ldr := ctxt.loader
-	d := deadcodePass{ctxt: ctxt, ldr: ldr}
+	d := deadcodePass{ctxt: ctxt, ldr: ldr, dump: newDepDumper(ldr), why: newWhyAliveGraph()}
 	d.init()
 	d.flood()
 
@@ -375,6 +391,12 @@ func deadcode(ctxt *Link) {
 		}
 		d.flood()
 	}
+	if d.dump != nil {
+		d.dump.close()
+	}
+	if d.why != nil {
+		ctxt.whyAlive = d.why.report(ctxt)
+	}
 }
 
 // methodsig is a typed method signature (name + type).
@@ -5,10 +5,14 @@
 package ld
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"internal/testenv"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"testing"
 )
 
@@ -49,3 +53,150 @@ func TestDeadcode(t *testing.T) {
 		})
 	}
 }
+
+func TestDumpDepJSON(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join("testdata", "deadcode", "dumpdep.go")
+
+	type sym struct {
+		Name, Package string
+		Size          int64
+	}
+	type edge struct {
+		From   *sym
+		To     sym
+		Reason string
+	}
+	dump := func(name string, ldflags string) ([]edge, int64) {
+		file := filepath.Join(tmpdir, name+".json")
+		exe := filepath.Join(tmpdir, name+".exe")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-dumpdep=json:"+file+" "+ldflags, "-o", exe, src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %v:\n%s", cmd.Args, err, out)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var edges []edge
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			var e edge
+			if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+				t.Fatalf("%s: %v: %s", file, err, s.Bytes())
+			}
+			edges = append(edges, e)
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return edges, fi.Size()
+	}
+
+	// find returns the edge from from to to, or nil.
+	find := func(edges []edge, from, to string) *edge {
+		for i, e := range edges {
+			if e.From != nil && e.From.Name == from && e.To.Name == to {
+				return &edges[i]
+			}
+		}
+		return nil
+	}
+
+	all, allSize := dump("all", "")
+	e := find(all, "main.main", "main.helper")
+	if e == nil {
+		t.Fatalf("no edge from main.main to main.helper")
+	}
+	if e.Reason != "reloc" || e.From.Package != "main" || e.To.Package != "main" || e.From.Size == 0 || e.To.Size == 0 {
+		t.Errorf("edge from main.main to main.helper is %+v, %+v, %q; want a relocation between symbols of main", *e.From, e.To, e.Reason)
+	}
+	if e := find(all, "type.main.T", "main.T.M"); e == nil || e.Reason != "method" {
+		t.Errorf("main.T.M is not reached as a method of type.main.T")
+	}
+	roots := 0
+	for _, e := range all {
+		if e.From == nil {
+			roots++
+			if e.Reason != "root" {
+				t.Errorf("edge to %s has no from, but reason %q", e.To.Name, e.Reason)
+			}
+		}
+	}
+	if roots == 0 {
+		t.Errorf("no roots")
+	}
+
+	re := regexp.MustCompile(`^main\.`)
+	filtered, filteredSize := dump("filtered", "-dumpdepfilter="+re.String())
+	if find(filtered, "main.main", "main.helper") == nil {
+		t.Errorf("no edge from main.main to main.helper with -dumpdepfilter")
+	}
+	for _, e := range filtered {
+		if !re.MatchString(e.To.Name) && (e.From == nil || !re.MatchString(e.From.Name)) {
+			t.Errorf("edge to %s does not match -dumpdepfilter", e.To.Name)
+		}
+	}
+	if filteredSize*10 > allSize {
+		t.Errorf("filtered dump is %d bytes, want much less than the %d of the whole", filteredSize, allSize)
+	}
+}
+
+func TestWhyAlive(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	tests := []struct {
+		name, src string
+		want      []string // in order in the output
+	}{
+		{
+			name: "println",
+			src:  "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n",
+			want: []string{"fmt.Fscanln is not reachable\n", "fmt.Scanln is not reachable\n"},
+		},
+		{
+			name: "scanln",
+			src:  "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tvar s string\n\tfmt.Scanln(&s)\n\tfmt.Println(s)\n}\n",
+			want: []string{
+				// Scanln is inlined, and its callee is not.
+				"fmt.Fscanln is reachable:\n\tfmt.Fscanln\n\t<- main.main (call)\n", "\t<- runtime.main ", " is the entry point\n",
+				"fmt.Scanln is not reachable itself, but is inlined into main.main, which is reachable:\n\tmain.main\n", " is the entry point\n",
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			src := filepath.Join(tmpdir, test.name+".go")
+			if err := os.WriteFile(src, []byte(test.src), 0666); err != nil {
+				t.Fatal(err)
+			}
+			exe := filepath.Join(tmpdir, test.name+".exe")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-whyalive=fmt.Fscanln -whyalive=fmt.Scanln", "-o", exe, src)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %v:\n%s", cmd.Args, err, out)
+			}
+			rest := out
+			for _, want := range test.want {
+				i := bytes.Index(rest, []byte(want))
+				if i < 0 {
+					t.Fatalf("output does not contain %q in order:\n%s", want, out)
+				}
+				rest = rest[i+len(want):]
+			}
+		})
+	}
+}
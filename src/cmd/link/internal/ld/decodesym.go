@@ -221,7 +221,7 @@ func decodetypeStr(ldr *loader.Loader, arch *sys.Arch, symIdx loader.Sym) string
 }
 
 func decodetypeGcmask(ctxt *Link, s loader.Sym) []byte {
-	if ctxt.loader.SymType(s) == sym.SDYNIMPORT {
+	if ctxt.loader.SymType(s) == sym.SDYNIMPORT && ctxt.linkShared {
 		symData := ctxt.loader.Data(s)
 		addr := decodetypeGcprogShlib(ctxt, symData)
 		ptrdata := decodetypePtrdata(ctxt.Arch, symData)
@@ -248,7 +248,7 @@ func decodetypeGcmask(ctxt *Link, s loader.Sym) []byte {
 
 // Type.commonType.gc
 func decodetypeGcprog(ctxt *Link, s loader.Sym) []byte {
-	if ctxt.loader.SymType(s) == sym.SDYNIMPORT {
+	if ctxt.loader.SymType(s) == sym.SDYNIMPORT && ctxt.linkShared {
 		symData := ctxt.loader.Data(s)
 		addr := decodetypeGcprogShlib(ctxt, symData)
 		sect := findShlibSection(ctxt, ctxt.loader.SymPkg(s), addr)
@@ -0,0 +1,224 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bufio"
+	"cmd/link/internal/loader"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Support for -dumpdep, which writes the edges of the graph the dead
+// code pass walks, each as the pass reaches a new symbol. By default,
+// or with -dumpdep=text, the edges are lines
+//
+//	from -> to
+//
+// with _ for the roots, and <UsedInIface> after the types converted to
+// interfaces. With -dumpdep=json, they are JSON objects, one per line:
+//
+//	{"from":{"name":"main.main","package":"main","size":98},"to":{"name":"main.helper","package":"main","size":42},"reason":"reloc"}
+//
+// with no "from" for the roots. The reason is why the symbol is reached:
+//
+//	root       it is a root of the pass, such as the entry point
+//	reloc      a relocation of from refers to it
+//	aux        it is auxiliary data of from, such as funcdata
+//	usediface  from converts the type to an interface
+//	method     it is a method of the type from, and may be called
+//	           through an interface or reflection
+//	carrier    it is the outer symbol or a sub-symbol of the host
+//	           object symbol from
+//
+// The edges go to standard output, or to file with -dumpdep=text:file
+// or -dumpdep=json:file. With -dumpdepfilter=regexp, only the edges
+// with a symbol whose name matches regexp are written.
+
+// A depReason is why the dead code pass reaches a symbol.
+type depReason uint8
+
+const (
+	depRoot depReason = iota
+	depReloc
+	depAux
+	depUsedInIface
+	depMethod
+	depCarrier
+)
+
+var depReasonNames = [...]string{
+	depRoot:        "root",
+	depReloc:       "reloc",
+	depAux:         "aux",
+	depUsedInIface: "usediface",
+	depMethod:      "method",
+	depCarrier:     "carrier",
+}
+
+func (r depReason) String() string { return depReasonNames[r] }
+
+// dumpDepFlag is the value of -dumpdep.
+type dumpDepFlag struct {
+	format string // "text" or "json", or "" to write nothing
+	file   string // or "" for standard output
+}
+
+func (f *dumpDepFlag) Set(s string) error {
+	format, file := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		format, file = s[:i], s[i+1:]
+		if file == "" {
+			return fmt.Errorf("missing file in dumpdep %q", s)
+		}
+	}
+	switch format {
+	case "false":
+		if file != "" {
+			return fmt.Errorf("invalid dumpdep: %q", s)
+		}
+		format = ""
+	case "true":
+		format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid dumpdep: %q; want text or json, optionally followed by :file", s)
+	}
+	f.format, f.file = format, file
+	return nil
+}
+
+func (f *dumpDepFlag) String() string {
+	if f.format == "" {
+		return "false"
+	}
+	if f.file == "" {
+		return f.format
+	}
+	return f.format + ":" + f.file
+}
+
+// IsBoolFlag makes -dumpdep alone mean text, as it meant when it was a
+// boolean flag.
+func (f *dumpDepFlag) IsBoolFlag() bool { return true }
+
+// A depDumper writes the edges of the dead code pass for -dumpdep.
+type depDumper struct {
+	ldr    *loader.Loader
+	json   bool
+	filter *regexp.Regexp
+	f      *os.File // if writing to a file
+	w      *bufio.Writer
+	enc    *json.Encoder
+}
+
+type depEdge struct {
+	From   *depSym `json:"from,omitempty"`
+	To     depSym  `json:"to"`
+	Reason string  `json:"reason"`
+}
+
+type depSym struct {
+	Name        string `json:"name"`
+	Package     string `json:"package"`
+	Size        int64  `json:"size"`
+	UsedInIface bool   `json:"usediniface,omitempty"`
+}
+
+// newDepDumper returns the dumper for -dumpdep, or nil if it is not
+// set.
+func newDepDumper(ldr *loader.Loader) *depDumper {
+	if flagDumpDep.format == "" {
+		if *flagDumpDepFilter != "" {
+			Exitf("-dumpdepfilter requires -dumpdep")
+		}
+		return nil
+	}
+	d := &depDumper{ldr: ldr, json: flagDumpDep.format == "json"}
+	if *flagDumpDepFilter != "" {
+		re, err := regexp.Compile(*flagDumpDepFilter)
+		if err != nil {
+			Exitf("-dumpdepfilter: %v", err)
+		}
+		d.filter = re
+	}
+	var w io.Writer = os.Stdout
+	if flagDumpDep.file != "" {
+		f, err := os.Create(flagDumpDep.file)
+		if err != nil {
+			Exitf("-dumpdep: %v", err)
+		}
+		d.f = f
+		w = f
+	}
+	d.w = bufio.NewWriter(w)
+	d.enc = json.NewEncoder(d.w)
+	return d
+}
+
+// edge writes the edge by which the dead code pass reaches the symbol
+// to from parent, which is 0 for a root.
+func (d *depDumper) edge(parent, to loader.Sym, why depReason) {
+	ldr := d.ldr
+	toName := ldr.SymName(to)
+	if toName == "" {
+		return
+	}
+	fromName := ""
+	if parent != 0 {
+		fromName = ldr.SymName(parent)
+	}
+	if d.filter != nil && !d.filter.MatchString(toName) && (parent == 0 || !d.filter.MatchString(fromName)) {
+		return
+	}
+
+	if !d.json {
+		if ldr.AttrUsedInIface(to) {
+			toName += " <UsedInIface>"
+		}
+		from := "_"
+		if parent != 0 {
+			from = fromName
+			if ldr.AttrUsedInIface(parent) {
+				from += " <UsedInIface>"
+			}
+		}
+		fmt.Fprintf(d.w, "%s -> %s\n", from, toName)
+		return
+	}
+
+	sym := func(s loader.Sym, name string) depSym {
+		return depSym{
+			Name:        name,
+			Package:     symPackage(ldr, s),
+			Size:        ldr.SymSize(s),
+			UsedInIface: ldr.AttrUsedInIface(s),
+		}
+	}
+	e := depEdge{To: sym(to, toName), Reason: why.String()}
+	if parent != 0 {
+		from := sym(parent, fromName)
+		e.From = &from
+	}
+	if err := d.enc.Encode(e); err != nil {
+		Exitf("-dumpdep: %v", err)
+	}
+}
+
+// close flushes the edges written.
+func (d *depDumper) close() {
+	if err := d.w.Flush(); err != nil {
+		Exitf("-dumpdep: %v", err)
+	}
+	if d.f != nil {
+		if err := d.f.Close(); err != nil {
+			Exitf("-dumpdep: %v", err)
+		}
+	}
+}
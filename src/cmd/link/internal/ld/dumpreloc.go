@@ -0,0 +1,224 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bufio"
+	"cmd/internal/sys"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Support for -dumpreloc, which writes out every relocation handed
+// to the external linker, one per line:
+//
+//	section	symbol+offset	target+addend	go-type	host-types
+//
+// host-types lists the object file relocation types written for the
+// Go relocation, in order, separated by commas. The lines are sorted
+// and contain no addresses, so that the output of two links can be
+// compared with diff.
+
+// relocDumper collects the relocations for -dumpreloc. It is safe
+// for concurrent use, as relocation sections are written in parallel.
+type relocDumper struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// add records the external relocation rr, computed from relocation r
+// of symbol s in section sect. host holds the bytes written to the
+// output file for it.
+func (d *relocDumper) add(ctxt *Link, sect *sym.Section, s loader.Sym, r loader.Reloc, rr loader.ExtReloc, host []byte) {
+	ldr := ctxt.loader
+	line := fmt.Sprintf("%s\t%s+%#x\t%s%+d\t%s\t%s\n",
+		sect.Name, ldr.SymName(s), r.Off(), ldr.SymName(rr.Xsym), rr.Xadd,
+		sym.RelocName(ctxt.Arch, r.Type()), strings.Join(hostRelocTypes(ctxt, host), ","))
+	d.mu.Lock()
+	d.lines = append(d.lines, line)
+	d.mu.Unlock()
+}
+
+// write writes the collected relocations to the file named by
+// -dumpreloc.
+func (d *relocDumper) write(ctxt *Link) {
+	// Relocations are collected in parallel, so sort them. As
+	// each line starts with the section name, this also groups
+	// them by section.
+	sort.Strings(d.lines)
+
+	f, err := os.Create(*flagDumpReloc)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "# %s/%s %s\n", &ctxt.HeadType, ctxt.Arch.Name, &ctxt.BuildMode)
+	for _, line := range d.lines {
+		w.WriteString(line)
+	}
+	if err := w.Flush(); err != nil {
+		Exitf("%v", err)
+	}
+	if err := f.Close(); err != nil {
+		Exitf("%v", err)
+	}
+}
+
+// hostRelocTypes decodes the relocation entries in b, as written by
+// the architecture's Elfreloc1, Machoreloc1, PEreloc1 or Xcoffreloc1,
+// and returns the names of their types.
+func hostRelocTypes(ctxt *Link, b []byte) []string {
+	var names []string
+	bo := ctxt.Arch.ByteOrder
+	switch {
+	case ctxt.IsELF:
+		size := ctxt.Arch.RegSize * 2
+		if elfRelType == ".rela" {
+			size += ctxt.Arch.RegSize
+		}
+		for ; len(b) >= size; b = b[size:] {
+			var t uint32
+			switch {
+			case ctxt.Arch.Family == sys.MIPS64:
+				// The type is the last byte of r_info, see
+				// mips64.elfreloc1.
+				t = uint32(b[15])
+			case ctxt.Arch.RegSize == 8:
+				t = uint32(bo.Uint64(b[8:]))
+			default:
+				t = uint32(uint8(bo.Uint32(b[4:])))
+			}
+			names = append(names, elfRelocTypeString(ctxt.Arch, t))
+		}
+	case ctxt.IsDarwin():
+		for ; len(b) >= 8; b = b[8:] {
+			t := bo.Uint32(b[4:]) >> 28
+			switch ctxt.Arch.Family {
+			case sys.AMD64:
+				names = append(names, macho.RelocTypeX86_64(t).String())
+			case sys.ARM64:
+				names = append(names, macho.RelocTypeARM64(t).String())
+			default:
+				names = append(names, macho.RelocTypeGeneric(t).String())
+			}
+		}
+	case ctxt.IsWindows():
+		for ; len(b) >= 10; b = b[10:] {
+			t := bo.Uint16(b[8:])
+			name, ok := peRelocTypeNames[ctxt.Arch.Family][t]
+			if !ok {
+				name = fmt.Sprintf("%#x", t)
+			}
+			names = append(names, name)
+		}
+	case ctxt.IsAIX():
+		for ; len(b) >= RELSZ_64; b = b[RELSZ_64:] {
+			t := uint8(bo.Uint16(b[12:]))
+			name, ok := xcoffRelocTypeNames[t]
+			if !ok {
+				name = fmt.Sprintf("%#x", t)
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func elfRelocTypeString(arch *sys.Arch, t uint32) string {
+	switch arch.Family {
+	case sys.AMD64:
+		return elf.R_X86_64(t).String()
+	case sys.I386:
+		return elf.R_386(t).String()
+	case sys.ARM:
+		return elf.R_ARM(t).String()
+	case sys.ARM64:
+		return elf.R_AARCH64(t).String()
+	case sys.MIPS, sys.MIPS64:
+		return elf.R_MIPS(t).String()
+	case sys.PPC64:
+		return elf.R_PPC64(t).String()
+	case sys.RISCV64:
+		return elf.R_RISCV(t).String()
+	case sys.S390X:
+		return elf.R_390(t).String()
+	}
+	return fmt.Sprintf("%#x", t)
+}
+
+var peRelocTypeNames = map[sys.ArchFamily]map[uint16]string{
+	sys.I386: {
+		IMAGE_REL_I386_DIR32:  "IMAGE_REL_I386_DIR32",
+		IMAGE_REL_I386_SECREL: "IMAGE_REL_I386_SECREL",
+		IMAGE_REL_I386_REL32:  "IMAGE_REL_I386_REL32",
+	},
+	sys.AMD64: {
+		IMAGE_REL_AMD64_ADDR64: "IMAGE_REL_AMD64_ADDR64",
+		IMAGE_REL_AMD64_ADDR32: "IMAGE_REL_AMD64_ADDR32",
+		IMAGE_REL_AMD64_REL32:  "IMAGE_REL_AMD64_REL32",
+		IMAGE_REL_AMD64_SECREL: "IMAGE_REL_AMD64_SECREL",
+	},
+	sys.ARM: {
+		IMAGE_REL_ARM_ABSOLUTE: "IMAGE_REL_ARM_ABSOLUTE",
+		IMAGE_REL_ARM_ADDR32:   "IMAGE_REL_ARM_ADDR32",
+		IMAGE_REL_ARM_ADDR32NB: "IMAGE_REL_ARM_ADDR32NB",
+		IMAGE_REL_ARM_BRANCH24: "IMAGE_REL_ARM_BRANCH24",
+		IMAGE_REL_ARM_BRANCH11: "IMAGE_REL_ARM_BRANCH11",
+		IMAGE_REL_ARM_SECREL:   "IMAGE_REL_ARM_SECREL",
+	},
+	sys.ARM64: {
+		IMAGE_REL_ARM64_ABSOLUTE:       "IMAGE_REL_ARM64_ABSOLUTE",
+		IMAGE_REL_ARM64_ADDR32:         "IMAGE_REL_ARM64_ADDR32",
+		IMAGE_REL_ARM64_ADDR32NB:       "IMAGE_REL_ARM64_ADDR32NB",
+		IMAGE_REL_ARM64_BRANCH26:       "IMAGE_REL_ARM64_BRANCH26",
+		IMAGE_REL_ARM64_PAGEBASE_REL21: "IMAGE_REL_ARM64_PAGEBASE_REL21",
+		IMAGE_REL_ARM64_REL21:          "IMAGE_REL_ARM64_REL21",
+		IMAGE_REL_ARM64_PAGEOFFSET_12A: "IMAGE_REL_ARM64_PAGEOFFSET_12A",
+		IMAGE_REL_ARM64_PAGEOFFSET_12L: "IMAGE_REL_ARM64_PAGEOFFSET_12L",
+		IMAGE_REL_ARM64_SECREL:         "IMAGE_REL_ARM64_SECREL",
+		IMAGE_REL_ARM64_SECREL_LOW12A:  "IMAGE_REL_ARM64_SECREL_LOW12A",
+		IMAGE_REL_ARM64_SECREL_HIGH12A: "IMAGE_REL_ARM64_SECREL_HIGH12A",
+		IMAGE_REL_ARM64_SECREL_LOW12L:  "IMAGE_REL_ARM64_SECREL_LOW12L",
+		IMAGE_REL_ARM64_TOKEN:          "IMAGE_REL_ARM64_TOKEN",
+		IMAGE_REL_ARM64_SECTION:        "IMAGE_REL_ARM64_SECTION",
+		IMAGE_REL_ARM64_ADDR64:         "IMAGE_REL_ARM64_ADDR64",
+		IMAGE_REL_ARM64_BRANCH19:       "IMAGE_REL_ARM64_BRANCH19",
+		IMAGE_REL_ARM64_BRANCH14:       "IMAGE_REL_ARM64_BRANCH14",
+		IMAGE_REL_ARM64_REL32:          "IMAGE_REL_ARM64_REL32",
+	},
+}
+
+var xcoffRelocTypeNames = map[uint8]string{
+	XCOFF_R_POS:    "R_POS",
+	XCOFF_R_NEG:    "R_NEG",
+	XCOFF_R_REL:    "R_REL",
+	XCOFF_R_TOC:    "R_TOC",
+	XCOFF_R_TRL:    "R_TRL",
+	XCOFF_R_TRLA:   "R_TRLA",
+	XCOFF_R_GL:     "R_GL",
+	XCOFF_R_TCL:    "R_TCL",
+	XCOFF_R_RL:     "R_RL",
+	XCOFF_R_RLA:    "R_RLA",
+	XCOFF_R_REF:    "R_REF",
+	XCOFF_R_BA:     "R_BA",
+	XCOFF_R_RBA:    "R_RBA",
+	XCOFF_R_BR:     "R_BR",
+	XCOFF_R_RBR:    "R_RBR",
+	XCOFF_R_TLS:    "R_TLS",
+	XCOFF_R_TLS_IE: "R_TLS_IE",
+	XCOFF_R_TLS_LD: "R_TLS_LD",
+	XCOFF_R_TLS_LE: "R_TLS_LE",
+	XCOFF_R_TLSM:   "R_TLSM",
+	XCOFF_R_TLSML:  "R_TLSML",
+	XCOFF_R_TOCU:   "R_TOCU",
+	XCOFF_R_TOCL:   "R_TOCL",
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/obj"
+	"cmd/link/internal/loadelf"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"fmt"
+)
+
+// Reporting of symbols defined both by a Go package and a host object,
+// or by two host objects:
+//
+//	duplicate symbol dup:
+//		defined by Go package main ($WORK/b001/_pkg_.a) at /src/main.go:8, size 6
+//		defined again by $WORK/b001/_pkg_.a(dup.syso), section .text, size 11, strong
+//
+// A definition by a host object names the object, its section holding
+// the symbol, the size of the symbol and whether it is weak or strong.
+// A definition by a Go package names the package and its object, and
+// for a function, its source position. A symbol exported from Go with
+// //export is defined by the C function cgo writes to call the Go
+// function, which is named on a line of its own.
+
+// reportDupSym reports the duplicate definition e.
+func reportDupSym(ctxt *Link, e *loadelf.DupSymError) {
+	ldr := ctxt.loader
+	var prev string
+	if e.Prev != nil {
+		prev = "defined by " + hostDefString(e.Prev)
+	} else {
+		// Describe the Go function rather than its ABI wrapper.
+		s := e.Sym
+		if fn := ldr.Lookup(e.Name, sym.SymVerABIInternal); fn != 0 && !ldr.IsExternal(fn) {
+			s = fn
+		}
+		prev = "defined by Go package " + ldr.SymPkg(s)
+		if unit := ldr.SymUnit(s); unit != nil {
+			prev += " (" + unit.Lib.File + ")"
+		}
+		if pos := funcPos(ctxt, s); pos != "" {
+			prev += " at " + pos
+		}
+		prev += fmt.Sprintf(", size %d", ldr.SymSize(s))
+	}
+	msg := fmt.Sprintf("duplicate symbol %s:\n\t%s\n\tdefined again by %s", e.Name, prev, hostDefString(&e.Def))
+	if ldr.AttrCgoExportDynamic(e.Sym) || ldr.AttrCgoExportStatic(e.Sym) {
+		// The function cgo writes for //export has the name of
+		// the Go function, in the package of its object.
+		pkgs := []string{e.Def.Pkg}
+		if e.Prev != nil {
+			pkgs = append([]string{e.Prev.Pkg}, pkgs...)
+		}
+		for _, pkg := range pkgs {
+			fn := ldr.Lookup(pkg+"."+e.Name, sym.SymVerABIInternal)
+			if fn == 0 || ldr.IsExternal(fn) {
+				continue
+			}
+			msg += "\n\texported from Go by " + ldr.SymName(fn)
+			if pos := funcPos(ctxt, fn); pos != "" {
+				msg += " at " + pos
+			}
+			break
+		}
+	}
+	Errorf(nil, "%s", msg)
+}
+
+// hostDefString describes the definition d by a host object.
+func hostDefString(d *loadelf.SymDef) string {
+	bind := "strong"
+	if d.Weak {
+		bind = "weak"
+	}
+	return fmt.Sprintf("%s, section %s, size %d, %s", d.File, d.Sect, d.Size, bind)
+}
+
+// funcPos returns the source position of the start of the Go function
+// s, or "" if s is not one.
+func funcPos(ctxt *Link, s loader.Sym) string {
+	ldr := ctxt.loader
+	unit := ldr.SymUnit(s)
+	if fi := ldr.FuncInfo(s); unit == nil || !fi.Valid() {
+		return ""
+	}
+	_, pcfile, pcline, _, _ := ldr.PcdataAuxs(s, nil)
+	if pcfile == 0 || pcline == 0 {
+		return ""
+	}
+	// The values of pcfile index the file table of the unit.
+	it := obj.NewPCIter(uint32(ctxt.Arch.MinLC))
+	it.Init(ldr.Data(pcfile))
+	if it.Done || it.Value < 0 || int(it.Value) >= len(unit.FileTable) {
+		return ""
+	}
+	file := expandFile(unit.FileTable[it.Value])
+	it.Init(ldr.Data(pcline))
+	if it.Done {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", file, it.Value)
+}
@@ -1139,7 +1139,7 @@ func expandFile(fname string) string {
 	if strings.HasPrefix(fname, src.FileSymPrefix) {
 		fname = fname[len(src.FileSymPrefix):]
 	}
-	return expandGoroot(fname)
+	return remapPath(expandGoroot(fname))
 }
 
 // writeDirFileTables emits the portion of the DWARF line table
@@ -1147,7 +1147,9 @@ func expandFile(fname string) string {
 // described in section 6.2.4 of the DWARF 4 standard. It walks the
 // filepaths for the unit to discover any common directories, which
 // are emitted to the directory table first, then the file table is
-// emitted after that.
+// emitted after that. With -dwarf=5, the tables have the format of
+// section 6.2.4 of the DWARF 5 standard instead, in which entry 0 of
+// each is the one of the compilation unit.
 func (d *dwctxt) writeDirFileTables(unit *sym.CompilationUnit, lsu *loader.SymbolBuilder) {
 	type fileDir struct {
 		base string
@@ -1192,9 +1194,38 @@ func (d *dwctxt) writeDirFileTables(unit *sym.CompilationUnit, lsu *loader.Symbo
 		}
 	}
 
+	lsDwsym := dwSym(lsu.Sym())
+	if dwarf5() {
+		lsu.AddUint8(1) // directory_entry_format_count
+		lsu.AddUleb(dwarf.DW_LNCT_path)
+		lsu.AddUleb(dwarf.DW_FORM_string)
+		lsu.AddUleb(uint64(len(dirs)))
+		d.AddString(lsDwsym, getCompilationDir())
+		for k := 1; k < len(dirs); k++ {
+			d.AddString(lsDwsym, dirs[k])
+		}
+
+		// File 0 is the primary source file of the unit, which a
+		// Go package does not have. Repeat the first file, so that
+		// the compiler's file numbers, which start at 1, still hold.
+		if len(files) > 0 {
+			files = append([]fileDir{files[0]}, files...)
+		}
+		lsu.AddUint8(2) // file_name_entry_format_count
+		lsu.AddUleb(dwarf.DW_LNCT_path)
+		lsu.AddUleb(dwarf.DW_FORM_string)
+		lsu.AddUleb(dwarf.DW_LNCT_directory_index)
+		lsu.AddUleb(dwarf.DW_FORM_udata)
+		lsu.AddUleb(uint64(len(files)))
+		for k := 0; k < len(files); k++ {
+			d.AddString(lsDwsym, files[k].base)
+			dwarf.Uleb128put(d, lsDwsym, int64(files[k].dir))
+		}
+		return
+	}
+
 	// Emit directory section. This is a series of nul terminated
 	// strings, followed by a single zero byte.
-	lsDwsym := dwSym(lsu.Sym())
 	for k := 1; k < len(dirs); k++ {
 		d.AddString(lsDwsym, dirs[k])
 	}
@@ -1236,13 +1267,22 @@ func (d *dwctxt) writelines(unit *sym.CompilationUnit, lineProlog loader.Sym) []
 	unitLengthOffset := lsu.Size()
 	d.createUnitLength(lsu, 0) // unit_length (*), filled in at end
 	unitstart = lsu.Size()
-	lsu.AddUint16(d.arch, 2) // dwarf version (appendix F) -- version 3 is incompatible w/ XCode 9.0's dsymutil, latest supported on OSX 10.12 as of 2018-05
+	if dwarf5() {
+		lsu.AddUint16(d.arch, 5)            // dwarf version
+		lsu.AddUint8(uint8(d.arch.PtrSize)) // address_size
+		lsu.AddUint8(0)                     // segment_selector_size
+	} else {
+		lsu.AddUint16(d.arch, 2) // dwarf version (appendix F) -- version 3 is incompatible w/ XCode 9.0's dsymutil, latest supported on OSX 10.12 as of 2018-05
+	}
 	headerLengthOffset := lsu.Size()
 	d.addDwarfAddrField(lsu, 0) // header_length (*), filled in at end
 	headerstart = lsu.Size()
 
 	// cpos == unitstart + 4 + 2 + 4
-	lsu.AddUint8(1)                // minimum_instruction_length
+	lsu.AddUint8(1) // minimum_instruction_length
+	if dwarf5() {
+		lsu.AddUint8(1) // maximum_operations_per_instruction
+	}
 	lsu.AddUint8(is_stmt)          // default_is_stmt
 	lsu.AddUint8(LINE_BASE & 0xFF) // line_base
 	lsu.AddUint8(LINE_RANGE)       // line_range
@@ -1302,10 +1342,18 @@ func (d *dwctxt) writepcranges(unit *sym.CompilationUnit, base loader.Sym, pcs [
 	rsu := d.ldr.MakeSymbolUpdater(rangeProlog)
 	rDwSym := dwSym(rangeProlog)
 
+	if dwarf5() {
+		d.putListsHeader(rsu)
+	}
+
 	// Create PC ranges for the compilation unit DIE.
 	newattr(unit.DWInfo, dwarf.DW_AT_ranges, dwarf.DW_CLS_PTR, rsu.Size(), rDwSym)
 	newattr(unit.DWInfo, dwarf.DW_AT_low_pc, dwarf.DW_CLS_ADDRESS, 0, dwSym(base))
-	dwarf.PutBasedRanges(d, rDwSym, pcs)
+	if dwarf5() {
+		d.putRnglist(rsu, pcs)
+	} else {
+		dwarf.PutBasedRanges(d, rDwSym, pcs)
+	}
 
 	// Collect up the ranges for functions in the unit.
 	rsize := uint64(rsu.Size())
@@ -1314,6 +1362,9 @@ func (d *dwctxt) writepcranges(unit *sym.CompilationUnit, base loader.Sym, pcs [
 		syms = append(syms, s)
 		rsize += uint64(d.ldr.SymSize(s))
 	}
+	if dwarf5() {
+		d.setUnitLength(rsu, int64(rsize))
+	}
 
 	if d.linkctxt.HeadType == objabi.Haix {
 		addDwsectCUSize(".debug_ranges", unit.Lib.Pkg, rsize)
@@ -1350,7 +1401,87 @@ func appendPCDeltaCFA(arch *sys.Arch, b []byte, deltapc, cfa int64) []byte {
 	return b
 }
 
-func (d *dwctxt) writeframes(fs loader.Sym) dwarfSecInfo {
+// appendCIEInstructions appends to b the initial instructions of the
+// CIE, which describe the frame on entry to a function.
+func (d *dwctxt) appendCIEInstructions(b []byte) []byte {
+	b = append(b, dwarf.DW_CFA_def_cfa)                    // Set the current frame address..
+	b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfregsp)) // ...to use the value in the platform's SP register (defined in l.go)...
+	if haslinkregister(d.linkctxt) {
+		b = dwarf.AppendUleb128(b, 0) // ...plus a 0 offset.
+
+		b = append(b, dwarf.DW_CFA_same_value) // The platform's link register is unchanged during the prologue.
+		b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfreglr))
+
+		b = append(b, dwarf.DW_CFA_val_offset)                 // The previous value...
+		b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfregsp)) // ...of the platform's SP register...
+		b = dwarf.AppendUleb128(b, 0)                          // ...is CFA+0.
+	} else {
+		b = dwarf.AppendUleb128(b, uint64(d.arch.PtrSize)) // ...plus the word size (because the call instruction implicitly adds one word to the frame).
+
+		b = append(b, dwarf.DW_CFA_offset_extended)                                    // The previous value...
+		b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfreglr))                         // ...of the return address...
+		b = dwarf.AppendUleb128(b, uint64(int64(-d.arch.PtrSize)/dataAlignmentFactor)) // ...is saved at [CFA - (PtrSize/4)].
+	}
+	return b
+}
+
+// appendFDEInstructions appends to b the instructions of the FDE of
+// the function fn, of the given size, which track its frame size
+// through its pcsp table.
+func (d *dwctxt) appendFDEInstructions(b []byte, pcsp *obj.PCIter, fn loader.Sym, fi loader.FuncInfo, size int64) []byte {
+	haslr := haslinkregister(d.linkctxt)
+	if haslr && fi.TopFrame() {
+		// Mark the link register as having an undefined value.
+		// This stops call stack unwinders progressing any further.
+		// TODO: similar mark on non-LR architectures.
+		b = append(b, dwarf.DW_CFA_undefined)
+		b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfreglr))
+	}
+
+	for pcsp.Init(d.ldr.Data(d.ldr.Pcsp(fn))); !pcsp.Done; pcsp.Next() {
+		nextpc := pcsp.NextPC
+
+		// pciterinit goes up to the end of the function,
+		// but DWARF expects us to stop just before the end.
+		if int64(nextpc) == size {
+			nextpc--
+			if nextpc < pcsp.PC {
+				continue
+			}
+		}
+
+		spdelta := int64(pcsp.Value)
+		if !haslr {
+			// Return address has been pushed onto stack.
+			spdelta += int64(d.arch.PtrSize)
+		}
+
+		if haslr && !fi.TopFrame() {
+			// TODO(bryanpkc): This is imprecise. In general, the instruction
+			// that stores the return address to the stack frame is not the
+			// same one that allocates the frame.
+			if pcsp.Value > 0 {
+				// The return address is preserved at (CFA-frame_size)
+				// after a stack frame has been allocated.
+				b = append(b, dwarf.DW_CFA_offset_extended_sf)
+				b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfreglr))
+				b = dwarf.AppendSleb128(b, -spdelta/dataAlignmentFactor)
+			} else {
+				// The return address is restored into the link register
+				// when a stack frame has been de-allocated.
+				b = append(b, dwarf.DW_CFA_same_value)
+				b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfreglr))
+			}
+		}
+
+		b = appendPCDeltaCFA(d.arch, b, int64(nextpc)-int64(pcsp.PC), spdelta)
+	}
+	return b
+}
+
+// writeframes writes .debug_frame to fs, or, if the FDEs are streamed,
+// only the CIE, and returns the chunks of FDEs.
+func (d *dwctxt) writeframes(fs loader.Sym) (dwarfSecInfo, []frameChunk) {
 	fsd := dwSym(fs)
 	fsu := d.ldr.MakeSymbolUpdater(fs)
 	fsu.SetType(sym.SDWARFSECT)
@@ -1379,24 +1510,7 @@ func (d *dwctxt) writeframes(fs loader.Sym) dwarfSecInfo {
 	dwarf.Sleb128put(d, fsd, dataAlignmentFactor)       // all CFI offset calculations include multiplication with this factor
 	dwarf.Uleb128put(d, fsd, int64(thearch.Dwarfreglr)) // return_address_register
 
-	fsu.AddUint8(dwarf.DW_CFA_def_cfa)                  // Set the current frame address..
-	dwarf.Uleb128put(d, fsd, int64(thearch.Dwarfregsp)) // ...to use the value in the platform's SP register (defined in l.go)...
-	if haslr {
-		dwarf.Uleb128put(d, fsd, int64(0)) // ...plus a 0 offset.
-
-		fsu.AddUint8(dwarf.DW_CFA_same_value) // The platform's link register is unchanged during the prologue.
-		dwarf.Uleb128put(d, fsd, int64(thearch.Dwarfreglr))
-
-		fsu.AddUint8(dwarf.DW_CFA_val_offset)               // The previous value...
-		dwarf.Uleb128put(d, fsd, int64(thearch.Dwarfregsp)) // ...of the platform's SP register...
-		dwarf.Uleb128put(d, fsd, int64(0))                  // ...is CFA+0.
-	} else {
-		dwarf.Uleb128put(d, fsd, int64(d.arch.PtrSize)) // ...plus the word size (because the call instruction implicitly adds one word to the frame).
-
-		fsu.AddUint8(dwarf.DW_CFA_offset_extended)                           // The previous value...
-		dwarf.Uleb128put(d, fsd, int64(thearch.Dwarfreglr))                  // ...of the return address...
-		dwarf.Uleb128put(d, fsd, int64(-d.arch.PtrSize)/dataAlignmentFactor) // ...is saved at [CFA - (PtrSize/4)].
-	}
+	fsu.AddBytes(d.appendCIEInstructions(nil))
 
 	pad := int64(cieReserve) + lengthFieldSize - int64(len(d.ldr.Data(fs)))
 
@@ -1409,6 +1523,10 @@ func (d *dwctxt) writeframes(fs loader.Sym) dwarfSecInfo {
 
 	fsu.AddBytes(zeros[:pad])
 
+	if d.streamframes() {
+		return dwarfSecInfo{syms: []loader.Sym{fs}}, d.sizeframes()
+	}
+
 	var deltaBuf []byte
 	pcsp := obj.NewPCIter(uint32(d.arch.MinLC))
 	for _, s := range d.linkctxt.Textp {
@@ -1417,57 +1535,10 @@ func (d *dwctxt) writeframes(fs loader.Sym) dwarfSecInfo {
 		if !fi.Valid() {
 			continue
 		}
-		fpcsp := d.ldr.Pcsp(s)
 
 		// Emit a FDE, Section 6.4.1.
 		// First build the section contents into a byte buffer.
-		deltaBuf = deltaBuf[:0]
-		if haslr && fi.TopFrame() {
-			// Mark the link register as having an undefined value.
-			// This stops call stack unwinders progressing any further.
-			// TODO: similar mark on non-LR architectures.
-			deltaBuf = append(deltaBuf, dwarf.DW_CFA_undefined)
-			deltaBuf = dwarf.AppendUleb128(deltaBuf, uint64(thearch.Dwarfreglr))
-		}
-
-		for pcsp.Init(d.linkctxt.loader.Data(fpcsp)); !pcsp.Done; pcsp.Next() {
-			nextpc := pcsp.NextPC
-
-			// pciterinit goes up to the end of the function,
-			// but DWARF expects us to stop just before the end.
-			if int64(nextpc) == int64(len(d.ldr.Data(fn))) {
-				nextpc--
-				if nextpc < pcsp.PC {
-					continue
-				}
-			}
-
-			spdelta := int64(pcsp.Value)
-			if !haslr {
-				// Return address has been pushed onto stack.
-				spdelta += int64(d.arch.PtrSize)
-			}
-
-			if haslr && !fi.TopFrame() {
-				// TODO(bryanpkc): This is imprecise. In general, the instruction
-				// that stores the return address to the stack frame is not the
-				// same one that allocates the frame.
-				if pcsp.Value > 0 {
-					// The return address is preserved at (CFA-frame_size)
-					// after a stack frame has been allocated.
-					deltaBuf = append(deltaBuf, dwarf.DW_CFA_offset_extended_sf)
-					deltaBuf = dwarf.AppendUleb128(deltaBuf, uint64(thearch.Dwarfreglr))
-					deltaBuf = dwarf.AppendSleb128(deltaBuf, -spdelta/dataAlignmentFactor)
-				} else {
-					// The return address is restored into the link register
-					// when a stack frame has been de-allocated.
-					deltaBuf = append(deltaBuf, dwarf.DW_CFA_same_value)
-					deltaBuf = dwarf.AppendUleb128(deltaBuf, uint64(thearch.Dwarfreglr))
-				}
-			}
-
-			deltaBuf = appendPCDeltaCFA(d.arch, deltaBuf, int64(nextpc)-int64(pcsp.PC), spdelta)
-		}
+		deltaBuf = d.appendFDEInstructions(deltaBuf[:0], pcsp, fn, fi, int64(len(d.ldr.Data(fn))))
 		pad := int(Rnd(int64(len(deltaBuf)), int64(d.arch.PtrSize))) - len(deltaBuf)
 		deltaBuf = append(deltaBuf, zeros[:pad]...)
 
@@ -1497,7 +1568,119 @@ func (d *dwctxt) writeframes(fs loader.Sym) dwarfSecInfo {
 		}
 	}
 
-	return dwarfSecInfo{syms: []loader.Sym{fs}}
+	return dwarfSecInfo{syms: []loader.Sym{fs}}, nil
+}
+
+// When linking an executable internally, the FDEs of .debug_frame,
+// most of the DWARF the linker makes itself rather than copies from
+// the objects, are not kept in memory. writeframes only works out their
+// sizes, and generator symbols, each for a run of FDEs of about
+// frameChunkSize bytes, write them into the output, or into a buffer
+// of that size to be compressed. The instructions of each FDE are
+// computed twice, once for its size and once for its contents.
+
+const frameChunkSize = 64 << 10
+
+// A frameChunk is a run of FDEs of .debug_frame.
+type frameChunk struct {
+	fns   []loader.Sym
+	sizes []int64 // of the functions, whose data may be gone by the time the FDEs are written
+	size  int64   // of the FDEs
+}
+
+// streamframes reports whether the FDEs of .debug_frame are streamed.
+// The addresses of the functions are then known, and the FDEs need no
+// relocations.
+func (d *dwctxt) streamframes() bool {
+	ctxt := d.linkctxt
+	return ctxt.BuildMode == BuildModeExe && ctxt.IsInternal() && !isDwarf64(ctxt)
+}
+
+// sizeframes returns the chunks of the FDEs of the functions.
+func (d *dwctxt) sizeframes() []frameChunk {
+	var chunks []frameChunk
+	var c frameChunk
+	var deltaBuf []byte
+	pcsp := obj.NewPCIter(uint32(d.arch.MinLC))
+	for _, fn := range d.linkctxt.Textp {
+		fi := d.ldr.FuncInfo(fn)
+		if !fi.Valid() {
+			continue
+		}
+		size := int64(len(d.ldr.Data(fn)))
+		deltaBuf = d.appendFDEInstructions(deltaBuf[:0], pcsp, fn, fi, size)
+		c.fns = append(c.fns, fn)
+		c.sizes = append(c.sizes, size)
+		c.size += d.fdeSize(len(deltaBuf))
+		if c.size >= frameChunkSize {
+			chunks = append(chunks, c)
+			c = frameChunk{}
+		}
+	}
+	if len(c.fns) > 0 {
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+// fdeSize returns the size of an FDE with n bytes of instructions,
+// including its length field.
+func (d *dwctxt) fdeSize(n int) int64 {
+	return 4 + 4 + 2*int64(d.arch.PtrSize) + Rnd(int64(n), int64(d.arch.PtrSize))
+}
+
+// appendFDEs appends the FDEs of chunk c to b, as writeframes writes
+// them when they are not streamed.
+func (d *dwctxt) appendFDEs(b []byte, c *frameChunk) []byte {
+	ldr := d.ldr
+	arch := d.arch
+	var deltaBuf []byte
+	var buf [8]byte
+	pcsp := obj.NewPCIter(uint32(arch.MinLC))
+	putAddr := func(b []byte, v uint64) []byte {
+		if arch.PtrSize == 8 {
+			arch.ByteOrder.PutUint64(buf[:], v)
+		} else {
+			arch.ByteOrder.PutUint32(buf[:], uint32(v))
+		}
+		return append(b, buf[:arch.PtrSize]...)
+	}
+	for i, fn := range c.fns {
+		deltaBuf = d.appendFDEInstructions(deltaBuf[:0], pcsp, fn, ldr.FuncInfo(fn), c.sizes[i])
+		pad := int(Rnd(int64(len(deltaBuf)), int64(arch.PtrSize))) - len(deltaBuf)
+		arch.ByteOrder.PutUint32(buf[:], uint32(d.fdeSize(len(deltaBuf))-4))
+		b = append(b, buf[:4]...)
+		b = append(b, 0, 0, 0, 0) // CIE offset
+		b = putAddr(b, uint64(ldr.SymValue(fn)))
+		b = putAddr(b, uint64(c.sizes[i])) // address range
+		b = append(b, deltaBuf...)
+		b = append(b, zeros[:pad]...)
+	}
+	return b
+}
+
+// frameChunkSyms returns the generator symbols for the chunks of FDEs.
+func (d *dwctxt) frameChunkSyms(chunks []frameChunk) []loader.Sym {
+	ctxt := d.linkctxt
+	ldr := d.ldr
+	syms := make([]loader.Sym, len(chunks))
+	for i := range chunks {
+		c := &chunks[i]
+		gen := func(ctxt *Link, s loader.Sym) {
+			P := ctxt.loader.Data(s)
+			if b := d.appendFDEs(P[:0], c); len(b) != len(P) || &b[0] != &P[0] {
+				panic(fmt.Sprintf(".debug_frame: FDEs of %d bytes, want %d", len(b), len(P)))
+			}
+		}
+		s := ldr.CreateExtSym("", 0)
+		ldr.SetIsGeneratedSym(s, true)
+		sb := ldr.MakeSymbolUpdater(s)
+		sb.SetType(sym.SDWARFSECT)
+		sb.SetSize(c.size)
+		ctxt.generatorSyms[s] = gen
+		syms[i] = s
+	}
+	return syms
 }
 
 /*
@@ -1532,12 +1715,21 @@ func (d *dwctxt) writeUnitInfo(u *sym.CompilationUnit, abbrevsym loader.Sym, inf
 	// Fields marked with (*) must be changed for 64-bit dwarf
 	// This must match COMPUNITHEADERSIZE above.
 	d.createUnitLength(su, 0) // unit_length (*), will be filled in later.
-	su.AddUint16(d.arch, 4)   // dwarf version (appendix F)
+	if dwarf5() {
+		// The DWARF 5 header (sec 7.5.1.1) has the unit type,
+		// and the address size before the abbrev offset.
+		su.AddUint16(d.arch, 5)
+		su.AddUint8(dwarf.DW_UT_compile)
+		su.AddUint8(uint8(d.arch.PtrSize))
+		d.addDwarfAddrRef(su, abbrevsym)
+	} else {
+		su.AddUint16(d.arch, 4) // dwarf version (appendix F)
 
-	// debug_abbrev_offset (*)
-	d.addDwarfAddrRef(su, abbrevsym)
+		// debug_abbrev_offset (*)
+		d.addDwarfAddrRef(su, abbrevsym)
 
-	su.AddUint8(uint8(d.arch.PtrSize)) // address_size
+		su.AddUint8(uint8(d.arch.PtrSize)) // address_size
+	}
 
 	ds := dwSym(s)
 	dwarf.Uleb128put(d, ds, int64(compunit.Abbrev))
@@ -1621,10 +1813,7 @@ func (d *dwctxt) writegdbscript() dwarfSecInfo {
 var prototypedies map[string]*dwarf.DWDie
 
 func dwarfEnabled(ctxt *Link) bool {
-	if *FlagW { // disable dwarf
-		return false
-	}
-	if *FlagS && ctxt.HeadType != objabi.Hdarwin {
+	if *FlagW { // disable dwarf, also set by -s
 		return false
 	}
 	if ctxt.HeadType == objabi.Hplan9 || ctxt.HeadType == objabi.Hjs {
@@ -1979,6 +2168,12 @@ type dwUnitSyms struct {
 	rangeProlog loader.Sym
 	infoEpilog  loader.Sym
 
+	// Inputs for -dwarf=5.
+	locProlog     loader.Sym
+	strSym        loader.Sym
+	strOffsetsSym loader.Sym
+	addrSym       loader.Sym
+
 	// Outputs for a given unit.
 	linesyms   []loader.Sym
 	infosyms   []loader.Sym
@@ -1997,11 +2192,20 @@ func (d *dwctxt) dwUnitPortion(u *sym.CompilationUnit, abbrevsym loader.Sym, us
 		base := loader.Sym(u.Textp[0])
 		us.rangessyms = d.writepcranges(u, base, u.PCs, us.rangeProlog)
 		us.locsyms = d.collectUnitLocs(u)
+		if dwarf5() && len(us.locsyms) > 0 {
+			us.locsyms = d.writeloclistsheader(us.locProlog, us.locsyms)
+		}
+	}
+	if dwarf5() {
+		d.writeUnitStrsAddrs(u, us)
 	}
 	us.infosyms = d.writeUnitInfo(u, abbrevsym, us.infoEpilog)
 }
 
 func (d *dwctxt) dwarfGenerateDebugSyms() {
+	if dwarf5() {
+		dwarf.UseVersion5()
+	}
 	abbrevSec := d.writeabbrev()
 	dwarfp = append(dwarfp, abbrevSec)
 	d.calcCompUnitRanges()
@@ -2030,10 +2234,14 @@ func (d *dwctxt) dwarfGenerateDebugSyms() {
 	}
 
 	// Create the section symbols.
+	locName, rangesName := ".debug_loc", ".debug_ranges"
+	if dwarf5() {
+		locName, rangesName = ".debug_loclists", ".debug_rnglists"
+	}
 	frameSym := mkSecSym(".debug_frame")
-	locSym := mkSecSym(".debug_loc")
+	locSym := mkSecSym(locName)
 	lineSym := mkSecSym(".debug_line")
-	rangesSym := mkSecSym(".debug_ranges")
+	rangesSym := mkSecSym(rangesName)
 	infoSym := mkSecSym(".debug_info")
 
 	// Create the section objects
@@ -2041,7 +2249,14 @@ func (d *dwctxt) dwarfGenerateDebugSyms() {
 	locSec := dwarfSecInfo{syms: []loader.Sym{locSym}}
 	rangesSec := dwarfSecInfo{syms: []loader.Sym{rangesSym}}
 	frameSec := dwarfSecInfo{syms: []loader.Sym{frameSym}}
+	var frameChunks []frameChunk
 	infoSec := dwarfSecInfo{syms: []loader.Sym{infoSym}}
+	var strSec, strOffsetsSec, addrSec dwarfSecInfo
+	if dwarf5() {
+		strSec.syms = []loader.Sym{mkSecSym(".debug_str")}
+		strOffsetsSec.syms = []loader.Sym{mkSecSym(".debug_str_offsets")}
+		addrSec.syms = []loader.Sym{mkSecSym(".debug_addr")}
+	}
 
 	// Create any new symbols that will be needed during the
 	// parallel portion below.
@@ -2052,6 +2267,16 @@ func (d *dwctxt) dwarfGenerateDebugSyms() {
 		us.lineProlog = mkAnonSym(sym.SDWARFLINES)
 		us.rangeProlog = mkAnonSym(sym.SDWARFRANGE)
 		us.infoEpilog = mkAnonSym(sym.SDWARFFCN)
+		if dwarf5() {
+			u := d.linkctxt.compUnits[i]
+			if u.DWInfo.Abbrev != dwarf.DW_ABRV_COMPUNIT_TEXTLESS {
+				d.convertUnitLists(u)
+			}
+			us.locProlog = mkAnonSym(sym.SDWARFLOC)
+			us.strSym = mkAnonSym(sym.SDWARFCUINFO)
+			us.strOffsetsSym = mkAnonSym(sym.SDWARFCUINFO)
+			us.addrSym = mkAnonSym(sym.SDWARFCUINFO)
+		}
 	}
 
 	var wg sync.WaitGroup
@@ -2066,7 +2291,7 @@ func (d *dwctxt) dwarfGenerateDebugSyms() {
 			<-sema
 			wg.Done()
 		}()
-		frameSec = d.writeframes(frameSym)
+		frameSec, frameChunks = d.writeframes(frameSym)
 	}()
 
 	// Create a goroutine per comp unit to handle the generation that
@@ -2094,12 +2319,20 @@ func (d *dwctxt) dwarfGenerateDebugSyms() {
 	}
 
 	// Stitch together the results.
+	frameSec.syms = append(frameSec.syms, markReachable(d.frameChunkSyms(frameChunks))...)
 	for i := 0; i < ncu; i++ {
 		r := &unitSyms[i]
 		lineSec.syms = append(lineSec.syms, markReachable(r.linesyms)...)
 		infoSec.syms = append(infoSec.syms, markReachable(r.infosyms)...)
 		locSec.syms = append(locSec.syms, markReachable(r.locsyms)...)
 		rangesSec.syms = append(rangesSec.syms, markReachable(r.rangessyms)...)
+		if dwarf5() && d.ldr.SymSize(r.strOffsetsSym) != 0 {
+			strSec.syms = append(strSec.syms, markReachable([]loader.Sym{r.strSym})...)
+			strOffsetsSec.syms = append(strOffsetsSec.syms, markReachable([]loader.Sym{r.strOffsetsSym})...)
+		}
+		if dwarf5() && d.ldr.SymSize(r.addrSym) != 0 {
+			addrSec.syms = append(addrSec.syms, markReachable([]loader.Sym{r.addrSym})...)
+		}
 	}
 	dwarfp = append(dwarfp, lineSec)
 	dwarfp = append(dwarfp, frameSec)
@@ -2112,6 +2345,23 @@ func (d *dwctxt) dwarfGenerateDebugSyms() {
 		dwarfp = append(dwarfp, locSec)
 	}
 	dwarfp = append(dwarfp, rangesSec)
+	if dwarf5() {
+		var namesSec dwarfSecInfo
+		if *flagDWARFNames {
+			namesSym := mkAnonSym(sym.SDWARFCUINFO)
+			namesStrSym := mkAnonSym(sym.SDWARFCUINFO)
+			d.writeDebugNames(unitSyms, namesSym, namesStrSym)
+			strSec.syms = append(strSec.syms, markReachable([]loader.Sym{namesStrSym})...)
+			namesSec.syms = append([]loader.Sym{mkSecSym(".debug_names")}, markReachable([]loader.Sym{namesSym})...)
+		}
+		dwarfp = append(dwarfp, strSec, strOffsetsSec)
+		if len(addrSec.syms) > 1 {
+			dwarfp = append(dwarfp, addrSec)
+		}
+		if namesSec.secSym() != 0 {
+			dwarfp = append(dwarfp, namesSec)
+		}
+	}
 
 	// Check to make sure we haven't listed any symbols more than once
 	// in the info section. This used to be done by setting and
@@ -2155,12 +2405,16 @@ func dwarfaddshstrings(ctxt *Link, shstrtab *loader.SymbolBuilder) {
 	}
 
 	secs := []string{"abbrev", "frame", "info", "loc", "line", "gdb_scripts", "ranges"}
+	if dwarf5() {
+		secs = []string{"abbrev", "frame", "info", "loclists", "line", "gdb_scripts", "rnglists", "str", "str_offsets", "addr"}
+		if *flagDWARFNames {
+			secs = append(secs, "names")
+		}
+	}
 	for _, sec := range secs {
 		shstrtab.Addstring(".debug_" + sec)
 		if ctxt.IsExternal() {
 			shstrtab.Addstring(elfRelType + ".debug_" + sec)
-		} else {
-			shstrtab.Addstring(".zdebug_" + sec)
 		}
 	}
 }
@@ -2183,7 +2437,9 @@ func dwarfaddelfsectionsyms(ctxt *Link) {
 
 // dwarfcompress compresses the DWARF sections. Relocations are applied
 // on the fly. After this, dwarfp will contain a different (new) set of
-// symbols, and sections may have been replaced.
+// symbols, and sections may have been replaced. If the DWARF is
+// streamed to the output, it leaves the compression to writeDWARF,
+// unless -sizecheck or -sizereport needs the sizes beforehand.
 func dwarfcompress(ctxt *Link) {
 	// compressedSect is a helper type for parallelizing compression.
 	type compressedSect struct {
@@ -2193,10 +2449,16 @@ func dwarfcompress(ctxt *Link) {
 	}
 
 	supported := ctxt.IsELF || ctxt.IsWindows() || ctxt.IsDarwin()
-	if !ctxt.compressDWARF || !supported || ctxt.IsExternal() {
+	if ctxt.compressDWARF == dwarfCompressNone || !supported || ctxt.IsExternal() {
+		return
+	}
+	if ctxt.streamTail() && *flagSizeCheck == "" && *flagSizeReport == "" {
+		ctxt.compressDWARFLate = true
 		return
 	}
 
+	// The relocations are applied in parallel, by compressSyms.
+	flush := ctxt.deferErrors()
 	var compressedCount int
 	resChannel := make(chan compressedSect)
 	for i := range dwarfp {
@@ -2210,6 +2472,7 @@ func dwarfcompress(ctxt *Link) {
 		r := <-resChannel
 		res[r.index] = r
 	}
+	flush()
 
 	ldr := ctxt.loader
 	var newDwarfp []dwarfSecInfo
@@ -2223,8 +2486,17 @@ func dwarfcompress(ctxt *Link) {
 			Segdwarf.Sections = append(Segdwarf.Sections, ldr.SymSect(s))
 		} else {
 			compressedSegName := ".zdebug_" + ldr.SymSect(s).Name[len(".debug_"):]
-			sect := addsection(ctxt.loader, ctxt.Arch, &Segdwarf, compressedSegName, 04)
-			sect.Align = 1
+			var sect *sym.Section
+			if ctxt.IsELF {
+				// ELF compressed sections keep their names, and
+				// are aligned for their compression header.
+				sect = addsection(ctxt.loader, ctxt.Arch, &Segdwarf, ldr.SymSect(s).Name, 04)
+				sect.Align = int32(ctxt.Arch.PtrSize)
+				sect.Compressed = true
+			} else {
+				sect = addsection(ctxt.loader, ctxt.Arch, &Segdwarf, compressedSegName, 04)
+				sect.Align = 1
+			}
 			sect.Length = uint64(len(z.compressed))
 			newSym := ldr.CreateSymForUpdate(compressedSegName, 0)
 			newSym.SetData(z.compressed)
@@ -2249,8 +2521,11 @@ func dwarfcompress(ctxt *Link) {
 	var prevSect *sym.Section
 	for _, si := range dwarfp {
 		for _, s := range si.syms {
-			ldr.SetSymValue(s, int64(pos))
 			sect := ldr.SymSect(s)
+			if sect != prevSect && sect.Compressed {
+				pos = uint64(Rnd(int64(pos), int64(sect.Align)))
+			}
+			ldr.SetSymValue(s, int64(pos))
 			if sect != prevSect {
 				sect.Vaddr = uint64(pos)
 				prevSect = sect
@@ -2267,6 +2542,82 @@ func dwarfcompress(ctxt *Link) {
 	Segdwarf.Length = pos - Segdwarf.Vaddr
 }
 
+// writeDWARF writes the DWARF sections that dwarfcompress left to it
+// to the streamed tail of the output, compressing each one as it goes,
+// and then lays out the sections and their symbols again, as
+// dwarfcompress would have.
+func writeDWARF(ctxt *Link) {
+	ldr := ctxt.loader
+	out := ctxt.Out
+	fileoff := func(va uint64) int64 {
+		return int64(va - Segdwarf.Vaddr + Segdwarf.Fileoff)
+	}
+
+	// The relocations of a section may refer to the symbols of any
+	// other, so nothing moves until all are written.
+	type placement struct {
+		vaddr, length uint64
+		compressed    bool
+	}
+	place := make([]placement, len(dwarfp))
+	pos := Segdwarf.Vaddr
+	for i, si := range dwarfp {
+		sect := ldr.SymSect(si.syms[0])
+		total := int64(sect.Length)
+		start := uint64(Rnd(int64(pos), int64(ctxt.Arch.PtrSize)))
+		out.SeekSet(fileoff(start))
+		writeCompressedSyms(ctxt, out, si.syms, total)
+		if n := out.Offset() - fileoff(start); n < total {
+			place[i] = placement{start, uint64(n), true}
+			pos = start + uint64(n)
+			for _, s := range si.syms {
+				ldr.FreeData(s)
+			}
+			continue
+		}
+
+		// Compression didn't help.
+		out.Rewind(fileoff(pos))
+		writeBlock(ctxt, out, ldr, si.syms, int64(sect.Vaddr), total, zeros[:])
+		place[i] = placement{pos, uint64(total), false}
+		pos += uint64(total)
+	}
+
+	for i, si := range dwarfp {
+		s := si.syms[0]
+		sect := ldr.SymSect(s)
+		p := place[i]
+		if !p.compressed {
+			delta := int64(p.vaddr) - int64(sect.Vaddr)
+			for _, s := range si.syms {
+				ldr.SetSymValue(s, ldr.SymValue(s)+delta)
+			}
+			sect.Vaddr = p.vaddr
+			continue
+		}
+
+		// ELF compressed sections keep their names, and are
+		// aligned for their compression header.
+		sect.Align = int32(ctxt.Arch.PtrSize)
+		sect.Compressed = true
+		sect.Vaddr = p.vaddr
+		sect.Length = p.length
+		newSym := ldr.CreateSymForUpdate(".zdebug_"+sect.Name[len(".debug_"):], 0)
+		newSym.SetSize(int64(p.length))
+		ldr.SetSymSect(newSym.Sym(), sect)
+		ldr.SetSymValue(newSym.Sym(), int64(p.vaddr))
+		dwarfp[i] = dwarfSecInfo{syms: []loader.Sym{newSym.Sym()}}
+
+		// compressed symbols are no longer needed.
+		for _, s := range si.syms {
+			ldr.SetAttrReachable(s, false)
+			ldr.FreeSym(s)
+		}
+	}
+	Segdwarf.Length = pos - Segdwarf.Vaddr
+	Segdwarf.Filelen = Segdwarf.Length
+}
+
 type compilationUnitByStartPC []*sym.CompilationUnit
 
 func (v compilationUnitByStartPC) Len() int      { return len(v) }
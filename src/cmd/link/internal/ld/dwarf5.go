@@ -0,0 +1,275 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/dwarf"
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+)
+
+// Support for -dwarf=5, which writes DWARF version 5 rather than 4.
+//
+// The compiler writes the DIEs of functions, types and variables as
+// for DWARF 4, and they mean the same in a DWARF 5 unit, except that
+// an offset in a range or location list attribute refers to
+// .debug_rnglists or .debug_loclists rather than .debug_ranges or
+// .debug_loc. The linker converts the range and location lists of the
+// compiler to their DWARF 5 encodings before assembling the units, and
+// updates the references to them.
+//
+// The compile unit DIEs, which the linker writes, refer to their
+// strings and base address by index, through the unit's part of
+// .debug_str_offsets and .debug_addr, and their line tables have the
+// DWARF 5 header.
+
+// dwarf5 reports whether the linker writes DWARF version 5.
+func dwarf5() bool {
+	return *flagDWARFVersion == 5
+}
+
+// convertUnitLists converts the range and location lists of the
+// functions of unit u to their DWARF 5 encodings, and updates the
+// references to them in the DIEs of the functions. It makes symbol
+// updaters, so it must not run concurrently with the rest of the DWARF
+// generation.
+func (d *dwctxt) convertUnitLists(u *sym.CompilationUnit) {
+	moved := make(map[loader.Sym]map[int64]int64)
+	for _, s := range u.RangeSyms {
+		if s := loader.Sym(s); moved[s] == nil {
+			moved[s] = d.convertList(s, false)
+		}
+	}
+	for _, s := range d.collectUnitLocs(u) {
+		if moved[s] == nil {
+			moved[s] = d.convertList(s, true)
+		}
+	}
+	if len(moved) == 0 {
+		return
+	}
+
+	for _, fn := range u.FuncDIEs {
+		s := loader.Sym(fn)
+		var sb *loader.SymbolBuilder
+		relocs := d.ldr.Relocs(s)
+		for i := 0; i < relocs.Count(); i++ {
+			r := relocs.At(i)
+			offs, ok := moved[r.Sym()]
+			if !ok || r.Type() != objabi.R_DWARFSECREF {
+				continue
+			}
+			off, ok := offs[r.Add()]
+			if !ok {
+				d.linkctxt.Errorf(s, "reference to %s+%d is not to the start of a list", d.ldr.SymName(r.Sym()), r.Add())
+				continue
+			}
+			if sb == nil {
+				sb = d.ldr.MakeSymbolUpdater(s)
+				relocs = sb.Relocs()
+			}
+			sb.SetRelocAdd(i, off)
+		}
+	}
+}
+
+// convertList rewrites the DWARF 4 range list entries or, if loc is
+// set, location list entries in symbol s in their DWARF 5 encodings.
+// It returns the new offsets of the entries, by their old offsets.
+func (d *dwctxt) convertList(s loader.Sym, loc bool) map[int64]int64 {
+	endOfList, offsetPair, baseAddress, startEnd, startLength := dwarf.DW_RLE_end_of_list, dwarf.DW_RLE_offset_pair, dwarf.DW_RLE_base_address, dwarf.DW_RLE_start_end, dwarf.DW_RLE_start_length
+	if loc {
+		endOfList, offsetPair, baseAddress, startEnd, startLength = dwarf.DW_LLE_end_of_list, dwarf.DW_LLE_offset_pair, dwarf.DW_LLE_base_address, dwarf.DW_LLE_start_end, dwarf.DW_LLE_start_length
+	}
+
+	ps := int64(d.arch.PtrSize)
+	data := d.ldr.Data(s)
+	read := func(off int64) uint64 {
+		if ps == 8 {
+			return d.arch.ByteOrder.Uint64(data[off:])
+		}
+		return uint64(d.arch.ByteOrder.Uint32(data[off:]))
+	}
+	relocs := d.ldr.Relocs(s)
+	rels := make(map[int64]loader.Reloc, relocs.Count())
+	for i := 0; i < relocs.Count(); i++ {
+		r := relocs.At(i)
+		rels[int64(r.Off())] = r
+	}
+
+	type reloc struct {
+		off int64
+		typ objabi.RelocType
+		siz uint8
+		sym loader.Sym
+		add int64
+	}
+	var out []byte
+	var outRels []reloc
+	putAddr := func(r loader.Reloc) {
+		outRels = append(outRels, reloc{int64(len(out)), objabi.R_ADDR, uint8(ps), r.Sym(), r.Add()})
+		out = append(out, make([]byte, ps)...)
+	}
+
+	offs := make(map[int64]int64)
+	for off := int64(0); off+2*ps <= int64(len(data)); {
+		offs[off] = int64(len(out))
+		rb, hasb := rels[off]
+		re, hase := rels[off+ps]
+		b, e := read(off), read(off+ps)
+		off += 2 * ps
+
+		switch {
+		case !hasb && hase && b == 1<<(8*ps)-1:
+			out = append(out, uint8(baseAddress))
+			putAddr(re)
+			continue
+		case !hasb && !hase && b == 0 && e == 0:
+			out = append(out, uint8(endOfList))
+			continue
+		case hasb && hase && rb.Sym() == re.Sym():
+			out = append(out, uint8(startLength))
+			putAddr(rb)
+			out = dwarf.AppendUleb128(out, uint64(re.Add()-rb.Add()))
+		case hasb && hase:
+			out = append(out, uint8(startEnd))
+			putAddr(rb)
+			putAddr(re)
+		case !hasb && !hase:
+			out = append(out, uint8(offsetPair))
+			out = dwarf.AppendUleb128(out, b)
+			out = dwarf.AppendUleb128(out, e)
+		default:
+			d.linkctxt.Errorf(s, "unexpected list entry at offset %d", off-2*ps)
+			return offs
+		}
+
+		if loc {
+			// Location description, with a 2-byte length in
+			// DWARF 4 and a ULEB128 one in DWARF 5.
+			n := int64(d.arch.ByteOrder.Uint16(data[off:]))
+			off += 2
+			out = dwarf.AppendUleb128(out, uint64(n))
+			for i := off; i < off+n; i++ {
+				if r, ok := rels[i]; ok {
+					outRels = append(outRels, reloc{int64(len(out)) + i - off, r.Type(), r.Siz(), r.Sym(), r.Add()})
+				}
+			}
+			out = append(out, data[off:off+n]...)
+			off += n
+		}
+	}
+	offs[int64(len(data))] = int64(len(out))
+
+	sb := d.ldr.MakeSymbolUpdater(s)
+	sb.SetData(out)
+	sb.SetSize(int64(len(out)))
+	sb.ResetRelocs()
+	for _, r := range outRels {
+		rr, _ := sb.AddRel(r.typ)
+		rr.SetOff(int32(r.off))
+		rr.SetSiz(r.siz)
+		rr.SetSym(r.sym)
+		rr.SetAdd(r.add)
+	}
+	return offs
+}
+
+// putListsHeader writes the header of the part of .debug_rnglists or
+// .debug_loclists for a unit. Its unit_length is set by setUnitLength.
+func (d *dwctxt) putListsHeader(sb *loader.SymbolBuilder) {
+	d.createUnitLength(sb, 0)
+	sb.AddUint16(d.arch, 5)            // version
+	sb.AddUint8(uint8(d.arch.PtrSize)) // address_size
+	sb.AddUint8(0)                     // segment_selector_size
+	sb.AddUint32(d.arch, 0)            // offset_entry_count
+}
+
+// writeloclistsheader writes the header of the part of .debug_loclists
+// for a unit, with location lists locsyms, to locProlog, and returns
+// the symbols of the part.
+func (d *dwctxt) writeloclistsheader(locProlog loader.Sym, locsyms []loader.Sym) []loader.Sym {
+	sb := d.ldr.MakeSymbolUpdater(locProlog)
+	d.putListsHeader(sb)
+	size := sb.Size()
+	for _, s := range locsyms {
+		size += d.ldr.SymSize(s)
+	}
+	d.setUnitLength(sb, size)
+	return append([]loader.Sym{locProlog}, locsyms...)
+}
+
+// putRnglist writes the ranges, relative to the base address of the
+// unit, as a DWARF 5 range list.
+func (d *dwctxt) putRnglist(sb *loader.SymbolBuilder, pcs []dwarf.Range) {
+	for _, r := range pcs {
+		sb.AddUint8(dwarf.DW_RLE_offset_pair)
+		sb.AddUleb(uint64(r.Start))
+		sb.AddUleb(uint64(r.End))
+	}
+	sb.AddUint8(dwarf.DW_RLE_end_of_list)
+}
+
+// writeUnitStrsAddrs writes the strings of the compile unit DIE of u
+// to its part of .debug_str and .debug_str_offsets, and its base
+// address to its part of .debug_addr, and makes the DIE refer to them
+// by index.
+func (d *dwctxt) writeUnitStrsAddrs(u *sym.CompilationUnit, us *dwUnitSyms) {
+	if len(u.Textp) == 0 && u.DWInfo.Child == nil && len(u.VarDIEs) == 0 {
+		// As in writeUnitInfo, the unit is left out.
+		return
+	}
+	compunit := u.DWInfo
+
+	strs := d.ldr.MakeSymbolUpdater(us.strSym)
+	offs := d.ldr.MakeSymbolUpdater(us.strOffsetsSym)
+	d.createUnitLength(offs, 0)
+	offs.AddUint16(d.arch, 5) // version
+	offs.AddUint16(d.arch, 0) // padding
+	base := offs.Size()
+	size := 4
+	if isDwarf64(d.linkctxt) {
+		size = 8
+	}
+	n := int64(0)
+	for a := compunit.Attr; a != nil; a = a.Link {
+		switch a.Atr {
+		case dwarf.DW_AT_name, dwarf.DW_AT_comp_dir, dwarf.DW_AT_producer, dwarf.DW_AT_go_package_name:
+		default:
+			continue
+		}
+		offs.AddSymRef(d.arch, strs.Sym(), strs.Addstring(a.Data.(string)), objabi.R_DWARFSECREF, size)
+		a.Cls, a.Value, a.Data = dwarf.DW_CLS_CONSTANT, n, nil
+		n++
+	}
+	d.setUnitLength(offs, offs.Size())
+	newattr(compunit, dwarf.DW_AT_str_offsets_base, dwarf.DW_CLS_PTR, base, dwSym(offs.Sym()))
+
+	lowpc := getattr(compunit, dwarf.DW_AT_low_pc)
+	if lowpc == nil {
+		return
+	}
+	addr := d.ldr.MakeSymbolUpdater(us.addrSym)
+	d.createUnitLength(addr, 0)
+	addr.AddUint16(d.arch, 5)            // version
+	addr.AddUint8(uint8(d.arch.PtrSize)) // address_size
+	addr.AddUint8(0)                     // segment_selector_size
+	base = addr.Size()
+	addr.AddAddrPlus(d.arch, loader.Sym(lowpc.Data.(dwSym)), lowpc.Value)
+	d.setUnitLength(addr, addr.Size())
+	lowpc.Cls, lowpc.Value, lowpc.Data = dwarf.DW_CLS_CONSTANT, 0, nil
+	newattr(compunit, dwarf.DW_AT_addr_base, dwarf.DW_CLS_PTR, base, dwSym(addr.Sym()))
+}
+
+// setUnitLength sets the unit_length field at the start of sb, made by
+// createUnitLength, for a unit of size bytes, including the field.
+func (d *dwctxt) setUnitLength(sb *loader.SymbolBuilder, size int64) {
+	if isDwarf64(d.linkctxt) {
+		sb.SetUint(d.arch, 4, uint64(size-12))
+	} else {
+		sb.SetUint32(d.arch, 0, uint32(size-4))
+	}
+}
@@ -5,9 +5,11 @@
 package ld
 
 import (
+	"bytes"
 	intdwarf "cmd/internal/dwarf"
 	objfilepkg "cmd/internal/objfile" // renamed to avoid conflict with objfile function
 	"debug/dwarf"
+	"debug/elf"
 	"debug/pe"
 	"errors"
 	"fmt"
@@ -1849,3 +1851,375 @@ func main() {
 		}
 	}
 }
+
+func TestDWARF5(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	switch runtime.GOOS {
+	case "aix", "darwin", "ios", "plan9", "windows":
+		t.Skip("skipping: -dwarf=5 is only supported for ELF")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`
+	dir := t.TempDir()
+	f := gobuild(t, dir, prog, "-ldflags=-dwarf=5")
+	defer f.Close()
+
+	ef, err := elf.Open(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	for _, name := range []string{".debug_line", ".debug_rnglists", ".debug_str_offsets", ".debug_addr"} {
+		s := ef.Section(name)
+		if s == nil {
+			t.Fatalf("no %s section", name)
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := ef.ByteOrder.Uint16(data[4:]); v != 5 {
+			t.Errorf("%s: got version %d, want 5", name, v)
+		}
+	}
+	if ef.Section(".debug_ranges") != nil || ef.Section(".debug_loc") != nil {
+		t.Errorf("found DWARF 4 .debug_ranges or .debug_loc section")
+	}
+
+	dw, err := f.DWARF()
+	if err != nil {
+		t.Fatalf("error reading DWARF: %v", err)
+	}
+	ex := examiner{}
+	if err := ex.populate(dw.Reader()); err != nil {
+		t.Fatalf("error reading DWARF: %v", err)
+	}
+	mains := ex.Named("main.main")
+	if len(mains) != 1 {
+		t.Fatalf("found %d main.main DIEs, want 1", len(mains))
+	}
+	lowpc := mains[0].Val(dwarf.AttrLowpc).(uint64)
+	highpc := mains[0].Val(dwarf.AttrHighpc).(uint64)
+	cu := ex.Parent(ex.idxFromOffset(mains[0].Offset))
+	if cu == nil {
+		t.Fatalf("main.main DIE appears orphaned")
+	}
+	if name, _ := cu.Val(dwarf.AttrName).(string); name != "main" {
+		t.Errorf("got compile unit name %q, want main", name)
+	}
+	if cu.Val(dwarf.AttrStrOffsetsBase) == nil || cu.Val(dwarf.AttrAddrBase) == nil {
+		t.Errorf("compile unit has no DW_AT_str_offsets_base or DW_AT_addr_base")
+	}
+	ranges, err := dw.Ranges(cu)
+	if err != nil {
+		t.Fatalf("error reading compile unit ranges: %v", err)
+	}
+	inRange := false
+	for _, r := range ranges {
+		if r[0] <= lowpc && highpc <= r[1] {
+			inRange = true
+		}
+	}
+	if !inRange {
+		t.Errorf("main.main [%#x, %#x) is not in the compile unit ranges %#x", lowpc, highpc, ranges)
+	}
+
+	lr, err := dw.LineReader(cu)
+	if err != nil || lr == nil {
+		t.Fatalf("no line table for the main compile unit: %v", err)
+	}
+	var lne dwarf.LineEntry
+	found := false
+	for {
+		err := lr.Next(&lne)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading line table: %v", err)
+		}
+		if lne.Address >= lowpc && lne.Address < highpc && lne.Line == 6 && strings.HasSuffix(lne.File.Name, "test.go") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no line table row for test.go:6 in main.main")
+	}
+
+	if _, err := exec.LookPath("llvm-dwarfdump"); err == nil {
+		out, err := exec.Command("llvm-dwarfdump", "--verify", f.path).CombinedOutput()
+		if err != nil {
+			t.Errorf("llvm-dwarfdump --verify: %v\n%s", err, out)
+		}
+	}
+}
+
+func TestDWARFNames(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	switch runtime.GOOS {
+	case "aix", "darwin", "ios", "plan9", "windows":
+		t.Skip("skipping: -dwarf=5 is only supported for ELF")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import "fmt"
+
+var Global = []int{1, 2}
+
+func main() {
+	fmt.Println("hello", Global)
+}
+`
+	dir := t.TempDir()
+	f := gobuild(t, dir, prog, "-ldflags=-dwarf=5 -dwarfnames")
+	defer f.Close()
+
+	ef, err := elf.Open(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	sectData := func(name string) []byte {
+		s := ef.Section(name)
+		if s == nil {
+			t.Fatalf("no %s section", name)
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	names, strs, info := sectData(".debug_names"), sectData(".debug_str"), sectData(".debug_info")
+	t.Logf(".debug_names is %d bytes, %.1f%% of the %d bytes of .debug_info", len(names), 100*float64(len(names))/float64(len(info)), len(info))
+
+	// Decode the index.
+	bo := ef.ByteOrder
+	u32 := func(off int) int { return int(bo.Uint32(names[off:])) }
+	if v := bo.Uint16(names[4:]); v != 5 {
+		t.Fatalf("got .debug_names version %d, want 5", v)
+	}
+	ncu, nbucket, nname, abbrevSize := u32(8), u32(20), u32(24), u32(28)
+	off := 36 + u32(32)
+	cus := make([]int, ncu)
+	for i := range cus {
+		cus[i] = u32(off)
+		off += 4
+	}
+	buckets, hashes := off, off+4*nbucket
+	strOffs := hashes + 4*nname
+	entryOffs := strOffs + 4*nname
+	abbrevTable := entryOffs + 4*nname
+	pool := abbrevTable + abbrevSize
+
+	abbrevTags := make(map[uint64]uint64)
+	b := names[abbrevTable:pool]
+	for {
+		var code, tag uint64
+		code, b = readUleb(b)
+		if code == 0 {
+			break
+		}
+		tag, b = readUleb(b)
+		for {
+			var idx, form uint64
+			idx, b = readUleb(b)
+			form, b = readUleb(b)
+			if idx == 0 && form == 0 {
+				break
+			}
+			if form != map[uint64]uint64{intdwarf.DW_IDX_compile_unit: intdwarf.DW_FORM_udata, intdwarf.DW_IDX_die_offset: intdwarf.DW_FORM_ref4}[idx] {
+				t.Fatalf("unexpected index attribute %d with form %d", idx, form)
+			}
+		}
+		abbrevTags[code] = tag
+	}
+
+	dw, err := f.DWARF()
+	if err != nil {
+		t.Fatalf("error reading DWARF: %v", err)
+	}
+	rdr := dw.Reader()
+	want := map[string]dwarf.Tag{"main.main": dwarf.TagSubprogram, "main.Global": dwarf.TagVariable, "fmt.Fprintln": dwarf.TagSubprogram, "int": dwarf.TagBaseType}
+	for i := 0; i < nname; i++ {
+		s := strs[u32(strOffs+4*i):]
+		name := string(s[:bytes.IndexByte(s, 0)])
+		hash := uint32(u32(hashes + 4*i))
+		if h := debugNamesHash(name); hash != h {
+			t.Errorf("%s: got hash %#x, want %#x", name, hash, h)
+		}
+		if bucket := u32(buckets + 4*int(hash%uint32(nbucket))); bucket == 0 || bucket > i+1 {
+			t.Errorf("%s: name %d is not in its bucket, which starts at %d", name, i+1, bucket)
+		}
+		tag, ok := want[name]
+		if !ok {
+			continue
+		}
+		e := names[pool+u32(entryOffs+4*i):]
+		for {
+			var code, cu uint64
+			code, e = readUleb(e)
+			if code == 0 {
+				break
+			}
+			cu, e = readUleb(e)
+			die := cus[cu] + int(bo.Uint32(e))
+			e = e[4:]
+			rdr.Seek(dwarf.Offset(die))
+			entry, err := rdr.Next()
+			if err != nil {
+				t.Fatalf("%s: error reading DIE at %#x: %v", name, die, err)
+			}
+			if entry.Tag != dwarf.Tag(abbrevTags[code]) {
+				t.Errorf("%s: got DIE with tag %v, entry with tag %v", name, entry.Tag, dwarf.Tag(abbrevTags[code]))
+			}
+			if entry.Tag == tag {
+				delete(want, name)
+			}
+			if origin, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+				rdr.Seek(origin)
+				if entry, err = rdr.Next(); err != nil {
+					t.Fatalf("%s: error reading DIE at %#x: %v", name, origin, err)
+				}
+			}
+			if n, _ := entry.Val(dwarf.AttrName).(string); n != name {
+				t.Errorf("%s: entry refers to DIE named %q", name, n)
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("%s is not in the index", name)
+	}
+
+	if _, err := exec.LookPath("llvm-dwarfdump"); err == nil {
+		out, err := exec.Command("llvm-dwarfdump", "--verify", "--debug-names", f.path).CombinedOutput()
+		if err != nil {
+			t.Errorf("llvm-dwarfdump --verify --debug-names: %v\n%s", err, out)
+		}
+	}
+}
+
+func TestDebugFrame(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping: test only on linux")
+	}
+
+	t.Parallel()
+
+	const prog = `package main
+
+import (
+	"fmt"
+	"os"
+	"text/template"
+)
+
+func main() {
+	template.Must(template.New("x").Parse("{{.}}\n")).Execute(os.Stdout, fmt.Sprint("hello"))
+}
+`
+	// The FDEs are generated straight into the output, or into a
+	// buffer to compress; both must give the same section.
+	var frames [][]byte
+	var ef *elf.File
+	for _, flags := range []string{"-ldflags=-compressdwarf=false", "-ldflags=-compressdwarf=true"} {
+		f := gobuild(t, t.TempDir(), prog, flags)
+		defer f.Close()
+		var err error
+		ef, err = elf.Open(f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ef.Close()
+		s := ef.Section(".debug_frame")
+		if s == nil {
+			t.Fatal("no .debug_frame section")
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, data)
+	}
+	if !bytes.Equal(frames[0], frames[1]) {
+		t.Fatalf(".debug_frame differs when compressed")
+	}
+
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := make(map[uint64]elf.Symbol)
+	for _, s := range syms {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC {
+			funcs[s.Value] = s
+		}
+	}
+
+	// Walk the CIE and the FDEs, each of which must refer to the CIE
+	// and cover a function.
+	bo := ef.ByteOrder
+	ptrSize := 8
+	if ef.Class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+	addr := func(b []byte) uint64 {
+		if ptrSize == 8 {
+			return bo.Uint64(b)
+		}
+		return uint64(bo.Uint32(b))
+	}
+	frame := frames[0]
+	t.Logf(".debug_frame is %d bytes", len(frame))
+	var nfde int
+	seen := make(map[string]bool)
+	for off := 0; off < len(frame); {
+		n := int(bo.Uint32(frame[off:]))
+		rec := frame[off+4 : off+4+n]
+		if off == 0 {
+			if id := bo.Uint32(rec); id != ^uint32(0) {
+				t.Fatalf("CIE has id %#x", id)
+			}
+			off += 4 + n
+			continue
+		}
+		if cie := bo.Uint32(rec); cie != 0 {
+			t.Fatalf("FDE at %#x refers to a CIE at %#x", off, cie)
+		}
+		pc, size := addr(rec[4:]), addr(rec[4+ptrSize:])
+		s, ok := funcs[pc]
+		if !ok {
+			t.Fatalf("FDE at %#x covers %#x, which is not a function", off, pc)
+		}
+		if size != s.Size {
+			t.Errorf("FDE of %s covers %d bytes, want %d", s.Name, size, s.Size)
+		}
+		seen[s.Name] = true
+		nfde++
+		off += 4 + n
+	}
+	for _, name := range []string{"main.main", "runtime.main", "text/template.(*state).walk"} {
+		if !seen[name] {
+			t.Errorf("no FDE for %s", name)
+		}
+	}
+	if nfde < 1000 {
+		t.Errorf("got %d FDEs, want at least 1000", nfde)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/dwarf"
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Support for -dwarfnames, which writes a .debug_names index of the
+// DWARF 5 compilation units (DWARF 5 section 6.1.1), so that debuggers
+// can look up the types, functions and variables of a program by name
+// without reading all of .debug_info first.
+//
+// Most DIEs are written by the compiler, so the index is built by
+// decoding the DIEs of each unit, using the abbrev table the linker
+// writes. The DIEs are referred to by their offsets in their units,
+// which are known before layout, as a unit is the concatenation of its
+// symbols, and do not change when an external linker puts other units
+// before it. The index lists the DIEs that the standard says it should:
+// all named DIEs, except for compilation units, members, parameters,
+// and functions and variables that have no address. A DIE with no name
+// of its own, such as an inlined call, is indexed under the name of its
+// abstract origin.
+
+// A namesAbbrev is an entry of the abbrev table of .debug_info.
+type namesAbbrev struct {
+	tag   uint64
+	attrs [][2]uint64 // attribute and form
+}
+
+// A dieRef is the location of a DIE in a symbol of .debug_info.
+type dieRef struct {
+	sym loader.Sym
+	off int64
+}
+
+// A namesDIE is a DIE that .debug_names indexes.
+type namesDIE struct {
+	unit   int   // index of the unit in the CU list
+	off    int64 // offset of the DIE in its unit
+	tag    uint64
+	name   string
+	origin dieRef // abstract origin, for a DIE with no name
+}
+
+// readNamesAbbrevs decodes the abbrev table data.
+func readNamesAbbrevs(data []byte) map[uint64]namesAbbrev {
+	abbrevs := make(map[uint64]namesAbbrev)
+	for len(data) > 0 {
+		var code, tag uint64
+		code, data = readUleb(data)
+		if code == 0 {
+			break
+		}
+		tag, data = readUleb(data)
+		data = data[1:] // children
+		a := namesAbbrev{tag: tag}
+		for {
+			var attr, form uint64
+			attr, data = readUleb(data)
+			form, data = readUleb(data)
+			if attr == 0 && form == 0 {
+				break
+			}
+			a.attrs = append(a.attrs, [2]uint64{attr, form})
+		}
+		abbrevs[code] = a
+	}
+	return abbrevs
+}
+
+// readUleb decodes the ULEB128 value at the start of b, and returns it
+// and the rest of b.
+func readUleb(b []byte) (uint64, []byte) {
+	var v uint64
+	for shift := uint(0); len(b) > 0; shift += 7 {
+		c := b[0]
+		b = b[1:]
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return v, b
+}
+
+// namesIndexed reports whether .debug_names lists a named DIE with tag,
+// which has an address if hasAddr is set, or a static location if it
+// is a variable and static is set.
+func namesIndexed(tag uint64, hasAddr, static bool) bool {
+	switch tag {
+	case dwarf.DW_TAG_compile_unit, dwarf.DW_TAG_formal_parameter, dwarf.DW_TAG_member,
+		dwarf.DW_TAG_enumerator, dwarf.DW_TAG_imported_declaration:
+		return false
+	case dwarf.DW_TAG_subprogram, dwarf.DW_TAG_inlined_subroutine, dwarf.DW_TAG_label:
+		return hasAddr
+	case dwarf.DW_TAG_variable:
+		return static
+	}
+	return true
+}
+
+// scanNamesDIEs decodes the DIEs in data, the contents of symbol s
+// starting at offset start, which is at offset base in unit. It calls
+// add for each DIE the index lists, and records the names of the
+// others in names, for the DIEs that refer to them as their abstract
+// origin.
+func (d *dwctxt) scanNamesDIEs(s loader.Sym, data []byte, start int, unit int, base int64, abbrevs map[uint64]namesAbbrev, names map[dieRef]string, add func(namesDIE)) {
+	var rels map[int64]loader.Reloc
+	ps := d.arch.PtrSize
+	for off := start; off < len(data); {
+		dieOff := off
+		code, rest := readUleb(data[off:])
+		off = len(data) - len(rest)
+		if code == 0 {
+			continue // end of children
+		}
+		ab, ok := abbrevs[code]
+		if !ok {
+			d.linkctxt.Errorf(s, "-dwarfnames: unknown abbrev %d at offset %d", code, dieOff)
+			return
+		}
+		var name string
+		var origin dieRef
+		hasAddr, static := false, false
+		for _, af := range ab.attrs {
+			attr, form := af[0], af[1]
+			val := off
+			switch form {
+			case dwarf.DW_FORM_flag_present:
+			case dwarf.DW_FORM_data1, dwarf.DW_FORM_ref1, dwarf.DW_FORM_flag:
+				off++
+			case dwarf.DW_FORM_data2, dwarf.DW_FORM_ref2:
+				off += 2
+			case dwarf.DW_FORM_data4, dwarf.DW_FORM_ref4, dwarf.DW_FORM_ref_addr, dwarf.DW_FORM_sec_offset, dwarf.DW_FORM_strp:
+				off += 4
+			case dwarf.DW_FORM_data8, dwarf.DW_FORM_ref8, dwarf.DW_FORM_ref_sig8:
+				off += 8
+			case dwarf.DW_FORM_addr:
+				off += ps
+			case dwarf.DW_FORM_udata, dwarf.DW_FORM_sdata, dwarf.DW_FORM_ref_udata, dwarf.DW_FORM_strx, dwarf.DW_FORM_addrx:
+				_, rest := readUleb(data[off:])
+				off = len(data) - len(rest)
+			case dwarf.DW_FORM_string:
+				for data[off] != 0 {
+					off++
+				}
+				off++
+			case dwarf.DW_FORM_block1:
+				val = off + 1
+				off = val + int(data[off])
+			case dwarf.DW_FORM_block, dwarf.DW_FORM_exprloc:
+				n, rest := readUleb(data[off:])
+				val = len(data) - len(rest)
+				off = val + int(n)
+			default:
+				d.linkctxt.Errorf(s, "-dwarfnames: unexpected form %#x at offset %d", form, val)
+				return
+			}
+			switch attr {
+			case dwarf.DW_AT_name:
+				if form == dwarf.DW_FORM_string {
+					name = string(data[val : off-1])
+				}
+			case dwarf.DW_AT_low_pc, dwarf.DW_AT_ranges, dwarf.DW_AT_entry_pc:
+				hasAddr = true
+			case dwarf.DW_AT_location:
+				static = (form == dwarf.DW_FORM_block1 || form == dwarf.DW_FORM_exprloc) &&
+					val < off && data[val] == dwarf.DW_OP_addr
+			case dwarf.DW_AT_abstract_origin:
+				if rels == nil {
+					rels = make(map[int64]loader.Reloc)
+					relocs := d.ldr.Relocs(s)
+					for i := 0; i < relocs.Count(); i++ {
+						r := relocs.At(i)
+						rels[int64(r.Off())] = r
+					}
+				}
+				if r, ok := rels[int64(val)]; ok {
+					origin = dieRef{r.Sym(), r.Add()}
+				}
+			}
+		}
+		if name != "" {
+			names[dieRef{s, int64(dieOff)}] = name
+		}
+		if (name != "" || origin.sym != 0) && namesIndexed(ab.tag, hasAddr, static) {
+			add(namesDIE{unit: unit, off: base + int64(dieOff), tag: ab.tag, name: name, origin: origin})
+		}
+	}
+}
+
+// writeDebugNames writes the .debug_names index of units to namesSym,
+// and the names it lists to strSym, in .debug_str.
+func (d *dwctxt) writeDebugNames(units []dwUnitSyms, namesSym, strSym loader.Sym) {
+	abbrevs := readNamesAbbrevs(dwarf.GetAbbrev())
+
+	// Find the DIEs to index, and their names.
+	var dies []namesDIE
+	add := func(die namesDIE) { dies = append(dies, die) }
+	names := make(map[dieRef]string)
+	var cus []loader.Sym
+	for i := range units {
+		us := &units[i]
+		if len(us.infosyms) == 0 {
+			continue
+		}
+		unit := len(cus)
+		cus = append(cus, us.infosyms[0])
+		var base int64
+		for i, s := range us.infosyms {
+			data := d.ldr.Data(s)
+			start := 0
+			if i == 0 {
+				// Skip the unit header.
+				start = 4 + 2 + 1 + 1 + 4
+			}
+			d.scanNamesDIEs(s, data, start, unit, base, abbrevs, names, add)
+			base += int64(len(data))
+		}
+	}
+
+	// Group the DIEs by name, and the names by hash bucket.
+	type entry struct {
+		unit int
+		off  int64
+		tag  uint64
+	}
+	byName := make(map[string][]entry)
+	tags := make(map[uint64]uint64) // abbrev codes
+	for _, die := range dies {
+		name := die.name
+		if name == "" {
+			if name = names[die.origin]; name == "" {
+				continue
+			}
+		}
+		byName[name] = append(byName[name], entry{die.unit, die.off, die.tag})
+		tags[die.tag] = 0
+	}
+	type nameHash struct {
+		name string
+		hash uint32
+	}
+	hashes := make([]nameHash, 0, len(byName))
+	for name := range byName {
+		hashes = append(hashes, nameHash{name, debugNamesHash(name)})
+	}
+	nbucket := uint32(len(hashes))
+	switch {
+	case nbucket > 1024:
+		nbucket /= 4
+	case nbucket > 16:
+		nbucket /= 2
+	case nbucket == 0:
+		nbucket = 1
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		hi, hj := hashes[i], hashes[j]
+		if bi, bj := hi.hash%nbucket, hj.hash%nbucket; bi != bj {
+			return bi < bj
+		}
+		if hi.hash != hj.hash {
+			return hi.hash < hj.hash
+		}
+		return hi.name < hj.name
+	})
+
+	// Abbrev table, with one abbrev per tag, and the entry pool.
+	var tagList []uint64
+	for tag := range tags {
+		tagList = append(tagList, tag)
+	}
+	sort.Slice(tagList, func(i, j int) bool { return tagList[i] < tagList[j] })
+	var abbrevTable []byte
+	for i, tag := range tagList {
+		tags[tag] = uint64(i + 1)
+		abbrevTable = dwarf.AppendUleb128(abbrevTable, uint64(i+1))
+		abbrevTable = dwarf.AppendUleb128(abbrevTable, tag)
+		abbrevTable = dwarf.AppendUleb128(abbrevTable, dwarf.DW_IDX_compile_unit)
+		abbrevTable = dwarf.AppendUleb128(abbrevTable, dwarf.DW_FORM_udata)
+		abbrevTable = dwarf.AppendUleb128(abbrevTable, dwarf.DW_IDX_die_offset)
+		abbrevTable = dwarf.AppendUleb128(abbrevTable, dwarf.DW_FORM_ref4)
+		abbrevTable = append(abbrevTable, 0, 0)
+	}
+	abbrevTable = append(abbrevTable, 0)
+	var pool []byte
+	var off [4]byte
+	poolOffs := make([]uint32, len(hashes))
+	for i, h := range hashes {
+		poolOffs[i] = uint32(len(pool))
+		for _, e := range byName[h.name] {
+			pool = dwarf.AppendUleb128(pool, tags[e.tag])
+			pool = dwarf.AppendUleb128(pool, uint64(e.unit))
+			d.arch.ByteOrder.PutUint32(off[:], uint32(e.off))
+			pool = append(pool, off[:]...)
+		}
+		pool = append(pool, 0)
+	}
+
+	sb := d.ldr.MakeSymbolUpdater(namesSym)
+	strs := d.ldr.MakeSymbolUpdater(strSym)
+	d.createUnitLength(sb, 0)
+	sb.AddUint16(d.arch, 5)                        // version
+	sb.AddUint16(d.arch, 0)                        // padding
+	sb.AddUint32(d.arch, uint32(len(cus)))         // comp_unit_count
+	sb.AddUint32(d.arch, 0)                        // local_type_unit_count
+	sb.AddUint32(d.arch, 0)                        // foreign_type_unit_count
+	sb.AddUint32(d.arch, nbucket)                  // bucket_count
+	sb.AddUint32(d.arch, uint32(len(hashes)))      // name_count
+	sb.AddUint32(d.arch, uint32(len(abbrevTable))) // abbrev_table_size
+	sb.AddUint32(d.arch, 0)                        // augmentation_string_size
+	for _, cu := range cus {
+		d.addDwarfAddrRef(sb, cu)
+	}
+	next := 0
+	for b := uint32(0); b < nbucket; b++ {
+		if next < len(hashes) && hashes[next].hash%nbucket == b {
+			sb.AddUint32(d.arch, uint32(next+1))
+			for next < len(hashes) && hashes[next].hash%nbucket == b {
+				next++
+			}
+		} else {
+			sb.AddUint32(d.arch, 0)
+		}
+	}
+	for _, h := range hashes {
+		sb.AddUint32(d.arch, h.hash)
+	}
+	for _, h := range hashes {
+		sb.AddSymRef(d.arch, strSym, strs.Addstring(h.name), objabi.R_DWARFSECREF, 4)
+	}
+	for _, off := range poolOffs {
+		sb.AddUint32(d.arch, off)
+	}
+	sb.AddBytes(abbrevTable)
+	sb.AddBytes(pool)
+	d.setUnitLength(sb, sb.Size())
+}
+
+// debugNamesHash returns the hash of name in .debug_names: the DJB hash
+// of its UTF-8 encoding after simple case folding (DWARF 5 section
+// 7.33), in which the dotted and dotless I are left alone.
+func debugNamesHash(name string) uint32 {
+	h := uint32(5381)
+	var buf [utf8.UTFMax]byte
+	for _, r := range name {
+		switch {
+		case 'A' <= r && r <= 'Z':
+			r += 'a' - 'A'
+		case r < utf8.RuneSelf, r == 0x130, r == 0x131:
+		default:
+			r = unicode.ToLower(unicode.ToUpper(r))
+		}
+		n := utf8.EncodeRune(buf[:], r)
+		for _, c := range buf[:n] {
+			h = h*33 + uint32(c)
+		}
+	}
+	return h
+}
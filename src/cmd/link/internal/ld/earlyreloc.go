@@ -0,0 +1,125 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"sort"
+	"strings"
+)
+
+// The code a program runs first may have to do without some of its
+// relocations. A -static-pie executable has no dynamic linker: its
+// entry point, go.link.selfreloc, applies the relative relocations,
+// before which nothing is relocated, and no other relocation is ever
+// applied. A reference through the GOT or PLT in that code reads an
+// entry that is not set yet, or never will be, and crashes the program
+// before it can say anything.
+//
+// checkEarlyRelocs finds them at link time. It walks the direct calls
+// and jumps from the entry point, and reports
+//
+//	- in go.link.selfreloc, any reference through the GOT or PLT and
+//	  any absolute address, as nothing is relocated yet;
+//	- in the code it reaches, references through the PLT and through
+//	  GOT entries that need a relocation other than a relative one:
+//	  those of dynamic imports, indirect functions and thread-local
+//	  variables.
+//
+// Each report names the call path from the entry point. Dynamically
+// linked programs and libraries run no code before the dynamic linker
+// has processed their relocations, so there is nothing to check.
+
+// indirectRefs records, for each symbol, its references through the
+// GOT or PLT.
+type indirectRefs map[loader.Sym][]indirectRef
+
+// An indirectRef is a reference to targ through an entry of the GOT
+// or PLT, for checkEarlyRelocs.
+type indirectRef struct {
+	targ loader.Sym
+	via  loader.Sym // ctxt.GOT, ctxt.PLT or ctxt.GOTPLT
+}
+
+// checkEarlyRelocs checks the startup code of an internally linked
+// -static-pie executable.
+func (ctxt *Link) checkEarlyRelocs() {
+	ldr := ctxt.loader
+	selfreloc := ldr.Lookup("go.link.selfreloc", 0)
+	if selfreloc == 0 {
+		return
+	}
+	via := func(ref indirectRef) string {
+		if ref.via == ctxt.GOT {
+			return "GOT"
+		}
+		return "PLT"
+	}
+
+	relocs := ldr.Relocs(selfreloc)
+	for _, ref := range ctxt.indirectRefs[selfreloc] {
+		ldr.Errorf(selfreloc, "refers to %s through the %s before the static PIE has relocated itself", ldr.SymName(ref.targ), via(ref))
+	}
+	for ri := 0; ri < relocs.Count(); ri++ {
+		if r := relocs.At(ri); r.Type() == objabi.R_ADDR {
+			ldr.Errorf(selfreloc, "uses the absolute address of %s before the static PIE has relocated itself", ldr.SymName(r.Sym()))
+		}
+	}
+
+	// Walk the code run once relocated: from where go.link.selfreloc
+	// jumps to, and from runtime.rt0_go for the ports whose entry
+	// point finds it indirectly.
+	parent := map[loader.Sym]loader.Sym{selfreloc: 0}
+	var queue []loader.Sym
+	push := func(s, from loader.Sym) {
+		if _, ok := parent[s]; ok || s == 0 || len(ldr.Data(s)) == 0 {
+			return
+		}
+		parent[s] = from
+		queue = append(queue, s)
+	}
+	for ri := 0; ri < relocs.Count(); ri++ {
+		if r := relocs.At(ri); r.Type().IsDirectCallOrJump() {
+			push(r.Sym(), selfreloc)
+		}
+	}
+	push(ldr.Lookup("runtime.rt0_go", 0), selfreloc)
+
+	path := func(s loader.Sym) string {
+		var names []string
+		for ; s != 0; s = parent[s] {
+			names = append(names, ldr.SymName(s))
+		}
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		return strings.Join(names, " -> ")
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		refs := ctxt.indirectRefs[s]
+		sort.Slice(refs, func(i, j int) bool { return refs[i].targ < refs[j].targ })
+		for _, ref := range refs {
+			if ref.via == ctxt.GOT {
+				switch gotReason(ldr, ref.targ) {
+				case "unrelaxed", "weakundef", "unresolved":
+					continue // set by a relative relocation, or 0
+				}
+			}
+			ldr.Errorf(s, "refers to %s through the %s, which a static PIE never sets: it only applies relative relocations (startup path: %s)", ldr.SymName(ref.targ), via(ref), path(s))
+		}
+		rs := ldr.Relocs(s)
+		for ri := 0; ri < rs.Count(); ri++ {
+			if r := rs.At(ri); r.Type().IsDirectCallOrJump() {
+				push(r.Sym(), s)
+			}
+		}
+	}
+	if ctxt.Debugvlog != 0 {
+		ctxt.Logf("checkEarlyRelocs: %d functions in the startup path\n", len(parent))
+	}
+}
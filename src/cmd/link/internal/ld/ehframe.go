@@ -0,0 +1,151 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/dwarf"
+	"cmd/internal/obj"
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"sort"
+)
+
+// Support for -ehframe, which writes the call frame information of
+// the Go functions, the same as in .debug_frame, to a loaded
+// .eh_frame section, which unwinders such as those of libgcc,
+// libunwind and perf find at run time, unlike .debug_frame.
+//
+// The CIE has augmentation "zR", for the FDEs to give the addresses of
+// their functions as 4-byte offsets from themselves, which take no
+// dynamic relocations in a position-independent executable. When
+// linking internally, the linker also writes an .eh_frame_hdr section,
+// found through the PT_GNU_EH_FRAME segment, with a table of the FDEs
+// sorted by address for the unwinders to search. When linking
+// externally, the .eh_frame of go.o has no terminator, so that the
+// host linker merges it with those of the C objects, and builds the
+// .eh_frame_hdr of all of them itself, with --eh-frame-hdr.
+
+// Pointer encodings of .eh_frame and .eh_frame_hdr, as per the Linux
+// Standard Base.
+const (
+	DW_EH_PE_udata4  = 0x03
+	DW_EH_PE_sdata4  = 0x0b
+	DW_EH_PE_pcrel   = 0x10
+	DW_EH_PE_datarel = 0x30
+)
+
+// ehframeHdr is the .eh_frame_hdr section symbol, when linking
+// internally with -ehframe.
+var ehframeHdr loader.Sym
+
+// ehframe creates the .eh_frame section, and when linking internally
+// the .eh_frame_hdr section.
+func (ctxt *Link) ehframe() {
+	ldr := ctxt.loader
+	arch := ctxt.Arch
+	d := &dwctxt{
+		linkctxt: ctxt,
+		ldr:      ldr,
+		arch:     arch,
+	}
+	haslr := haslinkregister(ctxt)
+
+	fs := ldr.CreateSymForUpdate(".eh_frame", 0)
+	fs.SetType(sym.SELFROSECT)
+	fs.SetAlign(int32(arch.PtrSize))
+
+	// appendRecord appends a CIE or FDE of contents b, preceded by its
+	// length, and padded with DW_CFA_nop to a multiple of the pointer
+	// size, as the host linkers expect.
+	appendRecord := func(b []byte) {
+		n := int(Rnd(int64(4+len(b)), int64(arch.PtrSize))) - 4
+		fs.AddUint32(arch, uint32(n))
+		fs.AddBytes(b)
+		fs.AddBytes(zeros[:n-len(b)])
+	}
+
+	// The CIE, at offset 0.
+	cie := []byte{0, 0, 0, 0} // CIE id
+	cie = append(cie, 1)      // version
+	cie = append(cie, "zR\x00"...)
+	cie = dwarf.AppendUleb128(cie, 1) // code alignment factor
+	cie = dwarf.AppendSleb128(cie, dataAlignmentFactor)
+	cie = append(cie, byte(thearch.Dwarfreglr))
+	cie = dwarf.AppendUleb128(cie, 1) // augmentation data length
+	cie = append(cie, DW_EH_PE_pcrel|DW_EH_PE_sdata4)
+	cie = d.appendCIEInstructions(cie)
+	appendRecord(cie)
+
+	type fde struct {
+		fn  loader.Sym
+		off int64 // offset of the FDE in .eh_frame
+	}
+	var fdes []fde
+	var b []byte
+	pcsp := obj.NewPCIter(uint32(arch.MinLC))
+	for _, fn := range ctxt.Textp {
+		fi := ldr.FuncInfo(fn)
+		if !fi.Valid() {
+			continue
+		}
+		off := int64(len(fs.Data()))
+		fdes = append(fdes, fde{fn, off})
+
+		b = append(b[:0], 0, 0, 0, 0) // offset back to the CIE
+		b = append(b, 0, 0, 0, 0)     // address of the function, relocated below
+		b = append(b, 0, 0, 0, 0)     // size of the function
+		arch.ByteOrder.PutUint32(b[0:], uint32(off+4))
+		arch.ByteOrder.PutUint32(b[8:], uint32(len(ldr.Data(fn))))
+		b = dwarf.AppendUleb128(b, 0) // augmentation data length
+		if !haslr && fi.TopFrame() {
+			// Stop unwinders at the top of the stack, as the
+			// link register architectures do in .debug_frame.
+			b = append(b, dwarf.DW_CFA_undefined)
+			b = dwarf.AppendUleb128(b, uint64(thearch.Dwarfreglr))
+		}
+		b = d.appendFDEInstructions(b, pcsp, fn, fi, int64(len(ldr.Data(fn))))
+		appendRecord(b)
+
+		r, _ := fs.AddRel(objabi.R_PCREL)
+		r.SetOff(int32(off + 8))
+		r.SetSiz(4)
+		r.SetSym(fn)
+		r.SetAdd(4) // relative to the start of the field, not its end
+	}
+
+	if ctxt.IsExternal() {
+		return
+	}
+	fs.AddUint32(arch, 0) // terminator
+
+	// The .eh_frame_hdr: the version, the encodings of the pointer to
+	// .eh_frame, of the number of FDEs and of the table, then those,
+	// with the table giving the address of each function and of its
+	// FDE as offsets from the start of .eh_frame_hdr.
+	frame := fs.Sym()
+	writeHdr := func(ctxt *Link, s loader.Sym) {
+		ldr := ctxt.loader
+		sb := ldr.MakeSymbolUpdater(s)
+		base := ldr.SymValue(s)
+		sb.SetUint8(arch, 0, 1)
+		sb.SetUint8(arch, 1, DW_EH_PE_pcrel|DW_EH_PE_sdata4)
+		sb.SetUint8(arch, 2, DW_EH_PE_udata4)
+		sb.SetUint8(arch, 3, DW_EH_PE_datarel|DW_EH_PE_sdata4)
+		sb.SetUint32(arch, 4, uint32(ldr.SymValue(frame)-(base+4)))
+		sb.SetUint32(arch, 8, uint32(len(fdes)))
+		sort.Slice(fdes, func(i, j int) bool {
+			return ldr.SymValue(fdes[i].fn) < ldr.SymValue(fdes[j].fn)
+		})
+		for i, f := range fdes {
+			sb.SetUint32(arch, int64(12+8*i), uint32(ldr.SymValue(f.fn)-base))
+			sb.SetUint32(arch, int64(16+8*i), uint32(ldr.SymValue(frame)+f.off-base))
+		}
+	}
+	ehframeHdr = ctxt.createGeneratorSymbol(".eh_frame_hdr", 0, sym.SELFROSECT, int64(12+8*len(fdes)), writeHdr)
+	ldr.SetAttrReachable(ehframeHdr, true)
+	ldr.SetAttrLocal(ehframeHdr, true)
+	ldr.SetSymAlign(ehframeHdr, 4)
+}
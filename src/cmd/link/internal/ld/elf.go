@@ -5,20 +5,26 @@
 package ld
 
 import (
+	"bytes"
 	"cmd/internal/objabi"
 	"cmd/internal/sys"
+	"cmd/link/internal/loadelf"
 	"cmd/link/internal/loader"
 	"cmd/link/internal/sym"
 	"crypto/sha1"
+	"crypto/sha256"
 	"debug/elf"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"internal/buildcfg"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 )
 
 /*
@@ -183,6 +189,11 @@ var (
 	// target platform uses.
 	elfRelType string
 
+	// Whether to write the SysV .hash and the GNU .gnu.hash
+	// tables of the dynamic symbols, as set by -hash-style.
+	elfSysvHash bool
+	elfGNUHash  bool
+
 	ehdr ElfEhdr
 	phdr [NSECT]*ElfPhdr
 	shdr [NSECT]*ElfShdr
@@ -467,6 +478,15 @@ func elfhash(name string) uint32 {
 	return h
 }
 
+// gnuhash is the hash function of the GNU hash table.
+func gnuhash(name string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(name); i++ {
+		h = h*33 + uint32(name[i])
+	}
+	return h
+}
+
 func elfWriteDynEntSym(ctxt *Link, s *loader.SymbolBuilder, tag elf.DynTag, t loader.Sym) {
 	Elfwritedynentsymplus(ctxt, s, tag, t, 0)
 }
@@ -499,6 +519,46 @@ func elfwritedynentsymsize(ctxt *Link, s *loader.SymbolBuilder, tag elf.DynTag,
 	s.AddSize(ctxt.Arch, t)
 }
 
+// elfInterpreter returns the program interpreter of the output: the
+// one given with -I or by the cgo directives, or else the default for
+// the target.
+func (ctxt *Link) elfInterpreter() string {
+	p := interpreter
+	if p == "" && buildcfg.GOOS == runtime.GOOS && buildcfg.GOARCH == runtime.GOARCH && buildcfg.GO_LDSO != "" {
+		p = buildcfg.GO_LDSO
+	}
+
+	if p == "" {
+		switch ctxt.HeadType {
+		case objabi.Hlinux:
+			if buildcfg.GOOS == "android" {
+				p = thearch.Androiddynld
+				if p == "" {
+					Exitf("ELF interpreter not set")
+				}
+			} else {
+				p = thearch.Linuxdynld
+			}
+
+		case objabi.Hfreebsd:
+			p = thearch.Freebsddynld
+
+		case objabi.Hnetbsd:
+			p = thearch.Netbsddynld
+
+		case objabi.Hopenbsd:
+			p = thearch.Openbsddynld
+
+		case objabi.Hdragonfly:
+			p = thearch.Dragonflydynld
+
+		case objabi.Hsolaris:
+			p = thearch.Solarisdynld
+		}
+	}
+	return p
+}
+
 func elfinterp(sh *ElfShdr, startva uint64, resoff uint64, p string) int {
 	interp = p
 	n := len(interp) + 1
@@ -538,6 +598,22 @@ const (
 	MIPS_FPABI_FP64A = 7
 )
 
+// Processor-specific attributes sections, as per the ELF for the Arm
+// Architecture and the RISC-V ELF psABI.
+const (
+	SHT_ARM_ATTRIBUTES   = elf.SectionType(0x70000003)
+	SHT_RISCV_ATTRIBUTES = elf.SectionType(0x70000003)
+	PT_RISCV_ATTRIBUTES  = elf.ProgType(0x70000003)
+)
+
+// HostAttrs is the processor-specific attributes section of a host
+// object, .ARM.attributes on arm or .riscv.attributes on riscv64. The
+// architecture backend merges them into the attributes of the output.
+type HostAttrs struct {
+	Pn    string // the object, for errors
+	Attrs loadelf.Attributes
+}
+
 func elfMipsAbiFlags(sh *ElfShdr, startva uint64, resoff uint64) int {
 	n := 24
 	sh.Addr = startva + resoff - uint64(n)
@@ -708,7 +784,17 @@ func elfwriteopenbsdsig(out *OutBuf) int {
 	return int(sh.Size)
 }
 
+// gobuildinfo is set by -B gobuildid, for addgobuildinfo to derive the
+// GNU build ID from the Go build ID once all the flags are parsed.
+var gobuildinfo bool
+
 func addbuildinfo(val string) {
+	if val == "gobuildid" {
+		gobuildinfo = true
+		return
+	}
+	gobuildinfo = false
+
 	if !strings.HasPrefix(val, "0x") {
 		Exitf("-B argument must start with 0x: %s", val)
 	}
@@ -735,6 +821,19 @@ func addbuildinfo(val string) {
 	buildinfo = b
 }
 
+// addgobuildinfo sets the GNU build ID for -B gobuildid: the first 20
+// bytes of the SHA-256 hash of the Go build ID, the size of the SHA-1
+// build IDs of the GNU linkers. The go command derives the Go build ID
+// it gives the linker from the inputs of the link, so the GNU build ID
+// is the same for identical builds and changes when the build changes.
+func addgobuildinfo() {
+	if *flagBuildid == "" {
+		Exitf("-B gobuildid requires a Go build ID, set with -buildid")
+	}
+	sum := sha256.Sum256([]byte(*flagBuildid))
+	buildinfo = sum[:20]
+}
+
 // Build info note
 const (
 	ELF_NOTE_BUILDINFO_NAMESZ = 4
@@ -781,12 +880,226 @@ func elfwritegobuildid(out *OutBuf) int {
 	return int(sh.Size)
 }
 
+// GNU property note, as per the Linux Extensions to gABI.
+const (
+	NT_GNU_PROPERTY_TYPE_0 = 5
+
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND = 0xc0000000
+	GNU_PROPERTY_AARCH64_FEATURE_1_BTI = 1 << 0
+	GNU_PROPERTY_AARCH64_FEATURE_1_PAC = 1 << 1
+
+	GNU_PROPERTY_X86_FEATURE_1_AND   = 0xc0000002
+	GNU_PROPERTY_X86_FEATURE_1_IBT   = 1 << 0
+	GNU_PROPERTY_X86_FEATURE_1_SHSTK = 1 << 1
+)
+
+// gnuFeatures holds the processor features, such as BTI on arm64 or
+// IBT on x86, that the output supports, to record in its
+// .note.gnu.property note. It starts as the features asserted with
+// -cfprotection, and then loses those that a host object does not
+// support.
+var gnuFeatures uint32
+
+// parseCFProtection sets gnuFeatures from the value of -cfprotection,
+// a comma-separated list of features.
+func parseCFProtection(ctxt *Link, val string) {
+	var names map[string]uint32
+	switch {
+	case ctxt.IsELF && ctxt.IsARM64():
+		names = map[string]uint32{
+			"bti": GNU_PROPERTY_AARCH64_FEATURE_1_BTI,
+			"pac": GNU_PROPERTY_AARCH64_FEATURE_1_PAC,
+		}
+	case ctxt.IsELF && (ctxt.IsAMD64() || ctxt.Is386()):
+		names = map[string]uint32{
+			"ibt":   GNU_PROPERTY_X86_FEATURE_1_IBT,
+			"shstk": GNU_PROPERTY_X86_FEATURE_1_SHSTK,
+		}
+	default:
+		Exitf("-cfprotection is not supported on %s/%s", buildcfg.GOOS, buildcfg.GOARCH)
+	}
+	for _, name := range strings.Split(val, ",") {
+		f, ok := names[name]
+		if !ok {
+			Exitf("-cfprotection: unknown feature %q for %s", name, buildcfg.GOARCH)
+		}
+		gnuFeatures |= f
+	}
+}
+
+// gnuPropertyType returns the type of the property holding the
+// features in gnuFeatures.
+func gnuPropertyType(arch *sys.Arch) uint32 {
+	switch arch.Family {
+	case sys.ARM64:
+		return GNU_PROPERTY_AARCH64_FEATURE_1_AND
+	case sys.AMD64, sys.I386:
+		return GNU_PROPERTY_X86_FEATURE_1_AND
+	}
+	return 0
+}
+
+// gnuPropertyDescsz returns the size of the descriptor of the GNU
+// property note. It holds a single property, padded to 8 bytes on ELF64.
+func gnuPropertyDescsz() int {
+	if elf64 {
+		return 16
+	}
+	return 12
+}
+
+func elfgnuproperty(sh *ElfShdr, startva uint64, resoff uint64) int {
+	// Unlike the other notes, this note is aligned to 8 bytes on ELF64.
+	align := uint64(4)
+	if elf64 {
+		align = 8
+	}
+	sz := uint64(3*4+len(ELF_NOTE_BUILDINFO_NAME)) + uint64(gnuPropertyDescsz())
+	off := (resoff - sz) &^ (align - 1)
+
+	sh.Type = uint32(elf.SHT_NOTE)
+	sh.Flags = uint64(elf.SHF_ALLOC)
+	sh.Addralign = align
+	sh.Addr = startva + off
+	sh.Off = off
+	sh.Size = sz
+
+	return int(resoff - off)
+}
+
+func elfwritegnuproperty(ctxt *Link, out *OutBuf) int {
+	sh := elfwritenotehdr(out, ".note.gnu.property", uint32(len(ELF_NOTE_BUILDINFO_NAME)), uint32(gnuPropertyDescsz()), NT_GNU_PROPERTY_TYPE_0)
+	if sh == nil {
+		return 0
+	}
+
+	out.Write(ELF_NOTE_BUILDINFO_NAME)
+	out.Write32(gnuPropertyType(ctxt.Arch))
+	out.Write32(4)
+	out.Write32(gnuFeatures)
+	if elf64 {
+		out.Write32(0)
+	}
+
+	return int(sh.Size)
+}
+
+// addgnuproperty adds the .note.gnu.property note to go.o, when
+// linking externally.
+func addgnuproperty(ctxt *Link) {
+	ldr := ctxt.loader
+	s := ldr.CreateSymForUpdate(".note.gnu.property", 0)
+	s.SetType(sym.SELFROSECT)
+	s.AddUint32(ctxt.Arch, uint32(len(ELF_NOTE_BUILDINFO_NAME)))
+	s.AddUint32(ctxt.Arch, uint32(gnuPropertyDescsz()))
+	s.AddUint32(ctxt.Arch, NT_GNU_PROPERTY_TYPE_0)
+	s.AddBytes(ELF_NOTE_BUILDINFO_NAME)
+	s.AddUint32(ctxt.Arch, gnuPropertyType(ctxt.Arch))
+	s.AddUint32(ctxt.Arch, 4)
+	s.AddUint32(ctxt.Arch, gnuFeatures)
+	if elf64 {
+		s.AddUint32(ctxt.Arch, 0)
+	}
+	s.SetSize(int64(len(s.Data())))
+	s.SetAlign(int32(ctxt.Arch.PtrSize))
+}
+
+// Package metadata note, as per the systemd Package Notes spec
+// (https://systemd.io/ELF_PACKAGE_METADATA/).
+const (
+	NT_FDO_PACKAGING_METADATA = 0xcafe1a7e
+)
+
+var ELF_NOTE_FDO_NAME = []byte("FDO\x00")
+
+// packageNote holds the package metadata set with -package-note, as
+// the NUL-terminated JSON object of the .note.package note.
+var packageNote []byte
+
+// parsePackageNote sets packageNote from the value of -package-note:
+// a JSON object, or @file to read it from file.
+func parsePackageNote(ctxt *Link, val string) {
+	if !ctxt.IsELF {
+		Exitf("-package-note is only supported for ELF")
+	}
+	data := []byte(val)
+	if strings.HasPrefix(val, "@") {
+		var err error
+		data, err = ioutil.ReadFile(val[1:])
+		if err != nil {
+			Exitf("-package-note: %v", err)
+		}
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		Exitf("-package-note: invalid JSON: %v", err)
+	}
+	if b.Bytes()[0] != '{' {
+		Exitf("-package-note: the metadata must be a JSON object")
+	}
+
+	// JSON text has no NUL bytes, so the terminator ends the string.
+	b.WriteByte(0)
+	packageNote = b.Bytes()
+}
+
+// packageNoteReserve returns the room, in whole pages, that the
+// .note.package note needs in the reserved area at the start of the
+// file, on top of ELFRESERVE.
+func packageNoteReserve() int64 {
+	if len(packageNote) == 0 {
+		return 0
+	}
+	return Rnd(int64(3*4+len(ELF_NOTE_FDO_NAME)+len(packageNote)), ELFRESERVE)
+}
+
+func elfpackagenote(sh *ElfShdr, startva uint64, resoff uint64) int {
+	n := len(ELF_NOTE_FDO_NAME) + int(Rnd(int64(len(packageNote)), 4))
+	return elfnote(sh, startva, resoff, n)
+}
+
+func elfwritepackagenote(out *OutBuf) int {
+	sh := elfwritenotehdr(out, ".note.package", uint32(len(ELF_NOTE_FDO_NAME)), uint32(len(packageNote)), NT_FDO_PACKAGING_METADATA)
+	if sh == nil {
+		return 0
+	}
+
+	out.Write(ELF_NOTE_FDO_NAME)
+	out.Write(packageNote)
+	var zero = make([]byte, 4)
+	out.Write(zero[:int(Rnd(int64(len(packageNote)), 4)-int64(len(packageNote)))])
+
+	return int(sh.Size)
+}
+
+// addpackagenote adds the .note.package note to go.o, when linking
+// externally.
+func addpackagenote(ctxt *Link) {
+	ldr := ctxt.loader
+	s := ldr.CreateSymForUpdate(".note.package", 0)
+	s.SetType(sym.SELFROSECT)
+	s.AddUint32(ctxt.Arch, uint32(len(ELF_NOTE_FDO_NAME)))
+	s.AddUint32(ctxt.Arch, uint32(len(packageNote)))
+	s.AddUint32(ctxt.Arch, NT_FDO_PACKAGING_METADATA)
+	s.AddBytes(ELF_NOTE_FDO_NAME)
+	s.AddBytes(packageNote)
+	for len(s.Data())%4 != 0 {
+		s.AddUint8(0)
+	}
+	s.SetSize(int64(len(s.Data())))
+	s.SetAlign(4)
+}
+
 // Go specific notes
 const (
 	ELF_NOTE_GOPKGLIST_TAG = 1
 	ELF_NOTE_GOABIHASH_TAG = 2
 	ELF_NOTE_GODEPS_TAG    = 3
 	ELF_NOTE_GOBUILDID_TAG = 4
+
+	// The fingerprints of the packages in a Go shared library, one
+	// "path fingerprint" line each, checked by -linkshared links.
+	ELF_NOTE_GOPKGHASHES_TAG = 5
 )
 
 var ELF_NOTE_GO_NAME = []byte("Go\x00\x00")
@@ -837,65 +1150,40 @@ func elfdynhash(ctxt *Link) {
 		return
 	}
 
+	// The GNU hash table renumbers the dynamic symbols, so it
+	// comes before everything that records their numbers.
+	if elfGNUHash {
+		elfgnuhash(ctxt)
+	}
+
 	nsym := Nelfsym
 	ldr := ctxt.loader
-	s := ldr.CreateSymForUpdate(".hash", 0)
-	s.SetType(sym.SELFROSECT)
-
-	i := nsym
-	nbucket := 1
-	for i > 0 {
-		nbucket++
-		i >>= 1
-	}
 
 	var needlib *Elflib
 	need := make([]*Elfaux, nsym)
-	chain := make([]uint32, nsym)
-	buckets := make([]uint32, nbucket)
-
 	for _, sy := range ldr.DynidSyms() {
-
-		dynid := ldr.SymDynid(sy)
 		if ldr.SymDynimpvers(sy) != "" {
-			need[dynid] = addelflib(&needlib, ldr.SymDynimplib(sy), ldr.SymDynimpvers(sy))
+			need[ldr.SymDynid(sy)] = addelflib(&needlib, ldr.SymDynimplib(sy), ldr.SymDynimpvers(sy))
 		}
+	}
 
-		name := ldr.SymExtname(sy)
-		hc := elfhash(name)
-
-		b := hc % uint32(nbucket)
-		chain[dynid] = buckets[b]
-		buckets[b] = uint32(dynid)
+	if elfSysvHash {
+		elfsysvhash(ctxt)
 	}
 
-	// s390x (ELF64) hash table entries are 8 bytes
-	if ctxt.Arch.Family == sys.S390X {
-		s.AddUint64(ctxt.Arch, uint64(nbucket))
-		s.AddUint64(ctxt.Arch, uint64(nsym))
-		for i := 0; i < nbucket; i++ {
-			s.AddUint64(ctxt.Arch, uint64(buckets[i]))
-		}
-		for i := 0; i < nsym; i++ {
-			s.AddUint64(ctxt.Arch, uint64(chain[i]))
-		}
-	} else {
-		s.AddUint32(ctxt.Arch, uint32(nbucket))
-		s.AddUint32(ctxt.Arch, uint32(nsym))
-		for i := 0; i < nbucket; i++ {
-			s.AddUint32(ctxt.Arch, buckets[i])
-		}
-		for i := 0; i < nsym; i++ {
-			s.AddUint32(ctxt.Arch, chain[i])
-		}
+	// glibc refuses to load a program with DT_RELR that needs versions
+	// of libc.so.6 but not GLIBC_ABI_DT_RELR, so that a program using
+	// RELR fails cleanly with an older glibc that ignores DT_RELR.
+	if len(elfRelr) > 0 && ctxt.IsLinux() && needlib != nil {
+		addelflib(&needlib, "libc.so.6", "GLIBC_ABI_DT_RELR")
 	}
 
 	dynstr := ldr.CreateSymForUpdate(".dynstr", 0)
 
 	// version symbols
 	gnuVersionR := ldr.CreateSymForUpdate(".gnu.version_r", 0)
-	s = gnuVersionR
-	i = 2
+	s := gnuVersionR
+	i := 2
 	nfile := 0
 	for l := needlib; l != nil; l = l.next {
 		nfile++
@@ -947,10 +1235,36 @@ func elfdynhash(ctxt *Link) {
 	}
 
 	s = ldr.CreateSymForUpdate(".dynamic", 0)
+	var flags, flags1 uint64
 	if ctxt.BuildMode == BuildModePIE {
 		// https://github.com/bminor/glibc/blob/895ef79e04a953cac1493863bcae29ad85657ee1/elf/elf.h#L986
 		const DTFLAGS_1_PIE = 0x08000000
-		Elfwritedynent(ctxt.Arch, s, elf.DT_FLAGS_1, uint64(DTFLAGS_1_PIE))
+		flags1 |= DTFLAGS_1_PIE
+	}
+	if elfTextrel {
+		// The dynamic linker must write to the text segment
+		// (see PIEAbsReloc).
+		Elfwritedynent(ctxt.Arch, s, elf.DT_TEXTREL, 0)
+		flags |= uint64(elf.DF_TEXTREL)
+	}
+	if *flagBindNow {
+		// Bind the PLT entries at startup rather than on first
+		// call, so that the GOT can be in the relro segment.
+		const DTFLAGS_1_NOW = 0x00000001
+		flags |= uint64(elf.DF_BIND_NOW)
+		flags1 |= DTFLAGS_1_NOW
+	}
+	if flags1 != 0 {
+		Elfwritedynent(ctxt.Arch, s, elf.DT_FLAGS_1, flags1)
+	}
+	if flags != 0 {
+		Elfwritedynent(ctxt.Arch, s, elf.DT_FLAGS, flags)
+	}
+	if len(elfRelr) > 0 {
+		relr := ldr.LookupOrCreateSym(".relr.dyn", 0)
+		elfWriteDynEntSym(ctxt, s, DT_RELR, relr)
+		elfwritedynentsymsize(ctxt, s, DT_RELRSZ, relr)
+		Elfwritedynent(ctxt.Arch, s, DT_RELRENT, 8)
 	}
 	elfverneed = nfile
 	if elfverneed != 0 {
@@ -973,6 +1287,209 @@ func elfdynhash(ctxt *Link) {
 	Elfwritedynent(ctxt.Arch, s, elf.DT_NULL, 0)
 }
 
+// elfsysvhash writes the SysV hash table of the dynamic symbols, .hash.
+func elfsysvhash(ctxt *Link) {
+	nsym := Nelfsym
+	ldr := ctxt.loader
+	s := ldr.CreateSymForUpdate(".hash", 0)
+	s.SetType(sym.SELFROSECT)
+
+	i := nsym
+	nbucket := 1
+	for i > 0 {
+		nbucket++
+		i >>= 1
+	}
+
+	chain := make([]uint32, nsym)
+	buckets := make([]uint32, nbucket)
+
+	for _, sy := range ldr.DynidSyms() {
+		dynid := ldr.SymDynid(sy)
+		name := ldr.SymExtname(sy)
+		hc := elfhash(name)
+
+		b := hc % uint32(nbucket)
+		chain[dynid] = buckets[b]
+		buckets[b] = uint32(dynid)
+	}
+
+	// s390x (ELF64) hash table entries are 8 bytes
+	if ctxt.Arch.Family == sys.S390X {
+		s.AddUint64(ctxt.Arch, uint64(nbucket))
+		s.AddUint64(ctxt.Arch, uint64(nsym))
+		for i := 0; i < nbucket; i++ {
+			s.AddUint64(ctxt.Arch, uint64(buckets[i]))
+		}
+		for i := 0; i < nsym; i++ {
+			s.AddUint64(ctxt.Arch, uint64(chain[i]))
+		}
+	} else {
+		s.AddUint32(ctxt.Arch, uint32(nbucket))
+		s.AddUint32(ctxt.Arch, uint32(nsym))
+		for i := 0; i < nbucket; i++ {
+			s.AddUint32(ctxt.Arch, buckets[i])
+		}
+		for i := 0; i < nsym; i++ {
+			s.AddUint32(ctxt.Arch, chain[i])
+		}
+	}
+}
+
+// elfgnuhash writes the GNU hash table of the dynamic symbols,
+// .gnu.hash. The table covers only the defined symbols, which must
+// come last in .dynsym, ordered by bucket, so elfgnuhash first moves
+// the undefined symbols to the front and sorts the rest.
+func elfgnuhash(ctxt *Link) {
+	ldr := ctxt.loader
+
+	type hashed struct {
+		s loader.Sym
+		h uint32
+	}
+	byid := make([]loader.Sym, Nelfsym)
+	for _, s := range ldr.DynidSyms() {
+		byid[ldr.SymDynid(s)] = s
+	}
+	order := []loader.Sym{0}
+	var defined []hashed
+	for _, s := range byid[1:] {
+		if ldr.SymType(s) == sym.SDYNIMPORT {
+			order = append(order, s)
+		} else {
+			defined = append(defined, hashed{s, gnuhash(ldr.SymExtname(s))})
+		}
+	}
+	symoffset := len(order)
+
+	nbucket := uint32(len(defined)/4 + 1)
+	sort.SliceStable(defined, func(i, j int) bool {
+		return defined[i].h%nbucket < defined[j].h%nbucket
+	})
+	for _, d := range defined {
+		order = append(order, d.s)
+	}
+	elfrenumberdynsyms(ctxt, byid, order)
+
+	// The Bloom filter has two bits set per symbol in words of
+	// the class size, and about 12 bits per symbol.
+	const shift2 = 26
+	wordBits := uint32(ctxt.Arch.PtrSize * 8)
+	maskwords := uint32(1)
+	for maskwords*wordBits < uint32(len(defined))*12 {
+		maskwords <<= 1
+	}
+	bloom := make([]uint64, maskwords)
+	buckets := make([]uint32, nbucket)
+	chain := make([]uint32, len(defined))
+	for i, d := range defined {
+		bloom[d.h/wordBits%maskwords] |= 1<<(d.h%wordBits) | 1<<(d.h>>shift2%wordBits)
+		b := d.h % nbucket
+		if buckets[b] == 0 {
+			buckets[b] = uint32(symoffset + i)
+		}
+		// The low bit marks the last symbol of a bucket.
+		chain[i] = d.h &^ 1
+		if i == len(defined)-1 || defined[i+1].h%nbucket != b {
+			chain[i] |= 1
+		}
+	}
+
+	s := ldr.CreateSymForUpdate(".gnu.hash", 0)
+	s.SetType(sym.SELFROSECT)
+	s.AddUint32(ctxt.Arch, nbucket)
+	s.AddUint32(ctxt.Arch, uint32(symoffset))
+	s.AddUint32(ctxt.Arch, maskwords)
+	s.AddUint32(ctxt.Arch, shift2)
+	for _, w := range bloom {
+		s.AddUint(ctxt.Arch, w)
+	}
+	for _, b := range buckets {
+		s.AddUint32(ctxt.Arch, b)
+	}
+	for _, c := range chain {
+		s.AddUint32(ctxt.Arch, c)
+	}
+}
+
+// elfrenumberdynsyms gives order[i] the dynamic symbol number i, where
+// byid lists the dynamic symbols by their current number. It moves the
+// .dynsym entries and rewrites the symbol numbers of the dynamic
+// relocations to match.
+func elfrenumberdynsyms(ctxt *Link, byid, order []loader.Sym) {
+	ldr := ctxt.loader
+	newid := make([]int64, len(byid))
+	same := true
+	for i := 1; i < len(order); i++ {
+		id := ldr.SymDynid(order[i])
+		newid[id] = int64(i)
+		same = same && id == int32(i)
+	}
+	if same {
+		return
+	}
+	for i := 1; i < len(order); i++ {
+		ldr.SetSymDynid(order[i], int32(i))
+	}
+
+	symsize := int64(ELF32SYMSIZE)
+	if elf64 {
+		symsize = ELF64SYMSIZE
+	}
+	dynsym := ldr.MakeSymbolUpdater(ctxt.DynSym)
+	old := dynsym.Data()
+	data := make([]byte, len(old))
+	copy(data, old[:symsize])
+	for i := int64(1); i < int64(len(byid)); i++ {
+		copy(data[newid[i]*symsize:], old[i*symsize:(i+1)*symsize])
+	}
+	type reloc struct {
+		off int64
+		siz uint8
+		typ objabi.RelocType
+		sym loader.Sym
+		add int64
+	}
+	relocs := dynsym.Relocs()
+	rs := make([]reloc, relocs.Count())
+	for i := range rs {
+		r := relocs.At(i)
+		rs[i] = reloc{int64(r.Off()), r.Siz(), r.Type(), r.Sym(), r.Add()}
+	}
+	dynsym.SetData(data)
+	dynsym.ResetRelocs()
+	for _, r := range rs {
+		nr, _ := dynsym.AddRel(r.typ)
+		nr.SetOff(int32(newid[r.off/symsize]*symsize + r.off%symsize))
+		nr.SetSiz(r.siz)
+		nr.SetSym(r.sym)
+		nr.SetAdd(r.add)
+	}
+	dynsym.SortRelocs()
+
+	if elfRelType == ".rela" {
+		for _, s := range []loader.Sym{ctxt.Rela, ctxt.RelaPLT} {
+			su := ldr.MakeSymbolUpdater(s)
+			for off := int64(0); off+ELF64RELASIZE <= su.Size(); off += ELF64RELASIZE {
+				info := ctxt.Arch.ByteOrder.Uint64(su.Data()[off+8:])
+				if id := info >> 32; id != 0 {
+					su.SetUint(ctxt.Arch, off+8, elf.R_INFO(uint32(newid[id]), uint32(info)))
+				}
+			}
+		}
+	} else {
+		for _, s := range []loader.Sym{ctxt.Rel, ctxt.RelPLT} {
+			su := ldr.MakeSymbolUpdater(s)
+			for off := int64(0); off+ELF32RELSIZE <= su.Size(); off += ELF32RELSIZE {
+				info := ctxt.Arch.ByteOrder.Uint32(su.Data()[off+4:])
+				if id := info >> 8; id != 0 {
+					su.SetUint32(ctxt.Arch, off+4, elf.R_INFO32(uint32(newid[id]), info&0xff))
+				}
+			}
+		}
+	}
+}
+
 func elfphload(seg *sym.Segment) *ElfPhdr {
 	ph := newElfPhdr()
 	ph.Type = elf.PT_LOAD
@@ -991,6 +1508,9 @@ func elfphload(seg *sym.Segment) *ElfPhdr {
 	ph.Off = seg.Fileoff
 	ph.Filesz = seg.Filelen
 	ph.Align = uint64(*FlagRound)
+	if seg == &Segtext && *flagTextAlign != 0 {
+		ph.Align = uint64(*flagTextAlign)
+	}
 
 	return ph
 }
@@ -1095,9 +1615,22 @@ func elfshbits(linkmode LinkMode, sect *sym.Section) *ElfShdr {
 		sh.Flags |= uint64(elf.SHF_TLS)
 		sh.Type = uint32(elf.SHT_NOBITS)
 	}
+	if sect.Name == ".tdata" {
+		sh.Flags |= uint64(elf.SHF_TLS)
+	}
+	if sect.Name == ".preinit_array" {
+		sh.Type = uint32(elf.SHT_PREINIT_ARRAY)
+	}
+	if sect.Name == ".relr.dyn" {
+		sh.Type = uint32(SHT_RELR)
+		sh.Entsize = 8
+	}
 	if strings.HasPrefix(sect.Name, ".debug") || strings.HasPrefix(sect.Name, ".zdebug") {
 		sh.Flags = 0
 	}
+	if sect.Compressed {
+		sh.Flags |= uint64(elf.SHF_COMPRESSED)
+	}
 
 	if linkmode != LinkExternal {
 		sh.Addr = sect.Vaddr
@@ -1162,7 +1695,46 @@ func elfrelocsect(ctxt *Link, out *OutBuf, sect *sym.Section, syms []loader.Sym)
 		return
 	}
 
-	ldr := ctxt.loader
+	syms = elfsectsyms(ctxt.loader, sect, syms)
+	batches := relocBatches(ctxt, syms)
+	if len(batches) == 1 {
+		elfrelocsyms(ctxt, out, sect, syms)
+	} else {
+		// Convert the batches in parallel, each into a buffer of
+		// its own, and copy the buffers to the output in order,
+		// so that the output is the same as that of a serial run.
+		bufs := make([]*OutBuf, len(batches))
+		var wg sync.WaitGroup
+		sem := make(chan int, runtime.GOMAXPROCS(0))
+		for i, batch := range batches {
+			wg.Add(1)
+			sem <- 1
+			go func(i int, batch relocBatch) {
+				buf := NewOutBuf(ctxt.Arch)
+				buf.heap = make([]byte, 0, batch.nreloc*int(thearch.ElfrelocSize))
+				elfrelocsyms(ctxt, buf, sect, batch.syms)
+				bufs[i] = buf
+				wg.Done()
+				<-sem
+			}(i, batch)
+		}
+		wg.Wait()
+		for _, buf := range bufs {
+			out.Write(buf.heap)
+		}
+	}
+
+	// sanity check
+	if uint64(out.Offset()) != sect.Reloff+sect.Rellen {
+		panic(fmt.Sprintf("elfrelocsect: size mismatch %d != %d + %d", out.Offset(), sect.Reloff, sect.Rellen))
+	}
+}
+
+// elfrelocsyms writes the external relocations of syms, which are in
+// section sect, to out.
+// elfsectsyms returns the run of syms, which are sorted by address,
+// that is in sect.
+func elfsectsyms(ldr *loader.Loader, sect *sym.Section, syms []loader.Sym) []loader.Sym {
 	for i, s := range syms {
 		if !ldr.AttrReachable(s) {
 			panic("should never happen")
@@ -1174,13 +1746,21 @@ func elfrelocsect(ctxt *Link, out *OutBuf, sect *sym.Section, syms []loader.Sym)
 	}
 
 	eaddr := sect.Vaddr + sect.Length
+	for i, s := range syms {
+		if ldr.AttrReachable(s) && ldr.SymValue(s) >= int64(eaddr) {
+			syms = syms[:i]
+			break
+		}
+	}
+	return syms
+}
+
+func elfrelocsyms(ctxt *Link, out *OutBuf, sect *sym.Section, syms []loader.Sym) {
+	ldr := ctxt.loader
 	for _, s := range syms {
 		if !ldr.AttrReachable(s) {
 			continue
 		}
-		if ldr.SymValue(s) >= int64(eaddr) {
-			break
-		}
 
 		// Compute external relocations on the go, and pass to Elfreloc1
 		// to stream out.
@@ -1202,16 +1782,15 @@ func elfrelocsect(ctxt *Link, out *OutBuf, sect *sym.Section, syms []loader.Sym)
 			if !ldr.AttrReachable(rr.Xsym) {
 				ldr.Errorf(s, "unreachable reloc %d (%s) target %v", r.Type(), sym.RelocName(ctxt.Arch, r.Type()), ldr.SymName(rr.Xsym))
 			}
+			off := out.Offset()
 			if !thearch.Elfreloc1(ctxt, out, ldr, s, rr, ri, int64(uint64(ldr.SymValue(s)+int64(r.Off()))-sect.Vaddr)) {
 				ldr.Errorf(s, "unsupported obj reloc %d (%s)/%d to %s", r.Type(), sym.RelocName(ctxt.Arch, r.Type()), r.Siz(), ldr.SymName(r.Sym()))
 			}
+			if ctxt.relocDump != nil {
+				ctxt.relocDump.add(ctxt, sect, s, r, rr, out.bytesAt(off, out.Offset()-off))
+			}
 		}
 	}
-
-	// sanity check
-	if uint64(out.Offset()) != sect.Reloff+sect.Rellen {
-		panic(fmt.Sprintf("elfrelocsect: size mismatch %d != %d + %d", out.Offset(), sect.Reloff, sect.Rellen))
-	}
 }
 
 func elfEmitReloc(ctxt *Link) {
@@ -1220,6 +1799,7 @@ func elfEmitReloc(ctxt *Link) {
 	}
 
 	sizeExtRelocs(ctxt, thearch.ElfrelocSize)
+	defer ctxt.deferErrors()()
 	relocSect, wg := relocSectFn(ctxt, elfrelocsect)
 
 	for _, sect := range Segtext.Sections {
@@ -1275,6 +1855,25 @@ func addgonote(ctxt *Link, sectionName string, tag uint32, desc []byte) {
 	s.SetAlign(4)
 }
 
+// hasTLSData reports whether there are reachable thread-local
+// variables with initial values, which host objects define in .tdata.
+func hasTLSData(ldr *loader.Loader) bool {
+	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+		if ldr.AttrReachable(s) && ldr.SymType(s) == sym.STLSDATA {
+			return true
+		}
+	}
+	return false
+}
+
+// noSectionHeaders reports whether the output is written without its
+// section headers, for -strip=sections. When linking externally, the
+// object file for the external linker needs them, and the output of the
+// external linker is stripped instead, by elfStripSections.
+func (ctxt *Link) noSectionHeaders() bool {
+	return ctxt.strip&stripSections != 0 && !ctxt.IsExternal()
+}
+
 func (ctxt *Link) doelf() {
 	ldr := ctxt.loader
 
@@ -1282,6 +1881,11 @@ func (ctxt *Link) doelf() {
 	shstrtab := ldr.CreateSymForUpdate(".shstrtab", 0)
 
 	shstrtab.SetType(sym.SELFROSECT)
+	if ctxt.noSectionHeaders() {
+		// The names are still needed for the section headers built in
+		// memory, but neither they nor the headers are written.
+		ldr.SetAttrReachable(shstrtab.Sym(), false)
+	}
 
 	shstrtab.Addstring("")
 	shstrtab.Addstring(".text")
@@ -1291,10 +1895,36 @@ func (ctxt *Link) doelf() {
 	shstrtab.Addstring(".noptrbss")
 	shstrtab.Addstring("__libfuzzer_extra_counters")
 	shstrtab.Addstring(".go.buildinfo")
+	for _, ls := range ctxt.sectLayout {
+		shstrtab.Addstring(ls.name)
+	}
+	for _, r := range reservedSections {
+		shstrtab.Addstring(r.name)
+	}
+	for _, a := range addedSections {
+		if a.alloc {
+			shstrtab.Addstring(a.name)
+		}
+	}
+	if *flagEHFrame {
+		shstrtab.Addstring(".eh_frame")
+		if ctxt.IsInternal() {
+			shstrtab.Addstring(".eh_frame_hdr")
+		}
+	}
+	if ctxt.pkgTextTabSym() != 0 {
+		shstrtab.Addstring(pkgTextSectName)
+	}
 	if ctxt.IsMIPS() {
 		shstrtab.Addstring(".MIPS.abiflags")
 		shstrtab.Addstring(".gnu.attributes")
 	}
+	if ctxt.IsARM() {
+		shstrtab.Addstring(".ARM.attributes")
+	}
+	if ctxt.IsRISCV64() {
+		shstrtab.Addstring(".riscv.attributes")
+	}
 
 	// generate .tbss section for dynamic internal linker or external
 	// linking, so that various binutils could correctly calculate
@@ -1302,6 +1932,9 @@ func (ctxt *Link) doelf() {
 	if !*FlagD || ctxt.IsExternal() {
 		shstrtab.Addstring(".tbss")
 	}
+	if ctxt.IsInternal() && hasTLSData(ldr) {
+		shstrtab.Addstring(".tdata")
+	}
 	if ctxt.IsNetbsd() {
 		shstrtab.Addstring(".note.netbsd.ident")
 		if *flagRace {
@@ -1317,6 +1950,12 @@ func (ctxt *Link) doelf() {
 	if *flagBuildid != "" {
 		shstrtab.Addstring(".note.go.buildid")
 	}
+	if gnuFeatures != 0 {
+		shstrtab.Addstring(".note.gnu.property")
+	}
+	if len(packageNote) > 0 {
+		shstrtab.Addstring(".note.package")
+	}
 	shstrtab.Addstring(".elfdata")
 	shstrtab.Addstring(".rodata")
 	// See the comment about data.rel.ro.FOO section names in data.go.
@@ -1330,9 +1969,8 @@ func (ctxt *Link) doelf() {
 	shstrtab.Addstring(relro_prefix + ".gosymtab")
 	shstrtab.Addstring(relro_prefix + ".gopclntab")
 
-	if ctxt.IsExternal() {
-		*FlagD = true
-
+	// Relocation sections, for the external linker or -emitreloc.
+	if ctxt.IsExternal() || *flagEmitReloc {
 		shstrtab.Addstring(elfRelType + ".text")
 		shstrtab.Addstring(elfRelType + ".rodata")
 		shstrtab.Addstring(elfRelType + relro_prefix + ".typelink")
@@ -1345,10 +1983,33 @@ func (ctxt *Link) doelf() {
 			shstrtab.Addstring(elfRelType + ".data.rel.ro")
 		}
 		shstrtab.Addstring(elfRelType + ".go.buildinfo")
+		for _, r := range reservedSections {
+			shstrtab.Addstring(elfRelType + r.name)
+		}
+		for _, a := range addedSections {
+			if a.alloc {
+				shstrtab.Addstring(elfRelType + a.name)
+			}
+		}
+		if *flagEHFrame {
+			shstrtab.Addstring(elfRelType + ".eh_frame")
+		}
+		if ctxt.pkgTextTabSym() != 0 {
+			shstrtab.Addstring(elfRelType + pkgTextSectName)
+		}
 		if ctxt.IsMIPS() {
 			shstrtab.Addstring(elfRelType + ".MIPS.abiflags")
 			shstrtab.Addstring(elfRelType + ".gnu.attributes")
 		}
+		if ctxt.IsARM() {
+			shstrtab.Addstring(elfRelType + ".ARM.attributes")
+		}
+		if ctxt.IsRISCV64() {
+			shstrtab.Addstring(elfRelType + ".riscv.attributes")
+		}
+	}
+	if ctxt.IsExternal() {
+		*FlagD = true
 
 		// add a .note.GNU-stack section to mark the stack as non-executable
 		shstrtab.Addstring(".note.GNU-stack")
@@ -1357,6 +2018,7 @@ func (ctxt *Link) doelf() {
 			shstrtab.Addstring(".note.go.abihash")
 			shstrtab.Addstring(".note.go.pkg-list")
 			shstrtab.Addstring(".note.go.deps")
+			shstrtab.Addstring(".note.go.pkg-hashes")
 		}
 	}
 
@@ -1368,7 +2030,7 @@ func (ctxt *Link) doelf() {
 		hasinitarr = true
 	}
 
-	if hasinitarr {
+	if hasinitarr || len(ctxt.initArray) != 0 {
 		shstrtab.Addstring(".init_array")
 		shstrtab.Addstring(elfRelType + ".init_array")
 	}
@@ -1376,14 +2038,28 @@ func (ctxt *Link) doelf() {
 	if !*FlagS {
 		shstrtab.Addstring(".symtab")
 		shstrtab.Addstring(".strtab")
-		dwarfaddshstrings(ctxt, shstrtab)
 	}
+	dwarfaddshstrings(ctxt, shstrtab)
 
 	shstrtab.Addstring(".shstrtab")
 
+	if *FlagD && ctxt.IsInternal() && len(hostobj) != 0 {
+		// The host objects may need GOT entries, which the linker
+		// fills in, see AddGotSym.
+		shstrtab.Addstring(".got")
+		got := ldr.CreateSymForUpdate(".got", 0)
+		got.SetType(sym.SELFGOT)
+	}
 	if !*FlagD { /* -d suppresses dynamic loader format */
-		shstrtab.Addstring(".interp")
-		shstrtab.Addstring(".hash")
+		if !*flagStaticPIE {
+			shstrtab.Addstring(".interp")
+		}
+		if elfSysvHash {
+			shstrtab.Addstring(".hash")
+		}
+		if elfGNUHash {
+			shstrtab.Addstring(".gnu.hash")
+		}
 		shstrtab.Addstring(".got")
 		if ctxt.IsPPC64() {
 			shstrtab.Addstring(".glink")
@@ -1394,6 +2070,9 @@ func (ctxt *Link) doelf() {
 		shstrtab.Addstring(".dynstr")
 		shstrtab.Addstring(elfRelType)
 		shstrtab.Addstring(elfRelType + ".plt")
+		if *flagPackRelocs {
+			shstrtab.Addstring(".relr.dyn")
+		}
 
 		shstrtab.Addstring(".plt")
 		shstrtab.Addstring(".gnu.version")
@@ -1432,8 +2111,15 @@ func (ctxt *Link) doelf() {
 		}
 
 		/* hash */
-		hash := ldr.CreateSymForUpdate(".hash", 0)
-		hash.SetType(sym.SELFROSECT)
+		var hash, gnuHash *loader.SymbolBuilder
+		if elfSysvHash {
+			hash = ldr.CreateSymForUpdate(".hash", 0)
+			hash.SetType(sym.SELFROSECT)
+		}
+		if elfGNUHash {
+			gnuHash = ldr.CreateSymForUpdate(".gnu.hash", 0)
+			gnuHash.SetType(sym.SELFROSECT)
+		}
 
 		gotplt := ldr.CreateSymForUpdate(".got.plt", 0)
 		gotplt.SetType(sym.SELFSECT) // writable
@@ -1469,7 +2155,12 @@ func (ctxt *Link) doelf() {
 		/*
 		 * .dynamic table
 		 */
-		elfWriteDynEntSym(ctxt, dynamic, elf.DT_HASH, hash.Sym())
+		if hash != nil {
+			elfWriteDynEntSym(ctxt, dynamic, elf.DT_HASH, hash.Sym())
+		}
+		if gnuHash != nil {
+			elfWriteDynEntSym(ctxt, dynamic, elf.DT_GNU_HASH, gnuHash.Sym())
+		}
 
 		elfWriteDynEntSym(ctxt, dynamic, elf.DT_SYMTAB, dynsym.Sym())
 		if elf64 {
@@ -1494,6 +2185,9 @@ func (ctxt *Link) doelf() {
 		if rpath.val != "" {
 			Elfwritedynent(ctxt.Arch, dynamic, elf.DT_RUNPATH, uint64(dynstr.Addstring(rpath.val)))
 		}
+		if *flagSoname != "" {
+			Elfwritedynent(ctxt.Arch, dynamic, elf.DT_SONAME, uint64(dynstr.Addstring(*flagSoname)))
+		}
 
 		if ctxt.IsPPC64() {
 			elfWriteDynEntSym(ctxt, dynamic, elf.DT_PLTGOT, plt.Sym())
@@ -1510,6 +2204,13 @@ func (ctxt *Link) doelf() {
 		// DT_PLTRELSZ, and elf.DT_JMPREL dynamic entries until after we know the
 		// size of .rel(a).plt section.
 		Elfwritedynent(ctxt.Arch, dynamic, elf.DT_DEBUG, 0)
+
+		if *flagAsan && ctxt.IsInternal() {
+			preinit := ctxt.asanPreinit()
+			shstrtab.Addstring(".preinit_array")
+			elfWriteDynEntSym(ctxt, dynamic, elf.DT_PREINIT_ARRAY, preinit)
+			elfwritedynentsymsize(ctxt, dynamic, elf.DT_PREINIT_ARRAYSZ, preinit)
+		}
 	}
 
 	if ctxt.IsShared() {
@@ -1535,12 +2236,24 @@ func (ctxt *Link) doelf() {
 			deplist = append(deplist, filepath.Base(shlib.Path))
 		}
 		addgonote(ctxt, ".note.go.deps", ELF_NOTE_GODEPS_TAG, []byte(strings.Join(deplist, "\n")))
+		addgonote(ctxt, ".note.go.pkg-hashes", ELF_NOTE_GOPKGHASHES_TAG, shlibPkgHashes(ctxt.Library))
 	}
 
 	if ctxt.LinkMode == LinkExternal && *flagBuildid != "" {
 		addgonote(ctxt, ".note.go.buildid", ELF_NOTE_GOBUILDID_TAG, []byte(*flagBuildid))
 	}
 
+	// The host linker merges the property note of go.o with those of
+	// the other objects. Without it, the output would not have the
+	// features even if all the C objects have them.
+	if ctxt.LinkMode == LinkExternal && gnuFeatures != 0 {
+		addgnuproperty(ctxt)
+	}
+
+	if ctxt.LinkMode == LinkExternal && len(packageNote) > 0 {
+		addpackagenote(ctxt)
+	}
+
 	//type mipsGnuAttributes struct {
 	//	version uint8   // 'A'
 	//	length  uint32  // 15 including itself
@@ -1632,8 +2345,13 @@ func asmbElf(ctxt *Link) {
 		ctxt.Out.Write(Elfstrdat)
 		if ctxt.IsExternal() {
 			elfEmitReloc(ctxt)
+		} else if *flagEmitReloc {
+			emitrelocs(ctxt)
 		}
 	}
+	if ctxt.IsInternal() {
+		elfdynsymsects(ctxt)
+	}
 	ctxt.Out.SeekSet(0)
 
 	ldr := ctxt.loader
@@ -1659,7 +2377,7 @@ func asmbElf(ctxt *Link) {
 		eh.Machine = uint16(elf.EM_S390)
 	}
 
-	elfreserve := int64(ELFRESERVE)
+	elfreserve := int64(ELFRESERVE) + packageNoteReserve()
 
 	numtext := int64(0)
 	for _, sect := range Segtext.Sections {
@@ -1704,6 +2422,8 @@ func asmbElf(ctxt *Link) {
 			sh.Flags = uint64(elf.SHF_ALLOC)
 			sh = elfshname(".note.go.deps")
 			sh.Type = uint32(elf.SHT_NOTE)
+			sh = elfshname(".note.go.pkg-hashes")
+			sh.Type = uint32(elf.SHT_NOTE)
 		}
 
 		if *flagBuildid != "" {
@@ -1712,6 +2432,18 @@ func asmbElf(ctxt *Link) {
 			sh.Flags = uint64(elf.SHF_ALLOC)
 		}
 
+		if gnuFeatures != 0 {
+			sh := elfshname(".note.gnu.property")
+			sh.Type = uint32(elf.SHT_NOTE)
+			sh.Flags = uint64(elf.SHF_ALLOC)
+		}
+
+		if len(packageNote) > 0 {
+			sh := elfshname(".note.package")
+			sh.Type = uint32(elf.SHT_NOTE)
+			sh.Flags = uint64(elf.SHF_ALLOC)
+		}
+
 		goto elfobj
 	}
 
@@ -1727,9 +2459,10 @@ func asmbElf(ctxt *Link) {
 
 	/*
 	 * PHDR must be in a loaded segment. Adjust the text
-	 * segment boundaries downwards to include it.
+	 * segment boundaries downwards to include it, unless
+	 * the headers are loaded separately, see below.
 	 */
-	{
+	if !*flagSeparateCode {
 		o := int64(Segtext.Vaddr - pph.Vaddr)
 		Segtext.Vaddr -= uint64(o)
 		Segtext.Length += uint64(o)
@@ -1738,7 +2471,7 @@ func asmbElf(ctxt *Link) {
 		Segtext.Filelen += uint64(o)
 	}
 
-	if !*FlagD { /* -d suppresses dynamic loader format */
+	if !*FlagD && !*flagStaticPIE { /* -d suppresses dynamic loader format */
 		/* interpreter */
 		sh := elfshname(".interp")
 
@@ -1746,38 +2479,7 @@ func asmbElf(ctxt *Link) {
 		sh.Flags = uint64(elf.SHF_ALLOC)
 		sh.Addralign = 1
 
-		if interpreter == "" && buildcfg.GOOS == runtime.GOOS && buildcfg.GOARCH == runtime.GOARCH && buildcfg.GO_LDSO != "" {
-			interpreter = buildcfg.GO_LDSO
-		}
-
-		if interpreter == "" {
-			switch ctxt.HeadType {
-			case objabi.Hlinux:
-				if buildcfg.GOOS == "android" {
-					interpreter = thearch.Androiddynld
-					if interpreter == "" {
-						Exitf("ELF interpreter not set")
-					}
-				} else {
-					interpreter = thearch.Linuxdynld
-				}
-
-			case objabi.Hfreebsd:
-				interpreter = thearch.Freebsddynld
-
-			case objabi.Hnetbsd:
-				interpreter = thearch.Netbsddynld
-
-			case objabi.Hopenbsd:
-				interpreter = thearch.Openbsddynld
-
-			case objabi.Hdragonfly:
-				interpreter = thearch.Dragonflydynld
-
-			case objabi.Hsolaris:
-				interpreter = thearch.Solarisdynld
-			}
-		}
+		interpreter = ctxt.elfInterpreter()
 
 		resoff -= int64(elfinterp(sh, uint64(startva), uint64(resoff), interpreter))
 
@@ -1829,8 +2531,45 @@ func asmbElf(ctxt *Link) {
 		phsh(pnote, sh)
 	}
 
+	if gnuFeatures != 0 {
+		sh := elfshname(".note.gnu.property")
+		resoff -= int64(elfgnuproperty(sh, uint64(startva), uint64(resoff)))
+
+		pnote := newElfPhdr()
+		pnote.Type = elf.PT_NOTE
+		pnote.Flags = elf.PF_R
+		phsh(pnote, sh)
+
+		ph := newElfPhdr()
+		ph.Type = elf.PT_GNU_PROPERTY
+		ph.Flags = elf.PF_R
+		phsh(ph, sh)
+	}
+
+	if len(packageNote) > 0 {
+		sh := elfshname(".note.package")
+		resoff -= int64(elfpackagenote(sh, uint64(startva), uint64(resoff)))
+
+		pnote := newElfPhdr()
+		pnote.Type = elf.PT_NOTE
+		pnote.Flags = elf.PF_R
+		phsh(pnote, sh)
+	}
+
 	// Additions to the reserved area must be above this line.
 
+	if *flagSeparateCode {
+		// Load the reserved area read-only, by itself: Main has
+		// padded it to a whole number of pages.
+		ph := newElfPhdr()
+		ph.Type = elf.PT_LOAD
+		ph.Flags = elf.PF_R
+		ph.Vaddr = uint64(startva)
+		ph.Paddr = uint64(startva)
+		ph.Memsz = uint64(HEADR)
+		ph.Filesz = uint64(HEADR)
+		ph.Align = uint64(*FlagRound)
+	}
 	elfphload(&Segtext)
 	if len(Segrodata.Sections) > 0 {
 		elfphload(&Segrodata)
@@ -1971,13 +2710,24 @@ func asmbElf(ctxt *Link) {
 			shsym(sh, ldr, ldr.Lookup(".got.plt", 0))
 		}
 
-		sh = elfshname(".hash")
-		sh.Type = uint32(elf.SHT_HASH)
-		sh.Flags = uint64(elf.SHF_ALLOC)
-		sh.Entsize = 4
-		sh.Addralign = uint64(ctxt.Arch.RegSize)
-		sh.Link = uint32(elfshname(".dynsym").shnum)
-		shsym(sh, ldr, ldr.Lookup(".hash", 0))
+		if elfSysvHash {
+			sh = elfshname(".hash")
+			sh.Type = uint32(elf.SHT_HASH)
+			sh.Flags = uint64(elf.SHF_ALLOC)
+			sh.Entsize = 4
+			sh.Addralign = uint64(ctxt.Arch.RegSize)
+			sh.Link = uint32(elfshname(".dynsym").shnum)
+			shsym(sh, ldr, ldr.Lookup(".hash", 0))
+		}
+
+		if elfGNUHash {
+			sh = elfshname(".gnu.hash")
+			sh.Type = uint32(elf.SHT_GNU_HASH)
+			sh.Flags = uint64(elf.SHF_ALLOC)
+			sh.Addralign = uint64(ctxt.Arch.PtrSize)
+			sh.Link = uint32(elfshname(".dynsym").shnum)
+			shsym(sh, ldr, ldr.Lookup(".gnu.hash", 0))
+		}
 
 		/* sh and elf.PT_DYNAMIC for .dynamic section */
 		sh = elfshname(".dynamic")
@@ -1997,9 +2747,14 @@ func asmbElf(ctxt *Link) {
 		 * Thread-local storage segment (really just size).
 		 */
 		tlssize := uint64(0)
+		var tdata *sym.Section
 		for _, sect := range Segdata.Sections {
-			if sect.Name == ".tbss" {
-				tlssize = sect.Length
+			switch sect.Name {
+			case ".tbss":
+				tlssize += sect.Length
+			case ".tdata":
+				tlssize += sect.Length
+				tdata = sect
 			}
 		}
 		if tlssize != 0 {
@@ -2008,9 +2763,33 @@ func asmbElf(ctxt *Link) {
 			ph.Flags = elf.PF_R
 			ph.Memsz = tlssize
 			ph.Align = uint64(ctxt.Arch.RegSize)
+			if ctxt.Tlsalign != 0 {
+				ph.Align = uint64(ctxt.Tlsalign)
+			}
+			if tdata != nil {
+				// The block starts with the initial values
+				// of the thread-local variables of host objects.
+				ph.Vaddr = tdata.Vaddr
+				ph.Paddr = tdata.Vaddr
+				ph.Off = tdata.Seg.Fileoff + tdata.Vaddr - tdata.Seg.Vaddr
+				ph.Filesz = tdata.Length
+			}
 		}
 	}
 
+	if ehframeHdr != 0 {
+		ph := newElfPhdr()
+		ph.Type = elf.PT_GNU_EH_FRAME
+		ph.Flags = elf.PF_R
+		sect := ctxt.loader.SymSect(ehframeHdr)
+		ph.Vaddr = sect.Vaddr
+		ph.Paddr = sect.Vaddr
+		ph.Off = sect.Seg.Fileoff + sect.Vaddr - sect.Seg.Vaddr
+		ph.Filesz = sect.Length
+		ph.Memsz = sect.Length
+		ph.Align = 4
+	}
+
 	if ctxt.HeadType == objabi.Hlinux {
 		ph := newElfPhdr()
 		ph.Type = elf.PT_GNU_STACK
@@ -2031,13 +2810,17 @@ func asmbElf(ctxt *Link) {
 		ph.Flags = elf.PF_W + elf.PF_R
 		ph.Align = uint64(ctxt.Arch.RegSize)
 	}
+	checkLoadWX()
 
 elfobj:
-	sh := elfshname(".shstrtab")
-	sh.Type = uint32(elf.SHT_STRTAB)
-	sh.Addralign = 1
-	shsym(sh, ldr, ldr.Lookup(".shstrtab", 0))
-	eh.Shstrndx = uint16(sh.shnum)
+	var sh *ElfShdr
+	if !ctxt.noSectionHeaders() {
+		sh = elfshname(".shstrtab")
+		sh.Type = uint32(elf.SHT_STRTAB)
+		sh.Addralign = 1
+		shsym(sh, ldr, ldr.Lookup(".shstrtab", 0))
+		eh.Shstrndx = uint16(sh.shnum)
+	}
 
 	if ctxt.IsMIPS() {
 		sh = elfshname(".MIPS.abiflags")
@@ -2058,6 +2841,29 @@ elfobj:
 		shsym(sh, ldr, ldr.Lookup(".gnu.attributes", 0))
 	}
 
+	if ctxt.IsARM() {
+		// The arm backend creates the section in gentext.
+		sh = elfshname(".ARM.attributes")
+		sh.Type = uint32(SHT_ARM_ATTRIBUTES)
+		sh.Addralign = 1
+		shsym(sh, ldr, ldr.Lookup(".ARM.attributes", 0))
+	}
+
+	if ctxt.IsRISCV64() {
+		// The riscv64 backend creates the section in gentext.
+		sh = elfshname(".riscv.attributes")
+		sh.Type = uint32(SHT_RISCV_ATTRIBUTES)
+		sh.Addralign = 1
+		shsym(sh, ldr, ldr.Lookup(".riscv.attributes", 0))
+
+		if ctxt.LinkMode != LinkExternal {
+			ph := newElfPhdr()
+			ph.Type = PT_RISCV_ATTRIBUTES
+			ph.Flags = elf.PF_R
+			phsh(ph, sh)
+		}
+	}
+
 	// put these sections early in the list
 	if !*FlagS {
 		elfshname(".symtab")
@@ -2103,6 +2909,14 @@ elfobj:
 		sh.Type = uint32(elf.SHT_PROGBITS)
 		sh.Addralign = 1
 		sh.Flags = 0
+	} else if *flagEmitReloc {
+		for _, seg := range []*sym.Segment{&Segtext, &Segrodata, &Segrelrodata, &Segdata} {
+			for _, sect := range seg.Sections {
+				if sect.Rellen != 0 {
+					elfshreloc(ctxt.Arch, sect)
+				}
+			}
+		}
 	}
 
 	if !*FlagS {
@@ -2173,8 +2987,10 @@ elfobj:
 	a := int64(0)
 	a += int64(elfwritehdr(ctxt.Out))
 	a += int64(elfwritephdrs(ctxt.Out))
-	a += int64(elfwriteshdrs(ctxt.Out))
-	if !*FlagD {
+	if !ctxt.noSectionHeaders() {
+		a += int64(elfwriteshdrs(ctxt.Out))
+	}
+	if !*FlagD && !*flagStaticPIE {
 		a += int64(elfwriteinterp(ctxt.Out))
 	}
 	if ctxt.IsMIPS() {
@@ -2194,11 +3010,28 @@ elfobj:
 		if *flagBuildid != "" {
 			a += int64(elfwritegobuildid(ctxt.Out))
 		}
+		if gnuFeatures != 0 {
+			a += int64(elfwritegnuproperty(ctxt, ctxt.Out))
+		}
+		if len(packageNote) > 0 {
+			a += int64(elfwritepackagenote(ctxt.Out))
+		}
 	}
 	if *flagRace && ctxt.IsNetbsd() {
 		a += int64(elfwritenetbsdpax(ctxt.Out))
 	}
 
+	if ctxt.noSectionHeaders() {
+		// Only the program headers describe the file. The section
+		// headers are cleared last, as the writers above look up
+		// their sections by name.
+		eh.Shoff = 0
+		eh.Shnum = 0
+		eh.Shstrndx = 0
+		ctxt.Out.SeekSet(0)
+		elfwritehdr(ctxt.Out)
+	}
+
 	if a > elfreserve {
 		Errorf(nil, "ELFRESERVE too small: %d > %d with %d text sections", a, elfreserve, numtext)
 	}
@@ -2210,6 +3043,39 @@ elfobj:
 	}
 }
 
+// elfdynsymsects writes the section indexes of the defined dynamic
+// symbols to the output. elfadddynsym runs before the symbols are
+// laid out, and gives them all section 1.
+func elfdynsymsects(ctxt *Link) {
+	ldr := ctxt.loader
+	dynsym := ctxt.DynSym
+	if dynsym == 0 || ldr.SymSect(dynsym) == nil {
+		return
+	}
+	sect := ldr.SymSect(dynsym)
+	off := int64(sect.Seg.Fileoff + uint64(ldr.SymValue(dynsym)) - sect.Seg.Vaddr)
+	// st_shndx is at offset 14 of an Elf32_Sym, 6 of an Elf64_Sym.
+	off, symsize := off+14, int64(ELF32SYMSIZE)
+	if elf64 {
+		off, symsize = off-8, ELF64SYMSIZE
+	}
+	for _, s := range ldr.DynidSyms() {
+		if ldr.SymType(s) == sym.SDYNIMPORT {
+			continue
+		}
+		xo := s
+		if outer := ldr.OuterSym(s); outer != 0 {
+			xo = outer
+		}
+		sect := ldr.SymSect(xo)
+		if sect == nil || sect.Elfsect == nil {
+			continue
+		}
+		ctxt.Out.SeekSet(off + int64(ldr.SymDynid(s))*symsize)
+		ctxt.Out.Write16(uint16(sect.Elfsect.(*ElfShdr).shnum))
+	}
+}
+
 func elfadddynsym(ldr *loader.Loader, target *Target, syms *ArchSyms, s loader.Sym) {
 	ldr.SetSymDynid(s, int32(Nelfsym))
 	Nelfsym++
@@ -2217,22 +3083,35 @@ func elfadddynsym(ldr *loader.Loader, target *Target, syms *ArchSyms, s loader.S
 	name := ldr.SymExtname(s)
 	dstru := ldr.MakeSymbolUpdater(syms.DynStr)
 	st := ldr.SymType(s)
-	cgoeStatic := ldr.AttrCgoExportStatic(s)
 	cgoeDynamic := ldr.AttrCgoExportDynamic(s)
-	cgoexp := (cgoeStatic || cgoeDynamic)
+
+	// A weak undefined reference from a host object is resolved by the
+	// dynamic linker to 0 if no library defines the symbol.
+	bind := elf.STB_GLOBAL
+	if st == sym.SDYNIMPORT && ldr.AttrWeakUndef(s) {
+		bind = elf.STB_WEAK
+	}
+
+	// The size of a defined symbol is that of its code or variable,
+	// which need not be loaded yet, or be loaded at all for .bss.
+	typ := elf.STT_OBJECT
+	var size int64
+	if st != sym.SDYNIMPORT {
+		size = ldr.SymSize(s)
+		switch st {
+		case sym.STEXT:
+			typ = elf.STT_FUNC
+		case sym.STLSBSS, sym.STLSDATA:
+			typ = elf.STT_TLS
+		}
+	}
+	t := elf.ST_INFO(bind, typ)
 
 	d.AddUint32(target.Arch, uint32(dstru.Addstring(name)))
 
 	if elf64 {
 
 		/* type */
-		var t uint8
-
-		if cgoexp && st == sym.STEXT {
-			t = elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC)
-		} else {
-			t = elf.ST_INFO(elf.STB_GLOBAL, elf.STT_OBJECT)
-		}
 		d.AddUint8(t)
 
 		/* reserved */
@@ -2253,7 +3132,7 @@ func elfadddynsym(ldr *loader.Loader, target *Target, syms *ArchSyms, s loader.S
 		}
 
 		/* size of object */
-		d.AddUint64(target.Arch, uint64(len(ldr.Data(s))))
+		d.AddUint64(target.Arch, uint64(size))
 
 		dil := ldr.SymDynimplib(s)
 
@@ -2272,19 +3151,9 @@ func elfadddynsym(ldr *loader.Loader, target *Target, syms *ArchSyms, s loader.S
 		}
 
 		/* size of object */
-		d.AddUint32(target.Arch, uint32(len(ldr.Data(s))))
+		d.AddUint32(target.Arch, uint32(size))
 
 		/* type */
-		var t uint8
-
-		// TODO(mwhudson): presumably the behavior should actually be the same on both arm and 386.
-		if target.Arch.Family == sys.I386 && cgoexp && st == sym.STEXT {
-			t = elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC)
-		} else if target.Arch.Family == sys.ARM && cgoeDynamic && st == sym.STEXT {
-			t = elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC)
-		} else {
-			t = elf.ST_INFO(elf.STB_GLOBAL, elf.STT_OBJECT)
-		}
 		d.AddUint8(t)
 		d.AddUint8(0)
 
@@ -0,0 +1,354 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// When linking externally, the symbol table of the output is the one
+// written by the host linker, which may drop or alter the symbols of
+// the Go object: some host linkers discard local symbols, or do not
+// keep symbol sizes. Programs that symbolize the binary, such as
+// profilers, would then behave differently depending on the link
+// mode. elfRewriteSymtab replaces the Go symbols in the output's
+// .symtab with those the linker wrote to go.o, relocated to the
+// addresses the host linker assigned.
+
+// elfRewriteSymtab rewrites the .symtab section of the ELF executable
+// or shared object outfile, produced by the host linker from goobj
+// and the host objects. If dropGenerated is set, the generated local
+// symbols of -strip=locals are left out.
+func elfRewriteSymtab(goobj, outfile string, dropGenerated bool) error {
+	gof, err := elf.Open(goobj)
+	if err != nil {
+		return err
+	}
+	defer gof.Close()
+	gosyms, err := gof.Symbols()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(outfile, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return err
+	}
+	symtab := ef.SectionByType(elf.SHT_SYMTAB)
+	if symtab == nil {
+		// Stripped by the host linker, for example by -extldflags=-s.
+		return nil
+	}
+	if int(symtab.Link) >= len(ef.Sections) {
+		return fmt.Errorf("%s: bad .symtab link %d", outfile, symtab.Link)
+	}
+	strtab := ef.Sections[symtab.Link]
+	syms, err := ef.Symbols()
+	if err != nil {
+		return err
+	}
+
+	// Symbols defined in go.o, except section symbols, which the host
+	// linker keeps or creates itself, and file symbols, which are
+	// placed with the Go symbols following them.
+	isGoSym := func(s *elf.Symbol) bool {
+		switch elf.ST_TYPE(s.Info) {
+		case elf.STT_SECTION, elf.STT_FILE:
+			return false
+		}
+		return s.Section != elf.SHN_UNDEF && s.Section < elf.SHN_LORESERVE
+	}
+
+	// Count the names, to find symbols that can serve as anchors
+	// to locate the go.o sections in the output.
+	gocount := make(map[string]int)
+	for i := range gosyms {
+		if isGoSym(&gosyms[i]) {
+			gocount[gosyms[i].Name]++
+		}
+	}
+	outcount := make(map[string]int)
+	outsym := make(map[string]*elf.Symbol)
+	for i := range syms {
+		outcount[syms[i].Name]++
+		outsym[syms[i].Name] = &syms[i]
+	}
+
+	// For each section of go.o, find where the host linker placed it:
+	// the output section holding it and the address of its start.
+	type placement struct {
+		shndx elf.SectionIndex
+		delta uint64
+	}
+	place := make(map[elf.SectionIndex]placement)
+	for i := range gosyms {
+		s := &gosyms[i]
+		if !isGoSym(s) || gocount[s.Name] != 1 || outcount[s.Name] != 1 {
+			continue
+		}
+		if _, ok := place[s.Section]; ok {
+			continue
+		}
+		o := outsym[s.Name]
+		if o.Section == elf.SHN_UNDEF || o.Section >= elf.SHN_LORESERVE || elf.ST_TYPE(o.Info) != elf.ST_TYPE(s.Info) {
+			continue
+		}
+		place[s.Section] = placement{o.Section, o.Value - s.Value}
+	}
+
+	// Relocate the Go symbols to their final addresses. They replace
+	// the output's symbols with the same name and address.
+	type symkey struct {
+		name  string
+		value uint64
+	}
+	var placed []elf.Symbol
+	replaced := make(map[symkey]bool)
+	gofiles := make(map[string]bool)
+	for _, s := range gosyms {
+		if elf.ST_TYPE(s.Info) == elf.STT_FILE {
+			// The file symbols of go.o group its local symbols
+			// by package, and move with them.
+			placed = append(placed, s)
+			gofiles[s.Name] = true
+			continue
+		}
+		if !isGoSym(&s) {
+			continue
+		}
+		p, ok := place[s.Section]
+		if !ok {
+			// None of the section's symbols survived the host
+			// link; there is nothing to place it by.
+			continue
+		}
+		s.Section = p.shndx
+		s.Value += p.delta
+		placed = append(placed, s)
+		replaced[symkey{s.Name, s.Value}] = true
+	}
+
+	// The new symbol table holds the symbols of the output that do
+	// not come from go.o, followed by the Go symbols.
+	var locals, globals []elf.Symbol
+	add := func(s elf.Symbol) {
+		if dropGenerated && isGeneratedLocal(s.Name) {
+			return
+		}
+		if elf.ST_BIND(s.Info) == elf.STB_LOCAL {
+			locals = append(locals, s)
+		} else {
+			globals = append(globals, s)
+		}
+	}
+	for _, s := range syms {
+		if isGoSym(&s) && replaced[symkey{s.Name, s.Value}] {
+			continue
+		}
+		if elf.ST_TYPE(s.Info) == elf.STT_FILE && gofiles[s.Name] {
+			continue
+		}
+		add(s)
+	}
+	var file *elf.Symbol // file symbol for the next local symbol
+	for i, s := range placed {
+		if elf.ST_TYPE(s.Info) == elf.STT_FILE {
+			file = &placed[i]
+			continue
+		}
+		if file != nil && elf.ST_BIND(s.Info) == elf.STB_LOCAL && !(dropGenerated && isGeneratedLocal(s.Name)) {
+			add(*file)
+			file = nil
+		}
+		add(s)
+	}
+
+	// Build the new .strtab, sharing the tails of names as host
+	// linkers do.
+	var names []string
+	for _, s := range locals {
+		names = append(names, s.Name)
+	}
+	for _, s := range globals {
+		names = append(names, s.Name)
+	}
+	stroff := elfStrtab(names)
+	strs := make([]byte, 1, stroff.size)
+	for _, name := range stroff.order {
+		strs = append(strs, name...)
+		strs = append(strs, 0)
+	}
+	str := func(name string) uint32 { return stroff.off[name] }
+
+	// Build the new .symtab.
+	bo := ef.ByteOrder
+	var symdata []byte
+	putsym := func(s elf.Symbol) {
+		if ef.Class == elf.ELFCLASS64 {
+			var b [elf.Sym64Size]byte
+			bo.PutUint32(b[0:], str(s.Name))
+			b[4] = s.Info
+			b[5] = s.Other
+			bo.PutUint16(b[6:], uint16(s.Section))
+			bo.PutUint64(b[8:], s.Value)
+			bo.PutUint64(b[16:], s.Size)
+			symdata = append(symdata, b[:]...)
+		} else {
+			var b [elf.Sym32Size]byte
+			bo.PutUint32(b[0:], str(s.Name))
+			bo.PutUint32(b[4:], uint32(s.Value))
+			bo.PutUint32(b[8:], uint32(s.Size))
+			b[12] = s.Info
+			b[13] = s.Other
+			bo.PutUint16(b[14:], uint16(s.Section))
+			symdata = append(symdata, b[:]...)
+		}
+	}
+	putsym(elf.Symbol{})
+	for _, s := range locals {
+		putsym(s)
+	}
+	for _, s := range globals {
+		putsym(s)
+	}
+	nlocal := 1 + len(locals)
+
+	// Write the new tables in place of the old ones if they fit,
+	// otherwise append them to the file. Either way, point the
+	// section headers at them.
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	write := func(data []byte, old *elf.Section) (int64, error) {
+		off := int64(old.Offset)
+		if uint64(len(data)) > old.Size {
+			off = Rnd(end, 8)
+			end = off + int64(len(data))
+		}
+		_, err := f.WriteAt(data, off)
+		return off, err
+	}
+	symoff, err := write(symdata, symtab)
+	if err != nil {
+		return err
+	}
+	stroffset, err := write(strs, strtab)
+	if err != nil {
+		return err
+	}
+	if err := elfUpdateShdr(f, ef, symtab, uint64(symoff), uint64(len(symdata)), uint32(nlocal)); err != nil {
+		return err
+	}
+	return elfUpdateShdr(f, ef, strtab, uint64(stroffset), uint64(len(strs)), strtab.Info)
+}
+
+// elfUpdateShdr sets the file offset, size and info fields of the
+// header of section sect in the ELF file f.
+func elfUpdateShdr(f *os.File, ef *elf.File, sect *elf.Section, off, size uint64, info uint32) error {
+	index := -1
+	for i := range ef.Sections {
+		if ef.Sections[i] == sect {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("section %s not found", sect.Name)
+	}
+	bo := ef.ByteOrder
+	if ef.Class == elf.ELFCLASS64 {
+		var h elf.Header64
+		if err := binary.Read(io.NewSectionReader(f, 0, int64(binary.Size(h))), bo, &h); err != nil {
+			return err
+		}
+		var sh elf.Section64
+		pos := int64(h.Shoff) + int64(index)*int64(h.Shentsize)
+		if err := binary.Read(io.NewSectionReader(f, pos, int64(binary.Size(sh))), bo, &sh); err != nil {
+			return err
+		}
+		sh.Off, sh.Size, sh.Info = off, size, info
+		return elfWriteAt(f, pos, bo, &sh)
+	}
+	var h elf.Header32
+	if err := binary.Read(io.NewSectionReader(f, 0, int64(binary.Size(h))), bo, &h); err != nil {
+		return err
+	}
+	var sh elf.Section32
+	pos := int64(h.Shoff) + int64(index)*int64(h.Shentsize)
+	if err := binary.Read(io.NewSectionReader(f, pos, int64(binary.Size(sh))), bo, &sh); err != nil {
+		return err
+	}
+	sh.Off, sh.Size, sh.Info = uint32(off), uint32(size), info
+	return elfWriteAt(f, pos, bo, &sh)
+}
+
+// elfWriteAt writes the binary representation of data to f at offset off.
+func elfWriteAt(f *os.File, off int64, bo binary.ByteOrder, data interface{}) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, bo, data); err != nil {
+		return err
+	}
+	_, err := f.WriteAt(buf.Bytes(), off)
+	return err
+}
+
+// An elfStrings is a string table laid out by elfStrtab.
+type elfStrings struct {
+	order []string          // strings stored in the table, in order
+	off   map[string]uint32 // offset of each string in the table
+	size  int               // size of the table
+}
+
+// elfStrtab lays out an ELF string table holding names. A name that
+// is a suffix of another shares its bytes. The table starts with the
+// empty string at offset 0.
+func elfStrtab(names []string) elfStrings {
+	rev := func(s string) string {
+		b := []byte(s)
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return string(b)
+	}
+	// Sorting the reversed names puts each name right after the
+	// names it is a suffix of.
+	revs := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			revs = append(revs, rev(name))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(revs)))
+
+	t := elfStrings{off: map[string]uint32{"": 0}, size: 1}
+	prev := ""
+	var prevOff int
+	for _, r := range revs {
+		name := rev(r)
+		if strings.HasSuffix(prev, name) {
+			t.off[name] = uint32(prevOff + len(prev) - len(name))
+			continue
+		}
+		t.order = append(t.order, name)
+		t.off[name] = uint32(t.size)
+		prev, prevOff = name, t.size
+		t.size += len(name) + 1
+	}
+	return t
+}
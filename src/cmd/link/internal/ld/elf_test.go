@@ -8,7 +8,9 @@
 package ld
 
 import (
+	"bytes"
 	"debug/elf"
+	"fmt"
 	"internal/testenv"
 	"io/ioutil"
 	"os"
@@ -127,3 +129,437 @@ func TestNoDuplicateNeededEntries(t *testing.T) {
 		t.Errorf("Got %d entries for `libc.so`, want %d", got, want)
 	}
 }
+
+const wxMain = `package main
+
+// int wxfunc(void);
+import "C"
+
+func main() {
+	println(C.wxfunc())
+}
+`
+
+// wxFunc and wxMixed are assembled into a host object with a writable
+// and executable section. The first only defines a function, so the
+// linker can load it as text; the second also defines data that the
+// function writes to.
+const wxFunc = `
+	.section .wxtext,"awx",@progbits
+	.globl wxfunc
+	.type wxfunc, @function
+wxfunc:
+	movl $42, %eax
+	ret
+	.section .note.GNU-stack,"",@progbits
+`
+
+const wxMixed = `
+	.section .wxtext,"awx",@progbits
+	.globl wxfunc
+	.type wxfunc, @function
+wxfunc:
+	addl $42, wxcount(%rip)
+	movl wxcount(%rip), %eax
+	ret
+	.type wxcount, @object
+	.size wxcount, 4
+wxcount:
+	.long 0
+	.section .note.GNU-stack,"",@progbits
+`
+
+func TestWX(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	// build writes a program using the host object assembled from
+	// asm to a new directory and links it internally with the given
+	// extra linker flags.
+	build := func(t *testing.T, asm, ldflags string) (string, []byte, error) {
+		dir := t.TempDir()
+		files := map[string]string{
+			"go.mod":  "module wx\n",
+			"main.go": wxMain,
+			"wx.S":    asm,
+		}
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		exe := filepath.Join(dir, "wx.exe")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=internal "+ldflags)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		return exe, out, err
+	}
+
+	// hasWX reports whether exe has a loadable segment that is
+	// writable and executable.
+	hasWX := func(t *testing.T, exe string) bool {
+		f, err := elf.Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_LOAD && p.Flags&(elf.PF_W|elf.PF_X) == elf.PF_W|elf.PF_X {
+				return true
+			}
+		}
+		return false
+	}
+
+	run := func(t *testing.T, exe string) {
+		out, err := exec.Command(exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", exe, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != "42" {
+			t.Errorf("%s printed %q, want %q", exe, got, "42")
+		}
+	}
+
+	t.Run("func", func(t *testing.T) {
+		exe, out, err := build(t, wxFunc, "")
+		if err != nil {
+			t.Fatalf("build failed: %v\n%s", err, out)
+		}
+		if hasWX(t, exe) {
+			t.Errorf("program has a writable and executable segment")
+		}
+		run(t, exe)
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		_, out, err := build(t, wxMixed, "")
+		if err == nil {
+			t.Fatalf("build succeeded unexpectedly")
+		}
+		if !strings.Contains(string(out), "host object section") || !strings.Contains(string(out), "(.wxtext) is writable and executable") {
+			t.Errorf("unexpected build error:\n%s", out)
+		}
+
+		exe, out, err := build(t, wxMixed, "-allow-wx")
+		if err != nil {
+			t.Fatalf("build with -allow-wx failed: %v\n%s", err, out)
+		}
+		if !hasWX(t, exe) {
+			t.Errorf("program built with -allow-wx has no writable and executable segment")
+		}
+		run(t, exe)
+	})
+}
+
+func TestLoadWX(t *testing.T) {
+	load := func(flags elf.ProgFlag, vaddr, memsz uint64) *ElfPhdr {
+		return &ElfPhdr{Type: elf.PT_LOAD, Flags: flags, Vaddr: vaddr, Memsz: memsz}
+	}
+	const page = 0x1000
+	tests := []struct {
+		name  string
+		phdrs []*ElfPhdr
+		want  int
+	}{
+		{
+			name: "separate",
+			phdrs: []*ElfPhdr{
+				load(elf.PF_R|elf.PF_X, 0x401000, 0x1800),
+				load(elf.PF_R, 0x403000, 0x800),
+				load(elf.PF_R|elf.PF_W, 0x404000, 0x100),
+			},
+		},
+		{
+			name: "wx segment",
+			phdrs: []*ElfPhdr{
+				load(elf.PF_R|elf.PF_W|elf.PF_X, 0x401000, 0x1800),
+				load(elf.PF_R|elf.PF_W, 0x403000, 0x100),
+			},
+			want: 1,
+		},
+		{
+			name: "shared page",
+			phdrs: []*ElfPhdr{
+				load(elf.PF_R|elf.PF_X, 0x401000, 0x1800),
+				load(elf.PF_R|elf.PF_W, 0x402800, 0x100),
+			},
+			want: 1,
+		},
+		{
+			name: "shared read-only page",
+			phdrs: []*ElfPhdr{
+				load(elf.PF_R|elf.PF_X, 0x401000, 0x1800),
+				load(elf.PF_R, 0x402800, 0x100),
+				load(elf.PF_R|elf.PF_W, 0x403000, 0x100),
+			},
+		},
+		{
+			name: "empty segment",
+			phdrs: []*ElfPhdr{
+				load(elf.PF_R|elf.PF_X, 0x401000, 0x1800),
+				load(elf.PF_R|elf.PF_W, 0x402800, 0),
+				{Type: elf.PT_GNU_STACK, Flags: elf.PF_R | elf.PF_W},
+			},
+		},
+	}
+	for _, tc := range tests {
+		if got := loadWX(tc.phdrs, page); len(got) != tc.want {
+			t.Errorf("%s: loadWX returned %q, want %d problems", tc.name, got, tc.want)
+		}
+	}
+}
+
+const textrelMain = `package main
+
+// int textrel(void);
+import "C"
+
+func main() {
+	println(C.textrel())
+}
+`
+
+// textrelAbs32 and textrelAbs64 are assembled into host objects that
+// are not position independent. The first holds a 32-bit absolute
+// address in its code; the second a 64-bit one, and another one in
+// read-only data.
+const textrelAbs32 = `
+	.text
+	.globl textrel
+	.type textrel, @function
+textrel:
+	movq textrelptr, %rax
+	movl (%rax), %eax
+	ret
+	.data
+textrelptr:
+	.quad textrelval
+textrelval:
+	.long 42
+	.section .note.GNU-stack,"",@progbits
+`
+
+const textrelAbs64 = `
+	.text
+	.globl textrel
+	.type textrel, @function
+textrel:
+	movabsq $textrelptr, %rax
+	movq (%rax), %rax
+	movl (%rax), %eax
+	ret
+	.section .rodata
+textrelptr:
+	.quad textrelval
+	.data
+textrelval:
+	.long 42
+	.section .note.GNU-stack,"",@progbits
+`
+
+func TestTextRel(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	// build writes a program using the host object assembled from
+	// asm to a new directory and links it internally with the given
+	// extra go command arguments and linker flags.
+	build := func(t *testing.T, asm string, args []string, ldflags string) (string, []byte, error) {
+		dir := t.TempDir()
+		files := map[string]string{
+			"go.mod":    "module textrel\n",
+			"main.go":   textrelMain,
+			"textrel.S": asm,
+		}
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		exe := filepath.Join(dir, "textrel.exe")
+		args = append([]string{"build", "-o", exe, "-ldflags=-linkmode=internal " + ldflags}, args...)
+		cmd := exec.Command(testenv.GoToolPath(t), args...)
+		cmd.Dir = dir
+		// The go command links the host object with the C compiler
+		// to find its imports, which rejects textrelAbs32 if the C
+		// compiler builds PIEs by default.
+		cmd.Env = append(os.Environ(), "CGO_LDFLAGS=-no-pie")
+		out, err := cmd.CombinedOutput()
+		return exe, out, err
+	}
+
+	run := func(t *testing.T, exe string) {
+		out, err := exec.Command(exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", exe, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != "42" {
+			t.Errorf("%s printed %q, want %q", exe, got, "42")
+		}
+	}
+
+	hasTextrel := func(t *testing.T, exe string) bool {
+		f, err := elf.Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		ds := f.SectionByType(elf.SHT_DYNAMIC)
+		if ds == nil {
+			t.Fatalf("%s has no dynamic section", exe)
+		}
+		d, err := ds.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for len(d) >= 16 {
+			if elf.DynTag(f.ByteOrder.Uint64(d)) == elf.DT_TEXTREL {
+				return true
+			}
+			d = d[16:]
+		}
+		return false
+	}
+
+	t.Run("exe", func(t *testing.T) {
+		exe, out, err := build(t, textrelAbs32, nil, "")
+		if err != nil {
+			t.Fatalf("build failed: %v\n%s", err, out)
+		}
+		run(t, exe)
+	})
+
+	t.Run("pie", func(t *testing.T) {
+		_, out, err := build(t, textrelAbs64, []string{"-buildmode=pie"}, "")
+		if err == nil {
+			t.Fatalf("build succeeded unexpectedly")
+		}
+		if !strings.Contains(string(out), "relocation R_X86_64_64 at textrel+0x2 against") || !strings.Contains(string(out), "recompile with -fPIC or link with -allow-textrel") {
+			t.Errorf("unexpected build error:\n%s", out)
+		}
+
+		exe, out, err := build(t, textrelAbs64, []string{"-buildmode=pie"}, "-allow-textrel")
+		if err != nil {
+			t.Fatalf("build with -allow-textrel failed: %v\n%s", err, out)
+		}
+		if !hasTextrel(t, exe) {
+			t.Errorf("program built with -allow-textrel has no DT_TEXTREL")
+		}
+		run(t, exe)
+	})
+}
+
+func TestSectLayout(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only works on linux/amd64")
+	}
+
+	t.Parallel()
+
+	const addr = 0x700000
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module layout\n",
+		"main.go": sectLayoutMain,
+		"layout.ld": fmt.Sprintf(`/* Configuration block for post-processing. */
+SECTIONS
+{
+	.config %#x : ALIGN(0x1000)
+	{
+		*(.config)
+		KEEP(*(.config.*))
+	}
+}
+INSERT AFTER .noptrdata;
+`, addr),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exe := filepath.Join(dir, "layout.exe")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=internal -sectlayout="+filepath.Join(dir, "layout.ld"))
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sect := f.Section(".config")
+	if sect == nil {
+		t.Fatalf("no .config section")
+	}
+	if sect.Addr != addr {
+		t.Errorf(".config at %#x, want %#x", sect.Addr, addr)
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unreferenced .config.extra section is kept too.
+	if !bytes.HasPrefix(data, []byte("config block\x00")) || !bytes.Contains(data, []byte("extra block\x00")) {
+		t.Errorf("unexpected .config contents %q", data)
+	}
+	if prev := f.Sections[sectionIndex(f, sect)-1]; prev.Name != ".noptrdata" {
+		t.Errorf(".config follows %s, want .noptrdata", prev.Name)
+	}
+
+	out, err := exec.Command(exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", exe, err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "config block" {
+		t.Errorf("%s printed %q, want %q", exe, got, "config block")
+	}
+}
+
+func sectionIndex(f *elf.File, sect *elf.Section) int {
+	for i, s := range f.Sections {
+		if s == sect {
+			return i
+		}
+	}
+	return -1
+}
+
+const sectLayoutMain = `
+package main
+
+/*
+__attribute__((section(".config"), aligned(16)))
+char config[64] = "config block";
+
+__attribute__((section(".config.extra"), used))
+static const char extra[16] = "extra block";
+
+static const char *getconfig(void) { return config; }
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.GoString(C.getconfig()))
+}
+`
@@ -0,0 +1,166 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"runtime"
+	"sync"
+)
+
+// Support for -emitreloc when linking internally, which keeps the
+// relocations the linker applied in the output, like the --emit-relocs
+// option of the GNU linkers, so that post-link optimizers such as BOLT
+// can move code around. The relocations of each allocated section go
+// to a non-allocated relocation section referring to .symtab, as they
+// would in an object file, except that r_offset is the virtual address
+// of the relocated field.
+//
+// A relocation target with no symbol of its own in .symtab, such as
+// the GOT, is referred to by its offset in its section, using a
+// section symbol. Relocations that compute offsets rather than
+// addresses, such as those in the type data and those of thread-local
+// variables, do not change when code moves and are left out.
+
+// emitrelocsectionsyms writes a section symbol to the symbol table for
+// each allocated section, for -emitreloc. As in a linked executable,
+// its value is the address of the section.
+func emitrelocsectionsyms(ctxt *Link) {
+	ldr := ctxt.loader
+	for _, seg := range []*sym.Segment{&Segtext, &Segrodata, &Segrelrodata, &Segdata} {
+		for _, sect := range seg.Sections {
+			s := ldr.CreateStaticSym(sect.Name)
+			sect.Sym = sym.LoaderSym(s)
+			putelfsyment(ctxt.Out, 0, int64(sect.Vaddr), 0, elf.ST_INFO(elf.STB_LOCAL, elf.STT_SECTION), sect.Elfsect.(*ElfShdr).shnum, 0)
+			ldr.SetSymElfSym(s, int32(ctxt.numelfsym))
+			ctxt.numelfsym++
+		}
+	}
+}
+
+// emitreloc returns the ELF relocation describing relocation r of
+// symbol s, as the internal linker applied it.
+func emitreloc(ctxt *Link, ldr *loader.Loader, s loader.Sym, r loader.Reloc) (loader.ExtReloc, bool) {
+	var rr loader.ExtReloc
+	rs := r.Sym()
+	siz := r.Siz()
+	if siz == 0 || rs == 0 {
+		return rr, false
+	}
+	rr.Type = r.Type()
+	rr.Size = siz
+	switch rr.Type {
+	case objabi.R_ADDROFF, objabi.R_WEAKADDROFF, objabi.R_METHODOFF, objabi.R_GOTOFF, objabi.R_SIZE, objabi.R_CONST,
+		objabi.R_TLS_LE, objabi.R_TLS_IE, objabi.R_ARM64_TLS_LE, objabi.R_ARM64_TLS_IE:
+		return rr, false
+	}
+
+	if r.Weak() && !ldr.AttrReachable(rs) {
+		rs = ctxt.ArchSyms.unreachableMethod
+	}
+	rs, off := FoldSubSymbolOffset(ldr, rs)
+	rr.Xsym = rs
+	rr.Xadd = r.Add() + off
+	switch rr.Type {
+	case objabi.R_CALL, objabi.R_PCREL, objabi.R_GOTPCREL:
+		rr.Xadd -= int64(siz) // relative to address after the relocated chunk
+	}
+
+	if ElfSymForReloc(ctxt, rs) == 0 {
+		sect := ldr.SymSect(rs)
+		if sect == nil || sect.Sym == 0 {
+			ldr.Errorf(s, "-emitreloc: relocation target %s is not in the symbol table", ldr.SymName(rs))
+			return rr, false
+		}
+		rr.Xsym = loader.Sym(sect.Sym)
+		rr.Xadd += ldr.SymValue(rs) - int64(sect.Vaddr)
+	}
+	return rr, true
+}
+
+// emitrelocsyms writes the relocations of syms, in section sect, to out.
+func emitrelocsyms(ctxt *Link, out *OutBuf, sect *sym.Section, syms []loader.Sym) {
+	ldr := ctxt.loader
+	for _, s := range elfsectsyms(ldr, sect, syms) {
+		relocs := ldr.Relocs(s)
+		for ri := 0; ri < relocs.Count(); ri++ {
+			r := relocs.At(ri)
+			rr, ok := emitreloc(ctxt, ldr, s, r)
+			if !ok {
+				continue
+			}
+			if !thearch.Elfreloc1(ctxt, out, ldr, s, rr, ri, ldr.SymValue(s)+int64(r.Off())) {
+				ldr.Errorf(s, "-emitreloc: unsupported relocation %d (%s)/%d to %s", r.Type(), sym.RelocName(ctxt.Arch, r.Type()), r.Siz(), ldr.SymName(r.Sym()))
+			}
+		}
+	}
+}
+
+// emitrelocs writes the relocation sections for -emitreloc to the
+// output, and sets the Reloff and Rellen of the sections they are for.
+func emitrelocs(ctxt *Link) {
+	for ctxt.Out.Offset()&7 != 0 {
+		ctxt.Out.Write8(0)
+	}
+
+	// Sections that the dynamic linker's relocation sections are
+	// named after, like .plt, have no relocation section of their
+	// own, nor do those whose relocation section name is not in
+	// .shstrtab, like the GOT.
+	names := make(map[string]bool)
+	var sects []*sym.Section
+	for _, seg := range []*sym.Segment{&Segtext, &Segrodata, &Segrelrodata, &Segdata} {
+		for _, sect := range seg.Sections {
+			names[sect.Name] = true
+			sects = append(sects, sect)
+		}
+	}
+	hasname := func(name string) bool {
+		for i := 0; i < nelfstr; i++ {
+			if elfstr[i].s == name {
+				return true
+			}
+		}
+		return false
+	}
+	var relsects []*sym.Section
+	for _, sect := range sects {
+		name := elfRelType + sect.Name
+		if sect.Vaddr >= sect.Seg.Vaddr+sect.Seg.Filelen || names[name] || !hasname(name) {
+			continue
+		}
+		relsects = append(relsects, sect)
+	}
+
+	// Convert the relocations of each section in parallel, and write
+	// them in order.
+	bufs := make([]*OutBuf, len(relsects))
+	var wg sync.WaitGroup
+	sem := make(chan int, runtime.GOMAXPROCS(0))
+	for i, sect := range relsects {
+		syms := ctxt.datap
+		if sect.Name == ".text" {
+			syms = ctxt.Textp
+		}
+		wg.Add(1)
+		sem <- 1
+		go func(i int, sect *sym.Section, syms []loader.Sym) {
+			buf := NewOutBuf(ctxt.Arch)
+			emitrelocsyms(ctxt, buf, sect, syms)
+			bufs[i] = buf
+			wg.Done()
+			<-sem
+		}(i, sect, syms)
+	}
+	wg.Wait()
+	for i, sect := range relsects {
+		sect.Reloff = uint64(ctxt.Out.Offset())
+		sect.Rellen = uint64(len(bufs[i].heap))
+		ctxt.Out.Write(bufs[i].heap)
+	}
+}
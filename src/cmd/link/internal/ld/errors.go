@@ -8,6 +8,9 @@ import (
 	"cmd/internal/obj"
 	"cmd/link/internal/loader"
 	"cmd/link/internal/sym"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -24,10 +27,12 @@ type ErrorReporter struct {
 	unresOnce  sync.Once
 	unresSyms  map[unresolvedSymKey]bool
 	unresMutex sync.Mutex
+	unresolved []unresolvedSymKey // to report, see reportUnresolved
 	SymName    symNameFn
 }
 
-// errorUnresolved prints unresolved symbol error for rs that is referenced from s.
+// errorUnresolved records the unresolved symbol rs referenced from s,
+// for reportUnresolved to report. With -h, it reports it at once.
 func (reporter *ErrorReporter) errorUnresolved(ldr *loader.Loader, s, rs loader.Sym) {
 	reporter.unresOnce.Do(func() { reporter.unresSyms = make(map[unresolvedSymKey]bool) })
 
@@ -38,29 +43,135 @@ func (reporter *ErrorReporter) errorUnresolved(ldr *loader.Loader, s, rs loader.
 		reporter.unresSyms[k] = true
 		name := ldr.SymName(rs)
 
-		// Try to find symbol under another ABI.
-		var reqABI, haveABI obj.ABI
-		haveABI = ^obj.ABI(0)
-		reqABI, ok := sym.VersionToABI(ldr.SymVersion(rs))
-		if ok {
-			for abi := obj.ABI(0); abi < obj.ABICount; abi++ {
-				v := sym.ABIToVersion(abi)
-				if v == -1 {
-					continue
-				}
-				if rs1 := ldr.Lookup(name, v); rs1 != 0 && ldr.SymType(rs1) != sym.Sxxx && ldr.SymType(rs1) != sym.SXREF {
-					haveABI = abi
-				}
-			}
-		}
-
 		// Give a special error message for main symbol (see #24809).
 		if name == "main.main" {
 			reporter.Errorf(s, "function main is undeclared in the main package")
-		} else if haveABI != ^obj.ABI(0) {
-			reporter.Errorf(s, "relocation target %s not defined for %s (but is defined for %s)", name, reqABI, haveABI)
+		} else if *flagH {
+			if reqABI, haveABI, ok := otherABI(ldr, rs); ok {
+				reporter.Errorf(s, "relocation target %s not defined for %s (but is defined for %s)", name, reqABI, haveABI)
+			} else {
+				reporter.Errorf(s, "relocation target %s not defined", name)
+			}
 		} else {
-			reporter.Errorf(s, "relocation target %s not defined", name)
+			reporter.unresolved = append(reporter.unresolved, k)
+		}
+	}
+}
+
+// otherABI reports whether the unresolved symbol rs, which has ABI
+// reqABI, is defined for another ABI, haveABI.
+func otherABI(ldr *loader.Loader, rs loader.Sym) (reqABI, haveABI obj.ABI, ok bool) {
+	reqABI, ok = sym.VersionToABI(ldr.SymVersion(rs))
+	if !ok {
+		return 0, 0, false
+	}
+	haveABI = ^obj.ABI(0)
+	for abi := obj.ABI(0); abi < obj.ABICount; abi++ {
+		v := sym.ABIToVersion(abi)
+		if v == -1 {
+			continue
+		}
+		if rs1 := ldr.Lookup(ldr.SymName(rs), v); rs1 != 0 && ldr.SymType(rs1) != sym.Sxxx && ldr.SymType(rs1) != sym.SXREF {
+			haveABI = abi
+		}
+	}
+	return reqABI, haveABI, haveABI != ^obj.ABI(0)
+}
+
+// reportUnresolved reports the unresolved symbols recorded since it was
+// last called as a single error, which lists each symbol once for each
+// package referring to it, with the symbols referring to it:
+//
+//	undefined symbols:
+//		main:
+//			missing0, referenced by main(.text)
+//			main.undefined, referenced by main.defined1, main.defined2
+//			main.f (defined for ABI0, not ABIInternal), referenced by main.g
+//		and 45 more
+//
+// The packages and the symbols are sorted by name. With -errorlimit,
+// at most that many symbols are listed.
+func (reporter *ErrorReporter) reportUnresolved(ldr *loader.Loader) {
+	reporter.unresMutex.Lock()
+	keys := reporter.unresolved
+	reporter.unresolved = nil
+	reporter.unresMutex.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	type undefKey struct {
+		pkg, name string
+	}
+	type undef struct {
+		undefKey
+		note string
+		from []string
+	}
+	undefs := make(map[undefKey]*undef)
+	for _, k := range keys {
+		uk := undefKey{symPackage(ldr, k.from), ldr.SymName(k.to)}
+		u := undefs[uk]
+		if u == nil {
+			u = &undef{undefKey: uk}
+			if reqABI, haveABI, ok := otherABI(ldr, k.to); ok {
+				u.note = fmt.Sprintf(" (defined for %s, not %s)", haveABI, reqABI)
+			}
+			undefs[uk] = u
+		}
+		u.from = append(u.from, ldr.SymName(k.from))
+	}
+	list := make([]*undef, 0, len(undefs))
+	for _, u := range undefs {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].pkg != list[j].pkg {
+			return list[i].pkg < list[j].pkg
+		}
+		return list[i].name < list[j].name
+	})
+
+	const maxFrom = 3 // symbols listed as referring to each
+	var b strings.Builder
+	b.WriteString("undefined symbols:")
+	pkg := ""
+	for i, u := range list {
+		if *flagErrorLimit > 0 && i == *flagErrorLimit {
+			fmt.Fprintf(&b, "\n\tand %d more", len(list)-i)
+			break
+		}
+		if i == 0 || u.pkg != pkg {
+			pkg = u.pkg
+			fmt.Fprintf(&b, "\n\t%s:", pkg)
+		}
+		sort.Strings(u.from)
+		from := u.from[:0]
+		for i, f := range u.from {
+			if i == 0 || f != u.from[i-1] {
+				from = append(from, f)
+			}
 		}
+		more := ""
+		if len(from) > maxFrom {
+			more = fmt.Sprintf(" and %d more", len(from)-maxFrom)
+			from = from[:maxFrom]
+		}
+		fmt.Fprintf(&b, "\n\t\t%s%s, referenced by %s%s", u.name, u.note, strings.Join(from, ", "), more)
+	}
+	Errorf(nil, "%s", b.String())
+}
+
+// deferErrors makes the errors about symbols wait until the returned
+// function is called, which prints them ordered by the address of
+// their symbol, for the phases that apply relocations in parallel.
+// See loader.ErrorReporter.Defer. With -h, the errors are printed at
+// once, for the stack of the panic.
+func (ctxt *Link) deferErrors() (flush func()) {
+	if *flagH {
+		return func() {}
 	}
+	reporter := ctxt.loader.GetErrorReporter()
+	reporter.Defer()
+	return reporter.Flush
 }
@@ -0,0 +1,160 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"sort"
+)
+
+// checkExportCollisions warns about cgo exports whose names are also
+// defined by the C library or by a shared library the program imports
+// symbols from. Such an export interposes on the library's definition
+// for every user of the name in the process, which is rarely intended.
+// With -strictwarnings the collisions are errors.
+func (ctxt *Link) checkExportCollisions() {
+	if ctxt.HeadType == objabi.Hwindows {
+		return
+	}
+	ldr := ctxt.loader
+
+	// The symbols the program imports dynamically name the library
+	// that defines them.
+	dynimp := make(map[string]string)
+	var exports []loader.Sym
+	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+		if ldr.AttrCgoExportDynamic(s) {
+			exports = append(exports, s)
+			continue
+		}
+		if ldr.SymType(s) == sym.SDYNIMPORT {
+			if lib := ldr.SymDynimplib(s); lib != "" {
+				dynimp[ldr.SymExtname(s)] = lib
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range exports {
+		name := ldr.SymExtname(s)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lib, ok := dynimp[name]
+		if !ok {
+			lib, ok = libcSymbols[name]
+		}
+		if ok {
+			warnf("cgo export %s collides with symbol %s in %s", name, name, lib)
+		}
+	}
+}
+
+// libcSymbols maps commonly used functions and variables of the C
+// library, the math library and the threads library to the library
+// that defines them.
+var libcSymbols = map[string]string{}
+
+func init() {
+	add := func(lib string, names ...string) {
+		for _, name := range names {
+			libcSymbols[name] = lib
+		}
+	}
+	add("libc",
+		// stdlib.h
+		"abort", "abs", "atexit", "atof", "atoi", "atol", "atoll",
+		"bsearch", "calloc", "div", "exit", "free", "getenv", "labs",
+		"ldiv", "llabs", "lldiv", "malloc", "mblen", "mbstowcs",
+		"mbtowc", "mkstemp", "posix_memalign", "putenv", "qsort",
+		"rand", "random", "realloc", "realpath", "setenv", "srand",
+		"srandom", "strtod", "strtof", "strtol", "strtold", "strtoll",
+		"strtoul", "strtoull", "system", "unsetenv", "wcstombs",
+		"wctomb", "_exit", "_Exit", "aligned_alloc",
+		// string.h
+		"memchr", "memcmp", "memcpy", "memmove", "memset", "stpcpy",
+		"strcasecmp", "strcat", "strchr", "strcmp", "strcoll",
+		"strcpy", "strcspn", "strdup", "strerror", "strlen",
+		"strncasecmp", "strncat", "strncmp", "strncpy", "strndup",
+		"strnlen", "strpbrk", "strrchr", "strsep", "strspn",
+		"strstr", "strtok", "strtok_r", "strxfrm",
+		// stdio.h
+		"clearerr", "fclose", "fdopen", "feof", "ferror", "fflush",
+		"fgetc", "fgets", "fileno", "fopen", "fprintf", "fputc",
+		"fputs", "fread", "freopen", "fscanf", "fseek", "ftell",
+		"fwrite", "getc", "getchar", "getline", "perror", "popen",
+		"pclose", "printf", "putc", "putchar", "puts", "remove",
+		"rename", "rewind", "scanf", "setbuf", "setvbuf",
+		"snprintf", "sprintf", "sscanf", "stderr", "stdin",
+		"stdout", "tmpfile", "ungetc", "vfprintf", "vprintf",
+		"vsnprintf", "vsprintf",
+		// unistd.h, fcntl.h and other system calls
+		"access", "alarm", "chdir", "chmod", "chown", "close",
+		"creat", "dup", "dup2", "dup3", "execl", "execle", "execlp",
+		"execv", "execve", "execvp", "fchdir", "fchmod", "fchown",
+		"fcntl", "fork", "fstat", "fsync", "ftruncate", "getcwd",
+		"getegid", "geteuid", "getgid", "getpagesize", "getpgid",
+		"getpgrp", "getpid", "getppid", "getuid", "ioctl", "isatty",
+		"kill", "lchown", "link", "lseek", "lstat", "mkdir",
+		"mkfifo", "mmap", "mprotect", "munmap", "nanosleep", "open",
+		"openat", "pause", "pipe", "pipe2", "poll", "pread",
+		"pwrite", "read", "readlink", "rmdir", "sbrk", "select",
+		"setgid", "setpgid", "setsid", "setuid", "sleep", "stat",
+		"symlink", "sync", "sysconf", "truncate", "umask", "uname",
+		"unlink", "usleep", "vfork", "wait", "waitpid", "write",
+		// socket.h and netdb.h
+		"accept", "bind", "connect", "freeaddrinfo", "gai_strerror",
+		"getaddrinfo", "gethostbyname", "gethostname", "getnameinfo",
+		"getpeername", "getsockname", "getsockopt", "listen", "recv",
+		"recvfrom", "recvmsg", "send", "sendmsg", "sendto",
+		"setsockopt", "shutdown", "socket", "socketpair",
+		// signal.h and setjmp.h
+		"longjmp", "raise", "setjmp", "sigaction", "sigaddset",
+		"sigdelset", "sigemptyset", "sigfillset", "siglongjmp",
+		"signal", "sigprocmask", "sigsetjmp",
+		// time.h
+		"asctime", "clock", "clock_gettime", "ctime", "difftime",
+		"gettimeofday", "gmtime", "localtime", "mktime", "strftime",
+		"time",
+		// ctype.h
+		"isalnum", "isalpha", "isdigit", "islower", "isprint",
+		"isspace", "isupper", "isxdigit", "tolower", "toupper",
+		// dlfcn.h, which glibc 2.34 and later defines in libc
+		"dladdr", "dlclose", "dlerror", "dlopen", "dlsym",
+		// errno.h and miscellany
+		"environ", "errno", "__errno_location", "getopt", "optarg",
+		"optind", "syslog",
+	)
+	add("libm",
+		"acos", "acosh", "asin", "asinh", "atan", "atan2", "atanh",
+		"cbrt", "ceil", "copysign", "cos", "cosh", "erf", "erfc",
+		"exp", "exp2", "expm1", "fabs", "floor", "fma", "fmax",
+		"fmin", "fmod", "frexp", "hypot", "ldexp", "lgamma", "log",
+		"log10", "log1p", "log2", "lrint", "lround", "modf",
+		"nearbyint", "nextafter", "pow", "remainder", "rint",
+		"round", "scalbn", "sin", "sinh", "sqrt", "tan", "tanh",
+		"tgamma", "trunc",
+	)
+	add("libpthread",
+		"pthread_attr_destroy", "pthread_attr_init",
+		"pthread_attr_setstacksize", "pthread_cond_broadcast",
+		"pthread_cond_destroy", "pthread_cond_init",
+		"pthread_cond_signal", "pthread_cond_wait", "pthread_create",
+		"pthread_detach", "pthread_equal", "pthread_exit",
+		"pthread_getspecific", "pthread_join", "pthread_key_create",
+		"pthread_key_delete", "pthread_kill", "pthread_mutex_destroy",
+		"pthread_mutex_init", "pthread_mutex_lock",
+		"pthread_mutex_trylock", "pthread_mutex_unlock",
+		"pthread_once", "pthread_self", "pthread_setspecific",
+		"pthread_sigmask", "sem_init", "sem_post", "sem_wait",
+	)
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// After linking a C shared library, or an executable with
+// -exportsymbols, the functions exported with //export are checked to
+// still be exported by the output, so that a function that vanished is
+// reported by the build rather than by dlsym. An export disappears if the host linker discards it, for
+// example with --gc-sections, or hides it, for example with a version
+// script that does not list it.
+//
+// Only the exports cgo recorded in the objects can be checked: a file
+// excluded by build constraints leaves no trace in them, and the
+// library is simply built without its exports.
+
+// A cgoExport is a function exported to C with //export, as recorded
+// by a cgo_export_dynamic directive.
+type cgoExport struct {
+	name string // the C name
+	pkg  string // the package exporting it
+}
+
+// lintExports reports, as warnings or with -strictwarnings as errors,
+// the exports of the C shared library or executable outfile written by
+// the host linker that are missing from its dynamic symbol table, with
+// the reason.
+func (ctxt *Link) lintExports(outfile string) {
+	if !ctxt.IsELF || ctxt.BuildMode != BuildModeCShared && ctxt.exportSymbols == nil {
+		return
+	}
+	exports := ctxt.cgoExports
+	if ctxt.exportSymbols != nil {
+		// With -exportsymbols, only the listed exports are meant to be
+		// exported, and every listed symbol is.
+		exports = listedExports(exports, ctxt.exportSymbols)
+	}
+	var problems []string
+	var err error
+	if len(exports) > 0 {
+		problems, err = exportProblems(exports, outfile)
+	}
+	if err == nil && ctxt.exportSymbols != nil {
+		var unexported []string
+		unexported, err = unexportedSymbols(ctxt.exportSymbols, ctxt.cgoExports, outfile)
+		problems = append(problems, unexported...)
+	}
+	if err != nil {
+		Exitf("checking the exports of %s: %v", outfile, err)
+	}
+	for _, p := range problems {
+		warnf("%s", p)
+	}
+	if len(problems) > 0 && *flagStrictWarnings {
+		os.Remove(outfile)
+	}
+}
+
+// exportProblems returns a message for each of exports that the ELF
+// output outfile does not export.
+func exportProblems(exports []cgoExport, outfile string) ([]string, error) {
+	f, err := elf.Open(outfile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dynsyms, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, err
+	}
+	// Without a symbol table (-s), hidden and discarded exports are
+	// not told apart.
+	syms, _ := f.Symbols()
+
+	dyn := make(map[string]elf.Symbol)
+	for _, s := range dynsyms {
+		dyn[s.Name] = s
+	}
+	static := make(map[string]bool)
+	for _, s := range syms {
+		if s.Section != elf.SHN_UNDEF {
+			static[s.Name] = true
+		}
+	}
+
+	pkgs := make(map[string][]string)
+	for _, e := range exports {
+		if !contains(pkgs[e.name], e.pkg) {
+			pkgs[e.name] = append(pkgs[e.name], e.pkg)
+		}
+	}
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		if len(pkgs[name]) > 1 {
+			sort.Strings(pkgs[name])
+			problems = append(problems, fmt.Sprintf("cgo export %s is exported by several packages, only one of them is exported: %s", name, strings.Join(pkgs[name], ", ")))
+			continue
+		}
+		var why string
+		s, ok := dyn[name]
+		switch {
+		case ok && s.Section == elf.SHN_UNDEF:
+			why = "it is not defined, but referred to"
+		case ok && elf.ST_BIND(s.Info) == elf.STB_LOCAL:
+			why = "its dynamic symbol is local"
+		case ok && (elf.ST_VISIBILITY(s.Other) == elf.STV_HIDDEN || elf.ST_VISIBILITY(s.Other) == elf.STV_INTERNAL):
+			why = "its dynamic symbol is hidden"
+		case ok:
+			continue
+		case static[name]:
+			why = "the external linker made it local, for example with a version script"
+		case syms != nil:
+			why = "the external linker discarded it as dead code, for example with --gc-sections"
+		default:
+			why = "it is not in the dynamic symbol table"
+		}
+		problems = append(problems, fmt.Sprintf("cgo export %s of package %s is not exported by the output: %s", name, pkgs[name][0], why))
+	}
+	return problems, nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// The -exportsymbols flag limits the dynamic symbols of a C shared
+// library to the ones listed in a file, one name per line, with
+// comments starting with #. The external linker is given a version
+// script that makes every other symbol local, which hides the symbols
+// of the runtime/cgo C code and of the C code of the packages. The Go
+// symbols are local anyway when linking externally. The runtime needs
+// none of its symbols to be exported: the C code calling into Go is
+// part of the library.
+//
+// A name may be followed by @ and a version, as in Add@LIBFOO_1.0,
+// which attaches the symbol to that version node. The versions form a
+// chain in the order they first appear, each inheriting from the one
+// before it. As GNU version scripts cannot mix versioned and
+// unversioned symbols, either every symbol has a version or none has.
+//
+// An ELF executable exports its cgo exports, and with -exportdynamic
+// every global symbol its host objects define with default visibility,
+// as -rdynamic does, so that the libraries it opens can use them. When
+// linking externally, the host linker is passed -rdynamic anyway. With
+// -exportsymbols, the executable exports only the symbols listed; the
+// internal linker cannot attach versions to them.
+
+// An exportSymbol is a symbol listed in the -exportsymbols file.
+type exportSymbol struct {
+	name    string
+	version string // "" if unversioned
+}
+
+// parseExportSymbols parses the contents of the -exportsymbols file.
+func parseExportSymbols(file, data string) ([]exportSymbol, error) {
+	var syms []exportSymbol
+	seen := make(map[string]string) // version of each name
+	for i, line := range strings.Split(data, "\n") {
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		pos := fmt.Sprintf("%s:%d", file, i+1)
+		name, version := line, ""
+		if j := strings.Index(line, "@"); j >= 0 {
+			name, version = line[:j], line[j+1:]
+			if version == "" || strings.ContainsAny(version, " \t\"\\*?[];{}@") {
+				return nil, fmt.Errorf("%s: invalid version %q", pos, version)
+			}
+		}
+		if name == "" || strings.ContainsAny(name, " \t\"\\*?[];{}") {
+			return nil, fmt.Errorf("%s: invalid symbol name %q", pos, name)
+		}
+		if len(syms) > 0 && (syms[0].version == "") != (version == "") {
+			return nil, fmt.Errorf("%s: either every symbol has a version or none has", pos)
+		}
+		if prev, ok := seen[name]; ok {
+			if prev != version {
+				return nil, fmt.Errorf("%s: %s is listed with versions %s and %s", pos, name, prev, version)
+			}
+			continue
+		}
+		seen[name] = version
+		syms = append(syms, exportSymbol{name, version})
+	}
+	return syms, nil
+}
+
+// exportSymbolsScript reads the -exportsymbols file and writes the
+// version script for the external linker, returning its path.
+func (ctxt *Link) exportSymbolsScript() string {
+	syms := ctxt.readExportSymbols()
+	path := filepath.Join(*flagTmpdir, "exports.map")
+	if err := ioutil.WriteFile(path, []byte(versionScript(syms)), 0666); err != nil {
+		Exitf("%v", err)
+	}
+	return path
+}
+
+// readExportSymbols reads the -exportsymbols file, recording the names
+// in ctxt.exportSymbols.
+func (ctxt *Link) readExportSymbols() []exportSymbol {
+	data, err := ioutil.ReadFile(*flagExportSymbols)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	syms, err := parseExportSymbols(*flagExportSymbols, string(data))
+	if err != nil {
+		Exitf("%v", err)
+	}
+	ctxt.exportSymbols = []string{}
+	for _, s := range syms {
+		ctxt.exportSymbols = append(ctxt.exportSymbols, s.name)
+	}
+	return syms
+}
+
+// exeExports sets the dynamic symbols an executable linked internally
+// exports, adding the global symbols of the host objects to ctxt.dynexp
+// with -exportdynamic and dropping those -exportsymbols does not list.
+// It runs before the deadcode pass, for which ctxt.dynexp are roots.
+func (ctxt *Link) exeExports() {
+	ldr := ctxt.loader
+	if *flagExportDynamic {
+		for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+			outer := ldr.OuterSym(s)
+			if outer == 0 || !ldr.IsExternal(outer) || ldr.SymVersion(s) != 0 || ldr.AttrVisibilityHidden(s) || ldr.AttrCgoExportDynamic(s) {
+				continue
+			}
+			ctxt.dynexp = append(ctxt.dynexp, s)
+		}
+	}
+	if *flagExportSymbols == "" {
+		return
+	}
+	syms := ctxt.readExportSymbols()
+	if len(syms) > 0 && syms[0].version != "" {
+		Exitf("%s: the internal linker cannot attach versions to the exports of an executable", *flagExportSymbols)
+	}
+	listed := make(map[string]bool)
+	for _, s := range syms {
+		listed[s.name] = true
+	}
+	defined := make(map[string]bool)
+	dynexp := ctxt.dynexp[:0]
+	for _, s := range ctxt.dynexp {
+		name := ldr.SymExtname(s)
+		if listed[name] {
+			dynexp = append(dynexp, s)
+			defined[name] = true
+		}
+	}
+	ctxt.dynexp = dynexp
+	for _, s := range syms {
+		if !defined[s.name] {
+			warnf("%s lists %s, which is not defined by the output", *flagExportSymbols, s.name)
+		}
+	}
+}
+
+// versionScript returns a version script exporting only syms.
+func versionScript(syms []exportSymbol) string {
+	var versions []string
+	names := make(map[string][]string)
+	for _, s := range syms {
+		if _, ok := names[s.version]; !ok {
+			versions = append(versions, s.version)
+		}
+		names[s.version] = append(names[s.version], s.name)
+	}
+	if len(versions) == 0 {
+		versions = []string{""}
+	}
+
+	var b strings.Builder
+	for i, v := range versions {
+		if v != "" {
+			b.WriteString(v + " ")
+		}
+		b.WriteString("{\n")
+		if len(names[v]) > 0 {
+			b.WriteString("\tglobal:\n")
+			for _, name := range names[v] {
+				// Quoted names are not patterns.
+				fmt.Fprintf(&b, "\t\t\"%s\";\n", name)
+			}
+		}
+		if i == 0 {
+			b.WriteString("\tlocal:\n\t\t*;\n")
+		}
+		b.WriteString("}")
+		if i > 0 {
+			b.WriteString(" " + versions[i-1])
+		}
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// listedExports returns the exports that are listed in names.
+func listedExports(exports []cgoExport, names []string) []cgoExport {
+	listed := make(map[string]bool)
+	for _, name := range names {
+		listed[name] = true
+	}
+	var out []cgoExport
+	for _, e := range exports {
+		if listed[e.name] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// unexportedSymbols returns a message for each of names that is not
+// a cgo export and is not defined in the dynamic symbol table of the
+// ELF output outfile. The cgo exports are checked by
+// exportProblems.
+func unexportedSymbols(names []string, exports []cgoExport, outfile string) ([]string, error) {
+	f, err := elf.Open(outfile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dynsyms, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, err
+	}
+	defined := make(map[string]bool)
+	for _, s := range dynsyms {
+		if s.Section != elf.SHN_UNDEF {
+			defined[s.Name] = true
+		}
+	}
+	for _, e := range exports {
+		defined[e.name] = true
+	}
+	var problems []string
+	for _, name := range names {
+		if !defined[name] {
+			problems = append(problems, fmt.Sprintf("%s lists %s, which is not defined by the output", *flagExportSymbols, name))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExportSymbols(t *testing.T) {
+	const src = `
+# The API.
+Add
+Sub   # trailing comment
+Add
+`
+	syms, err := parseExportSymbols("x.txt", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []exportSymbol{{"Add", ""}, {"Sub", ""}}; !reflect.DeepEqual(syms, want) {
+		t.Errorf("parseExportSymbols = %q, want %q", syms, want)
+	}
+
+	syms, err = parseExportSymbols("x.txt", "Add@LIBX_1.0\nSub@LIBX_2.0\nMul@LIBX_1.0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []exportSymbol{{"Add", "LIBX_1.0"}, {"Sub", "LIBX_2.0"}, {"Mul", "LIBX_1.0"}}; !reflect.DeepEqual(syms, want) {
+		t.Errorf("parseExportSymbols with versions = %q, want %q", syms, want)
+	}
+
+	errors := []struct {
+		src, err string
+	}{
+		{"Add\nlib_*\n", `x.txt:2: invalid symbol name "lib_*"`},
+		{"Add@\n", `x.txt:1: invalid version ""`},
+		{"Add@V1\nSub\n", "x.txt:2: either every symbol has a version or none has"},
+		{"Add@V1\nAdd@V2\n", "x.txt:2: Add is listed with versions V1 and V2"},
+	}
+	for _, test := range errors {
+		if _, err := parseExportSymbols("x.txt", test.src); err == nil || err.Error() != test.err {
+			t.Errorf("parseExportSymbols(%q): error %v, want %s", test.src, err, test.err)
+		}
+	}
+}
+
+func TestVersionScript(t *testing.T) {
+	tests := []struct {
+		syms []exportSymbol
+		want string
+	}{
+		{nil, "{\n\tlocal:\n\t\t*;\n};\n"},
+		{
+			[]exportSymbol{{"Add", ""}, {"Sub", ""}},
+			"{\n\tglobal:\n\t\t\"Add\";\n\t\t\"Sub\";\n\tlocal:\n\t\t*;\n};\n",
+		},
+		{
+			[]exportSymbol{{"Add", "V1"}, {"Sub", "V2"}, {"Mul", "V1"}},
+			"V1 {\n\tglobal:\n\t\t\"Add\";\n\t\t\"Mul\";\n\tlocal:\n\t\t*;\n};\n" +
+				"V2 {\n\tglobal:\n\t\t\"Sub\";\n} V1;\n",
+		},
+	}
+	for _, test := range tests {
+		if got := versionScript(test.syms); got != test.want {
+			t.Errorf("versionScript(%q) = %q, want %q", test.syms, got, test.want)
+		}
+	}
+}
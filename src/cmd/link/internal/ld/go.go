@@ -257,6 +257,7 @@ func setCgoAttr(ctxt *Link, file string, pkg string, directives [][]string, host
 				}
 				l.SetAttrCgoExportStatic(s, true)
 			} else {
+				ctxt.cgoExports = append(ctxt.cgoExports, cgoExport{name: remote, pkg: pkg})
 				if ctxt.LinkMode == LinkInternal && !l.AttrCgoExportDynamic(s) {
 					// Dynamic cgo exports appear
 					// in the exported symbol table.
@@ -373,6 +374,80 @@ func adddynlib(ctxt *Link, lib string) {
 	}
 }
 
+// resolveWeakUndefs resolves the symbols that host objects refer to
+// only weakly and that are still undefined once all host objects are
+// loaded, as a host linker would. In a position-dependent executable
+// they are given address 0, without any dynamic relocation. In
+// position-independent output they become dynamic imports, like those
+// that cgo found in a library: their dynamic symbols are weak (see
+// elfadddynsym), so that the dynamic linker binds them to 0 if no
+// library loaded defines them.
+func (ctxt *Link) resolveWeakUndefs() {
+	if !ctxt.IsELF || ctxt.LinkMode != LinkInternal {
+		return
+	}
+	ldr := ctxt.loader
+	for _, s := range ldr.WeakUndefSyms() {
+		switch ldr.SymType(s) {
+		case sym.Sxxx, sym.SXREF:
+		default:
+			continue
+		}
+		ctxt.resolveUndef(s)
+	}
+}
+
+// resolveUndef resolves the undefined symbol s like a weak undefined
+// symbol (see resolveWeakUndefs), and reports whether it gave s
+// address 0 rather than making it a dynamic import.
+func (ctxt *Link) resolveUndef(s loader.Sym) (zero bool) {
+	ldr := ctxt.loader
+	if ctxt.BuildMode == BuildModeExe {
+		ctxt.xdefine(ldr.SymName(s), sym.SRODATA, 0)
+		ldr.SetAttrNotInSymbolTable(s, true)
+		ldr.SetAttrUndefZero(s, true)
+		return true
+	}
+	su := ldr.MakeSymbolUpdater(s)
+	su.SetType(sym.SDYNIMPORT)
+	return false
+}
+
+// resolveUnresolved applies -unresolved to the symbols that host
+// objects refer to, that the deadcode pass found reachable and that
+// nothing defines. With -unresolved=warn or ignore, they are resolved
+// like weak undefined symbols, although the dynamic linker still fails
+// to bind a dynamic import that no library defines, for a call only
+// once it is made. Go code referring to an undefined symbol is always
+// an error, as is any such symbol with -unresolved=error. When linking
+// externally, the host linker is told to do the same (see
+// hostlink).
+func (ctxt *Link) resolveUnresolved() {
+	if *flagUnresolved == "error" || !ctxt.IsELF || ctxt.LinkMode != LinkInternal {
+		return
+	}
+	ldr := ctxt.loader
+	for _, s := range ldr.HostUndefSyms() {
+		switch ldr.SymType(s) {
+		case sym.Sxxx, sym.SXREF:
+		default:
+			continue
+		}
+		if !ldr.AttrReachable(s) {
+			continue
+		}
+		zero := ctxt.resolveUndef(s)
+		if *flagUnresolved != "warn" {
+			continue
+		}
+		if zero {
+			warnf("undefined symbol %s resolved to 0", ldr.SymName(s))
+		} else {
+			warnf("undefined symbol %s left to the dynamic linker", ldr.SymName(s))
+		}
+	}
+}
+
 func Adddynsym(ldr *loader.Loader, target *Target, syms *ArchSyms, s loader.Sym) {
 	if ldr.SymDynid(s) >= 0 || target.LinkMode == LinkExternal {
 		return
@@ -441,6 +516,8 @@ func (ctxt *Link) addexport() {
 		}
 	}
 
+	ctxt.checkExportCollisions()
+
 	// TODO(aix)
 	if ctxt.HeadType == objabi.Hdarwin || ctxt.HeadType == objabi.Haix {
 		return
@@ -456,7 +533,11 @@ func (ctxt *Link) addexport() {
 		Adddynsym(ctxt.loader, &ctxt.Target, &ctxt.ArchSyms, s)
 	}
 
-	for _, lib := range dedupLibraries(ctxt, dynlib) {
+	libs := dedupLibraries(ctxt, dynlib)
+	if *flagAsan {
+		libs = asanLibFirst(libs)
+	}
+	for _, lib := range libs {
 		adddynlib(ctxt, lib)
 	}
 }
@@ -0,0 +1,160 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bufio"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Support for -dumpgot, which writes out every GOT and PLT entry the
+// linker created, one per line:
+//
+//	kind	symbol	reason	packages
+//
+// kind is got or plt, and packages lists the packages whose code or
+// data refers to the entry, separated by commas. The reason is why
+// the symbol is reached indirectly:
+//
+//	dynimport   the symbol is defined by a shared library
+//	ifunc       the symbol is an indirect function of a host object,
+//	            whose address is only known once its resolver ran
+//	tls         the symbol is a thread-local variable
+//	weakundef   the symbol is a weak undefined reference; the entry is 0
+//	unresolved  the symbol is undefined, and -unresolved made the entry 0
+//	unrelaxed   the symbol is defined in the output, but the instruction
+//	            loading its address from the GOT could not be rewritten
+//	            to compute it directly
+//
+// The entries are preceded by comment lines counting them for each
+// reason. The internal linker only links executables, in which no
+// symbol is preemptible. When linking externally, the external
+// linker creates the GOT and PLT, and the file only says so.
+
+// gotRefs records the symbols whose relocations were redirected to a
+// GOT or PLT entry, for -dumpgot.
+type gotRefs map[loader.Sym][]loader.Sym
+
+// adddynrel calls the architecture's Adddynrel for relocation ri of s,
+// recording for -dumpgot and checkEarlyRelocs the entry of the GOT or
+// PLT it now refers to.
+func (ctxt *Link) adddynrel(s loader.Sym, r loader.Reloc, ri int) bool {
+	ldr := ctxt.loader
+	targ := r.Sym() // r may change
+	ok := thearch.Adddynrel(&ctxt.Target, ldr, &ctxt.ArchSyms, s, r, ri)
+	if (ctxt.gotRefs == nil && ctxt.indirectRefs == nil) || targ == 0 {
+		return ok
+	}
+	relocs := ldr.Relocs(s)
+	switch via := relocs.At(ri).Sym(); via {
+	case ctxt.GOT, ctxt.PLT, ctxt.GOTPLT:
+		if targ == ctxt.GOT || targ == ctxt.PLT || targ == ctxt.GOTPLT {
+			break
+		}
+		if ctxt.gotRefs != nil {
+			ctxt.gotRefs[targ] = append(ctxt.gotRefs[targ], s)
+		}
+		if ctxt.indirectRefs != nil {
+			ctxt.indirectRefs[s] = append(ctxt.indirectRefs[s], indirectRef{targ, via})
+		}
+	}
+	return ok
+}
+
+// gotReason returns why s has an entry in the GOT or PLT.
+func gotReason(ldr *loader.Loader, s loader.Sym) string {
+	switch {
+	case ldr.AttrIFunc(s):
+		return "ifunc"
+	case ldr.SymType(s) == sym.SDYNIMPORT:
+		return "dynimport"
+	case ldr.SymType(s) == sym.STLSBSS:
+		return "tls"
+	case ldr.AttrWeakUndef(s):
+		return "weakundef"
+	case ldr.AttrUndefZero(s):
+		return "unresolved"
+	}
+	return "unrelaxed"
+}
+
+// dumpGOT writes the GOT and PLT entries to the file named by
+// -dumpgot.
+func (ctxt *Link) dumpGOT() {
+	ldr := ctxt.loader
+	var lines []string
+	counts := make(map[string]*[2]int) // GOT and PLT entries for each reason
+	if ctxt.IsInternal() {
+		for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+			got, plt := ldr.SymGot(s) >= 0, ldr.SymPlt(s) >= 0
+			if !got && !plt {
+				continue
+			}
+			reason := gotReason(ldr, s)
+			if counts[reason] == nil {
+				counts[reason] = new([2]int)
+			}
+
+			var pkgs []string
+			for _, r := range ctxt.gotRefs[s] {
+				if pkg := symPackage(ldr, r); !contains(pkgs, pkg) {
+					pkgs = append(pkgs, pkg)
+				}
+			}
+			sort.Strings(pkgs)
+			refs := strings.Join(pkgs, ",")
+			if refs == "" {
+				refs = "-"
+			}
+
+			if got {
+				counts[reason][0]++
+				lines = append(lines, fmt.Sprintf("got\t%s\t%s\t%s\n", ldr.SymName(s), reason, refs))
+			}
+			if plt {
+				counts[reason][1]++
+				lines = append(lines, fmt.Sprintf("plt\t%s\t%s\t%s\n", ldr.SymName(s), reason, refs))
+			}
+		}
+	}
+	sort.Strings(lines)
+
+	f, err := os.Create(*flagDumpGOT)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "# %s/%s %s\n", &ctxt.HeadType, ctxt.Arch.Name, &ctxt.BuildMode)
+	if ctxt.IsExternal() {
+		fmt.Fprintf(w, "# linked externally: the external linker creates the GOT and PLT\n")
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	var total [2]int
+	for _, reason := range reasons {
+		c := counts[reason]
+		fmt.Fprintf(w, "# %s: %d got, %d plt\n", reason, c[0], c[1])
+		total[0] += c[0]
+		total[1] += c[1]
+	}
+	fmt.Fprintf(w, "# total: %d got, %d plt\n", total[0], total[1])
+	for _, line := range lines {
+		w.WriteString(line)
+	}
+	if err := w.Flush(); err != nil {
+		Exitf("%v", err)
+	}
+	if err := f.Close(); err != nil {
+		Exitf("%v", err)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// After an external link, the output is checked for the sections and
+// symbols the runtime depends on. A host linker can remove or
+// rearrange them, for example with an aggressive --gc-sections or a
+// linker script, and the program would then only fail when run.
+// The check is disabled by -skip-extlink-check.
+
+// checkHostlinkOutput checks that the ELF file outfile, written by
+// the host linker, still holds what the runtime needs from goobj.
+func (ctxt *Link) checkHostlinkOutput(goobj, outfile string) {
+	problems, err := ctxt.elfHostlinkProblems(goobj, outfile)
+	if err != nil {
+		Exitf("checking external linker output: %v", err)
+	}
+	if len(problems) == 0 {
+		return
+	}
+	os.Remove(outfile)
+	Exitf("external linker output %s is broken:\n\t%s\n(use -skip-extlink-check to skip this check)", outfile, strings.Join(problems, "\n\t"))
+}
+
+// elfHostlinkProblems returns the problems found in the ELF file
+// outfile, linked from goobj.
+func (ctxt *Link) elfHostlinkProblems(goobj, outfile string) ([]string, error) {
+	gof, err := elf.Open(goobj)
+	if err != nil {
+		return nil, err
+	}
+	defer gof.Close()
+	f, err := elf.Open(outfile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// The build information, which the go command and debug/buildinfo
+	// look for by section name.
+	if gof.Section(".go.buildinfo") != nil {
+		sect := f.Section(".go.buildinfo")
+		switch {
+		case sect == nil:
+			problemf("section .go.buildinfo is missing; did the external linker discard it?")
+		case sect.Size == 0 || sect.Type == elf.SHT_NOBITS:
+			problemf("section .go.buildinfo is empty")
+		default:
+			data, err := sect.Data()
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.HasPrefix(data, []byte(buildinfomagic)) {
+				problemf("section .go.buildinfo does not start with the build information")
+			}
+		}
+	}
+
+	// The thread-local storage used by the runtime.
+	hasTLS := false
+	for _, sect := range gof.Sections {
+		if sect.Flags&elf.SHF_TLS != 0 && sect.Size > 0 {
+			hasTLS = true
+		}
+	}
+	if hasTLS {
+		found := false
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_TLS {
+				found = true
+			}
+		}
+		if !found {
+			problemf("there is no TLS segment (PT_TLS), but the Go code uses thread-local storage")
+		}
+	}
+
+	// The symbols of the runtime tables. The host linker may have
+	// stripped the symbol table, or discarded local symbols, in which
+	// case they cannot be checked.
+	if *FlagS {
+		return problems, nil
+	}
+	gosyms, err := gof.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	want := make(map[string]elf.Symbol)
+	for _, s := range gosyms {
+		want[s.Name] = s
+	}
+	have := make(map[string]elf.Symbol)
+	for _, s := range syms {
+		if _, ok := want[s.Name]; ok {
+			have[s.Name] = s
+		}
+	}
+	if len(have) == 0 {
+		return problems, nil
+	}
+
+	// discarded reports whether the host linker removed the symbol
+	// name because it is local in goobj, as -Wl,--discard-all and
+	// -Wl,-x do. Such a symbol cannot be checked, but its absence
+	// does not mean the table it marks is gone.
+	discarded := func(name string) bool {
+		_, ok := have[name]
+		return !ok && elf.ST_BIND(want[name].Info) == elf.STB_LOCAL
+	}
+
+	// section returns the allocated section of f holding the
+	// range [addr, addr+size], or nil.
+	section := func(addr, size uint64) *elf.Section {
+		for _, sect := range f.Sections {
+			if sect.Flags&elf.SHF_ALLOC != 0 && sect.Flags&elf.SHF_TLS == 0 && sect.Addr <= addr && addr+size <= sect.Addr+sect.Size {
+				return sect
+			}
+		}
+		return nil
+	}
+
+	// checkRange checks that the table between the symbols start and
+	// end was kept whole, in a single section.
+	checkRange := func(start, end string) {
+		gs, ok1 := want[start]
+		ge, ok2 := want[end]
+		if !ok1 || !ok2 || discarded(start) || discarded(end) {
+			return
+		}
+		s, ok1 := have[start]
+		e, ok2 := have[end]
+		switch {
+		case !ok1:
+			problemf("symbol %s is missing", start)
+		case !ok2:
+			problemf("symbol %s is missing", end)
+		case e.Value < s.Value:
+			problemf("%s (%#x) is before %s (%#x)", end, e.Value, start, s.Value)
+		case e.Value-s.Value != ge.Value-gs.Value:
+			problemf("%s to %s spans %#x bytes, want %#x", start, end, e.Value-s.Value, ge.Value-gs.Value)
+		default:
+			if sect := section(s.Value, e.Value-s.Value); sect == nil {
+				problemf("%s to %s (%#x-%#x) is not within a single allocated section", start, end, s.Value, e.Value)
+			} else if sect.Type == elf.SHT_NOBITS {
+				problemf("%s to %s is in section %s, which has no contents", start, end, sect.Name)
+			}
+		}
+	}
+	checkRange("runtime.pclntab", "runtime.epclntab")
+	checkRange("runtime.noptrdata", "runtime.enoptrdata")
+	checkRange("runtime.data", "runtime.edata")
+
+	// The module data, which describes all of the above to the
+	// runtime.
+	if ctxt.Moduledata != 0 {
+		name := ctxt.loader.SymName(ctxt.Moduledata)
+		if g, ok := want[name]; ok && !discarded(name) {
+			s, ok := have[name]
+			switch {
+			case !ok:
+				problemf("module data symbol %s is missing", name)
+			case s.Size != g.Size:
+				problemf("module data symbol %s has size %d, want %d", name, s.Size, g.Size)
+			default:
+				// With -guard-moduledata, it is read-only.
+				if sect := section(s.Value, s.Size); sect == nil || sect.Type == elf.SHT_NOBITS {
+					problemf("module data symbol %s (%#x) is not in a data section", name, s.Value)
+				} else if sect.Flags&elf.SHF_WRITE == 0 && !*flagGuardModData {
+					problemf("module data symbol %s (%#x) is not in a writable data section", name, s.Value)
+				}
+			}
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"strconv"
+	"strings"
+)
+
+// Internal linking support for the constructors of host objects.
+//
+// The C runtime of a program calls the constructors listed in the
+// .preinit_array, .init_array and .ctors sections of its objects, and
+// the dynamic linker those of the shared libraries. An executable
+// linked internally has no C runtime, so the linker lays the
+// constructors of the host objects out in an .init_array section, in
+// the order GNU ld would, and sets runtime.hostInitArray to its bounds
+// for the runtime to call them before the package initializers. When
+// linking a shared library or archive, the .init_array section is the
+// one the loader runs.
+//
+// The .fini_array and .dtors sections are not loaded: Go programs exit
+// without running the exit handlers of C.
+
+// collectInitArray records the constructor sections of the host
+// objects, which are loaded with type sym.SINITARR, and points
+// runtime.hostInitArray at the output section when linking an
+// executable.
+func (ctxt *Link) collectInitArray() {
+	ldr := ctxt.loader
+	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+		if ldr.IsExternal(s) && ldr.SymType(s) == sym.SINITARR {
+			ctxt.initArray = append(ctxt.initArray, s)
+		}
+	}
+	if len(ctxt.initArray) == 0 || ctxt.linkShared || (ctxt.BuildMode != BuildModeExe && ctxt.BuildMode != BuildModePIE) {
+		return
+	}
+	s := ldr.MakeSymbolUpdater(ldr.LookupOrCreateSym("runtime.hostInitArray", 0))
+	s.SetType(sym.SNOPTRDATA)
+	s.SetSize(0)
+	s.AddAddr(ctxt.Arch, ldr.LookupOrCreateSym("runtime.initarray", 0))
+	s.AddAddr(ctxt.Arch, ldr.LookupOrCreateSym("runtime.einitarray", 0))
+}
+
+// initPriority returns the sort key of the constructor section s of a
+// host object, for SORT_BY_INIT_PRIORITY: .preinit_array comes first,
+// then .init_array.N and .ctors.N by priority N, where that of .ctors.N
+// is 65535-N as its entries run backwards, then .init_array and .ctors.
+func initPriority(ldr *loader.Loader, s loader.Sym) int {
+	name := ldr.SymName(s)
+	i := strings.LastIndex(name, "(")
+	if i < 0 || !strings.HasSuffix(name, ")") {
+		return 65536 // not from a host object
+	}
+	name = name[i+1 : len(name)-1]
+	switch {
+	case name == ".preinit_array":
+		return -1
+	case strings.HasPrefix(name, ".init_array."):
+		if n, err := strconv.Atoi(name[len(".init_array."):]); err == nil {
+			return n
+		}
+	case strings.HasPrefix(name, ".ctors."):
+		if n, err := strconv.Atoi(name[len(".ctors."):]); err == nil {
+			return 65535 - n
+		}
+	}
+	return 65536
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bufio"
+	"cmd/internal/objabi"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Interposition support for -buildmode=c-archive and c-shared.
+//
+// When a Go archive or shared library is linked into a C program, the
+// references from Go code to symbols defined outside the Go object
+// (libc functions imported by cgo, and symbols left for the host
+// linker to resolve) should be preemptible, so that a preloaded
+// library can interpose on them. References made through the PLT or
+// GOT, or through an absolute address that the dynamic linker fills
+// in, stay preemptible. A direct PC-relative reference is bound at
+// link time and cannot be interposed.
+//
+// The -interpose flag makes the linker route all calls to such
+// symbols through the PLT and stops passing -Bsymbolic to the host
+// linker. The -interposereport flag writes out every such reference
+// and how it is bound.
+
+// An interposeRef is a reference from Go code to a symbol outside the
+// Go object.
+type interposeRef struct {
+	targ    string
+	binding string
+	from    string
+	off     int32
+	rtype   string
+	typ     sym.SymKind
+}
+
+// interposeBinding reports how the reference r is bound:
+// "plt", "got", "abs", or "direct" if it cannot be interposed.
+func interposeBinding(ctxt *Link, ldr *loader.Loader, r loader.Reloc) string {
+	rt := r.Type()
+	switch {
+	case rt.IsDirectCall():
+		if t := ldr.SymType(r.Sym()); ctxt.IsAMD64() && t != sym.SDYNIMPORT && !(*FlagInterpose && t == sym.SUNDEFEXT) {
+			// Calls to other symbols use R_X86_64_PC32, see
+			// amd64.elfreloc1.
+			return "direct"
+		}
+		return "plt"
+	case rt == objabi.R_PCREL:
+		if ctxt.IsAMD64() && ldr.SymType(r.Sym()) == sym.SDYNIMPORT && ldr.SymElfType(r.Sym()) == elf.STT_FUNC {
+			return "plt"
+		}
+	case rt == objabi.R_ADDR:
+		return "abs"
+	case rt == objabi.R_GOTPCREL, rt == objabi.R_ARM64_GOTPCREL, rt == objabi.R_ARM64_GOT, rt == objabi.R_ADDRPOWER_GOT:
+		return "got"
+	}
+	return "direct"
+}
+
+// isInterposeTarget reports whether s is defined outside the Go object.
+func isInterposeTarget(ldr *loader.Loader, s loader.Sym) bool {
+	switch ldr.SymType(s) {
+	case sym.SDYNIMPORT, sym.SUNDEFEXT, sym.SHOSTOBJ:
+		return true
+	}
+	return false
+}
+
+// interposeRefs collects the references from reachable Go symbols to
+// symbols defined outside the Go object.
+func (ctxt *Link) interposeRefs() []interposeRef {
+	ldr := ctxt.loader
+	var refs []interposeRef
+	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+		if !ldr.AttrReachable(s) || isInterposeTarget(ldr, s) {
+			continue
+		}
+		relocs := ldr.Relocs(s)
+		for ri := 0; ri < relocs.Count(); ri++ {
+			r := relocs.At(ri)
+			rs := r.Sym()
+			if rs == 0 || r.Siz() == 0 || !isInterposeTarget(ldr, rs) {
+				continue
+			}
+			refs = append(refs, interposeRef{
+				targ:    ldr.SymExtname(rs),
+				binding: interposeBinding(ctxt, ldr, r),
+				from:    ldr.SymName(s),
+				off:     r.Off(),
+				rtype:   sym.RelocName(ctxt.Arch, r.Type()),
+				typ:     ldr.SymType(rs),
+			})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].targ != refs[j].targ {
+			return refs[i].targ < refs[j].targ
+		}
+		if refs[i].from != refs[j].from {
+			return refs[i].from < refs[j].from
+		}
+		return refs[i].off < refs[j].off
+	})
+	return refs
+}
+
+// interpose checks, for -interpose, that every reference to a symbol
+// in a host library remains preemptible, and writes the
+// -interposereport file if requested.
+func (ctxt *Link) interpose() {
+	refs := ctxt.interposeRefs()
+
+	if *FlagInterpose {
+		for _, f := range flagExtldflags {
+			if strings.Contains(f, "-Bsymbolic") {
+				Errorf(nil, "-interpose conflicts with %s in -extldflags", f)
+			}
+		}
+		for _, r := range refs {
+			// Host objects are part of the archive or shared
+			// library itself; only symbols from host libraries
+			// need to stay preemptible.
+			if r.binding == "direct" && r.typ != sym.SHOSTOBJ {
+				Errorf(nil, "-interpose: reference to %s from %s+%#x (%s) cannot be interposed", r.targ, r.from, r.off, r.rtype)
+			}
+		}
+	}
+
+	if *flagInterposeReport == "" {
+		return
+	}
+	f, err := os.Create(*flagInterposeReport)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "# symbol\tbinding\treference\n")
+	for _, r := range refs {
+		fmt.Fprintf(w, "%s\t%s\t%s+%#x (%s)\n", r.targ, r.binding, r.from, r.off, r.rtype)
+	}
+	if err := w.Flush(); err != nil {
+		Exitf("%v", err)
+	}
+	if err := f.Close(); err != nil {
+		Exitf("%v", err)
+	}
+}
@@ -269,3 +269,34 @@ func PrepareAddmoduledata(ctxt *Link) (*loader.SymbolBuilder, loader.Sym) {
 
 	return initfunc, amd
 }
+
+// PrepareSelfReloc returns a symbol builder that target-specific code
+// can use to build up the linker-generated go.link.selfreloc function
+// of a -static-pie executable, which becomes its entry point. With
+// no dynamic linker to load it, the executable applies its own
+// relative relocations: the function computes the load bias as the
+// runtime address of the returned zero symbol, whose link-time address
+// is 0, finds the relocations through the _DYNAMIC array, applies them,
+// and jumps to the returned original entry point. If the executable
+// is not a static PIE the returned builder will be nil.
+func PrepareSelfReloc(ctxt *Link) (sr *loader.SymbolBuilder, zero, entry loader.Sym) {
+	if !*flagStaticPIE || ctxt.LinkMode != LinkInternal {
+		return nil, 0, 0
+	}
+	ldr := ctxt.loader
+	entry = ldr.Lookup(*flagEntrySymbol, sym.SymVerABI0)
+	if entry == 0 {
+		Exitf("-static-pie: entry symbol %s not defined", *flagEntrySymbol)
+	}
+	zero = ctxt.xdefine("go.link.zero", sym.SRODATA, 0)
+	ldr.SetAttrNotInSymbolTable(zero, true)
+
+	s := ldr.LookupOrCreateSym("go.link.selfreloc", 0)
+	sr = ldr.MakeSymbolUpdater(s)
+	ldr.SetAttrReachable(s, true)
+	ldr.SetAttrLocal(s, true)
+	sr.SetType(sym.STEXT)
+	ctxt.Textp = append(ctxt.Textp, s)
+	*flagEntrySymbol = "go.link.selfreloc"
+	return sr, zero, entry
+}
@@ -35,11 +35,12 @@ func TestUndefinedRelocErrors(t *testing.T) {
 		// Main function has dedicated error message.
 		"function main is undeclared in the main package": 1,
 
-		// Single error reporting per each symbol.
-		// This way, duplicated messages are not reported for
-		// multiple relocations with a same name.
-		"main.defined1: relocation target main.undefined not defined": 1,
-		"main.defined2: relocation target main.undefined not defined": 1,
+		// The undefined symbols are reported together, each
+		// once for each package referring to it, with the symbols
+		// referring to it.
+		"undefined symbols:": 1,
+		"\tmain:":            1,
+		"\t\tmain.undefined, referenced by main.defined1, main.defined2": 1,
 	}
 	unexpectedErrors := map[string]int{}
 
@@ -342,3 +343,49 @@ func main() {
 		})
 	}
 }
+
+func TestDumpReloc(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+	t.Parallel()
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(src, []byte("package main\nvar X = &Y\nvar Y int\nfunc main() { println(X) }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Link twice and check that the output is the same, so that it
+	// can be compared across links.
+	var dumps [2][]byte
+	for i := range dumps {
+		dump := filepath.Join(dir, fmt.Sprintf("reloc%d.txt", i))
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(dir, "x.exe"), "-ldflags=-linkmode=external -dumpreloc="+dump, src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %v:\n%s", cmd.Args, err, out)
+		}
+		b, err := ioutil.ReadFile(dump)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumps[i] = b
+	}
+	if !bytes.Equal(dumps[0], dumps[1]) {
+		t.Errorf("-dumpreloc output differs between links")
+	}
+
+	// The pointer in main.X must be relocated against main.Y.
+	found := false
+	for _, line := range strings.Split(string(dumps[0]), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) == 5 && f[1] == "main.X+0x0" {
+			if f[2] != "main.Y+0" || f[3] != "R_ADDR" || f[4] == "" {
+				t.Errorf("unexpected relocation for main.X: %q", line)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no relocation for main.X in -dumpreloc output:\n%s", dumps[0])
+	}
+}
@@ -57,8 +57,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"text/tabwriter"
 )
 
 // Data layout and relocation.
@@ -114,6 +116,7 @@ type ArchSyms struct {
 
 	Tlsg      loader.Sym
 	Tlsoffset int
+	Tlsalign  int64 // alignment of a TLS block with host variables
 
 	Dynamic loader.Sym
 	DynSym  loader.Sym
@@ -585,12 +588,16 @@ func (ctxt *Link) loadlib() {
 			ldshlibsyms(ctxt, lib.Shlib)
 		}
 	}
+	ctxt.checkShlibFingerprints()
 
 	// Process cgo directives (has to be done before host object loading).
 	ctxt.loadcgodirectives()
 
 	// Conditionally load host objects, or setup for external linking.
 	hostobjs(ctxt)
+	if ctxt.LinkMode == LinkInternal {
+		ctxt.loadWholeArchives()
+	}
 	hostlinksetup(ctxt)
 
 	if ctxt.LinkMode == LinkInternal && len(hostobj) != 0 {
@@ -613,15 +620,15 @@ func (ctxt *Link) loadlib() {
 			}
 			if ctxt.HeadType == objabi.Hwindows {
 				if p := ctxt.findLibPath("libmingwex.a"); p != "none" {
-					hostArchive(ctxt, p)
+					hostArchive(ctxt, p, false)
 				}
 				if p := ctxt.findLibPath("libmingw32.a"); p != "none" {
-					hostArchive(ctxt, p)
+					hostArchive(ctxt, p, false)
 				}
 				// Link libmsvcrt.a to resolve '__acrt_iob_func' symbol
 				// (see https://golang.org/issue/23649 for details).
 				if p := ctxt.findLibPath("libmsvcrt.a"); p != "none" {
-					hostArchive(ctxt, p)
+					hostArchive(ctxt, p, false)
 				}
 				// TODO: maybe do something similar to peimporteddlls to collect all lib names
 				// and try link them all to final exe just like libmingwex.a and libmingw32.a:
@@ -633,11 +640,13 @@ func (ctxt *Link) loadlib() {
 				*/
 			}
 			if *flagLibGCC != "none" {
-				hostArchive(ctxt, *flagLibGCC)
+				hostArchive(ctxt, *flagLibGCC, false)
 			}
 		}
 	}
 
+	ctxt.resolveWeakUndefs()
+
 	// We've loaded all the code now.
 	ctxt.Loaded = true
 
@@ -715,10 +724,29 @@ func (ctxt *Link) linksetup() {
 	// statically linked binaries.
 	if ctxt.BuildMode == BuildModeExe {
 		if havedynamic == 0 && ctxt.HeadType != objabi.Hdarwin && ctxt.HeadType != objabi.Hsolaris {
+			if *flagInterpreter != "" {
+				Exitf("-interp cannot be used with a statically linked program: it has no program interpreter")
+			}
 			*FlagD = true
 		}
 	}
 
+	// An internally linked static PIE relocates itself and so cannot
+	// have anything for a dynamic linker to do, nor relocations in
+	// the packed format. An externally linked one is started by the C
+	// library, which sets up thread-local storage for its own variables
+	// too, so the runtime must leave it to runtime/cgo.
+	if *flagStaticPIE {
+		switch {
+		case ctxt.LinkMode == LinkInternal && havedynamic != 0:
+			Exitf("-static-pie cannot be linked internally with dynamic imports; use -linkmode=external")
+		case ctxt.LinkMode == LinkInternal && *flagPackRelocs:
+			Exitf("-static-pie cannot be linked internally with -pack-relative-relocs")
+		case ctxt.LinkMode == LinkExternal && !iscgo:
+			Exitf("-static-pie cannot be linked externally without cgo; use -linkmode=internal")
+		}
+	}
+
 	if ctxt.LinkMode == LinkExternal && ctxt.Arch.Family == sys.PPC64 && buildcfg.GOOS != "aix" {
 		toc := ctxt.loader.LookupOrCreateSym(".TOC.", 0)
 		sb := ctxt.loader.MakeSymbolUpdater(toc)
@@ -791,8 +819,14 @@ func (ctxt *Link) linksetup() {
 		ctxt.loader.SetAttrLocal(moduledata, true)
 	}
 	// In all cases way we mark the moduledata as noptrdata to hide it from
-	// the GC.
-	mdsb.SetType(sym.SNOPTRDATA)
+	// the GC. With -guard-moduledata it is read-only data instead, put
+	// with the tables it describes, which makes it relro data when
+	// building a shared object.
+	if *flagGuardModData {
+		mdsb.SetType(sym.SRODATA)
+	} else {
+		mdsb.SetType(sym.SNOPTRDATA)
+	}
 	ctxt.loader.SetAttrReachable(moduledata, true)
 	ctxt.Moduledata = moduledata
 
@@ -997,6 +1031,12 @@ func loadobjfile(ctxt *Link, lib *sym.Library) {
 
 		pname := fmt.Sprintf("%s(%s)", lib.File, arhdr.name)
 		l = atolwhex(arhdr.size)
+		if ok, targets := sysoSelected(arhdr.name); !ok {
+			if ctxt.Debugvlog != 0 {
+				ctxt.Logf("skipping %s, built for %s\n", pname, targets)
+			}
+			continue
+		}
 		ldobj(ctxt, f, lib, l, pname, lib.File)
 	}
 }
@@ -1008,6 +1048,7 @@ type Hostobj struct {
 	file   string
 	off    int64
 	length int64
+	lto    string // what the object holds, if it is compiled for link-time optimization
 }
 
 var hostobj []Hostobj
@@ -1051,6 +1092,9 @@ func ldhostobj(ld func(*Link, *bio.Reader, string, int64, string), headType obja
 
 	hostobj = append(hostobj, Hostobj{})
 	h := &hostobj[len(hostobj)-1]
+	if ld != nil {
+		ld = recordHostObjSyms(ld)
+	}
 	h.ld = ld
 	h.pkg = pkg
 	h.pn = pn
@@ -1205,6 +1249,10 @@ func (ctxt *Link) archive() {
 		Exitf("error closing %v", *flagOutfile)
 	}
 
+	if ctxt.IsELF && !*flagSkipPICCheck {
+		ctxt.checkArchivePIC(filepath.Join(*flagTmpdir, "go.o"))
+	}
+
 	argv := []string{*flagExtar, "-q", "-c", "-s"}
 	if ctxt.HeadType == objabi.Haix {
 		argv = append(argv, "-X64")
@@ -1246,7 +1294,10 @@ func (ctxt *Link) hostlink() {
 	argv = append(argv, ctxt.extld()...)
 	argv = append(argv, hostlinkArchArgs(ctxt.Arch)...)
 
-	if *FlagS || debug_s {
+	// The host linker's -s drops the DWARF as well as the symbol
+	// table. With -strip=symtab alone, the symbol table is removed
+	// from the output afterwards instead.
+	if (*FlagS || debug_s) && *FlagW {
 		if ctxt.HeadType == objabi.Hdarwin {
 			// Recent versions of macOS print
 			//	ld: warning: option -s is obsolete and being ignored
@@ -1335,7 +1386,11 @@ func (ctxt *Link) hostlink() {
 			if ctxt.UseRelro() {
 				argv = append(argv, "-Wl,-z,relro")
 			}
-			argv = append(argv, "-pie")
+			if *flagStaticPIE {
+				argv = append(argv, "-static-pie")
+			} else {
+				argv = append(argv, "-pie")
+			}
 		}
 	case BuildModeCShared:
 		if ctxt.HeadType == objabi.Hdarwin {
@@ -1353,8 +1408,15 @@ func (ctxt *Link) hostlink() {
 				// Pass -z nodelete to mark the shared library as
 				// non-closeable: a dlclose will do nothing.
 				argv = append(argv, "-Wl,-z,nodelete")
-				// Only pass Bsymbolic on non-Windows.
-				argv = append(argv, "-Wl,-Bsymbolic")
+				// Only pass Bsymbolic on non-Windows, and not with
+				// -interpose, which needs references to symbols
+				// defined in the library to stay preemptible.
+				if !*FlagInterpose {
+					argv = append(argv, "-Wl,-Bsymbolic")
+				}
+				if *flagExportSymbols != "" {
+					argv = append(argv, "-Wl,--version-script="+ctxt.exportSymbolsScript())
+				}
 			}
 		}
 	case BuildModeShared:
@@ -1435,6 +1497,10 @@ func (ctxt *Link) hostlink() {
 	if ctxt.IsELF && len(buildinfo) > 0 {
 		argv = append(argv, fmt.Sprintf("-Wl,--build-id=0x%x", buildinfo))
 	}
+	if *flagEHFrame {
+		// Build the .eh_frame_hdr of the Go and C functions.
+		argv = append(argv, "-Wl,--eh-frame-hdr")
+	}
 
 	// On Windows, given -o foo, GCC will append ".exe" to produce
 	// "foo.exe".  We have decided that we want to honor the -o
@@ -1452,6 +1518,9 @@ func (ctxt *Link) hostlink() {
 	if rpath.val != "" {
 		argv = append(argv, fmt.Sprintf("-Wl,-rpath,%s", rpath.val))
 	}
+	if *flagSoname != "" {
+		argv = append(argv, "-Wl,-soname,"+*flagSoname)
+	}
 
 	if *flagInterpreter != "" {
 		// Many linkers support both -I and the --dynamic-linker flags
@@ -1464,6 +1533,9 @@ func (ctxt *Link) hostlink() {
 	// Force global symbols to be exported for dlopen, etc.
 	if ctxt.IsELF {
 		argv = append(argv, "-rdynamic")
+		if *flagExportSymbols != "" && (ctxt.BuildMode == BuildModeExe || ctxt.BuildMode == BuildModePIE) {
+			argv = append(argv, "-Wl,--version-script="+ctxt.exportSymbolsScript())
+		}
 	}
 	if ctxt.HeadType == objabi.Haix {
 		fileName := xcoffCreateExportFile(ctxt)
@@ -1476,10 +1548,48 @@ func (ctxt *Link) hostlink() {
 	}
 
 	const compressDWARF = "-Wl,--compress-debug-sections=zlib-gnu"
-	if ctxt.compressDWARF && linkerFlagSupported(ctxt.Arch, argv[0], altLinker, compressDWARF) {
+	const compressDWARFZstd = "-Wl,--compress-debug-sections=zstd"
+	switch {
+	case ctxt.compressDWARF == dwarfCompressNone:
+	case ctxt.compressDWARF == dwarfCompressZstd && linkerFlagSupported(ctxt.Arch, argv[0], altLinker, compressDWARFZstd):
+		argv = append(argv, compressDWARFZstd)
+	case linkerFlagSupported(ctxt.Arch, argv[0], altLinker, compressDWARF):
+		// Older linkers do not support zstd, so fall back to zlib.
 		argv = append(argv, compressDWARF)
 	}
 
+	const packRelocs = "-Wl,-z,pack-relative-relocs"
+	if *flagPackRelocs && ctxt.IsELF && linkerFlagSupported(ctxt.Arch, argv[0], altLinker, packRelocs) {
+		argv = append(argv, packRelocs)
+	}
+	if *flagBindNow && ctxt.IsELF {
+		argv = append(argv, "-Wl,-z,now")
+	}
+	if *flagHashStyle != "" && ctxt.IsELF {
+		argv = append(argv, "-Wl,--hash-style="+*flagHashStyle)
+	}
+	if ctxt.IsELF {
+		switch *flagUnresolved {
+		case "warn":
+			argv = append(argv, "-Wl,--warn-unresolved-symbols")
+		case "ignore":
+			argv = append(argv, "-Wl,--unresolved-symbols=ignore-all")
+		}
+	}
+	if *flagEmitReloc && ctxt.IsELF {
+		argv = append(argv, "-Wl,--emit-relocs")
+	}
+	if *flagTextAlign != 0 && ctxt.IsELF {
+		argv = append(argv, fmt.Sprintf("-Wl,-z,max-page-size=%#x", *flagTextAlign))
+	}
+	const separateCode = "-Wl,-z,separate-code"
+	if *flagSeparateCode && ctxt.IsELF {
+		if !linkerFlagSupported(ctxt.Arch, argv[0], altLinker, separateCode) {
+			Exitf("-separate-code: the external linker does not support -z separate-code")
+		}
+		argv = append(argv, separateCode)
+	}
+
 	argv = append(argv, filepath.Join(*flagTmpdir, "go.o"))
 	argv = append(argv, hostobjCopy()...)
 	if ctxt.HeadType == objabi.Haix {
@@ -1553,7 +1663,7 @@ func (ctxt *Link) hostlink() {
 		}
 	}
 
-	for _, p := range ldflag {
+	for _, p := range ctxt.wholeArchiveArgs(ldflag) {
 		argv = append(argv, p)
 		checkStatic(p)
 	}
@@ -1614,7 +1724,18 @@ func (ctxt *Link) hostlink() {
 		ctxt.Logf("\n")
 	}
 
+	// The tools run after the external linker are found while it runs.
+	var dsymutilc, stripc <-chan hostProg
+	if combineDwarf {
+		dsymutilc = ctxt.findHostProg("dsymutil")
+		stripc = ctxt.findHostProg("strip")
+	}
+
+	argv = hostlinkResponseFile(argv, len(ctxt.extld()))
+
+	end := ctxt.bench.Sub("run " + filepath.Base(argv[0]))
 	out, err := exec.Command(argv[0], argv[1:]...).CombinedOutput()
+	end()
 	if err != nil {
 		Exitf("running %s failed: %v\n%s", argv[0], err, out)
 	}
@@ -1651,33 +1772,21 @@ func (ctxt *Link) hostlink() {
 	}
 
 	if combineDwarf {
-		// Find "dsymutils" and "strip" tools using CC --print-prog-name.
-		var cc []string
-		cc = append(cc, ctxt.extld()...)
-		cc = append(cc, hostlinkArchArgs(ctxt.Arch)...)
-		cc = append(cc, "--print-prog-name", "dsymutil")
-		out, err := exec.Command(cc[0], cc[1:]...).CombinedOutput()
-		if err != nil {
-			Exitf("%s: finding dsymutil failed: %v\n%s", os.Args[0], err, out)
-		}
-		dsymutilCmd := strings.TrimSuffix(string(out), "\n")
-
-		cc[len(cc)-1] = "strip"
-		out, err = exec.Command(cc[0], cc[1:]...).CombinedOutput()
-		if err != nil {
-			Exitf("%s: finding strip failed: %v\n%s", os.Args[0], err, out)
-		}
-		stripCmd := strings.TrimSuffix(string(out), "\n")
-
+		dsymutil := (<-dsymutilc).path("dsymutil")
 		dsym := filepath.Join(*flagTmpdir, "go.dwarf")
-		if out, err := exec.Command(dsymutilCmd, "-f", *flagOutfile, "-o", dsym).CombinedOutput(); err != nil {
+		end := ctxt.bench.Sub("run dsymutil")
+		if out, err := exec.Command(dsymutil, "-f", *flagOutfile, "-o", dsym).CombinedOutput(); err != nil {
 			Exitf("%s: running dsymutil failed: %v\n%s", os.Args[0], err, out)
 		}
+		end()
 		// Remove STAB (symbolic debugging) symbols after we are done with them (by dsymutil).
 		// They contain temporary file paths and make the build not reproducible.
-		if out, err := exec.Command(stripCmd, "-S", *flagOutfile).CombinedOutput(); err != nil {
+		strip := (<-stripc).path("strip")
+		end = ctxt.bench.Sub("run strip")
+		if out, err := exec.Command(strip, "-S", *flagOutfile).CombinedOutput(); err != nil {
 			Exitf("%s: running strip failed: %v\n%s", os.Args[0], err, out)
 		}
+		end()
 		// Skip combining if `dsymutil` didn't generate a file. See #11994.
 		if _, err := os.Stat(dsym); os.IsNotExist(err) {
 			return
@@ -1701,6 +1810,27 @@ func (ctxt *Link) hostlink() {
 			Exitf("%s: %v", os.Args[0], err)
 		}
 	}
+	if ctxt.IsELF && !*flagSkipExtCheck {
+		ctxt.checkHostlinkOutput(filepath.Join(*flagTmpdir, "go.o"), *flagOutfile)
+	}
+	ctxt.lintExports(*flagOutfile)
+	// The relocations kept by -emitreloc refer to the symbols of the
+	// host linker's symbol table by index, so leave it alone.
+	if ctxt.IsELF && !debug_s && !*flagEmitReloc {
+		if err := elfRewriteSymtab(filepath.Join(*flagTmpdir, "go.o"), *flagOutfile, ctxt.strip&stripLocals != 0); err != nil {
+			Exitf("%s: rewriting symbol table failed: %v", os.Args[0], err)
+		}
+	}
+	if ctxt.IsELF && debug_s && !*FlagW && ctxt.strip&stripSections == 0 {
+		if err := elfStripSymtab(*flagOutfile); err != nil {
+			Exitf("%s: stripping symbol table failed: %v", os.Args[0], err)
+		}
+	}
+	if ctxt.IsELF && ctxt.strip&stripSections != 0 {
+		if err := elfStripSections(*flagOutfile); err != nil {
+			Exitf("%s: stripping sections failed: %v", os.Args[0], err)
+		}
+	}
 	if ctxt.NeedCodeSign() {
 		err := machoCodeSign(ctxt, *flagOutfile)
 		if err != nil {
@@ -1709,6 +1839,93 @@ func (ctxt *Link) hostlink() {
 	}
 }
 
+// A hostProg is the result of looking up a program of the external
+// toolchain.
+type hostProg struct {
+	cmd string
+	out []byte
+	err error
+}
+
+// findHostProg looks up the program prog of the external toolchain
+// with the external linker's --print-prog-name, in the background.
+func (ctxt *Link) findHostProg(prog string) <-chan hostProg {
+	var cc []string
+	cc = append(cc, ctxt.extld()...)
+	cc = append(cc, hostlinkArchArgs(ctxt.Arch)...)
+	cc = append(cc, "--print-prog-name", prog)
+	c := make(chan hostProg, 1)
+	go func() {
+		out, err := exec.Command(cc[0], cc[1:]...).CombinedOutput()
+		c <- hostProg{strings.TrimSuffix(string(out), "\n"), out, err}
+	}()
+	return c
+}
+
+// path returns the path of the program prog found by findHostProg, or
+// exits if it was not found.
+func (p hostProg) path(prog string) string {
+	if p.err != nil {
+		Exitf("%s: finding %s failed: %v\n%s", os.Args[0], prog, p.err, p.out)
+	}
+	return p.cmd
+}
+
+// maxHostlinkArgLen is the length of the arguments of the external
+// linker past which they are passed in a response file. Windows limits
+// a command line to 32 KB. Other systems allow more, but the arguments
+// share the limit with the environment, which ulimit may lower.
+const maxHostlinkArgLen = 30 << 10
+
+// hostlinkResponseFile returns argv if its arguments are short enough,
+// and otherwise replaces all but the first keep, the command running
+// the external linker, with @file, naming a response file in the
+// temporary directory that holds them. -debugarglen lowers the limit.
+func hostlinkResponseFile(argv []string, keep int) []string {
+	limit := maxHostlinkArgLen
+	if *flagDebugArgLen > 0 {
+		limit = *flagDebugArgLen
+	}
+	n := 0
+	for _, arg := range argv {
+		n += len(arg) + 1
+	}
+	if n <= limit {
+		return argv
+	}
+	var buf bytes.Buffer
+	for _, arg := range argv[keep:] {
+		buf.WriteString(responseFileQuote(arg))
+		buf.WriteByte('\n')
+	}
+	path := filepath.Join(*flagTmpdir, "hostlink.rsp")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		Exitf("writing response file: %v", err)
+	}
+	return append(argv[:keep:keep], "@"+path)
+}
+
+// responseFileQuote quotes arg for a response file of GCC or Clang,
+// which split it at white space, unless quoted or escaped by a
+// backslash, which also escapes quotes and itself.
+func responseFileQuote(arg string) string {
+	const special = " \t\n\v\f\r'\"\\"
+	if arg == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(arg, special) {
+		return arg
+	}
+	var b strings.Builder
+	for _, r := range arg {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 var createTrivialCOnce sync.Once
 
 func linkerFlagSupported(arch *sys.Arch, linker, altLinker, flag string) bool {
@@ -1820,6 +2037,83 @@ func hostlinkArchArgs(arch *sys.Arch) []string {
 
 var wantHdr = objabi.HeaderString()
 
+// splitHeader splits the object header line into the part naming the
+// target and toolchain version and the list of enabled experiments.
+func splitHeader(line string) (base, exp string) {
+	line = strings.TrimSuffix(line, "\n")
+	if i := strings.Index(line, " X:"); i >= 0 {
+		return line[:i], line[i+len(" X:"):]
+	}
+	return line, ""
+}
+
+// checkExperiments checks that all packages were compiled with the
+// same GOEXPERIMENT settings as the main package, and the linker
+// itself. Mixing them produces programs that crash in obscure ways.
+func (ctxt *Link) checkExperiments() {
+	if *flagIgnoreExp || len(ctxt.Library) == 0 {
+		return
+	}
+	mainlib := ctxt.Library[0]
+	want, ok := ctxt.experiments[mainlib]
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	bad := false
+	if _, exp := splitHeader(wantHdr); exp != want {
+		fmt.Fprintf(w, "\t%s\t%s\n", "(linker)", experimentDiff(exp, want))
+		bad = true
+	}
+	libs := append([]*sym.Library(nil), ctxt.Library...)
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Pkg < libs[j].Pkg })
+	for _, lib := range libs {
+		exp, ok := ctxt.experiments[lib]
+		if ok && exp != want {
+			fmt.Fprintf(w, "\t%s\t%s\n", lib.Pkg, experimentDiff(exp, want))
+			bad = true
+		}
+	}
+	if !bad {
+		return
+	}
+	w.Flush()
+	Exitf("packages built with different GOEXPERIMENT settings than package %s (X:%s):\n%s(use -ignore-experiment-mismatch to link anyway)", mainlib.Pkg, want, buf.String())
+}
+
+// experimentDiff returns the experiments that differ between the
+// comma-separated lists of enabled experiments have and want, as
+// enabled ("name") or disabled ("noname") in have.
+func experimentDiff(have, want string) string {
+	set := func(s string) map[string]bool {
+		m := make(map[string]bool)
+		for _, name := range strings.Split(s, ",") {
+			if name != "" {
+				m[name] = true
+			}
+		}
+		return m
+	}
+	h, w := set(have), set(want)
+	var diff []string
+	for name := range h {
+		if !w[name] {
+			diff = append(diff, name)
+		}
+	}
+	for name := range w {
+		if !h[name] {
+			diff = append(diff, "no"+name)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return strings.TrimPrefix(diff[i], "no") < strings.TrimPrefix(diff[j], "no")
+	})
+	return strings.Join(diff, ",")
+}
+
 // ldobj loads an input object. If it is a host object (an object
 // compiled by a non-Go compiler) it returns the Hostobj pointer. If
 // it is a Go object, it returns nil.
@@ -1838,15 +2132,36 @@ func ldobj(ctxt *Link, f *bio.Reader, lib *sym.Library, length int64, pn string,
 	lib.Units = append(lib.Units, unit)
 
 	magic := uint32(c1)<<24 | uint32(c2)<<16 | uint32(c3)<<8 | uint32(c4)
+	if kind := ltoObjKind(f, length, magic); kind != "" {
+		// Only the external linker can link it.
+		if ltoObj == "" {
+			ltoObj, ltoKind = pn, kind
+		}
+		h := ldhostobj(nil, ctxt.HeadType, f, pkg, length, pn, file)
+		h.lto = kind
+		return h
+	}
+
 	if magic == 0x7f454c46 { // \x7F E L F
 		ldelf := func(ctxt *Link, f *bio.Reader, pkg string, length int64, pn string) {
-			textp, flags, err := loadelf.Load(ctxt.loader, ctxt.Arch, ctxt.IncVersion(), f, pkg, length, pn, ehdr.Flags)
+			textp, flags, wx, features, attrs, err := loadelf.Load(ctxt.loader, ctxt.Arch, ctxt.IncVersion(), f, pkg, length, pn, ehdr.Flags)
+			if dup, ok := err.(*loadelf.DupSymError); ok {
+				reportDupSym(ctxt, dup)
+				return
+			}
 			if err != nil {
 				Errorf(nil, "%v", err)
 				return
 			}
 			ehdr.Flags = flags
+			// The output only supports the features that all of
+			// its objects support.
+			gnuFeatures &= features
+			if attrs != nil {
+				ctxt.HostAttrs = append(ctxt.HostAttrs, HostAttrs{Pn: pn, Attrs: *attrs})
+			}
 			ctxt.Textp = append(ctxt.Textp, textp...)
+			ctxt.wxsects = append(ctxt.wxsects, wx...)
 		}
 		return ldhostobj(ldelf, ctxt.HeadType, f, pkg, length, pn, file)
 	}
@@ -1926,8 +2241,15 @@ func ldobj(ctxt *Link, f *bio.Reader, lib *sym.Library, length int64, pn string,
 	}
 
 	// First, check that the basic GOOS, GOARCH, and Version match.
-	if line != wantHdr {
+	// The experiments are compared across all packages once they are
+	// loaded, see checkExperiments.
+	base, exp := splitHeader(line)
+	if wantBase, _ := splitHeader(wantHdr); base != wantBase {
 		Errorf(nil, "%s: linked object header mismatch:\nhave %q\nwant %q\n", pn, line, wantHdr)
+	} else if _, ok := ctxt.experiments[lib]; !ok {
+		ctxt.experiments[lib] = exp
+	} else if ctxt.experiments[lib] != exp {
+		Errorf(nil, "%s: object built with GOEXPERIMENT settings X:%s, other objects of package %s with X:%s", pn, exp, lib.Pkg, ctxt.experiments[lib])
 	}
 
 	// Skip over exports and other info -- ends with \n!\n.
@@ -2124,6 +2446,17 @@ func ldshlibsyms(ctxt *Link, shlib string) {
 		deps = append(deps, dep)
 	}
 
+	var pkgHashes map[string]goobj.FingerprintType
+	if data, err := readnote(f, ELF_NOTE_GO_NAME, ELF_NOTE_GOPKGHASHES_TAG); err != nil {
+		Errorf(nil, "cannot read package fingerprints from shared library %s: %v", libpath, err)
+		return
+	} else if data != nil {
+		if pkgHashes, err = parseShlibPkgHashes(data); err != nil {
+			Errorf(nil, "cannot read package fingerprints from shared library %s: %v", libpath, err)
+			return
+		}
+	}
+
 	syms, err := f.DynamicSymbols()
 	if err != nil {
 		Errorf(nil, "cannot read symbols from shared library: %s", libpath)
@@ -2182,7 +2515,7 @@ func ldshlibsyms(ctxt *Link, shlib string) {
 			l.SetSymExtname(s, elfsym.Name)
 		}
 	}
-	ctxt.Shlibs = append(ctxt.Shlibs, Shlib{Path: libpath, Hash: hash, Deps: deps, File: f})
+	ctxt.Shlibs = append(ctxt.Shlibs, Shlib{Path: libpath, Hash: hash, Deps: deps, File: f, PkgHashes: pkgHashes})
 }
 
 func addsection(ldr *loader.Loader, arch *sys.Arch, seg *sym.Segment, name string, rwx int) *sym.Section {
@@ -2574,6 +2907,24 @@ func AddGotSym(target *Target, ldr *loader.Loader, syms *ArchSyms, s loader.Sym,
 		return
 	}
 
+	if ldr.AttrUndefZero(s) {
+		// An undefined symbol given address 0 by resolveUndef:
+		// the entry is 0 and needs no dynamic relocation.
+		got := ldr.MakeSymbolUpdater(syms.GOT)
+		ldr.SetGot(s, int32(got.Size()))
+		got.AddUint(target.Arch, 0)
+		return
+	}
+
+	if *FlagD && target.IsElf() {
+		// A static executable has no dynamic linker to fill in
+		// the entry, so the linker does.
+		got := ldr.MakeSymbolUpdater(syms.GOT)
+		ldr.SetGot(s, int32(got.Size()))
+		got.AddAddrPlus(target.Arch, s, 0)
+		return
+	}
+
 	Adddynsym(ldr, target, syms, s)
 	got := ldr.MakeSymbolUpdater(syms.GOT)
 	ldr.SetGot(s, int32(got.Size()))
@@ -32,8 +32,10 @@ package ld
 
 import (
 	"bufio"
+	"cmd/internal/goobj"
 	"cmd/internal/objabi"
 	"cmd/internal/sys"
+	"cmd/link/internal/benchmark"
 	"cmd/link/internal/loader"
 	"cmd/link/internal/sym"
 	"debug/elf"
@@ -45,6 +47,10 @@ type Shlib struct {
 	Hash []byte
 	Deps []string
 	File *elf.File
+
+	// PkgHashes maps the packages of the library to their
+	// fingerprints. It is nil for libraries without the note.
+	PkgHashes map[string]goobj.FingerprintType
 }
 
 // Link holds the context for writing object code from a compiler
@@ -61,14 +67,21 @@ type Link struct {
 
 	Debugvlog int
 	Bso       *bufio.Writer
+	bench     *benchmark.Metrics // for the sub-phases of -tracefile
 
 	Loaded bool // set after all inputs have been loaded as symbols
 
-	compressDWARF bool
+	compressDWARF     dwarfCompression
+	compressDWARFLate bool // dwarfcompress left the compression to writeDWARF
+
+	strip stripMode // the parts of the output -strip leaves out
+
+	linkModeReason string // why determineLinkMode chose the link mode, for -print-config
 
 	Libdir       []string
 	Library      []*sym.Library
 	LibraryByPkg map[string]*sym.Library
+	pkghashes    map[*sym.Library][]byte // package hashes for plugin version checks
 	Shlibs       []Shlib
 	Textp        []loader.Sym
 	Moduledata   loader.Sym
@@ -87,8 +100,32 @@ type Link struct {
 	datap  []loader.Sym
 	dynexp []loader.Sym
 
+	cgoExports    []cgoExport // functions exported with //export, for lintExports
+	exportSymbols []string    // symbols listed in the -exportsymbols file
+
+	relocDump    *relocDumper // for -dumpreloc
+	gotRefs      gotRefs      // for -dumpgot
+	indirectRefs indirectRefs // for checkEarlyRelocs
+	typeImports  typeImports  // for -pluginhost
+	embedz       loader.Sym   // compressed go:embed data, for -compress-sections
+	embeds       loader.Sym   // where the runtime inflates embedz
+	wxsects      []loader.Sym // writable and executable host object sections, for -allow-wx
+	initArray    []loader.Sym // constructor sections of the host objects
+
+	HostAttrs []HostAttrs // processor-specific attributes of the host objects, in load order
+
+	wholeArchiveSyms []loader.Sym // symbols loaded from -wholearchive archives
+	deadcodeRoots    []loader.Sym // roots of the dead code pass, for -metadata
+	whyAlive         string       // the -whyalive report, printed at the end of the link
+
+	experiments map[*sym.Library]string // GOEXPERIMENT settings of the loaded packages
+
+	sectLayout     []*layoutSection // output sections described by -sectlayout
+	sectLayoutKeep []loader.Sym     // input sections kept by -sectlayout
+
 	// Elf symtab variables.
-	numelfsym int // starts at 0, 1 is reserved
+	numelfsym int    // starts at 0, 1 is reserved
+	elfFile   string // STT_FILE symbol to write before the next local symbol
 
 	// These are symbols that created and written by the linker.
 	// Rather than creating a symbol, and writing all its data into the heap,
@@ -0,0 +1,89 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+)
+
+// The layout of the output is made visible to the program through
+// go.link.<name>start and go.link.<name>size, which runtime/debug
+// declares as zeroed uintptr variables and reports with ReadLayout.
+// If they are reachable, the linker sets each start to the address of
+// the range, with a relocation like for any pointer, so that it accounts
+// for the load address of a position-independent executable, and each
+// size once the output is laid out. Each range is a single section of
+// the Go code, which an external linker may move but does not split.
+var linkLayoutRanges = []struct {
+	name       string
+	start, end string
+}{
+	{"text", "runtime.text", "runtime.etext"},
+	{"rodata", "runtime.rodata", "runtime.erodata"},
+	{"noptrdata", "runtime.noptrdata", "runtime.enoptrdata"},
+	{"data", "runtime.data", "runtime.edata"},
+	{"bss", "runtime.bss", "runtime.ebss"},
+	{"noptrbss", "runtime.noptrbss", "runtime.enoptrbss"},
+}
+
+// linkLayoutSym returns the layout variable name, or 0 if it is not
+// reachable or is not to be set.
+func (ctxt *Link) linkLayoutSym(name string) (s loader.Sym) {
+	if ctxt.DynlinkingGo() {
+		// The variables would only describe one of the modules.
+		return 0
+	}
+	ldr := ctxt.loader
+	s = ldr.Lookup(name, 0)
+	if s == 0 || !ldr.AttrReachable(s) {
+		return 0
+	}
+	if ldr.SymSize(s) != int64(ctxt.Arch.PtrSize) {
+		Errorf(nil, "%s: not a variable of type uintptr", name)
+		return 0
+	}
+	return s
+}
+
+// dolinklayout turns the reachable layout variables into data holding
+// the start of each range.
+func (ctxt *Link) dolinklayout() {
+	ldr := ctxt.loader
+	for _, r := range linkLayoutRanges {
+		for _, suffix := range []string{"start", "size"} {
+			s := ctxt.linkLayoutSym("go.link." + r.name + suffix)
+			if s == 0 {
+				continue
+			}
+			sb := ldr.MakeSymbolUpdater(s)
+			sb.SetType(sym.SNOPTRDATA)
+			sb.SetSize(0)
+			sb.SetData(make([]byte, 0, ctxt.Arch.PtrSize))
+			sb.SetReadOnly(false)
+			sb.ResetRelocs()
+			if suffix == "start" {
+				sb.AddAddrPlus(ctxt.Arch, ldr.LookupOrCreateSym(r.start, 0), 0)
+			} else {
+				sb.AddUint(ctxt.Arch, 0) // set by setlinklayout
+			}
+		}
+	}
+}
+
+// setlinklayout sets the size of each range in the layout variables,
+// once the output is laid out.
+func (ctxt *Link) setlinklayout() {
+	ldr := ctxt.loader
+	for _, r := range linkLayoutRanges {
+		s := ctxt.linkLayoutSym("go.link." + r.name + "size")
+		if s == 0 {
+			continue
+		}
+		start := ldr.SymValue(ldr.Lookup(r.start, 0))
+		end := ldr.SymValue(ldr.Lookup(r.end, 0))
+		ldr.MakeSymbolUpdater(s).SetUint(ctxt.Arch, 0, uint64(end-start))
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/bio"
+	"debug/elf"
+	"io"
+	"strings"
+)
+
+// Host objects compiled for link-time optimization, with clang -flto or
+// gcc -flto, hold the compiler's intermediate representation instead of
+// machine code: LLVM bitcode, possibly in a wrapper, or ELF objects
+// whose only contents are .gnu.lto_* or .llvm.lto sections. Only the
+// external linker, through its compiler plugin, can link them. The
+// objects compiled with -ffat-lto-objects also hold machine code, and
+// are loaded as usual.
+
+// ltoObj is the name of the first host object compiled for link-time
+// optimization, and ltoKind what it holds.
+var ltoObj, ltoKind string
+
+// ltoObjKind returns what the host object at the current offset of f,
+// of length bytes and starting with magic, holds if it is compiled for
+// link-time optimization, or "".
+func ltoObjKind(f *bio.Reader, length int64, magic uint32) string {
+	switch magic {
+	case 0x4243c0de: // BC\xC0\xDE
+		return "LLVM bitcode"
+	case 0xdec0170b: // 0x0B17C0DE, little endian
+		return "LLVM bitcode"
+	case 0x7f454c46: // \x7F E L F
+		ef, err := elf.NewFile(io.NewSectionReader(f.File(), f.Offset(), length))
+		if err != nil {
+			// Loading it reports the error.
+			return ""
+		}
+		kind := ""
+		for _, s := range ef.Sections {
+			switch {
+			case strings.HasPrefix(s.Name, ".gnu.lto_"):
+				kind = "GCC LTO bytecode"
+			case s.Name == ".llvm.lto" || s.Name == ".llvmbc":
+				kind = "LLVM bitcode"
+			case s.Flags&elf.SHF_ALLOC != 0 && s.Type != elf.SHT_NOTE && s.Size != 0:
+				// Machine code or data, as well.
+				return ""
+			}
+		}
+		return kind
+	}
+	return ""
+}
@@ -1226,9 +1226,13 @@ func machorelocsect(ctxt *Link, out *OutBuf, sect *sym.Section, syms []loader.Sy
 			if !ldr.AttrReachable(rr.Xsym) {
 				ldr.Errorf(s, "unreachable reloc %d (%s) target %v", r.Type(), sym.RelocName(ctxt.Arch, r.Type()), ldr.SymName(rr.Xsym))
 			}
+			off := out.Offset()
 			if !thearch.Machoreloc1(ctxt.Arch, out, ldr, s, rr, int64(uint64(ldr.SymValue(s)+int64(r.Off()))-sect.Vaddr)) {
 				ldr.Errorf(s, "unsupported obj reloc %d (%s)/%d to %s", r.Type(), sym.RelocName(ctxt.Arch, r.Type()), r.Siz(), ldr.SymName(r.Sym()))
 			}
+			if ctxt.relocDump != nil {
+				ctxt.relocDump.add(ctxt, sect, s, r, rr, out.bytesAt(off, out.Offset()-off))
+			}
 		}
 	}
 
@@ -1244,6 +1248,7 @@ func machoEmitReloc(ctxt *Link) {
 	}
 
 	sizeExtRelocs(ctxt, thearch.MachorelocSize)
+	defer ctxt.deferErrors()()
 	relocSect, wg := relocSectFn(ctxt, machorelocsect)
 
 	relocSect(ctxt, Segtext.Sections[0], ctxt.Textp)
@@ -112,6 +112,26 @@ func machoCombineDwarf(ctxt *Link, exef *os.File, exem *macho.File, dsym, outexe
 		return fmt.Errorf("missing __LINKEDIT segment")
 	}
 
+	realdwarf := dwarfm.Segment("__DWARF")
+	if realdwarf == nil {
+		return fmt.Errorf("missing __DWARF segment")
+	}
+
+	// Try to compress the DWARF sections, while the segments before
+	// the linkedit section are copied. This includes some Apple
+	// proprietary sections like __apple_types. The sections are read
+	// with ReadAt, which leaves the offset of dwarff alone.
+	type compressed struct {
+		sects []*macho.Section
+		bytes []byte
+		err   error
+	}
+	compressc := make(chan compressed, 1)
+	go func() {
+		sects, bytes, err := machoCompressSections(ctxt, dwarfm)
+		compressc <- compressed{sects, bytes, err}
+	}()
+
 	if _, err := exef.Seek(0, 0); err != nil {
 		return err
 	}
@@ -119,17 +139,11 @@ func machoCombineDwarf(ctxt *Link, exef *os.File, exem *macho.File, dsym, outexe
 		return err
 	}
 
-	realdwarf := dwarfm.Segment("__DWARF")
-	if realdwarf == nil {
-		return fmt.Errorf("missing __DWARF segment")
-	}
-
-	// Try to compress the DWARF sections. This includes some Apple
-	// proprietary sections like __apple_types.
-	compressedSects, compressedBytes, err := machoCompressSections(ctxt, dwarfm)
-	if err != nil {
-		return err
+	c := <-compressc
+	if c.err != nil {
+		return c.err
 	}
+	compressedSects, compressedBytes := c.sects, c.bytes
 
 	// Now copy the dwarf data into the output.
 	// Kernel requires all loaded segments to be page-aligned in the file,
@@ -251,7 +265,7 @@ func machoCombineDwarf(ctxt *Link, exef *os.File, exem *macho.File, dsym, outexe
 // returning the updated sections and segment contents, nils if the sections
 // weren't compressed, or an error if there was a problem reading dwarfm.
 func machoCompressSections(ctxt *Link, dwarfm *macho.File) ([]*macho.Section, []byte, error) {
-	if !ctxt.compressDWARF {
+	if ctxt.compressDWARF == dwarfCompressNone {
 		return nil, nil, nil
 	}
 
@@ -56,21 +56,62 @@ func init() {
 	flag.Var(&rpath, "r", "set the ELF dynamic linker search `path` to dir1:dir2:...")
 	flag.Var(&flagExtld, "extld", "use `linker` when linking in external mode")
 	flag.Var(&flagExtldflags, "extldflags", "pass `flags` to external linker")
+	flag.Var(&flagDumpDep, "dumpdep", "dump symbol dependency graph, as text or json, to standard output or to file with `format[:file]`")
 }
 
 // Flags used by the linker. The exported flags are used by the architecture-specific packages.
 var (
 	flagBuildid = flag.String("buildid", "", "record `id` as Go toolchain build id")
 
-	flagOutfile    = flag.String("o", "", "write output to `file`")
-	flagPluginPath = flag.String("pluginpath", "", "full path name for plugin")
-
-	flagInstallSuffix = flag.String("installsuffix", "", "set package directory `suffix`")
-	flagDumpDep       = flag.Bool("dumpdep", false, "dump symbol dependency graph")
-	flagRace          = flag.Bool("race", false, "enable race detector")
-	flagMsan          = flag.Bool("msan", false, "enable MSan interface")
-	flagAsan          = flag.Bool("asan", false, "enable ASan interface")
-	flagAslr          = flag.Bool("aslr", true, "enable ASLR for buildmode=c-shared on windows")
+	flagOutfile          = flag.String("o", "", "write output to `file`")
+	flagOutStripped      = flag.String("o-stripped", "", "also write a stripped copy of the output to `file`")
+	flagSplitDWARF       = flag.String("splitdwarf", "", "move the DWARF and the symbol table of the output to `file`, and link to it from the output")
+	flagPluginPath       = flag.String("pluginpath", "", "full path name for plugin")
+	flagPluginCompat     = flag.String("plugin-compat", "strict", "plugin package hash `mode` (strict, loose)")
+	flagPluginHost       = flag.String("pluginhost", "", "use the type descriptors exported by the program in `file` that opens the plugin")
+	flagCompressSections = flag.Bool("compress-sections", false, "compress the contents of //go:embed files, which the program inflates at startup")
+
+	flagInstallSuffix   = flag.String("installsuffix", "", "set package directory `suffix`")
+	flagDumpDep         dumpDepFlag
+	flagDumpDepFilter   = flag.String("dumpdepfilter", "", "with -dumpdep, only dump the edges with a symbol matching `regexp`")
+	flagDumpGOT         = flag.String("dumpgot", "", "write the GOT and PLT entries the linker creates to `file`")
+	flagDumpReloc       = flag.String("dumpreloc", "", "write relocations passed to the external linker to `file`")
+	flagSkipExtCheck    = flag.Bool("skip-extlink-check", false, "do not check the external linker output for the sections the runtime needs")
+	flagSkipPICCheck    = flag.Bool("skip-pic-check", false, "do not check that a c-archive can be linked into a PIE or shared library")
+	flagSectLayout      = flag.String("sectlayout", "", "place host object sections as described by the linker script `file`")
+	flagOrderFile       = flag.String("orderfile", "", "place the functions listed in `file` first in the text section, in order")
+	flagRandLayout      = flag.Int64("randlayout", 0, "randomize the order of the functions in the text section with `seed`, if nonzero")
+	flagSizeCheck       = flag.String("sizecheck", "", "fail if the output exceeds the size limits in `file`")
+	flagSizeReport      = flag.String("sizereport", "", "write a JSON report of the output size by section and package to `file`")
+	flagSoname          = flag.String("soname", "", "set the DT_SONAME of the ELF shared library to `name`")
+	flagExportSymbols   = flag.String("exportsymbols", "", "export only the symbols listed in `file` from the C shared library or executable (ELF)")
+	flagExportDynamic   = flag.Bool("exportdynamic", false, "export the global symbols of the host objects from the executable, like -rdynamic (ELF)")
+	flagSysoSelect      = flag.String("sysoselect", "", "load the .syso files listed in the JSON `file` only for their targets")
+	flagMetadata        = flag.String("metadata", "", "write a zip archive of JSON tables describing the output to `file`")
+	flagPrintConfig     = flag.String("print-config", "", "print the effective flags, the decisions derived from them and the inputs as JSON, then `continue` or exit")
+	flagSeparateCode    = flag.Bool("separate-code", false, "map the ELF headers apart from the code, so that only code is executable (ELF)")
+	flagFuncAlign       = flag.Int("funcalign", 0, "align functions in the text section to `n` bytes, instead of the architecture's default")
+	flagSplitTextSize   = flag.Int64("splittextsize", -1, "split the text into sections of at most `size` bytes, or not at all if 0 (ppc64 and arm64)")
+	flagTextAlign       = flag.Int("textalign", 0, "align the text segment to `n` bytes in memory and in the file, so that it can be mapped with huge pages (ELF)")
+	flagAllowWX         = flag.Bool("allow-wx", false, "allow host object sections that are both writable and executable")
+	flagAllowTextrel    = flag.Bool("allow-textrel", false, "allow absolute addresses in host object code when linking a PIE internally")
+	flagPackRelocs      = flag.Bool("pack-relative-relocs", false, "pack relative dynamic relocations into a DT_RELR table (ELF)")
+	flagBindNow         = flag.Bool("bindnow", false, "bind all dynamic symbols at startup, so that the GOT can be read-only (ELF)")
+	flagHashStyle       = flag.String("hash-style", "", "dynamic symbol hash table `style`: sysv, gnu or both (ELF, default both)")
+	flagDWARFVersion    = flag.Int("dwarf", 4, "write DWARF `version` 4 or 5 (5 for ELF only)")
+	flagDWARFNames      = flag.Bool("dwarfnames", false, "write a .debug_names index of the DWARF (with -dwarf=5)")
+	flagEHFrame         = flag.Bool("ehframe", false, "write .eh_frame unwind tables for the Go functions (ELF, amd64 and arm64)")
+	flagEmitReloc       = flag.Bool("emitreloc", false, "keep the static relocations in the output, for post-link optimizers (ELF)")
+	flagStaticPIE       = flag.Bool("static-pie", false, "link a PIE that needs no dynamic linker (linux/amd64, linux/arm64)")
+	flagABIWrapperAlias = flag.Bool("abiwrapper-alias", false, "name ABI wrappers like the functions they wrap in the symbol table, with zero-size aliases (ELF)")
+	flagCFProtection    = flag.String("cfprotection", "", "assert that the Go code supports the control-flow protection `features` (ELF)")
+	flagPackageNote     = flag.String("package-note", "", "add a .note.package note with the package metadata `json`, or @file to read it from file (ELF)")
+	flagGuardModData    = flag.Bool("guard-moduledata", false, "put runtime.firstmoduledata in read-only memory with the pclntab, typelinks and itablinks")
+	flagIgnoreExp       = flag.Bool("ignore-experiment-mismatch", false, "link packages built with different GOEXPERIMENT settings")
+	flagRace            = flag.Bool("race", false, "enable race detector")
+	flagMsan            = flag.Bool("msan", false, "enable MSan interface")
+	flagAsan            = flag.Bool("asan", false, "enable ASan interface")
+	flagAslr            = flag.Bool("aslr", true, "enable ASLR for buildmode=c-shared on windows")
 
 	flagFieldTrack = flag.String("k", "", "set field tracking `symbol`")
 	flagLibGCC     = flag.String("libgcc", "", "compiler support lib for internal linking; use \"none\" to disable")
@@ -80,28 +121,36 @@ var (
 	flagExtldflags quoted.Flag
 	flagExtar      = flag.String("extar", "", "archive program for buildmode=c-archive")
 
-	flagA             = flag.Bool("a", false, "no-op (deprecated)")
-	FlagC             = flag.Bool("c", false, "dump call graph")
-	FlagD             = flag.Bool("d", false, "disable dynamic executable")
-	flagF             = flag.Bool("f", false, "ignore version mismatch")
-	flagG             = flag.Bool("g", false, "disable go package data checks")
-	flagH             = flag.Bool("h", false, "halt on error")
-	flagN             = flag.Bool("n", false, "dump symbol table")
-	FlagS             = flag.Bool("s", false, "disable symbol table")
-	FlagW             = flag.Bool("w", false, "disable DWARF generation")
-	flag8             bool // use 64-bit addresses in symbol table
-	flagInterpreter   = flag.String("I", "", "use `linker` as ELF dynamic linker")
-	FlagDebugTramp    = flag.Int("debugtramp", 0, "debug trampolines")
-	FlagDebugTextSize = flag.Int("debugtextsize", 0, "debug text section max size")
-	FlagStrictDups    = flag.Int("strictdups", 0, "sanity check duplicate symbol contents during object file reading (1=warn 2=err).")
-	FlagRound         = flag.Int("R", -1, "set address rounding `quantum`")
-	FlagTextAddr      = flag.Int64("T", -1, "set text segment `address`")
-	flagEntrySymbol   = flag.String("E", "", "set `entry` symbol name")
-	cpuprofile        = flag.String("cpuprofile", "", "write cpu profile to `file`")
-	memprofile        = flag.String("memprofile", "", "write memory profile to `file`")
-	memprofilerate    = flag.Int64("memprofilerate", 0, "set runtime.MemProfileRate to `rate`")
-	benchmarkFlag     = flag.String("benchmark", "", "set to 'mem' or 'cpu' to enable phase benchmarking")
-	benchmarkFileFlag = flag.String("benchmarkprofile", "", "emit phase profiles to `base`_phase.{cpu,mem}prof")
+	flagA               = flag.Bool("a", false, "no-op (deprecated)")
+	FlagC               = flag.Bool("c", false, "dump call graph")
+	FlagD               = flag.Bool("d", false, "disable dynamic executable")
+	flagF               = flag.Bool("f", false, "ignore version mismatch")
+	flagG               = flag.Bool("g", false, "disable go package data checks")
+	flagH               = flag.Bool("h", false, "halt on error")
+	flagN               = flag.Bool("n", false, "dump symbol table")
+	FlagS               = flag.Bool("s", false, "disable symbol table")
+	FlagW               = flag.Bool("w", false, "disable DWARF generation")
+	flag8               bool // use 64-bit addresses in symbol table
+	flagInterpreter     = flag.String("I", "", "use `linker` as ELF dynamic linker")
+	FlagInterpose       = flag.Bool("interpose", false, "keep references to host library symbols preemptible (c-archive, c-shared)")
+	flagInterposeReport = flag.String("interposereport", "", "write references to symbols outside the Go object to `file`")
+	FlagDebugTramp      = flag.Int("debugtramp", 0, "debug trampolines")
+	FlagDebugTextSize   = flag.Int("debugtextsize", 0, "debug text section max size")
+	flagDebugArgLen     = flag.Int("debugarglen", 0, "debug external linker response files: use one once the arguments exceed `n` bytes")
+	FlagDebugEarlyGOT   = flag.String("debugearlygot", "", "debug the -static-pie startup check: load `symbol` through the GOT in the entry point")
+	FlagStrictDups      = flag.Int("strictdups", 0, "sanity check duplicate symbol contents during object file reading (1=warn 2=err).")
+	flagStrictWarnings  = flag.Bool("strictwarnings", false, "treat linker warnings as errors")
+	flagErrorLimit      = flag.Int("errorlimit", -1, "stop after `n` errors, or never if 0 (if not set, 20, but list all undefined symbols)")
+	flagUnresolved      = flag.String("unresolved", "error", "treat undefined symbols of host objects according to `mode`: error, warn or ignore (ELF)")
+	FlagRound           = flag.Int("R", -1, "set address rounding `quantum`")
+	FlagTextAddr        = flag.Int64("T", -1, "set text segment `address`")
+	flagEntrySymbol     = flag.String("E", "", "set `entry` symbol name")
+	cpuprofile          = flag.String("cpuprofile", "", "write cpu profile to `file`")
+	memprofile          = flag.String("memprofile", "", "write memory profile to `file`")
+	memprofilerate      = flag.Int64("memprofilerate", 0, "set runtime.MemProfileRate to `rate`")
+	benchmarkFlag       = flag.String("benchmark", "", "set to 'mem' or 'cpu' to enable phase benchmarking")
+	benchmarkFileFlag   = flag.String("benchmarkprofile", "", "emit phase profiles to `base`_phase.{cpu,mem}prof")
+	flagTraceFile       = flag.String("tracefile", "", "write the phase timings as a Chrome trace to `file`")
 )
 
 // Main is the main entry point for the linker code.
@@ -137,16 +186,32 @@ func Main(arch *sys.Arch, theArch Arch) {
 	flag.BoolVar(&ctxt.linkShared, "linkshared", false, "link against installed Go shared libraries")
 	flag.Var(&ctxt.LinkMode, "linkmode", "set link `mode`")
 	flag.Var(&ctxt.BuildMode, "buildmode", "set build `mode`")
-	flag.BoolVar(&ctxt.compressDWARF, "compressdwarf", true, "compress DWARF if possible")
-	objabi.Flagfn1("B", "add an ELF NT_GNU_BUILD_ID `note` when using ELF", addbuildinfo)
+	flag.StringVar(flagInterpreter, "interp", "", "use `path` as the ELF program interpreter (same as -I)")
+	flag.Var(&ctxt.compressDWARF, "compressdwarf", "compress DWARF if possible, with `method` zlib, zstd or none")
+	flag.Var(&ctxt.strip, "strip", "leave the comma-separated `parts` out of the output: sections, symtab, locals or dwarf")
+	objabi.Flagfn1("B", "add an ELF NT_GNU_BUILD_ID `note` when using ELF; gobuildid derives it from the Go build ID", addbuildinfo)
+	objabi.Flagfn1("debug-prefix-map", "replace the leading `old=new` in the file paths written to the output; can be repeated", addDebugPrefixMap)
 	objabi.Flagfn1("L", "add specified `directory` to library path", func(a string) { Lflag(ctxt, a) })
 	objabi.AddVersionFlag() // -V
+	objabi.Flagfn1("addsection", "add the contents of a file as a section `name=file[,alloc]`; can be repeated", addAddSection)
+	objabi.Flagfn1("reserve-section", "reserve a zero-filled section `name=size[,flags]` to be written after linking; can be repeated", addReserveSection)
 	objabi.Flagfn1("X", "add string value `definition` of the form importpath.name=value", func(s string) { addstrdata1(ctxt, s) })
+	objabi.Flagfn1("wholearchive", "link in all members of host archives matching `pattern`", addWholeArchive)
+	objabi.Flagfn1("whyalive", "print why the symbols matching `pattern` are in the output; can be repeated", addWhyAlive)
 	objabi.Flagcount("v", "print link trace", &ctxt.Debugvlog)
 	objabi.Flagfn1("importcfg", "read import configuration from `file`", ctxt.readImportCfg)
 
 	objabi.Flagparse(usage)
 
+	if debugPrefixMap != "" {
+		// Remap the GOROOT recorded above, unless -X replaced it.
+		for _, name := range []string{"runtime.defaultGOROOT", "internal/buildcfg.defaultGOROOT"} {
+			if strdata[name] == final {
+				strdata[name] = remapPath(final)
+			}
+		}
+	}
+
 	if ctxt.Debugvlog > 0 {
 		// dump symbol info on crash
 		defer func() { ctxt.loader.Dump() }()
@@ -172,6 +237,20 @@ func Main(arch *sys.Arch, theArch Arch) {
 		usage()
 	}
 
+	switch *flagPluginCompat {
+	case "strict", "loose":
+	default:
+		Errorf(nil, "unknown -plugin-compat mode %q", *flagPluginCompat)
+		usage()
+	}
+
+	switch *flagPrintConfig {
+	case "", "continue", "exit":
+	default:
+		Errorf(nil, "unknown -print-config mode %q", *flagPrintConfig)
+		usage()
+	}
+
 	checkStrictDups = *FlagStrictDups
 
 	if !buildcfg.Experiment.RegabiWrappers {
@@ -186,6 +265,7 @@ func Main(arch *sys.Arch, theArch Arch) {
 	if ctxt.BuildMode != BuildModeShared && flag.NArg() != 1 {
 		usage()
 	}
+	checkOptions(ctxt)
 
 	if *flagOutfile == "" {
 		*flagOutfile = "a.out"
@@ -196,6 +276,16 @@ func Main(arch *sys.Arch, theArch Arch) {
 
 	interpreter = *flagInterpreter
 
+	if *flagDumpGOT != "" {
+		ctxt.gotRefs = make(gotRefs)
+	}
+	if *flagStaticPIE {
+		ctxt.indirectRefs = make(indirectRefs)
+	}
+	if *flagDumpReloc != "" {
+		ctxt.relocDump = new(relocDumper)
+	}
+
 	if *flagBuildid == "" && ctxt.Target.IsOpenbsd() {
 		// TODO(jsing): Remove once direct syscalls are no longer in use.
 		// OpenBSD 6.7 onwards will not permit direct syscalls from a
@@ -216,17 +306,230 @@ func Main(arch *sys.Arch, theArch Arch) {
 			usage()
 		}
 	}
+	if *flagTraceFile != "" {
+		if bench == nil {
+			bench = benchmark.New(benchmark.NoGC, "")
+		}
+		if err := bench.TraceTo(*flagTraceFile); err != nil {
+			Exitf("-tracefile: %v", err)
+		}
+		// Write the phases so far if the link fails.
+		AtExit(func() { bench.Trace() })
+	}
+	ctxt.bench = bench
 
 	bench.Start("libinit")
 	libinit(ctxt) // creates outfile
 	bench.Start("computeTLSOffset")
 	ctxt.computeTLSOffset()
 	bench.Start("Archinit")
+	textAddrSet := *FlagTextAddr != -1
 	thearch.Archinit(ctxt)
 
 	if ctxt.linkShared && !ctxt.IsELF {
 		Exitf("-linkshared can only be used on elf systems")
 	}
+	if *FlagInterpose && (!ctxt.IsELF || (ctxt.BuildMode != BuildModeCArchive && ctxt.BuildMode != BuildModeCShared)) {
+		Exitf("-interpose can only be used with -buildmode=c-archive or c-shared on elf systems")
+	}
+	if *flagGuardModData && !(ctxt.IsLinux() && (ctxt.IsAMD64() || ctxt.IsARM64())) {
+		Exitf("-guard-moduledata is only supported on linux/amd64 and linux/arm64")
+	}
+	if *flagOutStripped != "" && (!(ctxt.IsELF || ctxt.IsDarwin()) || ctxt.BuildMode == BuildModeCArchive) {
+		Exitf("-o-stripped is only supported for ELF and Mach-O executables and shared libraries")
+	}
+	if *flagPackageNote != "" {
+		parsePackageNote(ctxt, *flagPackageNote)
+		// The note goes with the headers, which need more room
+		// before the text.
+		pad := packageNoteReserve()
+		HEADR += int32(pad)
+		*FlagTextAddr += pad
+	}
+	if *flagTextAlign != 0 {
+		if !ctxt.IsELF {
+			Exitf("-textalign is only supported for ELF")
+		}
+		align := int64(*flagTextAlign)
+		if align&(align-1) != 0 || align < int64(*FlagRound) {
+			Exitf("-textalign=%#x must be a power of two, and at least the -R rounding quantum %#x", align, *FlagRound)
+		}
+		// The text segment starts with the headers.
+		if start := *FlagTextAddr - int64(HEADR); start%align != 0 {
+			if textAddrSet {
+				Exitf("-T=%#x puts the text segment at %#x, which is not aligned to -textalign=%#x", *FlagTextAddr, start, align)
+			}
+			*FlagTextAddr = Rnd(start, align) + int64(HEADR)
+		}
+	}
+	if *flagFuncAlign != 0 {
+		if ctxt.IsWasm() {
+			Exitf("-funcalign is not supported on wasm")
+		}
+		align := *flagFuncAlign
+		if align&(align-1) != 0 || align < thearch.Funcalign {
+			Exitf("-funcalign=%d must be a power of two, and at least the %s default %d", align, buildcfg.GOARCH, thearch.Funcalign)
+		}
+		Funcalign = align
+	}
+	if *flagSplitTextSize != -1 {
+		if !ctxt.IsPPC64() && !ctxt.IsARM64() {
+			Exitf("-splittextsize is only supported on ppc64, ppc64le and arm64")
+		}
+		// A larger section would put some direct calls within it
+		// out of their reach.
+		if size := *flagSplitTextSize; size < 0 || uint64(size) > thearch.TrampLimit {
+			Exitf("-splittextsize=%#x must be between 0 and %#x, the reach of a direct call on %s less some room", size, thearch.TrampLimit, buildcfg.GOARCH)
+		}
+	}
+	if *flagSeparateCode {
+		if !ctxt.IsELF {
+			Exitf("-separate-code is only supported for ELF")
+		}
+		if *flagAllowWX {
+			Exitf("-separate-code cannot be used with -allow-wx")
+		}
+		// The headers, and the notes and interpreter name after
+		// them, get whole pages of their own, before the text,
+		// which -textalign may want further along.
+		round := int64(*FlagRound)
+		if int64(*flagTextAlign) > round {
+			round = int64(*flagTextAlign)
+		}
+		pad := Rnd(int64(HEADR), round) - int64(HEADR)
+		HEADR += int32(pad)
+		*FlagTextAddr += pad
+	}
+	if *flagPackRelocs && !ctxt.IsELF {
+		Exitf("-pack-relative-relocs is only supported for ELF")
+	}
+	if *flagBindNow && !ctxt.IsELF {
+		Exitf("-bindnow is only supported for ELF")
+	}
+	if *flagHashStyle != "" && !ctxt.IsELF {
+		Exitf("-hash-style is only supported for ELF")
+	}
+	switch *flagHashStyle {
+	case "":
+		// The GNU hash table reorders the dynamic symbols, which
+		// the MIPS ABI ties to the GOT.
+		elfSysvHash, elfGNUHash = true, !ctxt.IsMIPS() && !ctxt.IsMIPS64()
+	case "sysv":
+		elfSysvHash = true
+	case "gnu":
+		elfGNUHash = true
+	case "both":
+		elfSysvHash, elfGNUHash = true, true
+	default:
+		Exitf("unknown -hash-style %q, want sysv, gnu or both", *flagHashStyle)
+	}
+	if elfGNUHash && (ctxt.IsMIPS() || ctxt.IsMIPS64()) {
+		Exitf("-hash-style=%s is not supported on %s", *flagHashStyle, buildcfg.GOARCH)
+	}
+	switch *flagUnresolved {
+	case "error":
+	case "warn", "ignore":
+		if !ctxt.IsELF {
+			Exitf("-unresolved=%s is only supported for ELF", *flagUnresolved)
+		}
+	default:
+		Exitf("unknown -unresolved mode %q, want error, warn or ignore", *flagUnresolved)
+	}
+	if ctxt.strip&(stripSymtab|stripLocals) != 0 && !ctxt.IsELF {
+		Exitf("-strip=symtab and -strip=locals are only supported for ELF")
+	}
+	// -s and -w are aliases for -strip=symtab,dwarf and -strip=dwarf,
+	// except that on darwin -s keeps the DWARF, which is in a segment
+	// of its own. From here on, they tell whether the symbol table and
+	// the DWARF are written.
+	if *FlagS {
+		ctxt.strip |= stripSymtab
+		if !ctxt.IsDarwin() {
+			ctxt.strip |= stripDWARF
+		}
+	}
+	if *FlagW {
+		ctxt.strip |= stripDWARF
+	}
+	*FlagS = ctxt.strip&stripSymtab != 0
+	*FlagW = ctxt.strip&stripDWARF != 0
+	if ctxt.strip&stripSections != 0 {
+		if !ctxt.IsELF {
+			Exitf("-strip=sections is only supported for ELF")
+		}
+		if ctxt.BuildMode == BuildModeCArchive || ctxt.BuildMode == BuildModeShared {
+			Exitf("-strip=sections cannot be used with -buildmode=%s: the output is read by a linker, which needs the sections", ctxt.BuildMode)
+		}
+		if *flagEmitReloc {
+			Exitf("-strip=sections cannot be used with -emitreloc: the relocations are kept in sections")
+		}
+		if len(reservedSections) > 0 {
+			Exitf("-strip=sections cannot be used with -reserve-section: the reserved sections are found by name")
+		}
+		if len(addedSections) > 0 {
+			Exitf("-strip=sections cannot be used with -addsection: the added sections are found by name")
+		}
+		// The symbol table and the DWARF data are only found through
+		// the section headers.
+		ctxt.strip |= stripSymtab | stripDWARF
+		*FlagS = true
+		*FlagW = true
+	}
+	if gobuildinfo && ctxt.IsELF {
+		addgobuildinfo()
+	}
+	if *flagDWARFVersion != 4 && *flagDWARFVersion != 5 {
+		Exitf("invalid -dwarf=%d: the version must be 4 or 5", *flagDWARFVersion)
+	}
+	if *flagDWARFVersion == 5 && !ctxt.IsELF {
+		Exitf("-dwarf=5 is only supported for ELF")
+	}
+	if *flagEHFrame && !(ctxt.IsELF && (ctxt.IsAMD64() || ctxt.IsARM64())) {
+		Exitf("-ehframe is only supported for ELF on amd64 and arm64")
+	}
+	if *flagDWARFNames && *flagDWARFVersion != 5 {
+		Exitf("-dwarfnames requires -dwarf=5: .debug_names is a DWARF 5 section")
+	}
+	if *flagEmitReloc {
+		if !ctxt.IsELF {
+			Exitf("-emitreloc is only supported for ELF")
+		}
+		if *FlagS {
+			Exitf("-emitreloc cannot be used with -s or -strip=symtab: the relocations refer to the symbol table")
+		}
+	}
+	if *flagSplitDWARF != "" {
+		if !ctxt.IsELF || ctxt.BuildMode == BuildModeCArchive {
+			Exitf("-splitdwarf is only supported for ELF executables and shared libraries")
+		}
+		if *FlagW {
+			Exitf("-splitdwarf cannot be used with -s, -w or -strip=dwarf,sections: there is no DWARF to move")
+		}
+		if *flagEmitReloc {
+			Exitf("-splitdwarf cannot be used with -emitreloc: the relocations refer to the symbol table")
+		}
+		// The symbol table goes to the companion file, and is left out
+		// of the output only when it is moved.
+		*FlagS = false
+	}
+	if *flagStaticPIE && (ctxt.BuildMode != BuildModePIE || !ctxt.IsLinux() || !(ctxt.IsAMD64() || ctxt.IsARM64())) {
+		Exitf("-static-pie is only supported with -buildmode=pie on linux/amd64 and linux/arm64")
+	}
+	if *FlagDebugEarlyGOT != "" && !(*flagStaticPIE && ctxt.IsAMD64()) {
+		Exitf("-debugearlygot is only supported with -static-pie on linux/amd64")
+	}
+	if *flagInterpreter != "" && (*FlagD || *flagStaticPIE) {
+		Exitf("-interp cannot be used with -d or -static-pie: static executables have no program interpreter")
+	}
+	if *flagABIWrapperAlias && !ctxt.IsELF {
+		Exitf("-abiwrapper-alias is only supported for ELF")
+	}
+	if *flagCFProtection != "" {
+		parseCFProtection(ctxt, *flagCFProtection)
+	}
+	if *flagSysoSelect != "" {
+		loadSysoSelect(*flagSysoSelect)
+	}
 
 	if ctxt.Debugvlog != 0 {
 		ctxt.Logf("HEADER = -H%d -T0x%x -R0x%x\n", ctxt.HeadType, uint64(*FlagTextAddr), uint32(*FlagRound))
@@ -255,15 +558,60 @@ func Main(arch *sys.Arch, theArch Arch) {
 	}
 	bench.Start("loadlib")
 	ctxt.loadlib()
+	ctxt.checkExperiments()
+	if *flagSplitTextSize == 0 && ctxt.IsPPC64() && ctxt.IsExternal() {
+		// The trampolines only reach the functions in other
+		// sections, and the external linker needs the sections to
+		// insert its own.
+		Exitf("-splittextsize=0 cannot be used on %s when linking externally", buildcfg.GOARCH)
+	}
+	if *flagPrintConfig != "" {
+		ctxt.printConfig()
+	}
+
+	if ctxt.BuildMode == BuildModePlugin || ctxt.CanUsePlugins() {
+		ctxt.pkghashes = pluginPkgHashes(ctxt)
+	}
+	if *flagPluginHost != "" {
+		ctxt.loadPluginHost()
+	}
+
+	if *flagEmitReloc && ctxt.IsInternal() && !(ctxt.IsAMD64() || ctxt.IsARM64()) {
+		Exitf("-emitreloc is only supported on amd64 and arm64 when linking internally")
+	}
+	if *flagEmitReloc && ctxt.IsExternal() && ctxt.strip&stripLocals != 0 {
+		Exitf("-strip=locals cannot be used with -emitreloc when linking externally: the relocations refer to the symbol table of the external linker by index")
+	}
+
+	if ctxt.IsELF && ctxt.IsInternal() {
+		ctxt.collectInitArray()
+		if (ctxt.BuildMode == BuildModeExe || ctxt.BuildMode == BuildModePIE) && !*FlagD {
+			ctxt.exeExports()
+		}
+	}
+	if *flagSectLayout != "" {
+		ctxt.loadSectLayout()
+	}
 
 	bench.Start("deadcode")
 	deadcode(ctxt)
+	ctxt.resolveUnresolved()
+	if *flagPluginHost != "" {
+		ctxt.importTypes()
+	}
+	if *flagCompressSections {
+		ctxt.compressEmbeds()
+	}
 
 	bench.Start("linksetup")
 	ctxt.linksetup()
 
 	bench.Start("dostrdata")
 	ctxt.dostrdata()
+	ctxt.dolinklayout()
+	ctxt.dopkgtext()
+	ctxt.reserveSections()
+	ctxt.addSections()
 	if buildcfg.Experiment.FieldTrack {
 		bench.Start("fieldtrack")
 		fieldtrack(ctxt.Arch, ctxt.loader)
@@ -310,6 +658,7 @@ func Main(arch *sys.Arch, theArch Arch) {
 
 	bench.Start("textaddress")
 	ctxt.textaddress()
+	ctxt.setpkgtext()
 	bench.Start("typelink")
 	ctxt.typelink()
 	bench.Start("buildinfo")
@@ -321,14 +670,42 @@ func Main(arch *sys.Arch, theArch Arch) {
 	ctxt.findfunctab(pclnState, containers)
 	bench.Start("dwarfGenerateDebugSyms")
 	dwarfGenerateDebugSyms(ctxt)
+	if *flagEHFrame {
+		bench.Start("ehframe")
+		ctxt.ehframe()
+	}
 	bench.Start("symtab")
 	symGroupType := ctxt.symtab(pclnState)
 	bench.Start("dodata")
 	ctxt.dodata(symGroupType)
+	if *flagDumpGOT != "" {
+		ctxt.dumpGOT()
+	}
+	if ctxt.indirectRefs != nil && ctxt.IsInternal() {
+		bench.Start("checkEarlyRelocs")
+		ctxt.checkEarlyRelocs()
+	}
 	bench.Start("address")
 	order := ctxt.address()
+	ctxt.setReservedSections()
+	ctxt.setAddedSections()
+	ctxt.setlinklayout()
+	ctxt.setpkgtextaddr()
+	ctxt.checkWX()
 	bench.Start("dwarfcompress")
 	dwarfcompress(ctxt)
+	if *flagSizeCheck != "" {
+		bench.Start("sizecheck")
+		ctxt.sizeCheck()
+	}
+	if *flagSizeReport != "" {
+		bench.Start("sizereport")
+		ctxt.writeSizeReport()
+	}
+	if *flagMetadata != "" {
+		bench.Start("metadata")
+		ctxt.writeMetadata()
+	}
 	bench.Start("layout")
 	filesize := ctxt.layout(order)
 
@@ -338,13 +715,24 @@ func Main(arch *sys.Arch, theArch Arch) {
 	// for which we have computed the size and offset, in a
 	// mmap'd region. The second part writes more content, for
 	// which we don't know the size.
-	if ctxt.Arch.Family != sys.Wasm {
+	if ctxt.streamTail() {
+		// Only map the allocated image. The rest, which is mostly
+		// DWARF, goes to the file as it is written.
+		if err := ctxt.Out.Mmap(Segdwarf.Fileoff); err != nil {
+			Exitf("mapping output file failed: %v", err)
+		}
+		ctxt.Out.StreamTail(int64(Segdwarf.Fileoff))
+	} else if ctxt.Arch.Family != sys.Wasm {
 		// Don't mmap if we're building for Wasm. Wasm file
 		// layout is very different so filesize is meaningless.
 		if err := ctxt.Out.Mmap(filesize); err != nil {
 			Exitf("mapping output file failed: %v", err)
 		}
 	}
+	if *FlagInterpose || *flagInterposeReport != "" {
+		bench.Start("interpose")
+		ctxt.interpose()
+	}
 	// asmb will redirect symbols to the output file mmap, and relocations
 	// will be applied directly there.
 	bench.Start("Asmb")
@@ -361,12 +749,29 @@ func Main(arch *sys.Arch, theArch Arch) {
 
 	bench.Start("Asmb2")
 	asmb2(ctxt)
+	ctxt.ErrorReporter.reportUnresolved(ctxt.loader)
+	if ctxt.relocDump != nil {
+		bench.Start("dumpreloc")
+		ctxt.relocDump.write(ctxt)
+	}
 
 	bench.Start("Munmap")
 	ctxt.Out.Close() // Close handles Munmapping if necessary.
 
 	bench.Start("hostlink")
 	ctxt.hostlink()
+	if len(addedSections) > 0 {
+		bench.Start("appendAddedSections")
+		ctxt.appendAddedSections()
+	}
+	if *flagSplitDWARF != "" {
+		bench.Start("writeSplitDWARF")
+		ctxt.writeSplitDWARF()
+	}
+	if *flagOutStripped != "" {
+		bench.Start("writeStripped")
+		ctxt.writeStripped()
+	}
 	if ctxt.Debugvlog != 0 {
 		ctxt.Logf("%s", ctxt.loader.Stat())
 		ctxt.Logf("%d liveness data\n", liveness)
@@ -375,7 +780,15 @@ func Main(arch *sys.Arch, theArch Arch) {
 	ctxt.Bso.Flush()
 	bench.Start("archive")
 	ctxt.archive()
-	bench.Report(os.Stdout)
+	if ctxt.whyAlive != "" {
+		os.Stdout.WriteString(ctxt.whyAlive)
+	}
+	if len(*benchmarkFlag) != 0 {
+		bench.Report(os.Stdout)
+	}
+	if err := bench.Trace(); err != nil {
+		Exitf("-tracefile: %v", err)
+	}
 
 	errorexit()
 }
@@ -396,6 +809,9 @@ func (r *Rpath) String() string {
 }
 
 func startProfile() {
+	if *memprofilerate != 0 {
+		runtime.MemProfileRate = int(*memprofilerate)
+	}
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -404,12 +820,15 @@ func startProfile() {
 		if err := pprof.StartCPUProfile(f); err != nil {
 			log.Fatalf("%v", err)
 		}
-		AtExit(pprof.StopCPUProfile)
+		// The profile is written by Exit, so also when the link fails.
+		AtExit(func() {
+			pprof.StopCPUProfile()
+			if err := f.Close(); err != nil {
+				log.Fatalf("%v", err)
+			}
+		})
 	}
 	if *memprofile != "" {
-		if *memprofilerate != 0 {
-			runtime.MemProfileRate = int(*memprofilerate)
-		}
 		f, err := os.Create(*memprofile)
 		if err != nil {
 			log.Fatalf("%v", err)
@@ -424,6 +843,9 @@ func startProfile() {
 			if err := pprof.Lookup("heap").WriteTo(f, writeLegacyFormat); err != nil {
 				log.Fatalf("%v", err)
 			}
+			if err := f.Close(); err != nil {
+				log.Fatalf("%v", err)
+			}
 		})
 	}
 }
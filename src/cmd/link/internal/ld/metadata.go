@@ -0,0 +1,241 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"archive/zip"
+	"cmd/link/internal/loader"
+	"encoding/json"
+	"internal/buildcfg"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Support for -metadata, which writes a zip archive describing the
+// output for binary analysis tools, once it is laid out. It holds JSON
+// files, each an object with the schema version and one table:
+//
+//	build.json      the target, the build settings recorded by the go
+//	                command, and the build ID
+//	symbols.json    every symbol in the loaded segments, with its
+//	                package, kind, section, address and size
+//	roots.json      the symbols the dead code pass started from
+//	itabs.json      the itabs, with their interface and type
+//	typelinks.json  the types in the typelinks table
+//	xflags.json     the string variables set with -X
+//
+// Fields are only ever added to a schema version; a change to the
+// meaning of an existing field requires a new one.
+
+// metadataSchema is the version of the -metadata archive format.
+const metadataSchema = 1
+
+type metadataBuild struct {
+	Schema     int               `json:"schema"`
+	GOOS       string            `json:"goos"`
+	GOARCH     string            `json:"goarch"`
+	BuildMode  string            `json:"buildmode"`
+	LinkMode   string            `json:"linkmode"`
+	GoVersion  string            `json:"goversion"`
+	Experiment string            `json:"experiment,omitempty"`
+	BuildID    string            `json:"buildid,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Settings   []metadataSetting `json:"settings,omitempty"`
+	Deps       []string          `json:"deps,omitempty"`
+}
+
+type metadataSetting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type metadataSymbol struct {
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	Kind    string `json:"kind"`
+	Section string `json:"section"`
+	Address uint64 `json:"address"`
+	Size    int64  `json:"size"`
+}
+
+type metadataItab struct {
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+	Type      string `json:"type"`
+}
+
+type metadataXFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// writeMetadata writes the -metadata archive.
+func (ctxt *Link) writeMetadata() {
+	ldr := ctxt.loader
+
+	build := metadataBuild{
+		Schema:     metadataSchema,
+		GOOS:       buildcfg.GOOS,
+		GOARCH:     buildcfg.GOARCH,
+		BuildMode:  ctxt.BuildMode.String(),
+		LinkMode:   ctxt.LinkMode.String(),
+		GoVersion:  buildcfg.Version,
+		Experiment: buildcfg.GOEXPERIMENT(),
+		BuildID:    *flagBuildid,
+	}
+	if s := ldr.Lookup("runtime.modinfo", 0); s != 0 {
+		parseModinfo(&build, stringVarValue(ctxt, s))
+	}
+
+	var syms []metadataSymbol
+	var itabs []metadataItab
+	var typelinks []string
+	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+		if !ldr.AttrReachable(s) {
+			continue
+		}
+		if ldr.IsItab(s) {
+			relocs := ldr.Relocs(s)
+			itabs = append(itabs, metadataItab{
+				Name:      ldr.SymName(s),
+				Interface: metadataTypeName(ctxt, decodeRelocSym(ldr, s, &relocs, 0)),
+				Type:      metadataTypeName(ctxt, decodeRelocSym(ldr, s, &relocs, int32(ctxt.Arch.PtrSize))),
+			})
+		}
+		if ldr.IsTypelink(s) {
+			typelinks = append(typelinks, metadataTypeName(ctxt, s))
+		}
+		sect := ldr.SymSect(s)
+		if sect == nil || sect.Seg == &Segdwarf || ldr.SymName(s) == "" {
+			continue
+		}
+		syms = append(syms, metadataSymbol{
+			Name:    ldr.SymName(s),
+			Package: symPackage(ldr, s),
+			Kind:    ldr.SymType(s).String(),
+			Section: sect.Name,
+			Address: uint64(ldr.SymValue(s)),
+			Size:    ldr.SymSize(s),
+		})
+	}
+	sort.SliceStable(syms, func(i, j int) bool {
+		if syms[i].Address != syms[j].Address {
+			return syms[i].Address < syms[j].Address
+		}
+		return syms[i].Name < syms[j].Name
+	})
+	sort.Slice(itabs, func(i, j int) bool { return itabs[i].Name < itabs[j].Name })
+	sort.Strings(typelinks)
+
+	roots := []string{}
+	for _, s := range ctxt.deadcodeRoots {
+		roots = append(roots, ldr.SymName(s))
+	}
+
+	xflags := []metadataXFlag{}
+	for _, name := range strnames {
+		if strdataSet[name] {
+			xflags = append(xflags, metadataXFlag{name, strdata[name]})
+		}
+	}
+
+	f, err := os.Create(*flagMetadata)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	zw := zip.NewWriter(f)
+	add := func(name, table string, v interface{}) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			Exitf("writing %s: %v", *flagMetadata, err)
+		}
+		var data []byte
+		if table == "" {
+			data, err = json.MarshalIndent(v, "", "\t")
+		} else {
+			data, err = json.MarshalIndent(map[string]interface{}{"schema": metadataSchema, table: v}, "", "\t")
+		}
+		if err != nil {
+			Exitf("writing %s: %v", *flagMetadata, err)
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			Exitf("writing %s: %v", *flagMetadata, err)
+		}
+	}
+	add("build.json", "", build)
+	add("symbols.json", "symbols", syms)
+	add("roots.json", "roots", roots)
+	add("itabs.json", "itabs", itabs)
+	add("typelinks.json", "typelinks", typelinks)
+	add("xflags.json", "xflags", xflags)
+	if err := zw.Close(); err != nil {
+		Exitf("writing %s: %v", *flagMetadata, err)
+	}
+	if err := f.Close(); err != nil {
+		Exitf("writing %s: %v", *flagMetadata, err)
+	}
+}
+
+// metadataTypeName returns the name of the type described by the type
+// symbol s, as reflect prints it.
+func metadataTypeName(ctxt *Link, s loader.Sym) string {
+	ldr := ctxt.loader
+	if s == 0 {
+		return ""
+	}
+	if len(ldr.Data(s)) == 0 {
+		// A type in a Go shared library.
+		return strings.TrimPrefix(ldr.SymName(s), "type.")
+	}
+	return decodetypeStr(ldr, ctxt.Arch, s)
+}
+
+// stringVarValue returns the value of the Go string variable s.
+func stringVarValue(ctxt *Link, s loader.Sym) string {
+	ldr := ctxt.loader
+	data := ldr.Data(s)
+	if len(data) < 2*ctxt.Arch.PtrSize {
+		return ""
+	}
+	n := decodeInuxi(ctxt.Arch, data[ctxt.Arch.PtrSize:], ctxt.Arch.PtrSize)
+	relocs := ldr.Relocs(s)
+	r := decodeReloc(ldr, s, &relocs, 0)
+	if r.Sym() == 0 {
+		return ""
+	}
+	str := ldr.Data(r.Sym())
+	if r.Add() < 0 || uint64(r.Add())+n > uint64(len(str)) {
+		return ""
+	}
+	return string(str[r.Add() : uint64(r.Add())+n])
+}
+
+// parseModinfo records in b the module path, dependencies and build
+// settings the go command recorded in runtime.modinfo. See
+// runtime/debug.ReadBuildInfo.
+func parseModinfo(b *metadataBuild, modinfo string) {
+	// The build information is wrapped in 16-byte markers.
+	if len(modinfo) < 32 {
+		return
+	}
+	for _, line := range strings.Split(modinfo[16:len(modinfo)-16], "\n") {
+		f := strings.SplitN(line, "\t", 2)
+		if len(f) != 2 {
+			continue
+		}
+		switch f[0] {
+		case "path":
+			b.Path = f[1]
+		case "dep":
+			b.Deps = append(b.Deps, strings.Replace(f[1], "\t", " ", -1))
+		case "build":
+			kv := strings.SplitN(f[1], "\t", 2)
+			if len(kv) == 2 {
+				b.Settings = append(b.Settings, metadataSetting{kv[0], kv[1]})
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+)
+
+// Support for -orderfile, which places the functions listed in a file,
+// one symbol name per line as in the symbol table and pclntab, at the
+// start of the text section, in the order listed. The other functions
+// follow in their usual order. Blank lines and lines starting with #
+// are ignored, as are later duplicates. Names that match no function
+// are reported with a warning, as order files are typically generated
+// from profiles of other builds.
+//
+// Support for -randlayout, which shuffles the functions with a seeded
+// random number generator, to measure how much the performance of a
+// program depends on its code layout. With both flags, the functions
+// not listed in the order file follow in random order.
+
+// textUnits splits ctxt.Textp into the symbols that must stay first,
+// the runs of a symbol and its sub-symbols, which move together, and
+// the symbols that must stay last.
+func (ctxt *Link) textUnits() (head []loader.Sym, units [][]loader.Sym, tail []loader.Sym) {
+	ldr := ctxt.loader
+	textp := ctxt.Textp
+	first, last := 0, len(textp)
+	for first < last && (ldr.SymName(textp[first]) == "go.buildid" || ldr.SymName(textp[first]) == "runtime.text") {
+		first++
+	}
+	if first < last && ldr.SymName(textp[last-1]) == "runtime.etext" {
+		last--
+	}
+	for i := first; i < last; i++ {
+		s := textp[i]
+		if !ldr.AttrSubSymbol(s) || len(units) == 0 {
+			units = append(units, nil)
+		}
+		u := len(units) - 1
+		units[u] = append(units[u], s)
+	}
+	return textp[:first], units, textp[last:]
+}
+
+// joinTextUnits sets ctxt.Textp to head, units and tail, in order.
+func (ctxt *Link) joinTextUnits(head []loader.Sym, units [][]loader.Sym, tail []loader.Sym) {
+	textp := make([]loader.Sym, 0, len(ctxt.Textp))
+	textp = append(textp, head...)
+	for _, syms := range units {
+		textp = append(textp, syms...)
+	}
+	ctxt.Textp = append(textp, tail...)
+}
+
+// randomizeText shuffles ctxt.Textp as described by -randlayout. It
+// depends only on the seed and the original order, so the output is
+// still reproducible.
+func (ctxt *Link) randomizeText() {
+	head, units, tail := ctxt.textUnits()
+	r := rand.New(rand.NewSource(*flagRandLayout))
+	r.Shuffle(len(units), func(i, j int) { units[i], units[j] = units[j], units[i] })
+	ctxt.joinTextUnits(head, units, tail)
+}
+
+// orderText reorders ctxt.Textp as described by -orderfile. It is
+// called before addresses are assigned to the text symbols, so that
+// text section splitting and trampolines follow the new order.
+func (ctxt *Link) orderText() {
+	data, err := ioutil.ReadFile(*flagOrderFile)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	ldr := ctxt.loader
+
+	head, units, tail := ctxt.textUnits()
+	byname := make(map[string][]int)
+	for u, syms := range units {
+		for _, s := range syms {
+			name := ldr.SymName(s)
+			if n := byname[name]; len(n) == 0 || n[len(n)-1] != u {
+				byname[name] = append(n, u)
+			}
+		}
+	}
+
+	placed := make([]bool, len(units))
+	order := make([][]loader.Sym, 0, len(units))
+	for i, line := range strings.Split(string(data), "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		us, ok := byname[name]
+		if !ok {
+			warnf("-orderfile: %s:%d: no function %s", *flagOrderFile, i+1, name)
+			continue
+		}
+		for _, u := range us {
+			if !placed[u] {
+				placed[u] = true
+				order = append(order, units[u])
+			}
+		}
+	}
+	for u, syms := range units {
+		if !placed[u] {
+			order = append(order, syms)
+		}
+	}
+	ctxt.joinTextUnits(head, order, tail)
+}
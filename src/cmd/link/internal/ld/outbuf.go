@@ -37,6 +37,10 @@ const outbufMode = 0775
 //   backed buffer that will get synced to disk.
 // - Munmap the output file
 //
+// Fourth, the part of the file past the allocated image, which for a
+// large program is mostly DWARF, can be streamed to the file instead,
+// see StreamTail.
+//
 // And finally, it provides a mechanism by which you can multithread the
 // writing of output files. This mechanism is accomplished by copying a OutBuf,
 // and using it in the thread/goroutine.
@@ -70,6 +74,12 @@ type OutBuf struct {
 	f      *os.File
 	encbuf [8]byte // temp buffer used by WriteN methods
 	isView bool    // true if created from View()
+
+	// With StreamTail, the writes from tailStart on go to the file
+	// through tail, which holds the data from file offset tailOff.
+	tailStart int64 // 0 if not streaming
+	tailOff   int64
+	tail      []byte
 }
 
 func (out *OutBuf) Open(name string) error {
@@ -95,6 +105,10 @@ func NewOutBuf(arch *sys.Arch) *OutBuf {
 var viewError = errors.New("output not mmapped")
 
 func (out *OutBuf) View(start uint64) (*OutBuf, error) {
+	if out.tailStart != 0 && int64(start) >= out.tailStart {
+		// The streamed tail is written in order.
+		return nil, viewError
+	}
 	return &OutBuf{
 		arch:   out.arch,
 		name:   out.name,
@@ -124,6 +138,9 @@ func (out *OutBuf) Close() error {
 			return err
 		}
 	}
+	if err := out.flushTail(); err != nil {
+		return err
+	}
 	if err := out.f.Close(); err != nil {
 		return err
 	}
@@ -169,11 +186,110 @@ func (out *OutBuf) copyHeap() bool {
 // maxOutBufHeapLen limits the growth of the heap area.
 const maxOutBufHeapLen = 10 << 20
 
+// outTailBufSize is the amount of streamed data buffered before it is
+// written to the file.
+const outTailBufSize = 1 << 20
+
+// StreamTail makes the writes at offset start and beyond go straight
+// to the file, in order, instead of to the mmapped area or the heap,
+// so that they are not all in memory at the same time and the mmapped
+// area does not have to grow. Writes may skip forward, leaving a hole
+// that reads as zeros, and rewrite the last outTailBufSize bytes, but
+// not go back any further, except by Rewind. The mmapped area, if any,
+// must end at start, and the writes before start must fit in it.
+func (out *OutBuf) StreamTail(start int64) {
+	if out.isView {
+		panic("cannot stream the tail of a view")
+	}
+	if out.isMmapped() && int64(len(out.buf)) != start || len(out.heap) != 0 && !out.isMmapped() && int64(len(out.heap)) > start {
+		panic("streamed tail overlaps the mapped output")
+	}
+	out.tailStart = start
+	out.tailOff = start
+	out.tail = make([]byte, 0, outTailBufSize)
+}
+
+// Rewind discards what was written to the streamed tail from off on,
+// and moves the write offset back to off.
+func (out *OutBuf) Rewind(off int64) {
+	if out.tailStart == 0 || off < out.tailStart {
+		panic("can only rewind the streamed tail")
+	}
+	if off >= out.tailOff {
+		if end := out.tailOff + int64(len(out.tail)); off < end {
+			out.tail = out.tail[:off-out.tailOff]
+		}
+	} else {
+		// Cut the file, so that the holes left by the writes from
+		// off on read as zeros.
+		if err := out.f.Truncate(off); err != nil {
+			Exitf("resize output file failed: %v", err)
+		}
+		out.tail = out.tail[:0]
+		out.tailOff = off
+	}
+	out.off = off
+}
+
+// flushTail writes the buffered part of the streamed tail to the file.
+func (out *OutBuf) flushTail() error {
+	if len(out.tail) == 0 {
+		return nil
+	}
+	if _, err := out.f.WriteAt(out.tail, out.tailOff); err != nil {
+		return err
+	}
+	out.tailOff += int64(len(out.tail))
+	out.tail = out.tail[:0]
+	if cap(out.tail) > outTailBufSize {
+		// Do not hold on to the space of a large write.
+		out.tail = make([]byte, 0, outTailBufSize)
+	}
+	return nil
+}
+
+// tailLoc is writeLoc for the streamed tail. The space it returns
+// stays valid until the next write.
+func (out *OutBuf) tailLoc(lenToWrite int64) (int64, []byte) {
+	if out.isView {
+		panic("cannot write to the streamed tail in parallel")
+	}
+	if out.off < out.tailOff {
+		log.Fatalf("write at %#x to the part of the streamed output already written, up to %#x", out.off, out.tailOff)
+	}
+	end := out.tailOff + int64(len(out.tail))
+	if out.off+lenToWrite > out.tailOff+outTailBufSize || out.off > end {
+		// Start a new buffer at out.off, which may leave a hole
+		// in the file, or hold on to what can be rewritten.
+		keep := int64(0)
+		if out.off < end {
+			keep = end - out.off
+		}
+		rest := append([]byte(nil), out.tail[int64(len(out.tail))-keep:]...)
+		out.tail = out.tail[:int64(len(out.tail))-keep]
+		if err := out.flushTail(); err != nil {
+			Exitf("writing output file failed: %v", err)
+		}
+		out.tailOff = out.off
+		out.tail = append(out.tail, rest...)
+		end = out.tailOff + int64(len(out.tail))
+	}
+	pos := out.off - out.tailOff
+	if n := out.off + lenToWrite - end; n > 0 {
+		out.tail = append(out.tail, make([]byte, n)...)
+	}
+	return pos, out.tail
+}
+
 // writeLoc determines the write location if a buffer is mmaped.
 // We maintain two write buffers, an mmapped section, and a heap section for
 // writing. When the mmapped section is full, we switch over the heap memory
-// for writing.
+// for writing. With StreamTail, the writes at the end of the file go
+// to the tail buffer instead.
 func (out *OutBuf) writeLoc(lenToWrite int64) (int64, []byte) {
+	if out.tailStart != 0 && out.off >= out.tailStart {
+		return out.tailLoc(lenToWrite)
+	}
 	// See if we have enough space in the mmaped area.
 	bufLen := int64(len(out.buf))
 	if out.off+lenToWrite <= bufLen {
@@ -202,6 +318,32 @@ func (out *OutBuf) writeLoc(lenToWrite int64) (int64, []byte) {
 	return heapPos, out.heap
 }
 
+// bytesAt returns the n bytes written at offset off.
+func (out *OutBuf) bytesAt(off, n int64) []byte {
+	bufLen := int64(len(out.buf))
+	switch {
+	case out.tailStart != 0 && off >= out.tailOff:
+		return out.tail[off-out.tailOff : off-out.tailOff+n]
+	case out.tailStart != 0 && off >= out.tailStart:
+		b := make([]byte, n)
+		k := out.tailOff - off
+		if k > n {
+			k = n
+		}
+		if _, err := out.f.ReadAt(b[:k], off); err != nil {
+			Exitf("reading output file failed: %v", err)
+		}
+		copy(b[k:], out.tail)
+		return b
+	case off+n <= bufLen:
+		return out.buf[off : off+n]
+	case off >= bufLen:
+		return out.heap[off-bufLen : off-bufLen+n]
+	}
+	b := append([]byte{}, out.buf[off:]...)
+	return append(b, out.heap[:off+n-bufLen]...)
+}
+
 func (out *OutBuf) SeekSet(p int64) {
 	out.off = p
 }
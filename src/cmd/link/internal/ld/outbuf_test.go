@@ -5,6 +5,8 @@
 package ld
 
 import (
+	"bytes"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -91,3 +93,54 @@ func TestIsMmapped(t *testing.T) {
 		}
 	}
 }
+
+// TestStreamTail checks the writes to the streamed tail, in order, over
+// holes, over what was just written, and after a Rewind.
+func TestStreamTail(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "foo.out")
+	ob := NewOutBuf(nil)
+	if err := ob.Open(filename); err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	const start = 16
+	if err := ob.Mmap(start); err != nil {
+		t.Fatalf("error mmapping file %v", err)
+	}
+
+	var want []byte
+	write := func(off int64, b []byte) {
+		ob.SeekSet(off)
+		ob.Write(b)
+		if end := off + int64(len(b)); end > int64(len(want)) {
+			want = append(want, make([]byte, end-int64(len(want)))...)
+		}
+		copy(want[off:], b)
+	}
+	big := bytes.Repeat([]byte("0123456789"), outTailBufSize/5)
+
+	write(0, bytes.Repeat([]byte{'h'}, start))
+	ob.StreamTail(start)
+	write(start, []byte("abc"))
+	write(start+10, big) // leaves a hole, and fills more than the buffer
+	write(start+12, []byte("xyz"))
+	n := int64(len(want))
+	write(n-4, []byte("end"))
+	write(n+100, []byte("past the hole"))
+	ob.Rewind(n + 50)
+	want = want[:n+50]
+	write(n+50, []byte("rewritten"))
+	ob.Rewind(start + 5)
+	want = want[:start+5]
+	write(start+8, []byte("again"))
+
+	if err := ob.Close(); err != nil {
+		t.Fatalf("error closing file: %v", err)
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes %q..., want %d bytes %q...", len(got), got[:32], len(want), want[:32])
+	}
+}
@@ -310,8 +310,10 @@ func (state *pclntab) generateFuncnametab(ctxt *Link, funcs []loader.Sym) map[lo
 		}
 	}
 
-	// Loop through the CUs, and calculate the size needed.
-	var size int64
+	// Loop through the CUs, and calculate the size needed. The
+	// runtime takes a name offset of 0 to mean that the function has
+	// no name, so the table starts with an empty name.
+	size := int64(1)
 	walkFuncs(ctxt, funcs, func(s loader.Sym) {
 		nameOffsets[s] = uint32(size)
 		a, b, c := nameParts(ctxt.loader.SymName(s))
@@ -581,9 +581,13 @@ func (f *peFile) emitRelocations(ctxt *Link) {
 				if ldr.SymDynid(rr.Xsym) < 0 {
 					ctxt.Errorf(s, "reloc %d to non-coff symbol %s (outer=%s) %d", r.Type(), ldr.SymName(r.Sym()), ldr.SymName(rr.Xsym), ldr.SymType(r.Sym()))
 				}
+				off := ctxt.Out.Offset()
 				if !thearch.PEreloc1(ctxt.Arch, ctxt.Out, ldr, s, rr, int64(uint64(ldr.SymValue(s)+int64(r.Off()))-base)) {
 					ctxt.Errorf(s, "unsupported obj reloc %v/%d to %s", r.Type(), r.Siz(), ldr.SymName(r.Sym()))
 				}
+				if ctxt.relocDump != nil {
+					ctxt.relocDump.add(ctxt, sect, s, r, rr, ctxt.Out.bytesAt(off, ctxt.Out.Offset()-off))
+				}
 			}
 		}
 		sect.Rellen = uint64(ctxt.Out.Offset()) - sect.Reloff
@@ -1218,18 +1222,46 @@ func peimporteddlls() []string {
 	return dlls
 }
 
+// addimports writes the import directory of the executable in a new
+// .idata section, laid out as the PE specification requires:
+//
+//	import directory table: an IMAGE_IMPORT_DESCRIPTOR for each DLL,
+//	    then a null descriptor
+//	DLL names
+//	hint/name table: for each imported function, a 2-byte hint and its
+//	    name, padded so that the next entry starts on an even boundary
+//	import lookup table: for each DLL, aligned to the thunk size (4
+//	    bytes in PE32 files, 8 in PE32+ files), the RVA of the hint/name
+//	    entry of each of its functions, then a null thunk
+//
+// The import address table, which the loader overwrites with the
+// addresses of the functions, is a separate copy of the import lookup
+// table, in the .windynamic symbol of the data section (see
+// initdynimport). Each descriptor points to its DLL's part of both.
 func addimports(ctxt *Link, datsect *peSection) {
 	ldr := ctxt.loader
 	startoff := ctxt.Out.Offset()
 	dynamic := ldr.LookupOrCreateSym(".windynamic", 0)
 
-	// skip import descriptor table (will write it later)
-	n := uint64(0)
+	thunksize := int64(4)
+	if pe64 != 0 {
+		thunksize = 8
+	}
+	writeThunk := func(v uint64) {
+		if pe64 != 0 {
+			ctxt.Out.Write64(v)
+		} else {
+			ctxt.Out.Write32(uint32(v))
+		}
+	}
 
+	// skip import descriptor table (will write it later)
+	ndlls := int64(0)
 	for d := dr; d != nil; d = d.next {
-		n++
+		ndlls++
 	}
-	ctxt.Out.SeekSet(startoff + int64(binary.Size(&IMAGE_IMPORT_DESCRIPTOR{}))*int64(n+1))
+	dirsize := int64(binary.Size(&IMAGE_IMPORT_DESCRIPTOR{})) * (ndlls + 1)
+	ctxt.Out.SeekSet(startoff + dirsize)
 
 	// write dll names
 	for d := dr; d != nil; d = d.next {
@@ -1247,24 +1279,18 @@ func addimports(ctxt *Link, datsect *peSection) {
 	}
 
 	// write OriginalFirstThunks
+	for (ctxt.Out.Offset()-startoff)%thunksize != 0 {
+		ctxt.Out.Write8(0)
+	}
 	oftbase := uint64(ctxt.Out.Offset()) - uint64(startoff)
 
-	n = uint64(ctxt.Out.Offset())
+	n := uint64(ctxt.Out.Offset())
 	for d := dr; d != nil; d = d.next {
 		d.thunkoff = uint64(ctxt.Out.Offset()) - n
 		for m := d.ms; m != nil; m = m.next {
-			if pe64 != 0 {
-				ctxt.Out.Write64(m.off)
-			} else {
-				ctxt.Out.Write32(uint32(m.off))
-			}
-		}
-
-		if pe64 != 0 {
-			ctxt.Out.Write64(0)
-		} else {
-			ctxt.Out.Write32(0)
+			writeThunk(m.off)
 		}
+		writeThunk(0)
 	}
 
 	// add pe section and pad it at the end
@@ -1278,22 +1304,16 @@ func addimports(ctxt *Link, datsect *peSection) {
 
 	// write FirstThunks (allocated in .data section)
 	ftbase := uint64(ldr.SymValue(dynamic)) - uint64(datsect.virtualAddress) - uint64(PEBASE)
+	if ftbase%uint64(thunksize) != 0 {
+		Errorf(nil, "import address table at %#x is not aligned to %d bytes", ftbase, thunksize)
+	}
 
 	ctxt.Out.SeekSet(int64(uint64(datsect.pointerToRawData) + ftbase))
 	for d := dr; d != nil; d = d.next {
 		for m := d.ms; m != nil; m = m.next {
-			if pe64 != 0 {
-				ctxt.Out.Write64(m.off)
-			} else {
-				ctxt.Out.Write32(uint32(m.off))
-			}
-		}
-
-		if pe64 != 0 {
-			ctxt.Out.Write64(0)
-		} else {
-			ctxt.Out.Write32(0)
+			writeThunk(m.off)
 		}
+		writeThunk(0)
 	}
 
 	// finally write import descriptor table
@@ -1316,7 +1336,7 @@ func addimports(ctxt *Link, datsect *peSection) {
 
 	// update data directory
 	pefile.dataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].VirtualAddress = isect.virtualAddress
-	pefile.dataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].Size = isect.virtualSize
+	pefile.dataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].Size = uint32(dirsize)
 	pefile.dataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IAT].VirtualAddress = uint32(ldr.SymValue(dynamic) - PEBASE)
 	pefile.dataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IAT].Size = uint32(ldr.SymSize(dynamic))
 
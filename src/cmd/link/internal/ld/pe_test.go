@@ -0,0 +1,176 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"internal/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestPEImportDirectory checks that the import directory of PE32 and
+// PE32+ executables is laid out as the PE specification requires (see
+// addimports), as the loader of the CLR, unlike the Windows one, checks.
+func TestPEImportDirectory(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, goarch := range []string{"386", "amd64"} {
+		goarch := goarch
+		t.Run(goarch, func(t *testing.T) {
+			t.Parallel()
+			exe := filepath.Join(t.TempDir(), "main.exe")
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, src)
+			cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH="+goarch, "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%s: %v\n%s", cmd, err, out)
+			}
+			checkPEImports(t, exe)
+		})
+	}
+}
+
+func checkPEImports(t *testing.T, exe string) {
+	f, err := pe.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var dirs []pe.DataDirectory
+	thunksize := uint32(4)
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = oh.DataDirectory[:oh.NumberOfRvaAndSizes]
+	case *pe.OptionalHeader64:
+		dirs = oh.DataDirectory[:oh.NumberOfRvaAndSizes]
+		thunksize = 8
+	default:
+		t.Fatalf("unexpected optional header %T", oh)
+	}
+	if len(dirs) <= pe.IMAGE_DIRECTORY_ENTRY_IAT {
+		t.Fatalf("%d data directories, want at least %d", len(dirs), pe.IMAGE_DIRECTORY_ENTRY_IAT+1)
+	}
+	imp := dirs[pe.IMAGE_DIRECTORY_ENTRY_IMPORT]
+	iat := dirs[pe.IMAGE_DIRECTORY_ENTRY_IAT]
+
+	// at returns the contents of the image from rva to the end of its
+	// section.
+	at := func(rva uint32) []byte {
+		for _, s := range f.Sections {
+			if rva >= s.VirtualAddress && rva < s.VirtualAddress+s.VirtualSize {
+				data, err := s.Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if off := rva - s.VirtualAddress; off < uint32(len(data)) {
+					return data[off:]
+				}
+				return nil
+			}
+		}
+		t.Fatalf("RVA %#x is not in a section", rva)
+		return nil
+	}
+	thunk := func(b []byte) uint64 {
+		if thunksize == 8 {
+			return binary.LittleEndian.Uint64(b)
+		}
+		return uint64(binary.LittleEndian.Uint32(b))
+	}
+
+	const descsize = 20
+	if imp.Size == 0 || imp.Size%descsize != 0 {
+		t.Fatalf("import directory has size %d, want a multiple of %d", imp.Size, descsize)
+	}
+	ndesc := imp.Size/descsize - 1
+	descs := at(imp.VirtualAddress)
+	if uint32(len(descs)) < imp.Size {
+		t.Fatalf("import directory of %d bytes is truncated to %d", imp.Size, len(descs))
+	}
+	for _, b := range descs[ndesc*descsize : imp.Size] {
+		if b != 0 {
+			t.Fatalf("import directory does not end with a null descriptor")
+		}
+	}
+
+	nsyms := 0
+	for i := uint32(0); i < ndesc; i++ {
+		d := descs[i*descsize:]
+		ilt := binary.LittleEndian.Uint32(d[0:])
+		name := binary.LittleEndian.Uint32(d[12:])
+		ft := binary.LittleEndian.Uint32(d[16:])
+		dll := cstring(at(name))
+		if dll == "" {
+			t.Errorf("descriptor %d has no DLL name", i)
+		}
+		if ilt == 0 || ilt == ft {
+			t.Errorf("%s: import lookup table at %#x, want one separate from the import address table at %#x", dll, ilt, ft)
+		}
+		if ilt%thunksize != 0 || ft%thunksize != 0 {
+			t.Errorf("%s: import lookup table at %#x and address table at %#x, want both aligned to %d bytes", dll, ilt, ft, thunksize)
+		}
+		if ft < iat.VirtualAddress || ft >= iat.VirtualAddress+iat.Size {
+			t.Errorf("%s: import address table at %#x is outside the IAT directory [%#x, %#x)", dll, ft, iat.VirtualAddress, iat.VirtualAddress+iat.Size)
+		}
+
+		// Both tables hold the RVAs of the hint/name entries, and
+		// end with a null thunk.
+		lb, ab := at(ilt), at(ft)
+		for j := uint32(0); ; j++ {
+			off := j * thunksize
+			if off+thunksize > uint32(len(lb)) || off+thunksize > uint32(len(ab)) {
+				t.Fatalf("%s: thunk arrays are not null-terminated", dll)
+			}
+			l, a := thunk(lb[off:]), thunk(ab[off:])
+			if l != a {
+				t.Errorf("%s: thunk %d is %#x in the import lookup table and %#x in the address table", dll, j, l, a)
+			}
+			if l == 0 {
+				break
+			}
+			if l>>(8*thunksize-1) != 0 {
+				t.Errorf("%s: thunk %d imports by ordinal", dll, j)
+				continue
+			}
+			if l%2 != 0 {
+				t.Errorf("%s: hint/name entry at %#x is not on an even boundary", dll, l)
+			}
+			if hn := at(uint32(l)); len(hn) < 3 || cstring(hn[2:]) == "" {
+				t.Errorf("%s: hint/name entry at %#x has no name", dll, l)
+			}
+			nsyms++
+		}
+	}
+
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nsyms == 0 || nsyms != len(syms) {
+		t.Errorf("found %d imported functions, want %d", nsyms, len(syms))
+	}
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A c-archive is linked into a C program by the host linker, and that
+// program is usually a PIE, or a shared library. On ELF systems the go
+// command compiles the packages of a c-archive with -shared so that
+// the object the linker writes into the archive is position
+// independent, but a build system that runs the compiler itself may
+// not. The host linker would then reject the archive, when the user
+// of the archive links their program. So, before the archive is
+// written, its object is checked for relocations that cannot be used
+// in a PIE or a shared library, and the link fails with the symbols
+// holding them. The check is disabled by -skip-pic-check, for an
+// archive that is only linked into programs that are not position
+// independent.
+
+// checkArchivePIC checks that the ELF object goobj, to be put into a
+// c-archive, can be linked into a PIE or a shared library.
+func (ctxt *Link) checkArchivePIC(goobj string) {
+	problems, nonPIC, err := ctxt.archivePICProblems(goobj)
+	if err != nil {
+		Exitf("checking %s: %v", goobj, err)
+	}
+	if len(problems) == 0 {
+		return
+	}
+	const max = 10
+	if len(problems) > max {
+		problems = append(problems[:max], fmt.Sprintf("and %d more", len(problems)-max))
+	}
+	advice := "compile all packages with -shared"
+	if len(nonPIC) > 0 {
+		advice = fmt.Sprintf("packages compiled without -shared: %s", strings.Join(nonPIC, ", "))
+	}
+	Exitf("buildmode=c-archive object cannot be used in a PIE or shared library:\n\t%s\n(%s; use -skip-pic-check if the archive is only linked into programs that are not position independent)", strings.Join(problems, "\n\t"), advice)
+}
+
+// archivePICProblems returns the relocations in the allocated
+// sections of the ELF object goobj that are not position independent,
+// and the packages holding them that were not compiled with -shared.
+func (ctxt *Link) archivePICProblems(goobj string) (problems, nonPIC []string, err error) {
+	f, err := elf.Open(goobj)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if f.Class != elf.ELFCLASS64 || (f.Machine != elf.EM_X86_64 && f.Machine != elf.EM_AARCH64) {
+		return nil, nil, nil
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, nil, err
+	}
+
+	// The symbols defined in each section, by address, to describe
+	// the location of a relocation.
+	defs := make(map[elf.SectionIndex][]elf.Symbol)
+	for _, s := range syms {
+		switch elf.ST_TYPE(s.Info) {
+		case elf.STT_FUNC, elf.STT_OBJECT, elf.STT_TLS, elf.STT_NOTYPE:
+			if s.Name != "" && s.Section > elf.SHN_UNDEF && s.Section < elf.SHN_LORESERVE {
+				defs[s.Section] = append(defs[s.Section], s)
+			}
+		}
+	}
+	for _, d := range defs {
+		sort.SliceStable(d, func(i, j int) bool { return d[i].Value < d[j].Value })
+	}
+	loc := func(sect elf.SectionIndex, off uint64) (string, uint64) {
+		d := defs[sect]
+		i := sort.Search(len(d), func(i int) bool { return d[i].Value > off }) - 1
+		if i < 0 {
+			return f.Sections[sect].Name, off
+		}
+		return d[i].Name, off - d[i].Value
+	}
+
+	ldr := ctxt.loader
+	reported := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, rsect := range f.Sections {
+		if rsect.Type != elf.SHT_RELA && rsect.Type != elf.SHT_REL {
+			continue
+		}
+		if int(rsect.Info) >= len(f.Sections) {
+			continue
+		}
+		sect := f.Sections[rsect.Info]
+		if sect.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		data, err := rsect.Data()
+		if err != nil {
+			return nil, nil, err
+		}
+		entsize := 16
+		if rsect.Type == elf.SHT_RELA {
+			entsize = 24
+		}
+		for i := 0; i+entsize <= len(data); i += entsize {
+			off := f.ByteOrder.Uint64(data[i:])
+			info := f.ByteOrder.Uint64(data[i+8:])
+			typ, symidx := elf.R_TYPE64(info), int(elf.R_SYM64(info))
+			if !picIncompatible(f.Machine, typ, sect.Flags&elf.SHF_WRITE != 0) {
+				continue
+			}
+			name, symoff := loc(elf.SectionIndex(rsect.Info), off)
+			target := "?"
+			if symidx > 0 && symidx <= len(syms) {
+				if target = syms[symidx-1].Name; target == "" && syms[symidx-1].Section < elf.SectionIndex(len(f.Sections)) {
+					target = f.Sections[syms[symidx-1].Section].Name
+				}
+			}
+			// Report each kind of relocation once per symbol.
+			key := fmt.Sprintf("%s: %s against %s", name, picRelocName(f.Machine, typ), target)
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+			problems = append(problems, fmt.Sprintf("%s+%#x: %s against %s", name, symoff, picRelocName(f.Machine, typ), target))
+			for _, ver := range []int{sym.SymVerABIInternal, sym.SymVerABI0} {
+				s := ldr.Lookup(name, ver)
+				if s == 0 || ldr.IsExternal(s) || ldr.AttrShared(s) {
+					continue
+				}
+				if pkg := symPackage(ldr, s); !seen[pkg] {
+					seen[pkg] = true
+					nonPIC = append(nonPIC, pkg)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(nonPIC)
+	return problems, nonPIC, nil
+}
+
+// picIncompatible reports whether a relocation of type typ, for the
+// ELF machine m, in a section that is writable or not, cannot be used
+// in a PIE or a shared library. Those are the relocations holding an
+// absolute address that is too small for any load address, or that
+// would have the dynamic linker write to a read-only section, and
+// those using the local-exec TLS model, which is only valid in an
+// executable.
+func picIncompatible(m elf.Machine, typ uint32, writable bool) bool {
+	switch m {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(typ) {
+		case elf.R_X86_64_8, elf.R_X86_64_16, elf.R_X86_64_32, elf.R_X86_64_32S,
+			elf.R_X86_64_TPOFF32, elf.R_X86_64_TPOFF64:
+			return true
+		case elf.R_X86_64_64:
+			return !writable
+		}
+	case elf.EM_AARCH64:
+		switch elf.R_AARCH64(typ) {
+		case elf.R_AARCH64_ABS16, elf.R_AARCH64_ABS32,
+			elf.R_AARCH64_MOVW_UABS_G0, elf.R_AARCH64_MOVW_UABS_G0_NC,
+			elf.R_AARCH64_MOVW_UABS_G1, elf.R_AARCH64_MOVW_UABS_G1_NC,
+			elf.R_AARCH64_MOVW_UABS_G2, elf.R_AARCH64_MOVW_UABS_G2_NC,
+			elf.R_AARCH64_MOVW_UABS_G3,
+			elf.R_AARCH64_MOVW_SABS_G0, elf.R_AARCH64_MOVW_SABS_G1, elf.R_AARCH64_MOVW_SABS_G2,
+			elf.R_AARCH64_TLSLE_MOVW_TPREL_G2, elf.R_AARCH64_TLSLE_MOVW_TPREL_G1,
+			elf.R_AARCH64_TLSLE_MOVW_TPREL_G1_NC, elf.R_AARCH64_TLSLE_MOVW_TPREL_G0,
+			elf.R_AARCH64_TLSLE_MOVW_TPREL_G0_NC, elf.R_AARCH64_TLSLE_ADD_TPREL_HI12,
+			elf.R_AARCH64_TLSLE_ADD_TPREL_LO12, elf.R_AARCH64_TLSLE_ADD_TPREL_LO12_NC,
+			elf.R_AARCH64_TLSLE_LDST128_TPREL_LO12, elf.R_AARCH64_TLSLE_LDST128_TPREL_LO12_NC:
+			return true
+		case elf.R_AARCH64_ABS64:
+			return !writable
+		}
+	}
+	return false
+}
+
+// picRelocName returns the name of the relocation type typ for the
+// ELF machine m.
+func picRelocName(m elf.Machine, typ uint32) string {
+	switch m {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(typ).String()
+	case elf.EM_AARCH64:
+		return elf.R_AARCH64(typ).String()
+	}
+	return fmt.Sprint(typ)
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"encoding/binary"
+	"sort"
+)
+
+// The package of each range of the Go code is made visible to the
+// program through go.link.pkgtexttab and go.link.pkgtexttabsize, which
+// runtime/debug declares as zeroed uintptr variables and reads in
+// PackageForPC. If they are reachable, the linker sets them, as it does
+// the layout variables, to the address and the size of a table in a
+// .gopkgtext section on ELF, in the read-only data elsewhere:
+//
+//	nranges uint32
+//	npkgs   uint32
+//	ranges  [nranges]struct{ start, end, pkg uint32 }
+//	pkgoffs [npkgs + 1]uint32
+//	paths   [pkgoffs[npkgs]]byte
+//
+// in the byte order of the target. The ranges are sorted offsets from
+// runtime.text, which the runtime maps to addresses with the text
+// section map, so they stay valid when the text is split in several
+// sections. Package pkg has the import path paths[pkgoffs[pkg]:
+// pkgoffs[pkg+1]]. Code of host objects belongs to the package that
+// contains the object, and code the linker generates, such as
+// trampolines, to "(linker)", as for -sizecheck.
+
+const pkgTextSectName = ".gopkgtext"
+
+// pkgTextTabSym returns the table of text ranges, or 0 if the program
+// does not use it.
+func (ctxt *Link) pkgTextTabSym() loader.Sym {
+	if ctxt.IsWasm() || ctxt.linkLayoutSym("go.link.pkgtexttab") == 0 {
+		return 0
+	}
+	return ctxt.loader.Lookup(ctxt.pkgTextTabName(), 0)
+}
+
+func (ctxt *Link) pkgTextTabName() string {
+	if ctxt.IsELF {
+		return pkgTextSectName
+	}
+	return "go.link.pkgtext"
+}
+
+// dopkgtext creates the table of text ranges, filled in by setpkgtext
+// once the text is laid out, and turns the reachable variables
+// describing it into data.
+func (ctxt *Link) dopkgtext() {
+	if ctxt.IsWasm() {
+		return
+	}
+	tab := ctxt.linkLayoutSym("go.link.pkgtexttab")
+	if tab == 0 {
+		return
+	}
+	ldr := ctxt.loader
+	s := ldr.CreateSymForUpdate(ctxt.pkgTextTabName(), 0)
+	if ctxt.IsELF {
+		s.SetType(sym.SELFROSECT)
+	} else {
+		s.SetType(sym.SRODATA)
+	}
+	s.SetReachable(true)
+	s.SetAlign(4)
+	addr := s.Sym()
+	if ctxt.IsELF {
+		// Symbols named after their section are not in the symbol
+		// table, which relocations for the external linker refer to.
+		// setpkgtextaddr moves go.link.pkgtext to the section.
+		addr = ctxt.xdefine("go.link.pkgtext", sym.SRODATA, 0)
+	}
+
+	for _, v := range []loader.Sym{tab, ctxt.linkLayoutSym("go.link.pkgtexttabsize")} {
+		if v == 0 {
+			continue
+		}
+		sb := ldr.MakeSymbolUpdater(v)
+		sb.SetType(sym.SNOPTRDATA)
+		sb.SetSize(0)
+		sb.SetData(make([]byte, 0, ctxt.Arch.PtrSize))
+		sb.SetReadOnly(false)
+		sb.ResetRelocs()
+		if v == tab {
+			sb.AddAddrPlus(ctxt.Arch, addr, 0)
+		} else {
+			sb.AddUint(ctxt.Arch, 0) // set by setpkgtext
+		}
+	}
+}
+
+// setpkgtext fills in the table of text ranges, once the text is laid
+// out, trampolines included.
+func (ctxt *Link) setpkgtext() {
+	s := ctxt.pkgTextTabSym()
+	if s == 0 {
+		return
+	}
+	ldr := ctxt.loader
+	text := ldr.SymValue(ldr.Lookup("runtime.text", 0))
+	var funcs []pkgTextFunc
+	for _, f := range ctxt.Textp {
+		if size := ldr.SymSize(f); size > 0 {
+			start := ldr.SymValue(f) - text
+			funcs = append(funcs, pkgTextFunc{start, start + size, symPackage(ldr, f)})
+		}
+	}
+	data := pkgTextTable(ctxt.Arch.ByteOrder, funcs)
+	sb := ldr.MakeSymbolUpdater(s)
+	sb.SetData(data)
+	sb.SetSize(int64(len(data)))
+	if v := ctxt.linkLayoutSym("go.link.pkgtexttabsize"); v != 0 {
+		ldr.MakeSymbolUpdater(v).SetUint(ctxt.Arch, 0, uint64(len(data)))
+	}
+}
+
+// setpkgtextaddr sets go.link.pkgtext to the address of the .gopkgtext
+// section on ELF, once the sections are laid out.
+func (ctxt *Link) setpkgtextaddr() {
+	s := ctxt.pkgTextTabSym()
+	if s == 0 || !ctxt.IsELF {
+		return
+	}
+	ldr := ctxt.loader
+	addr := ldr.Lookup("go.link.pkgtext", 0)
+	ldr.SetSymSect(addr, ldr.SymSect(s))
+	ldr.SetSymValue(addr, ldr.SymValue(s))
+}
+
+// A pkgTextFunc is a text symbol, with its offset from runtime.text.
+type pkgTextFunc struct {
+	start, end int64
+	pkg        string
+}
+
+// pkgTextTable returns the table of text ranges of funcs, merging the
+// ranges of consecutive functions of the same package.
+func pkgTextTable(order binary.ByteOrder, funcs []pkgTextFunc) []byte {
+	sort.SliceStable(funcs, func(i, j int) bool { return funcs[i].start < funcs[j].start })
+
+	type textRange struct{ start, end, pkg uint32 }
+	var ranges []textRange
+	pkgIndex := make(map[string]uint32)
+	var pkgs []string
+	for _, f := range funcs {
+		pkg, ok := pkgIndex[f.pkg]
+		if !ok {
+			pkg = uint32(len(pkgs))
+			pkgIndex[f.pkg] = pkg
+			pkgs = append(pkgs, f.pkg)
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].pkg == pkg {
+			ranges[n-1].end = uint32(f.end)
+			continue
+		}
+		ranges = append(ranges, textRange{uint32(f.start), uint32(f.end), pkg})
+	}
+
+	var data []byte
+	put := func(v uint32) {
+		var b [4]byte
+		order.PutUint32(b[:], v)
+		data = append(data, b[:]...)
+	}
+	put(uint32(len(ranges)))
+	put(uint32(len(pkgs)))
+	for _, r := range ranges {
+		put(r.start)
+		put(r.end)
+		put(r.pkg)
+	}
+	off := uint32(0)
+	for _, pkg := range pkgs {
+		put(off)
+		off += uint32(len(pkg))
+	}
+	put(off)
+	for _, pkg := range pkgs {
+		data = append(data, pkg...)
+	}
+	return data
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"internal/testenv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type pkgTextRange struct {
+	start, end uint32
+	pkg        string
+}
+
+// decodePkgText decodes a table written by pkgTextTable.
+func decodePkgText(t *testing.T, order binary.ByteOrder, data []byte) []pkgTextRange {
+	t.Helper()
+	word := func(i uint32) uint32 {
+		if int(i)*4+4 > len(data) {
+			t.Fatalf("table of %d bytes has no word %d", len(data), i)
+		}
+		return order.Uint32(data[i*4:])
+	}
+	nranges, npkgs := word(0), word(1)
+	offs := 2 + 3*nranges
+	paths := data[(offs+npkgs+1)*4:]
+	var ranges []pkgTextRange
+	for i := uint32(0); i < nranges; i++ {
+		p := word(2 + 3*i + 2)
+		if p >= npkgs {
+			t.Fatalf("range %d has package %d of %d", i, p, npkgs)
+		}
+		ranges = append(ranges, pkgTextRange{word(2 + 3*i), word(2 + 3*i + 1), string(paths[word(offs+p):word(offs+p+1)])})
+	}
+	return ranges
+}
+
+func TestPkgTextTable(t *testing.T) {
+	funcs := []pkgTextFunc{
+		{0x40, 0x48, "(linker)"},
+		{0x00, 0x10, "runtime"},
+		{0x10, 0x30, "runtime"},
+		{0x30, 0x40, "main"},
+		{0x50, 0x60, "runtime"},
+		{0x60, 0x64, "runtime"},
+	}
+	got := decodePkgText(t, binary.BigEndian, pkgTextTable(binary.BigEndian, funcs))
+	want := []pkgTextRange{
+		{0x00, 0x30, "runtime"},
+		{0x30, 0x40, "main"},
+		{0x40, 0x48, "(linker)"},
+		{0x50, 0x64, "runtime"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pkgTextTable:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+const testPkgTextSrc = `
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+func main() {
+	fmt.Println(debug.PackageForPC(0))
+}
+`
+
+// TestPkgTextTrampolines checks that the trampolines inserted between
+// the functions are in the table, and belong to the linker.
+func TestPkgTextTrampolines(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := os.WriteFile(src, []byte(testPkgTextSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(tmpdir, "x.exe")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-debugtramp=2", "-o", exe, src)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sect := f.Section(pkgTextSectName)
+	if sect == nil {
+		t.Fatalf("no %s section", pkgTextSectName)
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges := decodePkgText(t, f.ByteOrder, data)
+
+	pkgs := make(map[string]bool)
+	for i, r := range ranges {
+		if r.start >= r.end || i > 0 && r.start < ranges[i-1].end {
+			t.Errorf("range %d [%#x, %#x) is empty or overlaps the previous one", i, r.start, r.end)
+		}
+		pkgs[r.pkg] = true
+	}
+	for _, pkg := range []string{"main", "fmt", "runtime", "runtime/debug", "(linker)"} {
+		if !pkgs[pkg] {
+			t.Errorf("no code of %s in the table", pkg)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/objabi"
+	"strings"
+)
+
+// Support for -debug-prefix-map.
+//
+// The linker writes file paths into the output: the source file names
+// of the pcln table and of the DWARF line tables, the GOROOT the
+// runtime reports and the path of the gdb script. -trimpath, through
+// GOROOT_FINAL, only hides GOROOT. -debug-prefix-map=old=new replaces
+// any leading old in these paths with new, like the C compilers'
+// option, so that builds in different directories write the same
+// output.
+
+// debugPrefixMap is the list of -debug-prefix-map rewrites, in the
+// form objabi.ApplyRewrites takes, the last given first.
+var debugPrefixMap string
+
+func addDebugPrefixMap(arg string) {
+	eq := strings.Index(arg, "=")
+	if eq <= 0 {
+		Exitf("-debug-prefix-map argument must be of the form old=new: %s", arg)
+	}
+	if strings.Contains(arg, ";") || strings.Contains(arg, "=>") {
+		Exitf("-debug-prefix-map argument cannot contain ; or =>: %s", arg)
+	}
+	rewrite := arg[:eq] + "=>" + arg[eq+1:]
+	if debugPrefixMap != "" {
+		rewrite += ";" + debugPrefixMap
+	}
+	debugPrefixMap = rewrite
+}
+
+// remapPath returns path rewritten by the first matching
+// -debug-prefix-map rewrite.
+func remapPath(path string) string {
+	if debugPrefixMap == "" {
+		return path
+	}
+	path, _ = objabi.ApplyRewrites(path, debugPrefixMap)
+	return path
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import "testing"
+
+func TestRemapPath(t *testing.T) {
+	defer func(old string) { debugPrefixMap = old }(debugPrefixMap)
+	debugPrefixMap = ""
+
+	for _, arg := range []string{"/home/gopher=/src", "/home/gopher/go=/goroot", "/home/gopher/go=/root", "/tmp="} {
+		addDebugPrefixMap(arg)
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"/home/gopher/p/main.go", "/src/p/main.go"},
+		{"/home/gopher/go/src/fmt/print.go", "/root/src/fmt/print.go"}, // the last matching option wins
+		{"/home/gopher/gopher.go", "/src/gopher.go"},
+		{"/home/gopherx/main.go", "/home/gopherx/main.go"},
+		{"/home/gopher", "/src"},
+		{"/tmp/x.go", "x.go"},
+		{"main.go", "main.go"},
+	}
+	for _, test := range tests {
+		if got := remapPath(test.path); got != test.want {
+			t.Errorf("remapPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"internal/buildcfg"
+	"io"
+	"os"
+)
+
+// Support for -print-config, which prints the configuration the linker
+// runs with, once the inputs are loaded and the link mode is settled,
+// as a JSON object on standard output:
+//
+//	args            the command line, with response files expanded
+//	set             the flags given on the command line
+//	flags           the effective value of every flag
+//	buildmode       the build mode
+//	linkmode        the link mode, and linkmodereason why it was chosen
+//	interp          the ELF program interpreter, if the output has one;
+//	                when linking externally, only one given to the linker
+//	extld           when linking externally, the host linker, and
+//	                extldflags the flags passed to it with -extldflags
+//	symtab, dwarf   whether the output has a symbol table and DWARF
+//	compressdwarf   how the DWARF is compressed
+//	inputs          the packages, host objects and shared libraries
+//	                loaded, with the SHA-256 of their contents
+//
+// With -print-config=continue the link goes on as usual, with
+// -print-config=exit the linker stops without writing the output.
+
+type printConfig struct {
+	GOOS           string             `json:"goos"`
+	GOARCH         string             `json:"goarch"`
+	GoVersion      string             `json:"goversion"`
+	Experiment     string             `json:"experiment,omitempty"`
+	Args           []string           `json:"args"`
+	Set            []string           `json:"set"`
+	Flags          map[string]string  `json:"flags"`
+	BuildMode      string             `json:"buildmode"`
+	LinkMode       string             `json:"linkmode"`
+	LinkModeReason string             `json:"linkmodereason"`
+	Interp         string             `json:"interp,omitempty"`
+	Extld          []string           `json:"extld,omitempty"`
+	Extldflags     []string           `json:"extldflags,omitempty"`
+	Symtab         bool               `json:"symtab"`
+	DWARF          bool               `json:"dwarf"`
+	CompressDWARF  string             `json:"compressdwarf"`
+	Inputs         []printConfigInput `json:"inputs"`
+}
+
+type printConfigInput struct {
+	Kind    string `json:"kind"` // package, hostobj or shlib
+	Package string `json:"package,omitempty"`
+	File    string `json:"file"`
+	Offset  int64  `json:"offset,omitempty"` // of a host object in an archive
+	Length  int64  `json:"length,omitempty"`
+	SHA256  string `json:"sha256"`
+}
+
+// printConfig prints the -print-config object, and with
+// -print-config=exit, exits.
+func (ctxt *Link) printConfig() {
+	c := printConfig{
+		GOOS:           buildcfg.GOOS,
+		GOARCH:         buildcfg.GOARCH,
+		GoVersion:      buildcfg.Version,
+		Experiment:     buildcfg.GOEXPERIMENT(),
+		Args:           os.Args[1:],
+		Set:            []string{},
+		Flags:          make(map[string]string),
+		BuildMode:      ctxt.BuildMode.String(),
+		LinkMode:       ctxt.LinkMode.String(),
+		LinkModeReason: ctxt.linkModeReason,
+		Symtab:         !*FlagS && !debug_s,
+		DWARF:          dwarfEnabled(ctxt),
+		CompressDWARF:  "none",
+		Inputs:         []printConfigInput{},
+	}
+	flag.Visit(func(f *flag.Flag) {
+		c.Set = append(c.Set, f.Name)
+	})
+	flag.VisitAll(func(f *flag.Flag) {
+		c.Flags[f.Name] = f.Value.String()
+	})
+	if debug_s {
+		// hostlinksetup moved -s aside for the host linker.
+		c.Flags["s"] = "true"
+	}
+	if ctxt.IsELF && !*FlagD && !*flagStaticPIE && ctxt.BuildMode != BuildModeCArchive {
+		if ctxt.IsInternal() {
+			c.Interp = ctxt.elfInterpreter()
+		} else {
+			c.Interp = interpreter
+		}
+	}
+	if ctxt.IsExternal() {
+		c.Extld = ctxt.extld()
+		c.Extldflags = flagExtldflags
+	}
+	if c.DWARF {
+		c.CompressDWARF = ctxt.compressDWARF.String()
+	}
+
+	for _, lib := range ctxt.Library {
+		if lib.Shlib != "" {
+			continue
+		}
+		c.Inputs = append(c.Inputs, printConfigInput{
+			Kind:    "package",
+			Package: lib.Pkg,
+			File:    lib.File,
+			SHA256:  hashInput(lib.File, 0, -1),
+		})
+	}
+	for _, h := range hostobj {
+		c.Inputs = append(c.Inputs, printConfigInput{
+			Kind:    "hostobj",
+			Package: h.pkg,
+			File:    h.file,
+			Offset:  h.off,
+			Length:  h.length,
+			SHA256:  hashInput(h.file, h.off, h.length),
+		})
+	}
+	for _, shlib := range ctxt.Shlibs {
+		c.Inputs = append(c.Inputs, printConfigInput{
+			Kind:   "shlib",
+			File:   shlib.Path,
+			SHA256: hashInput(shlib.Path, 0, -1),
+		})
+	}
+
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		Exitf("-print-config: %v", err)
+	}
+	ctxt.Bso.Flush()
+	os.Stdout.Write(append(data, '\n'))
+
+	if *flagPrintConfig == "exit" {
+		ctxt.Out.Close()
+		mayberemoveoutfile()
+		Exit(0)
+	}
+}
+
+// hashInput returns the SHA-256 of the length bytes of file at off, or
+// from off on if length is negative, in hex.
+func hashInput(file string, off, length int64) string {
+	f, err := os.Open(file)
+	if err != nil {
+		Exitf("-print-config: %v", err)
+	}
+	defer f.Close()
+	var r io.Reader = io.NewSectionReader(f, off, 1<<62)
+	if length >= 0 {
+		r = io.LimitReader(r, length)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		Exitf("-print-config: reading %s: %v", file, err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
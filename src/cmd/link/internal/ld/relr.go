@@ -0,0 +1,181 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"sort"
+)
+
+// Support for -pack-relative-relocs, which packs the relative dynamic
+// relocations of a PIE linked internally into a .relr.dyn section
+// (SHT_RELR, DT_RELR) instead of .rela. Most of the dynamic relocations
+// of a Go PIE are relative ones, for the pointers in its data, and
+// RELR encodes them as a list of addresses and bitmaps of the words
+// that follow each, a small fraction of the size of Elf64_Rela entries.
+// The word to relocate holds the link-time address already, as it does
+// with .rela, so the dynamic linker only adds the load address to it.
+//
+// The encoding depends on the distances between the relocated words,
+// which are known once the data sections are laid out, but .relr.dyn
+// is in the read-only data it follows, before addresses are assigned.
+// So the encoding starts afresh at each section, which makes its size
+// depend only on the offsets in the sections, and .relr.dyn is the
+// last section of its segment, after all the data it relocates.
+
+// ELF constants for RELR, which debug/elf does not define.
+const (
+	SHT_RELR   = elf.SectionType(19)
+	DT_RELRSZ  = elf.DynTag(35)
+	DT_RELR    = elf.DynTag(36)
+	DT_RELRENT = elf.DynTag(37)
+)
+
+// An elfRelrEntry is the location of a word to be relocated by RELR.
+type elfRelrEntry struct {
+	sym loader.Sym
+	off int64
+}
+
+// elfRelr holds the words to be relocated by RELR, recorded by the
+// architecture's adddynrel.
+var elfRelr []elfRelrEntry
+
+// elfRelrLoc is the location of a word to be relocated by RELR in its
+// section.
+type elfRelrLoc struct {
+	sect *sym.Section
+	off  int64
+}
+
+// elfRelrLocs holds the entries of elfRelr by section, once the data
+// is laid out.
+var elfRelrLocs []elfRelrLoc
+
+// ElfAddRelr is called by the architecture's adddynrel for the
+// relocation r in s that needs a relative dynamic relocation. With
+// -pack-relative-relocs, it records it for .relr.dyn and reports
+// true; otherwise, the caller emits an R_*_RELATIVE relocation.
+func ElfAddRelr(target *Target, ldr *loader.Loader, s loader.Sym, r loader.Reloc) bool {
+	if !*flagPackRelocs || !target.IsElf() || target.Arch.PtrSize != 8 || r.Siz() != 8 {
+		return false
+	}
+	// RELR can only relocate aligned words. Go symbols holding
+	// pointers are pointer aligned, but host object sections may not
+	// be.
+	if r.Off()%8 != 0 || (ldr.SymAlign(s) != 0 && ldr.SymAlign(s) < 8) {
+		return false
+	}
+	elfRelr = append(elfRelr, elfRelrEntry{s, int64(r.Off())})
+	return true
+}
+
+// allocateRelrSection allocates the .relr.dyn section at the end of
+// seg, once the data it relocates is laid out.
+func (state *dodataState) allocateRelrSection(ctxt *Link, seg *sym.Segment) {
+	if len(elfRelr) == 0 {
+		return
+	}
+	ldr := ctxt.loader
+	for _, e := range elfRelr {
+		s, off := e.sym, e.off
+		if outer := ldr.OuterSym(s); outer != 0 && ldr.SubSym(outer) != 0 {
+			// The value of a sub-symbol is its offset in its
+			// outer symbol until addresses are assigned.
+			s, off = outer, off+ldr.SymValue(s)
+		}
+		sect := ldr.SymSect(s)
+		if sect == nil || sect.Seg == &Segtext {
+			ldr.Errorf(e.sym, "relative relocation at offset %#x is not in the data", e.off)
+			continue
+		}
+		off += ldr.SymValue(s)
+		if off%8 != 0 || sect.Align < 8 {
+			ldr.Errorf(e.sym, "relative relocation at offset %#x is not aligned", e.off)
+			continue
+		}
+		elfRelrLocs = append(elfRelrLocs, elfRelrLoc{sect, off})
+	}
+	n := len(relrEncode(elfRelrLocs, func(sect *sym.Section) uint64 { return 0 }))
+
+	sect := addsection(ldr, ctxt.Arch, seg, ".relr.dyn", 04)
+	sect.Align = 8
+	state.datsize = Rnd(state.datsize, int64(sect.Align))
+	sect.Vaddr = uint64(state.datsize)
+	s := ldr.CreateSymForUpdate(".relr.dyn", 0)
+	s.SetType(sym.SRODATA)
+	s.SetReachable(true)
+	s.SetSize(int64(8 * n))
+	s.SetAlign(8)
+	ldr.SetSymSect(s.Sym(), sect)
+	state.datsize += s.Size()
+	sect.Length = uint64(state.datsize) - sect.Vaddr
+
+	// Write it out after the other symbols of the segment.
+	state.data[sym.SPCLNTAB] = append(state.data[sym.SPCLNTAB], s.Sym())
+}
+
+// relrData fills in the contents of .relr.dyn, once addresses are
+// assigned.
+func (ctxt *Link) relrData() {
+	if len(elfRelrLocs) == 0 {
+		return
+	}
+	ldr := ctxt.loader
+	s := ldr.MakeSymbolUpdater(ldr.Lookup(".relr.dyn", 0))
+	words := relrEncode(elfRelrLocs, func(sect *sym.Section) uint64 { return sect.Vaddr })
+	if int64(8*len(words)) != s.Size() {
+		Errorf(nil, ".relr.dyn has %d entries, want %d", len(words), s.Size()/8)
+		return
+	}
+	data := make([]byte, s.Size())
+	for i, w := range words {
+		ctxt.Arch.ByteOrder.PutUint64(data[8*i:], w)
+	}
+	s.SetData(data)
+}
+
+// relrEncode returns the RELR entries relocating the words at locs,
+// where the address of a section is given by base. Each entry is
+// either the address of a word, or a bitmap, with its low bit set,
+// of the 63 words following the last word relocated. A new address
+// entry is started at each section, so that the number of entries
+// does not depend on the addresses of the sections.
+func relrEncode(locs []elfRelrLoc, base func(*sym.Section) uint64) []uint64 {
+	sects := make(map[*sym.Section]int)
+	for _, l := range locs {
+		if _, ok := sects[l.sect]; !ok {
+			sects[l.sect] = len(sects)
+		}
+	}
+	sort.SliceStable(locs, func(i, j int) bool {
+		if si, sj := sects[locs[i].sect], sects[locs[j].sect]; si != sj {
+			return si < sj
+		}
+		return locs[i].off < locs[j].off
+	})
+
+	const nbits = 63
+	var words []uint64
+	for i := 0; i < len(locs); {
+		sect := locs[i].sect
+		words = append(words, base(sect)+uint64(locs[i].off))
+		next := locs[i].off + 8 // next word not relocated
+		for i++; i < len(locs) && locs[i].sect == sect && locs[i].off < next; i++ {
+			// Duplicate entries would relocate the word twice.
+		}
+		for i < len(locs) && locs[i].sect == sect && locs[i].off < next+8*nbits {
+			var bitmap uint64
+			for ; i < len(locs) && locs[i].sect == sect && locs[i].off < next+8*nbits; i++ {
+				bitmap |= 1 << uint((locs[i].off-next)/8)
+			}
+			words = append(words, bitmap<<1|1)
+			next += 8 * nbits
+		}
+	}
+	return words
+}
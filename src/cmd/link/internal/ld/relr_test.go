@@ -0,0 +1,42 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/sym"
+	"reflect"
+	"testing"
+)
+
+func TestRelrEncode(t *testing.T) {
+	data := &sym.Section{Name: ".data", Vaddr: 0x10000}
+	relro := &sym.Section{Name: ".data.rel.ro", Vaddr: 0x8000}
+	locs := []elfRelrLoc{
+		{data, 0x230}, // 70 words in
+		{data, 0x10},
+		{relro, 0x1000},
+		{data, 0},
+		{data, 0x8},
+		{data, 0}, // duplicate
+		{data, 0x1000},
+	}
+	base := func(sect *sym.Section) uint64 { return sect.Vaddr }
+	want := []uint64{
+		0x10000,     // data+0
+		0b11<<1 | 1, // data+0x8, data+0x10
+		1<<6<<1 | 1, // data+0x230, the 7th word of the next 63
+		0x11000,     // data+0x1000, too far for a bitmap
+		0x9000,      // relro+0x1000, in a new section
+	}
+	if got := relrEncode(locs, base); !reflect.DeepEqual(got, want) {
+		t.Errorf("relrEncode = %#x, want %#x", got, want)
+	}
+
+	// The number of entries does not depend on the section addresses.
+	data.Vaddr, relro.Vaddr = 0x10008, 0
+	if got := relrEncode(locs, base); len(got) != len(want) {
+		t.Errorf("relrEncode with moved sections returned %d entries, want %d", len(got), len(want))
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"strconv"
+	"strings"
+)
+
+// Support for -reserve-section, which reserves a zero-filled section
+// of the output for data written into the file after linking, such as
+// a license or a public key.
+//
+// The section is page-aligned, in the read-only segment unless it is
+// writable. The program finds it through go.reserve.<name>.start and
+// go.reserve.<name>.size, where name is the section name without its
+// leading dot, declared as zeroed uintptr variables:
+//
+//	//go:linkname licenseStart go.reserve.license.start
+//	var licenseStart uintptr
+//
+// If they are reachable, the linker sets the start to the address of
+// the section, with a relocation so that it accounts for the load
+// address of a position-independent executable, and the size to the
+// size of the section.
+//
+// Nothing the linker or the go command computes from the output covers
+// the section contents once they are written: the Go build ID is stored
+// in its own note and at the start of the text, and is not a hash of
+// the file. On darwin, however, the code signature covers the whole
+// file, so the output has to be signed again after it is patched.
+
+// A reservedSection is a section reserved with -reserve-section.
+type reservedSection struct {
+	name     string
+	size     int64
+	writable bool
+
+	sym   loader.Sym // the section symbol
+	start loader.Sym // go.reserve.<name>, marking its start
+}
+
+var reservedSections []reservedSection
+
+func addReserveSection(arg string) {
+	eq := strings.Index(arg, "=")
+	if eq < 0 {
+		Exitf("-reserve-section argument must be of the form name=size[,flags]: %s", arg)
+	}
+	r := reservedSection{name: arg[:eq]}
+	if !validReservedName(r.name) {
+		Exitf("-reserve-section: bad section name %q: must be a dot followed by letters, digits, underscores and dots", r.name)
+	}
+	for _, other := range reservedSections {
+		if other.name == r.name {
+			Exitf("-reserve-section: section %s reserved twice", r.name)
+		}
+	}
+	fields := strings.Split(arg[eq+1:], ",")
+	size, err := strconv.ParseInt(fields[0], 0, 64)
+	if err != nil || size <= 0 || size != int64(uint32(size)) {
+		Exitf("-reserve-section: bad size %q for section %s", fields[0], r.name)
+	}
+	r.size = size
+	for _, flag := range fields[1:] {
+		switch flag {
+		case "ro":
+			r.writable = false
+		case "rw":
+			r.writable = true
+		default:
+			Exitf("-reserve-section: unknown flag %q for section %s, want ro or rw", flag, r.name)
+		}
+	}
+	reservedSections = append(reservedSections, r)
+}
+
+// validReservedName reports whether name, the name of a reserved
+// section, is a dot followed by letters, digits, underscores and dots,
+// and does not end with one.
+func validReservedName(name string) bool {
+	if len(name) < 2 || name[0] != '.' || name[len(name)-1] == '.' || strings.Contains(name, "..") {
+		return false
+	}
+	for _, c := range name[1:] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// reserveSections creates the sections reserved with -reserve-section,
+// and sets the reachable variables describing them.
+func (ctxt *Link) reserveSections() {
+	if len(reservedSections) == 0 {
+		return
+	}
+	if !ctxt.IsELF && !(ctxt.IsDarwin() && ctxt.IsInternal()) {
+		Exitf("-reserve-section is only supported for ELF, and for Mach-O when linking internally")
+	}
+	ldr := ctxt.loader
+	for i := range reservedSections {
+		r := &reservedSections[i]
+		if ctxt.IsDarwin() && len(r.name)+1 > 16 {
+			// Mach-O names it __name, in 16 bytes.
+			Exitf("-reserve-section: section name %s too long for Mach-O", r.name)
+		}
+		if ldr.Lookup(r.name, 0) != 0 {
+			Exitf("-reserve-section: section %s already exists", r.name)
+		}
+		typ := sym.SELFROSECT
+		if r.writable {
+			typ = sym.SELFSECT
+		}
+		s := ldr.CreateSymForUpdate(r.name, 0)
+		s.SetType(typ)
+		s.SetReachable(true)
+		s.SetAlign(int32(*FlagRound))
+		s.SetSize(r.size)
+		r.sym = s.Sym()
+
+		// The section symbol is not in the symbol table, so
+		// relocations refer to a symbol marking its start, set once
+		// the output is laid out.
+		name := "go.reserve." + r.name[1:]
+		r.start = ctxt.xdefine(name, typ, 0)
+		ldr.SetAttrReachable(r.start, true)
+
+		if v := ctxt.reservedVar(name + ".start"); v != nil {
+			v.AddAddrPlus(ctxt.Arch, r.start, 0)
+		}
+		if v := ctxt.reservedVar(name + ".size"); v != nil {
+			v.AddUint(ctxt.Arch, uint64(r.size))
+		}
+	}
+}
+
+// reservedVar returns an updater for the variable name, emptied to be
+// filled, or nil if it is not reachable.
+func (ctxt *Link) reservedVar(name string) *loader.SymbolBuilder {
+	ldr := ctxt.loader
+	s := ldr.Lookup(name, 0)
+	if s == 0 || !ldr.AttrReachable(s) {
+		return nil
+	}
+	if ldr.SymSize(s) != int64(ctxt.Arch.PtrSize) {
+		Errorf(nil, "%s: not a variable of type uintptr", name)
+		return nil
+	}
+	sb := ldr.MakeSymbolUpdater(s)
+	sb.SetType(sym.SNOPTRDATA)
+	sb.SetSize(0)
+	sb.SetData(make([]byte, 0, ctxt.Arch.PtrSize))
+	sb.SetReadOnly(false)
+	sb.ResetRelocs()
+	return sb
+}
+
+// setReservedSections sets the symbols marking the start of the
+// reserved sections, once the output is laid out, and reports those
+// that have the name of another section of the output.
+func (ctxt *Link) setReservedSections() {
+	if len(reservedSections) == 0 {
+		return
+	}
+	count := make(map[string]int)
+	for _, seg := range Segments {
+		for _, sect := range seg.Sections {
+			count[sect.Name]++
+		}
+	}
+	ldr := ctxt.loader
+	for _, r := range reservedSections {
+		if count[r.name] > 1 {
+			Errorf(nil, "-reserve-section: section %s already exists", r.name)
+		}
+		ldr.SetSymValue(r.start, ldr.SymValue(r.sym))
+		ldr.SetSymSect(r.start, ldr.SymSect(r.sym))
+	}
+}
@@ -0,0 +1,496 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Support for -sectlayout, which places sections of host objects in
+// output sections of their own, described by a restricted form of
+// GNU ld linker script:
+//
+//	SECTIONS
+//	{
+//		.config 0x800000 : ALIGN(0x1000)
+//		{
+//			KEEP(*(.config))
+//			*(.config.*)
+//		}
+//	}
+//	INSERT AFTER .noptrdata;
+//
+// Each output section names the input sections it holds, by glob
+// patterns, and may give an address and an alignment. Input sections
+// wrapped in KEEP are kept even if nothing refers to them. The output
+// sections of a SECTIONS command are placed, in order, before or
+// after the named section of the Go program. Only data sections can
+// be placed, relative to the data sections laid out by dodata.
+//
+// Any other linker script construct is an error.
+
+// A layoutSection is an output section described by the -sectlayout
+// file.
+type layoutSection struct {
+	name    string
+	addr    uint64 // address, if hasAddr
+	hasAddr bool
+	align   int32
+	inputs  []layoutInput
+	where   string // "BEFORE" or "AFTER"
+	anchor  string // name of the section to place it next to
+	pos     string // file:line of the definition, for errors
+
+	syms []loader.Sym // input section symbols, in order
+	sect *sym.Section // allocated section
+}
+
+// A layoutInput is an input section description.
+type layoutInput struct {
+	pattern string // glob matching input section names
+	keep    bool
+}
+
+// loadSectLayout reads the -sectlayout file and assigns the host
+// object sections loaded to the output sections it describes.
+func (ctxt *Link) loadSectLayout() {
+	if !ctxt.IsELF {
+		Exitf("-sectlayout is only supported for ELF targets")
+	}
+	if ctxt.IsExternal() {
+		Exitf("-sectlayout is not supported when linking externally")
+	}
+	data, err := ioutil.ReadFile(*flagSectLayout)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	layout, err := parseSectLayout(*flagSectLayout, string(data))
+	if err != nil {
+		Exitf("%v", err)
+	}
+
+	ldr := ctxt.loader
+	seen := make(map[string]string)
+	for _, ls := range layout {
+		if prev, ok := seen[ls.name]; ok {
+			Exitf("%s: output section %s already defined at %s", ls.pos, ls.name, prev)
+		}
+		seen[ls.name] = ls.pos
+	}
+	claimed := make(map[loader.Sym]bool)
+	for _, ls := range layout {
+		for _, in := range ls.inputs {
+			for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+				name, ok := hostSectionName(ldr, s)
+				if !ok || claimed[s] {
+					continue
+				}
+				if match, _ := filepath.Match(in.pattern, name); !match {
+					continue
+				}
+				if ldr.SymType(s) == sym.STEXT {
+					Exitf("%s: input section %s of %s is executable; only data sections can be placed", ls.pos, name, ls.name)
+				}
+				claimed[s] = true
+				ls.syms = append(ls.syms, s)
+				if in.keep {
+					ctxt.sectLayoutKeep = append(ctxt.sectLayoutKeep, s)
+				}
+			}
+		}
+	}
+	ctxt.sectLayout = layout
+}
+
+// hostSectionName reports whether s is the symbol for a section of a
+// host object, and if so returns the name of the section. Host object
+// loaders name these symbols "pkg(section)".
+func hostSectionName(ldr *loader.Loader, s loader.Sym) (string, bool) {
+	if !ldr.IsExternal(s) {
+		return "", false
+	}
+	switch ldr.SymType(s) {
+	case sym.STEXT, sym.SRODATA, sym.SNOPTRDATA, sym.SNOPTRBSS, sym.SDATA, sym.SBSS:
+	default:
+		return "", false
+	}
+	name := ldr.SymName(s)
+	if !strings.HasSuffix(name, ")") {
+		return "", false
+	}
+	i := strings.LastIndex(name, "(")
+	if i < 0 || !strings.HasPrefix(name[i+1:], ".") {
+		return "", false
+	}
+	return name[i+1 : len(name)-1], true
+}
+
+// allocateLayoutSections allocates, in segment seg, the -sectlayout
+// output sections to be placed before the section named next, and
+// those to be placed after the last section allocated in seg. It is
+// called before each named data section is allocated, with next set
+// to its name, and with next empty at the end of a segment.
+func (state *dodataState) allocateLayoutSections(seg *sym.Segment, next string) {
+	ctxt := state.ctxt
+	if len(ctxt.sectLayout) == 0 {
+		return
+	}
+	var prev string
+	if n := len(seg.Sections); n > 0 {
+		prev = seg.Sections[n-1].Name
+	}
+	for _, ls := range ctxt.sectLayout {
+		if ls.sect == nil && ls.where == "AFTER" && ls.anchor == prev && prev != "" {
+			state.allocateLayoutSection(seg, ls)
+		}
+	}
+	for _, ls := range ctxt.sectLayout {
+		if ls.sect == nil && ls.where == "BEFORE" && ls.anchor == next && next != "" {
+			state.allocateLayoutSection(seg, ls)
+		}
+	}
+}
+
+// allocateLayoutSection allocates the section for ls in segment seg
+// and assigns its input sections to it.
+func (state *dodataState) allocateLayoutSection(seg *sym.Segment, ls *layoutSection) {
+	ctxt := state.ctxt
+	ldr := ctxt.loader
+	for _, sg := range []*sym.Segment{&Segtext, &Segrodata, &Segrelrodata, &Segdata} {
+		for _, sect := range sg.Sections {
+			if sect.Name == ls.name {
+				Errorf(nil, "%s: output section %s conflicts with a section of the Go program", ls.pos, ls.name)
+			}
+		}
+	}
+	if afterBss(seg) {
+		// Past the end of the initialized data, nothing but
+		// zeroes can be placed.
+		for _, s := range ls.syms {
+			if ldr.AttrReachable(s) && ldr.SymType(s) != sym.SNOPTRBSS && ldr.SymType(s) != sym.SBSS {
+				Errorf(nil, "%s: %s holds initialized data and cannot be placed %s %s", ls.pos, ls.name, strings.ToLower(ls.where), ls.anchor)
+				break
+			}
+		}
+	}
+	rwx := 04
+	if seg == &Segdata || seg == &Segrelrodata {
+		rwx = 06
+	}
+	sect := addsection(ldr, ctxt.Arch, seg, ls.name, rwx)
+	sect.Align = ls.align
+	for _, s := range ls.syms {
+		if ldr.AttrReachable(s) {
+			if a := symalign(ldr, s); a > sect.Align {
+				sect.Align = a
+			}
+		}
+	}
+	if sect.Align == 0 {
+		sect.Align = 1
+	}
+	state.datsize = Rnd(state.datsize, int64(sect.Align))
+	sect.Vaddr = uint64(state.datsize)
+	for _, s := range ls.syms {
+		if !ldr.AttrReachable(s) {
+			continue
+		}
+		state.datsize = aligndatsize(state, state.datsize, s)
+		ldr.SetSymSect(s, sect)
+		ldr.SetSymValue(s, int64(uint64(state.datsize)-sect.Vaddr))
+		state.datsize += ldr.SymSize(s)
+	}
+	sect.Length = uint64(state.datsize) - sect.Vaddr
+	ls.sect = sect
+}
+
+// afterBss reports whether the sections allocated so far in seg
+// include the zero-initialized data sections.
+func afterBss(seg *sym.Segment) bool {
+	for _, sect := range seg.Sections {
+		if sect.Name == ".bss" || sect.Name == ".noptrbss" {
+			return true
+		}
+	}
+	return false
+}
+
+// removeLayoutSyms removes the input sections placed by -sectlayout
+// from the symbols to be assigned to sections by type.
+func (state *dodataState) removeLayoutSyms() {
+	ctxt := state.ctxt
+	if len(ctxt.sectLayout) == 0 {
+		return
+	}
+	placed := make(map[loader.Sym]bool)
+	for _, ls := range ctxt.sectLayout {
+		for _, s := range ls.syms {
+			placed[s] = true
+		}
+	}
+	for symn := range state.data {
+		syms := state.data[symn][:0]
+		for _, s := range state.data[symn] {
+			if !placed[s] {
+				syms = append(syms, s)
+			}
+		}
+		state.data[symn] = syms
+	}
+}
+
+// restoreLayoutSyms puts the input sections placed by -sectlayout
+// back with the other data symbols, so that they are written out,
+// and checks that every output section was placed.
+func (state *dodataState) restoreLayoutSyms() {
+	ctxt := state.ctxt
+	ldr := ctxt.loader
+	for _, ls := range ctxt.sectLayout {
+		if ls.sect == nil {
+			Errorf(nil, "%s: cannot place %s %s %s: no such data section", ls.pos, ls.name, strings.ToLower(ls.where), ls.anchor)
+			continue
+		}
+		for _, s := range ls.syms {
+			if ldr.AttrReachable(s) {
+				symn := ldr.SymType(s)
+				state.data[symn] = append(state.data[symn], s)
+			}
+		}
+	}
+}
+
+// placeLayoutSection returns the address of sect, given that the
+// preceding section ends at va: the address requested by -sectlayout,
+// if any, and va otherwise.
+func (ctxt *Link) placeLayoutSection(sect *sym.Section, va uint64) uint64 {
+	for _, ls := range ctxt.sectLayout {
+		if ls.sect != sect || !ls.hasAddr {
+			continue
+		}
+		if ls.addr%uint64(sect.Align) != 0 {
+			Errorf(nil, "%s: address %#x of %s is not %d-byte aligned", ls.pos, ls.addr, ls.name, sect.Align)
+		}
+		if ls.addr < va {
+			Errorf(nil, "%s: address %#x of %s overlaps the preceding sections, which end at %#x", ls.pos, ls.addr, ls.name, va)
+			return va
+		}
+		return ls.addr
+	}
+	return va
+}
+
+// parseSectLayout parses the -sectlayout file named file, with
+// contents data.
+func parseSectLayout(file, data string) ([]*layoutSection, error) {
+	p := &layoutParser{file: file, line: 1, data: data}
+	var layout []*layoutSection
+	for {
+		tok := p.next()
+		if p.err != nil {
+			return nil, p.err
+		}
+		if tok == "" {
+			break
+		}
+		if tok != "SECTIONS" {
+			return nil, p.unsupported(tok)
+		}
+		p.expect("{")
+		var group []*layoutSection
+		for p.err == nil {
+			tok := p.next()
+			if tok == "}" {
+				break
+			}
+			group = append(group, p.outputSection(tok))
+		}
+		p.expect("INSERT")
+		where := p.next()
+		if where != "AFTER" && where != "BEFORE" && p.err == nil {
+			p.errorf("expected AFTER or BEFORE, found %q", where)
+		}
+		anchor := p.next()
+		if p.peek() == ";" {
+			p.next()
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		if len(group) == 0 {
+			return nil, fmt.Errorf("%s:%d: SECTIONS command without output sections", p.file, p.line)
+		}
+		for _, ls := range group {
+			ls.where, ls.anchor = where, anchor
+		}
+		layout = append(layout, group...)
+	}
+	return layout, nil
+}
+
+// A layoutParser splits a -sectlayout file into tokens.
+type layoutParser struct {
+	file string
+	line int
+	data string
+	err  error
+}
+
+func (p *layoutParser) errorf(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%s:%d: %s", p.file, p.line, fmt.Sprintf(format, args...))
+	}
+}
+
+func (p *layoutParser) unsupported(tok string) error {
+	p.errorf("unsupported linker script construct %q", tok)
+	return p.err
+}
+
+func (p *layoutParser) pos() string {
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+// next returns the next token, or "" at the end of the file or after
+// an error.
+func (p *layoutParser) next() string {
+	if p.err != nil {
+		return ""
+	}
+	for {
+		p.data = strings.TrimLeftFunc(p.data, func(r rune) bool {
+			if r == '\n' {
+				p.line++
+			}
+			return unicode.IsSpace(r)
+		})
+		if !strings.HasPrefix(p.data, "/*") {
+			break
+		}
+		end := strings.Index(p.data, "*/")
+		if end < 0 {
+			p.errorf("unterminated comment")
+			return ""
+		}
+		p.line += strings.Count(p.data[:end], "\n")
+		p.data = p.data[end+2:]
+	}
+	if p.data == "" {
+		return ""
+	}
+	n := strings.IndexAny(p.data, " \t\r\n(){}:;,=")
+	switch {
+	case n == 0:
+		n = 1
+	case n < 0:
+		n = len(p.data)
+	}
+	tok := p.data[:n]
+	p.data = p.data[n:]
+	return tok
+}
+
+func (p *layoutParser) peek() string {
+	saved := *p
+	tok := p.next()
+	*p = saved
+	return tok
+}
+
+func (p *layoutParser) expect(want string) {
+	if tok := p.next(); tok != want && p.err == nil {
+		p.errorf("expected %q, found %q", want, tok)
+	}
+}
+
+func (p *layoutParser) number(tok string) uint64 {
+	mult := uint64(1)
+	switch {
+	case strings.HasSuffix(tok, "K"):
+		mult, tok = 1<<10, tok[:len(tok)-1]
+	case strings.HasSuffix(tok, "M"):
+		mult, tok = 1<<20, tok[:len(tok)-1]
+	}
+	v, err := strconv.ParseUint(tok, 0, 64)
+	if err != nil {
+		p.errorf("bad number %q", tok)
+	}
+	return v * mult
+}
+
+// outputSection parses an output section description, starting with
+// its name, tok.
+func (p *layoutParser) outputSection(name string) *layoutSection {
+	ls := &layoutSection{name: name, pos: p.pos()}
+	if !strings.HasPrefix(name, ".") {
+		p.unsupported(name)
+		return ls
+	}
+	tok := p.next()
+	if tok != ":" {
+		ls.addr, ls.hasAddr = p.number(tok), true
+		p.expect(":")
+	}
+	tok = p.next()
+	if tok == "ALIGN" {
+		p.expect("(")
+		align := p.number(p.next())
+		if align == 0 || align&(align-1) != 0 || align > 1<<30 {
+			p.errorf("bad alignment %d", align)
+		}
+		ls.align = int32(align)
+		p.expect(")")
+		tok = p.next()
+	}
+	if tok != "{" {
+		p.unsupported(tok)
+		return ls
+	}
+	for p.err == nil {
+		tok := p.next()
+		if tok == "}" {
+			break
+		}
+		keep := tok == "KEEP"
+		if keep {
+			p.expect("(")
+			tok = p.next()
+		}
+		if tok != "*" || p.peek() != "(" {
+			if p.peek() == "(" {
+				p.errorf("unsupported file name pattern %q, only * is supported", tok)
+			} else {
+				p.unsupported(tok)
+			}
+			break
+		}
+		p.expect("(")
+		for p.err == nil {
+			tok := p.next()
+			if tok == ")" {
+				break
+			}
+			if strings.ContainsAny(tok, "(){}:;,=") || p.peek() == "(" {
+				p.unsupported(tok)
+				break
+			}
+			if _, err := filepath.Match(tok, ""); err != nil || tok == "" {
+				p.errorf("bad section name pattern %q", tok)
+				break
+			}
+			ls.inputs = append(ls.inputs, layoutInput{pattern: tok, keep: keep})
+		}
+		if keep {
+			p.expect(")")
+		}
+	}
+	return ls
+}
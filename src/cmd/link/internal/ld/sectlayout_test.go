@@ -0,0 +1,80 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSectLayout(t *testing.T) {
+	const src = `
+/* Two sections at the end of the initialized data. */
+SECTIONS
+{
+	.config 0x800000 : ALIGN(4K)
+	{
+		KEEP(*(.config))
+		*(.config.* .cfg)
+	}
+	.pad : { *(.pad) }
+}
+INSERT AFTER .noptrdata;
+
+SECTIONS { .early : { *(.early) } } INSERT BEFORE .rodata
+`
+	layout, err := parseSectLayout("x.ld", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []layoutSection
+	for _, ls := range layout {
+		got = append(got, *ls)
+	}
+	want := []layoutSection{
+		{
+			name: ".config", addr: 0x800000, hasAddr: true, align: 4096,
+			inputs: []layoutInput{{".config", true}, {".config.*", false}, {".cfg", false}},
+			where:  "AFTER", anchor: ".noptrdata", pos: "x.ld:5",
+		},
+		{
+			name:   ".pad",
+			inputs: []layoutInput{{".pad", false}},
+			where:  "AFTER", anchor: ".noptrdata", pos: "x.ld:10",
+		},
+		{
+			name:   ".early",
+			inputs: []layoutInput{{".early", false}},
+			where:  "BEFORE", anchor: ".rodata", pos: "x.ld:14",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSectLayout:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseSectLayoutErrors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"MEMORY { }", `x.ld:1: unsupported linker script construct "MEMORY"`},
+		{"SECTIONS { .a : { foo.o(.a) } } INSERT AFTER .data;", `unsupported file name pattern "foo.o"`},
+		{"SECTIONS { .a : { *(EXCLUDE_FILE(x) .a) } } INSERT AFTER .data;", `unsupported linker script construct "EXCLUDE_FILE"`},
+		{"SECTIONS { .a : AT(0x1000) { *(.a) } } INSERT AFTER .data;", `unsupported linker script construct "AT"`},
+		{"SECTIONS { .a : ALIGN(3) { *(.a) } } INSERT AFTER .data;", "bad alignment 3"},
+		{"SECTIONS { .a zz : { *(.a) } } INSERT AFTER .data;", `bad number "zz"`},
+		{"SECTIONS { .a : { *(.a) } }\nINSERT INTO .data;", `x.ld:2: expected AFTER or BEFORE, found "INTO"`},
+		{"SECTIONS { .a : { *(.a) } }", `expected "INSERT"`},
+		{"SECTIONS { } INSERT AFTER .data;", "SECTIONS command without output sections"},
+		{"/* comment", "unterminated comment"},
+	}
+	for _, test := range tests {
+		_, err := parseSectLayout("x.ld", test.src)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseSectLayout(%q): got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/internal/goobj"
+	"cmd/link/internal/sym"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Go shared library records the fingerprint of each of its packages
+// in a .note.go.pkg-hashes note. When linking with -linkshared, the
+// fingerprints are checked against those the importing packages were
+// compiled against, so that a stale library fails the link instead of
+// the runtime's check of the library's ABI hash when the program starts.
+
+// shlibPkgHashes returns the contents of the .note.go.pkg-hashes note
+// of a Go shared library linking libs, of which the packages not from
+// another shared library are its own.
+func shlibPkgHashes(libs []*sym.Library) []byte {
+	var buf bytes.Buffer
+	for _, l := range libs {
+		if l.Shlib != "" || l.Fingerprint.IsZero() {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %x\n", l.Pkg, l.Fingerprint[:])
+	}
+	return buf.Bytes()
+}
+
+// parseShlibPkgHashes parses the contents of a .note.go.pkg-hashes note.
+func parseShlibPkgHashes(data []byte) (map[string]goobj.FingerprintType, error) {
+	hashes := make(map[string]goobj.FingerprintType)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		f := strings.Fields(line)
+		var fp goobj.FingerprintType
+		if len(f) != 2 || hex.DecodedLen(len(f[1])) != len(fp) {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		if _, err := hex.Decode(fp[:], []byte(f[1])); err != nil {
+			return nil, fmt.Errorf("malformed line %q: %v", line, err)
+		}
+		hashes[f[0]] = fp
+	}
+	return hashes, nil
+}
+
+// staleShlibPackages returns a message for each package of shlib whose
+// fingerprint differs from the one the package importing it, in libs,
+// was compiled against.
+func staleShlibPackages(shlib *Shlib, libs map[string]*sym.Library) []string {
+	pkgs := make([]string, 0, len(shlib.PkgHashes))
+	for pkg := range shlib.PkgHashes {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	var stale []string
+	for _, pkg := range pkgs {
+		l := libs[pkg]
+		if l == nil || l.Shlib == "" || l.Fingerprint.IsZero() {
+			continue
+		}
+		if fp := shlib.PkgHashes[pkg]; fp != l.Fingerprint {
+			stale = append(stale, fmt.Sprintf("package %s has fingerprint %x in the library, but %s was compiled against %x", pkg, fp, l.Srcref, l.Fingerprint))
+		}
+	}
+	return stale
+}
+
+// shlibRebuildCommand returns the go command that rebuilds shlib.
+func shlibRebuildCommand(shlib *Shlib) string {
+	if filepath.Base(shlib.Path) == "libstd.so" {
+		return "go install -buildmode=shared std"
+	}
+	pkgs := make([]string, 0, len(shlib.PkgHashes))
+	for pkg := range shlib.PkgHashes {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	return "go install -buildmode=shared -linkshared " + strings.Join(pkgs, " ")
+}
+
+// checkShlibFingerprints exits with an error if any of the Go shared
+// libraries linked against is stale.
+func (ctxt *Link) checkShlibFingerprints() {
+	for i := range ctxt.Shlibs {
+		shlib := &ctxt.Shlibs[i]
+		stale := staleShlibPackages(shlib, ctxt.LibraryByPkg)
+		if len(stale) == 0 {
+			continue
+		}
+		Errorf(nil, "shared library %s is stale:\n\t%s\n\trebuild it with: %s", shlib.Path, strings.Join(stale, "\n\t"), shlibRebuildCommand(shlib))
+	}
+	exitIfErrors()
+}
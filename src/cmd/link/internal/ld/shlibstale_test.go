@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/goobj"
+	"cmd/link/internal/sym"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShlibPkgHashes(t *testing.T) {
+	fmtFP := goobj.FingerprintType{1, 2, 3, 4, 5, 6, 7, 8}
+	rtFP := goobj.FingerprintType{8, 7, 6, 5, 4, 3, 2, 1}
+	libs := []*sym.Library{
+		{Pkg: "fmt", Fingerprint: fmtFP},
+		{Pkg: "main"}, // not imported
+		{Pkg: "other", Fingerprint: rtFP, Shlib: "libother.so"},
+		{Pkg: "runtime", Fingerprint: rtFP},
+	}
+	note := shlibPkgHashes(libs)
+	if want := "fmt 0102030405060708\nruntime 0807060504030201\n"; string(note) != want {
+		t.Errorf("shlibPkgHashes = %q, want %q", note, want)
+	}
+	got, err := parseShlibPkgHashes(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]goobj.FingerprintType{"fmt": fmtFP, "runtime": rtFP}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseShlibPkgHashes = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"fmt\n", "fmt 0102\n", "fmt 010203040506070x\n", "fmt 0102030405060708 extra\n"} {
+		if _, err := parseShlibPkgHashes([]byte(bad)); err == nil {
+			t.Errorf("parseShlibPkgHashes(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestStaleShlibPackages(t *testing.T) {
+	oldFP := goobj.FingerprintType{1}
+	newFP := goobj.FingerprintType{2}
+	shlib := &Shlib{
+		Path: "/goroot/pkg/linux_amd64_dynlink/libstd.so",
+		PkgHashes: map[string]goobj.FingerprintType{
+			"fmt":     oldFP,
+			"runtime": oldFP,
+			"unused":  oldFP,
+		},
+	}
+	libs := map[string]*sym.Library{
+		"fmt":     {Pkg: "fmt", Srcref: "main", Fingerprint: newFP, Shlib: shlib.Path},
+		"runtime": {Pkg: "runtime", Srcref: "fmt", Fingerprint: oldFP, Shlib: shlib.Path},
+		"main":    {Pkg: "main"},
+	}
+	stale := staleShlibPackages(shlib, libs)
+	if len(stale) != 1 || !strings.Contains(stale[0], "package fmt has fingerprint 0100000000000000 in the library, but main was compiled against 0200000000000000") {
+		t.Errorf("staleShlibPackages = %q, want fmt reported as stale", stale)
+	}
+	if got, want := shlibRebuildCommand(shlib), "go install -buildmode=shared std"; got != want {
+		t.Errorf("shlibRebuildCommand = %q, want %q", got, want)
+	}
+
+	// Libraries built before the fingerprints were recorded are
+	// not checked.
+	shlib.PkgHashes = nil
+	if stale := staleShlibPackages(shlib, libs); len(stale) != 0 {
+		t.Errorf("staleShlibPackages without fingerprints = %q, want none", stale)
+	}
+
+	mylib := &Shlib{
+		Path:      "/pkg/libexample.com-a.so",
+		PkgHashes: map[string]goobj.FingerprintType{"example.com/b": oldFP, "example.com/a": oldFP},
+	}
+	if got, want := shlibRebuildCommand(mylib), "go install -buildmode=shared -linkshared example.com/a example.com/b"; got != want {
+		t.Errorf("shlibRebuildCommand = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Support for -sizecheck, which fails the link if the output is
+// larger than the limits given in a file, one per line:
+//
+//	# The whole binary, and the code in it.
+//	total <= 50MB
+//	section .text <= 20MB
+//	# A package, or a package and the packages below it.
+//	package main <= 64KiB
+//	package vendor/github.com/foo/... <= 1MB
+//
+// Sizes are in bytes, with an optional suffix B, KB, MB, GB (powers of
+// 1000) or KiB, MiB, GiB (powers of 1024).
+//
+// The total is the size of the sections with contents in the output,
+// DWARF included. A section limit is on the size of the named output
+// section. A package limit is on the size of the symbols of the
+// package, including those of its host objects, in the sections with
+// contents, DWARF excluded. Symbols created by the linker belong to no
+// package; they are listed as "(linker)".
+//
+// The limits are checked once the output is laid out. Each limit
+// exceeded is reported with the largest contributors to its size:
+// packages for the total and for a section, symbols for a package.
+
+// A sizeLimit is a limit read from the -sizecheck file.
+type sizeLimit struct {
+	kind  string // "total", "section" or "package"
+	name  string // section name or package pattern
+	limit int64
+	text  string // limit as written, for reports
+	pos   string // file:line of the limit, for errors
+}
+
+func (l *sizeLimit) String() string {
+	if l.kind == "total" {
+		return "total"
+	}
+	return l.kind + " " + l.name
+}
+
+// matchPackage reports whether the package pkg is covered by the
+// package limit l.
+func (l *sizeLimit) matchPackage(pkg string) bool {
+	if prefix := strings.TrimSuffix(l.name, "/..."); prefix != l.name {
+		return pkg == prefix || strings.HasPrefix(pkg, prefix+"/")
+	}
+	return pkg == l.name
+}
+
+// sizeCheck checks the output against the limits of the -sizecheck
+// file.
+func (ctxt *Link) sizeCheck() {
+	data, err := ioutil.ReadFile(*flagSizeCheck)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	limits, err := parseSizeLimits(*flagSizeCheck, string(data))
+	if err != nil {
+		Exitf("%v", err)
+	}
+
+	// Attribute the output to symbols and packages.
+	ldr := ctxt.loader
+	type contrib struct {
+		name string
+		size int64
+	}
+	symSize := make(map[loader.Sym]int64)
+	sectPkgSize := make(map[*sym.Section]map[string]int64)
+	ctxt.symSizes(func(s loader.Sym, sect *sym.Section, size int64) {
+		if sectHasContents(sect) {
+			symSize[s] += size
+		}
+		if sectPkgSize[sect] == nil {
+			sectPkgSize[sect] = make(map[string]int64)
+		}
+		sectPkgSize[sect][symPackage(ldr, s)] += size
+	})
+
+	// top formats the largest of the contributions in m.
+	top := func(m map[string]int64) string {
+		var list []contrib
+		for name, size := range m {
+			if size > 0 {
+				list = append(list, contrib{name, size})
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].size != list[j].size {
+				return list[i].size > list[j].size
+			}
+			return list[i].name < list[j].name
+		})
+		const maxContrib = 10
+		if len(list) > maxContrib {
+			list = list[:maxContrib]
+		}
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', tabwriter.AlignRight)
+		for _, c := range list {
+			fmt.Fprintf(w, "\t%d\t %s\n", c.size, c.name)
+		}
+		w.Flush()
+		return buf.String()
+	}
+
+	for _, l := range limits {
+		var size int64
+		contribs := make(map[string]int64)
+		switch l.kind {
+		case "total":
+			for _, seg := range Segments {
+				for _, sect := range seg.Sections {
+					if !sectHasContents(sect) {
+						continue
+					}
+					size += int64(sect.Length)
+					if seg == &Segdwarf {
+						contribs["(DWARF)"] += int64(sect.Length)
+						continue
+					}
+					for pkg, n := range sectPkgSize[sect] {
+						contribs[pkg] += n
+					}
+				}
+			}
+		case "section":
+			found := false
+			for _, seg := range Segments {
+				for _, sect := range seg.Sections {
+					if sect.Name != l.name {
+						continue
+					}
+					found = true
+					size += int64(sect.Length)
+					for pkg, n := range sectPkgSize[sect] {
+						contribs[pkg] += n
+					}
+				}
+			}
+			if !found {
+				// The section may only be in some outputs, for
+				// example in those that have cgo code.
+				continue
+			}
+		case "package":
+			for s, n := range symSize {
+				if l.matchPackage(symPackage(ldr, s)) {
+					size += n
+					contribs[ldr.SymName(s)] += n
+				}
+			}
+		}
+		if size > l.limit {
+			Errorf(nil, "%s: %s is %d bytes, over the limit of %s by %d bytes; largest contributors:\n%s", l.pos, l, size, l.text, size-l.limit, strings.TrimSuffix(top(contribs), "\n"))
+		}
+	}
+	exitIfErrors()
+}
+
+// symSizes calls f for each symbol in the loaded segments, with its
+// section and the number of bytes it accounts for. A symbol with
+// sub-symbols, such as a host object section or a carrier symbol, is
+// split between them; bytes covered by no sub-symbol, or by one that
+// overlaps an earlier one, are attributed to the outer symbol.
+func (ctxt *Link) symSizes(f func(s loader.Sym, sect *sym.Section, size int64)) {
+	ldr := ctxt.loader
+	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
+		if !ldr.AttrReachable(s) || ldr.SymSize(s) == 0 {
+			continue
+		}
+		if outer := ldr.OuterSym(s); outer != 0 && ldr.SubSym(outer) != 0 {
+			// Accounted for with the outer symbol. The symbols
+			// of a carrier, which has no sub-symbol list, are
+			// accounted for themselves.
+			continue
+		}
+		sect := ldr.SymSect(s)
+		if sect == nil || sect.Seg == &Segdwarf {
+			continue
+		}
+		if ldr.SubSym(s) == 0 {
+			f(s, sect, ldr.SymSize(s))
+			continue
+		}
+		var subs []loader.Sym
+		for ss := ldr.SubSym(s); ss != 0; ss = ldr.SubSym(ss) {
+			subs = append(subs, ss)
+		}
+		sort.SliceStable(subs, func(i, j int) bool {
+			return ldr.SymValue(subs[i]) < ldr.SymValue(subs[j])
+		})
+		pos, end := ldr.SymValue(s), ldr.SymValue(s)+ldr.SymSize(s)
+		rest := ldr.SymSize(s)
+		for _, ss := range subs {
+			start, stop := ldr.SymValue(ss), ldr.SymValue(ss)+ldr.SymSize(ss)
+			if start < pos {
+				start = pos
+			}
+			if stop > end {
+				stop = end
+			}
+			if stop > start {
+				f(ss, sect, stop-start)
+				rest -= stop - start
+				pos = stop
+			}
+		}
+		if rest > 0 {
+			f(s, sect, rest)
+		}
+	}
+}
+
+// sectHasContents reports whether sect takes space in the output file.
+func sectHasContents(sect *sym.Section) bool {
+	if sect.Name == ".tbss" {
+		return false
+	}
+	if sect.Seg == &Segdata {
+		// address sets the file length of the data segment to
+		// omit the BSS sections at its end.
+		return sect.Vaddr < Segdata.Vaddr+Segdata.Filelen
+	}
+	return true
+}
+
+// symPackage returns the package the symbol s belongs to, for size
+// attribution. Symbols of host objects belong to the package that
+// contains them, and those created by the linker to "(linker)".
+func symPackage(ldr *loader.Loader, s loader.Sym) string {
+	if pkg := ldr.SymPkg(s); pkg != "" {
+		return pkg
+	}
+	// Host object section symbols are named "pkg(.section)", and
+	// the symbols they define are their sub-symbols.
+	if outer := ldr.OuterSym(s); outer != 0 {
+		s = outer
+	}
+	if name := ldr.SymName(s); ldr.IsExternal(s) && strings.HasSuffix(name, ")") {
+		if i := strings.Index(name, "("); i > 0 {
+			return name[:i]
+		}
+	}
+	return "(linker)"
+}
+
+// parseSizeLimits parses the contents of the -sizecheck file.
+func parseSizeLimits(file, data string) ([]*sizeLimit, error) {
+	var limits []*sizeLimit
+	for i, line := range strings.Split(data, "\n") {
+		pos := fmt.Sprintf("%s:%d", file, i+1)
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		j := strings.Index(line, "<=")
+		if j < 0 {
+			return nil, fmt.Errorf("%s: missing <= in limit %q", pos, line)
+		}
+		l := &sizeLimit{text: strings.TrimSpace(line[j+2:]), pos: pos}
+		f := strings.Fields(line[:j])
+		switch {
+		case len(f) == 1 && f[0] == "total":
+			l.kind = "total"
+		case len(f) == 2 && (f[0] == "section" || f[0] == "package"):
+			l.kind, l.name = f[0], f[1]
+		case len(f) > 0 && (f[0] == "total" || f[0] == "section" || f[0] == "package"):
+			return nil, fmt.Errorf("%s: malformed %s limit %q", pos, f[0], line)
+		default:
+			return nil, fmt.Errorf("%s: unknown limit %q; want total, section or package", pos, line)
+		}
+		n, err := parseSize(l.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pos, err)
+		}
+		l.limit = n
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+// parseSize parses a size such as 512, 10KB or 1.5MiB.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+		{"B", 1},
+	}
+	num, mult := s, 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			num, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	if strings.Trim(num, "0123456789.") != "" {
+		return 0, fmt.Errorf("malformed size %q", s)
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed size %q", s)
+	}
+	return int64(v * mult), nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSizeLimits(t *testing.T) {
+	const src = `
+# Limits for the release build.
+total <= 50MB
+section .text<=20MiB  # code only
+package vendor/github.com/foo/... <= 1.5MB
+
+package main <= 4096
+`
+	limits, err := parseSizeLimits("x.txt", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []sizeLimit
+	for _, l := range limits {
+		got = append(got, *l)
+	}
+	want := []sizeLimit{
+		{kind: "total", limit: 50000000, text: "50MB", pos: "x.txt:3"},
+		{kind: "section", name: ".text", limit: 20 << 20, text: "20MiB", pos: "x.txt:4"},
+		{kind: "package", name: "vendor/github.com/foo/...", limit: 1500000, text: "1.5MB", pos: "x.txt:5"},
+		{kind: "package", name: "main", limit: 4096, text: "4096", pos: "x.txt:7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSizeLimits:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseSizeLimitsErrors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"total < 1MB", `x.txt:1: missing <= in limit "total < 1MB"`},
+		{"\nsymbol main.main <= 1KB", `x.txt:2: unknown limit "symbol main.main <= 1KB"; want total, section or package`},
+		{"section <= 1KB", `malformed section limit`},
+		{"package a b <= 1KB", `malformed package limit`},
+		{"total .text <= 1KB", `malformed total limit`},
+		{"total <= 1TB", `malformed size "1TB"`},
+		{"total <= -1", `malformed size "-1"`},
+		{"total <= 1e6", `malformed size "1e6"`},
+		{"total <= MB", `malformed size "MB"`},
+		{"total <=", `malformed size ""`},
+	}
+	for _, test := range tests {
+		_, err := parseSizeLimits("x.txt", test.src)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseSizeLimits(%q): got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
+
+func TestSizeLimitMatchPackage(t *testing.T) {
+	tests := []struct {
+		pattern, pkg string
+		want         bool
+	}{
+		{"main", "main", true},
+		{"net", "net/http", false},
+		{"net/...", "net", true},
+		{"net/...", "net/http", true},
+		{"net/...", "netip", false},
+		{"vendor/github.com/foo/...", "vendor/github.com/foo/bar", true},
+	}
+	for _, test := range tests {
+		l := &sizeLimit{kind: "package", name: test.pattern}
+		if got := l.matchPackage(test.pkg); got != test.want {
+			t.Errorf("package %s matches %s = %v, want %v", test.pattern, test.pkg, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/bio"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Support for -sizereport, which writes a JSON report of what makes up
+// the output, once it is laid out:
+//
+//	{
+//		"linkmode": "internal",
+//		"total": 2134016,
+//		"sections": [
+//			{
+//				"name": ".text",
+//				"size": 1046528,
+//				"padding": 6731,
+//				"packages": [{"package": "runtime", "size": 461352}, ...]
+//			},
+//			...
+//		],
+//		"packages": [
+//			{
+//				"package": "runtime",
+//				"size": 1052672,
+//				"sections": [{"section": ".text", "size": 461352}, ...]
+//			},
+//			...
+//		]
+//	}
+//
+// The sections are those of the output, in address order, and the
+// total is the size of the sections with contents, as for -sizecheck.
+// The size of a section is split between the packages of its symbols,
+// with the bytes between the symbols, for alignment, as its padding.
+// Symbols created by the linker belong to the pseudo-package
+// "(linker)", and the DWARF sections to "(DWARF)". The symbols of a
+// host object belong to the object, as "pkg(file.o)", rather than to
+// the package that contains it. Sections without contents, such as
+// .bss, are marked "nobits" and not counted in the package sizes.
+//
+// When linking externally, the report is of the Go object passed to
+// the external linker, which adds the host objects and C libraries
+// itself.
+
+type sizeReport struct {
+	LinkMode string              `json:"linkmode"`
+	Total    int64               `json:"total"`
+	Sections []sizeReportSection `json:"sections"`
+	Packages []sizeReportPackage `json:"packages"`
+}
+
+type sizeReportSection struct {
+	Name     string          `json:"name"`
+	Size     int64           `json:"size"`
+	Padding  int64           `json:"padding"`
+	NoBits   bool            `json:"nobits,omitempty"`
+	Packages []sizeReportPkg `json:"packages"`
+}
+
+type sizeReportPkg struct {
+	Package string `json:"package"`
+	Size    int64  `json:"size"`
+}
+
+type sizeReportPackage struct {
+	Package  string           `json:"package"`
+	Size     int64            `json:"size"`
+	Sections []sizeReportSect `json:"sections"`
+}
+
+type sizeReportSect struct {
+	Section string `json:"section"`
+	Size    int64  `json:"size"`
+}
+
+// A hostObjSyms is the range of symbols created by loading a host
+// object, for -sizereport and the symbol table to attribute them to it.
+type hostObjSyms struct {
+	start, end loader.Sym
+	name       string
+}
+
+var hostObjSymRanges []hostObjSyms
+
+// recordHostObjSyms returns a function that loads a host object with
+// ld and records the symbols it creates.
+func recordHostObjSyms(ld func(*Link, *bio.Reader, string, int64, string)) func(*Link, *bio.Reader, string, int64, string) {
+	return func(ctxt *Link, f *bio.Reader, pkg string, length int64, pn string) {
+		start := loader.Sym(ctxt.loader.NSym())
+		ld(ctxt, f, pkg, length, pn)
+		end := loader.Sym(ctxt.loader.NSym())
+		if end > start {
+			hostObjSymRanges = append(hostObjSymRanges, hostObjSyms{start, end, hostObjName(pkg, pn)})
+		}
+	}
+}
+
+// hostObjName returns the name of the host object pn of package pkg in
+// reports. An archive member "dir/archive.a(file.o)" is named by its
+// package and member name, as the archive is usually in the build
+// cache.
+func hostObjName(pkg, pn string) string {
+	if i := strings.LastIndex(pn, "("); i >= 0 && strings.HasSuffix(pn, ")") {
+		return pkg + pn[i:]
+	}
+	return pkg + "(" + filepath.Base(pn) + ")"
+}
+
+// hostObjOf returns the name of the host object that created s, or ""
+// if s was not created by loading a host object.
+func hostObjOf(s loader.Sym) string {
+	i := sort.Search(len(hostObjSymRanges), func(i int) bool {
+		return hostObjSymRanges[i].end > s
+	})
+	if i < len(hostObjSymRanges) && hostObjSymRanges[i].start <= s {
+		return hostObjSymRanges[i].name
+	}
+	return ""
+}
+
+// writeSizeReport writes the -sizereport file.
+func (ctxt *Link) writeSizeReport() {
+	ldr := ctxt.loader
+
+	// owner returns the package or host object s is attributed to.
+	owner := func(s loader.Sym) string {
+		// The symbols defined by a host object are sub-symbols
+		// of its section symbols.
+		o := s
+		if outer := ldr.OuterSym(s); outer != 0 {
+			o = outer
+		}
+		if name := hostObjOf(o); name != "" {
+			return name
+		}
+		return symPackage(ldr, s)
+	}
+	sectPkgSize := make(map[string]map[string]int64)
+	ctxt.symSizes(func(s loader.Sym, sect *sym.Section, size int64) {
+		if sectPkgSize[sect.Name] == nil {
+			sectPkgSize[sect.Name] = make(map[string]int64)
+		}
+		sectPkgSize[sect.Name][owner(s)] += size
+	})
+
+	report := sizeReport{LinkMode: ctxt.LinkMode.String()}
+	index := make(map[string]int) // section name to index in report.Sections
+	for _, seg := range Segments {
+		for _, sect := range seg.Sections {
+			i, ok := index[sect.Name]
+			if !ok {
+				i = len(report.Sections)
+				index[sect.Name] = i
+				report.Sections = append(report.Sections, sizeReportSection{Name: sect.Name})
+			}
+			rs := &report.Sections[i]
+			rs.Size += int64(sect.Length)
+			if !sectHasContents(sect) {
+				rs.NoBits = true
+				continue
+			}
+			report.Total += int64(sect.Length)
+			if seg == &Segdwarf {
+				if sectPkgSize[sect.Name] == nil {
+					sectPkgSize[sect.Name] = make(map[string]int64)
+				}
+				sectPkgSize[sect.Name]["(DWARF)"] += int64(sect.Length)
+			}
+		}
+	}
+
+	pkgs := make(map[string]*sizeReportPackage)
+	for i := range report.Sections {
+		rs := &report.Sections[i]
+		rs.Packages = []sizeReportPkg{}
+		if rs.NoBits {
+			continue
+		}
+		used := int64(0)
+		for pkg, n := range sectPkgSize[rs.Name] {
+			if n == 0 {
+				continue
+			}
+			used += n
+			rs.Packages = append(rs.Packages, sizeReportPkg{pkg, n})
+			p := pkgs[pkg]
+			if p == nil {
+				p = &sizeReportPackage{Package: pkg}
+				pkgs[pkg] = p
+			}
+			p.Size += n
+			p.Sections = append(p.Sections, sizeReportSect{rs.Name, n})
+		}
+		rs.Padding = rs.Size - used
+		sort.Slice(rs.Packages, func(i, j int) bool {
+			a, b := rs.Packages[i], rs.Packages[j]
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+			return a.Package < b.Package
+		})
+	}
+	report.Packages = []sizeReportPackage{}
+	for _, p := range pkgs {
+		report.Packages = append(report.Packages, *p)
+	}
+	sort.Slice(report.Packages, func(i, j int) bool {
+		a, b := report.Packages[i], report.Packages[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Package < b.Package
+	})
+
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		Exitf("-sizereport: %v", err)
+	}
+	if err := ioutil.WriteFile(*flagSizeReport, append(data, '\n'), 0666); err != nil {
+		Exitf("-sizereport: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Support for -splitdwarf, which moves the DWARF sections and a copy
+// of the symbol table of the output to a companion file, as
+//
+//	objcopy --only-keep-debug out out.debug
+//	objcopy --strip-debug --add-gnu-debuglink=out.debug out
+//
+// would, without needing binutils for the target. Like -o-stripped,
+// it works on the final output, after any external link.
+//
+// The companion has the section headers of the output, with the same
+// addresses, so that debuggers can match its sections with those of
+// the output, but only the contents of the non-loaded sections and of
+// the notes. The output gets a .gnu_debuglink section naming the
+// companion, which debuggers look for in the directory of the output,
+// and holding its CRC-32.
+
+// writeSplitDWARF moves the DWARF sections and the symbol table of the
+// output to the -splitdwarf file.
+func (ctxt *Link) writeSplitDWARF() {
+	data, err := ioutil.ReadFile(*flagOutfile)
+	if err != nil {
+		Exitf("-splitdwarf: %v", err)
+	}
+	debug, err := elfOnlyKeepDebug(data)
+	if err != nil {
+		Exitf("-splitdwarf: %s: %v", *flagOutfile, err)
+	}
+	out, err := elfStrip(data, stripDWARF|ctxt.strip&stripSymtab)
+	if err != nil {
+		Exitf("-splitdwarf: %s: %v", *flagOutfile, err)
+	}
+	out, err = elfAddSection(out, ".gnu_debuglink", elf.SHT_PROGBITS, 4, gnuDebuglink(ctxt.Arch.ByteOrder, filepath.Base(*flagSplitDWARF), debug))
+	if err != nil {
+		Exitf("-splitdwarf: %s: %v", *flagOutfile, err)
+	}
+	mode := os.FileMode(0777)
+	if fi, err := os.Stat(*flagOutfile); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := ioutil.WriteFile(*flagOutfile, out, mode); err != nil {
+		Exitf("-splitdwarf: %v", err)
+	}
+	os.Remove(*flagSplitDWARF)
+	if err := ioutil.WriteFile(*flagSplitDWARF, debug, 0666); err != nil {
+		Exitf("-splitdwarf: %v", err)
+	}
+}
+
+// gnuDebuglink returns the contents of the .gnu_debuglink section
+// naming the companion file name, with contents debug.
+func gnuDebuglink(bo binary.ByteOrder, name string, debug []byte) []byte {
+	b := append([]byte(name), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	var crc [4]byte
+	bo.PutUint32(crc[:], crc32.ChecksumIEEE(debug))
+	return append(b, crc[:]...)
+}
+
+// elfOnlyKeepDebug returns the companion file of the ELF file data for
+// -splitdwarf: a file with the same section headers, in which only
+// the DWARF sections, the symbol table, the string tables and the
+// notes have contents. It has no program headers.
+//
+// The go command completes the Go build ID of the output after the
+// link, from a hash of the output, which depends on the companion
+// through the CRC in .gnu_debuglink, so the Go build ID note of the
+// companion keeps the build ID given to the linker. Its ELF build ID
+// note is that of the output.
+func elfOnlyKeepDebug(data []byte) ([]byte, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bo := f.ByteOrder
+	shdrs, err := elfReadShdrs(f, data)
+	if err != nil {
+		return nil, err
+	}
+	_, _, shstrndx := elfShdrTable(f, data)
+
+	var ehsize int
+	if f.Class == elf.ELFCLASS64 {
+		ehsize = int(bo.Uint16(data[0x34:]))
+	} else {
+		ehsize = int(bo.Uint16(data[0x28:]))
+	}
+	out := append([]byte(nil), data[:ehsize]...)
+
+	for i, s := range f.Sections {
+		sh := &shdrs[i]
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+		keep := false
+		switch {
+		case s.Type == elf.SHT_NOTE:
+			keep = true
+		case s.Flags&elf.SHF_ALLOC != 0 || s.Type == elf.SHT_NOBITS:
+		case strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_"):
+			keep = true
+		case s.Type == elf.SHT_SYMTAB || s.Type == elf.SHT_STRTAB || i == shstrndx:
+			keep = true
+		}
+		if !keep {
+			sh.Type = uint32(elf.SHT_NOBITS)
+			sh.Off = uint64(len(out))
+			continue
+		}
+		off := uint64(len(out))
+		if sh.Addralign > 1 {
+			off = uint64(Rnd(int64(off), int64(sh.Addralign)))
+		}
+		out = append(out, make([]byte, off-uint64(len(out)))...)
+		out = append(out, data[s.Offset:s.Offset+s.FileSize]...)
+		sh.Off = off
+	}
+
+	var shdata bytes.Buffer
+	for i := range shdrs {
+		elfWriteShdr(&shdata, f, &shdrs[i])
+	}
+	shoff := uint64(Rnd(int64(len(out)), 8))
+	out = append(out, make([]byte, shoff-uint64(len(out)))...)
+	out = append(out, shdata.Bytes()...)
+	if f.Class == elf.ELFCLASS64 {
+		bo.PutUint64(out[0x20:], 0) // e_phoff
+		bo.PutUint64(out[0x28:], shoff)
+		bo.PutUint16(out[0x38:], 0) // e_phnum
+	} else {
+		bo.PutUint32(out[0x1c:], 0)
+		bo.PutUint32(out[0x20:], uint32(shoff))
+		bo.PutUint16(out[0x2c:], 0)
+	}
+	return out, nil
+}
+
+// elfAddSection returns a copy of the ELF file data with a new,
+// non-loaded section with the given name, type, alignment and
+// contents, after the other sections.
+func elfAddSection(data []byte, name string, typ elf.SectionType, align uint64, contents []byte) ([]byte, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bo := f.ByteOrder
+	shdrs, err := elfReadShdrs(f, data)
+	if err != nil {
+		return nil, err
+	}
+	shoff, shentsize, shstrndx := elfShdrTable(f, data)
+	if shstrndx == 0 || shstrndx >= len(shdrs) {
+		return nil, errors.New("no section name string table")
+	}
+
+	// Drop the section header table if it ends the file, as it is
+	// written again below.
+	end := uint64(len(data))
+	if shoff+uint64(len(shdrs)*shentsize) == end && shoff >= elfLoadedEnd(f, data) {
+		end = shoff
+	}
+	out := append([]byte(nil), data[:end]...)
+
+	// Add the name to the section name string table, moving it to
+	// the end of the file unless it is there already.
+	shstr := &shdrs[shstrndx]
+	if shstr.Off+shstr.Size != uint64(len(out)) {
+		strs := data[shstr.Off : shstr.Off+shstr.Size]
+		shstr.Off = uint64(len(out))
+		out = append(out, strs...)
+	}
+	nameoff := shstr.Size
+	out = append(out, name...)
+	out = append(out, 0)
+	shstr.Size += uint64(len(name) + 1)
+
+	off := uint64(Rnd(int64(len(out)), int64(align)))
+	out = append(out, make([]byte, off-uint64(len(out)))...)
+	out = append(out, contents...)
+	shdrs = append(shdrs, elf.Section64{
+		Name:      uint32(nameoff),
+		Type:      uint32(typ),
+		Off:       off,
+		Size:      uint64(len(contents)),
+		Addralign: align,
+	})
+
+	var shdata bytes.Buffer
+	for i := range shdrs {
+		elfWriteShdr(&shdata, f, &shdrs[i])
+	}
+	shoff = uint64(Rnd(int64(len(out)), 8))
+	out = append(out, make([]byte, shoff-uint64(len(out)))...)
+	out = append(out, shdata.Bytes()...)
+	if f.Class == elf.ELFCLASS64 {
+		bo.PutUint64(out[0x28:], shoff)
+		bo.PutUint16(out[0x3c:], uint16(len(shdrs)))
+	} else {
+		bo.PutUint32(out[0x20:], uint32(shoff))
+		bo.PutUint16(out[0x30:], uint16(len(shdrs)))
+	}
+	return out, nil
+}
@@ -0,0 +1,519 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/internal/codesign"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Support for -o-stripped, which writes a stripped copy of the output
+// next to it, for release pipelines that ship a stripped binary and
+// keep the full one for symbolization. The copy is made from the
+// final output, after any external link, by dropping the DWARF
+// sections and the symbol table and fixing up the headers. The loaded
+// segments are copied unchanged, so the two files have the same ELF
+// build ID note or Mach-O UUID, if any, and the same Go build ID.
+
+// writeStripped writes the stripped copy of the output to the
+// -o-stripped file.
+func (ctxt *Link) writeStripped() {
+	data, err := ioutil.ReadFile(*flagOutfile)
+	if err != nil {
+		Exitf("writing stripped output: %v", err)
+	}
+	var out []byte
+	switch {
+	case ctxt.IsELF:
+		out, err = elfStrip(data, stripSymtab|stripDWARF)
+	case ctxt.IsDarwin():
+		out, err = machoStrip(data)
+	}
+	if err != nil {
+		Exitf("writing stripped output: %s: %v", *flagOutfile, err)
+	}
+	// The go command completes the build ID of the output it ran the
+	// linker for, once it is written, but does not know about the
+	// stripped copy. Complete it here the same way.
+	if id := *flagBuildid; strings.Contains(id, "/") {
+		out = bytes.ReplaceAll(out, []byte(id), []byte(finalBuildID(data, id)))
+	}
+	mode := os.FileMode(0777)
+	if fi, err := os.Stat(*flagOutfile); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	os.Remove(*flagOutStripped)
+	if err := ioutil.WriteFile(*flagOutStripped, out, mode); err != nil {
+		Exitf("writing stripped output: %v", err)
+	}
+	if ctxt.NeedCodeSign() {
+		if err := machoCodeSign(ctxt, *flagOutStripped); err != nil {
+			Exitf("%s: code signing failed: %v", *flagOutStripped, err)
+		}
+	}
+}
+
+// finalBuildID returns the build ID that the go command gives the output
+// data, linked with build ID id: the last part of id is replaced by a
+// hash of data, with the occurrences of id and any Mach-O code
+// signature cleared. See updateBuildID in cmd/go/internal/work.
+func finalBuildID(data []byte, id string) string {
+	data = bytes.ReplaceAll(data, []byte(id), make([]byte, len(id)))
+	if f, err := macho.NewFile(bytes.NewReader(data)); err == nil {
+		if cmd, ok := codesign.FindCodeSigCmd(f); ok && uint64(cmd.Dataoff)+uint64(cmd.Datasize) <= uint64(len(data)) {
+			copy(data[cmd.Dataoff:cmd.Dataoff+cmd.Datasize], make([]byte, cmd.Datasize))
+		}
+	}
+	h := sha256.Sum256(data)
+	return id[:strings.LastIndex(id, "/")+1] + base64.RawURLEncoding.EncodeToString(h[:15])
+}
+
+// elfStrip returns a copy of the ELF file data without the parts
+// selected by parts: its DWARF sections, if stripDWARF is set, and its
+// symbol table, if stripSymtab is set.
+func elfStrip(data []byte, parts stripMode) ([]byte, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bo := f.ByteOrder
+	is64 := f.Class == elf.ELFCLASS64
+	shoff, shentsize, shstrndx := elfShdrTable(f, data)
+	shdrs, err := elfReadShdrs(f, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Choose the sections to remove: the DWARF sections, the symbol
+	// table and its string table, and relocations for them.
+	remove := make([]bool, len(f.Sections))
+	for i, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 {
+			continue
+		}
+		isDWARF := strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_")
+		if isDWARF && parts&stripDWARF != 0 || s.Type == elf.SHT_SYMTAB && parts&stripSymtab != 0 {
+			remove[i] = true
+		}
+	}
+	for i, s := range f.Sections {
+		if (s.Type == elf.SHT_REL || s.Type == elf.SHT_RELA) && s.Flags&elf.SHF_ALLOC == 0 && int(s.Info) < len(remove) && remove[s.Info] {
+			remove[i] = true
+		}
+	}
+	for i, s := range f.Sections {
+		if s.Type != elf.SHT_STRTAB || i == shstrndx {
+			continue
+		}
+		used, usedByRemoved := false, false
+		for j, t := range f.Sections {
+			if int(t.Link) == i {
+				if remove[j] {
+					usedByRemoved = true
+				} else {
+					used = true
+				}
+			}
+		}
+		if usedByRemoved && !used {
+			remove[i] = true
+		}
+	}
+	index := make([]uint32, len(f.Sections))
+	n := uint32(0)
+	for i := range f.Sections {
+		if !remove[i] {
+			index[i] = n
+			n++
+		}
+	}
+	newIndex := func(i uint32) uint32 {
+		if int(i) >= len(index) || remove[i] {
+			return 0
+		}
+		return index[i]
+	}
+
+	// The loaded part of the file, which starts with the program
+	// headers, is copied unchanged.
+	end := elfLoadedEnd(f, data)
+	out := append([]byte(nil), data[:end]...)
+
+	// The other sections kept follow it.
+	for i, s := range f.Sections {
+		sh := &shdrs[i]
+		if remove[i] || s.Type == elf.SHT_NULL || s.Flags&elf.SHF_ALLOC != 0 || sh.Off+sh.Size <= end {
+			continue
+		}
+		off := uint64(len(out))
+		if s.Type != elf.SHT_NOBITS {
+			if sh.Addralign > 1 {
+				off = uint64(Rnd(int64(off), int64(sh.Addralign)))
+			}
+			out = append(out, make([]byte, off-uint64(len(out)))...)
+			out = append(out, data[sh.Off:sh.Off+sh.Size]...)
+		}
+		sh.Off = off
+	}
+
+	// Write the section header table, in place if it was in the
+	// loaded part of the file, and at the end otherwise.
+	var shdata bytes.Buffer
+	for i := range f.Sections {
+		if remove[i] {
+			continue
+		}
+		sh := shdrs[i]
+		sh.Link = newIndex(sh.Link)
+		if sh.Type == uint32(elf.SHT_REL) || sh.Type == uint32(elf.SHT_RELA) || sh.Flags&uint64(elf.SHF_INFO_LINK) != 0 {
+			sh.Info = newIndex(sh.Info)
+		}
+		elfWriteShdr(&shdata, f, &sh)
+	}
+	oldSize := uint64(len(f.Sections) * shentsize)
+	if shoff+oldSize <= end {
+		copy(out[shoff:shoff+oldSize], make([]byte, oldSize))
+		copy(out[shoff:], shdata.Bytes())
+	} else {
+		shoff = uint64(Rnd(int64(len(out)), 8))
+		out = append(out, make([]byte, shoff-uint64(len(out)))...)
+		out = append(out, shdata.Bytes()...)
+	}
+	if is64 {
+		bo.PutUint64(out[0x28:], shoff)
+		bo.PutUint16(out[0x3c:], uint16(n))
+		bo.PutUint16(out[0x3e:], uint16(newIndex(uint32(shstrndx))))
+	} else {
+		bo.PutUint32(out[0x20:], uint32(shoff))
+		bo.PutUint16(out[0x30:], uint16(n))
+		bo.PutUint16(out[0x32:], uint16(newIndex(uint32(shstrndx))))
+	}
+
+	// The dynamic symbols refer to their sections by index, which
+	// changes if a removed section came before a kept one.
+	for i, s := range f.Sections {
+		if s.Type != elf.SHT_DYNSYM {
+			continue
+		}
+		symsize, shndxoff := elf.Sym32Size, 14
+		if is64 {
+			symsize, shndxoff = elf.Sym64Size, 6
+		}
+		sh := shdrs[i]
+		for off := sh.Off; off+uint64(symsize) <= sh.Off+sh.Size; off += uint64(symsize) {
+			p := out[off+uint64(shndxoff):]
+			if shndx := bo.Uint16(p); shndx != 0 && shndx < uint16(elf.SHN_LORESERVE) {
+				bo.PutUint16(p, uint16(newIndex(uint32(shndx))))
+			}
+		}
+	}
+	return out, nil
+}
+
+// elfShdrTable returns the offset of the section header table of the
+// ELF file f, with contents data, the size of its entries and the
+// index of the section name string table.
+func elfShdrTable(f *elf.File, data []byte) (shoff uint64, shentsize, shstrndx int) {
+	bo := f.ByteOrder
+	if f.Class == elf.ELFCLASS64 {
+		return bo.Uint64(data[0x28:]), int(bo.Uint16(data[0x3a:])), int(bo.Uint16(data[0x3e:]))
+	}
+	return uint64(bo.Uint32(data[0x20:])), int(bo.Uint16(data[0x2e:])), int(bo.Uint16(data[0x32:]))
+}
+
+// elfReadShdrs returns the raw section headers of the ELF file f, with
+// contents data, to copy the fields that debug/elf does not keep.
+func elfReadShdrs(f *elf.File, data []byte) ([]elf.Section64, error) {
+	shoff, shentsize, _ := elfShdrTable(f, data)
+	shdrs := make([]elf.Section64, len(f.Sections))
+	for i := range shdrs {
+		r := bytes.NewReader(data[shoff+uint64(i*shentsize):])
+		var err error
+		if f.Class == elf.ELFCLASS64 {
+			err = binary.Read(r, f.ByteOrder, &shdrs[i])
+		} else {
+			var sh elf.Section32
+			err = binary.Read(r, f.ByteOrder, &sh)
+			shdrs[i] = elf.Section64{
+				Name: sh.Name, Type: sh.Type, Flags: uint64(sh.Flags), Addr: uint64(sh.Addr),
+				Off: uint64(sh.Off), Size: uint64(sh.Size), Link: sh.Link, Info: sh.Info,
+				Addralign: uint64(sh.Addralign), Entsize: uint64(sh.Entsize),
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return shdrs, nil
+}
+
+// elfWriteShdr writes the section header sh to buf, in the format of
+// the ELF file f.
+func elfWriteShdr(buf *bytes.Buffer, f *elf.File, sh *elf.Section64) {
+	if f.Class == elf.ELFCLASS64 {
+		binary.Write(buf, f.ByteOrder, sh)
+		return
+	}
+	binary.Write(buf, f.ByteOrder, &elf.Section32{
+		Name: sh.Name, Type: sh.Type, Flags: uint32(sh.Flags), Addr: uint32(sh.Addr),
+		Off: uint32(sh.Off), Size: uint32(sh.Size), Link: sh.Link, Info: sh.Info,
+		Addralign: uint32(sh.Addralign), Entsize: uint32(sh.Entsize),
+	})
+}
+
+// elfLoadedEnd returns the end of the loaded part of the ELF file f,
+// with contents data: the headers, the segments and the allocated
+// sections.
+func elfLoadedEnd(f *elf.File, data []byte) uint64 {
+	bo := f.ByteOrder
+	var end uint64
+	if f.Class == elf.ELFCLASS64 {
+		end = bo.Uint64(data[0x20:]) + uint64(len(f.Progs))*uint64(bo.Uint16(data[0x36:]))
+	} else {
+		end = uint64(bo.Uint32(data[0x1c:])) + uint64(len(f.Progs))*uint64(bo.Uint16(data[0x2a:]))
+	}
+	for _, p := range f.Progs {
+		if p.Off+p.Filesz > end {
+			end = p.Off + p.Filesz
+		}
+	}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 && s.Type != elf.SHT_NOBITS && s.Offset+s.Size > end {
+			end = s.Offset + s.Size
+		}
+	}
+	return end
+}
+
+// elfStripSections rewrites the ELF file name, the output of the
+// external linker, without its section header table and the sections
+// after the loaded part of the file, for -strip=sections. The
+// sections in the loaded part are left in place.
+func elfStripSections(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	out := data[:elfLoadedEnd(f, data)]
+	if f.Class == elf.ELFCLASS64 {
+		f.ByteOrder.PutUint64(out[0x28:], 0) // e_shoff
+		copy(out[0x3c:], make([]byte, 4))    // e_shnum, e_shstrndx
+	} else {
+		f.ByteOrder.PutUint32(out[0x20:], 0)
+		copy(out[0x30:], make([]byte, 4))
+	}
+	return ioutil.WriteFile(name, out, 0777)
+}
+
+// elfStripSymtab rewrites the ELF file name, the output of the
+// external linker, without its symbol table, for -strip=symtab. The
+// host linker's -s would drop the DWARF sections too.
+func elfStripSymtab(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	out, err := elfStrip(data, stripSymtab)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, out, 0777)
+}
+
+// Special values in the Mach-O indirect symbol table.
+const (
+	INDIRECT_SYMBOL_LOCAL = 0x80000000
+	INDIRECT_SYMBOL_ABS   = 0x40000000
+)
+
+// A machoBlob is a range of the __LINKEDIT segment of a Mach-O file,
+// referred to by the offset and size fields of a load command.
+type machoBlob struct {
+	cmd       int // offset of the load command in the file
+	off, size int // offsets of the offset and size fields in the command
+	unit      int // size of the unit the size field counts
+	align     int
+	data      []byte
+}
+
+// machoStrip returns a copy of the Mach-O file data without its DWARF
+// segment and local symbols.
+func machoStrip(data []byte) ([]byte, error) {
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if f.Magic != macho.Magic64 {
+		return nil, fmt.Errorf("not a 64-bit Mach-O file")
+	}
+	bo := f.ByteOrder
+	cstring := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+	linkseg := f.Segment("__LINKEDIT")
+	if linkseg == nil {
+		return nil, fmt.Errorf("missing __LINKEDIT segment")
+	}
+	// The DWARF segment, if any, comes right before __LINKEDIT.
+	cut := linkseg.Offset
+	if dw := f.Segment("__DWARF"); dw != nil {
+		if dw.Offset+dw.Filesz > linkseg.Offset {
+			return nil, fmt.Errorf("__DWARF segment is not before __LINKEDIT")
+		}
+		cut = dw.Offset
+	}
+
+	// Collect the contents of __LINKEDIT, and the load commands
+	// referring to them.
+	var blobs []*machoBlob
+	var symtab, strtab, indirect *machoBlob
+	var dysymtabCmd int
+	add := func(cmd, off, size, unit, align int) *machoBlob {
+		o, n := int(bo.Uint32(data[cmd+off:])), int(bo.Uint32(data[cmd+size:]))*unit
+		if n == 0 {
+			return nil
+		}
+		if uint64(o) < linkseg.Offset || uint64(o+n) > linkseg.Offset+linkseg.Filesz {
+			return nil // not in __LINKEDIT
+		}
+		b := &machoBlob{cmd: cmd, off: off, size: size, unit: unit, align: align, data: data[o : o+n]}
+		blobs = append(blobs, b)
+		return b
+	}
+	var cmds [][2]int // offset and size of each load command kept
+	pos := machoHeaderSize64
+	for i := uint32(0); i < f.Ncmd; i++ {
+		cmd, size := bo.Uint32(data[pos:]), int(bo.Uint32(data[pos+4:]))
+		keep := true
+		switch cmd {
+		case LC_SEGMENT_64:
+			keep = cstring(data[pos+8:pos+24]) != "__DWARF"
+		case LC_DYLD_INFO, LC_DYLD_INFO_ONLY:
+			for off := 8; off < 48; off += 8 {
+				add(pos, off, off+4, 1, 8)
+			}
+		case LC_SYMTAB:
+			symtab = add(pos, 8, 12, 16, 8)
+			strtab = add(pos, 16, 20, 1, 8)
+		case LC_DYSYMTAB:
+			dysymtabCmd = pos
+			for _, off := range []int{32, 40, 48, 64, 72} {
+				if bo.Uint32(data[pos+off+4:]) != 0 {
+					return nil, fmt.Errorf("unsupported LC_DYSYMTAB tables")
+				}
+			}
+			indirect = add(pos, 56, 60, 4, 8)
+		case LC_CODE_SIGNATURE:
+			add(pos, 8, 12, 1, 16)
+		case LC_SEGMENT_SPLIT_INFO, LC_FUNCTION_STARTS, LC_DATA_IN_CODE, LC_DYLIB_CODE_SIGN_DRS,
+			LC_DYLD_EXPORTS_TRIE, LC_DYLD_CHAINED_FIXUPS, LC_LINKER_OPTIMIZATION_HINT:
+			add(pos, 8, 12, 1, 8)
+		}
+		if keep {
+			cmds = append(cmds, [2]int{pos, size})
+		}
+		pos += size
+	}
+
+	out := append([]byte(nil), data[:cut]...)
+
+	// Drop the local symbols. They come first in the symbol table,
+	// and no indirect symbol may refer to them.
+	if symtab != nil && strtab != nil && dysymtabCmd != 0 {
+		nlocal := int(bo.Uint32(data[dysymtabCmd+12:]))
+		ok := bo.Uint32(data[dysymtabCmd+8:]) == 0
+		if indirect != nil {
+			for i := 0; i < len(indirect.data); i += 4 {
+				x := bo.Uint32(indirect.data[i:])
+				if x&(INDIRECT_SYMBOL_LOCAL|INDIRECT_SYMBOL_ABS) == 0 && int(x) < nlocal {
+					ok = false
+				}
+			}
+		}
+		if ok && nlocal > 0 {
+			var syms, strs []byte
+			strs = append(strs, 0)
+			stroff := make(map[string]uint32)
+			for i := nlocal * 16; i < len(symtab.data); i += 16 {
+				sym := append([]byte(nil), symtab.data[i:i+16]...)
+				if x := bo.Uint32(sym); x != 0 && int(x) < len(strtab.data) {
+					name := cstring(strtab.data[x:])
+					if _, ok := stroff[name]; !ok {
+						stroff[name] = uint32(len(strs))
+						strs = append(strs, name...)
+						strs = append(strs, 0)
+					}
+					bo.PutUint32(sym, stroff[name])
+				}
+				syms = append(syms, sym...)
+			}
+			for len(strs)%8 != 0 {
+				strs = append(strs, 0)
+			}
+			symtab.data, strtab.data = syms, strs
+			if indirect != nil {
+				ind := append([]byte(nil), indirect.data...)
+				for i := 0; i < len(ind); i += 4 {
+					if x := bo.Uint32(ind[i:]); x&(INDIRECT_SYMBOL_LOCAL|INDIRECT_SYMBOL_ABS) == 0 {
+						bo.PutUint32(ind[i:], x-uint32(nlocal))
+					}
+				}
+				indirect.data = ind
+			}
+			d := out[dysymtabCmd:]
+			for _, off := range []int{16, 24} { // iextdefsym, iundefsym
+				bo.PutUint32(d[off:], bo.Uint32(d[off:])-uint32(nlocal))
+			}
+			bo.PutUint32(d[12:], 0) // nlocalsym
+		}
+	}
+
+	// Lay out the new __LINKEDIT right after the loaded segments, in
+	// the same order as the old one.
+	sort.SliceStable(blobs, func(i, j int) bool {
+		return bo.Uint32(data[blobs[i].cmd+blobs[i].off:]) < bo.Uint32(data[blobs[j].cmd+blobs[j].off:])
+	})
+	for _, b := range blobs {
+		off := int(Rnd(int64(len(out)), int64(b.align)))
+		out = append(out, make([]byte, off-len(out))...)
+		out = append(out, b.data...)
+		bo.PutUint32(out[b.cmd+b.off:], uint32(off))
+		bo.PutUint32(out[b.cmd+b.size:], uint32(len(b.data)/b.unit))
+	}
+
+	// Fix up the __LINKEDIT segment, and remove the __DWARF one from
+	// the load commands.
+	var cmddata []byte
+	for _, c := range cmds {
+		cmd := out[c[0] : c[0]+c[1]]
+		if bo.Uint32(cmd) == LC_SEGMENT_64 && cstring(cmd[8:24]) == "__LINKEDIT" {
+			bo.PutUint64(cmd[40:], cut)                  // fileoff
+			bo.PutUint64(cmd[48:], uint64(len(out))-cut) // filesize
+		}
+		cmddata = append(cmddata, cmd...)
+	}
+	copy(out[machoHeaderSize64:machoHeaderSize64+int(f.Cmdsz)], make([]byte, f.Cmdsz))
+	copy(out[machoHeaderSize64:], cmddata)
+	bo.PutUint32(out[16:], uint32(len(cmds)))    // ncmds
+	bo.PutUint32(out[20:], uint32(len(cmddata))) // sizeofcmds
+	return out, nil
+}
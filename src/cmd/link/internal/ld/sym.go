@@ -52,6 +52,8 @@ func linknew(arch *sys.Arch) *Link {
 		numelfsym:     1,
 		ErrorReporter: ErrorReporter{ErrorReporter: ler},
 		generatorSyms: make(map[loader.Sym]generatorFunc),
+		experiments:   make(map[*sym.Library]string),
+		compressDWARF: dwarfCompressZlib,
 	}
 
 	if buildcfg.GOARCH != arch.Name {
@@ -31,14 +31,18 @@
 package ld
 
 import (
+	"bytes"
 	"cmd/internal/obj"
 	"cmd/internal/objabi"
 	"cmd/link/internal/loader"
 	"cmd/link/internal/sym"
+	"crypto/sha256"
 	"debug/elf"
 	"fmt"
 	"internal/buildcfg"
+	"io"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -102,10 +106,40 @@ func putelfsym(ctxt *Link, x loader.Sym, typ elf.SymType, curbind elf.SymBind) {
 			return
 		}
 		elfshnum = xosect.Elfsect.(*ElfShdr).shnum
+		if size == 0 {
+			if n := carrierSize(x); n != 0 {
+				// The symbols in the carrier's range are not in
+				// the symbol table themselves.
+				size = n
+			} else if !ctxt.DynlinkingGo() && elfFileName(ldr, x) == "" && (typ == elf.STT_OBJECT || typ == elf.STT_FUNC) {
+				// A marker like runtime.etext or runtime.end only
+				// labels an address, as _etext and _end do in C.
+				// ldshlibsyms skips such symbols of shared
+				// libraries, so they keep their type there.
+				typ = elf.STT_NOTYPE
+			}
+		}
+		if typ == elf.STT_TLS && ctxt.IsInternal() {
+			// The value is the offset in the TLS block.
+			addr = TLSSymOffset(ldr, x)
+		}
 	}
 
 	sname := ldr.SymExtname(x)
-	sname = mangleABIName(ctxt, ldr, x, sname)
+	alias := "" // name of a zero-size alias of x
+	if *flagABIWrapperAlias && typ == elf.STT_FUNC && !ctxt.DynlinkingGo() && abiWrapperPair(ldr, x) != 0 {
+		// Name the ABI wrapper and the function it wraps alike,
+		// so that profilers attribute the samples in both to the
+		// function, and mark the wrapper with an alias.
+		if abiWrapperTarget(ldr, x) != 0 {
+			alias = sname + ".abi0"
+			if ldr.SymVersion(x) == sym.SymVerABIInternal {
+				alias = sname + ".abiinternal"
+			}
+		}
+	} else {
+		sname = mangleABIName(ctxt, ldr, x, sname)
+	}
 
 	// One pass for each binding: elf.STB_LOCAL, elf.STB_GLOBAL,
 	// maybe one day elf.STB_WEAK.
@@ -125,6 +159,12 @@ func putelfsym(ctxt *Link, x loader.Sym, typ elf.SymType, curbind elf.SymBind) {
 		bind = elf.STB_LOCAL
 	}
 
+	if alias != "" {
+		// The wrapper has the name of the function, which may be
+		// global.
+		bind = elf.STB_LOCAL
+	}
+
 	if ctxt.LinkMode == LinkExternal && elfshnum != elf.SHN_UNDEF {
 		addr -= int64(xosect.Vaddr)
 	}
@@ -164,6 +204,7 @@ func putelfsym(ctxt *Link, x loader.Sym, typ elf.SymType, curbind elf.SymBind) {
 		// (*sym.Symbol).ElfsymForReloc). This is approximately equivalent to the
 		// ELF linker -Bsymbolic-functions option, but that is buggy on
 		// several platforms.
+		putelffile(ctxt)
 		putelfsyment(ctxt.Out, putelfstr("local."+sname), addr, size, elf.ST_INFO(elf.STB_LOCAL, typ), elfshnum, other)
 		ldr.SetSymLocalElfSym(x, int32(ctxt.numelfsym))
 		ctxt.numelfsym++
@@ -172,9 +213,54 @@ func putelfsym(ctxt *Link, x loader.Sym, typ elf.SymType, curbind elf.SymBind) {
 		return
 	}
 
+	if ctxt.strip&stripLocals != 0 && ctxt.IsInternal() && !ctxt.DynlinkingGo() && isGeneratedLocal(sname) {
+		// With external linking, the host linker needs the symbol
+		// to resolve the relocations to it, and the symbol is left
+		// out of the final output instead (see elfRewriteSymtab).
+		return
+	}
+
+	if bind == elf.STB_LOCAL {
+		putelffile(ctxt)
+	}
 	putelfsyment(ctxt.Out, putelfstr(sname), addr, size, elf.ST_INFO(bind, typ), elfshnum, other)
 	ldr.SetSymElfSym(x, int32(ctxt.numelfsym))
 	ctxt.numelfsym++
+
+	if alias != "" {
+		if !ctxt.DynlinkingGo() {
+			alias = strings.Replace(alias, "·", ".", -1)
+		}
+		putelfsyment(ctxt.Out, putelfstr(alias), addr, 0, elf.ST_INFO(bind, typ), elfshnum, other)
+		ctxt.numelfsym++
+	}
+}
+
+// putelffile writes the pending STT_FILE symbol ctxt.elfFile, if any,
+// which the local symbols that follow belong to.
+func putelffile(ctxt *Link) {
+	if ctxt.elfFile == "" {
+		return
+	}
+	putelfsyment(ctxt.Out, putelfstr(ctxt.elfFile), 0, 0, elf.ST_INFO(elf.STB_LOCAL, elf.STT_FILE), elf.SHN_ABS, 0)
+	ctxt.numelfsym++
+	ctxt.elfFile = ""
+}
+
+// elfFileName returns the name of the STT_FILE symbol of s: that of the
+// host object or the import path of the package defining it, or "" for
+// the symbols the linker makes.
+func elfFileName(ldr *loader.Loader, s loader.Sym) string {
+	o := s
+	if outer := ldr.OuterSym(s); outer != 0 {
+		// The symbols of a host object are sub-symbols of its
+		// section symbols.
+		o = outer
+	}
+	if name := hostObjOf(o); name != "" {
+		return name
+	}
+	return ldr.SymPkg(s)
 }
 
 func putelfsectionsym(ctxt *Link, out *OutBuf, s loader.Sym, shndx elf.SectionIndex) {
@@ -186,9 +272,35 @@ func putelfsectionsym(ctxt *Link, out *OutBuf, s loader.Sym, shndx elf.SectionIn
 func genelfsym(ctxt *Link, elfbind elf.SymBind) {
 	ldr := ctxt.loader
 
+	// The local symbols are grouped by the package or host object
+	// defining them, each group following an STT_FILE symbol with its
+	// name, as ELF tools expect. The symbols the linker makes come
+	// first, under the go.go file symbol.
+	type elfsym struct {
+		s   loader.Sym
+		typ elf.SymType
+	}
+	var locals []elfsym
+	put := func(s loader.Sym, typ elf.SymType) {
+		if elfbind == elf.STB_LOCAL {
+			locals = append(locals, elfsym{s, typ})
+			return
+		}
+		putelfsym(ctxt, s, typ, elfbind)
+	}
+
+	// The mapping symbols follow the addresses of the text, not the
+	// groups.
+	if (ctxt.IsARM() || ctxt.IsARM64()) && elfbind == elf.STB_LOCAL && !(ctxt.strip&stripLocals != 0 && ctxt.IsInternal()) {
+		mapsyms := newMappingSyms(ctxt)
+		for _, s := range ctxt.Textp {
+			mapsyms.put(ctxt, s)
+		}
+	}
+
 	// runtime.text marker symbol(s).
 	s := ldr.Lookup("runtime.text", 0)
-	putelfsym(ctxt, s, elf.STT_FUNC, elfbind)
+	put(s, elf.STT_FUNC)
 	for k, sect := range Segtext.Sections[1:] {
 		n := k + 1
 		if sect.Name != ".text" || (ctxt.IsAIX() && ctxt.IsExternal()) {
@@ -202,18 +314,18 @@ func genelfsym(ctxt *Link, elfbind elf.SymBind) {
 		if ldr.SymType(s) != sym.STEXT {
 			panic("unexpected type for runtime.text symbol")
 		}
-		putelfsym(ctxt, s, elf.STT_FUNC, elfbind)
+		put(s, elf.STT_FUNC)
 	}
 
 	// Text symbols.
 	for _, s := range ctxt.Textp {
-		putelfsym(ctxt, s, elf.STT_FUNC, elfbind)
+		put(s, elf.STT_FUNC)
 	}
 
 	// runtime.etext marker symbol.
 	s = ldr.Lookup("runtime.etext", 0)
 	if ldr.SymType(s) == sym.STEXT {
-		putelfsym(ctxt, s, elf.STT_FUNC, elfbind)
+		put(s, elf.STT_FUNC)
 	}
 
 	shouldBeInSymbolTable := func(s loader.Sym) bool {
@@ -243,8 +355,10 @@ func genelfsym(ctxt *Link, elfbind elf.SymBind) {
 		st := ldr.SymType(s)
 		if st >= sym.SELFRXSECT && st < sym.SXREF {
 			typ := elf.STT_OBJECT
-			if st == sym.STLSBSS {
-				if ctxt.IsInternal() {
+			if st == sym.STLSBSS || st == sym.STLSDATA {
+				if ldr.SymSect(s) == nil {
+					// Linking internally with -d, there is no
+					// .tbss section (see dodata).
 					continue
 				}
 				typ = elf.STT_TLS
@@ -252,13 +366,110 @@ func genelfsym(ctxt *Link, elfbind elf.SymBind) {
 			if !shouldBeInSymbolTable(s) {
 				continue
 			}
-			putelfsym(ctxt, s, typ, elfbind)
+			put(s, typ)
 			continue
 		}
 		if st == sym.SHOSTOBJ || st == sym.SDYNIMPORT || st == sym.SUNDEFEXT {
-			putelfsym(ctxt, s, ldr.SymElfType(s), elfbind)
+			put(s, ldr.SymElfType(s))
 		}
 	}
+
+	if elfbind != elf.STB_LOCAL {
+		return
+	}
+	var files []string
+	groups := make(map[string][]elfsym)
+	for _, e := range locals {
+		name := elfFileName(ldr, e.s)
+		if _, ok := groups[name]; !ok {
+			files = append(files, name)
+		}
+		groups[name] = append(groups[name], e)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i] == "" && files[j] != "" })
+	for _, name := range files {
+		// Written with the first local symbol of the group, if any.
+		ctxt.elfFile = name
+		for _, e := range groups[name] {
+			putelfsym(ctxt, e.s, e.typ, elfbind)
+		}
+	}
+	ctxt.elfFile = ""
+}
+
+// mappingSyms writes the mapping symbols of the arm and arm64 text: $a,
+// $t and $x mark the start of Arm, Thumb and A64 code, and $d that of
+// data, such as literal pools and padding, for disassemblers and
+// profilers not to decode the data as instructions. A mapping symbol
+// holds up to the next one, so they are only written where the kind of
+// the contents changes, which also merges adjacent data. The R_MAPSYM
+// relocations of a symbol give the kinds of its contents, which start
+// with Arm or A64 code otherwise.
+type mappingSyms struct {
+	code byte // kind of the code of Go functions
+	sect *sym.Section
+	end  int64        // address of the end of the last symbol
+	kind byte         // kind of the contents at end
+	str  map[byte]int // offsets of the names in the string table
+}
+
+func newMappingSyms(ctxt *Link) *mappingSyms {
+	code := byte('a')
+	if ctxt.IsARM64() {
+		code = 'x'
+	}
+	return &mappingSyms{code: code, str: make(map[byte]int)}
+}
+
+func (m *mappingSyms) put(ctxt *Link, s loader.Sym) {
+	ldr := ctxt.loader
+	sect := ldr.SymSect(s)
+	if ldr.OuterSym(s) != 0 || sect == nil || sect.Elfsect == nil {
+		// The relocations are those of the outer symbol.
+		return
+	}
+	addr := ldr.SymValue(s)
+	if sect != m.sect {
+		m.sect, m.end, m.kind = sect, addr, 0
+	}
+	base := int64(0)
+	if ctxt.IsExternal() {
+		base = int64(sect.Vaddr)
+	}
+	shnum := sect.Elfsect.(*ElfShdr).shnum
+	write := func(addr int64, kind byte) {
+		if kind == m.kind {
+			return
+		}
+		m.kind = kind
+		str, ok := m.str[kind]
+		if !ok {
+			str = putelfstr("$" + string(kind))
+			m.str[kind] = str
+		}
+		putelfsyment(ctxt.Out, str, addr-base, 0, elf.ST_INFO(elf.STB_LOCAL, elf.STT_NOTYPE), shnum, 0)
+		ctxt.numelfsym++
+	}
+
+	// The alignment padding before s.
+	if addr > m.end {
+		write(m.end, 'd')
+	}
+	m.end = addr + ldr.SymSize(s)
+
+	off, kind := int64(0), m.code
+	relocs := ldr.Relocs(s)
+	for ri := 0; ri < relocs.Count(); ri++ {
+		r := relocs.At(ri)
+		if r.Type() != objabi.R_MAPSYM {
+			continue
+		}
+		if int64(r.Off()) != off {
+			write(addr+off, kind)
+		}
+		off, kind = int64(r.Off()), byte(r.Add())
+	}
+	write(addr+off, kind)
 }
 
 func asmElfSym(ctxt *Link) {
@@ -267,6 +478,9 @@ func asmElfSym(ctxt *Link) {
 	putelfsyment(ctxt.Out, 0, 0, 0, elf.ST_INFO(elf.STB_LOCAL, elf.STT_NOTYPE), 0, 0)
 
 	dwarfaddelfsectionsyms(ctxt)
+	if *flagEmitReloc && ctxt.IsInternal() {
+		emitrelocsectionsyms(ctxt)
+	}
 
 	// Some linkers will add a FILE sym if one is not present.
 	// Avoid having the working directory inserted into the symbol table.
@@ -343,7 +557,7 @@ func asmbPlan9Sym(ctxt *Link) {
 		}
 		t := ldr.SymType(s)
 		if t >= sym.SELFRXSECT && t < sym.SXREF { // data sections handled in dodata
-			if t == sym.STLSBSS {
+			if t == sym.STLSBSS || t == sym.STLSDATA {
 				continue
 			}
 			if !shouldBeInSymbolTable(s) {
@@ -607,14 +821,15 @@ func (ctxt *Link) symtab(pcln *pclntab) []sym.SymKind {
 	}
 	if ctxt.BuildMode == BuildModePlugin || ctxt.CanUsePlugins() {
 		for _, l := range ctxt.Library {
+			h := ctxt.pkghashes[l]
 			s := ldr.CreateSymForUpdate("go.link.pkghashbytes."+l.Pkg, 0)
 			s.SetType(sym.SRODATA)
-			s.SetSize(int64(len(l.Fingerprint)))
-			s.SetData(l.Fingerprint[:])
+			s.SetSize(int64(len(h)))
+			s.SetData(h)
 			str := ldr.CreateSymForUpdate("go.link.pkghash."+l.Pkg, 0)
 			str.SetType(sym.SRODATA)
 			str.AddAddr(ctxt.Arch, s.Sym())
-			str.AddUint(ctxt.Arch, uint64(len(l.Fingerprint)))
+			str.AddUint(ctxt.Arch, uint64(len(h)))
 		}
 	}
 
@@ -711,6 +926,29 @@ func (ctxt *Link) symtab(pcln *pclntab) []sym.SymKind {
 	moduledata.AddAddr(ctxt.Arch, itablinkSym)
 	moduledata.AddUint(ctxt.Arch, nitablinks)
 	moduledata.AddUint(ctxt.Arch, nitablinks)
+	// The typeimports slice
+	if tab := ctxt.typeImports.tab; tab != 0 {
+		nimports := uint64(ldr.SymSize(tab)) / uint64(ctxt.Arch.PtrSize)
+		moduledata.AddAddr(ctxt.Arch, tab)
+		moduledata.AddUint(ctxt.Arch, nimports)
+		moduledata.AddUint(ctxt.Arch, nimports)
+	} else {
+		moduledata.AddUint(ctxt.Arch, 0)
+		moduledata.AddUint(ctxt.Arch, 0)
+		moduledata.AddUint(ctxt.Arch, 0)
+	}
+	// The embedz and embeds slices, see compressEmbeds
+	if ctxt.embedz != 0 {
+		for _, s := range []loader.Sym{ctxt.embedz, ctxt.embeds} {
+			moduledata.AddAddr(ctxt.Arch, s)
+			moduledata.AddUint(ctxt.Arch, uint64(ldr.SymSize(s)))
+			moduledata.AddUint(ctxt.Arch, uint64(ldr.SymSize(s)))
+		}
+	} else {
+		for i := 0; i < 6; i++ {
+			moduledata.AddUint(ctxt.Arch, 0)
+		}
+	}
 	// The ptab slice
 	if ptab := ldr.Lookup("go.plugin.tabs", 0); ptab != 0 && ldr.AttrReachable(ptab) {
 		ldr.SetAttrLocal(ptab, true)
@@ -737,7 +975,7 @@ func (ctxt *Link) symtab(pcln *pclntab) []sym.SymKind {
 			// pkghashes[i].name
 			addgostring(ctxt, ldr, pkghashes, fmt.Sprintf("go.link.pkgname.%d", i), l.Pkg)
 			// pkghashes[i].linktimehash
-			addgostring(ctxt, ldr, pkghashes, fmt.Sprintf("go.link.pkglinkhash.%d", i), string(l.Fingerprint[:]))
+			addgostring(ctxt, ldr, pkghashes, fmt.Sprintf("go.link.pkglinkhash.%d", i), string(ctxt.pkghashes[l]))
 			// pkghashes[i].runtimehash
 			hash := ldr.Lookup("go.link.pkghash."+l.Pkg, 0)
 			pkghashes.AddAddr(ctxt.Arch, hash)
@@ -798,7 +1036,17 @@ func (ctxt *Link) symtab(pcln *pclntab) []sym.SymKind {
 		moduledata.AddUint8(0)
 	}
 
-	// The rest of moduledata is zero initialized.
+	// The modulestate holds what the runtime writes about the
+	// module, so that the moduledata is only written by the linker
+	// and the dynamic linker, and can be read-only (see
+	// -guard-moduledata). It is zero initialized.
+	modulestate := ldr.CreateSymForUpdate("go.link.modulestate", 0)
+	modulestate.SetLocal(true)
+	modulestate.SetType(sym.SNOPTRBSS)
+	modulestate.SetSize(decodetypeSize(ctxt.Arch, ldr.Data(ldr.Lookup("type.runtime.modulestate", 0))))
+	moduledata.SetSize(Rnd(moduledata.Size(), int64(ctxt.Arch.PtrSize)))
+	moduledata.AddAddr(ctxt.Arch, modulestate.Sym())
+
 	// When linking an object that does not contain the runtime we are
 	// creating the moduledata from scratch and it does not have a
 	// compiler-provided size, so read it from the type data.
@@ -829,6 +1077,17 @@ func setCarrierSym(typ sym.SymKind, s loader.Sym) {
 	CarrierSymByType[typ].Sym = s
 }
 
+// carrierSize returns the size of the data the carrier symbol s
+// stands for, or 0 if s is not a carrier.
+func carrierSize(s loader.Sym) int64 {
+	for _, c := range CarrierSymByType {
+		if c.Sym == s && c.Size != 0 {
+			return c.Size
+		}
+	}
+	return 0
+}
+
 func setCarrierSize(typ sym.SymKind, sz int64) {
 	if CarrierSymByType[typ].Size != 0 {
 		panic(fmt.Sprintf("carrier symbol size for type %v already set", typ))
@@ -836,10 +1095,262 @@ func setCarrierSize(typ sym.SymKind, sz int64) {
 	CarrierSymByType[typ].Size = sz
 }
 
+// pluginPkgHashes returns the per-package hashes recorded for the
+// plugin version check. In the default -plugin-compat=strict mode this
+// is the package fingerprint from the object file, which changes
+// whenever anything about the compiled package changes. In
+// -plugin-compat=loose mode the hash only covers what the host and the
+// plugin share about a package: the names of its non-local symbols,
+// the sizes of its data, the descriptors of its types, and the
+// arguments and results of its functions. Inputs that do not affect
+// the ABI (function bodies, file paths, DWARF, debug flags) do not
+// cause a mismatch. Both the host and the plugin must be linked with
+// -plugin-compat=loose for the loose hashes to compare equal.
+//
+// This is called right after loading, before the linker has modified
+// any symbols in a build-mode dependent way.
+func pluginPkgHashes(ctxt *Link) map[*sym.Library][]byte {
+	hashes := make(map[*sym.Library][]byte, len(ctxt.Library))
+	if *flagPluginCompat != "loose" {
+		for _, l := range ctxt.Library {
+			hashes[l] = l.Fingerprint[:]
+		}
+		return hashes
+	}
+
+	ldr := ctxt.loader
+	syms := make(map[string][]string)
+	prefixes := make(map[string]string)
+	typePkgs := make(map[string]string, len(ctxt.Library))
+	for _, l := range ctxt.Library {
+		typePkgs[objabi.PathToPrefix(l.Pkg)+"."] = l.Pkg
+	}
+	var fdSyms []loader.Sym
+	for s := loader.Sym(1); s < loader.Sym(ldr.NDef()); s++ {
+		if ldr.IsFileLocal(s) {
+			continue
+		}
+		t := ldr.SymType(s)
+		if t == sym.Sxxx || t >= sym.SDWARFSECT {
+			continue
+		}
+		name := ldr.SymName(s)
+		if strings.HasPrefix(name, "type.") {
+			// The descriptor of a type defined by the package
+			// records its layout, such as the types of the fields
+			// of a struct, which the size alone does not. It is
+			// DUPOK, so it is attributed by name.
+			if pkg := typePkgs[typePkgPrefix(name)]; pkg != "" {
+				ent := fmt.Sprintf("%s %d %x", name, ldr.SymSize(s), symContentHash(ldr, s))
+				syms[pkg] = append(syms[pkg], ent)
+			}
+			continue
+		}
+		if ldr.AttrDuplicateOK(s) {
+			continue
+		}
+		// Only hash the symbols named by the package itself (its
+		// functions and variables). Compiler-generated symbols, such
+		// as constants and string data, vary with build flags.
+		pkg := ldr.SymPkg(s)
+		prefix, ok := prefixes[pkg]
+		if !ok {
+			prefix = objabi.PathToPrefix(pkg) + "."
+			prefixes[pkg] = prefix
+		}
+		if !strings.HasPrefix(name, prefix) || isStaticTmp(name) {
+			continue
+		}
+		ent := fmt.Sprintf("%s<%d>", name, ldr.SymVersion(s))
+		if t == sym.STEXT {
+			// The size of a function depends on its body, which
+			// is not part of the ABI. Its arguments are.
+			fdSyms = ldr.Funcdata(s, fdSyms)
+			ent += funcArgsSignature(ctxt, s, fdSyms)
+		} else {
+			ent += fmt.Sprintf(" %d", ldr.SymSize(s))
+		}
+		syms[pkg] = append(syms[pkg], ent)
+	}
+
+	for _, l := range ctxt.Library {
+		if l.Shlib != "" {
+			// Symbols from shared libraries do not carry their
+			// package; fall back to the fingerprint.
+			hashes[l] = l.Fingerprint[:]
+			continue
+		}
+		ents := syms[l.Pkg]
+		sort.Strings(ents)
+		h := sha256.New()
+		for _, ent := range ents {
+			io.WriteString(h, ent)
+			h.Write([]byte{0})
+		}
+		// Keep the same length as the fingerprint, so the recorded
+		// hash has the same layout in either mode.
+		hashes[l] = h.Sum(nil)[:len(l.Fingerprint)]
+	}
+	return hashes
+}
+
+// typePkgPrefix returns the symbol prefix of the package defining the
+// named type whose descriptor is the symbol name, such as "main." for
+// type.*main.T, or "" for the descriptors of unnamed types.
+func typePkgPrefix(name string) string {
+	name = strings.TrimLeft(strings.TrimPrefix(name, "type."), "*")
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		// Type arguments of an instantiated type.
+		name = name[:i]
+	}
+	// The last element of the package path has its dots escaped, so
+	// the first dot after the last slash ends the prefix.
+	i := strings.LastIndexByte(name, '/') + 1
+	j := strings.IndexByte(name[i:], '.')
+	if j <= 0 {
+		return ""
+	}
+	return name[:i+j+1]
+}
+
+// symContentHash returns a hash of the contents of s: its data and its
+// relocations, with the names of their targets, or their data for
+// content-addressable targets, whose names depend on what else is
+// linked.
+func symContentHash(ldr *loader.Loader, s loader.Sym) []byte {
+	h := sha256.New()
+	h.Write(ldr.Data(s))
+	relocs := ldr.Relocs(s)
+	for ri := 0; ri < relocs.Count(); ri++ {
+		r := relocs.At(ri)
+		fmt.Fprintf(h, "\x00%d %d %d %d", r.Off(), r.Siz(), r.Type(), r.Add())
+		if rs := r.Sym(); rs != 0 && ldr.IsContentAddressable(rs) {
+			// Short contents are deduplicated with the trailing
+			// zeros that fill them to 8 bytes.
+			fmt.Fprintf(h, " =%x", bytes.TrimRight(ldr.Data(rs), "\x00"))
+		} else if rs != 0 {
+			io.WriteString(h, " "+ldr.SymName(rs))
+		}
+	}
+	return h.Sum(nil)
+}
+
+// funcArgsSignature describes the arguments and results of the
+// function s for the plugin package hash: the descriptor of its type,
+// which the compiler marks with an R_USETYPE relocation, the size of
+// its argument frame and which of its words hold pointers, from the
+// argument pointer maps in its funcdata fd. Those hold a bitmap for
+// each safe point of the function. Their union only changes with the
+// body if the body changes which arguments are live on the stack, which
+// errs on the side of a mismatch.
+func funcArgsSignature(ctxt *Link, s loader.Sym, fd []loader.Sym) string {
+	ldr := ctxt.loader
+	sig := ""
+	relocs := ldr.Relocs(s)
+	for ri := 0; ri < relocs.Count(); ri++ {
+		if r := relocs.At(ri); r.Type() == objabi.R_USETYPE {
+			sig += fmt.Sprintf(" type=%s %x", ldr.SymName(r.Sym()), symContentHash(ldr, r.Sym()))
+		}
+	}
+	fi := ldr.FuncInfo(s)
+	if !fi.Valid() {
+		return sig
+	}
+	sig += fmt.Sprintf(" args=%d", fi.Args())
+	if len(fd) <= objabi.FUNCDATA_ArgsPointerMaps || fd[objabi.FUNCDATA_ArgsPointerMaps] == 0 {
+		return sig
+	}
+	data := ldr.Data(fd[objabi.FUNCDATA_ArgsPointerMaps])
+	if len(data) < 8 {
+		return sig
+	}
+	// See cmd/compile/internal/liveness.(*liveness).emit for the
+	// layout: the number of bitmaps, the number of bits in each, and
+	// the bitmaps.
+	n := int(ctxt.Arch.ByteOrder.Uint32(data))
+	nbit := int(ctxt.Arch.ByteOrder.Uint32(data[4:]))
+	ptrs := make([]byte, (nbit+7)/8)
+	data = data[8:]
+	for i := 0; i < n && len(data) >= len(ptrs); i++ {
+		for j := range ptrs {
+			ptrs[j] |= data[j]
+		}
+		data = data[len(ptrs):]
+	}
+	return sig + fmt.Sprintf(" ptrs=%d:%x", nbit, ptrs)
+}
+
 func isStaticTmp(name string) bool {
 	return strings.Contains(name, "."+obj.StaticNamePref)
 }
 
+// isGeneratedLocal reports whether name is the name of a symbol the
+// compiler or the linker generated for its own use, which -strip=locals
+// leaves out of the symbol table: constants such as $f64.*, mapping
+// symbols, static temporaries and the like.
+func isGeneratedLocal(name string) bool {
+	return strings.HasPrefix(name, "$") ||
+		strings.HasPrefix(name, "go.info.") ||
+		strings.HasPrefix(name, "gofile..") ||
+		strings.Contains(name, "..gobytes.") ||
+		isStaticTmp(name)
+}
+
+// abiWrapperPair returns the other function of the pair made of an ABI
+// wrapper and the function it wraps, if x is one of them, or 0.
+func abiWrapperPair(ldr *loader.Loader, x loader.Sym) loader.Sym {
+	if t := abiWrapperTarget(ldr, x); t != 0 {
+		return t
+	}
+	var ver int
+	switch ldr.SymVersion(x) {
+	case sym.SymVerABI0:
+		ver = sym.SymVerABIInternal
+	case sym.SymVerABIInternal:
+		ver = sym.SymVerABI0
+	default:
+		return 0
+	}
+	if w := ldr.Lookup(ldr.SymName(x), ver); w != 0 && abiWrapperTarget(ldr, w) == x {
+		return w
+	}
+	return 0
+}
+
+// abiWrapperTarget returns the function that x wraps, if x is an ABI
+// wrapper, or 0. The wrapper and the function have the same name, in
+// the two ABIs, and the compiler marks the wrapper as a wrapper
+// function.
+func abiWrapperTarget(ldr *loader.Loader, x loader.Sym) loader.Sym {
+	if ldr.SymType(x) != sym.STEXT || ldr.IsExternal(x) {
+		return 0
+	}
+	var ver int
+	switch ldr.SymVersion(x) {
+	case sym.SymVerABI0:
+		ver = sym.SymVerABIInternal
+	case sym.SymVerABIInternal:
+		ver = sym.SymVerABI0
+	default:
+		return 0
+	}
+	t := ldr.Lookup(ldr.SymName(x), ver)
+	if t == 0 || ldr.SymType(t) != sym.STEXT || ldr.IsExternal(t) || !ldr.AttrReachable(t) {
+		return 0
+	}
+	isWrapper := func(s loader.Sym) bool {
+		fi := ldr.FuncInfo(s)
+		return fi.Valid() && fi.FuncID() == objabi.FuncID_wrapper
+	}
+	// Some functions, such as runtime.deferreturn, are marked as
+	// wrappers by name. If both are marked, the Go function is the
+	// ABIInternal one.
+	if !isWrapper(x) || isWrapper(t) && ldr.SymVersion(x) == sym.SymVerABIInternal {
+		return 0
+	}
+	return t
+}
+
 // Mangle function name with ABI information.
 func mangleABIName(ctxt *Link, ldr *loader.Loader, x loader.Sym, name string) string {
 	// For functions with ABI wrappers, we have to make sure that we
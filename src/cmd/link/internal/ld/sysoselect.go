@@ -0,0 +1,160 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"encoding/json"
+	"internal/buildcfg"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Support for selecting the prebuilt host objects (.syso files) of
+// packages by target, so that a package can ship objects for several
+// targets without hiding them from the go command with build tags.
+//
+// The -sysoselect file is a JSON object mapping .syso file names to the
+// GOOS/GOARCH targets the objects are built for:
+//
+//	{
+//		"blake3-x86.syso": ["linux/amd64", "darwin/amd64", "windows/amd64"],
+//		"blake3-arm.syso": ["linux/arm64", "darwin/arm64"]
+//	}
+//
+// An object listed in the file is loaded only when linking for one of
+// its targets. Objects that are not listed follow the go/build file name
+// convention, name_GOOS_GOARCH.syso, name_GOOS.syso or name_GOARCH.syso,
+// whether or not a file is given: the go command already applies it, but
+// other build systems may not. Objects for other targets are skipped,
+// which -v reports, instead of failing the link on their machine type.
+//
+// The go command truncates the names of the members of package archives
+// to 16 bytes, so a listed name matches a member with the same first 16
+// bytes, and names must differ in their first 16 bytes.
+
+// sysoManifest maps the name of an archive member, truncated to 16
+// bytes, to the targets of the object listed under that name.
+var sysoManifest map[string][]string
+
+// loadSysoSelect reads the -sysoselect file.
+func loadSysoSelect(file string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		Exitf("%v", err)
+	}
+	var m map[string][]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		Exitf("-sysoselect: %s: %v", file, err)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sysoManifest = make(map[string][]string)
+	listed := make(map[string]string) // by key
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			Exitf("-sysoselect: %s: %q is not a file name", file, name)
+		}
+		for _, target := range m[name] {
+			if i := strings.Index(target, "/"); i <= 0 || i == len(target)-1 || strings.Count(target, "/") != 1 {
+				Exitf("-sysoselect: %s: %s: target %q is not of the form GOOS/GOARCH", file, name, target)
+			}
+		}
+		key := name
+		if len(key) > 16 {
+			key = key[:16]
+		}
+		if other, ok := listed[key]; ok {
+			Exitf("-sysoselect: %s: %s and %s have the same first 16 bytes", file, other, name)
+		}
+		listed[key] = name
+		sysoManifest[key] = m[name]
+	}
+}
+
+// sysoSelected reports whether the archive member name, a host object,
+// is to be loaded when linking for the target. If not, it also returns
+// the targets the object is for, for the report.
+func sysoSelected(name string) (bool, string) {
+	target := buildcfg.GOOS + "/" + buildcfg.GOARCH
+	if targets, ok := sysoManifest[name]; ok {
+		for _, t := range targets {
+			if t == target {
+				return true, ""
+			}
+		}
+		return false, strings.Join(targets, ", ")
+	}
+	if filepath.Ext(name) != ".syso" {
+		return true, ""
+	}
+	goos, goarch := sysoNameTarget(name)
+	if (goos == "" || matchGOOS(goos)) && (goarch == "" || goarch == buildcfg.GOARCH) {
+		return true, ""
+	}
+	switch {
+	case goos == "":
+		return false, "GOARCH=" + goarch
+	case goarch == "":
+		return false, "GOOS=" + goos
+	}
+	return false, goos + "/" + goarch
+}
+
+// sysoNameTarget returns the GOOS and GOARCH, if any, that the name of a
+// .syso file constrains it to, following go/build.
+func sysoNameTarget(name string) (goos, goarch string) {
+	name = strings.TrimSuffix(name, ".syso")
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return "", ""
+	}
+	l := strings.Split(name[i:], "_")
+	n := len(l)
+	if n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]] {
+		return l[n-2], l[n-1]
+	}
+	if knownOS[l[n-1]] {
+		return l[n-1], ""
+	}
+	if knownArch[l[n-1]] {
+		return "", l[n-1]
+	}
+	return "", ""
+}
+
+// matchGOOS reports whether code for goos can be linked into the
+// target, following go/build.
+func matchGOOS(goos string) bool {
+	switch {
+	case goos == buildcfg.GOOS:
+		return true
+	case goos == "linux":
+		return buildcfg.GOOS == "android"
+	case goos == "solaris":
+		return buildcfg.GOOS == "illumos"
+	case goos == "darwin":
+		return buildcfg.GOOS == "ios"
+	}
+	return false
+}
+
+// Known GOOS and GOARCH values, as in go/build/syslist.go.
+var (
+	knownOS   = knownList("aix android darwin dragonfly freebsd hurd illumos ios js linux nacl netbsd openbsd plan9 solaris windows zos")
+	knownArch = knownList("386 amd64 amd64p32 arm armbe arm64 arm64be loong64 mips mipsle mips64 mips64le mips64p32 mips64p32le ppc ppc64 ppc64le riscv riscv64 s390 s390x sparc sparc64 wasm")
+)
+
+func knownList(list string) map[string]bool {
+	m := make(map[string]bool)
+	for _, s := range strings.Fields(list) {
+		m[s] = true
+	}
+	return m
+}
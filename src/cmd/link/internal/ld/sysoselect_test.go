@@ -0,0 +1,30 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import "testing"
+
+func TestSysoNameTarget(t *testing.T) {
+	tests := []struct {
+		name         string
+		goos, goarch string
+	}{
+		{"rsrc.syso", "", ""},
+		{"linux.syso", "", ""},
+		{"rsrc_windows.syso", "windows", ""},
+		{"rsrc_amd64.syso", "", "amd64"},
+		{"rsrc_windows_386.syso", "windows", "386"},
+		{"x_linux_arm64.syso", "linux", "arm64"},
+		{"x_arm64_linux.syso", "linux", ""},
+		{"x_linux_v3.syso", "", ""},
+		{"hw-arm64.syso", "", ""},
+	}
+	for _, test := range tests {
+		goos, goarch := sysoNameTarget(test.name)
+		if goos != test.goos || goarch != test.goarch {
+			t.Errorf("sysoNameTarget(%q) = %q, %q, want %q, %q", test.name, goos, goarch, test.goos, test.goarch)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test the edges written by -dumpdep=json: main.main calls
+// main.helper, and main.T.M is reached as a method of a type
+// converted to an interface.
+
+package main
+
+type I interface{ M() }
+
+type T int
+
+func (T) M() { println("M") }
+
+//go:noinline
+func helper() { println("helper") }
+
+//go:noinline
+func call(i I) { i.M() }
+
+func main() {
+	helper()
+	call(T(1))
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"fmt"
+)
+
+// A host object compiled without -fPIC holds absolute addresses. When
+// linking a PIE internally, the architecture's adddynrel turns those
+// in data into dynamic R_*_RELATIVE relocations, which dodata moves to
+// the relro segment. Those in code can only be fixed up by a dynamic
+// linker that writes to the text segment, which is permitted by
+// -allow-textrel, and those that are too small to hold an address
+// above 4GB cannot be fixed up at all.
+
+// elfTextrel is set when a dynamic relocation against the text
+// segment has been emitted, so that the output gets DT_TEXTREL.
+var elfTextrel bool
+
+// PIEAbsReloc is called by the architecture's adddynrel for the
+// absolute relocation r in the host object symbol s that cannot be
+// turned into an ordinary dynamic relocation when linking a PIE
+// internally. If fixable is set, r can be applied by the dynamic
+// linker as a text relocation. PIEAbsReloc reports whether the caller
+// should emit that dynamic relocation; otherwise, it reports an error.
+func PIEAbsReloc(target *Target, ldr *loader.Loader, s loader.Sym, r loader.Reloc, fixable bool) bool {
+	if fixable && *flagAllowTextrel {
+		elfTextrel = true
+		return true
+	}
+	rs := ldr.SymName(r.Sym())
+	if r.Add() != 0 {
+		rs += fmt.Sprintf("%+#x", r.Add())
+	}
+	advice := "recompile with -fPIC"
+	if fixable {
+		advice += " or link with -allow-textrel"
+	}
+	ldr.Errorf(s, "relocation %s at %s against %s cannot be used in a position-independent executable; %s",
+		sym.RelocName(target.Arch, r.Type()), hostRelocLoc(ldr, s, int64(r.Off())), rs, advice)
+	return false
+}
+
+// hostRelocLoc describes the location at offset off in the host object
+// section symbol s by the nearest symbol at or before it.
+func hostRelocLoc(ldr *loader.Loader, s loader.Sym, off int64) string {
+	name, v := ldr.SymName(s), int64(0)
+	for ss := ldr.SubSym(s); ss != 0; ss = ldr.SubSym(ss) {
+		ssv := ldr.SymValue(ss) - ldr.SymValue(s)
+		if ldr.SymName(ss) != "" && v <= ssv && ssv <= off {
+			name, v = ldr.SymName(ss), ssv
+		}
+	}
+	return fmt.Sprintf("%s+%#x", name, off-v)
+}
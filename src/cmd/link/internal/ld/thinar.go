@@ -0,0 +1,172 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"cmd/internal/bio"
+	"cmd/link/internal/sym"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Support for GNU thin archives, created with ar T.
+//
+// A thin archive has the same layout as a regular archive, with its
+// symbol map and extended name table stored in it, but the other
+// members are only headers: their contents are in the object files
+// named by the extended name table, with paths relative to the
+// archive. The armap offsets are those of the headers, which follow
+// one another. A regular archive added to a thin archive is referenced
+// as /N:origin, where origin is the offset of the member header in the
+// archive named by N; ar flattens thin archives added to a thin
+// archive, but older versions referenced them the same way.
+
+const THINMAG = "!<thin>\n"
+
+// A thinArchive is a thin archive being read.
+type thinArchive struct {
+	name  string // path of the archive file
+	names string // extended name table
+}
+
+// openThinArchive reads the extended name table of the thin archive
+// name, read through f.
+func openThinArchive(name string, f *bio.Reader) *thinArchive {
+	a := &thinArchive{name: name}
+	var arhdr ArHdr
+	for off := int64(SARMAG); ; {
+		l := nextar(f, off, &arhdr)
+		if l <= 0 || !thinStored(arhdr.name) {
+			break
+		}
+		if arhdr.name == "//" {
+			buf := make([]byte, atolwhex(arhdr.size))
+			if _, err := io.ReadFull(f, buf); err != nil {
+				Exitf("%s: short read: %v", name, err)
+			}
+			a.names = string(buf)
+			break
+		}
+		off += l
+	}
+	return a
+}
+
+// thinStored reports whether the thin archive member named name, the
+// symbol map or the extended name table, is stored in the archive.
+func thinStored(name string) bool {
+	return name == "/" || name == "/SYM64/" || name == "//"
+}
+
+// thinNext returns the offset of the archive member that follows the
+// one named name whose header is at off, and l bytes long with its
+// contents as returned by nextar.
+func thinNext(name string, off, l int64) int64 {
+	if thinStored(name) {
+		return off + l
+	}
+	return off + SAR_HDR
+}
+
+// A thinMember is the object file of a thin archive member.
+type thinMember struct {
+	f    *bio.Reader // positioned at the start of the object
+	size int64
+	file string // the file holding the object
+	pn   string // the name of the member, for diagnostics
+}
+
+// member opens the object file of the member with header arhdr. The
+// caller must close m.f.
+func (a *thinArchive) member(arhdr *ArHdr) thinMember {
+	name := arhdr.name
+	if !strings.HasPrefix(name, "/") {
+		Exitf("%s: malformed thin archive member %q", a.name, name)
+	}
+	origin := int64(-1)
+	if i := strings.Index(name, ":"); i >= 0 {
+		o, err := strconv.ParseInt(name[i+1:], 10, 64)
+		if err != nil {
+			Exitf("%s: malformed thin archive member %q", a.name, name)
+		}
+		origin = o
+		name = name[:i]
+	}
+	i, err := strconv.Atoi(name[1:])
+	if err != nil || i < 0 || i >= len(a.names) {
+		Exitf("%s: malformed thin archive member %q", a.name, arhdr.name)
+	}
+	path := a.names[i:]
+	if j := strings.Index(path, "/\n"); j >= 0 {
+		path = path[:j]
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(a.name), path)
+	}
+
+	f, err := bio.Open(path)
+	if err != nil {
+		Exitf("%s: cannot open member: %v", a.name, err)
+	}
+	if origin < 0 {
+		return thinMember{f: f, size: atolwhex(arhdr.size), file: path, pn: fmt.Sprintf("%s(%s)", a.name, path)}
+	}
+
+	// A member of the archive at path.
+	var magbuf [SARMAG]byte
+	if _, err := io.ReadFull(f, magbuf[:]); err != nil {
+		Exitf("%s: %s is not an archive file", a.name, path)
+	}
+	var hdr ArHdr
+	if nextar(f, origin, &hdr) <= 0 {
+		Exitf("%s: %s missing archive entry at offset %d", a.name, path, origin)
+	}
+	if string(magbuf[:]) == THINMAG {
+		nested := openThinArchive(path, f)
+		f.Close()
+		return nested.member(&hdr)
+	}
+	if string(magbuf[:]) != ARMAG {
+		Exitf("%s: %s is not an archive file", a.name, path)
+	}
+	return thinMember{f: f, size: atolwhex(hdr.size), file: path, pn: fmt.Sprintf("%s(%s)", path, strings.TrimSuffix(hdr.name, "/"))}
+}
+
+// thinKey returns a key identifying the object file of m, the same
+// whether the member was named by an absolute or a relative path, to
+// load it only once.
+func thinKey(m thinMember) string {
+	path, err := filepath.Abs(m.file)
+	if err != nil {
+		path = filepath.Clean(m.file)
+	}
+	return fmt.Sprintf("%s@%d", path, m.f.Offset())
+}
+
+// load loads the object file of the member with header arhdr, unless
+// loaded records that it has been loaded already.
+func (a *thinArchive) load(ctxt *Link, arhdr *ArHdr, lib *sym.Library, loaded map[string]bool) {
+	m := a.member(arhdr)
+	defer m.f.Close()
+	key := thinKey(m)
+	if loaded[key] {
+		return
+	}
+	loaded[key] = true
+	h := ldobj(ctxt, m.f, lib, m.size, m.pn, m.file)
+	if h.lto != "" {
+		Errorf(nil, "%s: %s for link-time optimization cannot be linked internally, use -linkmode=external", m.pn, h.lto)
+		return
+	}
+	if h.ld == nil {
+		Errorf(nil, "%s: unrecognized object file format", m.pn)
+		return
+	}
+	m.f.MustSeek(h.off, 0)
+	h.ld(ctxt, m.f, h.pkg, h.length, h.pn)
+}
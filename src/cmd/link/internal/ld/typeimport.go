@@ -0,0 +1,133 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"debug/elf"
+	"sort"
+	"strings"
+)
+
+// A plugin carries the type descriptors of all the packages it links,
+// most of which the program opening it has too: the runtime then finds
+// the duplicates by comparing the types when it loads the plugin.
+//
+// With -pluginhost, the linker reads the dynamic symbols of the program
+// the plugin is built for, which exports its type descriptors as it can
+// open plugins, and leaves out of the plugin the descriptors the
+// program exports. They become undefined symbols, which the dynamic
+// linker binds to the program's descriptors, and the dead code pass
+// does not keep what only they refer to, such as their names and
+// methods. The packages both have must have the same hashes, as
+// plugin.Open checks; the plugin can then only be opened by that
+// program, or by one that exports the same descriptors.
+//
+// Type descriptors refer to others by their offsets from the start of
+// the types of their module, which cannot reach another module. The
+// plugin lists the imported descriptors in a table of pointers,
+// type..imports, laid out with its types, and an offset to an imported
+// type is the offset of its entry. The runtime adds the entries to the
+// typemap of the plugin when it loads it, see typelinksinit.
+
+// typeImports are the type descriptors a plugin leaves to the program
+// that opens it.
+type typeImports struct {
+	host map[loader.Sym]bool  // the types the program exports
+	tab  loader.Sym           // the table of the imported types
+	off  map[loader.Sym]int64 // the offset of the entry of each type in tab
+}
+
+// loadPluginHost reads the types the -pluginhost program exports.
+func (ctxt *Link) loadPluginHost() {
+	f, err := elf.Open(*flagPluginHost)
+	if err != nil {
+		Exitf("-pluginhost: %v", err)
+	}
+	defer f.Close()
+	dynsyms, err := f.DynamicSymbols()
+	if err != nil {
+		Exitf("-pluginhost: %s: %v", *flagPluginHost, err)
+	}
+
+	hashes := make(map[string][]byte)
+	types := make(map[string]bool)
+	for i := range dynsyms {
+		s := &dynsyms[i]
+		if s.Section == elf.SHN_UNDEF || elf.ST_TYPE(s.Info) != elf.STT_OBJECT {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s.Name, "go.link.pkghashbytes."):
+			hashes[strings.TrimPrefix(s.Name, "go.link.pkghashbytes.")] = readelfsymboldata(ctxt, f, s)
+		case strings.HasPrefix(s.Name, "type.") && !strings.HasPrefix(s.Name, "type.."):
+			types[s.Name] = true
+		}
+	}
+	if len(hashes) == 0 {
+		Exitf("-pluginhost: %s cannot open plugins", *flagPluginHost)
+	}
+	for _, l := range ctxt.Library {
+		if h, ok := hashes[l.Pkg]; ok && !bytes.Equal(h, ctxt.pkghashes[l]) {
+			Exitf("-pluginhost: %s was built with a different version of package %s", *flagPluginHost, l.Pkg)
+		}
+	}
+
+	ldr := ctxt.loader
+	ctxt.typeImports.host = make(map[loader.Sym]bool)
+	for s := loader.Sym(1); s < loader.Sym(ldr.NDef()); s++ {
+		if ldr.IsGoType(s) && types[typeSymbolMangle(ldr.SymName(s))] {
+			ctxt.typeImports.host[s] = true
+		}
+	}
+}
+
+// importTypes turns the reachable types the program exports into
+// dynamic imports, and lists them in type..imports.
+func (ctxt *Link) importTypes() {
+	ldr := ctxt.loader
+	var imports []loader.Sym
+	for s := range ctxt.typeImports.host {
+		if ldr.AttrReachable(s) {
+			imports = append(imports, s)
+		}
+	}
+	if len(imports) == 0 {
+		return
+	}
+	sort.Slice(imports, func(i, j int) bool { return imports[i] < imports[j] })
+
+	// The name puts the table with the type descriptors, see symtab.
+	tab := ldr.CreateSymForUpdate("type..imports", 0)
+	tab.SetType(sym.SRODATA)
+	tab.SetLocal(true)
+	ctxt.typeImports.tab = tab.Sym()
+	ctxt.typeImports.off = make(map[loader.Sym]int64, len(imports))
+	for _, s := range imports {
+		ctxt.typeImports.off[s] = tab.Size()
+		tab.AddAddr(ctxt.Arch, s)
+
+		// Keep the data, which the GC bitmaps of the variables of the
+		// type and the DWARF types are decoded from.
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetType(sym.SDYNIMPORT)
+		ldr.SetSymElfType(s, elf.STT_OBJECT)
+	}
+	if ctxt.Debugvlog != 0 {
+		ctxt.Logf("pluginhost: %d type descriptors imported from %s\n", len(imports), *flagPluginHost)
+	}
+}
+
+// typeImportOff returns the offset of the entry of the imported type s
+// from the start of the types, and whether s is imported.
+func (ti *typeImports) typeImportOff(ldr *loader.Loader, s loader.Sym) (int64, bool) {
+	off, ok := ti.off[s]
+	if !ok {
+		return 0, false
+	}
+	return ldr.SymValue(ti.tab) + off - int64(ldr.SymSect(ti.tab).Vaddr), true
+}
@@ -30,7 +30,7 @@ func (ctxt *Link) typelink() {
 	typelinks := byTypeStr{}
 	var itabs []loader.Sym
 	for s := loader.Sym(1); s < loader.Sym(ldr.NSym()); s++ {
-		if !ldr.AttrReachable(s) {
+		if !ldr.AttrReachable(s) || ldr.SymType(s) == sym.SDYNIMPORT {
 			continue
 		}
 		if ldr.IsTypelink(s) {
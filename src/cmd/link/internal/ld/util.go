@@ -45,14 +45,24 @@ func afterErrorAction() {
 	if *flagH {
 		panic("error")
 	}
-	if nerrors > 20 {
+	if limit := errorLimit(); limit > 0 && nerrors > limit {
 		Exitf("too many errors")
 	}
 }
 
+// errorLimit returns the number of errors to stop after, or 0 to never
+// stop: that given by -errorlimit, or 20 by default.
+func errorLimit() int {
+	if *flagErrorLimit < 0 {
+		return 20
+	}
+	return *flagErrorLimit
+}
+
 // Errorf logs an error message.
 //
-// If more than 20 errors have been printed, exit with an error.
+// If more errors than the -errorlimit have been printed, exit with an
+// error.
 //
 // Logging an error means that on exit cmd/link will delete any
 // output file and return a non-zero error code.
@@ -65,9 +75,19 @@ func Errorf(dummy *int, format string, args ...interface{}) {
 	afterErrorAction()
 }
 
+// warnf logs a warning message, or, with -strictwarnings, an error.
+func warnf(format string, args ...interface{}) {
+	if *flagStrictWarnings {
+		Errorf(nil, format, args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
+
 // Errorf method logs an error message.
 //
-// If more than 20 errors have been printed, exit with an error.
+// If more errors than the -errorlimit have been printed, exit with an
+// error.
 //
 // Logging an error means that on exit cmd/link will delete any
 // output file and return a non-zero error code.
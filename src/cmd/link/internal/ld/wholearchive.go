@@ -0,0 +1,128 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Support for -wholearchive.
+//
+// Normally only the archive members that define a symbol referenced
+// from elsewhere are linked in. Some C libraries have members that
+// are never referenced but register themselves from a constructor
+// (drivers, crypto engines); -wholearchive=pattern makes the linker
+// include every member of the host archives whose file name matches
+// pattern. When linking externally, the matching archives named in
+// cgo LDFLAGS are wrapped in --whole-archive/--no-whole-archive
+// (-force_load on darwin). When linking internally, all of their
+// members are loaded, and everything they define is kept by the dead
+// code pass.
+
+// wholeArchives holds the -wholearchive patterns.
+var wholeArchives []string
+
+func addWholeArchive(pattern string) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		Exitf("-wholearchive: bad pattern %q: %v", pattern, err)
+	}
+	wholeArchives = append(wholeArchives, pattern)
+}
+
+// isWholeArchive reports whether the archive at path matches a
+// -wholearchive pattern. Patterns are matched against the file name
+// of the archive and, if they contain a slash, against its path.
+func isWholeArchive(path string) bool {
+	for _, pattern := range wholeArchives {
+		name := filepath.Base(path)
+		if strings.Contains(pattern, "/") {
+			name = path
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveArg returns the archive named by the host linker argument
+// arg, either a path ending in .a or -lname, using the -L directories
+// in args to look for the latter. It returns "" if arg does not name
+// an archive, or if it names a library that is not found as an
+// archive.
+func (ctxt *Link) archiveArg(arg string, args []string) string {
+	if !strings.HasPrefix(arg, "-") {
+		if strings.HasSuffix(arg, ".a") {
+			return arg
+		}
+		return ""
+	}
+	if !strings.HasPrefix(arg, "-l") || len(arg) == 2 {
+		return ""
+	}
+	name := "lib" + arg[2:] + ".a"
+	if strings.HasPrefix(arg, "-l:") {
+		name = arg[3:]
+		if !strings.HasSuffix(name, ".a") {
+			return ""
+		}
+	}
+	for _, a := range args {
+		if strings.HasPrefix(a, "-L") {
+			p := filepath.Join(a[2:], name)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
+	if p := ctxt.findLibPath(name); p != "none" && filepath.IsAbs(p) {
+		return p
+	}
+	return ""
+}
+
+// wholeArchiveArgs returns args, the cgo LDFLAGS passed to the
+// external linker, with every archive that matches a -wholearchive
+// pattern marked to be linked in full. The order of the arguments
+// is preserved.
+func (ctxt *Link) wholeArchiveArgs(args []string) []string {
+	if len(wholeArchives) == 0 {
+		return args
+	}
+	var out []string
+	for _, arg := range args {
+		ar := ctxt.archiveArg(arg, args)
+		if ar == "" || !isWholeArchive(ar) {
+			out = append(out, arg)
+			continue
+		}
+		if ctxt.IsDarwin() {
+			out = append(out, "-Wl,-force_load,"+ar)
+		} else {
+			out = append(out, "-Wl,--whole-archive", arg, "-Wl,--no-whole-archive")
+		}
+	}
+	return out
+}
+
+// loadWholeArchives loads all the members of the archives named in
+// cgo LDFLAGS that match a -wholearchive pattern, for internal
+// linking.
+func (ctxt *Link) loadWholeArchives() {
+	if len(wholeArchives) == 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, arg := range ldflag {
+		ar := ctxt.archiveArg(arg, ldflag)
+		if ar == "" || seen[ar] || !isWholeArchive(ar) {
+			continue
+		}
+		seen[ar] = true
+		hostArchive(ctxt, ar, true)
+	}
+}
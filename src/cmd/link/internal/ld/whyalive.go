@@ -0,0 +1,238 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"bytes"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Support for -whyalive, which prints, at the end of the link, why the
+// symbols matching a pattern are in the output: the shortest chain of
+// references by which the dead code pass reaches each of them from a
+// root, as in
+//
+//	fmt.Fprintln is reachable:
+//		fmt.Fprintln
+//		<- main.main (call)
+//		<- runtime.main_main·f (data reference)
+//		<- runtime.main (code reference)
+//		<- runtime.mainPC (data reference)
+//		<- runtime.rt0_go (code reference)
+//		<- _rt0_amd64 (call)
+//		<- _rt0_amd64_linux (call)
+//		_rt0_amd64_linux is the entry point
+//
+// or that it is not reachable. A function that is not reachable itself,
+// because it is inlined everywhere it is called, is reported with the
+// chain of a function it is inlined into. The patterns are as for
+// filepath.Match, so * does not match a /. To find the shortest chains,
+// the dead code pass records every reference it follows, which it only
+// does with -whyalive.
+
+var whyAlivePatterns []string
+
+func addWhyAlive(pattern string) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		Exitf("-whyalive: bad pattern %q: %v", pattern, err)
+	}
+	whyAlivePatterns = append(whyAlivePatterns, pattern)
+}
+
+// A whyAliveGraph records the references the dead code pass follows.
+type whyAliveGraph struct {
+	edges []whyAliveEdge
+}
+
+type whyAliveEdge struct {
+	from, to loader.Sym // from is 0 for a root
+	why      depReason
+}
+
+// newWhyAliveGraph returns the graph to record for -whyalive, or nil
+// if it is not set.
+func newWhyAliveGraph() *whyAliveGraph {
+	if len(whyAlivePatterns) == 0 {
+		return nil
+	}
+	return &whyAliveGraph{}
+}
+
+func (g *whyAliveGraph) edge(from, to loader.Sym, why depReason) {
+	g.edges = append(g.edges, whyAliveEdge{from, to, why})
+}
+
+// report returns the -whyalive report, given the graph of the
+// completed dead code pass.
+func (g *whyAliveGraph) report(ctxt *Link) string {
+	ldr := ctxt.loader
+	n := ldr.NSym()
+
+	// Index the edges by their source, roots first.
+	sort.SliceStable(g.edges, func(i, j int) bool { return g.edges[i].from < g.edges[j].from })
+	start := make([]int32, n+1)
+	for _, e := range g.edges {
+		start[e.from+1]++
+	}
+	for i := 1; i <= n; i++ {
+		start[i] += start[i-1]
+	}
+
+	// Find the shortest chains with a breadth-first walk from the
+	// roots. via[s] is 1 + the index of the edge s is reached by, and
+	// depth[s] the length of its chain.
+	via := make([]int32, n)
+	depth := make([]int32, n)
+	var queue []loader.Sym
+	reach := func(i int32) {
+		e := g.edges[i]
+		if e.to != 0 && via[e.to] == 0 {
+			via[e.to] = i + 1
+			depth[e.to] = depth[e.from] + 1
+			queue = append(queue, e.to)
+		}
+	}
+	for i := start[0]; i < start[1]; i++ {
+		reach(i)
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for i := start[s]; i < start[s+1]; i++ {
+			reach(i)
+		}
+	}
+	live := func(s loader.Sym) bool { return via[s] != 0 && ldr.AttrReachable(s) }
+
+	dynexp := make(map[loader.Sym]bool)
+	for _, s := range ctxt.dynexp {
+		dynexp[s] = true
+	}
+	var buf bytes.Buffer
+	// chain prints the chain by which s is reached.
+	chain := func(s loader.Sym) {
+		fmt.Fprintf(&buf, "\t%s\n", ldr.SymName(s))
+		for {
+			e := g.edges[via[s]-1]
+			if e.from == 0 {
+				break
+			}
+			fmt.Fprintf(&buf, "\t<- %s (%s)\n", ldr.SymName(e.from), whyAliveReason(ldr, e))
+			s = e.from
+		}
+		root := "a root of the dead code pass"
+		switch {
+		case ldr.SymName(s) == *flagEntrySymbol:
+			root = "the entry point"
+		case dynexp[s]:
+			root = "exported"
+		}
+		fmt.Fprintf(&buf, "\t%s is %s\n", ldr.SymName(s), root)
+	}
+
+	for _, pattern := range whyAlivePatterns {
+		var matched []loader.Sym
+		for s := loader.Sym(1); s < loader.Sym(n); s++ {
+			if !live(s) {
+				continue
+			}
+			if ok, _ := filepath.Match(pattern, ldr.SymName(s)); ok {
+				matched = append(matched, s)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool { return ldr.SymName(matched[i]) < ldr.SymName(matched[j]) })
+		for _, s := range matched {
+			fmt.Fprintf(&buf, "%s is reachable:\n", ldr.SymName(s))
+			chain(s)
+		}
+		if len(matched) > 0 {
+			continue
+		}
+
+		// A function inlined everywhere it is called is not itself
+		// in the output, but its code is, in the functions it is
+		// inlined into.
+		inlinedInto := make(map[string][]loader.Sym)
+		for s := loader.Sym(1); s < loader.Sym(n); s++ {
+			if !live(s) || ldr.SymType(s) != sym.STEXT {
+				continue
+			}
+			fi := ldr.FuncInfo(s)
+			if !fi.Valid() {
+				continue
+			}
+			fi.Preload()
+			seen := make(map[string]bool)
+			for k := 0; k < int(fi.NumInlTree()); k++ {
+				name := ldr.SymName(fi.InlTree(k).Func)
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				if ok, _ := filepath.Match(pattern, name); ok {
+					inlinedInto[name] = append(inlinedInto[name], s)
+				}
+			}
+		}
+		if len(inlinedInto) == 0 {
+			fmt.Fprintf(&buf, "%s is not reachable\n", pattern)
+			continue
+		}
+		var names []string
+		for name := range inlinedInto {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// Show the caller closest to a root.
+			callers := inlinedInto[name]
+			sort.SliceStable(callers, func(i, j int) bool {
+				a, b := callers[i], callers[j]
+				if depth[a] != depth[b] {
+					return depth[a] < depth[b]
+				}
+				return ldr.SymName(a) < ldr.SymName(b)
+			})
+			caller := ldr.SymName(callers[0])
+			if len(callers) > 1 {
+				caller += fmt.Sprintf(" (and %d other functions)", len(callers)-1)
+			}
+			fmt.Fprintf(&buf, "%s is not reachable itself, but is inlined into %s, which is reachable:\n", name, caller)
+			chain(callers[0])
+		}
+	}
+	return buf.String()
+}
+
+// whyAliveReason describes the reference e.
+func whyAliveReason(ldr *loader.Loader, e whyAliveEdge) string {
+	switch e.why {
+	case depReloc:
+		relocs := ldr.Relocs(e.from)
+		for i := 0; i < relocs.Count(); i++ {
+			r := relocs.At(i)
+			if r.Sym() == e.to && r.Type().IsDirectCall() {
+				return "call"
+			}
+		}
+		if ldr.SymType(e.from) == sym.STEXT {
+			return "code reference"
+		}
+		return "data reference"
+	case depAux:
+		return "function data"
+	case depUsedInIface:
+		return "converted to an interface"
+	case depMethod:
+		return "method of a type converted to an interface"
+	case depCarrier:
+		return "same host object section"
+	}
+	return e.why.String()
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ld
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// checkWX reports an error for every reachable host object section
+// that is both writable and executable and defines both code and data,
+// so that loadelf could load it as neither text nor data, unless
+// -allow-wx is set. Such a section goes in the text segment, which
+// then has to be writable as a whole: the section cannot be split, as
+// its code may refer to its data at fixed offsets, without
+// relocations. The Go linker never lays out a writable and executable
+// segment otherwise.
+func (ctxt *Link) checkWX() {
+	if *flagAllowWX {
+		return
+	}
+	ldr := ctxt.loader
+	for _, s := range ctxt.wxsects {
+		if ldr.AttrReachable(s) {
+			Errorf(nil, "host object section %s is writable and executable and defines both code and data; linking it would make all of the text writable (use -allow-wx to permit it)", ldr.SymName(s))
+		}
+	}
+}
+
+// checkLoadWX reports an error if the PT_LOAD segments of the output,
+// as finally laid out, map any page both writable and executable,
+// unless -allow-wx is set. checkWX only catches the host object
+// sections that make the text segment writable; this also catches
+// anything else that ends up in a writable and executable segment, or
+// a writable segment sharing a page with an executable one, whatever
+// placed the sections there (-sectlayout, -addsection,
+// -reserve-section, -R).
+func checkLoadWX() {
+	if *flagAllowWX {
+		return
+	}
+	page := uint64(*FlagRound)
+	if page < minPageSize {
+		page = minPageSize
+	}
+	for _, msg := range loadWX(phdr[:ehdr.Phnum], page) {
+		Errorf(nil, "%s (use -allow-wx to permit it)", msg)
+	}
+}
+
+// minPageSize is the smallest page size of the targets, which the
+// PT_LOAD segments are mapped in.
+const minPageSize = 4096
+
+// loadWX returns a description of each PT_LOAD segment in phdrs that
+// is writable and executable, and of each pair of a writable and an
+// executable segment that share a page of size page.
+func loadWX(phdrs []*ElfPhdr, page uint64) []string {
+	var loads []*ElfPhdr
+	for _, ph := range phdrs {
+		if ph.Type == elf.PT_LOAD && ph.Memsz > 0 {
+			loads = append(loads, ph)
+		}
+	}
+	const wx = elf.PF_W | elf.PF_X
+	var msgs []string
+	for i, p := range loads {
+		if p.Flags&wx == wx {
+			msgs = append(msgs, fmt.Sprintf("segment at %#x is writable and executable", p.Vaddr))
+			continue
+		}
+		for _, q := range loads[i+1:] {
+			if q.Flags&wx == wx || (p.Flags|q.Flags)&wx != wx {
+				continue
+			}
+			pstart, pend := p.Vaddr&^(page-1), (p.Vaddr+p.Memsz+page-1)&^(page-1)
+			qstart, qend := q.Vaddr&^(page-1), (q.Vaddr+q.Memsz+page-1)&^(page-1)
+			if pstart < qend && qstart < pend {
+				msgs = append(msgs, fmt.Sprintf("segments at %#x (%s) and %#x (%s) share a page, which is mapped writable and executable", p.Vaddr, p.Flags, q.Vaddr, q.Flags))
+			}
+		}
+	}
+	return msgs
+}
@@ -1730,9 +1730,13 @@ func (f *xcoffFile) emitRelocations(ctxt *Link, fileoff int64) {
 				if ldr.SymDynid(rr.Xsym) < 0 {
 					ldr.Errorf(s, "reloc %s to non-coff symbol %s (outer=%s) %d %d", r.Type(), ldr.SymName(r.Sym()), ldr.SymName(rr.Xsym), ldr.SymType(r.Sym()), ldr.SymDynid(rr.Xsym))
 				}
+				off := ctxt.Out.Offset()
 				if !thearch.Xcoffreloc1(ctxt.Arch, ctxt.Out, ldr, s, rr, int64(uint64(ldr.SymValue(s)+int64(r.Off()))-base)) {
 					ldr.Errorf(s, "unsupported obj reloc %d(%s)/%d to %s", r.Type(), r.Type(), r.Siz(), ldr.SymName(r.Sym()))
 				}
+				if ctxt.relocDump != nil {
+					ctxt.relocDump.add(ctxt, sect, s, r, rr, ctxt.Out.bytesAt(off, ctxt.Out.Offset()-off))
+				}
 			}
 		}
 		sect.Rellen = uint64(ctxt.Out.Offset()) - sect.Reloff
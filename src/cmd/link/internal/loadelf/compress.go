@@ -0,0 +1,64 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loadelf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"internal/zstd"
+	"io"
+)
+
+// Decompress returns the contents of an ELF compressed section, whose
+// data starts with the compression header, and the alignment of the
+// contents the header records. The linker uses it for the sections of
+// host objects marked SHF_COMPRESSED, and to check the DWARF sections
+// it compresses.
+func Decompress(e binary.ByteOrder, is64 bool, data []byte) ([]byte, uint64, error) {
+	var typ elf.CompressionType
+	var size, align uint64
+	if is64 {
+		var ch elf.Chdr64
+		if err := binary.Read(bytes.NewReader(data), e, &ch); err != nil {
+			return nil, 0, fmt.Errorf("short compression header")
+		}
+		typ, size, align = elf.CompressionType(ch.Type), ch.Size, ch.Addralign
+		data = data[binary.Size(ch):]
+	} else {
+		var ch elf.Chdr32
+		if err := binary.Read(bytes.NewReader(data), e, &ch); err != nil {
+			return nil, 0, fmt.Errorf("short compression header")
+		}
+		typ, size, align = elf.CompressionType(ch.Type), uint64(ch.Size), uint64(ch.Addralign)
+		data = data[binary.Size(ch):]
+	}
+
+	var r io.Reader
+	switch typ {
+	case elf.COMPRESS_ZLIB:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, fmt.Errorf("zlib: %v", err)
+		}
+		r = zr
+	case elf.COMPRESS_ZSTD:
+		r = zstd.NewReader(bytes.NewReader(data))
+	default:
+		return nil, 0, fmt.Errorf("unknown compression type %d", typ)
+	}
+	// Read one byte more than the header says, to find a mismatch
+	// without trusting the header to allocate.
+	out, err := io.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("decompressing: %v", err)
+	}
+	if uint64(len(out)) != size {
+		return nil, 0, fmt.Errorf("decompressed to %d bytes, compression header says %d", len(out), size)
+	}
+	return out, align, nil
+}
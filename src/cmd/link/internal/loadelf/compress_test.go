@@ -0,0 +1,54 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loadelf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	data := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog; ", 100))
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write(data)
+	w.Close()
+
+	tests := []struct {
+		name string
+		e    binary.ByteOrder
+		is64 bool
+		hdr  interface{}
+		err  string
+	}{
+		{"64", binary.LittleEndian, true, &elf.Chdr64{Type: uint32(elf.COMPRESS_ZLIB), Size: uint64(len(data)), Addralign: 8}, ""},
+		{"32", binary.BigEndian, false, &elf.Chdr32{Type: uint32(elf.COMPRESS_ZLIB), Size: uint32(len(data)), Addralign: 8}, ""},
+		{"size", binary.LittleEndian, true, &elf.Chdr64{Type: uint32(elf.COMPRESS_ZLIB), Size: uint64(len(data)) - 1, Addralign: 8}, "compression header says"},
+		{"type", binary.LittleEndian, true, &elf.Chdr64{Type: 3, Size: uint64(len(data)), Addralign: 8}, "unknown compression type 3"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		binary.Write(&b, test.e, test.hdr)
+		b.Write(z.Bytes())
+		got, align, err := Decompress(test.e, test.is64, b.Bytes())
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, data) || align != 8 {
+			t.Errorf("%s: got %d bytes aligned to %d, want %d bytes aligned to 8", test.name, len(got), align, len(data))
+		}
+	}
+}
@@ -48,7 +48,16 @@ THE SOFTWARE.
 */
 
 const (
-	SHT_ARM_ATTRIBUTES = 0x70000003
+	SHT_ARM_ATTRIBUTES   = 0x70000003
+	SHT_RISCV_ATTRIBUTES = 0x70000003
+
+	GRP_COMDAT     = 0x1
+	STB_GNU_UNIQUE = 10
+	STT_GNU_IFUNC  = elf.STT_LOOS
+
+	NT_GNU_PROPERTY_TYPE_0             = 5
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND = 0xc0000000
+	GNU_PROPERTY_X86_FEATURE_1_AND     = 0xc0000002
 )
 
 type ElfSect struct {
@@ -65,6 +74,7 @@ type ElfSect struct {
 	entsize     uint64
 	base        []byte
 	readOnlyMem bool // Is this section in readonly memory?
+	discarded   bool // Is this section in a COMDAT group loaded before?
 	sym         loader.Sym
 }
 
@@ -95,6 +105,53 @@ type ElfObj struct {
 	shstrndx  uint32
 }
 
+// comdatGroups maps the signature of each COMDAT group loaded from host
+// objects to the symbols of its sections, by section name. Only the
+// first group with a signature is loaded: the sections of the others are
+// discarded, and references to them are redirected to the sections of
+// the same name in the group loaded.
+var comdatGroups = make(map[string]map[string]loader.Sym)
+
+// A SymDef is a definition of a symbol by a host object.
+type SymDef struct {
+	Pkg  string // the package of the object
+	File string // the object, as archive(member) for archive members
+	Sect string // the section of the object holding the symbol
+	Size int64
+	Weak bool
+}
+
+// A DupSymError reports a symbol defined by a host object that is
+// already defined, by another host object as described by Prev, or by
+// a Go package if Prev is nil.
+type DupSymError struct {
+	Sym  loader.Sym
+	Name string
+	Def  SymDef
+	Prev *SymDef
+}
+
+func (e *DupSymError) Error() string {
+	prev := "a Go package"
+	if e.Prev != nil {
+		prev = e.Prev.File
+	}
+	return fmt.Sprintf("loadelf: %s: duplicate symbol %s, already defined by %s", e.Def.File, e.Name, prev)
+}
+
+// hostSects maps the symbols of the sections loaded from host objects
+// to the objects and sections, and weakDefs holds the symbols that they
+// define as weak, to describe the first definition of a symbol defined
+// again.
+var (
+	hostSects = make(map[loader.Sym]hostSect)
+	weakDefs  = make(map[loader.Sym]bool)
+)
+
+type hostSect struct {
+	pkg, file, name string
+}
+
 type ElfSym struct {
 	name  string
 	value uint64
@@ -113,7 +170,19 @@ const (
 	TagCompatibility      = 32
 	TagNoDefaults         = 64
 	TagAlsoCompatibleWith = 65
+	TagCPUArch            = 6
+	TagCPUArchProfile     = 7
+	TagARMISAUse          = 8
+	TagTHUMBISAUse        = 9
+	TagFPArch             = 10
 	TagABIVFPArgs         = 28
+
+	TagRISCVStackAlign       = 4
+	TagRISCVArch             = 5
+	TagRISCVUnalignedAccess  = 6
+	TagRISCVPrivSpec         = 8
+	TagRISCVPrivSpecMinor    = 10
+	TagRISCVPrivSpecRevision = 12
 )
 
 type elfAttribute struct {
@@ -146,6 +215,10 @@ func (a *elfAttributeList) uleb128() uint64 {
 		return 0
 	}
 	v, size := binary.Uvarint(a.data)
+	if size <= 0 {
+		a.err = io.EOF
+		return 0
+	}
 	a.data = a.data[size:]
 	return v
 }
@@ -181,17 +254,17 @@ func (a *elfAttributeList) done() bool {
 	return false
 }
 
-// Look for the attribute that indicates the object uses the hard-float ABI (a
-// file-level attribute with tag Tag_VFP_arch and value 1). Unfortunately the
-// format used means that we have to parse all of the file-level attributes to
-// find the one we are looking for. This format is slightly documented in "ELF
-// for the ARM Architecture" but mostly this is derived from reading the source
+// parseArmAttributes returns the file attributes of the "aeabi" vendor in
+// the contents of an .ARM.attributes section. Unfortunately the format used
+// means that we have to parse all of the file-level attributes to find the
+// ones we are looking for. This format is slightly documented in "ELF for
+// the ARM Architecture" but mostly this is derived from reading the source
 // to gold and readelf.
-func parseArmAttributes(e binary.ByteOrder, data []byte) (found bool, ehdrFlags uint32, err error) {
-	found = false
+func parseArmAttributes(e binary.ByteOrder, data []byte) (*ARMAttributes, error) {
 	if data[0] != 'A' {
-		return false, 0, fmt.Errorf(".ARM.attributes has unexpected format %c\n", data[0])
+		return nil, fmt.Errorf(".ARM.attributes has unexpected format %c\n", data[0])
 	}
+	attrs := new(ARMAttributes)
 	data = data[1:]
 	for len(data) != 0 {
 		sectionlength := e.Uint32(data)
@@ -200,7 +273,7 @@ func parseArmAttributes(e binary.ByteOrder, data []byte) (found bool, ehdrFlags
 
 		nulIndex := bytes.IndexByte(sectiondata, 0)
 		if nulIndex < 0 {
-			return false, 0, fmt.Errorf("corrupt .ARM.attributes (section name not NUL-terminated)\n")
+			return nil, fmt.Errorf("corrupt .ARM.attributes (section name not NUL-terminated)\n")
 		}
 		name := string(sectiondata[:nulIndex])
 		sectiondata = sectiondata[nulIndex+1:]
@@ -220,17 +293,193 @@ func parseArmAttributes(e binary.ByteOrder, data []byte) (found bool, ehdrFlags
 			attrList := elfAttributeList{data: subsectiondata}
 			for !attrList.done() {
 				attr := attrList.armAttr()
-				if attr.tag == TagABIVFPArgs && attr.ival == 1 {
-					found = true
-					ehdrFlags = 0x5000402 // has entry point, Version5 EABI, hard-float ABI
+				switch attr.tag {
+				case TagCPUArch:
+					attrs.CPUArch = attr.ival
+				case TagCPUArchProfile:
+					attrs.CPUArchProfile = attr.ival
+				case TagARMISAUse:
+					attrs.ARMISAUse = attr.ival
+				case TagTHUMBISAUse:
+					attrs.THUMBISAUse = attr.ival
+				case TagFPArch:
+					attrs.FPArch = attr.ival
+				case TagABIVFPArgs:
+					attrs.ABIVFPArgs = attr.ival
 				}
 			}
 			if attrList.err != nil {
-				return false, 0, fmt.Errorf("could not parse .ARM.attributes\n")
+				return nil, fmt.Errorf("could not parse .ARM.attributes\n")
 			}
 		}
 	}
-	return found, ehdrFlags, nil
+	return attrs, nil
+}
+
+// Attributes holds the file attributes of an object, from its
+// processor-specific attributes section.
+type Attributes struct {
+	ARM   ARMAttributes   // on arm
+	RISCV RISCVAttributes // on riscv64
+}
+
+// ARMAttributes holds the file attributes of an arm object that the
+// linker merges, as recorded in its .ARM.attributes section. Attributes
+// the object does not set are zero.
+type ARMAttributes struct {
+	CPUArch        uint64 // Tag_CPU_arch
+	CPUArchProfile uint64 // Tag_CPU_arch_profile, such as 'A'
+	ARMISAUse      uint64 // Tag_ARM_ISA_use
+	THUMBISAUse    uint64 // Tag_THUMB_ISA_use
+	FPArch         uint64 // Tag_FP_arch
+	ABIVFPArgs     uint64 // Tag_ABI_VFP_args
+}
+
+// RISCVAttributes holds the file attributes of a riscv64 object, as
+// recorded in its .riscv.attributes section. Attributes the object does
+// not set are zero.
+type RISCVAttributes struct {
+	Arch            string    // Tag_RISCV_arch, the ISA string, such as "rv64i2p1_m2p0_c2p0"
+	StackAlign      uint64    // Tag_RISCV_stack_align, in bytes
+	UnalignedAccess bool      // Tag_RISCV_unaligned_access
+	PrivSpec        [3]uint64 // Tag_RISCV_priv_spec, _priv_spec_minor and _priv_spec_revision
+}
+
+// Read an elfAttribute from the list following the rules of the RISC-V
+// ELF psABI: attributes with odd tags have a string argument, the others
+// an integer one.
+func (a *elfAttributeList) riscvAttr() elfAttribute {
+	attr := elfAttribute{tag: a.uleb128()}
+	if attr.tag&1 != 0 {
+		attr.sval = a.string()
+	} else {
+		attr.ival = a.uleb128()
+	}
+	return attr
+}
+
+// parseRISCVAttributes returns the file attributes in the contents of a
+// .riscv.attributes section. Attributes of other vendors, and those that
+// apply to sections or symbols, are ignored.
+func parseRISCVAttributes(e binary.ByteOrder, data []byte) (*RISCVAttributes, error) {
+	malformed := fmt.Errorf("malformed .riscv.attributes")
+	if len(data) == 0 || data[0] != 'A' {
+		return nil, malformed
+	}
+	attrs := new(RISCVAttributes)
+	data = data[1:]
+	for len(data) != 0 {
+		if len(data) < 4 {
+			return nil, malformed
+		}
+		sectionlength := e.Uint32(data)
+		if sectionlength < 4 || uint64(sectionlength) > uint64(len(data)) {
+			return nil, malformed
+		}
+		sectiondata := data[4:sectionlength]
+		data = data[sectionlength:]
+
+		nulIndex := bytes.IndexByte(sectiondata, 0)
+		if nulIndex < 0 {
+			return nil, malformed
+		}
+		name := string(sectiondata[:nulIndex])
+		sectiondata = sectiondata[nulIndex+1:]
+
+		if name != "riscv" {
+			continue
+		}
+		for len(sectiondata) != 0 {
+			subsectiontag, sz := binary.Uvarint(sectiondata)
+			if sz <= 0 || sz+4 > len(sectiondata) {
+				return nil, malformed
+			}
+			subsectionsize := e.Uint32(sectiondata[sz:])
+			if uint64(subsectionsize) < uint64(sz+4) || uint64(subsectionsize) > uint64(len(sectiondata)) {
+				return nil, malformed
+			}
+			subsectiondata := sectiondata[sz+4 : subsectionsize]
+			sectiondata = sectiondata[subsectionsize:]
+
+			if subsectiontag != TagFile {
+				continue
+			}
+			attrList := elfAttributeList{data: subsectiondata}
+			for !attrList.done() {
+				attr := attrList.riscvAttr()
+				switch attr.tag {
+				case TagRISCVArch:
+					attrs.Arch = attr.sval
+				case TagRISCVStackAlign:
+					attrs.StackAlign = attr.ival
+				case TagRISCVUnalignedAccess:
+					attrs.UnalignedAccess = attr.ival != 0
+				case TagRISCVPrivSpec:
+					attrs.PrivSpec[0] = attr.ival
+				case TagRISCVPrivSpecMinor:
+					attrs.PrivSpec[1] = attr.ival
+				case TagRISCVPrivSpecRevision:
+					attrs.PrivSpec[2] = attr.ival
+				}
+			}
+			if attrList.err != nil {
+				return nil, malformed
+			}
+		}
+	}
+	return attrs, nil
+}
+
+// parseGNUProperty returns the value of the processor feature property
+// prType in the contents of a .note.gnu.property section, or 0 if it
+// has none. Notes and properties of other types are ignored. The
+// property descriptors are aligned to align bytes: 8 in ELF64 objects
+// and 4 in ELF32 ones.
+func parseGNUProperty(e binary.ByteOrder, data []byte, align int, prType uint32) (uint32, error) {
+	rnd := func(n, a int) int { return (n + a - 1) &^ (a - 1) }
+	malformed := fmt.Errorf("malformed .note.gnu.property")
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return 0, malformed
+		}
+		namesz, descsz, typ := int(e.Uint32(data)), int(e.Uint32(data[4:])), e.Uint32(data[8:])
+		data = data[12:]
+		if namesz > len(data) || rnd(namesz, 4)+descsz > len(data) {
+			return 0, malformed
+		}
+		name := string(data[:namesz])
+		desc := data[rnd(namesz, 4) : rnd(namesz, 4)+descsz]
+		if n := rnd(rnd(namesz, 4)+descsz, align); n < len(data) {
+			data = data[n:]
+		} else {
+			data = nil
+		}
+		if name != "GNU\x00" || typ != NT_GNU_PROPERTY_TYPE_0 {
+			continue
+		}
+		for len(desc) > 0 {
+			if len(desc) < 8 {
+				return 0, malformed
+			}
+			pt, sz := e.Uint32(desc), int(e.Uint32(desc[4:]))
+			desc = desc[8:]
+			if sz > len(desc) {
+				return 0, malformed
+			}
+			if pt == prType {
+				if sz != 4 {
+					return 0, malformed
+				}
+				return e.Uint32(desc), nil
+			}
+			if n := rnd(sz, align); n < len(desc) {
+				desc = desc[n:]
+			} else {
+				desc = nil
+			}
+		}
+	}
+	return 0, nil
 }
 
 // Load loads the ELF file pn from f.
@@ -241,13 +490,27 @@ func parseArmAttributes(e binary.ByteOrder, data []byte) (found bool, ehdrFlags
 // parameter initEhdrFlags contains the current header flags for the output
 // object, and the returned ehdrFlags contains what this Load function computes.
 // TODO: find a better place for this logic.
-func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader, pkg string, length int64, pn string, initEhdrFlags uint32) (textp []loader.Sym, ehdrFlags uint32, err error) {
+//
+// On arm64 and x86, Load returns in features the processor features,
+// such as BTI or IBT, that the object declares in its
+// .note.gnu.property section.
+// An object without the note supports none of them.
+//
+// On arm and riscv64, Load returns in attrs the attributes in the
+// object's .ARM.attributes or .riscv.attributes section, or nil if it has
+// none.
+//
+// Sections that are both writable and executable are loaded as text or
+// data if the symbols defined in them allow it. Otherwise they are
+// loaded as text and returned in wx, and it is up to the caller to
+// reject them or make the text segment writable.
+func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader, pkg string, length int64, pn string, initEhdrFlags uint32) (textp []loader.Sym, ehdrFlags uint32, wx []loader.Sym, features uint32, attrs *Attributes, err error) {
 	newSym := func(name string, version int) loader.Sym {
 		return l.CreateStaticSym(name)
 	}
 	lookup := l.LookupOrCreateCgoExport
-	errorf := func(str string, args ...interface{}) ([]loader.Sym, uint32, error) {
-		return nil, 0, fmt.Errorf("loadelf: %s: %v", pn, fmt.Sprintf(str, args...))
+	errorf := func(str string, args ...interface{}) ([]loader.Sym, uint32, []loader.Sym, uint32, *Attributes, error) {
+		return nil, 0, nil, 0, nil, fmt.Errorf("loadelf: %s: %v", pn, fmt.Sprintf(str, args...))
 	}
 
 	ehdrFlags = initEhdrFlags
@@ -440,6 +703,62 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		}
 	}
 
+	// read the processor features the object supports.
+	var prType uint32
+	switch arch.Family {
+	case sys.ARM64:
+		prType = GNU_PROPERTY_AARCH64_FEATURE_1_AND
+	case sys.AMD64, sys.I386:
+		prType = GNU_PROPERTY_X86_FEATURE_1_AND
+	}
+	if sect := section(elfobj, ".note.gnu.property"); sect != nil && prType != 0 && sect.type_ == elf.SHT_NOTE {
+		if err := elfmap(elfobj, sect); err != nil {
+			return errorf("malformed elf file: %v", err)
+		}
+		align := 4
+		if is64 != 0 {
+			align = 8
+		}
+		f, err := parseGNUProperty(e, sect.base[:sect.size], align, prType)
+		if err != nil {
+			return errorf("%v", err)
+		}
+		features = f
+	}
+
+	// read the processor-specific attributes, for the caller to merge.
+	if sect := section(elfobj, ".ARM.attributes"); sect != nil && arch.Family == sys.ARM && sect.type_ == SHT_ARM_ATTRIBUTES {
+		if err := elfmap(elfobj, sect); err != nil {
+			return errorf("%s: malformed elf file: %v", pn, err)
+		}
+		// We assume the soft-float ABI unless we see a tag indicating otherwise.
+		if initEhdrFlags == 0x5000002 {
+			ehdrFlags = 0x5000202
+		} else {
+			ehdrFlags = initEhdrFlags
+		}
+		armAttrs, err := parseArmAttributes(e, sect.base[:sect.size])
+		if err != nil {
+			// TODO(dfc) should this return an error?
+			log.Printf("%s: %v", pn, err)
+		} else {
+			attrs = &Attributes{ARM: *armAttrs}
+			if armAttrs.ABIVFPArgs == 1 {
+				ehdrFlags = 0x5000402 // has entry point, Version5 EABI, hard-float ABI
+			}
+		}
+	}
+	if sect := section(elfobj, ".riscv.attributes"); sect != nil && arch.Family == sys.RISCV64 && sect.type_ == SHT_RISCV_ATTRIBUTES {
+		if err := elfmap(elfobj, sect); err != nil {
+			return errorf("malformed elf file: %v", err)
+		}
+		riscvAttrs, err := parseRISCVAttributes(e, sect.base[:sect.size])
+		if err != nil {
+			return errorf("%v", err)
+		}
+		attrs = &Attributes{RISCV: *riscvAttrs}
+	}
+
 	// load string table for symbols into memory.
 	elfobj.symtab = section(elfobj, ".symtab")
 
@@ -471,33 +790,38 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 	// the memory anyway for the symbol images, so we might
 	// as well use one large chunk.
 
+	// Discard the sections of COMDAT groups loaded from other objects.
+	groups, err := readGroups(elfobj)
+	if err != nil {
+		return errorf("%s: malformed elf file: %v", pn, err)
+	}
+	var newGroups []elfGroup
+	for _, g := range groups {
+		kept, ok := comdatGroups[g.signature]
+		if !ok {
+			newGroups = append(newGroups, g)
+			continue
+		}
+		for _, i := range g.sects {
+			elfobj.sect[i].discarded = true
+			elfobj.sect[i].sym = kept[elfobj.sect[i].name]
+		}
+	}
+
 	// create symbols for elfmapped sections
 	sectsymNames := make(map[string]bool)
 	counter := 0
 	for i := 0; uint(i) < elfobj.nsect; i++ {
 		sect = &elfobj.sect[i]
-		if sect.type_ == SHT_ARM_ATTRIBUTES && sect.name == ".ARM.attributes" {
-			if err := elfmap(elfobj, sect); err != nil {
-				return errorf("%s: malformed elf file: %v", pn, err)
-			}
-			// We assume the soft-float ABI unless we see a tag indicating otherwise.
-			if initEhdrFlags == 0x5000002 {
-				ehdrFlags = 0x5000202
-			} else {
-				ehdrFlags = initEhdrFlags
-			}
-			found, newEhdrFlags, err := parseArmAttributes(e, sect.base[:sect.size])
-			if err != nil {
-				// TODO(dfc) should this return an error?
-				log.Printf("%s: %v", pn, err)
-			}
-			if found {
-				ehdrFlags = newEhdrFlags
-			}
+		if sect.discarded {
+			continue
 		}
-		if (sect.type_ != elf.SHT_PROGBITS && sect.type_ != elf.SHT_NOBITS) || sect.flags&elf.SHF_ALLOC == 0 {
+		if (sect.type_ != elf.SHT_PROGBITS && sect.type_ != elf.SHT_NOBITS && !isInitArray(sect)) || sect.flags&elf.SHF_ALLOC == 0 {
 			continue
 		}
+		if sect.flags&elf.SHF_COMPRESSED != 0 {
+			return errorf("%s: allocated ELF section %s is compressed", pn, sect.name)
+		}
 		if sect.type_ != elf.SHT_NOBITS {
 			if err := elfmap(elfobj, sect); err != nil {
 				return errorf("%s: malformed elf file: %v", pn, err)
@@ -512,6 +836,7 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		sectsymNames[name] = true
 
 		sb := l.MakeSymbolUpdater(lookup(name, localSymVersion))
+		hostSects[sb.Sym()] = hostSect{pkg, pn, sect.name}
 
 		switch sect.flags & (elf.SHF_ALLOC | elf.SHF_WRITE | elf.SHF_EXECINSTR) {
 		default:
@@ -521,20 +846,42 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 			sb.SetType(sym.SRODATA)
 
 		case elf.SHF_ALLOC + elf.SHF_WRITE:
-			if sect.type_ == elf.SHT_NOBITS {
+			switch {
+			case sect.flags&elf.SHF_TLS != 0 && sect.type_ == elf.SHT_NOBITS:
+				sb.SetType(sym.STLSBSS)
+			case sect.flags&elf.SHF_TLS != 0:
+				sb.SetType(sym.STLSDATA)
+			case sect.type_ == elf.SHT_NOBITS:
 				sb.SetType(sym.SNOPTRBSS)
-			} else {
+			default:
 				sb.SetType(sym.SNOPTRDATA)
 			}
 
 		case elf.SHF_ALLOC + elf.SHF_EXECINSTR:
 			sb.SetType(sym.STEXT)
+
+		case elf.SHF_ALLOC + elf.SHF_WRITE + elf.SHF_EXECINSTR:
+			// Go binaries never map memory both writable and
+			// executable, so load the section as either text or
+			// data depending on what is defined in it.
+			if t, ok := wxSectType(elfobj, i); ok {
+				sb.SetType(t)
+			} else {
+				sb.SetType(sym.STEXT)
+				wx = append(wx, sb.Sym())
+			}
 		}
 
 		if sect.name == ".got" || sect.name == ".toc" {
 			sb.SetType(sym.SELFGOT)
 		}
-		if sect.type_ == elf.SHT_PROGBITS {
+		if isInitArray(sect) {
+			if sect.size%uint64(arch.PtrSize) != 0 {
+				return errorf("%s: malformed elf file: size %d of %s is not a multiple of %d", pn, sect.size, sect.name, arch.PtrSize)
+			}
+			sb.SetType(sym.SINITARR)
+		}
+		if sect.type_ != elf.SHT_NOBITS {
 			sb.SetData(sect.base[:sect.size])
 		}
 
@@ -545,26 +892,49 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		sect.sym = sb.Sym()
 	}
 
+	for _, g := range newGroups {
+		kept := make(map[string]loader.Sym)
+		for _, i := range g.sects {
+			if sect := &elfobj.sect[i]; sect.sym != 0 {
+				kept[sect.name] = sect.sym
+			}
+		}
+		comdatGroups[g.signature] = kept
+	}
+
 	// enter sub-symbols into symbol table.
 	// symbol 0 is the null symbol.
 	symbols := make([]loader.Sym, elfobj.nsymtab)
 
+	// The mapping symbols of the text sections.
+	type mappingSym struct {
+		sect *ElfSect
+		off  int64
+		kind byte
+	}
+	var mappingSyms []mappingSym
+
 	for i := 1; i < elfobj.nsymtab; i++ {
 		var elfsym ElfSym
 		if err := readelfsym(newSym, lookup, l, arch, elfobj, i, &elfsym, 1, localSymVersion); err != nil {
 			return errorf("%s: malformed elf file: %v", pn, err)
 		}
 		symbols[i] = elfsym.sym
-		if elfsym.type_ != elf.STT_FUNC && elfsym.type_ != elf.STT_OBJECT && elfsym.type_ != elf.STT_NOTYPE && elfsym.type_ != elf.STT_COMMON {
+		if elfsym.bind == elf.STB_LOCAL && uint(elfsym.shndx) < elfobj.nsect {
+			if kind := mappingKind(arch, elfsym.name); kind != 0 {
+				sect = &elfobj.sect[elfsym.shndx]
+				if sect.sym != 0 && !sect.discarded && l.SymType(sect.sym) == sym.STEXT {
+					mappingSyms = append(mappingSyms, mappingSym{sect, int64(elfsym.value), kind})
+				}
+				continue
+			}
+		}
+		if elfsym.type_ != elf.STT_FUNC && elfsym.type_ != elf.STT_OBJECT && elfsym.type_ != elf.STT_NOTYPE && elfsym.type_ != elf.STT_COMMON && elfsym.type_ != elf.STT_TLS && elfsym.type_ != STT_GNU_IFUNC {
 			continue
 		}
 		if elfsym.shndx == elf.SHN_COMMON || elfsym.type_ == elf.STT_COMMON {
-			sb := l.MakeSymbolUpdater(elfsym.sym)
-			if uint64(sb.Size()) < elfsym.size {
-				sb.SetSize(int64(elfsym.size))
-			}
-			if sb.Type() == 0 || sb.Type() == sym.SXREF {
-				sb.SetType(sym.SNOPTRBSS)
+			if err := loadCommon(l, &elfsym); err != nil {
+				return errorf("%v", err)
 			}
 			continue
 		}
@@ -578,6 +948,10 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 			continue
 		}
 		sect = &elfobj.sect[elfsym.shndx]
+		if sect.discarded {
+			// Defined in the group loaded.
+			continue
+		}
 		if sect.sym == 0 {
 			if strings.HasPrefix(elfsym.name, ".Linfo_string") { // clang does this
 				continue
@@ -603,12 +977,24 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		}
 
 		s := elfsym.sym
-		if l.OuterSym(s) != 0 {
-			if l.AttrDuplicateOK(s) {
+		// A symbol defined by a Go package wins over a weak
+		// definition, and clashes with any other, whether or not
+		// it is DUPOK among Go packages.
+		goDef := !l.IsExternal(s) && len(l.Data(s)) != 0
+		if outer := l.OuterSym(s); outer != 0 || goDef {
+			if goDef && elfsym.bind == elf.STB_WEAK || !goDef && l.AttrDuplicateOK(s) {
 				continue
 			}
-			return errorf("duplicate symbol reference: %s in both %s and %s",
-				l.SymName(s), l.SymName(l.OuterSym(s)), l.SymName(sect.sym))
+			e := &DupSymError{
+				Sym:  s,
+				Name: l.SymName(s),
+				Def:  SymDef{Pkg: pkg, File: pn, Sect: sect.name, Size: int64(elfsym.size), Weak: elfsym.bind == elf.STB_WEAK},
+			}
+			if outer != 0 {
+				hs := hostSects[outer]
+				e.Prev = &SymDef{Pkg: hs.pkg, File: hs.file, Sect: hs.name, Size: l.SymSize(s), Weak: weakDefs[s]}
+			}
+			return nil, 0, nil, 0, nil, e
 		}
 
 		sectsb := l.MakeSymbolUpdater(sect.sym)
@@ -621,6 +1007,14 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		}
 		sb.SetValue(int64(elfsym.value))
 		sb.SetSize(int64(elfsym.size))
+		if elfsym.bind == elf.STB_WEAK {
+			weakDefs[s] = true
+		}
+		if elfsym.type_ == STT_GNU_IFUNC {
+			// The symbol is the resolver, which returns the
+			// address of the function.
+			l.SetAttrIFunc(s, true)
+		}
 		if sectsb.Type() == sym.STEXT {
 			if l.AttrExternal(s) && !l.AttrDuplicateOK(s) {
 				return errorf("%s: duplicate symbol definition", sb.Name())
@@ -642,7 +1036,7 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 	// This keeps textp in increasing address order.
 	for i := uint(0); i < elfobj.nsect; i++ {
 		s := elfobj.sect[i].sym
-		if s == 0 {
+		if s == 0 || elfobj.sect[i].discarded {
 			continue
 		}
 		sb := l.MakeSymbolUpdater(s)
@@ -673,7 +1067,7 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		if rsect.type_ != elf.SHT_RELA && rsect.type_ != elf.SHT_REL {
 			continue
 		}
-		if rsect.info >= uint32(elfobj.nsect) || elfobj.sect[rsect.info].base == nil {
+		if rsect.info >= uint32(elfobj.nsect) || elfobj.sect[rsect.info].base == nil || elfobj.sect[rsect.info].discarded {
 			continue
 		}
 		sect = &elfobj.sect[rsect.info]
@@ -755,7 +1149,7 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 			rType := objabi.ElfRelocOffset + objabi.RelocType(relocType)
 			rSize, addendSize, err := relSize(arch, pn, uint32(relocType))
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, nil, 0, nil, err
 			}
 			if rela != 0 {
 				rAdd = int64(add)
@@ -787,7 +1181,80 @@ func Load(l *loader.Loader, arch *sys.Arch, localSymVersion int, f *bio.Reader,
 		sb.SortRelocs() // just in case
 	}
 
-	return textp, ehdrFlags, nil
+	// The entries of .ctors sections run from last to first, so reverse
+	// them to run in order with those of .init_array, as GNU ld does
+	// when it puts them in .init_array.
+	for i := uint(0); i < elfobj.nsect; i++ {
+		if sect := &elfobj.sect[i]; sect.sym != 0 && sect.type_ == elf.SHT_PROGBITS && isInitArray(sect) {
+			reverseCtors(l, arch, sect.sym)
+		}
+	}
+
+	// Keep the mapping symbols as marker relocations, for the linker to
+	// write them to the output.
+	mapped := make(map[loader.Sym]bool)
+	for _, m := range mappingSyms {
+		sb := l.MakeSymbolUpdater(m.sect.sym)
+		r, _ := sb.AddRel(objabi.R_MAPSYM)
+		r.SetOff(int32(m.off))
+		r.SetAdd(int64(m.kind))
+		mapped[m.sect.sym] = true
+	}
+	for s := range mapped {
+		l.MakeSymbolUpdater(s).SortRelocs()
+	}
+
+	return textp, ehdrFlags, wx, features, attrs, nil
+}
+
+// isInitArray reports whether sect holds pointers to constructors:
+// an .init_array or .preinit_array section, or a .ctors section.
+// Their names may have a priority suffix, as in .init_array.00100.
+func isInitArray(sect *ElfSect) bool {
+	switch sect.type_ {
+	case elf.SHT_INIT_ARRAY, elf.SHT_PREINIT_ARRAY:
+		return true
+	case elf.SHT_PROGBITS:
+		return sect.name == ".ctors" || strings.HasPrefix(sect.name, ".ctors.")
+	}
+	return false
+}
+
+// reverseCtors reverses the order of the pointers in the .ctors
+// section symbol s, with their relocations.
+func reverseCtors(l *loader.Loader, arch *sys.Arch, s loader.Sym) {
+	sb := l.MakeSymbolUpdater(s)
+	ptr := int32(arch.PtrSize)
+	n := int32(sb.Size()) / ptr
+	data := make([]byte, len(sb.Data()))
+	for i := int32(0); i < n; i++ {
+		copy(data[(n-1-i)*ptr:(n-i)*ptr], sb.Data()[i*ptr:])
+	}
+	sb.SetData(data)
+	relocs := sb.Relocs()
+	for i := 0; i < relocs.Count(); i++ {
+		r := relocs.At(i)
+		off := r.Off()
+		r.SetOff((n-1-off/ptr)*ptr + off%ptr)
+	}
+	sb.SortRelocs()
+}
+
+// mappingKind returns the kind of the arm or arm64 mapping symbol name,
+// as in "$a" or "$d.realdata": 'a' for Arm code, 't' for Thumb code,
+// 'x' for A64 code and 'd' for data. It returns 0 if name is not a
+// mapping symbol.
+func mappingKind(arch *sys.Arch, name string) byte {
+	if len(name) < 2 || name[0] != '$' || len(name) > 2 && name[2] != '.' {
+		return 0
+	}
+	switch {
+	case name[1] == 'd' && (arch.Family == sys.ARM || arch.Family == sys.ARM64),
+		(name[1] == 'a' || name[1] == 't') && arch.Family == sys.ARM,
+		name[1] == 'x' && arch.Family == sys.ARM64:
+		return name[1]
+	}
+	return 0
 }
 
 func section(elfobj *ElfObj, name string) *ElfSect {
@@ -815,9 +1282,147 @@ func elfmap(elfobj *ElfObj, sect *ElfSect) (err error) {
 		return fmt.Errorf("short read: %v", err)
 	}
 
+	if sect.flags&elf.SHF_COMPRESSED != 0 {
+		// Compressed debug sections, from gcc -gz or the
+		// defaults of some distributions.
+		data, align, err := Decompress(elfobj.e, elfobj.is64 != 0, sect.base)
+		if err != nil {
+			sect.base = nil
+			return fmt.Errorf("compressed section %s: %v", sect.name, err)
+		}
+		sect.base, sect.readOnlyMem = data, false
+		sect.size, sect.align = uint64(len(data)), align
+	}
+
 	return nil
 }
 
+// wxSectType returns the symbol kind for the writable and executable
+// section with index secti, based on the symbols defined in it: text if
+// it only defines functions, data if it only defines data objects.
+// ok is false if it defines both or neither.
+func wxSectType(elfobj *ElfObj, secti int) (k sym.SymKind, ok bool) {
+	var funcs, objs int
+	for i := 1; i < elfobj.nsymtab; i++ {
+		var shndx elf.SectionIndex
+		var typ elf.SymType
+		if elfobj.is64 != 0 {
+			b := elfobj.symtab.base[i*elf.Sym64Size:]
+			typ = elf.ST_TYPE(b[4])
+			shndx = elf.SectionIndex(elfobj.e.Uint16(b[6:]))
+		} else {
+			b := elfobj.symtab.base[i*elf.Sym32Size:]
+			typ = elf.ST_TYPE(b[12])
+			shndx = elf.SectionIndex(elfobj.e.Uint16(b[14:]))
+		}
+		if int(shndx) != secti {
+			continue
+		}
+		switch typ {
+		case elf.STT_FUNC:
+			funcs++
+		case elf.STT_OBJECT, elf.STT_TLS:
+			objs++
+		}
+	}
+	switch {
+	case funcs > 0 && objs == 0:
+		return sym.STEXT, true
+	case objs > 0 && funcs == 0:
+		if elfobj.sect[secti].type_ == elf.SHT_NOBITS {
+			return sym.SNOPTRBSS, true
+		}
+		return sym.SNOPTRDATA, true
+	}
+	return 0, false
+}
+
+// loadCommon merges the common (tentative) symbol elfsym into the
+// symbol table. Tentative definitions of the same symbol from several
+// objects become a single zeroed variable, with the largest size and
+// alignment among them, allocated in a BSS section. Any other definition,
+// from a host object, Go code or a shared library imported with
+// cgo_import_dynamic, takes precedence over the tentative ones, whichever
+// object is loaded first.
+func loadCommon(l *loader.Loader, elfsym *ElfSym) error {
+	s := elfsym.sym
+	typ := sym.SNOPTRBSS
+	if elfsym.type_ == elf.STT_TLS {
+		typ = sym.STLSBSS
+	}
+	switch st := l.SymType(s); {
+	case st == 0 || st == sym.SXREF:
+		// First tentative definition.
+	case (st == sym.SNOPTRBSS || st == sym.STLSBSS) && l.IsExternal(s) && l.OuterSym(s) == 0:
+		// Tentatively defined by an earlier object.
+		if st != typ {
+			return fmt.Errorf("%s: common symbol is thread-local in only some objects", elfsym.name)
+		}
+	default:
+		return nil
+	}
+	sb := l.MakeSymbolUpdater(s)
+	sb.SetType(typ)
+	if uint64(sb.Size()) < elfsym.size {
+		sb.SetSize(int64(elfsym.size))
+	}
+	// The value of a common symbol is its required alignment.
+	if align := int32(elfsym.value); sb.Align() < align {
+		sb.SetAlign(align)
+	}
+	return nil
+}
+
+// An elfGroup is a COMDAT section group of an object.
+type elfGroup struct {
+	signature string
+	sects     []uint32 // indexes of the sections in the group
+}
+
+// readGroups returns the COMDAT groups of elfobj, whose symbol table
+// must be loaded.
+func readGroups(elfobj *ElfObj) ([]elfGroup, error) {
+	var groups []elfGroup
+	for i := uint(0); i < elfobj.nsect; i++ {
+		sect := &elfobj.sect[i]
+		if sect.type_ != elf.SHT_GROUP {
+			continue
+		}
+		if err := elfmap(elfobj, sect); err != nil {
+			return nil, err
+		}
+		data := sect.base[:sect.size]
+		if len(data) < 4 || len(data)%4 != 0 {
+			return nil, fmt.Errorf("section group %s has size %d", sect.name, len(data))
+		}
+		if elfobj.e.Uint32(data)&GRP_COMDAT == 0 {
+			continue
+		}
+		if int(sect.info) >= elfobj.nsymtab || &elfobj.sect[sect.link] != elfobj.symtab {
+			return nil, fmt.Errorf("section group %s has invalid signature symbol %d", sect.name, sect.info)
+		}
+		// The name is the first field of both Sym32 and Sym64.
+		symsize := elf.Sym32Size
+		if elfobj.is64 != 0 {
+			symsize = elf.Sym64Size
+		}
+		name := elfobj.e.Uint32(elfobj.symtab.base[int(sect.info)*symsize:])
+		if int(name) >= len(elfobj.symstr.base) {
+			return nil, fmt.Errorf("section group %s has invalid signature symbol %d", sect.name, sect.info)
+		}
+		g := elfGroup{signature: cstring(elfobj.symstr.base[name:])}
+		for data = data[4:]; len(data) > 0; data = data[4:] {
+			j := elfobj.e.Uint32(data)
+			if uint(j) >= elfobj.nsect {
+				return nil, fmt.Errorf("section group %s has invalid member %d", sect.name, j)
+			}
+			g.sects = append(g.sects, j)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
 func readelfsym(newSym, lookup func(string, int) loader.Sym, l *loader.Loader, arch *sys.Arch, elfobj *ElfObj, i int, elfsym *ElfSym, needSym int, localSymVersion int) (err error) {
 	if i >= elfobj.nsymtab || i < 0 {
 		err = fmt.Errorf("invalid elf symbol index")
@@ -865,9 +1470,9 @@ func readelfsym(newSym, lookup func(string, int) loader.Sym, l *loader.Loader, a
 	case elf.STT_SECTION:
 		s = elfobj.sect[elfsym.shndx].sym
 
-	case elf.STT_OBJECT, elf.STT_FUNC, elf.STT_NOTYPE, elf.STT_COMMON:
+	case elf.STT_OBJECT, elf.STT_FUNC, elf.STT_NOTYPE, elf.STT_COMMON, elf.STT_TLS, STT_GNU_IFUNC:
 		switch elfsym.bind {
-		case elf.STB_GLOBAL:
+		case elf.STB_GLOBAL, STB_GNU_UNIQUE:
 			if needSym != 0 {
 				s = lookup(elfsym.name, 0)
 
@@ -885,14 +1490,26 @@ func readelfsym(newSym, lookup func(string, int) loader.Sym, l *loader.Loader, a
 					l.SetAttrDuplicateOK(s, true)
 					l.SetAttrVisibilityHidden(s, true)
 				}
+				if s != 0 && elfsym.shndx == elf.SHN_UNDEF {
+					l.SetAttrWeakUndef(s, false)
+				}
 			}
 
 		case elf.STB_LOCAL:
+			if mappingKind(arch, elfsym.name) != 0 {
+				// binutils for arm and arm64 generate these mapping
+				// symbols, which Load turns into R_MAPSYM relocations
+				break
+			}
 			if (arch.Family == sys.ARM || arch.Family == sys.ARM64) && (strings.HasPrefix(elfsym.name, "$a") || strings.HasPrefix(elfsym.name, "$d") || strings.HasPrefix(elfsym.name, "$x")) {
 				// binutils for arm and arm64 generate these mapping
 				// symbols, ignore these
 				break
 			}
+			if arch.Family == sys.RISCV64 && (strings.HasPrefix(elfsym.name, "$d") || strings.HasPrefix(elfsym.name, "$x")) {
+				// as do newer versions of binutils for riscv64
+				break
+			}
 
 			if elfsym.name == ".TOC." {
 				// We need to be able to look this up,
@@ -926,6 +1543,11 @@ func readelfsym(newSym, lookup func(string, int) loader.Sym, l *loader.Loader, a
 				if l.OuterSym(s) != 0 {
 					l.SetAttrDuplicateOK(s, true)
 				}
+
+				// A weak undefined symbol may be left undefined.
+				if elfsym.shndx == elf.SHN_UNDEF {
+					l.SetAttrWeakUndef(s, true)
+				}
 			}
 
 		default:
@@ -1028,11 +1650,22 @@ func relSize(arch *sys.Arch, pn string, elftype uint32) (uint8, uint8, error) {
 		ARM64 | uint32(elf.R_AARCH64_LDST128_ABS_LO12_NC)<<16,
 		ARM64 | uint32(elf.R_AARCH64_PREL32)<<16,
 		ARM64 | uint32(elf.R_AARCH64_JUMP26)<<16,
+		ARM64 | uint32(elf.R_AARCH64_TLSDESC_ADR_PAGE21)<<16,
+		ARM64 | uint32(elf.R_AARCH64_TLSDESC_LD64_LO12_NC)<<16,
+		ARM64 | uint32(elf.R_AARCH64_TLSDESC_ADD_LO12_NC)<<16,
+		ARM64 | uint32(elf.R_AARCH64_TLSDESC_CALL)<<16,
 		AMD64 | uint32(elf.R_X86_64_PC32)<<16,
+		AMD64 | uint32(elf.R_X86_64_32)<<16,
+		AMD64 | uint32(elf.R_X86_64_32S)<<16,
 		AMD64 | uint32(elf.R_X86_64_PLT32)<<16,
 		AMD64 | uint32(elf.R_X86_64_GOTPCREL)<<16,
 		AMD64 | uint32(elf.R_X86_64_GOTPCRELX)<<16,
 		AMD64 | uint32(elf.R_X86_64_REX_GOTPCRELX)<<16,
+		AMD64 | uint32(elf.R_X86_64_TPOFF32)<<16,
+		AMD64 | uint32(elf.R_X86_64_GOTTPOFF)<<16,
+		AMD64 | uint32(elf.R_X86_64_TLSGD)<<16,
+		AMD64 | uint32(elf.R_X86_64_TLSLD)<<16,
+		AMD64 | uint32(elf.R_X86_64_DTPOFF32)<<16,
 		I386 | uint32(elf.R_386_32)<<16,
 		I386 | uint32(elf.R_386_PC32)<<16,
 		I386 | uint32(elf.R_386_GOT32)<<16,
@@ -1067,12 +1700,31 @@ func relSize(arch *sys.Arch, pn string, elftype uint32) (uint8, uint8, error) {
 		S390X | uint32(elf.R_390_PLT64)<<16:
 		return 8, 8, nil
 
+	case RISCV64 | uint32(elf.R_RISCV_ALIGN)<<16:
+		// The relocation marks padding, which is not changed.
+		return 0, 0, nil
+
+	case RISCV64 | uint32(elf.R_RISCV_SET6)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SUB6)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SET8)<<16,
+		RISCV64 | uint32(elf.R_RISCV_ADD8)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SUB8)<<16:
+		return 1, 1, nil
+
 	case RISCV64 | uint32(elf.R_RISCV_RVC_BRANCH)<<16,
-		RISCV64 | uint32(elf.R_RISCV_RVC_JUMP)<<16:
+		RISCV64 | uint32(elf.R_RISCV_RVC_JUMP)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SET16)<<16,
+		RISCV64 | uint32(elf.R_RISCV_ADD16)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SUB16)<<16:
 		return 2, 2, nil
 
 	case RISCV64 | uint32(elf.R_RISCV_32)<<16,
+		RISCV64 | uint32(elf.R_RISCV_32_PCREL)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SET32)<<16,
+		RISCV64 | uint32(elf.R_RISCV_ADD32)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SUB32)<<16,
 		RISCV64 | uint32(elf.R_RISCV_BRANCH)<<16,
+		RISCV64 | uint32(elf.R_RISCV_JAL)<<16,
 		RISCV64 | uint32(elf.R_RISCV_HI20)<<16,
 		RISCV64 | uint32(elf.R_RISCV_LO12_I)<<16,
 		RISCV64 | uint32(elf.R_RISCV_LO12_S)<<16,
@@ -1080,10 +1732,18 @@ func relSize(arch *sys.Arch, pn string, elftype uint32) (uint8, uint8, error) {
 		RISCV64 | uint32(elf.R_RISCV_PCREL_HI20)<<16,
 		RISCV64 | uint32(elf.R_RISCV_PCREL_LO12_I)<<16,
 		RISCV64 | uint32(elf.R_RISCV_PCREL_LO12_S)<<16,
+		RISCV64 | uint32(elf.R_RISCV_TLS_GOT_HI20)<<16,
+		RISCV64 | uint32(elf.R_RISCV_TLS_GD_HI20)<<16,
+		RISCV64 | uint32(elf.R_RISCV_TPREL_HI20)<<16,
+		RISCV64 | uint32(elf.R_RISCV_TPREL_LO12_I)<<16,
+		RISCV64 | uint32(elf.R_RISCV_TPREL_LO12_S)<<16,
+		RISCV64 | uint32(elf.R_RISCV_TPREL_ADD)<<16,
 		RISCV64 | uint32(elf.R_RISCV_RELAX)<<16:
 		return 4, 4, nil
 
 	case RISCV64 | uint32(elf.R_RISCV_64)<<16,
+		RISCV64 | uint32(elf.R_RISCV_ADD64)<<16,
+		RISCV64 | uint32(elf.R_RISCV_SUB64)<<16,
 		RISCV64 | uint32(elf.R_RISCV_CALL)<<16,
 		RISCV64 | uint32(elf.R_RISCV_CALL_PLT)<<16:
 		return 8, 8, nil
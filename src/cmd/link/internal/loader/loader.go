@@ -19,6 +19,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 )
 
 var _ = fmt.Print
@@ -228,6 +229,10 @@ type Loader struct {
 	attrSpecial          map[Sym]struct{} // "special" frame symbols
 	attrCgoExportDynamic map[Sym]struct{} // "cgo_export_dynamic" symbols
 	attrCgoExportStatic  map[Sym]struct{} // "cgo_export_static" symbols
+	attrWeakUndef        map[Sym]bool     // host object undefined refs, true if all weak
+	attrUndefZero        map[Sym]struct{} // undefined symbols given address 0
+	attrIFunc            map[Sym]struct{} // host object STT_GNU_IFUNC symbols
+	attrDynAddr          map[Sym]struct{} // linker-made data holding addresses of dynamic imports
 	generatedSyms        map[Sym]struct{} // symbols that generate their content
 
 	// Outer and Sub relations for symbols.
@@ -336,6 +341,10 @@ func NewLoader(flags uint32, elfsetstring elfsetstringFunc, reporter *ErrorRepor
 		attrSpecial:          make(map[Sym]struct{}),
 		attrCgoExportDynamic: make(map[Sym]struct{}),
 		attrCgoExportStatic:  make(map[Sym]struct{}),
+		attrWeakUndef:        make(map[Sym]bool),
+		attrUndefZero:        make(map[Sym]struct{}),
+		attrIFunc:            make(map[Sym]struct{}),
+		attrDynAddr:          make(map[Sym]struct{}),
 		generatedSyms:        make(map[Sym]struct{}),
 		deferReturnTramp:     make(map[Sym]bool),
 		extStaticSyms:        make(map[nameVer]Sym),
@@ -803,6 +812,17 @@ func (l *Loader) IsFromAssembly(i Sym) bool {
 	return r.FromAssembly()
 }
 
+// IsContentAddressable reports whether i is a content-addressable
+// symbol. Those are deduplicated by content, so the name of i may be
+// that of any symbol with the same content.
+func (l *Loader) IsContentAddressable(i Sym) bool {
+	if l.IsExternal(i) {
+		return false
+	}
+	r, li := l.toLocal(i)
+	return li >= uint32(r.ndef) && li < uint32(r.ndef+r.nhashed64def+r.nhasheddef)
+}
+
 // Returns the type of the i-th symbol.
 func (l *Loader) SymType(i Sym) sym.SymKind {
 	if l.IsExternal(i) {
@@ -1078,6 +1098,86 @@ func (l *Loader) SetAttrCgoExportStatic(i Sym, v bool) {
 	}
 }
 
+// AttrWeakUndef returns true for a symbol that host objects refer to
+// as a weak undefined symbol, and never as a global undefined symbol,
+// so that it may be left undefined, with address 0.
+func (l *Loader) AttrWeakUndef(i Sym) bool {
+	return l.attrWeakUndef[i]
+}
+
+// SetAttrWeakUndef records that a host object refers to i as an
+// undefined symbol, weak if v. Once a host object has referred to i
+// as a global undefined symbol, i is no longer weakly undefined.
+func (l *Loader) SetAttrWeakUndef(i Sym, v bool) {
+	if weak, ok := l.attrWeakUndef[i]; ok && !weak {
+		return
+	}
+	l.attrWeakUndef[i] = v
+}
+
+// AttrUndefZero returns true for an undefined symbol that the linker
+// gave address 0, so that references to it need no dynamic relocation.
+func (l *Loader) AttrUndefZero(i Sym) bool {
+	_, ok := l.attrUndefZero[i]
+	return ok
+}
+
+// SetAttrUndefZero sets the "undefined, at address 0" property for a
+// symbol (see AttrUndefZero).
+func (l *Loader) SetAttrUndefZero(i Sym, v bool) {
+	if v {
+		l.attrUndefZero[i] = struct{}{}
+	} else {
+		delete(l.attrUndefZero, i)
+	}
+}
+
+// AttrIFunc returns true for an indirect function of a host object
+// (STT_GNU_IFUNC), whose value is the address of a resolver that
+// returns the address of the function.
+func (l *Loader) AttrIFunc(i Sym) bool {
+	_, ok := l.attrIFunc[i]
+	return ok
+}
+
+// SetAttrIFunc sets the "indirect function" attribute for a symbol
+// (see AttrIFunc).
+func (l *Loader) SetAttrIFunc(i Sym, v bool) {
+	if v {
+		l.attrIFunc[i] = struct{}{}
+	} else {
+		delete(l.attrIFunc, i)
+	}
+}
+
+// AttrDynAddr returns true for a data symbol made by the linker whose
+// address relocations to dynamic imports are filled in by the dynamic
+// linker, as absolute addresses, even when linking internally.
+func (l *Loader) AttrDynAddr(i Sym) bool {
+	_, ok := l.attrDynAddr[i]
+	return ok
+}
+
+// SetAttrDynAddr sets the "addresses of dynamic imports" attribute
+// for a symbol (see AttrDynAddr).
+func (l *Loader) SetAttrDynAddr(i Sym, v bool) {
+	if v {
+		l.attrDynAddr[i] = struct{}{}
+	} else {
+		delete(l.attrDynAddr, i)
+	}
+}
+
+// IFuncSyms returns the indirect functions of host objects.
+func (l *Loader) IFuncSyms() []Sym {
+	sl := make([]Sym, 0, len(l.attrIFunc))
+	for s := range l.attrIFunc {
+		sl = append(sl, s)
+	}
+	sort.Slice(sl, func(i, j int) bool { return sl[i] < sl[j] })
+	return sl
+}
+
 // IsGeneratedSym returns true if a symbol's been previously marked as a
 // generator symbol through the SetIsGeneratedSym. The functions for generator
 // symbols are kept in the Link context.
@@ -1201,6 +1301,15 @@ func (l *Loader) IsDict(i Sym) bool {
 	return r.Sym(li).IsDict()
 }
 
+// Returns whether this symbol holds the contents of a //go:embed file.
+func (l *Loader) IsEmbed(i Sym) bool {
+	if l.IsExternal(i) {
+		return false
+	}
+	r, li := l.toLocal(i)
+	return r.Sym(li).IsEmbed()
+}
+
 // Return whether this is a trampoline of a deferreturn call.
 func (l *Loader) IsDeferReturnTramp(i Sym) bool {
 	return l.deferReturnTramp[i]
@@ -1526,6 +1635,30 @@ func (l *Loader) DynidSyms() []Sym {
 	return sl
 }
 
+// WeakUndefSyms returns the symbols that host objects refer to only
+// as weak undefined symbols.
+func (l *Loader) WeakUndefSyms() []Sym {
+	var sl []Sym
+	for s, weak := range l.attrWeakUndef {
+		if weak {
+			sl = append(sl, s)
+		}
+	}
+	sort.Slice(sl, func(i, j int) bool { return sl[i] < sl[j] })
+	return sl
+}
+
+// HostUndefSyms returns the symbols that host objects refer to as
+// undefined symbols, weak or not.
+func (l *Loader) HostUndefSyms() []Sym {
+	sl := make([]Sym, 0, len(l.attrWeakUndef))
+	for s := range l.attrWeakUndef {
+		sl = append(sl, s)
+	}
+	sort.Slice(sl, func(i, j int) bool { return sl[i] < sl[j] })
+	return sl
+}
+
 // SymGoType returns the 'Gotype' property for a given symbol (set by
 // the Go compiler for variable symbols). This version relies on
 // reading aux symbols for the target sym -- it could be that a faster
@@ -2579,13 +2712,26 @@ func (l *Loader) AssignTextSymbolOrder(libs []*sym.Library, intlibs []bool, exts
 type ErrorReporter struct {
 	ldr              *Loader
 	AfterErrorAction func()
+
+	deferred *deferredErrors // errors collected since Defer, if non-nil
+}
+
+type deferredErrors struct {
+	mu   sync.Mutex
+	errs []deferredError
+}
+
+type deferredError struct {
+	s   Sym
+	msg string
 }
 
 // Errorf method logs an error message.
 //
 // After each error, the error actions function will be invoked; this
 // will either terminate the link immediately (if -h option given)
-// or it will keep a count and exit if more than 20 errors have been printed.
+// or it will keep a count and exit if more errors than the
+// -errorlimit have been printed.
 //
 // Logging an error means that on exit cmd/link will delete any
 // output file and return a non-zero error code.
@@ -2599,10 +2745,49 @@ func (reporter *ErrorReporter) Errorf(s Sym, format string, args ...interface{})
 		format = fmt.Sprintf("sym %d: %s", s, format)
 	}
 	format += "\n"
+	if d := reporter.deferred; d != nil {
+		msg := fmt.Sprintf(format, args...)
+		d.mu.Lock()
+		d.errs = append(d.errs, deferredError{s, msg})
+		d.mu.Unlock()
+		return
+	}
 	fmt.Fprintf(os.Stderr, format, args...)
 	reporter.AfterErrorAction()
 }
 
+// Defer makes Errorf collect the errors rather than print them, until
+// Flush is called. It is for the phases that process symbols in
+// parallel, so that their errors come out in the same order from one
+// run to the next. Defer and Flush must not be called in parallel with
+// Errorf.
+func (reporter *ErrorReporter) Defer() {
+	reporter.deferred = &deferredErrors{}
+}
+
+// Flush prints the errors collected since Defer, ordered by the address
+// of their symbol, and then by the order they were reported in, and
+// invokes the error action after each.
+func (reporter *ErrorReporter) Flush() {
+	d := reporter.deferred
+	if d == nil {
+		return
+	}
+	reporter.deferred = nil
+	ldr := reporter.ldr
+	sort.SliceStable(d.errs, func(i, j int) bool {
+		a, b := d.errs[i].s, d.errs[j].s
+		if va, vb := ldr.SymValue(a), ldr.SymValue(b); va != vb {
+			return va < vb
+		}
+		return a < b
+	})
+	for _, e := range d.errs {
+		fmt.Fprint(os.Stderr, e.msg)
+		reporter.AfterErrorAction()
+	}
+}
+
 // GetErrorReporter returns the loader's associated error reporter.
 func (l *Loader) GetErrorReporter() *ErrorReporter {
 	return l.errorReporter
@@ -11,6 +11,9 @@ import (
 	"cmd/internal/sys"
 	"cmd/link/internal/sym"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
 )
 
@@ -453,3 +456,58 @@ func TestOuterSub(t *testing.T) {
 		t.Errorf("expected %d in sub list got %d", 5, count)
 	}
 }
+
+func TestDeferErrors(t *testing.T) {
+	ldr := mkLoader()
+	reporter := ldr.GetErrorReporter()
+	nerrors := 0
+	reporter.AfterErrorAction = func() { nerrors++ }
+
+	var syms []Sym
+	for i, v := range []int64{0x300, 0x100, 0x200} {
+		s := ldr.LookupOrCreateSym(fmt.Sprintf("s%d", i), 0)
+		ldr.SetSymValue(s, v)
+		syms = append(syms, s)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	// Report the errors of each symbol in parallel, as the
+	// relocations are applied.
+	reporter.Defer()
+	var wg sync.WaitGroup
+	for _, s := range syms {
+		wg.Add(1)
+		go func(s Sym) {
+			defer wg.Done()
+			ldr.Errorf(s, "first")
+			ldr.Errorf(s, "second")
+		}(s)
+	}
+	wg.Wait()
+	if nerrors != 0 {
+		t.Errorf("%d errors before Flush, want 0", nerrors)
+	}
+	reporter.Flush()
+	ldr.Errorf(syms[0], "after")
+	w.Close()
+	os.Stderr = stderr
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "s1: first\ns1: second\ns2: first\ns2: second\ns0: first\ns0: second\ns0: after\n"
+	if string(out) != want {
+		t.Errorf("got errors\n%s\nwant\n%s", out, want)
+	}
+	if nerrors != 7 {
+		t.Errorf("got %d errors, want 7", nerrors)
+	}
+}
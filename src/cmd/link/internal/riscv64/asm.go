@@ -21,6 +21,257 @@ import (
 const fakeLabelName = ".L0 "
 
 func gentext(ctxt *ld.Link, ldr *loader.Loader) {
+	if ctxt.IsELF {
+		addAttributes(ctxt, ldr)
+	}
+}
+
+func adddynrel(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym, r loader.Reloc, rIdx int) bool {
+	targ := r.Sym()
+	var targType sym.SymKind
+	if targ != 0 {
+		targType = ldr.SymType(targ)
+	}
+
+	switch r.Type() {
+	default:
+		if r.Type() >= objabi.ElfRelocOffset {
+			ldr.Errorf(s, "unexpected relocation type %d (%s)", r.Type(), sym.RelocName(target.Arch, r.Type()))
+			return false
+		}
+
+	// Handle relocations found in ELF object files.
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_JAL):
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected R_RISCV_JAL relocation for dynamic symbol %s", ldr.SymName(targ))
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_CALL)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_CALL),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_CALL_PLT):
+		// The AUIPC + JALR pair is relocated as any other AUIPC +
+		// I-type instruction pair.
+		su := ldr.MakeSymbolUpdater(s)
+		if targType == sym.SDYNIMPORT {
+			addpltsym(target, ldr, syms, targ)
+			su.SetRelocSym(rIdx, syms.PLT)
+			su.SetRelocAdd(rIdx, r.Add()+int64(ldr.SymPlt(targ)))
+		}
+		if (targType == 0 || targType == sym.SXREF) && !ldr.AttrVisibilityHidden(targ) {
+			ldr.Errorf(s, "unknown symbol %s in RISC-V call", ldr.SymName(targ))
+		}
+		su.SetRelocType(rIdx, objabi.R_RISCV_PCREL_ITYPE)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_GOT_HI20):
+		if targType != sym.SDYNIMPORT && !target.IsPIE() {
+			addgotsyminternal(target, ldr, syms, targ)
+		} else {
+			ld.AddGotSym(target, ldr, syms, targ, uint32(elf.R_RISCV_64))
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_PCREL_HI20)
+		su.SetRelocSym(rIdx, syms.GOT)
+		su.SetRelocAdd(rIdx, r.Add()+int64(ldr.SymGot(targ)))
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_PCREL_HI20):
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected R_RISCV_PCREL_HI20 relocation for dynamic symbol %s", ldr.SymName(targ))
+		}
+		if (targType == 0 || targType == sym.SXREF) && !ldr.AttrVisibilityHidden(targ) {
+			ldr.Errorf(s, "unknown symbol %s in pcrel", ldr.SymName(targ))
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_PCREL_HI20)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_PCREL_LO12_I),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_PCREL_LO12_S):
+		// The symbol is the label of the AUIPC instruction, whose
+		// R_RISCV_PCREL_HI20 relocation gives the address.
+		if r.Add() != 0 {
+			ldr.Errorf(s, "%s relocation with non-zero addend (%v)", sym.RelocName(target.Arch, r.Type()), r.Add())
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		if r.Type() == objabi.ElfRelocOffset+objabi.RelocType(elf.R_RISCV_PCREL_LO12_I) {
+			su.SetRelocType(rIdx, objabi.R_RISCV_PCREL_LO12_I)
+		} else {
+			su.SetRelocType(rIdx, objabi.R_RISCV_PCREL_LO12_S)
+		}
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_BRANCH),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_RVC_BRANCH),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_RVC_JUMP):
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected %s relocation for dynamic symbol %s", sym.RelocName(target.Arch, r.Type()), ldr.SymName(targ))
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		switch r.Type() - objabi.ElfRelocOffset {
+		case objabi.RelocType(elf.R_RISCV_BRANCH):
+			su.SetRelocType(rIdx, objabi.R_RISCV_BRANCH)
+		case objabi.RelocType(elf.R_RISCV_RVC_BRANCH):
+			su.SetRelocType(rIdx, objabi.R_RISCV_RVC_BRANCH)
+		default:
+			su.SetRelocType(rIdx, objabi.R_RISCV_RVC_JUMP)
+		}
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_32_PCREL):
+		if targType == sym.SDYNIMPORT {
+			ldr.Errorf(s, "unexpected R_RISCV_32_PCREL relocation for dynamic symbol %s", ldr.SymName(targ))
+		}
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_PCREL)
+		su.SetRelocAdd(rIdx, r.Add()+4)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_32),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_64):
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_ADDR)
+		if targType == sym.SDYNIMPORT || target.IsPIE() && target.IsInternal() {
+			// The address is only known at run time. Let the code
+			// below generate a dynamic relocation.
+			break
+		}
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SET8),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SET16),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SET32):
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_ADDR)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_ADD8),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_ADD16),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_ADD32),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_ADD64):
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_ADD)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SUB8),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SUB16),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SUB32),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SUB64):
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_SUB)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SET6):
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_SET6)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_SUB6):
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocType(rIdx, objabi.R_RISCV_SUB6)
+		return true
+
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_RELAX),
+		objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_ALIGN):
+		// The code is not relaxed, which leaves it correct, if
+		// larger and not always aligned as asked.
+		return true
+	}
+
+	// Reread the reloc to incorporate any changes in type above.
+	relocs := ldr.Relocs(s)
+	r = relocs.At(rIdx)
+
+	switch r.Type() {
+	case objabi.R_RISCV_CALL, objabi.R_RISCV_PCREL_ITYPE:
+		if targType != sym.SDYNIMPORT {
+			// nothing to do, the relocation will be laid out in reloc
+			return true
+		}
+		if target.IsExternal() {
+			// External linker will do this relocation.
+			return true
+		}
+		// Internal linking.
+		if r.Add() != 0 {
+			ldr.Errorf(s, "PLT call with non-zero addend (%v)", r.Add())
+		}
+		// Build a PLT entry and change the relocation target to that entry.
+		addpltsym(target, ldr, syms, targ)
+		su := ldr.MakeSymbolUpdater(s)
+		su.SetRelocSym(rIdx, syms.PLT)
+		su.SetRelocAdd(rIdx, int64(ldr.SymPlt(targ)))
+		return true
+
+	case objabi.R_ADDR:
+		if targType == sym.SDYNIMPORT && target.IsInternal() && r.Siz() == 8 {
+			// The data is asking for the address of a symbol of a
+			// shared library. Let the dynamic linker fill it in.
+			ld.Adddynsym(ldr, target, syms, targ)
+			rela := ldr.MakeSymbolUpdater(syms.Rela)
+			rela.AddAddrPlus(target.Arch, s, int64(r.Off()))
+			rela.AddUint64(target.Arch, elf.R_INFO(uint32(ldr.SymDynid(targ)), uint32(elf.R_RISCV_64)))
+			rela.AddUint64(target.Arch, uint64(r.Add()))
+			su := ldr.MakeSymbolUpdater(s)
+			su.SetRelocType(rIdx, objabi.R_CONST) // write r->add during relocsym
+			su.SetRelocSym(rIdx, 0)
+			return true
+		}
+
+		// Process dynamic relocations for the data sections.
+		if target.IsPIE() && target.IsInternal() {
+			// When internally linking, generate dynamic relocations
+			// for all typical R_ADDR relocations. The exception
+			// are those R_ADDR that are created as part of generating
+			// the dynamic relocations and must be resolved statically.
+			//
+			// See ../amd64/asm.go:adddynrel for the details.
+			switch ldr.SymName(s) {
+			case ".dynsym", ".rela", ".rela.plt", ".got.plt", ".dynamic":
+				return false
+			}
+		} else {
+			// Either internally linking a static executable,
+			// in which case we can resolve these relocations
+			// statically in the 'reloc' phase, or externally
+			// linking, in which case the relocation will be
+			// prepared in the 'reloc' phase and passed to the
+			// external linker in the 'asmb' phase.
+			if ldr.SymType(s) != sym.SDATA && ldr.SymType(s) != sym.SRODATA {
+				break
+			}
+		}
+
+		// With -pack-relative-relocs, the relocation goes in
+		// the packed .relr.dyn table instead. As below, the
+		// word still gets the link-time address statically.
+		if ld.ElfAddRelr(target, ldr, s, r) {
+			return true
+		}
+
+		// Generate R_RISCV_RELATIVE relocations for best
+		// efficiency in the dynamic linker.
+		//
+		// The r_offset and r_addend fields are filled in by
+		// R_ADDR relocations in the 'reloc' phase, after symbol
+		// addresses are assigned.
+		rela := ldr.MakeSymbolUpdater(syms.Rela)
+		rela.AddAddrPlus(target.Arch, s, int64(r.Off()))
+		if r.Siz() == 8 {
+			rela.AddUint64(target.Arch, elf.R_INFO(0, uint32(elf.R_RISCV_RELATIVE)))
+		} else {
+			ldr.Errorf(s, "unexpected relocation for dynamic symbol %s", ldr.SymName(targ))
+		}
+		rela.AddAddrPlus(target.Arch, targ, int64(r.Add()))
+		// Not mark r done here. So we still apply it statically,
+		// so in the file content we'll also have the right offset
+		// to the relocation target. So it can be examined statically
+		// (e.g. go version).
+		return true
+	}
+	return false
 }
 
 func genSymsLate(ctxt *ld.Link, ldr *loader.Loader) {
@@ -147,7 +398,99 @@ func elfreloc1(ctxt *ld.Link, out *ld.OutBuf, ldr *loader.Loader, s loader.Sym,
 }
 
 func elfsetupplt(ctxt *ld.Link, plt, gotplt *loader.SymbolBuilder, dynamic loader.Sym) {
-	log.Fatalf("elfsetupplt")
+	if plt.Size() != 0 {
+		return
+	}
+	if gotplt.Size() != 0 {
+		ctxt.Errorf(gotplt.Sym(), "got.plt is not empty at the very beginning")
+	}
+
+	// The PLT header is entered from a PLT entry with the address of
+	// the header in t3 and the address of the instruction after the
+	// JALR of the entry in t1. It calls the dynamic linker to resolve
+	// the symbol with the link map in t0 and the offset of the entry
+	// in .got.plt, from its first entry after the header, in t1:
+	//
+	//	sub	t1, t1, t3
+	//	auipc	t2, %pcrel_hi(.got.plt)
+	//	addi	t2, t2, %pcrel_lo(.got.plt)
+	//	ld	t3, 0(t2)	# _dl_runtime_resolve
+	//	addi	t1, t1, -(32+12)
+	//	srli	t1, t1, 1
+	//	ld	t0, 8(t2)	# link map
+	//	jr	t3
+	//
+	// This is the header of the RISC-V psABI, reordered to keep the
+	// AUIPC and the instruction using its result together.
+	plt.AddUint32(ctxt.Arch, 0x41c30333)
+	plt.AddUint32(ctxt.Arch, 0x00000397)
+	plt.AddUint32(ctxt.Arch, 0x00038393)
+	r, _ := plt.AddRel(objabi.R_RISCV_PCREL_ITYPE)
+	r.SetOff(int32(plt.Size() - 8))
+	r.SetSiz(8)
+	r.SetSym(gotplt.Sym())
+	plt.AddUint32(ctxt.Arch, 0x0003be03)
+	plt.AddUint32(ctxt.Arch, 0xfd430313)
+	plt.AddUint32(ctxt.Arch, 0x00135313)
+	plt.AddUint32(ctxt.Arch, 0x0083b283)
+	plt.AddUint32(ctxt.Arch, 0x000e0067)
+
+	// The dynamic linker sets the first two entries of .got.plt to
+	// _dl_runtime_resolve and the link map.
+	gotplt.AddUint64(ctxt.Arch, 0)
+	gotplt.AddUint64(ctxt.Arch, 0)
+}
+
+func addpltsym(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym) {
+	if ldr.SymPlt(s) >= 0 {
+		return
+	}
+
+	ld.Adddynsym(ldr, target, syms, s)
+
+	plt := ldr.MakeSymbolUpdater(syms.PLT)
+	gotplt := ldr.MakeSymbolUpdater(syms.GOTPLT)
+	rela := ldr.MakeSymbolUpdater(syms.RelaPLT)
+	if plt.Size() == 0 {
+		panic("plt is not set up")
+	}
+
+	// auipc	t3, %pcrel_hi(got.plt entry)
+	// ld		t3, %pcrel_lo(got.plt entry)(t3)
+	// jalr	t1, t3
+	// nop
+	ldr.SetPlt(s, int32(plt.Size()))
+	plt.AddUint32(target.Arch, 0x00000e17)
+	plt.AddUint32(target.Arch, 0x000e3e03)
+	r, _ := plt.AddRel(objabi.R_RISCV_PCREL_ITYPE)
+	r.SetOff(int32(plt.Size() - 8))
+	r.SetSiz(8)
+	r.SetSym(gotplt.Sym())
+	r.SetAdd(gotplt.Size())
+	plt.AddUint32(target.Arch, 0x000e0367)
+	plt.AddUint32(target.Arch, 0x00000013)
+
+	// add to got.plt: pointer to the PLT header, until the
+	// dynamic linker resolves the symbol.
+	gotplt.AddAddrPlus(target.Arch, plt.Sym(), 0)
+
+	// rela
+	rela.AddAddrPlus(target.Arch, gotplt.Sym(), gotplt.Size()-8)
+	rela.AddUint64(target.Arch, elf.R_INFO(uint32(ldr.SymDynid(s)), uint32(elf.R_RISCV_JUMP_SLOT)))
+	rela.AddUint64(target.Arch, 0)
+}
+
+// addgotsyminternal adds a GOT entry for s, which is defined by the
+// executable, holding its address. Unlike ld.AddGotSym, it needs no
+// dynamic relocation.
+func addgotsyminternal(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, s loader.Sym) {
+	if ldr.SymGot(s) >= 0 {
+		return
+	}
+
+	got := ldr.MakeSymbolUpdater(syms.GOT)
+	ldr.SetGot(s, int32(got.Size()))
+	got.AddAddrPlus(target.Arch, s, 0)
 }
 
 func machoreloc1(*sys.Arch, *ld.OutBuf, *loader.Loader, loader.Sym, loader.ExtReloc, int64) bool {
@@ -156,34 +499,6 @@ func machoreloc1(*sys.Arch, *ld.OutBuf, *loader.Loader, loader.Sym, loader.ExtRe
 }
 
 func archreloc(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, r loader.Reloc, s loader.Sym, val int64) (o int64, nExtReloc int, ok bool) {
-	rs := r.Sym()
-	pc := ldr.SymValue(s) + int64(r.Off())
-
-	// If the call points to a trampoline, see if we can reach the symbol
-	// directly. This situation can occur when the relocation symbol is
-	// not assigned an address until after the trampolines are generated.
-	if r.Type() == objabi.R_RISCV_CALL_TRAMP {
-		relocs := ldr.Relocs(rs)
-		if relocs.Count() != 1 {
-			ldr.Errorf(s, "trampoline %v has %d relocations", ldr.SymName(rs), relocs.Count())
-		}
-		tr := relocs.At(0)
-		if tr.Type() != objabi.R_RISCV_PCREL_ITYPE {
-			ldr.Errorf(s, "trampoline %v has unexpected relocation %v", ldr.SymName(rs), tr.Type())
-		}
-		trs := tr.Sym()
-		if ldr.SymValue(trs) != 0 && ldr.SymType(trs) != sym.SDYNIMPORT && ldr.SymType(trs) != sym.SUNDEFEXT {
-			trsOff := ldr.SymValue(trs) + tr.Add() - pc
-			if trsOff >= -(1<<20) && trsOff < (1<<20) {
-				r.SetType(objabi.R_RISCV_CALL)
-				r.SetSym(trs)
-				r.SetAdd(tr.Add())
-				rs = trs
-			}
-		}
-
-	}
-
 	if target.IsExternal() {
 		switch r.Type() {
 		case objabi.R_RISCV_CALL, objabi.R_RISCV_CALL_TRAMP:
@@ -196,7 +511,12 @@ func archreloc(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, r loade
 		return val, 0, false
 	}
 
-	off := ldr.SymValue(rs) + r.Add() - pc
+	rs, add := r.Sym(), r.Add()
+	if r.Type() == objabi.R_RISCV_CALL_TRAMP {
+		rs, add = callTarget(ldr, r, s)
+	}
+	pc := ldr.SymValue(s) + int64(r.Off())
+	off := ldr.SymValue(rs) + add - pc
 
 	switch r.Type() {
 	case objabi.R_RISCV_CALL, objabi.R_RISCV_CALL_TRAMP:
@@ -211,16 +531,129 @@ func archreloc(target *ld.Target, ldr *loader.Loader, syms *ld.ArchSyms, r loade
 
 		return val, 0, true
 
-	case objabi.R_RISCV_TLS_IE_ITYPE, objabi.R_RISCV_TLS_IE_STYPE:
-		// TLS relocations are not currently handled for internal linking.
-		// For now, TLS is only used when cgo is in use and cgo currently
-		// requires external linking. However, we need to accept these
-		// relocations so that code containing TLS variables will link,
-		// even when they're not being used. For now, replace these
+	case objabi.R_RISCV_TLS_IE_ITYPE:
+		// We are linking the final executable, so relax the
+		// initial-exec load of the offset of the variable from the
+		// thread pointer, from its GOT entry, to local-exec, as the
+		// host linkers do:
+		//
+		//	auipc rd, %tls_ie_pcrel_hi(v)  =>  lui  rd, %tprel_hi(v)
+		//	ld    rd2, %pcrel_lo(rd)       =>  addi rd2, rd, %tprel_lo(v)
+		//
+		// The TCB is below the thread pointer, which the TLS block
+		// starts at.
+		v := ld.TLSSymOffset(ldr, rs) + add
+		low, high, err := riscv.Split32BitImmediate(v)
+		if err != nil {
+			ldr.Errorf(s, "TLS offset of %s does not fit in 32 bits: %d", ldr.SymName(rs), v)
+		}
+		luiImm, err := riscv.EncodeUImmediate(high)
+		if err != nil {
+			ldr.Errorf(s, "cannot encode TLS offset of %s: %v", ldr.SymName(rs), err)
+		}
+		addiImm, err := riscv.EncodeIImmediate(low)
+		if err != nil {
+			ldr.Errorf(s, "cannot encode TLS offset of %s: %v", ldr.SymName(rs), err)
+		}
+		const (
+			luiOp  = 0x37
+			addiOp = 0x13
+		)
+		// Keep the destination register of the AUIPC, and both
+		// registers of the load.
+		lui := int64(uint32(val))&0xf80 | luiOp | int64(uint32(luiImm))
+		addi := int64(uint32(val>>32))&0xf8f80 | addiOp | int64(uint32(addiImm))
+		return addi<<32 | lui, 0, true
+
+	case objabi.R_RISCV_TLS_IE_STYPE:
+		// The compiler never stores to a TLS GOT entry, which is
+		// what this would do. Accept the relocation so that code
+		// containing such a store will link, but replace the
 		// instructions with EBREAK to detect accidental use.
 		const ebreakIns = 0x00100073
 		return ebreakIns<<32 | ebreakIns, 0, true
 
+	case objabi.R_RISCV_PCREL_HI20:
+		_, high, err := riscv.Split32BitImmediate(off)
+		if err != nil {
+			ldr.Errorf(s, "R_RISCV_PCREL_HI20 relocation does not fit in 32 bits: %d", off)
+		}
+		imm, err := riscv.EncodeUImmediate(high)
+		if err != nil {
+			ldr.Errorf(s, "cannot encode R_RISCV_PCREL_HI20 relocation offset for %s: %v", ldr.SymName(rs), err)
+		}
+		return val&^riscv.UTypeImmMask | int64(uint32(imm)), 0, true
+
+	case objabi.R_RISCV_PCREL_LO12_I, objabi.R_RISCV_PCREL_LO12_S:
+		// The symbol is the label of the AUIPC instruction, which
+		// the low 12 bits of its offset go with.
+		hi20, ok := findHI20Reloc(ldr, rs)
+		if !ok {
+			ldr.Errorf(s, "missing R_RISCV_PCREL_HI20 relocation at %s for %s relocation", ldr.SymName(rs), r.Type())
+			return val, 0, false
+		}
+		hiOff := ldr.SymValue(hi20.Sym()) + hi20.Add() - ldr.SymValue(rs)
+		low, _, err := riscv.Split32BitImmediate(hiOff)
+		if err != nil {
+			ldr.Errorf(s, "%s relocation does not fit in 32 bits: %d", r.Type(), hiOff)
+		}
+		var imm, immMask int64
+		if r.Type() == objabi.R_RISCV_PCREL_LO12_I {
+			imm, err = riscv.EncodeIImmediate(low)
+			immMask = riscv.ITypeImmMask
+		} else {
+			imm, err = riscv.EncodeSImmediate(low)
+			immMask = riscv.STypeImmMask
+		}
+		if err != nil {
+			ldr.Errorf(s, "cannot encode %s relocation offset for %s: %v", r.Type(), ldr.SymName(hi20.Sym()), err)
+		}
+		return val&^immMask | int64(uint32(imm)), 0, true
+
+	case objabi.R_RISCV_BRANCH:
+		imm, err := riscv.EncodeBImmediate(off)
+		if err != nil {
+			ldr.Errorf(s, "cannot encode R_RISCV_BRANCH relocation offset for %s: %v", ldr.SymName(rs), err)
+		}
+		return val&^riscv.BTypeImmMask | int64(uint32(imm)), 0, true
+
+	case objabi.R_RISCV_RVC_BRANCH:
+		// The 2-byte instructions are returned sign-extended, to
+		// pass the range check of the generic code.
+		imm, err := riscv.EncodeCBImmediate(off)
+		if err != nil {
+			ldr.Errorf(s, "cannot encode R_RISCV_RVC_BRANCH relocation offset for %s: %v", ldr.SymName(rs), err)
+		}
+		return int64(int16(val&^riscv.CBTypeImmMask | imm)), 0, true
+
+	case objabi.R_RISCV_RVC_JUMP:
+		imm, err := riscv.EncodeCJImmediate(off)
+		if err != nil {
+			ldr.Errorf(s, "cannot encode R_RISCV_RVC_JUMP relocation offset for %s: %v", ldr.SymName(rs), err)
+		}
+		return int64(int16(val&^riscv.CJTypeImmMask | imm)), 0, true
+
+	case objabi.R_RISCV_ADD, objabi.R_RISCV_SUB:
+		v := ldr.SymValue(rs) + add
+		if r.Type() == objabi.R_RISCV_SUB {
+			v = -v
+		}
+		// Keep the sum of the pair in range for its size, as
+		// only the last relocation of it gives the final value.
+		switch r.Siz() {
+		case 2:
+			return int64(int16(val + v)), 0, true
+		case 4:
+			return int64(int32(val + v)), 0, true
+		}
+		return val + v, 0, true
+
+	case objabi.R_RISCV_SET6:
+		return val&^0x3f | (ldr.SymValue(rs)+add)&0x3f, 0, true
+
+	case objabi.R_RISCV_SUB6:
+		return val&^0x3f | (val-(ldr.SymValue(rs)+add))&0x3f, 0, true
+
 	case objabi.R_RISCV_PCREL_ITYPE, objabi.R_RISCV_PCREL_STYPE:
 		// Generate AUIPC and second instruction immediates.
 		low, high, err := riscv.Split32BitImmediate(off)
@@ -268,11 +701,67 @@ func archrelocvariant(*ld.Target, *loader.Loader, loader.Reloc, sym.RelocVariant
 	return -1
 }
 
+// findHI20Reloc returns the R_RISCV_PCREL_HI20 relocation at the label
+// s of a host object, which its R_RISCV_PCREL_LO12_* relocations refer
+// to.
+func findHI20Reloc(ldr *loader.Loader, s loader.Sym) (loader.Reloc, bool) {
+	outer := ldr.OuterSym(s)
+	if outer == 0 {
+		return loader.Reloc{}, false
+	}
+	off := int32(ldr.SymValue(s) - ldr.SymValue(outer))
+	relocs := ldr.Relocs(outer)
+	i := sort.Search(relocs.Count(), func(i int) bool { return relocs.At(i).Off() >= off })
+	for ; i < relocs.Count(); i++ {
+		r := relocs.At(i)
+		if r.Off() != off {
+			break
+		}
+		if r.Type() == objabi.R_RISCV_PCREL_HI20 {
+			return r, true
+		}
+	}
+	return loader.Reloc{}, false
+}
+
+// callTarget returns the symbol and addend that the call relocation r
+// of s, to a trampoline, resolves to. This is the target of the
+// trampoline if the call can reach it directly, which happens when the
+// target is not assigned an address until after the trampolines are
+// generated. The relocation itself is left as it is, as relocations
+// are applied in parallel.
+func callTarget(ldr *loader.Loader, r loader.Reloc, s loader.Sym) (loader.Sym, int64) {
+	rs := r.Sym()
+	relocs := ldr.Relocs(rs)
+	if relocs.Count() != 1 {
+		ldr.Errorf(s, "trampoline %v has %d relocations", ldr.SymName(rs), relocs.Count())
+		return rs, r.Add()
+	}
+	tr := relocs.At(0)
+	if tr.Type() != objabi.R_RISCV_PCREL_ITYPE {
+		ldr.Errorf(s, "trampoline %v has unexpected relocation %v", ldr.SymName(rs), tr.Type())
+	}
+	trs := tr.Sym()
+	if ldr.SymValue(trs) != 0 && ldr.SymType(trs) != sym.SDYNIMPORT && ldr.SymType(trs) != sym.SUNDEFEXT {
+		pc := ldr.SymValue(s) + int64(r.Off())
+		trsOff := ldr.SymValue(trs) + tr.Add() - pc
+		if trsOff >= -(1<<20) && trsOff < (1<<20) {
+			return trs, tr.Add()
+		}
+	}
+	return rs, r.Add()
+}
+
 func extreloc(target *ld.Target, ldr *loader.Loader, r loader.Reloc, s loader.Sym) (loader.ExtReloc, bool) {
 	switch r.Type() {
-	case objabi.R_RISCV_CALL, objabi.R_RISCV_CALL_TRAMP:
+	case objabi.R_RISCV_CALL:
 		return ld.ExtrelocSimple(ldr, r), true
 
+	case objabi.R_RISCV_CALL_TRAMP:
+		rr := ld.ExtrelocSimple(ldr, r)
+		rr.Xsym, rr.Xadd = callTarget(ldr, r, s)
+		return rr, true
+
 	case objabi.R_RISCV_PCREL_ITYPE, objabi.R_RISCV_PCREL_STYPE, objabi.R_RISCV_TLS_IE_ITYPE, objabi.R_RISCV_TLS_IE_STYPE:
 		return ld.ExtrelocViaOuterSym(ldr, r, s), true
 	}
@@ -284,6 +773,16 @@ func trampoline(ctxt *ld.Link, ldr *loader.Loader, ri int, rs, s loader.Sym) {
 	r := relocs.At(ri)
 
 	switch r.Type() {
+	case objabi.ElfRelocOffset + objabi.RelocType(elf.R_RISCV_JAL):
+		// A JAL of a host object, which adddynrel reports if it
+		// calls a dynamic symbol. Otherwise, turn it into the
+		// R_RISCV_CALL that adddynrel would, as adddynrel does not run
+		// for static executables.
+		if ldr.SymType(rs) == sym.SDYNIMPORT {
+			break
+		}
+		ldr.MakeSymbolUpdater(s).SetRelocType(ri, objabi.R_RISCV_CALL)
+		fallthrough
 	case objabi.R_RISCV_CALL:
 		pc := ldr.SymValue(s) + int64(r.Off())
 		off := ldr.SymValue(rs) + r.Add() - pc
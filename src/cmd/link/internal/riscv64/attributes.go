@@ -0,0 +1,342 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package riscv64
+
+import (
+	"bytes"
+	"cmd/link/internal/ld"
+	"cmd/link/internal/loadelf"
+	"cmd/link/internal/loader"
+	"cmd/link/internal/sym"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goISA is the ISA of the code generated by the Go toolchain: RV64G
+// without Zifencei, as the compiler and assembler emit neither
+// compressed instructions nor FENCE.I. There is no GORISCV64 setting to
+// select another one. The versions are those of the user-level ISA
+// specification 2.2, which also covers the CSR instructions the runtime
+// uses.
+const goISA = "rv64i2p0_m2p0_a2p0_f2p0_d2p0"
+
+// goStackAlign is the stack alignment of the Go code. It only needs
+// 8-byte alignment, but the runtime aligns the stack to 16 bytes when
+// it calls C code, as the psABI requires.
+const goStackAlign = 16
+
+// addAttributes creates the .riscv.attributes section of the output.
+//
+// When linking internally, it holds the attributes of the Go code
+// merged with those of the host objects, following the psABI: the ISA
+// has the extensions of all of the objects, each at its highest
+// version, and the objects must agree on the stack alignment. When
+// linking externally, it holds the attributes of the Go code for the
+// host linker to merge. The ISA string then has no versions, so that
+// the host linker fills in those of its default ISA specification,
+// which match those of the objects its C compiler generates.
+func addAttributes(ctxt *ld.Link, ldr *loader.Loader) {
+	isa, err := parseISA(goISA)
+	if err != nil {
+		panic(err)
+	}
+	attrs := loadelf.RISCVAttributes{StackAlign: goStackAlign}
+	for _, h := range ctxt.HostAttrs {
+		if err := mergeAttributes(&attrs, isa, &h.Attrs.RISCV); err != nil {
+			ld.Errorf(nil, "%s: %v", h.Pn, err)
+		}
+	}
+	attrs.Arch = isa.String(ctxt.IsInternal())
+
+	s := ldr.CreateSymForUpdate(".riscv.attributes", 0)
+	s.SetType(sym.SELFROSECT)
+	s.SetReachable(true)
+	s.SetAlign(1)
+	s.AddBytes(encodeAttributes(ctxt.Arch.ByteOrder, &attrs))
+}
+
+// mergeAttributes merges the attributes of a host object, in, into out
+// and isa, which holds the ISA of out.
+func mergeAttributes(out *loadelf.RISCVAttributes, isa *riscvISA, in *loadelf.RISCVAttributes) error {
+	if in.Arch != "" {
+		inISA, err := parseISA(in.Arch)
+		if err != nil {
+			return err
+		}
+		if err := isa.merge(inISA); err != nil {
+			return err
+		}
+	}
+	if in.StackAlign != 0 {
+		if out.StackAlign != 0 && out.StackAlign != in.StackAlign {
+			return fmt.Errorf("stack alignment %d is incompatible with %d", in.StackAlign, out.StackAlign)
+		}
+		out.StackAlign = in.StackAlign
+	}
+	out.UnalignedAccess = out.UnalignedAccess || in.UnalignedAccess
+	// Keep the newest version of the privileged specification.
+	for i := range in.PrivSpec {
+		if in.PrivSpec[i] != out.PrivSpec[i] {
+			if in.PrivSpec[i] > out.PrivSpec[i] {
+				out.PrivSpec = in.PrivSpec
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// encodeAttributes returns the contents of a .riscv.attributes section
+// holding attrs, with the tags in increasing order.
+func encodeAttributes(e binary.ByteOrder, attrs *loadelf.RISCVAttributes) []byte {
+	var list []byte
+	var buf [binary.MaxVarintLen64]byte
+	uleb := func(v uint64) {
+		list = append(list, buf[:binary.PutUvarint(buf[:], v)]...)
+	}
+	if attrs.StackAlign != 0 {
+		uleb(loadelf.TagRISCVStackAlign)
+		uleb(attrs.StackAlign)
+	}
+	uleb(loadelf.TagRISCVArch)
+	list = append(list, attrs.Arch...)
+	list = append(list, 0)
+	if attrs.UnalignedAccess {
+		uleb(loadelf.TagRISCVUnalignedAccess)
+		uleb(1)
+	}
+	if attrs.PrivSpec != [3]uint64{} {
+		uleb(loadelf.TagRISCVPrivSpec)
+		uleb(attrs.PrivSpec[0])
+		uleb(loadelf.TagRISCVPrivSpecMinor)
+		uleb(attrs.PrivSpec[1])
+		uleb(loadelf.TagRISCVPrivSpecRevision)
+		uleb(attrs.PrivSpec[2])
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('A')
+	const vendor = "riscv\x00"
+	binary.Write(&b, e, uint32(4+len(vendor)+1+4+len(list)))
+	b.WriteString(vendor)
+	b.WriteByte(loadelf.TagFile)
+	binary.Write(&b, e, uint32(1+4+len(list)))
+	b.Write(list)
+	return b.Bytes()
+}
+
+// A riscvISA is an ISA parsed from an ISA string such as
+// "rv64i2p0_m2p0_c2p0": a base with a set of extensions, each at an
+// optional version.
+type riscvISA struct {
+	xlen string // "32" or "64"
+	exts map[string]riscvVersion
+}
+
+// A riscvVersion is the version of an extension, or the zero value if
+// it is not known.
+type riscvVersion struct {
+	major, minor int
+	known        bool
+}
+
+func (v riscvVersion) less(w riscvVersion) bool {
+	if !v.known || !w.known {
+		return !v.known && w.known
+	}
+	return v.major < w.major || v.major == w.major && v.minor < w.minor
+}
+
+// parseISA parses an ISA string, as found in Tag_RISCV_arch. The
+// single-letter extensions may or may not be separated by underscores,
+// and the versions are optional.
+func parseISA(s string) (*riscvISA, error) {
+	bad := fmt.Errorf("malformed ISA string %q", s)
+	rest := strings.ToLower(s)
+	if len(rest) < 5 || !strings.HasPrefix(rest, "rv32") && !strings.HasPrefix(rest, "rv64") {
+		return nil, bad
+	}
+	isa := &riscvISA{xlen: rest[2:4], exts: make(map[string]riscvVersion)}
+	rest = rest[4:]
+	if c := rest[0]; c != 'i' && c != 'e' && c != 'g' {
+		return nil, bad
+	}
+	for _, tok := range strings.Split(rest, "_") {
+		if tok == "" {
+			continue
+		}
+		if c := tok[0]; c == 'z' || c == 's' || c == 'x' {
+			// A multi-letter extension, which ends with its version,
+			// if any. Its name itself may contain digits, as in zve32x.
+			name, v := tok, riscvVersion{}
+			if i := versionStart(tok); i > 1 {
+				name, v = tok[:i], parseVersion(tok[i:])
+			}
+			isa.add(name, v)
+			continue
+		}
+		for len(tok) > 0 {
+			c := tok[0]
+			if c < 'a' || c > 'z' {
+				return nil, bad
+			}
+			tok = tok[1:]
+			n := 0
+			for n < len(tok) && (isDigit(tok[n]) || tok[n] == 'p' && n > 0 && n+1 < len(tok) && isDigit(tok[n+1]) && isDigit(tok[n-1])) {
+				n++
+			}
+			v := parseVersion(tok[:n])
+			tok = tok[n:]
+			if c == 'g' {
+				for _, e := range []string{"i", "m", "a", "f", "d"} {
+					isa.add(e, riscvVersion{})
+				}
+				continue
+			}
+			isa.add(string(c), v)
+		}
+	}
+	return isa, nil
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// versionStart returns the index of the version at the end of the
+// multi-letter extension tok, or len(tok) if it has none.
+func versionStart(tok string) int {
+	i := len(tok)
+	for i > 0 && isDigit(tok[i-1]) {
+		i--
+	}
+	if i == len(tok) {
+		return i
+	}
+	if j := i - 1; j > 0 && tok[j] == 'p' && isDigit(tok[j-1]) {
+		i = j
+		for i > 0 && isDigit(tok[i-1]) {
+			i--
+		}
+	}
+	return i
+}
+
+// defaultVersions are the versions of the extensions of the user-level
+// ISA specification 2.2, for the extensions an ISA string gives without
+// a version.
+var defaultVersions = map[string]riscvVersion{
+	"i":        {2, 0, true},
+	"e":        {1, 9, true},
+	"m":        {2, 0, true},
+	"a":        {2, 0, true},
+	"f":        {2, 0, true},
+	"d":        {2, 0, true},
+	"q":        {2, 0, true},
+	"c":        {2, 0, true},
+	"zicsr":    {2, 0, true},
+	"zifencei": {2, 0, true},
+}
+
+// parseVersion parses a version such as "2", "2p0" or "".
+func parseVersion(s string) riscvVersion {
+	if s == "" {
+		return riscvVersion{}
+	}
+	major, minor := s, "0"
+	if i := strings.IndexByte(s, 'p'); i >= 0 {
+		major, minor = s[:i], s[i+1:]
+	}
+	v := riscvVersion{known: true}
+	v.major, _ = strconv.Atoi(major)
+	v.minor, _ = strconv.Atoi(minor)
+	return v
+}
+
+// add adds the extension name to isa, keeping the highest version.
+func (isa *riscvISA) add(name string, v riscvVersion) {
+	if !v.known {
+		v = defaultVersions[name]
+	}
+	if old, ok := isa.exts[name]; !ok || old.less(v) {
+		isa.exts[name] = v
+	}
+}
+
+// merge adds the extensions of other to isa.
+func (isa *riscvISA) merge(other *riscvISA) error {
+	if other.xlen != isa.xlen {
+		return fmt.Errorf("ISA rv%s is incompatible with rv%s", other.xlen, isa.xlen)
+	}
+	_, i1 := isa.exts["i"]
+	_, i2 := other.exts["i"]
+	if i1 != i2 {
+		return fmt.Errorf("cannot link RV%sE and RV%sI code", isa.xlen, isa.xlen)
+	}
+	for name, v := range other.exts {
+		isa.add(name, v)
+	}
+	return nil
+}
+
+// riscvExtOrder is the canonical order of the single-letter extensions,
+// which also orders the Z extensions by their second letter.
+const riscvExtOrder = "iemafdqlcbkjtpvnh"
+
+// extRank returns the sort key of the extension name in the canonical
+// order of the ISA string: the single-letter extensions come first, then
+// the Z, S and X extensions.
+func extRank(name string) (int, int) {
+	order := func(c byte) int {
+		if i := strings.IndexByte(riscvExtOrder, c); i >= 0 {
+			return i
+		}
+		return len(riscvExtOrder) + int(c)
+	}
+	if len(name) == 1 {
+		return 0, order(name[0])
+	}
+	switch name[0] {
+	case 'z':
+		return 1, order(name[1])
+	case 's':
+		return 2, 0
+	}
+	return 3, 0
+}
+
+// String returns the ISA string of isa, in canonical order. With
+// versions false, it leaves out the versions of the extensions.
+func (isa *riscvISA) String(versions bool) string {
+	names := make([]string, 0, len(isa.exts))
+	for name := range isa.exts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, oi := extRank(names[i])
+		cj, oj := extRank(names[j])
+		if ci != cj {
+			return ci < cj
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	var b strings.Builder
+	b.WriteString("rv" + isa.xlen)
+	for i, name := range names {
+		v := isa.exts[name]
+		if i > 0 && (versions || len(name) > 1) {
+			b.WriteByte('_')
+		}
+		b.WriteString(name)
+		if versions && v.known {
+			fmt.Fprintf(&b, "%dp%d", v.major, v.minor)
+		}
+	}
+	return b.String()
+}
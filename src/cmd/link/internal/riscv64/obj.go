@@ -20,6 +20,7 @@ func Init() (*sys.Arch, ld.Arch) {
 		Dwarfregsp: dwarfRegSP,
 		Dwarfreglr: dwarfRegLR,
 
+		Adddynrel:        adddynrel,
 		Archinit:         archinit,
 		Archreloc:        archreloc,
 		Archrelocvariant: archrelocvariant,
@@ -39,7 +40,7 @@ func Init() (*sys.Arch, ld.Arch) {
 		GenSymsLate: genSymsLate,
 		Machoreloc1: machoreloc1,
 
-		Linuxdynld: "/lib/ld.so.1",
+		Linuxdynld: "/lib/ld-linux-riscv64-lp64d.so.1",
 
 		Freebsddynld:   "XXX",
 		Netbsddynld:    "XXX",
@@ -94,6 +94,7 @@ const (
 	SINITARR
 	SDATA
 	SXCOFFTOC
+	STLSDATA
 	SBSS
 	SNOPTRBSS
 	SLIBFUZZER_EXTRA_COUNTER
@@ -42,34 +42,35 @@ func _() {
 	_ = x[SINITARR-31]
 	_ = x[SDATA-32]
 	_ = x[SXCOFFTOC-33]
-	_ = x[SBSS-34]
-	_ = x[SNOPTRBSS-35]
-	_ = x[SLIBFUZZER_EXTRA_COUNTER-36]
-	_ = x[STLSBSS-37]
-	_ = x[SXREF-38]
-	_ = x[SMACHOSYMSTR-39]
-	_ = x[SMACHOSYMTAB-40]
-	_ = x[SMACHOINDIRECTPLT-41]
-	_ = x[SMACHOINDIRECTGOT-42]
-	_ = x[SFILEPATH-43]
-	_ = x[SDYNIMPORT-44]
-	_ = x[SHOSTOBJ-45]
-	_ = x[SUNDEFEXT-46]
-	_ = x[SDWARFSECT-47]
-	_ = x[SDWARFCUINFO-48]
-	_ = x[SDWARFCONST-49]
-	_ = x[SDWARFFCN-50]
-	_ = x[SDWARFABSFCN-51]
-	_ = x[SDWARFTYPE-52]
-	_ = x[SDWARFVAR-53]
-	_ = x[SDWARFRANGE-54]
-	_ = x[SDWARFLOC-55]
-	_ = x[SDWARFLINES-56]
+	_ = x[STLSDATA-34]
+	_ = x[SBSS-35]
+	_ = x[SNOPTRBSS-36]
+	_ = x[SLIBFUZZER_EXTRA_COUNTER-37]
+	_ = x[STLSBSS-38]
+	_ = x[SXREF-39]
+	_ = x[SMACHOSYMSTR-40]
+	_ = x[SMACHOSYMTAB-41]
+	_ = x[SMACHOINDIRECTPLT-42]
+	_ = x[SMACHOINDIRECTGOT-43]
+	_ = x[SFILEPATH-44]
+	_ = x[SDYNIMPORT-45]
+	_ = x[SHOSTOBJ-46]
+	_ = x[SUNDEFEXT-47]
+	_ = x[SDWARFSECT-48]
+	_ = x[SDWARFCUINFO-49]
+	_ = x[SDWARFCONST-50]
+	_ = x[SDWARFFCN-51]
+	_ = x[SDWARFABSFCN-52]
+	_ = x[SDWARFTYPE-53]
+	_ = x[SDWARFVAR-54]
+	_ = x[SDWARFRANGE-55]
+	_ = x[SDWARFLOC-56]
+	_ = x[SDWARFLINES-57]
 }
 
-const _SymKind_name = "SxxxSTEXTSELFRXSECTSMACHOPLTSTYPESSTRINGSGOSTRINGSGOFUNCSGCBITSSRODATASFUNCTABSELFROSECTSTYPERELROSSTRINGRELROSGOSTRINGRELROSGOFUNCRELROSGCBITSRELROSRODATARELROSFUNCTABRELROSTYPELINKSITABLINKSSYMTABSPCLNTABSFirstWritableSBUILDINFOSELFSECTSMACHOSMACHOGOTSWINDOWSSELFGOTSNOPTRDATASINITARRSDATASXCOFFTOCSBSSSNOPTRBSSSLIBFUZZER_EXTRA_COUNTERSTLSBSSSXREFSMACHOSYMSTRSMACHOSYMTABSMACHOINDIRECTPLTSMACHOINDIRECTGOTSFILEPATHSDYNIMPORTSHOSTOBJSUNDEFEXTSDWARFSECTSDWARFCUINFOSDWARFCONSTSDWARFFCNSDWARFABSFCNSDWARFTYPESDWARFVARSDWARFRANGESDWARFLOCSDWARFLINES"
+const _SymKind_name = "SxxxSTEXTSELFRXSECTSMACHOPLTSTYPESSTRINGSGOSTRINGSGOFUNCSGCBITSSRODATASFUNCTABSELFROSECTSTYPERELROSSTRINGRELROSGOSTRINGRELROSGOFUNCRELROSGCBITSRELROSRODATARELROSFUNCTABRELROSTYPELINKSITABLINKSSYMTABSPCLNTABSFirstWritableSBUILDINFOSELFSECTSMACHOSMACHOGOTSWINDOWSSELFGOTSNOPTRDATASINITARRSDATASXCOFFTOCSTLSDATASBSSSNOPTRBSSSLIBFUZZER_EXTRA_COUNTERSTLSBSSSXREFSMACHOSYMSTRSMACHOSYMTABSMACHOINDIRECTPLTSMACHOINDIRECTGOTSFILEPATHSDYNIMPORTSHOSTOBJSUNDEFEXTSDWARFSECTSDWARFCUINFOSDWARFCONSTSDWARFFCNSDWARFABSFCNSDWARFTYPESDWARFVARSDWARFRANGESDWARFLOCSDWARFLINES"
 
-var _SymKind_index = [...]uint16{0, 4, 9, 19, 28, 33, 40, 49, 56, 63, 70, 78, 88, 98, 110, 124, 136, 148, 160, 173, 182, 191, 198, 206, 220, 230, 238, 244, 253, 261, 268, 278, 286, 291, 300, 304, 313, 337, 344, 349, 361, 373, 390, 407, 416, 426, 434, 443, 453, 465, 476, 485, 497, 507, 516, 527, 536, 547}
+var _SymKind_index = [...]uint16{0, 4, 9, 19, 28, 33, 40, 49, 56, 63, 70, 78, 88, 98, 110, 124, 136, 148, 160, 173, 182, 191, 198, 206, 220, 230, 238, 244, 253, 261, 268, 278, 286, 291, 300, 308, 312, 321, 345, 352, 357, 369, 381, 398, 415, 424, 434, 442, 451, 461, 473, 484, 493, 505, 515, 524, 535, 544, 555}
 
 func (i SymKind) String() string {
 	if i >= SymKind(len(_SymKind_index)-1) {
@@ -5,10 +5,18 @@
 package main
 
 import (
+	"archive/zip"
 	"bufio"
 	"bytes"
 	"cmd/internal/sys"
+	"crypto/sha256"
+	"debug/elf"
 	"debug/macho"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"internal/profile"
 	"internal/testenv"
 	"io/ioutil"
 	"os"
@@ -16,6 +24,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -158,9 +168,10 @@ TEXT ·x(SB),0,$0
 	}
 	out = regexp.MustCompile("(?m)^#.*\n").ReplaceAll(out, nil)
 	got := string(out)
-	want := `main.x: relocation target zero not defined
-main.x: relocation target zero not defined
-main.x: relocation target main.zero not defined
+	want := `undefined symbols:
+	main:
+		main.zero, referenced by main.x
+		zero, referenced by main.x
 `
 	if want != got {
 		t.Fatalf("want:\n%sgot:\n%s", want, got)
@@ -248,12 +259,118 @@ void foo() {
 	if err == nil {
 		t.Fatalf("expected link to fail, but it succeeded")
 	}
-	re := regexp.MustCompile(`(?m)^main\(.*text\): relocation target undefined not defined$`)
+	re := regexp.MustCompile(`(?m)^\t\tundefined, referenced by main\(.*text\)$`)
 	if !re.Match(out) {
 		t.Fatalf("got:\n%q\nwant:\n%s", out, re)
 	}
 }
 
+// TestUndefinedHostSymbols checks that all the symbols a host object
+// refers to but nothing defines are reported at once, up to the
+// -errorlimit.
+func TestUndefinedHostSymbols(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+	testenv.MustInternalLink(t)
+
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le":
+		t.Skipf("Skipping on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	if runtime.GOOS == "aix" ||
+		runtime.GOOS == "windows" && runtime.GOARCH == "arm64" {
+		t.Skipf("Skipping on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(name string, args ...string) string {
+		cmd := exec.Command(name, args...)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("'%s %s' failed: %v, output: %s", name, strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	runGo := func(args ...string) string {
+		return run(testenv.GoToolPath(t), args...)
+	}
+
+	const n = 50
+	var c strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&c, "void missing%d();\n", i)
+	}
+	c.WriteString("\nvoid foo() {\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&c, "\tmissing%d();\n", i)
+	}
+	c.WriteString("}\n")
+
+	write("main.go", `package main
+func main() {
+        x()
+}
+func x()
+`)
+	write("x.s", `
+TEXT ·x(SB),0,$0
+        CALL foo(SB)
+        RET
+`)
+	write("x.c", c.String())
+
+	cc := strings.TrimSpace(runGo("env", "CC"))
+	cflags := strings.Fields(runGo("env", "GOGCCFLAGS"))
+
+	runGo("tool", "asm", "-gensymabis", "-o", "symabis", "x.s")
+	runGo("tool", "compile", "-symabis", "symabis", "-p", "main", "-o", "x1.o", "main.go")
+	runGo("tool", "asm", "-o", "x2.o", "x.s")
+	run(cc, append(cflags, "-c", "-o", "x3.o", "x.c")...)
+	runGo("tool", "pack", "c", "x.a", "x1.o", "x2.o", "x3.o")
+
+	link := func(flags ...string) string {
+		args := append([]string{"tool", "link", "-linkmode=internal"}, flags...)
+		cmd := exec.Command(testenv.GoToolPath(t), append(args, "x.a")...)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("expected link %v to fail, but it succeeded", flags)
+		}
+		return string(out)
+	}
+	missing := regexp.MustCompile(`(?m)^\t\tmissing\d+, referenced by main\(.*text\)$`)
+
+	out := link()
+	if got := strings.Count(out, "undefined symbols:"); got != 1 {
+		t.Errorf("got %d reports of undefined symbols, want 1:\n%s", got, out)
+	}
+	if got := len(missing.FindAllString(out, -1)); got != n {
+		t.Errorf("got %d undefined symbols listed, want %d:\n%s", got, n, out)
+	}
+	if strings.Contains(out, "too many errors") {
+		t.Errorf("link stopped early:\n%s", out)
+	}
+
+	out = link("-errorlimit=5")
+	if got := len(missing.FindAllString(out, -1)); got != 5 {
+		t.Errorf("with -errorlimit=5, got %d undefined symbols listed, want 5:\n%s", got, out)
+	}
+	if want := fmt.Sprintf("\tand %d more\n", n-5); !strings.Contains(out, want) {
+		t.Errorf("with -errorlimit=5, output does not contain %q:\n%s", want, out)
+	}
+}
+
 func TestBuildForTvOS(t *testing.T) {
 	testenv.MustHaveCGO(t)
 	testenv.MustHaveGoBuild(t)
@@ -399,6 +516,65 @@ func TestMachOBuildVersion(t *testing.T) {
 	}
 }
 
+func TestMachODataConst(t *testing.T) {
+	// The GOT, and the data only written when the program is loaded,
+	// are put in __DATA_CONST, which dyld makes read-only after binding.
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+
+	src := filepath.Join(tmpdir, "main.go")
+	err := ioutil.WriteFile(src, []byte(testMachOBuildVersionSrc), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// darwin/amd64 executables have no other relro data.
+	for _, goarch := range []string{"amd64", "arm64"} {
+		for _, mode := range []string{"exe", "pie"} {
+			exe := filepath.Join(tmpdir, goarch+"-"+mode)
+			cmd := exec.Command(testenv.GoToolPath(t), "build", "-buildmode="+mode, "-ldflags=-linkmode=internal", "-o", exe, src)
+			cmd.Env = append(os.Environ(),
+				"CGO_ENABLED=0",
+				"GOOS=darwin",
+				"GOARCH="+goarch,
+			)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v: %v:\n%s", cmd.Args, err, out)
+			}
+			f, err := macho.Open(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			const SG_READ_ONLY = 0x10
+			seg := f.Segment("__DATA_CONST")
+			if seg == nil {
+				t.Errorf("%s/%s: no __DATA_CONST segment", goarch, mode)
+				continue
+			}
+			if seg.Flag&SG_READ_ONLY == 0 {
+				t.Errorf("%s/%s: __DATA_CONST flags %#x, want SG_READ_ONLY", goarch, mode, seg.Flag)
+			}
+			want := []string{"__nl_symbol_ptr"}
+			if goarch == "arm64" || mode == "pie" {
+				want = append(want, "__typelink", "__itablink")
+			}
+			for _, name := range want {
+				sect := f.Section(name)
+				if sect == nil {
+					t.Errorf("%s/%s: no %s section", goarch, mode, name)
+				} else if sect.Seg != "__DATA_CONST" {
+					t.Errorf("%s/%s: %s section in %s, want __DATA_CONST", goarch, mode, name, sect.Seg)
+				}
+			}
+		}
+	}
+}
+
 const Issue34788src = `
 
 package blah
@@ -643,7 +819,7 @@ func TestTrampoline(t *testing.T) {
 	// threshold for trampoline generation, and essentially all cross-package
 	// calls will use trampolines.
 	switch runtime.GOARCH {
-	case "arm", "arm64", "ppc64", "ppc64le":
+	case "arm", "arm64", "ppc64", "ppc64le", "riscv64":
 	default:
 		t.Skipf("trampoline insertion is not implemented on %s", runtime.GOARCH)
 	}
@@ -694,7 +870,7 @@ func TestTrampolineCgo(t *testing.T) {
 	// threshold for trampoline generation, and essentially all cross-package
 	// calls will use trampolines.
 	switch runtime.GOARCH {
-	case "arm", "arm64", "ppc64", "ppc64le":
+	case "arm", "arm64", "ppc64", "ppc64le", "riscv64":
 	default:
 		t.Skipf("trampoline insertion is not implemented on %s", runtime.GOARCH)
 	}
@@ -747,6 +923,121 @@ func TestTrampolineCgo(t *testing.T) {
 	}
 }
 
+func TestTrampolineRISCV64(t *testing.T) {
+	// Test that the calls of a linux/riscv64 program, cross-linked with
+	// -debugtramp=2, reach their targets through the trampolines, which
+	// cannot be run here.
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "hello.go")
+	if err := ioutil.WriteFile(src, []byte(testTrampSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(tmpdir, "hello.exe")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-ldflags=-debugtramp=2", "-o", exe, src)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=riscv64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+
+	ef, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	text := ef.Section(".text")
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms, err := ef.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := make(map[uint64]string)
+	addrs := make(map[string]uint64)
+	var duffs []elf.Symbol
+	for _, s := range syms {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC {
+			funcs[s.Value] = s.Name
+			addrs[s.Name] = s.Value
+		}
+		if s.Name == "runtime.duffzero" || s.Name == "runtime.duffcopy" {
+			duffs = append(duffs, s)
+		}
+	}
+	// inDuff reports whether addr is in duffzero or duffcopy, whose
+	// calls enter them in the middle.
+	inDuff := func(addr uint64) bool {
+		for _, s := range duffs {
+			if s.Value <= addr && addr < s.Value+s.Size {
+				return true
+			}
+		}
+		return false
+	}
+	insn := func(addr uint64) uint32 {
+		return binary.LittleEndian.Uint32(data[addr-text.Addr:])
+	}
+
+	// Each trampoline is an AUIPC and JALR pair to the function it
+	// is named after, at the offset it is named after, if any.
+	trampRE := regexp.MustCompile(`^(.*?)(\+[0-9a-f]+)?-tramp[0-9]+$`)
+	ntramps := 0
+	for addr, name := range funcs {
+		m := trampRE.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		ntramps++
+		auipc, jalr := insn(addr), insn(addr+4)
+		if auipc&0x7f != 0x17 || jalr&0x7f != 0x67 {
+			t.Errorf("%s is %#08x %#08x, want AUIPC and JALR", name, auipc, jalr)
+			continue
+		}
+		target := addr + uint64(int64(int32(auipc&0xfffff000))) + uint64(int64(int32(jalr)>>20))
+		want, ok := addrs[m[1]]
+		if m[2] != "" {
+			off, _ := strconv.ParseUint(m[2][1:], 16, 64)
+			want += off
+		}
+		if !ok || target != want {
+			t.Errorf("%s jumps to %#x, want %s%s", name, target, m[1], m[2])
+		}
+	}
+	if ntramps == 0 {
+		t.Fatal("no trampolines")
+	}
+
+	// Each call (JAL with rd=ra) is to the start of a function, or into
+	// duffzero or duffcopy, and some of them to trampolines.
+	ntrampcalls := 0
+	for addr := text.Addr; addr+4 <= text.Addr+text.Size; addr += 4 {
+		i := insn(addr)
+		if i&0x7f != 0x6f || i>>7&0x1f != 1 {
+			continue
+		}
+		imm := int64(int32(i&0x80000000)>>11) | int64(i&0xff000) | int64(i>>9&0x800) | int64(i>>20&0x7fe)
+		target := addr + uint64(imm)
+		name, ok := funcs[target]
+		if !ok {
+			if !inDuff(target) {
+				t.Errorf("call at %#x to %#x is not to a function", addr, target)
+			}
+			continue
+		}
+		if trampRE.MatchString(name) {
+			ntrampcalls++
+		}
+	}
+	if ntrampcalls == 0 {
+		t.Error("no calls through trampolines")
+	}
+}
+
 func TestIndexMismatch(t *testing.T) {
 	// Test that index mismatch will cause a link-time error (not run-time error).
 	// This shouldn't happen with "go build". We invoke the compiler and the linker
@@ -1041,3 +1332,1927 @@ func TestLargeReloc(t *testing.T) {
 		}
 	}
 }
+
+const testWholeArchiveMain = `package main
+
+/*
+#cgo LDFLAGS: ${SRCDIR}/libreg.a
+
+int get(void);
+int registered(void);
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.get(), C.registered())
+}
+`
+
+const testWholeArchiveGet = `
+int reg;
+
+int get(void) { return 1; }
+int registered(void) { return reg; }
+`
+
+// The register member of the archive is never referenced: it only
+// has a constructor.
+const testWholeArchiveRegister = `
+extern int reg;
+
+__attribute__((constructor)) static void doregister(void) { reg = 42; }
+`
+
+func TestWholeArchive(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on %s", runtime.GOOS)
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(name string, args ...string) string {
+		cmd := exec.Command(name, args...)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("'%s %s' failed: %v, output: %s", name, strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	runGo := func(args ...string) string {
+		return run(testenv.GoToolPath(t), args...)
+	}
+
+	write("go.mod", "module wholearchive\n")
+	write("main.go", testWholeArchiveMain)
+	write("get.c", testWholeArchiveGet)
+	write("register.c", testWholeArchiveRegister)
+
+	// Build the archive outside of the package directory, so that
+	// the go command does not compile the C files into the package.
+	cc := strings.Fields(runGo("env", "CC"))
+	cflags := strings.Fields(runGo("env", "GOGCCFLAGS"))
+	for _, f := range []string{"get", "register"} {
+		run(cc[0], append(append(cc[1:], cflags...), "-c", "-o", f+".o", f+".c")...)
+		if err := os.Remove(filepath.Join(tmpdir, f+".c")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ar := strings.TrimSpace(runGo("env", "AR"))
+	if ar == "" {
+		ar = "ar"
+	}
+	run(ar, "rcs", "libreg.a", "get.o", "register.o")
+
+	build := func(ldflags string) string {
+		exe := filepath.Join(tmpdir, "main.exe")
+		runGo("build", "-o", exe, "-ldflags="+ldflags)
+		return strings.TrimSpace(run(exe))
+	}
+
+	// The register member is only linked in with -wholearchive.
+	if got, want := build("-linkmode=external"), "1 0"; got != want {
+		t.Errorf("external linking: got %q, want %q", got, want)
+	}
+	if got, want := build("-linkmode=external -wholearchive=libreg.a"), "1 42"; got != want {
+		t.Errorf("external linking with -wholearchive: got %q, want %q", got, want)
+	}
+
+	// The internal linker does not load archives named in cgo
+	// LDFLAGS unless they match -wholearchive.
+	exe := filepath.Join(tmpdir, "internal.exe")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=internal")
+	cmd.Dir = tmpdir
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("internal linking without -wholearchive succeeded unexpectedly")
+	} else if !strings.Contains(string(out), "get") {
+		t.Errorf("unexpected internal linking error:\n%s", out)
+	}
+	runGo("build", "-o", exe, "-ldflags=-linkmode=internal -wholearchive=lib*.a")
+	nm := runGo("tool", "nm", exe)
+	if !strings.Contains(nm, " doregister") {
+		t.Errorf("internal linking with -wholearchive: doregister not found in the binary")
+	}
+}
+
+const testThinArchiveMain = `package main
+
+/*
+#cgo LDFLAGS: -L${SRCDIR}/lib -lthin
+int thin_a(void);
+int thin_b(void);
+int thin_c(void);
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.thin_a(), C.thin_b(), C.thin_c())
+}
+`
+
+func TestThinArchive(t *testing.T) {
+	// Check that host archives created with ar T, whose members are
+	// stored as paths, can be linked internally, both in full and
+	// through their symbol map.
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on %s", runtime.GOOS)
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(name string, args ...string) string {
+		cmd := exec.Command(name, args...)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("'%s %s' failed: %v, output: %s", name, strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	runGo := func(args ...string) string {
+		return run(testenv.GoToolPath(t), args...)
+	}
+
+	for _, dir := range []string{"csrc/sub", "lib"} {
+		if err := os.MkdirAll(filepath.Join(tmpdir, dir), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module thinarchive\n")
+	write("main.go", testThinArchiveMain)
+	write("csrc/a.c", "int thin_a(void) { return 1; }\n")
+	write("csrc/sub/b.c", "int thin_b(void) { return 2; }\n")
+	write("csrc/c.c", "int thin_c(void) { return 3; }\n")
+
+	// Build the objects outside of the package directory, so that
+	// the go command does not compile the C files into the package.
+	cc := strings.Fields(runGo("env", "CC"))
+	cflags := strings.Fields(runGo("env", "GOGCCFLAGS"))
+	for _, f := range []string{"csrc/a", "csrc/sub/b", "csrc/c"} {
+		run(cc[0], append(append(cc[1:], cflags...), "-c", "-o", f+".o", f+".c")...)
+	}
+	ar := strings.TrimSpace(runGo("env", "AR"))
+	if ar == "" {
+		ar = "ar"
+	}
+	// libthin.a refers to a.o by both a relative and an absolute
+	// path, to b.o through a nested thin archive, which ar flattens,
+	// and to c.o through a regular archive.
+	run(ar, "rcT", "csrc/sub/libinner.a", "csrc/sub/b.o")
+	run(ar, "rc", "csrc/libreg.a", "csrc/c.o")
+	run(ar, "rcT", "lib/libthin.a", "csrc/a.o", filepath.Join(tmpdir, "csrc/a.o"), "csrc/sub/libinner.a", "csrc/libreg.a")
+
+	for _, test := range []struct {
+		name    string
+		ldflags string
+	}{
+		{"external", "-linkmode=external"},
+		{"internal-wholearchive", "-linkmode=internal -wholearchive=libthin.a"},
+		{"internal-armap", "-linkmode=internal -libgcc=" + filepath.Join(tmpdir, "lib/libthin.a")},
+	} {
+		exe := filepath.Join(tmpdir, test.name+".exe")
+		runGo("build", "-o", exe, "-ldflags="+test.ldflags)
+		if got, want := strings.TrimSpace(run(exe)), "1 2 3"; got != want {
+			t.Errorf("%s: got %q, want %q", test.name, got, want)
+		}
+	}
+}
+
+const testGuardModuledataSrc = `
+package main
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+//go:linkname firstmoduledata runtime.firstmoduledata
+var firstmoduledata uintptr
+
+func main() {
+	fmt.Println("ok")
+	if len(os.Args) > 1 {
+		fmt.Printf("writing to %p\n", unsafe.Pointer(&firstmoduledata))
+		firstmoduledata = 0
+		fmt.Println("wrote moduledata")
+	}
+}
+`
+
+// buildGuardModuledata builds testGuardModuledataSrc with the given
+// build mode flag and linker flags.
+func buildGuardModuledata(t *testing.T, buildmode, ldflags string) string {
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(testGuardModuledataSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(tmpdir, "x")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", buildmode, "-o", exe, "-ldflags="+ldflags, src)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("linking with %s %s failed: %v\n%s", buildmode, ldflags, err, out)
+	}
+	return exe
+}
+
+func TestGuardModuledata(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skipf("-guard-moduledata is not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	t.Parallel()
+
+	linkmodes := []string{"internal"}
+	if testenv.HasCGO() {
+		linkmodes = append(linkmodes, "external")
+	}
+	for _, linkmode := range linkmodes {
+		for _, buildmode := range []string{"exe", "pie"} {
+			exe := buildGuardModuledata(t, "-buildmode="+buildmode, "-guard-moduledata -linkmode="+linkmode)
+			out, err := exec.Command(exe).CombinedOutput()
+			if err != nil || string(out) != "ok\n" {
+				t.Errorf("%s linking, %s: program failed: %v\n%s", linkmode, buildmode, err, out)
+			}
+			checkGuardModuledataLayout(t, exe)
+		}
+	}
+}
+
+// checkGuardModuledataLayout checks that the moduledata and the tables
+// it points to are read-only in exe: in a segment that is not
+// writable, or in the relro segment, which the dynamic linker makes
+// read-only once it has relocated it.
+func checkGuardModuledataLayout(t *testing.T, exe string) {
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnly := func(addr uint64) bool {
+		for _, p := range f.Progs {
+			if addr < p.Vaddr || addr >= p.Vaddr+p.Memsz {
+				continue
+			}
+			if p.Type == elf.PT_GNU_RELRO || p.Type == elf.PT_LOAD && p.Flags&elf.PF_W == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	want := map[string]bool{
+		"runtime.firstmoduledata": true,
+		"runtime.pclntab":         true,
+		"runtime.typelink":        true,
+		"runtime.itablink":        true,
+	}
+	for _, s := range syms {
+		if !want[s.Name] {
+			continue
+		}
+		delete(want, s.Name)
+		if !readOnly(s.Value) {
+			t.Errorf("%s: %s (%#x) is writable", exe, s.Name, s.Value)
+		}
+	}
+	for name := range want {
+		t.Errorf("%s: symbol %s not found", exe, name)
+	}
+}
+
+// TestGuardModuledataWrite checks that writing to firstmoduledata
+// after the runtime is initialized faults at the address written with
+// -guard-moduledata, and only with it.
+func TestGuardModuledataWrite(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skipf("-guard-moduledata is not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	t.Parallel()
+
+	for _, buildmode := range []string{"exe", "pie"} {
+		exe := buildGuardModuledata(t, "-buildmode="+buildmode, "-guard-moduledata")
+		out, err := exec.Command(exe, "write").CombinedOutput()
+		if err == nil || strings.Contains(string(out), "wrote moduledata") {
+			t.Fatalf("%s: write to firstmoduledata did not fault: %v\n%s", buildmode, err, out)
+		}
+		m := regexp.MustCompile(`writing to (0x[0-9a-f]+)\n`).FindSubmatch(out)
+		if m == nil || !bytes.Contains(out, []byte("unexpected fault address "+string(m[1])+"\n")) {
+			t.Errorf("%s: write to firstmoduledata faulted, but not at its address:\n%s", buildmode, out)
+		}
+	}
+
+	exe := buildGuardModuledata(t, "-buildmode=exe", "")
+	out, err := exec.Command(exe, "write").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "wrote moduledata") {
+		t.Errorf("write to firstmoduledata without -guard-moduledata failed: %v\n%s", err, out)
+	}
+}
+
+func TestExperimentMismatch(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command(testenv.GoToolPath(t), args...)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", cmd, err, out)
+		}
+		return out
+	}
+	write("p.go", "package p\n\nfunc F() int { return 42 }\n")
+	write("main.go", "package main\n\nimport \"p\"\n\nfunc main() { println(p.F()) }\n")
+	run("tool", "compile", "-p", "p", "-o", "p.a", "p.go")
+
+	// Doctor the object header of package p to claim it was built
+	// with an additional experiment.
+	dir := filepath.Join(tmpdir, "x")
+	if err := os.Mkdir(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(testenv.GoToolPath(t), "tool", "pack", "x", filepath.Join(tmpdir, "p.a"))
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", cmd, err, out)
+	}
+	obj := filepath.Join(dir, "_go_.o")
+	data, err := ioutil.ReadFile(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 || !bytes.Contains(data[:i], []byte(" X:")) {
+		t.Fatalf("unexpected object header %q", data[:i])
+	}
+	exp := "fieldtrack"
+	if !bytes.HasSuffix(data[:i], []byte(" X:")) {
+		exp = "," + exp
+	}
+	data = append(append(append([]byte(nil), data[:i]...), exp...), data[i:]...)
+	if err := ioutil.WriteFile(obj, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tmpdir, "p.a")); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command(testenv.GoToolPath(t), "tool", "pack", "c", filepath.Join(tmpdir, "p.a"), "__.PKGDEF", "_go_.o")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", cmd, err, out)
+	}
+
+	run("tool", "compile", "-I", ".", "-o", "main.o", "main.go")
+
+	cmd = exec.Command(testenv.GoToolPath(t), "tool", "link", "-L", ".", "-o", "main.exe", "main.o")
+	cmd.Dir = tmpdir
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("link succeeded unexpectedly")
+	}
+	if !regexp.MustCompile(`(?m)^\s+p\s+fieldtrack$`).Match(out) {
+		t.Errorf("link error does not list package p with experiment fieldtrack:\n%s", out)
+	}
+
+	run("tool", "link", "-ignore-experiment-mismatch", "-L", ".", "-o", "main.exe", "main.o")
+}
+
+func TestExternalLinkSymtab(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	switch runtime.GOOS {
+	case "android", "dragonfly", "freebsd", "illumos", "linux", "netbsd", "openbsd", "solaris":
+	default:
+		t.Skipf("not an ELF platform: %s", runtime.GOOS)
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(testExternalLinkSymtabSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// nm returns the text symbols of the program built with the
+	// given link mode, mapped to their size and type.
+	nm := func(linkmode string) map[string]string {
+		exe := filepath.Join(tmpdir, "x-"+linkmode)
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode="+linkmode, src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s linking failed: %v\n%s", linkmode, err, out)
+		}
+		out, err := exec.Command(testenv.GoToolPath(t), "tool", "nm", "-size", exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("nm %s: %v\n%s", exe, err, out)
+		}
+		syms := make(map[string]string)
+		for _, line := range strings.Split(string(out), "\n") {
+			f := strings.Fields(line)
+			if len(f) != 4 || (f[2] != "T" && f[2] != "t") {
+				continue
+			}
+			// The symbol binding differs, as Go symbols are
+			// local when linking externally.
+			syms[f[3]] = f[1] + " " + strings.ToLower(f[2])
+		}
+		return syms
+	}
+
+	internal := nm("internal")
+	external := nm("external")
+	for name, want := range internal {
+		if strings.HasPrefix(name, "_rt0_") {
+			// The host linker provides the entry point.
+			continue
+		}
+		if got, ok := external[name]; !ok {
+			t.Errorf("symbol %s missing when linking externally", name)
+		} else if got != want {
+			t.Errorf("symbol %s: size and type %q when linking externally, %q when linking internally", name, got, want)
+		}
+	}
+}
+
+const testExternalLinkSymtabSrc = `
+package main
+
+import "fmt"
+
+type T struct{ x int }
+
+//go:noinline
+func (t *T) get() int { return t.x }
+
+func main() {
+	t := &T{42}
+	fmt.Println(t.get())
+}
+`
+
+func TestExtlinkCheck(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skip("test uses a GNU ld linker script")
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nfunc main() { println(\"ok\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// Have the host linker discard the build information.
+	script := filepath.Join(tmpdir, "discard.ld")
+	if err := ioutil.WriteFile(script, []byte("SECTIONS { /DISCARD/ : { *(.go.buildinfo) } } INSERT AFTER .text;\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	build := func(ldflags string) (string, []byte, error) {
+		n++
+		exe := filepath.Join(tmpdir, fmt.Sprintf("x%d.exe", n))
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=external "+ldflags, src)
+		out, err := cmd.CombinedOutput()
+		return exe, out, err
+	}
+
+	if _, out, err := build(""); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+
+	// Discarding the local symbols leaves the tables in place, and
+	// must not be reported.
+	exe, out, err := build("-extldflags=-Wl,--discard-all")
+	if err != nil {
+		t.Fatalf("build with --discard-all failed: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(exe).CombinedOutput(); err != nil {
+		t.Errorf("%s: %v\n%s", exe, err, out)
+	}
+	if out, err := exec.Command(testenv.GoToolPath(t), "version", "-m", exe).CombinedOutput(); err != nil {
+		t.Errorf("go version -m %s: %v\n%s", exe, err, out)
+	}
+
+	exe, out, err = build("-extldflags=-Wl,-T," + script)
+	if err == nil {
+		t.Fatalf("build succeeded unexpectedly")
+	}
+	if !strings.Contains(string(out), "section .go.buildinfo is missing") {
+		if strings.Contains(string(out), "running ") {
+			t.Skipf("host linker does not support the linker script: %s", out)
+		}
+		t.Fatalf("unexpected build error: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(exe); err == nil {
+		t.Errorf("broken output %s was not removed", exe)
+	}
+
+	exe, out, err = build("-skip-extlink-check -extldflags=-Wl,-T," + script)
+	if err != nil {
+		t.Fatalf("build with -skip-extlink-check failed: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(exe).CombinedOutput(); err != nil {
+		t.Errorf("%s: %v\n%s", exe, err, out)
+	}
+}
+
+func TestSizeCheck(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module sizecheck\n",
+		"main.go":     "package main\n\nimport \"sizecheck/big\"\n\nfunc main() { println(big.Table[0]) }\n",
+		"big/big.go":  "package big\n\nvar Table = [100000]byte{1}\n",
+		"small/sm.go": "package small\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(tmpdir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 0
+	build := func(limits string) (string, []byte, error) {
+		n++
+		file := filepath.Join(tmpdir, fmt.Sprintf("limits%d", n))
+		if err := ioutil.WriteFile(file, []byte(limits), 0666); err != nil {
+			t.Fatal(err)
+		}
+		exe := filepath.Join(tmpdir, fmt.Sprintf("x%d.exe", n))
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-sizecheck="+file)
+		cmd.Dir = tmpdir
+		out, err := cmd.CombinedOutput()
+		return exe, out, err
+	}
+
+	tests := []struct {
+		limits string
+		want   []string // expected in the output, if the link fails
+	}{
+		{
+			limits: "total <= 1GB\nsection .noptrdata <= 1MiB\npackage sizecheck/... <= 1MB\npackage sizecheck/small <= 0\n",
+		},
+		{
+			limits: "# Too small for the runtime.\ntotal <= 100KB\n",
+			want:   []string{"limits2:2: total is ", "over the limit of 100KB", " runtime\n"},
+		},
+		{
+			limits: "section .noptrdata <= 64KiB\n",
+			want:   []string{"limits3:1: section .noptrdata is ", " sizecheck/big\n"},
+		},
+		{
+			limits: "package sizecheck/... <= 50000\npackage runtime <= 1GB\n",
+			want:   []string{"limits4:1: package sizecheck/... is ", " 100000 sizecheck/big.Table\n"},
+		},
+	}
+	for _, test := range tests {
+		exe, out, err := build(test.limits)
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("build with limits %q failed: %v\n%s", test.limits, err, out)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("build with limits %q succeeded unexpectedly", test.limits)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("build with limits %q: output does not contain %q:\n%s", test.limits, want, out)
+			}
+		}
+		if _, err := os.Stat(exe); err == nil {
+			t.Errorf("output %s was written", exe)
+		}
+	}
+}
+
+func TestSizeReport(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skip("test only works on linux")
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	files := map[string]string{
+		"go.mod":     "module sizereport\n",
+		"main.go":    "package main\n\nimport (\n\t\"os/user\"\n\t\"sizereport/big\"\n)\n\nfunc main() {\n\tuser.Current()\n\tprintln(big.Table[0])\n}\n",
+		"big/big.go": "package big\n\nvar Table = [100000]byte{1}\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(tmpdir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// os/user uses cgo, and linking internally loads its host objects
+	// and those of runtime/cgo.
+	exe := filepath.Join(tmpdir, "x.exe")
+	file := filepath.Join(tmpdir, "report.json")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-linkmode=internal -sizereport="+file)
+	cmd.Dir = tmpdir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		LinkMode string
+		Total    int64
+		Sections []struct {
+			Name     string
+			Size     int64
+			Padding  int64
+			NoBits   bool
+			Packages []struct {
+				Package string
+				Size    int64
+			}
+		}
+		Packages []struct {
+			Package  string
+			Size     int64
+			Sections []struct {
+				Section string
+				Size    int64
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.LinkMode != "internal" {
+		t.Errorf("linkmode is %q, want internal", report.LinkMode)
+	}
+
+	ef, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	elfSize := make(map[string]int64)
+	for _, sect := range ef.Sections {
+		if sect.Type == elf.SHT_NOBITS {
+			elfSize[sect.Name] += int64(sect.Size)
+		} else {
+			elfSize[sect.Name] += int64(sect.FileSize)
+		}
+	}
+
+	var total, pkgTotal int64
+	pkgSize := make(map[string]int64)
+	for _, s := range report.Sections {
+		if n, ok := elfSize[s.Name]; !ok {
+			t.Errorf("section %s is not in the output", s.Name)
+		} else if n != s.Size {
+			t.Errorf("section %s is %d bytes in the report, %d in the output", s.Name, s.Size, n)
+		}
+		if s.NoBits {
+			if len(s.Packages) > 0 || s.Padding != 0 {
+				t.Errorf("section %s without contents is attributed to packages", s.Name)
+			}
+			continue
+		}
+		total += s.Size
+		sum := s.Padding
+		for _, p := range s.Packages {
+			sum += p.Size
+			pkgSize[p.Package] += p.Size
+		}
+		if sum != s.Size {
+			t.Errorf("section %s: packages and padding sum to %d bytes, want %d", s.Name, sum, s.Size)
+		}
+		// Only alignment is left unattributed.
+		if s.Padding < 0 || s.Padding > s.Size/8+64 {
+			t.Errorf("section %s: padding of %d bytes out of %d", s.Name, s.Padding, s.Size)
+		}
+	}
+	if total != report.Total {
+		t.Errorf("total is %d, want the %d bytes of the sections with contents", report.Total, total)
+	}
+	for _, p := range report.Packages {
+		var sum int64
+		for _, s := range p.Sections {
+			sum += s.Size
+		}
+		if sum != p.Size || sum != pkgSize[p.Package] {
+			t.Errorf("package %s is %d bytes, %d by section, %d in the sections", p.Package, p.Size, sum, pkgSize[p.Package])
+		}
+		pkgTotal += p.Size
+	}
+	var padding int64
+	for _, s := range report.Sections {
+		padding += s.Padding
+	}
+	if pkgTotal+padding != report.Total {
+		t.Errorf("packages and padding sum to %d bytes, want %d", pkgTotal+padding, report.Total)
+	}
+
+	if pkgSize["sizereport/big"] < 100000 {
+		t.Errorf("package sizereport/big is %d bytes, want at least 100000", pkgSize["sizereport/big"])
+	}
+	for _, want := range []string{"runtime", "(linker)"} {
+		if pkgSize[want] == 0 {
+			t.Errorf("no bytes attributed to %s", want)
+		}
+	}
+	hostObj := false
+	for pkg := range pkgSize {
+		if strings.HasPrefix(pkg, "runtime/cgo(") && strings.HasSuffix(pkg, ".o)") {
+			hostObj = true
+		}
+	}
+	if !hostObj {
+		t.Errorf("no bytes attributed to the host objects of runtime/cgo")
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nfunc main() { println(\"hello\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	type event struct {
+		Name string
+		Cat  string
+		Ph   string
+		Ts   int64
+		Dur  int64
+		Args map[string]int64
+	}
+	// link links src with ldflags and returns the events of the
+	// -tracefile output.
+	link := func(t *testing.T, ldflags string, wantErr bool) []event {
+		exe := filepath.Join(tmpdir, "x.exe")
+		file := filepath.Join(tmpdir, "trace.json")
+		os.Remove(file)
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-tracefile="+file+" "+ldflags, src)
+		out, err := cmd.CombinedOutput()
+		if err != nil && !wantErr {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		if err == nil && wantErr {
+			t.Fatalf("%s succeeded, want failure", cmd)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var trace struct {
+			TraceEvents []event
+		}
+		if err := json.Unmarshal(data, &trace); err != nil {
+			t.Fatalf("%v\n%s", err, data)
+		}
+		return trace.TraceEvents
+	}
+	// checkPhases checks that the phases of events include want, in
+	// order, and end with last.
+	checkPhases := func(t *testing.T, events []event, want []string, last string) (phases map[string]event) {
+		phases = make(map[string]event)
+		var names []string
+		end := int64(0)
+		for _, e := range events {
+			if e.Ph != "X" || e.Dur < 0 {
+				t.Errorf("bad event %+v", e)
+			}
+			if _, ok := e.Args["alloc-B"]; !ok {
+				t.Errorf("event %s has no allocation numbers", e.Name)
+			}
+			if e.Cat != "phase" {
+				continue
+			}
+			if e.Ts < end {
+				t.Errorf("phase %s starts at %d, before the previous phase ends at %d", e.Name, e.Ts, end)
+			}
+			end = e.Ts + e.Dur
+			names = append(names, e.Name)
+			phases[e.Name] = e
+		}
+		i := 0
+		for _, name := range names {
+			if i < len(want) && name == want[i] {
+				i++
+			}
+		}
+		if i < len(want) {
+			t.Errorf("phases are %v, want %v in order", names, want)
+		}
+		if len(names) == 0 || names[len(names)-1] != last {
+			t.Errorf("phases are %v, want them to end with %s", names, last)
+		}
+		return phases
+	}
+
+	t.Run("internal", func(t *testing.T) {
+		events := link(t, "", false)
+		checkPhases(t, events, []string{"libinit", "loadlib", "deadcode", "dwarfGenerateDebugInfo", "textaddress", "dodata", "address", "Asmb", "Asmb2", "hostlink"}, "archive")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		// The link fails in the sizecheck phase, reading the
+		// -sizecheck file.
+		events := link(t, "-sizecheck="+filepath.Join(tmpdir, "missing"), true)
+		checkPhases(t, events, []string{"libinit", "loadlib", "deadcode", "dodata", "address"}, "sizecheck")
+	})
+
+	t.Run("external", func(t *testing.T) {
+		testenv.MustHaveCGO(t)
+		if runtime.GOOS != "linux" {
+			t.Skip("test only works on linux")
+		}
+		events := link(t, "-linkmode=external", false)
+		phases := checkPhases(t, events, []string{"loadlib", "Asmb2", "hostlink"}, "archive")
+		hostlink := phases["hostlink"]
+		found := false
+		for _, e := range events {
+			if e.Cat == "subphase" && strings.HasPrefix(e.Name, "run ") {
+				found = true
+				if e.Ts < hostlink.Ts || e.Ts+e.Dur > hostlink.Ts+hostlink.Dur {
+					t.Errorf("sub-phase %s at [%d, %d] is not within hostlink at [%d, %d]", e.Name, e.Ts, e.Ts+e.Dur, hostlink.Ts, hostlink.Ts+hostlink.Dur)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no sub-phase for the external linker in %+v", events)
+		}
+	})
+}
+
+func TestProfileFlags(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	// A program big enough for the CPU profile to have samples.
+	if err := ioutil.WriteFile(src, []byte("package main\n\nimport \"net/http\"\n\nfunc main() { http.ListenAndServe(\"\", nil) }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// link links src with the profile flags and ldflags, and returns
+	// the CPU profile and the memory profile, which is in the legacy
+	// text format, with the functions in comments.
+	link := func(t *testing.T, ldflags string, wantErr bool) (cpu *profile.Profile, mem []byte) {
+		exe := filepath.Join(tmpdir, "x.exe")
+		cpuFile := filepath.Join(tmpdir, "cpu.prof")
+		memFile := filepath.Join(tmpdir, "mem.prof")
+		os.Remove(cpuFile)
+		os.Remove(memFile)
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-cpuprofile="+cpuFile+" -memprofile="+memFile+" -memprofilerate=1 "+ldflags, src)
+		out, err := cmd.CombinedOutput()
+		if err != nil && !wantErr {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		if err == nil && wantErr {
+			t.Fatalf("%s succeeded, want failure", cmd)
+		}
+		parse := func(file string) ([]byte, *profile.Profile) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := profile.Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			return data, p
+		}
+		_, cpu = parse(cpuFile)
+		mem, _ = parse(memFile)
+		return cpu, mem
+	}
+	// hasLinkerFunc reports whether a sample of p is in a function of
+	// the ld package.
+	hasLinkerFunc := func(p *profile.Profile) bool {
+		for _, s := range p.Sample {
+			for _, loc := range s.Location {
+				for _, line := range loc.Line {
+					if line.Function != nil && strings.HasPrefix(line.Function.Name, "cmd/link/internal/ld.") {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+
+	t.Run("link", func(t *testing.T) {
+		cpu, mem := link(t, "", false)
+		if !hasLinkerFunc(cpu) {
+			t.Errorf("CPU profile has no samples in the linker:\n%v", cpu)
+		}
+		if !bytes.Contains(mem, []byte("cmd/link/internal/ld.")) {
+			t.Errorf("memory profile has no samples in the linker")
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		// The link fails with Exitf, reading the -sizecheck file.
+		_, mem := link(t, "-sizecheck="+filepath.Join(tmpdir, "missing"), true)
+		if !bytes.Contains(mem, []byte("cmd/link/internal/ld.")) {
+			t.Errorf("memory profile has no samples in the linker")
+		}
+	})
+
+	t.Run("benchmark", func(t *testing.T) {
+		// -benchmarkprofile does not start its CPU profiles while
+		// -cpuprofile runs, but writes its memory profiles.
+		base := filepath.Join(tmpdir, "bench")
+		cpu, _ := link(t, "-benchmark=mem -benchmarkprofile="+base, false)
+		if !hasLinkerFunc(cpu) {
+			t.Errorf("CPU profile has no samples in the linker:\n%v", cpu)
+		}
+		if _, err := os.Stat(base + "_BenchmarkLoadlib.memprof"); err != nil {
+			t.Error(err)
+		}
+		if _, err := os.Stat(base + "_BenchmarkLoadlib.cpuprof"); err == nil {
+			t.Errorf("-benchmarkprofile wrote a CPU profile while -cpuprofile ran")
+		}
+	})
+}
+
+func TestOutStripped(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "main.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nfunc main() { println(\"hello\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// build links the program with -o-stripped, returning the paths
+	// of the output and of its stripped copy.
+	build := func(name string, env []string, ldflags string) (string, string) {
+		exe := filepath.Join(tmpdir, name+".exe")
+		stripped := filepath.Join(tmpdir, name+".stripped.exe")
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-o-stripped="+stripped+" "+ldflags, src)
+		cmd.Env = append(os.Environ(), env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("build %s failed: %v\n%s", name, err, out)
+		}
+		return exe, stripped
+	}
+
+	// checkBuildID checks that the stripped copy has the build ID the
+	// go command gave the output.
+	checkBuildID := func(exe, stripped string) {
+		var ids []string
+		for _, file := range []string{exe, stripped} {
+			out, err := exec.Command(testenv.GoToolPath(t), "tool", "buildid", file).CombinedOutput()
+			if err != nil {
+				t.Fatalf("go tool buildid %s: %v\n%s", file, err, out)
+			}
+			ids = append(ids, strings.TrimSpace(string(out)))
+		}
+		if ids[0] != ids[1] {
+			t.Errorf("build ID of stripped copy is %s, want %s", ids[1], ids[0])
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		modes := []string{"internal"}
+		if testenv.HasCGO() {
+			modes = append(modes, "external")
+		}
+		for _, mode := range modes {
+			exe, stripped := build("elf-"+mode, nil, "-linkmode="+mode)
+			checkBuildID(exe, stripped)
+			f, err := elf.Open(stripped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sect := range f.Sections {
+				if strings.HasPrefix(sect.Name, ".debug_") || strings.HasPrefix(sect.Name, ".zdebug_") || sect.Type == elf.SHT_SYMTAB {
+					t.Errorf("%s: stripped copy has section %s", mode, sect.Name)
+				}
+			}
+			if _, err := f.DynamicSymbols(); err != nil && err != elf.ErrNoSymbols {
+				t.Errorf("%s: reading dynamic symbols: %v", mode, err)
+			}
+			f.Close()
+			out, err := exec.Command(stripped).CombinedOutput()
+			if err != nil || string(out) != "hello\n" {
+				t.Errorf("%s: running stripped copy: %v\n%s", mode, err, out)
+			}
+		}
+	}
+
+	// Mach-O is checked by cross-linking, which needs no cgo.
+	exe, stripped := build("macho", []string{"GOOS=darwin", "GOARCH=arm64", "CGO_ENABLED=0"}, "")
+	checkBuildID(exe, stripped)
+	full, err := macho.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer full.Close()
+	data, err := ioutil.ReadFile(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Segment("__DWARF") != nil {
+		t.Errorf("stripped copy has a __DWARF segment")
+	}
+	if f.Symtab != nil && len(f.Symtab.Syms) >= len(full.Symtab.Syms) {
+		t.Errorf("stripped copy has %d symbols, want fewer than %d", len(f.Symtab.Syms), len(full.Symtab.Syms))
+	}
+	if le := f.Segment("__LINKEDIT"); le == nil || le.Offset+le.Filesz != uint64(len(data)) {
+		t.Errorf("__LINKEDIT does not end the stripped copy")
+	}
+
+	// The code signature must cover the stripped copy: check the
+	// SHA-256 hash of each page against its CodeDirectory.
+	var sigOff, sigSize uint32
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		if f.ByteOrder.Uint32(raw) == 0x1d { // LC_CODE_SIGNATURE
+			sigOff, sigSize = f.ByteOrder.Uint32(raw[8:]), f.ByteOrder.Uint32(raw[12:])
+		}
+	}
+	if sigSize == 0 {
+		t.Fatalf("stripped copy has no code signature")
+	}
+	be := binary.BigEndian
+	sig := data[sigOff : sigOff+sigSize]
+	cd := sig[be.Uint32(sig[16:]):] // the first blob of the SuperBlob
+	hashOff, nSlots, codeLimit := be.Uint32(cd[16:]), be.Uint32(cd[28:]), be.Uint32(cd[32:])
+	hashSize, pageSize := uint32(cd[36]), uint32(1)<<cd[39]
+	if codeLimit != sigOff {
+		t.Fatalf("code signature covers %d bytes, want %d", codeLimit, sigOff)
+	}
+	for i := uint32(0); i < nSlots; i++ {
+		start, end := i*pageSize, (i+1)*pageSize
+		if end > codeLimit {
+			end = codeLimit
+		}
+		h := sha256.Sum256(data[start:end])
+		if want := cd[hashOff+i*hashSize : hashOff+(i+1)*hashSize]; !bytes.Equal(h[:], want) {
+			t.Fatalf("code signature hash of page %d does not match", i)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	const prog = `package main
+
+type I interface{ M() }
+
+type T struct{ n int }
+
+func (t *T) M() { println(t.n) }
+
+var Version = "devel"
+
+var sink I
+
+func main() {
+	sink = &T{1}
+	sink.M()
+	println(Version)
+}
+`
+	for name, data := range map[string]string{"go.mod": "module metadatatest\n", "main.go": prog} {
+		if err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zipfile := filepath.Join(tmpdir, "metadata.zip")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(tmpdir, "x.exe"), "-ldflags=-metadata="+zipfile+" -X main.Version=v1.2.3")
+	cmd.Dir = tmpdir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+
+	zr, err := zip.OpenReader(zipfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	read := func(name string, v interface{}) {
+		for _, f := range zr.File {
+			if f.Name != name {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if err := json.NewDecoder(r).Decode(v); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			return
+		}
+		t.Fatalf("no %s in metadata", name)
+	}
+
+	var build struct {
+		Schema          int
+		GOOS, GOARCH    string
+		BuildMode, Path string
+		Settings        []struct{ Key, Value string }
+	}
+	read("build.json", &build)
+	if build.Schema != 1 || build.GOOS != runtime.GOOS || build.GOARCH != runtime.GOARCH || build.Path != "metadatatest" {
+		t.Errorf("build.json = %+v, want schema 1, %s/%s, path metadatatest", build, runtime.GOOS, runtime.GOARCH)
+	}
+	foundCompiler := false
+	for _, s := range build.Settings {
+		if s.Key == "compiler" && s.Value == "gc" {
+			foundCompiler = true
+		}
+	}
+	if !foundCompiler {
+		t.Errorf("build.json settings = %v, want compiler=gc among them", build.Settings)
+	}
+
+	var symbols struct {
+		Schema  int
+		Symbols []struct {
+			Name, Package, Kind, Section string
+			Address                      uint64
+			Size                         int64
+		}
+	}
+	read("symbols.json", &symbols)
+	found := false
+	for _, s := range symbols.Symbols {
+		if s.Name == "main.main" {
+			found = true
+			if s.Package != "main" || s.Kind != "STEXT" || s.Address == 0 || s.Size == 0 {
+				t.Errorf("main.main in symbols.json is %+v", s)
+			}
+		}
+	}
+	if symbols.Schema != 1 || !found {
+		t.Errorf("symbols.json has schema %d, and main.main: %v", symbols.Schema, found)
+	}
+
+	var itabs struct {
+		Itabs []struct{ Name, Interface, Type string }
+	}
+	read("itabs.json", &itabs)
+	found = false
+	for _, it := range itabs.Itabs {
+		if it.Interface == "main.I" && it.Type == "*main.T" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("itabs.json has no itab for *main.T and main.I: %v", itabs.Itabs)
+	}
+
+	var roots struct{ Roots []string }
+	read("roots.json", &roots)
+	if len(roots.Roots) == 0 {
+		t.Errorf("roots.json has no roots")
+	}
+
+	var typelinks struct{ Typelinks []string }
+	read("typelinks.json", &typelinks)
+	if len(typelinks.Typelinks) == 0 {
+		t.Errorf("typelinks.json has no types")
+	}
+
+	var xflags struct {
+		Xflags []struct{ Name, Value string }
+	}
+	read("xflags.json", &xflags)
+	found = false
+	for _, x := range xflags.Xflags {
+		if x.Name == "main.Version" && x.Value == "v1.2.3" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("xflags.json does not have main.Version=v1.2.3: %v", xflags.Xflags)
+	}
+}
+
+const linkLayoutSrc = `package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"unsafe"
+)
+
+var (
+	data      = &noptrdata
+	noptrdata = 42
+	bss       *int
+	noptrbss  [64]byte
+)
+
+func main() {
+	l, ok := debug.ReadLayout()
+	if !ok {
+		fmt.Println("no layout")
+		return
+	}
+	s := "in the read-only data"
+	for _, c := range []struct {
+		name string
+		r    debug.AddrRange
+		p    uintptr
+	}{
+		{"Text", l.Text, reflect.ValueOf(main).Pointer()},
+		{"ROData", l.ROData, (*reflect.StringHeader)(unsafe.Pointer(&s)).Data},
+		{"NoPtrData", l.NoPtrData, uintptr(unsafe.Pointer(&noptrdata))},
+		{"Data", l.Data, uintptr(unsafe.Pointer(&data))},
+		{"BSS", l.BSS, uintptr(unsafe.Pointer(&bss))},
+		{"NoPtrBSS", l.NoPtrBSS, uintptr(unsafe.Pointer(&noptrbss))},
+	} {
+		if c.p < c.r.Start || c.p-c.r.Start >= c.r.Size {
+			fmt.Printf("%s is [%#x, %#x), does not contain %#x\n", c.name, c.r.Start, c.r.Start+c.r.Size, c.p)
+		}
+	}
+	fmt.Printf("%d %d %d %d\n", l.NoPtrData.Size, l.Data.Size, l.BSS.Size, l.NoPtrBSS.Size)
+}
+`
+
+// TestLinkLayout checks that runtime/debug.ReadLayout reports the
+// sections of the Go code, wherever the program is loaded.
+func TestLinkLayout(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("test only works on linux/amd64 and linux/arm64")
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(linkLayoutSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, buildmode := range []string{"exe", "pie"} {
+		for _, linkmode := range []string{"internal", "external"} {
+			buildmode, linkmode := buildmode, linkmode
+			t.Run(buildmode+"-"+linkmode, func(t *testing.T) {
+				if linkmode == "external" {
+					testenv.MustHaveCGO(t)
+				}
+				t.Parallel()
+				exe := filepath.Join(t.TempDir(), "main")
+				cmd := exec.Command(testenv.GoToolPath(t), "build", "-buildmode="+buildmode, "-ldflags=-linkmode="+linkmode, "-o", exe, src)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("%s: %v\n%s", cmd, err, out)
+				}
+				out, err := exec.Command(exe).CombinedOutput()
+				if err != nil {
+					t.Fatalf("%s: %v\n%s", exe, err, out)
+				}
+
+				lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+				if len(lines) != 1 {
+					t.Fatalf("%s printed\n%s", exe, out)
+				}
+				if linkmode == "external" {
+					// The output sections also hold the variables
+					// of C code.
+					return
+				}
+				ef, err := elf.Open(exe)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer ef.Close()
+				var sizes []string
+				for _, name := range []string{".noptrdata", ".data", ".bss", ".noptrbss"} {
+					sect := ef.Section(name)
+					if sect == nil {
+						t.Fatalf("no %s section", name)
+					}
+					sizes = append(sizes, fmt.Sprint(sect.Size))
+				}
+				if want := strings.Join(sizes, " "); lines[0] != want {
+					t.Errorf("%s reported sizes %s, want the section sizes %s", exe, lines[0], want)
+				}
+			})
+		}
+	}
+}
+
+const reproducibleCgoSrc = `package main
+
+/*
+int add(int a, int b) { return a + b; }
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.add(1, 2))
+}
+`
+
+// TestReproducibleGOROOT checks that programs built in different
+// directories, with GOROOT in different directories, are the same with
+// -trimpath, and with -debug-prefix-map.
+func TestReproducibleGOROOT(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveSymlink(t)
+
+	if runtime.GOOS != "linux" {
+		t.Skip("test only works on linux")
+	}
+
+	t.Parallel()
+
+	// Make two trees, each with a GOROOT linking to the real one and
+	// a copy of the programs.
+	tmpdir := t.TempDir()
+	var roots [2]string
+	for i := range roots {
+		roots[i] = filepath.Join(tmpdir, fmt.Sprintf("tree%d", i))
+		if err := os.MkdirAll(filepath.Join(roots[i], "src"), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(runtime.GOROOT(), filepath.Join(roots[i], "goroot")); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{
+			"go.mod":      "module repro\n",
+			"main.go":     "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n",
+			"cgo/main.go": reproducibleCgoSrc,
+		}
+		for name, src := range files {
+			file := filepath.Join(roots[i], "src", name)
+			if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, []byte(src), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	build := func(t *testing.T, root, pkg string, args ...string) []byte {
+		goroot := filepath.Join(root, "goroot")
+		exe := filepath.Join(root, "out")
+		args = append([]string{"build", "-o", exe}, args...)
+		cmd := exec.Command(filepath.Join(goroot, "bin", "go"), append(args, pkg)...)
+		cmd.Dir = filepath.Join(root, "src")
+		cmd.Env = append(os.Environ(), "GOROOT="+goroot)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		out, err := ioutil.ReadFile(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	t.Run("trimpath", func(t *testing.T) {
+		a := build(t, roots[0], ".", "-trimpath")
+		b := build(t, roots[1], ".", "-trimpath")
+		if !bytes.Equal(a, b) {
+			t.Error("-trimpath builds in different directories differ")
+		}
+	})
+
+	t.Run("trimpath-cgo", func(t *testing.T) {
+		testenv.MustHaveCGO(t)
+		a := build(t, roots[0], "./cgo", "-trimpath", "-ldflags=-linkmode=internal")
+		b := build(t, roots[1], "./cgo", "-trimpath", "-ldflags=-linkmode=internal")
+		if !bytes.Equal(a, b) {
+			t.Error("-trimpath builds in different directories differ")
+		}
+
+		// The host linker owns the layout of the output, compare
+		// what the Go linker writes.
+		a = build(t, roots[0], "./cgo", "-trimpath", "-ldflags=-linkmode=external")
+		b = build(t, roots[1], "./cgo", "-trimpath", "-ldflags=-linkmode=external")
+		for _, name := range []string{".gopclntab", ".go.buildinfo", ".noptrdata"} {
+			sa, err := elfSectionData(a, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sb, err := elfSectionData(b, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sa, sb) {
+				t.Errorf("-trimpath builds in different directories have different %s sections", name)
+			}
+		}
+	})
+
+	t.Run("debug-prefix-map", func(t *testing.T) {
+		var outs [2][]byte
+		var ldflags [2]string
+		for i, root := range roots {
+			ldflags[i] = fmt.Sprintf("-buildid= -debug-prefix-map=%s=/goroot -debug-prefix-map=%s=/src",
+				filepath.Join(root, "goroot"), filepath.Join(root, "src"))
+			outs[i] = build(t, root, ".", "-ldflags="+ldflags[i])
+			// The go command records the flags in the build
+			// information.
+			if bytes.Contains(bytes.ReplaceAll(outs[i], []byte(ldflags[i]), nil), []byte(root)) {
+				t.Errorf("output built in %s contains its directory", root)
+			}
+			if !bytes.Contains(outs[i], []byte("/goroot/src/fmt/print.go")) || !bytes.Contains(outs[i], []byte("/src/main.go")) {
+				t.Errorf("output built in %s does not contain the remapped file names", root)
+			}
+		}
+		a := bytes.ReplaceAll(outs[0], []byte(ldflags[0]), []byte(ldflags[1]))
+		if !bytes.Equal(a, outs[1]) {
+			t.Error("-debug-prefix-map builds in different directories differ")
+		}
+	})
+}
+
+// elfSectionData returns the contents of the section name of the ELF
+// file in data.
+func elfSectionData(data []byte, name string) ([]byte, error) {
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	s := ef.Section(name)
+	if s == nil {
+		return nil, fmt.Errorf("no %s section", name)
+	}
+	return s.Data()
+}
+
+const compressSectionsGo = `
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"fmt"
+)
+
+//go:embed data.txt
+var text string
+
+//go:embed data.txt
+var bytes []byte
+
+//go:embed dir
+var dir embed.FS
+
+// Package initializers must see the inflated data.
+var first = text[:5]
+
+func main() {
+	small, err := dir.ReadFile("dir/small.txt")
+	if err != nil {
+		panic(err)
+	}
+	bytes[0] = 'X' // []byte data stays writable
+	fmt.Printf("%s %x %x %s\n", first, sha256.Sum256([]byte(text)), sha256.Sum256(bytes[1:]), small)
+}
+`
+
+func TestCompressSections(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	var data []byte
+	for i := 0; len(data) < 500<<10; i++ {
+		data = append(data, fmt.Sprintf("line %d of the embedded file, which compresses well\n", i*i%1000)...)
+	}
+	tmpdir := t.TempDir()
+	files := map[string]string{
+		"go.mod":        "module compresssections\n",
+		"main.go":       compressSectionsGo,
+		"data.txt":      string(data),
+		"dir/small.txt": "small",
+	}
+	for name, src := range files {
+		name = filepath.Join(tmpdir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := fmt.Sprintf("%s %x %x small\n", data[:5], sha256.Sum256(data), sha256.Sum256(data[1:]))
+
+	var sizes []int64
+	for _, ldflags := range []string{"", "-compress-sections"} {
+		exe := filepath.Join(tmpdir, fmt.Sprintf("x%d.exe", len(sizes)))
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags="+ldflags)
+		cmd.Dir = tmpdir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		out, err := exec.Command(exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", exe, err, out)
+		}
+		if string(out) != want {
+			t.Errorf("with -ldflags=%q, program printed %q, want %q", ldflags, out, want)
+		}
+		fi, err := os.Stat(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, fi.Size())
+	}
+	// The file is embedded twice, once read-only and once writable.
+	if saved := sizes[0] - sizes[1]; saved < int64(len(data)) {
+		t.Errorf("-compress-sections saved %d bytes, want at least %d (sizes %d and %d)", saved, len(data), sizes[0], sizes[1])
+	}
+}
+
+const orderFileGo = `
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+//go:noinline
+func f1() string { return where() }
+
+//go:noinline
+func f2() string { return where() }
+
+//go:noinline
+func f3() string { return where() }
+
+//go:noinline
+func where() string {
+	pc, _, _, _ := runtime.Caller(1)
+	return runtime.FuncForPC(pc).Name()
+}
+
+func main() {
+	fmt.Println(f1(), f2(), f3())
+}
+`
+
+func TestOrderFile(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping on non-ELF system")
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(orderFileGo), 0666); err != nil {
+		t.Fatal(err)
+	}
+	order := filepath.Join(tmpdir, "order.txt")
+	if err := ioutil.WriteFile(order, []byte("# hot functions\nmain.f3\n\nmain.f1\nno.such.func\nmain.main\nmain.f3\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(tmpdir, "x.exe")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-orderfile="+order, src)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+	if want := "order.txt:5: no function no.such.func"; !bytes.Contains(out, []byte(want)) {
+		t.Errorf("build output does not contain %q:\n%s", want, out)
+	}
+
+	// The listed functions come first in the text, in order.
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := f.Section(".text")
+	var funcs []elf.Symbol
+	for _, s := range syms {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Value >= text.Addr && s.Value < text.Addr+text.Size {
+			funcs = append(funcs, s)
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Value < funcs[j].Value })
+	var got []string
+	for _, s := range funcs {
+		if s.Name == "go.buildid" || s.Name == "runtime.text" {
+			continue
+		}
+		got = append(got, s.Name)
+		if len(got) == 3 {
+			break
+		}
+	}
+	want := []string{"main.f3", "main.f1", "main.main"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("first functions in .text are %v, want %v", got, want)
+	}
+
+	// The function table follows the new order.
+	out, err = exec.Command(exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", exe, err, out)
+	}
+	if got, want := string(out), "main.f1 main.f2 main.f3\n"; got != want {
+		t.Errorf("program printed %q, want %q", got, want)
+	}
+}
+
+func TestRandLayout(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(orderFileGo), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var exes []string
+	var syms []string
+	for i, seed := range []string{"1", "2", "1"} {
+		exe := filepath.Join(tmpdir, fmt.Sprintf("x%d.exe", i))
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", exe, "-ldflags=-randlayout="+seed, src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		out, err := exec.Command(exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", exe, err, out)
+		}
+		if got, want := string(out), "main.f1 main.f2 main.f3\n"; got != want {
+			t.Errorf("with -randlayout=%s, program printed %q, want %q", seed, got, want)
+		}
+		cmd = exec.Command(testenv.GoToolPath(t), "tool", "nm", "-n", exe)
+		out, err = cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", cmd, err, out)
+		}
+		exes = append(exes, exe)
+		syms = append(syms, string(out))
+	}
+
+	if syms[0] == syms[1] {
+		t.Errorf("-randlayout=1 and -randlayout=2 produced the same symbol table")
+	}
+	data0, err := ioutil.ReadFile(exes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data2, err := ioutil.ReadFile(exes[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data0, data2) {
+		t.Errorf("two links with -randlayout=1 produced different output")
+	}
+}
+
+var update = flag.Bool("update", false, "update testdata golden files")
+
+func TestPrintConfig(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		// The golden file records linux/amd64 defaults.
+		t.Skip("golden file is for linux/amd64")
+	}
+
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "main.go"), []byte("package main\n\nfunc main() { println(\"hello\") }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(testenv.GoToolPath(t), "tool", "compile", "-p", "main", "-o", "main.o", "main.go")
+	cmd.Dir = tmpdir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("compile failed: %v\n%s", err, out)
+	}
+	obj, err := ioutil.ReadFile(filepath.Join(tmpdir, "main.o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := func(mode string) []byte {
+		cmd := exec.Command(testenv.GoToolPath(t), "tool", "link", "-print-config="+mode, "-linkmode=internal", "-s", "-o", "x.exe", "main.o")
+		cmd.Dir = tmpdir
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("link -print-config=%s failed: %v\n%s", mode, err, stderr.Bytes())
+		}
+		return out
+	}
+
+	// With exit, the linker prints the configuration and stops.
+	out := link("exit")
+	if _, err := os.Stat(filepath.Join(tmpdir, "x.exe")); err == nil {
+		t.Errorf("-print-config=exit wrote the output file")
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(out, &config); err != nil {
+		t.Fatalf("bad -print-config output: %v\n%s", err, out)
+	}
+
+	// Keep the input for package main, whose contents are known, and
+	// drop the version fields, which change from build to build.
+	inputs, _ := config["inputs"].([]interface{})
+	var kept []interface{}
+	for _, in := range inputs {
+		in := in.(map[string]interface{})
+		if sum, _ := in["sha256"].(string); len(sum) != 2*sha256.Size {
+			t.Errorf("input %v has a bad hash", in)
+		}
+		if in["package"] == "main" {
+			if want := fmt.Sprintf("%x", sha256.Sum256(obj)); in["sha256"] != want {
+				t.Errorf("main.o hash is %v, want %s", in["sha256"], want)
+			}
+			in["sha256"] = "SHA256"
+			kept = append(kept, in)
+		}
+	}
+	if len(kept) != 1 || len(inputs) < 2 {
+		t.Errorf("want main and its dependencies in inputs, got %v", inputs)
+	}
+	config["inputs"] = kept
+	delete(config, "goversion")
+	delete(config, "experiment")
+
+	got, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	golden := filepath.Join("testdata", "print-config.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("-print-config output does not match %s (run with -update):\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+
+	// With continue, the link goes on after printing the configuration.
+	out = link("continue")
+	if !bytes.Contains(out, []byte(`"linkmodereason": "-linkmode"`)) {
+		t.Errorf("-print-config=continue did not print the configuration:\n%s", out)
+	}
+	cmd = exec.Command(filepath.Join(tmpdir, "x.exe"))
+	if out, err := cmd.CombinedOutput(); err != nil || string(out) != "hello\n" {
+		t.Errorf("running the linked program: %v\n%s", err, out)
+	}
+}
+
+const responseFileSrc = `package main
+
+// int answer(void) { return 42; }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.answer())
+}
+`
+
+// TestHostlinkResponseFile checks that the arguments of the external
+// linker are passed in a response file once they exceed the limit
+// that -debugarglen sets, quoted so that paths with spaces survive.
+func TestHostlinkResponseFile(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+	testenv.MustHaveCGO(t)
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(responseFileSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// The user's -tmpdir is kept, with the response file.
+	tmpdir := filepath.Join(dir, "tmp dir")
+	if err := os.Mkdir(tmpdir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "x.exe")
+	ldflags := fmt.Sprintf("-ldflags=-linkmode=external -debugarglen=1 '-tmpdir=%s'", tmpdir)
+	cmd := exec.Command(testenv.GoToolPath(t), "build", ldflags, "-o", exe, src)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, out)
+	}
+	out, err := exec.Command(exe).CombinedOutput()
+	if err != nil || string(out) != "42\n" {
+		t.Fatalf("running the linked program: %v\n%s", err, out)
+	}
+
+	rsp, err := ioutil.ReadFile(filepath.Join(tmpdir, "hostlink.rsp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote := strings.NewReplacer(`\`, `\\`, " ", `\ `).Replace
+	for _, obj := range []string{"go.o", "000000.o"} {
+		want := quote(filepath.Join(tmpdir, obj)) + "\n"
+		if !bytes.Contains(rsp, []byte(want)) {
+			t.Errorf("response file does not contain %q:\n%s", want, rsp)
+		}
+	}
+}
@@ -235,6 +235,18 @@ func (x *elfExe) DataStart() uint64 {
 			return s.Addr
 		}
 	}
+	if len(x.f.Sections) == 0 {
+		// Without section headers, as after objcopy --strip-sections
+		// or linking with -ldflags=-strip=sections, the blob may be in
+		// any of the writable segments, and not near its start.
+		for _, p := range x.f.Progs {
+			if p.Type == elf.PT_LOAD && p.Flags&(elf.PF_X|elf.PF_W) == elf.PF_W {
+				if addr, ok := findBuildInfo(p); ok {
+					return addr
+				}
+			}
+		}
+	}
 	for _, p := range x.f.Progs {
 		if p.Type == elf.PT_LOAD && p.Flags&(elf.PF_X|elf.PF_W) == elf.PF_W {
 			return p.Vaddr
@@ -243,6 +255,25 @@ func (x *elfExe) DataStart() uint64 {
 	return 0
 }
 
+// findBuildInfo returns the address of the build info blob, which is
+// 16-byte aligned, in the segment p, if it has one.
+func findBuildInfo(p *elf.Prog) (uint64, bool) {
+	data := make([]byte, p.Filesz)
+	if _, err := p.ReadAt(data, 0); err != nil {
+		return 0, false
+	}
+	for off := 0; ; off++ {
+		i := bytes.Index(data[off:], buildInfoMagic)
+		if i < 0 {
+			return 0, false
+		}
+		off += i
+		if addr := p.Vaddr + uint64(off); addr%16 == 0 {
+			return addr, true
+		}
+	}
+}
+
 // peExe is the PE (Windows Portable Executable) implementation of the exe interface.
 type peExe struct {
 	f *pe.File
@@ -635,6 +635,7 @@ const (
 	SHT_PREINIT_ARRAY  SectionType = 16         /* Pre-initialization function ptrs. */
 	SHT_GROUP          SectionType = 17         /* Section group. */
 	SHT_SYMTAB_SHNDX   SectionType = 18         /* Section indexes (see SHN_XINDEX). */
+	SHT_RELR           SectionType = 19         /* Relative relocations in compact format. */
 	SHT_LOOS           SectionType = 0x60000000 /* First of OS specific semantics */
 	SHT_GNU_ATTRIBUTES SectionType = 0x6ffffff5 /* GNU object attributes */
 	SHT_GNU_HASH       SectionType = 0x6ffffff6 /* GNU hash table */
@@ -668,6 +669,7 @@ var shtStrings = []intName{
 	{16, "SHT_PREINIT_ARRAY"},
 	{17, "SHT_GROUP"},
 	{18, "SHT_SYMTAB_SHNDX"},
+	{19, "SHT_RELR"},
 	{0x60000000, "SHT_LOOS"},
 	{0x6ffffff5, "SHT_GNU_ATTRIBUTES"},
 	{0x6ffffff6, "SHT_GNU_HASH"},
@@ -726,6 +728,7 @@ type CompressionType int
 
 const (
 	COMPRESS_ZLIB   CompressionType = 1          /* ZLIB compression. */
+	COMPRESS_ZSTD   CompressionType = 2          /* ZSTD compression. */
 	COMPRESS_LOOS   CompressionType = 0x60000000 /* First OS-specific. */
 	COMPRESS_HIOS   CompressionType = 0x6fffffff /* Last OS-specific. */
 	COMPRESS_LOPROC CompressionType = 0x70000000 /* First processor-specific type. */
@@ -733,7 +736,8 @@ const (
 )
 
 var compressionStrings = []intName{
-	{0, "COMPRESS_ZLIB"},
+	{1, "COMPRESS_ZLIB"},
+	{2, "COMPRESS_ZSTD"},
 	{0x60000000, "COMPRESS_LOOS"},
 	{0x6fffffff, "COMPRESS_HIOS"},
 	{0x70000000, "COMPRESS_LOPROC"},
@@ -886,6 +890,9 @@ const (
 	DT_PREINIT_ARRAY   DynTag = 32 /* Address of the array of pointers to pre-initialization functions. */
 	DT_PREINIT_ARRAYSZ DynTag = 33 /* Size in bytes of the array of pre-initialization functions. */
 	DT_SYMTAB_SHNDX    DynTag = 34 /* Address of SHT_SYMTAB_SHNDX section. */
+	DT_RELRSZ          DynTag = 35 /* Size in bytes of the SHT_RELR relocations. */
+	DT_RELR            DynTag = 36 /* Address of the SHT_RELR relocations. */
+	DT_RELRENT         DynTag = 37 /* Size in bytes of a SHT_RELR entry. */
 
 	DT_LOOS DynTag = 0x6000000d /* First OS-specific */
 	DT_HIOS DynTag = 0x6ffff000 /* Last OS-specific */
@@ -1029,6 +1036,9 @@ var dtStrings = []intName{
 	{32, "DT_PREINIT_ARRAY"},
 	{33, "DT_PREINIT_ARRAYSZ"},
 	{34, "DT_SYMTAB_SHNDX"},
+	{35, "DT_RELRSZ"},
+	{36, "DT_RELR"},
+	{37, "DT_RELRENT"},
 	{0x6000000d, "DT_LOOS"},
 	{0x6ffff000, "DT_HIOS"},
 	{0x6ffffd00, "DT_VALRNGLO"},
@@ -12,7 +12,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"internal/zstd"
 	"io"
+	"math"
 	"os"
 	"strings"
 )
@@ -123,17 +125,25 @@ func (s *Section) Open() io.ReadSeeker {
 	if s.Flags&SHF_COMPRESSED == 0 {
 		return io.NewSectionReader(s.sr, 0, 1<<63-1)
 	}
-	if s.compressionType == COMPRESS_ZLIB {
-		return &readSeekerFromReader{
-			reset: func() (io.Reader, error) {
-				fr := io.NewSectionReader(s.sr, s.compressionOffset, int64(s.FileSize)-s.compressionOffset)
-				return zlib.NewReader(fr)
-			},
-			size: int64(s.Size),
+	var zrd func(io.Reader) (io.ReadCloser, error)
+	switch s.compressionType {
+	case COMPRESS_ZLIB:
+		zrd = zlib.NewReader
+	case COMPRESS_ZSTD:
+		zrd = func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(zstd.NewReader(r)), nil
 		}
+	default:
+		err := &FormatError{int64(s.Offset), "unknown compression type", s.compressionType}
+		return errorReader{err}
+	}
+	return &readSeekerFromReader{
+		reset: func() (io.Reader, error) {
+			fr := io.NewSectionReader(s.sr, s.compressionOffset, int64(s.FileSize)-s.compressionOffset)
+			return zrd(fr)
+		},
+		size: int64(s.Size),
 	}
-	err := &FormatError{int64(s.Offset), "unknown compression type", s.compressionType}
-	return errorReader{err}
 }
 
 // A ProgHeader represents a single ELF program header.
@@ -173,7 +183,7 @@ type Symbol struct {
 	Value, Size uint64
 
 	// Version and Library are present only for the dynamic symbol
-	// table.
+	// table. Library is empty for the versions the file defines.
 	Version string
 	Library string
 }
@@ -1316,12 +1326,17 @@ func (f *File) gnuVersionInit(str []byte) bool {
 		return true
 	}
 
-	// Accumulate verneed information.
 	vn := f.SectionByType(SHT_GNU_VERNEED)
-	if vn == nil {
+	vd := f.SectionByType(SHT_GNU_VERDEF)
+	if vn == nil && vd == nil {
 		return false
 	}
-	d, _ := vn.Data()
+
+	// Accumulate verneed information.
+	var d []byte
+	if vn != nil {
+		d, _ = vn.Data()
+	}
 
 	var need []verneed
 	i := 0
@@ -1371,6 +1386,44 @@ func (f *File) gnuVersionInit(str []byte) bool {
 		i += int(next)
 	}
 
+	// Accumulate verdef information. The versions the file defines
+	// share the indexes of the versions it needs, and have no file.
+	// The first one, with index 1, names the file itself.
+	d = nil
+	if vd != nil {
+		d, _ = vd.Data()
+	}
+	for i = 0; i+20 <= len(d); {
+		vers := f.ByteOrder.Uint16(d[i : i+2])
+		if vers != 1 {
+			break
+		}
+		// flags := f.ByteOrder.Uint16(d[i+2:i+4])
+		ndx := int(f.ByteOrder.Uint16(d[i+4 : i+6]))
+		cnt := f.ByteOrder.Uint16(d[i+6 : i+8])
+		// hash := f.ByteOrder.Uint32(d[i+8:i+12])
+		aux := f.ByteOrder.Uint32(d[i+12 : i+16])
+		next := f.ByteOrder.Uint32(d[i+16 : i+20])
+
+		// The first auxiliary entry names the version, the others
+		// its parents.
+		if j := i + int(aux); cnt > 0 && j+8 <= len(d) {
+			nameoff := f.ByteOrder.Uint32(d[j : j+4])
+			name, _ := getString(str, int(nameoff))
+			if ndx >= len(need) {
+				a := make([]verneed, 2*(ndx+1))
+				copy(a, need)
+				need = a
+			}
+			need[ndx] = verneed{"", name}
+		}
+
+		if next == 0 {
+			break
+		}
+		i += int(next)
+	}
+
 	// Versym parallels symbol table, indexing into verneed.
 	vs := f.SectionByType(SHT_GNU_VERSYM)
 	if vs == nil {
@@ -1453,3 +1506,182 @@ func (f *File) DynString(tag DynTag) ([]string, error) {
 	}
 	return all, nil
 }
+
+// dynValue returns the values listed for the given tag in the file's
+// dynamic section or, without section headers, its PT_DYNAMIC segment.
+func (f *File) dynValue(tag DynTag) ([]uint64, error) {
+	var d []byte
+	if ds := f.SectionByType(SHT_DYNAMIC); ds != nil {
+		var err error
+		if d, err = ds.Data(); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, p := range f.Progs {
+			if p.Type != PT_DYNAMIC {
+				continue
+			}
+			var err error
+			if d, err = io.ReadAll(p.Open()); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	var vals []uint64
+	for len(d) > 0 {
+		var t DynTag
+		var v uint64
+		switch f.Class {
+		case ELFCLASS32:
+			if len(d) < 8 {
+				return nil, errors.New("truncated dynamic section")
+			}
+			t = DynTag(f.ByteOrder.Uint32(d[0:4]))
+			v = uint64(f.ByteOrder.Uint32(d[4:8]))
+			d = d[8:]
+		case ELFCLASS64:
+			if len(d) < 16 {
+				return nil, errors.New("truncated dynamic section")
+			}
+			t = DynTag(f.ByteOrder.Uint64(d[0:8]))
+			v = f.ByteOrder.Uint64(d[8:16])
+			d = d[16:]
+		default:
+			return nil, fmt.Errorf("unknown ELF class %v", f.Class)
+		}
+		if t == DT_NULL {
+			break
+		}
+		if t == tag {
+			vals = append(vals, v)
+		}
+	}
+	return vals, nil
+}
+
+// RelrRelocations returns the addresses of the relative relocations
+// that f packs in the SHT_RELR format, in the order of the table. The
+// dynamic linker adds the load address of the file to the word at each
+// of them. The table is the SHT_RELR section or, without one, as in a
+// file without section headers, the one the DT_RELR, DT_RELRSZ and
+// DT_RELRENT dynamic tags describe. RelrRelocations returns nil if
+// there is no table.
+func (f *File) RelrRelocations() ([]uint64, error) {
+	wordsize := uint64(4)
+	if f.Class == ELFCLASS64 {
+		wordsize = 8
+	}
+
+	var data []byte
+	if s := f.SectionByType(SHT_RELR); s != nil {
+		if s.Entsize != 0 && s.Entsize != wordsize {
+			return nil, fmt.Errorf("SHT_RELR section %s has entry size %d, want %d", s.Name, s.Entsize, wordsize)
+		}
+		var err error
+		if data, err = s.Data(); err != nil {
+			return nil, err
+		}
+	} else {
+		addr, err := f.dynValue(DT_RELR)
+		if err != nil || len(addr) == 0 {
+			return nil, err
+		}
+		size, err := f.dynValue(DT_RELRSZ)
+		if err != nil {
+			return nil, err
+		}
+		if len(size) == 0 {
+			return nil, errors.New("DT_RELR without DT_RELRSZ")
+		}
+		ent, err := f.dynValue(DT_RELRENT)
+		if err != nil {
+			return nil, err
+		}
+		if len(ent) > 0 && ent[0] != wordsize {
+			return nil, fmt.Errorf("DT_RELRENT is %d, want %d", ent[0], wordsize)
+		}
+		if data, err = f.readVirtual(addr[0], size[0]); err != nil {
+			return nil, fmt.Errorf("reading DT_RELR table: %v", err)
+		}
+	}
+	return decodeRelr(data, wordsize, f.ByteOrder)
+}
+
+// readVirtual reads the size bytes at address addr of the loaded
+// file, which must lie in the file data of a PT_LOAD segment.
+func (f *File) readVirtual(addr, size uint64) ([]byte, error) {
+	for _, p := range f.Progs {
+		if p.Type != PT_LOAD || addr < p.Vaddr || addr-p.Vaddr > p.Filesz || size > p.Filesz-(addr-p.Vaddr) {
+			continue
+		}
+		// The file may hold less data than the headers claim.
+		d, err := io.ReadAll(io.NewSectionReader(p, int64(addr-p.Vaddr), int64(size)))
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(d)) != size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("[%#x, %#x+%#x) is not in the file data of a loadable segment", addr, addr, size)
+}
+
+// decodeRelr decodes a table of relative relocations in the SHT_RELR
+// format, whose entries are words of wordsize bytes. An even entry is
+// the address of a relocation. An odd one is a bitmap of the
+// relocations at the wordsize*8-1 words following those the entries
+// before it cover: bit i+1 set means the i'th of them is relocated.
+func decodeRelr(data []byte, wordsize uint64, order binary.ByteOrder) ([]uint64, error) {
+	if uint64(len(data))%wordsize != 0 {
+		return nil, fmt.Errorf("SHT_RELR table size %d is not a multiple of %d", len(data), wordsize)
+	}
+	limit := uint64(math.MaxUint64)
+	if wordsize == 4 {
+		limit = math.MaxUint32
+	}
+	nbits := wordsize*8 - 1
+
+	var (
+		addrs []uint64
+		next  uint64 // address of the first word the next bitmap covers
+		words uint64 // number of words from next to the end of the address space
+		base  bool   // whether an address came before
+	)
+	for i := uint64(0); i < uint64(len(data)); i += wordsize {
+		var w uint64
+		if wordsize == 4 {
+			w = uint64(order.Uint32(data[i:]))
+		} else {
+			w = order.Uint64(data[i:])
+		}
+		if w&1 == 0 {
+			if w%wordsize != 0 {
+				return nil, fmt.Errorf("SHT_RELR entry %d: address %#x is not aligned to %d bytes", i/wordsize, w, wordsize)
+			}
+			addrs = append(addrs, w)
+			next, words, base = w+wordsize, (limit-w)/wordsize, true
+			continue
+		}
+		if !base {
+			return nil, fmt.Errorf("SHT_RELR entry %d: bitmap %#x does not follow an address", i/wordsize, w)
+		}
+		for j, bits := uint64(0), w>>1; bits != 0; j, bits = j+1, bits>>1 {
+			if bits&1 == 0 {
+				continue
+			}
+			if j >= words {
+				return nil, fmt.Errorf("SHT_RELR entry %d: bitmap %#x runs past the end of the address space", i/wordsize, w)
+			}
+			addrs = append(addrs, next+j*wordsize)
+		}
+		if words < nbits {
+			words = 0
+		} else {
+			words -= nbits
+		}
+		next += nbits * wordsize
+	}
+	return addrs, nil
+}
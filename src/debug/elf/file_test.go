@@ -842,12 +842,17 @@ func TestCompressedSection(t *testing.T) {
 	if !bytes.Equal(wantData, b) {
 		t.Fatalf("want data %x, got %x", wantData, b)
 	}
+	testSectionSeeks(t, sec, wantData)
+}
 
-	// Test Open method and seeking.
-	buf, have, count := make([]byte, len(b)), make([]bool, len(b)), 0
+// testSectionSeeks tests the Open method of sec and seeking, checking
+// that the section reads as wantData.
+func testSectionSeeks(t *testing.T, sec *Section, wantData []byte) {
+	var err error
+	buf, have, count := make([]byte, len(wantData)), make([]bool, len(wantData)), 0
 	sf := sec.Open()
-	if got, err := sf.Seek(0, io.SeekEnd); got != int64(len(b)) || err != nil {
-		t.Fatalf("want seek end %d, got %d error %v", len(b), got, err)
+	if got, err := sf.Seek(0, io.SeekEnd); got != int64(len(wantData)) || err != nil {
+		t.Fatalf("want seek end %d, got %d error %v", len(wantData), got, err)
 	}
 	if n, err := sf.Read(buf); n != 0 || err != io.EOF {
 		t.Fatalf("want EOF with 0 bytes, got %v with %d bytes", err, n)
@@ -896,6 +901,103 @@ func TestCompressedSection(t *testing.T) {
 	}
 }
 
+func TestCompressedSectionZstd(t *testing.T) {
+	// Test files made from compressed-32.obj and compressed-64.obj
+	// with objcopy from binutils 2.40:
+	// objcopy --decompress-debug-sections compressed-64.obj plain.obj
+	// objcopy --compress-debug-sections=zstd plain.obj zstd-compressed-64.obj
+	for _, class := range []string{"32", "64"} {
+		t.Run(class, func(t *testing.T) {
+			f, err := Open("testdata/zstd-compressed-" + class + ".obj")
+			if err != nil {
+				t.Fatal(err)
+			}
+			zf, err := Open("testdata/compressed-" + class + ".obj")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{".debug_info", ".debug_str"} {
+				sec := f.Section(name)
+				if sec.Flags&SHF_COMPRESSED == 0 || sec.compressionType != COMPRESS_ZSTD {
+					t.Fatalf("%s: want a section compressed with %v, got flags %v, compression type %v", name, COMPRESS_ZSTD, sec.Flags, sec.compressionType)
+				}
+				wantData, err := zf.Section(name).Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := sec.Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(wantData, b) {
+					t.Fatalf("%s: want data %x, got %x", name, wantData, b)
+				}
+				testSectionSeeks(t, sec, wantData)
+			}
+
+			countEntries := func(f *File) int {
+				d, err := f.DWARF()
+				if err != nil {
+					t.Fatal(err)
+				}
+				n := 0
+				for r := d.Reader(); ; n++ {
+					entry, err := r.Next()
+					if err != nil {
+						t.Fatal(err)
+					}
+					if entry == nil {
+						return n
+					}
+				}
+			}
+			if got, want := countEntries(f), countEntries(zf); got != want {
+				t.Errorf("want %d DWARF entries, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestCompressedSectionTruncated(t *testing.T) {
+	for _, class := range []string{"32", "64"} {
+		data, err := os.ReadFile("testdata/zstd-compressed-" + class + ".obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Cut the compressed stream of .debug_info short by
+		// shrinking the size in its section header.
+		var i int
+		for i = range f.Sections {
+			if f.Sections[i].Name == ".debug_info" {
+				break
+			}
+		}
+		size := f.Sections[i].FileSize - 8
+		if f.Class == ELFCLASS64 {
+			shoff := binary.LittleEndian.Uint64(data[0x28:])
+			binary.LittleEndian.PutUint64(data[shoff+uint64(i)*64+32:], size)
+		} else {
+			shoff := binary.LittleEndian.Uint32(data[0x20:])
+			binary.LittleEndian.PutUint32(data[shoff+uint32(i)*40+20:], uint32(size))
+		}
+		f, err = NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sec := f.Section(".debug_info")
+		if _, err := sec.Data(); err != io.ErrUnexpectedEOF {
+			t.Errorf("%s-bit Data: got error %v, want %v", class, err, io.ErrUnexpectedEOF)
+		}
+		if _, err := io.ReadAll(sec.Open()); err != io.ErrUnexpectedEOF {
+			t.Errorf("%s-bit Open: got error %v, want %v", class, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
 func TestNoSectionOverlaps(t *testing.T) {
 	// Ensure cmd/link outputs sections without overlaps.
 	switch runtime.GOOS {
@@ -936,3 +1038,221 @@ func TestIssue10996(t *testing.T) {
 		t.Fatalf("opening invalid ELF file unexpectedly succeeded")
 	}
 }
+
+func TestRelrRelocations(t *testing.T) {
+	for _, file := range []string{"testdata/librelr-amd64.so", "testdata/librelr-386.so"} {
+		file := file
+		t.Run(path.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := NewFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.SectionByType(SHT_RELR) == nil {
+				t.Fatal("no SHT_RELR section")
+			}
+
+			// The first 70 pointers of table and its last one,
+			// the 200th, are relocated.
+			syms, err := f.DynamicSymbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var table uint64
+			for _, s := range syms {
+				if s.Name == "table" {
+					table = s.Value
+				}
+			}
+			if table == 0 {
+				t.Fatal("no dynamic symbol table")
+			}
+			wordsize := uint64(4)
+			if f.Class == ELFCLASS64 {
+				wordsize = 8
+			}
+			var want []uint64
+			for i := uint64(0); i < 70; i++ {
+				want = append(want, table+i*wordsize)
+			}
+			want = append(want, table+199*wordsize)
+
+			got, err := f.RelrRelocations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("RelrRelocations() = %#x, want %#x", got, want)
+			}
+
+			// Without section headers, the dynamic tags locate
+			// the table.
+			switch f.Class {
+			case ELFCLASS32:
+				var hdr Header32
+				binary.Read(bytes.NewReader(data), f.ByteOrder, &hdr)
+				hdr.Shoff, hdr.Shnum, hdr.Shstrndx = 0, 0, 0
+				var b bytes.Buffer
+				binary.Write(&b, f.ByteOrder, &hdr)
+				copy(data, b.Bytes())
+			case ELFCLASS64:
+				var hdr Header64
+				binary.Read(bytes.NewReader(data), f.ByteOrder, &hdr)
+				hdr.Shoff, hdr.Shnum, hdr.Shstrndx = 0, 0, 0
+				var b bytes.Buffer
+				binary.Write(&b, f.ByteOrder, &hdr)
+				copy(data, b.Bytes())
+			}
+			f, err = NewFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Sections) != 0 {
+				t.Fatalf("file has %d sections after removing the section headers", len(f.Sections))
+			}
+			got, err = f.RelrRelocations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("RelrRelocations() without section headers = %#x, want %#x", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeRelr(t *testing.T) {
+	tests := []struct {
+		name     string
+		wordsize uint64
+		order    binary.ByteOrder
+		entries  []uint64
+		want     []uint64
+		err      string
+	}{
+		{
+			name:     "empty",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+		},
+		{
+			name:     "addresses",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0x1000, 0x2000},
+			want:     []uint64{0x1000, 0x2000},
+		},
+		{
+			name:     "bitmap",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0x1000, 0b1011},
+			want:     []uint64{0x1000, 0x1008, 0x1018},
+		},
+		{
+			name:     "bitmaps",
+			wordsize: 8,
+			order:    binary.BigEndian,
+			entries:  []uint64{0x1000, 1<<63 | 1, 0b11, 0x4000, 0b101},
+			want:     []uint64{0x1000, 0x1008 + 62*8, 0x1008 + 63*8, 0x4000, 0x4010},
+		},
+		{
+			name:     "empty bitmap",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0x1000, 1, 0b11},
+			want:     []uint64{0x1000, 0x1008 + 63*8},
+		},
+		{
+			name:     "32-bit bitmaps",
+			wordsize: 4,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0x100, 1<<31 | 0b11, 0b11},
+			want:     []uint64{0x100, 0x104, 0x104 + 30*4, 0x104 + 31*4},
+		},
+		{
+			name:     "32-bit big-endian",
+			wordsize: 4,
+			order:    binary.BigEndian,
+			entries:  []uint64{0x100, 0b111},
+			want:     []uint64{0x100, 0x104, 0x108},
+		},
+		{
+			name:     "last word",
+			wordsize: 4,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0xfffffff8, 0b11},
+			want:     []uint64{0xfffffff8, 0xfffffffc},
+		},
+		{
+			name:     "bitmap first",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0b11, 0x1000},
+			err:      "SHT_RELR entry 0: bitmap 0x3 does not follow an address",
+		},
+		{
+			name:     "unaligned address",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0x1000, 0x1004},
+			err:      "SHT_RELR entry 1: address 0x1004 is not aligned to 8 bytes",
+		},
+		{
+			name:     "32-bit unaligned address",
+			wordsize: 4,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0x102},
+			err:      "SHT_RELR entry 0: address 0x102 is not aligned to 4 bytes",
+		},
+		{
+			name:     "past the address space",
+			wordsize: 4,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0xfffffff8, 0b111},
+			err:      "SHT_RELR entry 1: bitmap 0x7 runs past the end of the address space",
+		},
+		{
+			name:     "64-bit past the address space",
+			wordsize: 8,
+			order:    binary.LittleEndian,
+			entries:  []uint64{0xfffffffffffffff8, 1, 0b11},
+			err:      "SHT_RELR entry 2: bitmap 0x3 runs past the end of the address space",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			for _, e := range test.entries {
+				b := make([]byte, test.wordsize)
+				if test.wordsize == 4 {
+					test.order.PutUint32(b, uint32(e))
+				} else {
+					test.order.PutUint64(b, e)
+				}
+				data = append(data, b...)
+			}
+			got, err := decodeRelr(data, test.wordsize, test.order)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("decodeRelr() error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("decodeRelr() = %#x, want %#x", got, test.want)
+			}
+		})
+	}
+
+	// The table is made of whole words.
+	if _, err := decodeRelr(make([]byte, 6), 4, binary.LittleEndian); err == nil {
+		t.Errorf("decodeRelr of 6 bytes of 4-byte words succeeded")
+	}
+}
@@ -835,4 +835,42 @@ var dynamicSymbolsGolden = map[string][]Symbol{
 	},
 	"testdata/go-relocation-test-clang-x86.obj": {},
 	"testdata/hello-world-core.gz":              {},
+	"testdata/libverdef-amd64.so": {
+		Symbol{
+			Name:    "two",
+			Info:    0x12,
+			Other:   0x0,
+			Section: 0x7,
+			Value:   0x100b,
+			Size:    0xb,
+			Version: "V2",
+		},
+		Symbol{
+			Name:    "V1",
+			Info:    0x11,
+			Other:   0x0,
+			Section: SHN_ABS,
+			Value:   0x0,
+			Size:    0x0,
+			Version: "V1",
+		},
+		Symbol{
+			Name:    "one",
+			Info:    0x12,
+			Other:   0x0,
+			Section: 0x7,
+			Value:   0x1000,
+			Size:    0xb,
+			Version: "V1",
+		},
+		Symbol{
+			Name:    "V2",
+			Info:    0x11,
+			Other:   0x0,
+			Section: SHN_ABS,
+			Value:   0x0,
+			Size:    0x0,
+			Version: "V2",
+		},
+	},
 }
@@ -0,0 +1,18 @@
+// librelr-amd64.so and librelr-386.so are built with
+//
+//	gcc -shared -nostdlib -fPIC -Wl,-z,pack-relative-relocs \
+//		-o librelr-amd64.so relr.c
+//	gcc -m32 -shared -nostdlib -fPIC -Wl,-z,pack-relative-relocs \
+//		-o librelr-386.so relr.c
+//	strip librelr-amd64.so librelr-386.so
+//
+// using GNU ld 2.40. The pointers of table need relative relocations:
+// its first 70 words take an address and bitmaps, and its last one an
+// address of its own.
+
+static int v[2];
+
+int *table[200] = {
+	[0 ... 69] = &v[0],
+	[199] = &v[1],
+};
@@ -0,0 +1,14 @@
+// libverdef-amd64.so is built with
+//
+//	gcc -shared -nostdlib -fPIC -Wl,--hash-style=gnu \
+//		-Wl,-soname,libverdef.so -Wl,--version-script=verdef.map \
+//		-o libverdef-amd64.so verdef.c
+//	strip libverdef-amd64.so
+//
+// where verdef.map is
+//
+//	V1 { global: one; local: *; };
+//	V2 { global: two; } V1;
+
+int one(void) { return 1; }
+int two(void) { return 2; }
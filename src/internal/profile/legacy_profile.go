@@ -176,7 +176,10 @@ func (p *Profile) remapFunctionIDs() {
 // and updates them appropriately. This is O(N*M), if this ever shows
 // up as a bottleneck, evaluate sorting the mappings and doing a
 // binary search, which would make it O(N*log(M)).
-func (p *Profile) remapMappingIDs() {
+//
+// headers holds, for each file whose start is mapped without being
+// executable, the end of that mapping.
+func (p *Profile) remapMappingIDs(headers map[string]uint64) {
 	if len(p.Mapping) == 0 {
 		return
 	}
@@ -193,9 +196,11 @@ func (p *Profile) remapMappingIDs() {
 	}
 
 	// Subtract the offset from the start of the main mapping if it
-	// ends up at a recognizable start address.
+	// ends up at a recognizable start address. This does not apply
+	// when the mapping follows the non-executable start of its file,
+	// as when the ELF headers are mapped apart from the text.
 	const expectedStart = 0x400000
-	if m := p.Mapping[0]; m.Start-m.Offset == expectedStart {
+	if m := p.Mapping[0]; m.Start-m.Offset == expectedStart && headers[m.File] != m.Start {
 		m.Start = expectedStart
 		m.Offset = 0
 	}
@@ -1027,6 +1032,7 @@ func (p *Profile) ParseMemoryMap(rd io.Reader) error {
 
 	var attrs []string
 	var r *strings.Replacer
+	headers := make(map[string]uint64)
 	const delimiter = "="
 	for {
 		l, err := b.ReadString('\n')
@@ -1059,7 +1065,13 @@ func (p *Profile) ParseMemoryMap(rd io.Reader) error {
 			}
 			return err
 		}
-		if m == nil || (m.File == "" && len(p.Mapping) != 0) {
+		if m == nil {
+			if file, limit, ok := parseHeaderEntry(l); ok {
+				headers[file] = limit
+			}
+			continue
+		}
+		if m.File == "" && len(p.Mapping) != 0 {
 			// In some cases the first entry may include the address range
 			// but not the name of the file. It should be followed by
 			// another entry with the name.
@@ -1074,10 +1086,28 @@ func (p *Profile) ParseMemoryMap(rd io.Reader) error {
 	}
 	p.remapLocationIDs()
 	p.remapFunctionIDs()
-	p.remapMappingIDs()
+	p.remapMappingIDs(headers)
 	return nil
 }
 
+// parseHeaderEntry returns the file and the end address of a
+// /proc/self/maps entry that maps the start of a file without making
+// it executable.
+func parseHeaderEntry(l string) (file string, limit uint64, ok bool) {
+	me := procMapsRE.FindStringSubmatch(l)
+	if len(me) != 9 || strings.Contains(me[3], "x") || me[8] == "" {
+		return "", 0, false
+	}
+	if offset, err := strconv.ParseUint(me[4], 16, 64); err != nil || offset != 0 {
+		return "", 0, false
+	}
+	limit, err := strconv.ParseUint(me[2], 16, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return me[8], limit, true
+}
+
 func parseMappingEntry(l string) (*Mapping, error) {
 	mapping := &Mapping{}
 	var err error
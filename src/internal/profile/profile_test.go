@@ -77,3 +77,51 @@ sampling period=1
 	}
 
 }
+
+func TestParseMemoryMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		start uint64
+	}{
+		{
+			name: "text at start",
+			in: `00400000-00480000 r-xp 00000000 00:1d 1234 /bin/prog
+00480000-00500000 r--p 00080000 00:1d 1234 /bin/prog
+`,
+			start: 0x400000,
+		},
+		{
+			// The main mapping is moved to the start address when
+			// the text before it was remapped.
+			name: "remapped text",
+			in: `00400000-00600000 rw-p 00000000 00:00 0 /anon_hugepage
+00600000-00680000 r-xp 00200000 00:1d 1234 /bin/prog
+`,
+			start: 0x400000,
+		},
+		{
+			// But not when the headers are mapped apart from it.
+			name: "separate headers",
+			in: `00400000-00401000 r--p 00000000 00:1d 1234 /bin/prog
+00401000-00480000 r-xp 00001000 00:1d 1234 /bin/prog
+00480000-00500000 r--p 00080000 00:1d 1234 /bin/prog
+`,
+			start: 0x401000,
+		},
+	}
+	for _, tc := range tests {
+		p := &Profile{}
+		if err := p.ParseMemoryMap(bytes.NewBufferString(tc.in)); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(p.Mapping) == 0 {
+			t.Errorf("%s: no mappings", tc.name)
+			continue
+		}
+		if got := p.Mapping[0].Start; got != tc.start {
+			t.Errorf("%s: main mapping starts at %#x, want %#x", tc.name, got, tc.start)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// A decoder holds the state of a frame kept from block to block.
+type decoder struct {
+	window  uint64      // window size of the frame
+	huff    []huffEntry // literals Huffman table
+	huffLog uint
+	seq     [3]fseTable // literal length, offset and match length tables
+	rep     [3]uint32   // repeated offsets
+	lits    []byte
+}
+
+// reset prepares d for a new frame with the given window size.
+func (d *decoder) reset(window uint64) {
+	d.window = window
+	d.huff = nil
+	for i := range d.seq {
+		d.seq[i].table = d.seq[i].table[:0]
+	}
+	d.rep = [3]uint32{1, 4, 8}
+}
+
+// block decodes the compressed block b, appending its content to dst,
+// in which the frame starts at start.
+func (d *decoder) block(dst []byte, start int, b []byte) ([]byte, error) {
+	n, err := d.literals(b)
+	if err != nil {
+		return nil, err
+	}
+	return d.sequences(dst, start, b[n:])
+}
+
+// literals decodes the literals section at the start of b into d.lits,
+// and returns its size.
+func (d *decoder) literals(b []byte) (int, error) {
+	if len(b) < 1 {
+		return 0, errCorrupt
+	}
+	typ := b[0] & 3
+	sizeFormat := b[0] >> 2 & 3
+	if typ < 2 {
+		// Raw or RLE literals.
+		var size, hdr int
+		switch sizeFormat {
+		case 0, 2:
+			size, hdr = int(b[0]>>3), 1
+		case 1:
+			if len(b) < 2 {
+				return 0, errCorrupt
+			}
+			size, hdr = int(b[0]>>4)|int(b[1])<<4, 2
+		case 3:
+			if len(b) < 3 {
+				return 0, errCorrupt
+			}
+			size, hdr = int(b[0]>>4)|int(b[1])<<4|int(b[2])<<12, 3
+		}
+		if size > blockMaxSize {
+			return 0, errCorrupt
+		}
+		d.lits = d.lits[:0]
+		if typ == 0 {
+			if len(b) < hdr+size {
+				return 0, errCorrupt
+			}
+			d.lits = append(d.lits, b[hdr:hdr+size]...)
+			return hdr + size, nil
+		}
+		if len(b) < hdr+1 {
+			return 0, errCorrupt
+		}
+		for i := 0; i < size; i++ {
+			d.lits = append(d.lits, b[hdr])
+		}
+		return hdr + 1, nil
+	}
+
+	// Huffman coded literals, with a new table or the previous one.
+	var regen, comp, hdr int
+	streams := 4
+	switch sizeFormat {
+	case 0, 1:
+		if len(b) < 3 {
+			return 0, errCorrupt
+		}
+		if sizeFormat == 0 {
+			streams = 1
+		}
+		regen = int(b[0]>>4) | int(b[1]&0x3f)<<4
+		comp = int(b[1]>>6) | int(b[2])<<2
+		hdr = 3
+	case 2:
+		if len(b) < 4 {
+			return 0, errCorrupt
+		}
+		regen = int(b[0]>>4) | int(b[1])<<4 | int(b[2]&3)<<12
+		comp = int(b[2]>>2) | int(b[3])<<6
+		hdr = 4
+	case 3:
+		if len(b) < 5 {
+			return 0, errCorrupt
+		}
+		regen = int(b[0]>>4) | int(b[1])<<4 | int(b[2]&0x3f)<<12
+		comp = int(b[2]>>6) | int(b[3])<<2 | int(b[4])<<10
+		hdr = 5
+	}
+	if regen > blockMaxSize || len(b) < hdr+comp {
+		return 0, errCorrupt
+	}
+	data := b[hdr : hdr+comp]
+	if typ == 2 {
+		n, err := d.readHuff(data)
+		if err != nil {
+			return 0, err
+		}
+		data = data[n:]
+	} else if d.huff == nil {
+		return 0, errCorrupt
+	}
+
+	if cap(d.lits) < regen {
+		d.lits = make([]byte, regen)
+	}
+	d.lits = d.lits[:regen]
+	if streams == 1 {
+		if err := d.huffStream(d.lits, data); err != nil {
+			return 0, err
+		}
+		return hdr + comp, nil
+	}
+	if len(data) < 6 {
+		return 0, errCorrupt
+	}
+	var sizes [4]int
+	total := 6
+	for i := 0; i < 3; i++ {
+		sizes[i] = int(binary.LittleEndian.Uint16(data[2*i:]))
+		total += sizes[i]
+	}
+	if total > len(data) {
+		return 0, errCorrupt
+	}
+	sizes[3] = len(data) - total
+	data = data[6:]
+	seg := (regen + 3) / 4
+	if 3*seg > regen {
+		return 0, errCorrupt
+	}
+	out := d.lits
+	for i, size := range sizes {
+		n := seg
+		if i == 3 {
+			n = len(out)
+		}
+		if err := d.huffStream(out[:n], data[:size]); err != nil {
+			return 0, err
+		}
+		out = out[n:]
+		data = data[size:]
+	}
+	return hdr + comp, nil
+}
+
+// A huffEntry is an entry of a Huffman decoding table, indexed by
+// the next huffLog bits of the stream.
+type huffEntry struct {
+	sym  byte
+	bits uint8
+}
+
+// readHuff reads the Huffman tree description at the start of b into
+// d.huff, and returns its size.
+func (d *decoder) readHuff(b []byte) (int, error) {
+	if len(b) < 1 {
+		return 0, errCorrupt
+	}
+	var weights []byte
+	var n int
+	if hdr := int(b[0]); hdr < 128 {
+		// FSE compressed weights.
+		if len(b) < 1+hdr {
+			return 0, errCorrupt
+		}
+		var err error
+		weights, err = fseWeights(b[1 : 1+hdr])
+		if err != nil {
+			return 0, err
+		}
+		n = 1 + hdr
+	} else {
+		// Weights stored as 4 bit numbers.
+		count := hdr - 127
+		n = 1 + (count+1)/2
+		if len(b) < n {
+			return 0, errCorrupt
+		}
+		weights = make([]byte, count)
+		for i := range weights {
+			w := b[1+i/2]
+			if i%2 == 0 {
+				w >>= 4
+			}
+			weights[i] = w & 0xf
+		}
+	}
+
+	// The weight of the last symbol is implied: it completes the
+	// sum of the weights to a power of 2.
+	var total uint32
+	for _, w := range weights {
+		if w > 11 {
+			return 0, errCorrupt
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return 0, errCorrupt
+	}
+	maxBits := uint(bits.Len32(total))
+	left := uint32(1)<<maxBits - total
+	if left&(left-1) != 0 || maxBits > 11 || len(weights) > 255 {
+		return 0, errCorrupt
+	}
+	weights = append(weights, byte(bits.Len32(left)))
+
+	// Codes are assigned from the smallest weights up, in symbol
+	// order within each weight.
+	var rankStart [13]uint32
+	var rankCount [13]uint32
+	for _, w := range weights {
+		rankCount[w]++
+	}
+	pos := uint32(0)
+	for w := 1; w <= int(maxBits); w++ {
+		rankStart[w] = pos
+		pos += rankCount[w] << (w - 1)
+	}
+	table := make([]huffEntry, 1<<maxBits)
+	for sym, w := range weights {
+		if w == 0 {
+			continue
+		}
+		n := uint32(1) << (w - 1)
+		e := huffEntry{byte(sym), uint8(maxBits + 1 - uint(w))}
+		for i := rankStart[w]; i < rankStart[w]+n; i++ {
+			table[i] = e
+		}
+		rankStart[w] += n
+	}
+	d.huff, d.huffLog = table, maxBits
+	return n, nil
+}
+
+// fseWeights decodes the FSE compressed Huffman weights in b.
+func fseWeights(b []byte) ([]byte, error) {
+	norm, al, n, err := readNCount(b, 255, 6)
+	if err != nil {
+		return nil, err
+	}
+	var t fseTable
+	if err := t.build(norm, al); err != nil {
+		return nil, err
+	}
+	r, err := newBitReader(b[n:])
+	if err != nil {
+		return nil, err
+	}
+	// Two interleaved states, the stream ends when reading the
+	// update of one of them would overflow it.
+	state1 := uint32(r.read(al))
+	state2 := uint32(r.read(al))
+	var weights []byte
+	for {
+		if len(weights) > 253 {
+			return nil, errCorrupt
+		}
+		e := t.table[state1]
+		weights = append(weights, e.sym)
+		if r.pos < int(e.bits) {
+			weights = append(weights, t.table[state2].sym)
+			break
+		}
+		state1 = uint32(e.base) + uint32(r.read(uint(e.bits)))
+		e = t.table[state2]
+		weights = append(weights, e.sym)
+		if r.pos < int(e.bits) {
+			weights = append(weights, t.table[state1].sym)
+			break
+		}
+		state2 = uint32(e.base) + uint32(r.read(uint(e.bits)))
+	}
+	return weights, nil
+}
+
+// huffStream decodes the Huffman coded stream b into out.
+func (d *decoder) huffStream(out, b []byte) error {
+	r, err := newBitReader(b)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		e := d.huff[r.peek(d.huffLog)]
+		out[i] = e.sym
+		r.pos -= int(e.bits)
+	}
+	if r.pos != 0 {
+		return errCorrupt
+	}
+	return nil
+}
+
+// sequences decodes the sequences section b and executes the sequences
+// with the literals, appending the result to dst.
+func (d *decoder) sequences(dst []byte, start int, b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return nil, errCorrupt
+	}
+	var nseq int
+	switch {
+	case b[0] < 128:
+		nseq, b = int(b[0]), b[1:]
+	case b[0] < 255:
+		if len(b) < 2 {
+			return nil, errCorrupt
+		}
+		nseq, b = int(b[0]-128)<<8|int(b[1]), b[2:]
+	default:
+		if len(b) < 3 {
+			return nil, errCorrupt
+		}
+		nseq, b = int(b[1])|int(b[2])<<8+0x7f00, b[3:]
+	}
+	if nseq == 0 {
+		if len(b) != 0 {
+			return nil, errCorrupt
+		}
+		return append(dst, d.lits...), nil
+	}
+
+	if len(b) < 1 || b[0]&3 != 0 {
+		return nil, errCorrupt
+	}
+	modes := b[0]
+	b = b[1:]
+	tables := [3]struct {
+		mode   byte
+		def    []int16
+		defLog uint
+		maxLog uint
+		maxSym int
+	}{
+		{modes >> 6, llDefault, llDefaultLog, llMaxLog, len(llBase) - 1},
+		{modes >> 4 & 3, ofDefault, ofDefaultLog, ofMaxLog, 31},
+		{modes >> 2 & 3, mlDefault, mlDefaultLog, mlMaxLog, len(mlBase) - 1},
+	}
+	for i, tab := range tables {
+		t := &d.seq[i]
+		switch tab.mode {
+		case 0: // predefined
+			if err := t.build(tab.def, tab.defLog); err != nil {
+				return nil, err
+			}
+		case 1: // RLE
+			if len(b) < 1 || int(b[0]) > tab.maxSym {
+				return nil, errCorrupt
+			}
+			t.rle(b[0])
+			b = b[1:]
+		case 2: // FSE compressed
+			norm, al, n, err := readNCount(b, tab.maxSym, tab.maxLog)
+			if err != nil {
+				return nil, err
+			}
+			if err := t.build(norm, al); err != nil {
+				return nil, err
+			}
+			b = b[n:]
+		case 3: // repeat
+			if len(t.table) == 0 {
+				return nil, errCorrupt
+			}
+		}
+	}
+
+	r, err := newBitReader(b)
+	if err != nil {
+		return nil, err
+	}
+	ll, of, ml := &d.seq[0], &d.seq[1], &d.seq[2]
+	llState := uint32(r.read(ll.log))
+	ofState := uint32(r.read(of.log))
+	mlState := uint32(r.read(ml.log))
+	lits := d.lits
+	for i := 0; i < nseq; i++ {
+		ofCode := of.table[ofState].sym
+		mlCode := ml.table[mlState].sym
+		llCode := ll.table[llState].sym
+		if ofCode > 31 || int(mlCode) >= len(mlBase) || int(llCode) >= len(llBase) {
+			return nil, errCorrupt
+		}
+		offset := uint32(1)<<ofCode + uint32(r.read(uint(ofCode)))
+		matchLen := uint32(mlBase[mlCode]) + uint32(r.read(uint(mlBits[mlCode])))
+		litLen := uint32(llBase[llCode]) + uint32(r.read(uint(llBits[llCode])))
+		if i < nseq-1 {
+			llState = ll.next(llState, &r)
+			mlState = ml.next(mlState, &r)
+			ofState = of.next(ofState, &r)
+		}
+		if r.pos < 0 {
+			return nil, errCorrupt
+		}
+
+		if offset > 3 {
+			offset -= 3
+			d.rep[2], d.rep[1], d.rep[0] = d.rep[1], d.rep[0], offset
+		} else {
+			idx := offset
+			if litLen == 0 {
+				idx++
+			}
+			switch idx {
+			case 1:
+				offset = d.rep[0]
+			case 2:
+				offset = d.rep[1]
+				d.rep[1], d.rep[0] = d.rep[0], offset
+			case 3:
+				offset = d.rep[2]
+				d.rep[2], d.rep[1], d.rep[0] = d.rep[1], d.rep[0], offset
+			case 4:
+				offset = d.rep[0] - 1
+				d.rep[2], d.rep[1], d.rep[0] = d.rep[1], d.rep[0], offset
+			}
+		}
+
+		if uint32(len(lits)) < litLen {
+			return nil, errCorrupt
+		}
+		dst = append(dst, lits[:litLen]...)
+		lits = lits[litLen:]
+		if offset == 0 || uint64(offset) > uint64(len(dst)-start) || uint64(offset) > d.window {
+			return nil, errCorrupt
+		}
+		from := len(dst) - int(offset)
+		if int(matchLen) <= int(offset) {
+			dst = append(dst, dst[from:from+int(matchLen)]...)
+		} else {
+			// The match overlaps the bytes it produces.
+			for j := 0; j < int(matchLen); j++ {
+				dst = append(dst, dst[from+j])
+			}
+		}
+	}
+	if r.pos != 0 {
+		return nil, errCorrupt
+	}
+	return append(dst, lits...), nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	skippableMagic  = 0x184D2A50 // the low 4 bits are user data
+	windowLogLimit  = 41         // the largest window descriptor allows
+	maxFrameHdrSize = 14         // after the magic number
+)
+
+var errCorrupt = errors.New("zstd: corrupt input")
+
+// A Reader decompresses the zstd frames read from an underlying reader.
+// It decodes a block at a time, keeping the window of the frame the
+// next blocks may copy from.
+type Reader struct {
+	r   io.Reader
+	err error // sticky; io.EOF after the last frame
+
+	// buf holds the window of the current frame followed by the
+	// content not read yet, which starts at off.
+	buf []byte
+	off int
+
+	frames   int  // frames read, including skippable ones
+	inFrame  bool // between the header and the end of a frame
+	start    int  // start of the frame in buf, 0 once out of buf
+	hasSize  bool
+	size     uint64 // content size the frame header records
+	produced uint64 // content of the frame decoded so far
+	checksum bool
+	hash     xxhash64
+
+	block []byte // compressed block being decoded
+	d     decoder
+}
+
+// NewReader returns a Reader decompressing the data read from r. The
+// data must hold at least one frame; a stream ending within a frame is
+// reported as io.ErrUnexpectedEOF.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Read reads decompressed data into p.
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.off == len(r.buf) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.inFrame {
+			r.err = r.nextBlock()
+		} else {
+			r.err = r.nextFrame()
+		}
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// readFull fills b from the underlying reader, for data that must be
+// there.
+func (r *Reader) readFull(b []byte) error {
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// nextFrame reads the header of the next frame, or skips a skippable
+// frame.
+func (r *Reader) nextFrame() error {
+	var hdr [4 + maxFrameHdrSize]byte
+	if _, err := io.ReadFull(r.r, hdr[:4]); err != nil {
+		if err == io.EOF && r.frames > 0 {
+			return io.EOF
+		}
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.frames++
+	magic := binary.LittleEndian.Uint32(hdr[:])
+	if magic&^0xF == skippableMagic {
+		if err := r.readFull(hdr[:4]); err != nil {
+			return err
+		}
+		n := int64(binary.LittleEndian.Uint32(hdr[:]))
+		if m, err := io.CopyN(io.Discard, r.r, n); m < n {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		return nil
+	}
+	if magic != frameMagic {
+		return errors.New("zstd: not a zstd frame")
+	}
+
+	if err := r.readFull(hdr[:1]); err != nil {
+		return err
+	}
+	desc := hdr[0]
+	fcsFlag := desc >> 6
+	single := desc&0x20 != 0
+	if desc&0x08 != 0 {
+		return errCorrupt // reserved bit
+	}
+	windowSize := 0
+	if !single {
+		windowSize = 1
+	}
+	dictSize := [4]int{0, 1, 2, 4}[desc&3]
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && single {
+		fcsSize = 1
+	}
+	b := hdr[:windowSize+dictSize+fcsSize]
+	if err := r.readFull(b); err != nil {
+		return err
+	}
+
+	var window uint64
+	if !single {
+		exp := uint(b[0] >> 3)
+		if exp+10 > windowLogLimit {
+			return errCorrupt
+		}
+		base := uint64(1) << (exp + 10)
+		window = base + base/8*uint64(b[0]&7)
+		b = b[1:]
+	}
+	for _, c := range b[:dictSize] {
+		if c != 0 {
+			return errors.New("zstd: dictionaries are not supported")
+		}
+	}
+	b = b[dictSize:]
+	r.size = 0
+	switch fcsSize {
+	case 1:
+		r.size = uint64(b[0])
+	case 2:
+		r.size = uint64(binary.LittleEndian.Uint16(b)) + 256
+	case 4:
+		r.size = uint64(binary.LittleEndian.Uint32(b))
+	case 8:
+		r.size = binary.LittleEndian.Uint64(b)
+	}
+	if single {
+		window = r.size
+	}
+
+	// The blocks of a frame cannot refer to the previous frames,
+	// whose content has all been read.
+	r.buf, r.off, r.start = r.buf[:0], 0, 0
+	r.inFrame = true
+	r.hasSize = fcsSize > 0
+	r.produced = 0
+	r.checksum = desc&0x04 != 0
+	r.hash.reset()
+	r.d.reset(window)
+	return nil
+}
+
+// nextBlock decodes the next block of the frame into buf.
+func (r *Reader) nextBlock() error {
+	var hdr [3]byte
+	if err := r.readFull(hdr[:]); err != nil {
+		return err
+	}
+	h := uint32(hdr[0]) | uint32(hdr[1])<<8 | uint32(hdr[2])<<16
+	last := h&1 != 0
+	size := int(h >> 3)
+	if size > blockMaxSize {
+		return errCorrupt
+	}
+
+	r.compact()
+	from := len(r.buf)
+	switch h >> 1 & 3 {
+	case 0: // raw
+		buf := grow(r.buf, size)
+		if err := r.readFull(buf[from:]); err != nil {
+			return err
+		}
+		r.buf = buf
+	case 1: // RLE
+		if err := r.readFull(hdr[:1]); err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			r.buf = append(r.buf, hdr[0])
+		}
+	case 2: // compressed
+		r.block = grow(r.block[:0], size)
+		if err := r.readFull(r.block); err != nil {
+			return err
+		}
+		buf, err := r.d.block(r.buf, r.start, r.block)
+		if err != nil {
+			return err
+		}
+		r.buf = buf
+	default:
+		return errCorrupt
+	}
+	r.produced += uint64(len(r.buf) - from)
+	if r.checksum {
+		r.hash.write(r.buf[from:])
+	}
+	if last {
+		return r.endFrame()
+	}
+	return nil
+}
+
+// endFrame checks the content of the frame against its header and its
+// checksum.
+func (r *Reader) endFrame() error {
+	r.inFrame = false
+	if r.hasSize && r.produced != r.size {
+		return fmt.Errorf("zstd: frame has %d bytes, header says %d", r.produced, r.size)
+	}
+	if r.checksum {
+		var b [4]byte
+		if err := r.readFull(b[:]); err != nil {
+			return err
+		}
+		if uint32(r.hash.sum64()) != binary.LittleEndian.Uint32(b[:]) {
+			return errors.New("zstd: checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// compact drops the start of buf, which has all been read, when more
+// than twice the window precedes the next block. Moving the window to
+// the start of buf then costs no more than decoding what is dropped.
+func (r *Reader) compact() {
+	window := r.d.window
+	if uint64(len(r.buf)) <= 2*window {
+		return
+	}
+	drop := len(r.buf) - int(window)
+	n := copy(r.buf, r.buf[drop:])
+	r.buf = r.buf[:n]
+	r.off -= drop
+	r.start -= drop
+	if r.start < 0 {
+		r.start = 0
+	}
+}
+
+// grow returns b extended by n bytes.
+func grow(b []byte, n int) []byte {
+	if cap(b)-len(b) < n {
+		nb := make([]byte, len(b), 2*cap(b)+n)
+		copy(nb, b)
+		b = nb
+	}
+	return b[:len(b)+n]
+}
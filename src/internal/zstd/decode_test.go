@@ -0,0 +1,244 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// testData returns inputs exercising the different kinds of zstd
+// blocks, literals and sequences.
+func testData() []struct {
+	name string
+	data []byte
+} {
+	r := rand.New(rand.NewSource(1))
+	random := func(n int, alphabet int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(r.Intn(alphabet))
+		}
+		return b
+	}
+	text := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog; ", 100))
+	var mixed []byte
+	for len(mixed) < 600<<10 {
+		mixed = append(mixed, text[:r.Intn(len(text))]...)
+		mixed = append(mixed, random(r.Intn(300), 256)...)
+		mixed = append(mixed, bytes.Repeat([]byte{0}, r.Intn(100))...)
+	}
+	return []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"byte", []byte{42}},
+		{"short", []byte("hello, world\n")},
+		{"rle", bytes.Repeat([]byte{7}, 300<<10)},
+		{"text", text},
+		{"random", random(200<<10, 256)},
+		{"skewed", random(100<<10, 5)},
+		{"mixed", mixed},
+	}
+}
+
+// rawFrame returns a frame holding data in raw blocks of at most
+// blockSize bytes, with the content size and a checksum.
+func rawFrame(data []byte, blockSize int) []byte {
+	var h xxhash64
+	h.reset()
+	h.write(data)
+	b := make([]byte, 13, 13+len(data)+3*(len(data)/blockSize+1)+4)
+	binary.LittleEndian.PutUint32(b, frameMagic)
+	b[4] = 0xE4 // 8 byte content size, single segment, checksum
+	binary.LittleEndian.PutUint64(b[5:], uint64(len(data)))
+	for first := true; first || len(data) > 0; first = false {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		hdr := uint32(n) << 3
+		if n == len(data) {
+			hdr |= 1 // last
+		}
+		b = append(b, byte(hdr), byte(hdr>>8), byte(hdr>>16))
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	sum := uint32(h.sum64())
+	return append(b, byte(sum), byte(sum>>8), byte(sum>>16), byte(sum>>24))
+}
+
+// compress compresses data with the zstd command, passing it the file
+// holding data unless stream is set, in which case the frame does not
+// record the content size.
+func compress(t *testing.T, zstd string, data []byte, stream bool, args ...string) []byte {
+	args = append([]string{"-c", "-q"}, args...)
+	cmd := exec.Command(zstd, args...)
+	if stream {
+		cmd.Stdin = bytes.NewReader(data)
+	} else {
+		file := filepath.Join(t.TempDir(), "data")
+		if err := os.WriteFile(file, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		cmd.Args = append(cmd.Args, file)
+	}
+	z, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %v", cmd.Args, err)
+	}
+	return z
+}
+
+func TestReader(t *testing.T) {
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		t.Skip("zstd not found")
+	}
+	levels := [][]string{
+		{"-1"},
+		{"-3"},
+		{"-19"},
+		{"--ultra", "-22"},
+		{"--fast=5"},
+		{"-3", "--zstd=wlog=10"}, // a window smaller than the blocks
+		{"-3", "--no-check"},
+	}
+	for _, test := range testData() {
+		for _, level := range levels {
+			for _, stream := range []bool{false, true} {
+				test, level, stream := test, level, stream
+				name := test.name + strings.Join(level, "")
+				if stream {
+					name += "-stream"
+				}
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+					z := compress(t, zstd, test.data, stream, level...)
+					got, err := io.ReadAll(NewReader(bytes.NewReader(z)))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, test.data) {
+						t.Errorf("Reader returned %d bytes, want the %d compressed bytes", len(got), len(test.data))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestReaderSmallReads(t *testing.T) {
+	data := testData()[len(testData())-1].data
+	z := rawFrame(data, 1000)
+	r := NewReader(iotest.OneByteReader(bytes.NewReader(z)))
+	got, err := io.ReadAll(iotest.HalfReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Reader returned %d bytes, want the %d compressed bytes", len(got), len(data))
+	}
+}
+
+func TestReaderFrames(t *testing.T) {
+	skippable := []byte{0x5A, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 1, 2, 3}
+	var z []byte
+	z = append(z, skippable...)
+	z = append(z, rawFrame([]byte("hello, "), 3)...)
+	z = append(z, skippable...)
+	z = append(z, rawFrame([]byte("world"), 128<<10)...)
+	got, err := io.ReadAll(NewReader(bytes.NewReader(z)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello, world" {
+		t.Errorf("got %q, want %q", got, "hello, world")
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	frames := [][]byte{rawFrame([]byte("hello, world\n"), 5)}
+	if zstd, err := exec.LookPath("zstd"); err == nil {
+		frames = append(frames, compress(t, zstd, testData()[len(testData())-1].data, false, "-3"))
+	}
+	for _, z := range frames {
+		step := len(z)/500 + 1
+		for n := 0; n < len(z); n += step {
+			_, err := io.ReadAll(NewReader(bytes.NewReader(z[:n])))
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("%d of %d bytes: got error %v, want %v", n, len(z), err, io.ErrUnexpectedEOF)
+			}
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	frame := rawFrame([]byte("hello, world\n"), 5)
+	edit := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), frame...))
+	}
+	tests := []struct {
+		name string
+		z    []byte
+		err  string
+	}{
+		{"magic", edit(func(b []byte) []byte { b[0]++; return b }), "not a zstd frame"},
+		{"reserved", edit(func(b []byte) []byte { b[4] |= 0x08; return b }), "corrupt input"},
+		{"size", edit(func(b []byte) []byte { b[5]++; return b }), "frame has 13 bytes, header says 14"},
+		{"checksum", edit(func(b []byte) []byte { b[len(b)-1]++; return b }), "checksum mismatch"},
+		{"block type", edit(func(b []byte) []byte { b[13] |= 6; return b }), "corrupt input"},
+		{"dictionary", []byte{0x28, 0xB5, 0x2F, 0xFD, 0x21, 1, 0, 1, 0, 0}, "dictionaries are not supported"},
+		{"offset", []byte{
+			0x28, 0xB5, 0x2F, 0xFD, 0x20, 4,
+			0x45, 0, 0, // last compressed block of 8 bytes
+			0x08, 'a', // 1 raw literal
+			1, 0x54, 1, 2, 0, // 1 sequence with RLE codes: 1 literal, offset 2 bits, match length 3
+			0x05, // offset 5, which is 2 back
+		}, "corrupt input"},
+	}
+	for _, test := range tests {
+		_, err := io.ReadAll(NewReader(bytes.NewReader(test.z)))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	var h xxhash64
+	h.reset()
+	if got, want := h.sum64(), uint64(0xEF46DB3751D8E999); got != want {
+		t.Errorf("empty input: got %#x, want %#x", got, want)
+	}
+
+	data := testData()[len(testData())-1].data[:1000]
+	h.write(data)
+	want := h.sum64()
+	for _, n := range []int{1, 7, 31, 32, 33, 100} {
+		h.reset()
+		for b := data; len(b) > 0; {
+			k := n
+			if k > len(b) {
+				k = len(b)
+			}
+			h.write(b[:k])
+			b = b[k:]
+		}
+		if got := h.sum64(); got != want {
+			t.Errorf("writes of %d bytes: got %#x, want %#x", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,948 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// A Zstandard compressor, for -compressdwarf=zstd. It writes a single
+// frame, as described in RFC 8878, of compressed blocks: the matches
+// are found with hash chains, the literals are Huffman coded and the
+// sequences are FSE coded with the predefined or computed tables,
+// whichever is smaller. It aims at doing better than zlib at
+// zlib.BestSpeed, which the linker uses, at a similar speed, not at
+// the ratio of the reference implementation.
+
+const (
+	minWindowLog = 17 // holds a whole block
+	maxWindowLog = 20
+	minMatch     = 4
+	hashLog      = 17
+	chainDepth   = 16
+	maxHuffBits  = 11
+)
+
+// A sequence is literals followed by a match.
+type sequence struct {
+	litLen   int32
+	matchLen int32
+	offset   int32
+}
+
+// Compress appends the Zstandard frame holding src to dst.
+func Compress(dst, src []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(dst)
+	z := NewWriter(&buf, int64(len(src)))
+	z.Write(src)
+	z.Close()
+	return buf.Bytes()
+}
+
+// A Writer compresses the data written to it, whose size it is
+// told beforehand, into a Zstandard frame. It encodes each block once
+// it has the block and the few bytes after it, and keeps only the last
+// window of the data before the block to find the matches in, so the
+// frame is the same whether the data comes in one piece or not.
+type Writer struct {
+	w     io.Writer
+	total int64 // size of the data
+	start int64 // the position of the next block
+	e     encoder
+	err   error
+}
+
+// NewWriter returns a Writer of the frame holding total bytes,
+// which writes the frame header to w right away.
+func NewWriter(w io.Writer, total int64) *Writer {
+	windowLog := bits.Len(uint(total))
+	if windowLog < minWindowLog {
+		windowLog = minWindowLog
+	}
+	if windowLog > maxWindowLog {
+		windowLog = maxWindowLog
+	}
+	z := &Writer{
+		w:     w,
+		total: total,
+		e: encoder{
+			total: int(total),
+			head:  make([]int32, 1<<hashLog),
+			chain: make([]int32, 1<<windowLog),
+			mask:  1<<windowLog - 1,
+		},
+	}
+
+	// Frame header: the window size and the content size, with no
+	// checksum.
+	var b [8]byte
+	dst := make([]byte, 0, 14)
+	binary.LittleEndian.PutUint32(b[:], frameMagic)
+	dst = append(dst, b[:4]...)
+	if uint64(total) < 1<<32 {
+		dst = append(dst, 2<<6, byte(windowLog-10)<<3)
+		binary.LittleEndian.PutUint32(b[:], uint32(total))
+		dst = append(dst, b[:4]...)
+	} else {
+		dst = append(dst, 3<<6, byte(windowLog-10)<<3)
+		binary.LittleEndian.PutUint64(b[:], uint64(total))
+		dst = append(dst, b[:8]...)
+	}
+	if total == 0 {
+		dst = blockHeader(dst, true, 0, 0)
+	}
+	_, z.err = w.Write(dst)
+	if total > math.MaxInt32 {
+		// The positions in the data are int32s.
+		z.err = errors.New("zstd: data too large")
+	}
+	return z
+}
+
+// Write adds p to the data, and writes out the blocks it completes.
+func (z *Writer) Write(p []byte) (int, error) {
+	e := &z.e
+	if z.err != nil {
+		return 0, z.err
+	}
+	if int64(e.base)+int64(len(e.src))+int64(len(p)) > z.total {
+		return 0, errors.New("zstd: more data than declared")
+	}
+	e.src = append(e.src, p...)
+	for z.err == nil && z.start < z.total {
+		end := z.start + blockMaxSize
+		if end > z.total {
+			end = z.total
+		}
+		// Inserting the positions up to the end of the block
+		// into the hash chains reads 3 bytes past it.
+		need := end + 3
+		if need > z.total {
+			need = z.total
+		}
+		if int64(e.base)+int64(len(e.src)) < need {
+			break
+		}
+		z.block(int(z.start), int(end))
+		z.start = end
+	}
+	// Drop the data before the window of the next block.
+	if drop := int(z.start) - int(e.mask) - int(e.base); drop > blockMaxSize {
+		n := copy(e.src, e.src[drop:])
+		e.src = e.src[:n]
+		e.base += int32(drop)
+	}
+	return len(p), z.err
+}
+
+// block writes the block src[start:end].
+func (z *Writer) block(start, end int) {
+	e := &z.e
+	var dst []byte
+	last := int64(end) == z.total
+	block := e.src[start-int(e.base) : end-int(e.base)]
+	switch {
+	case isRLE(block):
+		dst = blockHeader(e.out[:0], last, 1, len(block))
+		dst = append(dst, block[0])
+	default:
+		e.findSequences(start, end)
+		e.buf = e.encodeBlock(e.buf[:0])
+		if len(e.buf) < len(block) {
+			dst = blockHeader(e.out[:0], last, 2, len(e.buf))
+			dst = append(dst, e.buf...)
+		} else {
+			dst = blockHeader(e.out[:0], last, 0, len(block))
+			dst = append(dst, block...)
+		}
+	}
+	e.out = dst
+	_, z.err = z.w.Write(dst)
+}
+
+// Close reports whether all the data was written and compressed.
+func (z *Writer) Close() error {
+	if z.err == nil && z.start < z.total {
+		z.err = errors.New("zstd: less data than declared")
+	}
+	return z.err
+}
+
+// blockHeader appends a block header to dst.
+func blockHeader(dst []byte, last bool, typ, size int) []byte {
+	h := typ<<1 | size<<3
+	if last {
+		h |= 1
+	}
+	return append(dst, byte(h), byte(h>>8), byte(h>>16))
+}
+
+// isRLE reports whether b is a run of a single byte.
+func isRLE(b []byte) bool {
+	for _, c := range b[1:] {
+		if c != b[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// An encoder holds the state of the match finder, and the
+// sequences and literals of the current block.
+type encoder struct {
+	src   []byte  // the data from position base on
+	base  int32   // the position of src[0]
+	total int     // the size of all the data
+	head  []int32 // by hash, the last position plus 1
+	chain []int32 // by position, the previous position with the same hash plus 1
+	mask  int32   // of positions in chain, which is the window size minus 1
+
+	next int32 // the next position to insert into the hash chains
+	lits []byte
+	seqs []sequence
+	buf  []byte
+	out  []byte // the block written last
+}
+
+func hash(u uint32) uint32 {
+	return (u * 2654435761) >> (32 - hashLog)
+}
+
+// insert adds the positions up to p, exclusive, to the hash chains.
+func (e *encoder) insert(p int32) {
+	if e.next < e.base {
+		// Those before are out of the window of any match
+		// still to be found, see Writer.Write.
+		e.next = e.base
+	}
+	for ; e.next < p; e.next++ {
+		h := hash(binary.LittleEndian.Uint32(e.src[e.next-e.base:]))
+		e.chain[e.next&e.mask] = e.head[h]
+		e.head[h] = e.next + 1
+	}
+}
+
+// findSequences finds the sequences and literals of the block
+// from position start to end.
+func (e *encoder) findSequences(start, end int) {
+	src, b := e.src, e.base
+	e.lits = e.lits[:0]
+	e.seqs = e.seqs[:0]
+	anchor := int32(start)
+	for p := int32(start); int(p)+minMatch <= end; {
+		e.insert(p)
+		limit := int32(end) - p
+		var bestLen, bestPos int32
+		depth := chainDepth
+		for c := e.head[hash(binary.LittleEndian.Uint32(src[p-b:]))] - 1; c >= 0 && p-c <= e.mask && depth > 0; depth-- {
+			if bestLen == 0 || (bestLen < limit && src[c-b+bestLen] == src[p-b+bestLen]) {
+				n := matchLen(src[c-b:], src[p-b:p-b+limit])
+				if n > bestLen {
+					bestLen, bestPos = n, c
+					if n == limit {
+						break
+					}
+				}
+			}
+			next := e.chain[c&e.mask] - 1
+			if next >= c {
+				break
+			}
+			c = next
+		}
+		if bestLen < minMatch {
+			p++
+			continue
+		}
+		e.lits = append(e.lits, src[anchor-b:p-b]...)
+		e.seqs = append(e.seqs, sequence{litLen: p - anchor, matchLen: bestLen, offset: p - bestPos})
+		p += bestLen
+		anchor = p
+		if int(p)+4 <= e.total {
+			e.insert(p)
+		}
+	}
+	e.lits = append(e.lits, src[anchor-b:int32(end)-b]...)
+	if end+4 <= e.total {
+		e.insert(int32(end))
+	}
+}
+
+// matchLen returns the length of the common prefix of a and b,
+// where a is at least as long as b.
+func matchLen(a, b []byte) int32 {
+	n := 0
+	for ; n+8 <= len(b); n += 8 {
+		if x := binary.LittleEndian.Uint64(a[n:]) ^ binary.LittleEndian.Uint64(b[n:]); x != 0 {
+			return int32(n + bits.TrailingZeros64(x)/8)
+		}
+	}
+	for ; n < len(b) && a[n] == b[n]; n++ {
+	}
+	return int32(n)
+}
+
+// encodeBlock appends the contents of a compressed block holding the
+// current literals and sequences to dst.
+func (e *encoder) encodeBlock(dst []byte) []byte {
+	dst = encodeLiterals(dst, e.lits)
+	return encodeSequences(dst, e.seqs)
+}
+
+// encodeLiterals appends the literals section holding lits to dst.
+func encodeLiterals(dst, lits []byte) []byte {
+	if len(lits) > 1 && isRLE(lits) {
+		dst = rawLiteralsHeader(dst, 1, len(lits))
+		return append(dst, lits[0])
+	}
+	if len(lits) >= 64 {
+		if out, ok := huffLiterals(dst, lits); ok {
+			return out
+		}
+	}
+	dst = rawLiteralsHeader(dst, 0, len(lits))
+	return append(dst, lits...)
+}
+
+// rawLiteralsHeader appends the header of a raw or RLE literals
+// section to dst.
+func rawLiteralsHeader(dst []byte, typ, n int) []byte {
+	switch {
+	case n < 1<<5:
+		return append(dst, byte(typ|n<<3))
+	case n < 1<<12:
+		return append(dst, byte(typ|1<<2|n<<4), byte(n>>4))
+	default:
+		return append(dst, byte(typ|3<<2|n<<4), byte(n>>4), byte(n>>12))
+	}
+}
+
+// huffLiterals appends the literals section holding lits, Huffman
+// coded, to dst. It reports false if that is not smaller than the raw
+// literals.
+func huffLiterals(dst, lits []byte) ([]byte, bool) {
+	var freq [256]int
+	for _, c := range lits {
+		freq[c]++
+	}
+	lens := huffLengths(freq[:], maxHuffBits)
+	maxBits, last := 0, 0
+	for s, n := range lens {
+		if n > 0 {
+			last = s
+			if int(n) > maxBits {
+				maxBits = int(n)
+			}
+		}
+	}
+	if maxBits == 0 {
+		return dst, false
+	}
+
+	// The tree is described by the weights of the symbols up to the
+	// last one, whose weight is implied.
+	weights := make([]byte, last)
+	for s := range weights {
+		if lens[s] > 0 {
+			weights[s] = byte(maxBits + 1 - int(lens[s]))
+		}
+	}
+	body, ok := huffWeights(nil, weights)
+	if !ok {
+		return dst, false
+	}
+
+	// Canonical codes, from the longest, in symbol order.
+	var codes [256]uint16
+	code := 0
+	for n := maxBits; n > 0; n-- {
+		for s, l := range lens {
+			if int(l) == n {
+				codes[s] = uint16(code)
+				code++
+			}
+		}
+		code >>= 1
+	}
+	stream := func(dst, lits []byte) []byte {
+		var w bitWriter
+		w.out = dst
+		for i := len(lits) - 1; i >= 0; i-- {
+			c := lits[i]
+			w.addBits(uint64(codes[c]), uint(lens[c]))
+		}
+		return w.close()
+	}
+
+	n := len(lits)
+	var sizeFormat, sizeBits int
+	if n < 1<<10 {
+		body = stream(body, lits)
+	} else {
+		sizeFormat = 1
+		seg := (n + 3) / 4
+		jump := len(body)
+		body = append(body, make([]byte, 6)...)
+		start := len(body)
+		for i := 0; i < 4; i++ {
+			end := (i + 1) * seg
+			if end > n {
+				end = n
+			}
+			body = stream(body, lits[i*seg:end])
+			if i < 3 {
+				size := len(body) - start
+				if size >= 1<<16 {
+					return dst, false
+				}
+				binary.LittleEndian.PutUint16(body[jump+2*i:], uint16(size))
+				start = len(body)
+			}
+		}
+	}
+	cs := len(body)
+	switch {
+	case n < 1<<10 && cs < 1<<10:
+		sizeBits = 10
+	case sizeFormat == 0:
+		return dst, false
+	case n < 1<<14 && cs < 1<<14:
+		sizeFormat, sizeBits = 2, 14
+	case n < 1<<18 && cs < 1<<18:
+		sizeFormat, sizeBits = 3, 18
+	default:
+		return dst, false
+	}
+	hdrLen := (4 + 2*sizeBits + 7) / 8
+	if hdrLen+cs >= n+3 {
+		return dst, false
+	}
+	h := uint64(2) | uint64(sizeFormat)<<2 | uint64(n)<<4 | uint64(cs)<<(4+sizeBits)
+	for i := 0; i < hdrLen; i++ {
+		dst = append(dst, byte(h>>(8*i)))
+	}
+	return append(dst, body...), true
+}
+
+// huffLengths returns the lengths of the codes of a Huffman code
+// for the symbols with the frequencies freq, with codes no longer than
+// maxBits. At least two frequencies must be non-zero.
+func huffLengths(freq []int, maxBits int) []uint8 {
+	type leaf struct{ freq, sym int }
+	lens := make([]uint8, len(freq))
+	f := append([]int(nil), freq...)
+	for {
+		var leaves []leaf
+		for s, n := range f {
+			if n > 0 {
+				leaves = append(leaves, leaf{n, s})
+			}
+		}
+		if len(leaves) < 2 {
+			return lens
+		}
+		sort.Slice(leaves, func(i, j int) bool {
+			if leaves[i].freq != leaves[j].freq {
+				return leaves[i].freq < leaves[j].freq
+			}
+			return leaves[i].sym < leaves[j].sym
+		})
+
+		// The leaves are nodes 0 to n-1, and the inner nodes are
+		// created in order of weight after them, so that the two
+		// lightest nodes are always at the head of either list.
+		n := len(leaves)
+		weight := make([]int, 2*n-1)
+		parent := make([]int, 2*n-1)
+		for i, l := range leaves {
+			weight[i] = l.freq
+		}
+		nextLeaf, nextInner := 0, n
+		pick := func(created int) int {
+			if nextLeaf < n && (nextInner >= created || weight[nextLeaf] <= weight[nextInner]) {
+				nextLeaf++
+				return nextLeaf - 1
+			}
+			nextInner++
+			return nextInner - 1
+		}
+		for i := n; i < 2*n-1; i++ {
+			a, b := pick(i), pick(i)
+			weight[i] = weight[a] + weight[b]
+			parent[a], parent[b] = i, i
+		}
+		depth := make([]int, 2*n-1)
+		longest := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+		}
+		for i, l := range leaves {
+			lens[l.sym] = uint8(depth[i])
+			if depth[i] > longest {
+				longest = depth[i]
+			}
+		}
+		if longest <= maxBits {
+			return lens
+		}
+		// Flatten the distribution until the code is short enough.
+		for s := range f {
+			if f[s] > 0 {
+				f[s] = f[s]>>1 | 1
+			}
+		}
+	}
+}
+
+// huffWeights appends the description of a Huffman tree with the
+// given weights to dst: FSE coded if that is possible and smaller,
+// otherwise as 4-bit values.
+func huffWeights(dst, weights []byte) ([]byte, bool) {
+	if enc, ok := writeFSEWeights(weights); ok && len(enc) < 128 && (len(weights) > 128 || len(enc) < (len(weights)+1)/2) {
+		dst = append(dst, byte(len(enc)))
+		return append(dst, enc...), true
+	}
+	if len(weights) > 128 {
+		return dst, false
+	}
+	dst = append(dst, byte(127+len(weights)))
+	for i := 0; i < len(weights); i += 2 {
+		b := weights[i] << 4
+		if i+1 < len(weights) {
+			b |= weights[i+1]
+		}
+		dst = append(dst, b)
+	}
+	return dst, true
+}
+
+// writeFSEWeights returns the Huffman weights w FSE coded, with two
+// interleaved states.
+func writeFSEWeights(w []byte) ([]byte, bool) {
+	const al = 6
+	if len(w) < 2 {
+		return nil, false
+	}
+	var count [maxHuffBits + 1]int
+	maxSym := 0
+	for _, x := range w {
+		count[x]++
+		if int(x) > maxSym {
+			maxSym = int(x)
+		}
+	}
+	// The decoder stops when a state update would read past the
+	// end of the stream, so that every state must read some bits:
+	// no symbol may have more than half of the table.
+	norm := normalize(count[:maxSym+1], len(w), al, true)
+	if norm == nil {
+		return nil, false
+	}
+	out := writeNCount(nil, norm, al)
+	t := newFSEEncoder(norm, al)
+	var bw bitWriter
+	bw.out = out
+	var state [2]uint32
+	var started [2]bool
+	for i := len(w) - 1; i >= 0; i-- {
+		k := i & 1
+		if !started[k] {
+			state[k] = t.init(w[i])
+			started[k] = true
+		} else {
+			t.encode(&bw, &state[k], w[i])
+		}
+	}
+	bw.addBits(uint64(state[1]), al)
+	bw.addBits(uint64(state[0]), al)
+	return bw.close(), true
+}
+
+// normalize returns the distribution of count, which sums to
+// total, scaled to 1<<al, with every present symbol at least 1. If
+// capHalf is set, no symbol gets more than half. It returns nil if
+// there is no such distribution.
+func normalize(count []int, total, al int, capHalf bool) []int16 {
+	size := 1 << al
+	limit := size
+	if capHalf {
+		limit = size / 2
+	}
+	norm := make([]int16, len(count))
+	sum, present := 0, 0
+	for s, c := range count {
+		if c == 0 {
+			continue
+		}
+		present++
+		n := c * size / total
+		if n < 1 {
+			n = 1
+		}
+		if n > limit {
+			n = limit
+		}
+		norm[s] = int16(n)
+		sum += n
+	}
+	if present > size || (capHalf && present < 2) {
+		return nil
+	}
+	// Adjust the symbols whose probability is the furthest off.
+	for sum > size {
+		best := -1
+		for s, c := range count {
+			if norm[s] > 1 && (best < 0 || int(norm[s])*count[best] > int(norm[best])*c) {
+				best = s
+			}
+		}
+		norm[best]--
+		sum--
+	}
+	for sum < size {
+		best := -1
+		for s, c := range count {
+			if c > 0 && int(norm[s]) < limit && (best < 0 || c*int(norm[best]) > count[best]*int(norm[s])) {
+				best = s
+			}
+		}
+		norm[best]++
+		sum++
+	}
+	return norm
+}
+
+// writeNCount appends the description of the FSE table for the
+// distribution norm, with accuracy log al, to dst.
+func writeNCount(dst []byte, norm []int16, al int) []byte {
+	var w bitWriter
+	w.out = dst
+	w.addBits(uint64(al-5), 4)
+	size := 1 << al
+	remaining := size + 1
+	threshold := size
+	nbBits := uint(al + 1)
+	previous0 := false
+	for s := 0; s < len(norm) && remaining > 1; {
+		if previous0 {
+			start := s
+			for s < len(norm) && norm[s] == 0 {
+				s++
+			}
+			for s >= start+3 {
+				w.addBits(3, 2)
+				start += 3
+			}
+			w.addBits(uint64(s-start), 2)
+		}
+		n := int(norm[s])
+		s++
+		max := 2*threshold - 1 - remaining
+		if n < 0 {
+			remaining += n
+		} else {
+			remaining -= n
+		}
+		v := n + 1
+		if v >= threshold {
+			v += max
+		}
+		if v < max {
+			w.addBits(uint64(v), nbBits-1)
+		} else {
+			w.addBits(uint64(v), nbBits)
+		}
+		previous0 = v == 1
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	return w.flush()
+}
+
+// An fseEncoder is an FSE encoding table.
+type fseEncoder struct {
+	al             int
+	stateTable     []uint16
+	deltaNbBits    []uint32
+	deltaFindState []int32
+}
+
+func newFSEEncoder(norm []int16, al int) *fseEncoder {
+	size := 1 << al
+	t := &fseEncoder{
+		al:             al,
+		stateTable:     make([]uint16, size),
+		deltaNbBits:    make([]uint32, len(norm)),
+		deltaFindState: make([]int32, len(norm)),
+	}
+
+	// Spread the symbols over the table as the decoder does, with
+	// the low probability ones at the end.
+	symbols := make([]byte, size)
+	cumul := make([]int, len(norm)+1)
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			cumul[s+1] = cumul[s] + 1
+			symbols[high] = byte(s)
+			high--
+		} else {
+			cumul[s+1] = cumul[s] + int(n)
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	pos := 0
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			symbols[pos] = byte(s)
+			for pos = (pos + step) & (size - 1); pos > high; pos = (pos + step) & (size - 1) {
+			}
+		}
+	}
+	for u, s := range symbols {
+		t.stateTable[cumul[s]] = uint16(size + u)
+		cumul[s]++
+	}
+
+	total := 0
+	for s, n := range norm {
+		switch n {
+		case 0:
+		case -1, 1:
+			t.deltaNbBits[s] = uint32(al<<16 - size)
+			t.deltaFindState[s] = int32(total - 1)
+			total++
+		default:
+			maxBitsOut := al - (bits.Len32(uint32(n-1)) - 1)
+			minStatePlus := int(n) << maxBitsOut
+			t.deltaNbBits[s] = uint32(maxBitsOut<<16 - minStatePlus)
+			t.deltaFindState[s] = int32(total - int(n))
+			total += int(n)
+		}
+	}
+	return t
+}
+
+// init returns the initial state for encoding s, the last symbol.
+func (t *fseEncoder) init(s byte) uint32 {
+	nb := (t.deltaNbBits[s] + 1<<15) >> 16
+	v := nb<<16 - t.deltaNbBits[s]
+	return uint32(t.stateTable[int32(v>>nb)+t.deltaFindState[s]])
+}
+
+// encode writes the bits for going from state to the state for s.
+func (t *fseEncoder) encode(w *bitWriter, state *uint32, s byte) {
+	nb := (*state + t.deltaNbBits[s]) >> 16
+	w.addBits(uint64(*state), uint(nb))
+	*state = uint32(t.stateTable[int32(*state>>nb)+t.deltaFindState[s]])
+}
+
+// encodeSequences appends the sequences section holding seqs to dst.
+func encodeSequences(dst []byte, seqs []sequence) []byte {
+	n := len(seqs)
+	switch {
+	case n < 128:
+		dst = append(dst, byte(n))
+	case n < 0x7F00:
+		dst = append(dst, byte(n>>8+128), byte(n))
+	default:
+		dst = append(dst, 255, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	if n == 0 {
+		return dst
+	}
+
+	llCodes := make([]byte, n)
+	mlCodes := make([]byte, n)
+	ofCodes := make([]byte, n)
+	for i, s := range seqs {
+		llCodes[i] = llCode(s.litLen)
+		mlCodes[i] = mlCode(s.matchLen)
+		ofCodes[i] = byte(bits.Len32(uint32(s.offset+3)) - 1)
+	}
+	modes := len(dst)
+	dst = append(dst, 0)
+	var tables [3]*fseEncoder
+	for i, c := range []struct {
+		codes  []byte
+		def    []int16
+		defLog int
+		maxLog int
+	}{
+		{llCodes, llDefault, llDefaultLog, llMaxLog},
+		{ofCodes, ofDefault, ofDefaultLog, ofMaxLog},
+		{mlCodes, mlDefault, mlDefaultLog, mlMaxLog},
+	} {
+		var mode byte
+		dst, mode, tables[i] = seqTable(dst, c.codes, c.def, c.defLog, c.maxLog)
+		dst[modes] |= mode << (6 - 2*i)
+	}
+	ll, of, ml := tables[0], tables[1], tables[2]
+
+	var w bitWriter
+	w.out = dst
+	var llState, ofState, mlState uint32
+	for i := n - 1; i >= 0; i-- {
+		s := seqs[i]
+		if i == n-1 {
+			if ml != nil {
+				mlState = ml.init(mlCodes[i])
+			}
+			if of != nil {
+				ofState = of.init(ofCodes[i])
+			}
+			if ll != nil {
+				llState = ll.init(llCodes[i])
+			}
+		} else {
+			if of != nil {
+				of.encode(&w, &ofState, ofCodes[i])
+			}
+			if ml != nil {
+				ml.encode(&w, &mlState, mlCodes[i])
+			}
+			if ll != nil {
+				ll.encode(&w, &llState, llCodes[i])
+			}
+		}
+		w.addBits(uint64(s.litLen-llBase[llCodes[i]]), uint(llBits[llCodes[i]]))
+		w.addBits(uint64(s.matchLen-mlBase[mlCodes[i]]), uint(mlBits[mlCodes[i]]))
+		w.addBits(uint64(s.offset+3), uint(ofCodes[i]))
+	}
+	if ml != nil {
+		w.addBits(uint64(mlState), uint(ml.al))
+	}
+	if of != nil {
+		w.addBits(uint64(ofState), uint(of.al))
+	}
+	if ll != nil {
+		w.addBits(uint64(llState), uint(ll.al))
+	}
+	return w.close()
+}
+
+// seqTable chooses how to code the symbols codes: with a single
+// symbol (RLE), the predefined distribution def, or one computed from
+// codes, whichever is smallest. It appends the description of the
+// table to dst, and returns the mode and the table, which is nil for
+// RLE.
+func seqTable(dst []byte, codes []byte, def []int16, defLog, maxLog int) ([]byte, byte, *fseEncoder) {
+	count := make([]int, len(def))
+	maxSym := 0
+	for _, c := range codes {
+		count[c]++
+		if int(c) > maxSym {
+			maxSym = int(c)
+		}
+	}
+	if count[maxSym] == len(codes) {
+		return append(dst, byte(maxSym)), 1, nil
+	}
+
+	// cost estimates the size in bits of the symbols coded with norm.
+	cost := func(norm []int16, al int) float64 {
+		bits := 0.0
+		for s, c := range count {
+			if c == 0 {
+				continue
+			}
+			p := float64(norm[s])
+			if p < 1 {
+				p = 1
+			}
+			bits += float64(c) * (float64(al) - math.Log2(p))
+		}
+		return bits
+	}
+
+	al := bits.Len(uint(len(codes)-1)) - 2
+	if min := bits.Len(uint(maxSym)) + 2; al < min {
+		al = min
+	}
+	if al > maxLog {
+		al = maxLog
+	}
+	if al < 5 {
+		al = 5
+	}
+	if norm := normalize(count[:maxSym+1], len(codes), al, false); norm != nil {
+		hdr := writeNCount(nil, norm, al)
+		if float64(8*len(hdr))+cost(norm, al) < cost(def, defLog) {
+			return append(dst, hdr...), 2, newFSEEncoder(norm, al)
+		}
+	}
+	return dst, 0, newFSEEncoder(def, defLog)
+}
+
+// llCode returns the code of the literal length n.
+func llCode(n int32) byte {
+	if n >= 64 {
+		return byte(bits.Len32(uint32(n)) - 1 + 19)
+	}
+	c := len(llBase) - 1
+	for llBase[c] > n {
+		c--
+	}
+	return byte(c)
+}
+
+// mlCode returns the code of the match length n.
+func mlCode(n int32) byte {
+	if n-3 >= 128 {
+		return byte(bits.Len32(uint32(n-3)) - 1 + 36)
+	}
+	c := len(mlBase) - 1
+	for mlBase[c] > n {
+		c--
+	}
+	return byte(c)
+}
+
+// A bitWriter writes a bitstream, from the lowest bit of each
+// byte. Zstandard bitstreams are read from the end, so that what is
+// written last is read first.
+type bitWriter struct {
+	out  []byte
+	bits uint64
+	n    uint
+}
+
+// addBits writes the low nb bits of v, where nb is at most 32.
+func (w *bitWriter) addBits(v uint64, nb uint) {
+	w.bits |= (v & (1<<nb - 1)) << w.n
+	w.n += nb
+	for w.n >= 32 {
+		w.out = append(w.out, byte(w.bits), byte(w.bits>>8), byte(w.bits>>16), byte(w.bits>>24))
+		w.bits >>= 32
+		w.n -= 32
+	}
+}
+
+// flush returns the bits written, padded to a byte.
+func (w *bitWriter) flush() []byte {
+	for ; w.n > 0; w.n -= 8 {
+		w.out = append(w.out, byte(w.bits))
+		w.bits >>= 8
+		if w.n < 8 {
+			w.n = 8
+		}
+	}
+	return w.out
+}
+
+// close returns the bitstream written, ended with a 1 bit.
+func (w *bitWriter) close() []byte {
+	w.addBits(1, 1)
+	return w.flush()
+}
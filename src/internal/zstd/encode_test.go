@@ -0,0 +1,89 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		t.Skip("zstd not found")
+	}
+
+	for _, test := range testData() {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			z := Compress(nil, test.data)
+			cmd := exec.Command(zstd, "-d", "-c")
+			cmd.Stdin = bytes.NewReader(z)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("zstd -d: %v\n%s", err, stderr.Bytes())
+			}
+			if !bytes.Equal(out, test.data) {
+				t.Errorf("zstd -d returned %d bytes, want the %d compressed bytes", len(out), len(test.data))
+			}
+		})
+	}
+}
+
+// TestWriter checks that the frame does not depend on how the data
+// is written, and in particular that enough of it is kept for the
+// matches when it comes in pieces.
+func TestWriter(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog; ", 100))
+	var data []byte
+	for len(data) < 3<<20 {
+		// Repeat earlier pieces, near and far.
+		if len(data) > 1<<10 && r.Intn(2) == 0 {
+			i := r.Intn(len(data) - 1<<10)
+			data = append(data, data[i:i+r.Intn(1<<10)]...)
+			continue
+		}
+		data = append(data, text[:r.Intn(len(text))]...)
+		for n := r.Intn(300); n > 0; n-- {
+			data = append(data, byte(r.Intn(256)))
+		}
+	}
+	want := Compress(nil, data)
+
+	for _, size := range []int{1, 1000, 64 << 10, 1 << 20} {
+		var buf bytes.Buffer
+		z := NewWriter(&buf, int64(len(data)))
+		for p := data; len(p) > 0; {
+			n := r.Intn(2*size) + 1
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := z.Write(p[:n]); err != nil {
+				t.Fatalf("writing pieces of about %d bytes: %v", size, err)
+			}
+			p = p[n:]
+		}
+		if err := z.Close(); err != nil {
+			t.Fatalf("writing pieces of about %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("writing pieces of about %d bytes: got a different frame", size)
+		}
+	}
+
+	z := NewWriter(io.Discard, 10)
+	z.Write(make([]byte, 5))
+	if err := z.Close(); err == nil {
+		t.Errorf("Close after writing 5 of 10 bytes succeeded")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// An fseTable is an FSE decoding table, indexed by state.
+type fseTable struct {
+	table []fseEntry
+	log   uint
+}
+
+type fseEntry struct {
+	sym  byte
+	bits uint8
+	base uint16
+}
+
+// next returns the state after state, reading its low bits from r.
+func (t *fseTable) next(state uint32, r *bitReader) uint32 {
+	e := t.table[state]
+	return uint32(e.base) + uint32(r.read(uint(e.bits)))
+}
+
+// rle makes t a table that always decodes sym.
+func (t *fseTable) rle(sym byte) {
+	t.table = append(t.table[:0], fseEntry{sym: sym})
+	t.log = 0
+}
+
+// build makes t the decoding table of the normalized distribution norm
+// with accuracy log al.
+func (t *fseTable) build(norm []int16, al uint) error {
+	size := uint32(1) << al
+	if cap(t.table) < int(size) {
+		t.table = make([]fseEntry, size)
+	}
+	t.table = t.table[:size]
+	t.log = al
+	next := make([]uint32, len(norm))
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			t.table[high].sym = byte(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = uint32(n)
+		}
+	}
+	mask := size - 1
+	step := size>>1 + size>>3 + 3
+	pos := uint32(0)
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			t.table[pos].sym = byte(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return errCorrupt
+	}
+	for u := range t.table {
+		e := &t.table[u]
+		n := next[e.sym]
+		next[e.sym]++
+		nb := al - uint(bits.Len32(n)-1)
+		e.bits = uint8(nb)
+		e.base = uint16(n<<nb - size)
+	}
+	return nil
+}
+
+// readNCount reads the FSE table description at the start of b,
+// for symbols up to maxSym and an accuracy log up to maxLog. It returns
+// the normalized distribution, its accuracy log and the size of the
+// description.
+func readNCount(b []byte, maxSym int, maxLog uint) ([]int16, uint, int, error) {
+	pos := uint(0) // in bits
+	read := func(n uint) uint32 {
+		var v uint32
+		for i := uint(0); i < n; i++ {
+			if p := pos + i; p/8 < uint(len(b)) {
+				v |= uint32(b[p/8]>>(p%8)&1) << i
+			}
+		}
+		return v
+	}
+	al := uint(read(4)) + 5
+	pos += 4
+	if al > maxLog {
+		return nil, 0, 0, errCorrupt
+	}
+	var norm []int16
+	remaining := int32(1)<<al + 1
+	threshold := int32(1) << al
+	nbits := al + 1
+	for remaining > 1 {
+		if len(norm) > maxSym {
+			return nil, 0, 0, errCorrupt
+		}
+		max := 2*threshold - 1 - remaining
+		var count int32
+		if v := int32(read(nbits - 1)); v < max {
+			count = v
+			pos += nbits - 1
+		} else {
+			count = int32(read(nbits))
+			if count >= threshold {
+				count -= max
+			}
+			pos += nbits
+		}
+		count-- // -1 means a probability less than 1
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, int16(count))
+		if count == 0 {
+			// Repeat flags: 2 bit counts of further zeros.
+			for {
+				rep := read(2)
+				pos += 2
+				for i := uint32(0); i < rep; i++ {
+					norm = append(norm, 0)
+				}
+				if rep != 3 {
+					break
+				}
+			}
+		}
+		for remaining < threshold && threshold > 1 {
+			nbits--
+			threshold >>= 1
+		}
+	}
+	n := int((pos + 7) / 8)
+	if remaining != 1 || len(norm) > maxSym+1 || n > len(b) {
+		return nil, 0, 0, errCorrupt
+	}
+	return norm, al, n, nil
+}
+
+// A bitReader reads a bit stream backward, from its end, as the
+// Huffman and FSE coded streams are written.
+type bitReader struct {
+	b   []byte
+	pos int // bits left to read; negative after reading past the start
+}
+
+func newBitReader(b []byte) (bitReader, error) {
+	if len(b) == 0 || b[len(b)-1] == 0 {
+		// The last byte holds the end mark.
+		return bitReader{}, errCorrupt
+	}
+	return bitReader{b, 8*(len(b)-1) + bits.Len8(b[len(b)-1]) - 1}, nil
+}
+
+// peek returns the next n bits, with zeros past the start of the stream.
+func (r *bitReader) peek(n uint) uint64 {
+	if n == 0 {
+		return 0
+	}
+	lo := r.pos - int(n)
+	var v uint64
+	if lo >= 0 && lo/8+8 <= len(r.b) {
+		v = binary.LittleEndian.Uint64(r.b[lo/8:]) >> (lo % 8)
+	} else {
+		for i := 0; i < int(n); i++ {
+			if p := lo + i; p >= 0 && p < 8*len(r.b) {
+				v |= uint64(r.b[p/8]>>(p%8)&1) << i
+			}
+		}
+	}
+	return v & (1<<n - 1)
+}
+
+// read reads the next n bits.
+func (r *bitReader) read(n uint) uint64 {
+	v := r.peek(n)
+	r.pos -= int(n)
+	return v
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime1 = 11400714785074694791
+	prime2 = 14029467366897019727
+	prime3 = 1609587929392839161
+	prime4 = 9650029242287828579
+	prime5 = 2870177450012600261
+)
+
+// An xxhash64 computes the XXH64 hash with seed 0 of the bytes written
+// to it, which zstd uses for the content checksums.
+type xxhash64 struct {
+	v   [4]uint64
+	buf [32]byte // the start of a stripe
+	n   int      // bytes in buf
+	len uint64   // bytes written
+}
+
+func (h *xxhash64) reset() {
+	h.v = [4]uint64{prime1, prime2, 0, 0}
+	h.v[0] += prime2
+	h.v[3] -= prime1
+	h.n = 0
+	h.len = 0
+}
+
+func xxRound(acc, v uint64) uint64 {
+	return bits.RotateLeft64(acc+v*prime2, 31) * prime1
+}
+
+func xxMerge(acc, v uint64) uint64 {
+	return (acc^xxRound(0, v))*prime1 + prime4
+}
+
+// stripe mixes the 32 bytes of b into the accumulators.
+func (h *xxhash64) stripe(b []byte) {
+	h.v[0] = xxRound(h.v[0], binary.LittleEndian.Uint64(b))
+	h.v[1] = xxRound(h.v[1], binary.LittleEndian.Uint64(b[8:]))
+	h.v[2] = xxRound(h.v[2], binary.LittleEndian.Uint64(b[16:]))
+	h.v[3] = xxRound(h.v[3], binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (h *xxhash64) write(b []byte) {
+	h.len += uint64(len(b))
+	if h.n > 0 {
+		k := copy(h.buf[h.n:], b)
+		h.n += k
+		b = b[k:]
+		if h.n < len(h.buf) {
+			return
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(b) >= 32; b = b[32:] {
+		h.stripe(b)
+	}
+	h.n = copy(h.buf[:], b)
+}
+
+// sum64 returns the hash of the bytes written so far.
+func (h *xxhash64) sum64() uint64 {
+	var acc uint64
+	if h.len >= 32 {
+		v := h.v
+		acc = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) + bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		acc = xxMerge(xxMerge(xxMerge(xxMerge(acc, v[0]), v[1]), v[2]), v[3])
+	} else {
+		acc = prime5
+	}
+	acc += h.len
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		acc ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		acc = bits.RotateLeft64(acc, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		acc = bits.RotateLeft64(acc, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		acc ^= uint64(c) * prime5
+		acc = bits.RotateLeft64(acc, 11) * prime1
+	}
+	acc ^= acc >> 33
+	acc *= prime2
+	acc ^= acc >> 29
+	acc *= prime3
+	acc ^= acc >> 32
+	return acc
+}
@@ -1320,7 +1320,8 @@ TEXT runtime·goexit(SB),NOSPLIT|TOPFRAME,$0-0
 // instead the pointer to the moduledata is passed in AX.
 TEXT runtime·addmoduledata(SB),NOSPLIT,$0-0
 	MOVL	runtime·lastmoduledatap(SB), DX
-	MOVL	AX, moduledata_next(DX)
+	MOVL	moduledata_state(DX), DX
+	MOVL	AX, modulestate_next(DX)
 	MOVL	AX, runtime·lastmoduledatap(SB)
 	RET
 
@@ -1452,7 +1452,8 @@ TEXT runtime·goexit(SB),NOSPLIT|TOPFRAME,$0-0
 TEXT runtime·addmoduledata(SB),NOSPLIT,$0-0
 	PUSHQ	R15 // The access to global variables below implicitly uses R15, which is callee-save
 	MOVQ	runtime·lastmoduledatap(SB), AX
-	MOVQ	DI, moduledata_next(AX)
+	MOVQ	moduledata_state(AX), AX
+	MOVQ	DI, modulestate_next(AX)
 	MOVQ	DI, runtime·lastmoduledatap(SB)
 	POPQ	R15
 	RET
@@ -852,7 +852,8 @@ TEXT runtime·addmoduledata(SB),NOSPLIT,$0-0
 	MOVW	R9, saver9-4(SP) // The access to global variables below implicitly uses R9, which is callee-save
 	MOVW	R11, saver11-8(SP) // Likewise, R11 is the temp register, but callee-save in C ABI
 	MOVW	runtime·lastmoduledatap(SB), R1
-	MOVW	R0, moduledata_next(R1)
+	MOVW	moduledata_state(R1), R1
+	MOVW	R0, modulestate_next(R1)
 	MOVW	R0, runtime·lastmoduledatap(SB)
 	MOVW	saver11-8(SP), R11
 	MOVW	saver9-4(SP), R9
@@ -921,7 +921,8 @@ TEXT runtime·addmoduledata(SB),NOSPLIT|NOFRAME,$0-0
 	ADD	$-8, R1
 	MOVD	R31, 0(R1)
 	MOVD	runtime·lastmoduledatap(SB), R4
-	MOVD	R3, moduledata_next(R4)
+	MOVD	moduledata_state(R4), R4
+	MOVD	R3, modulestate_next(R4)
 	MOVD	R3, runtime·lastmoduledatap(SB)
 	MOVD	0(R1), R31
 	ADD	$8, R1
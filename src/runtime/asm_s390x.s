@@ -761,7 +761,8 @@ TEXT runtime·addmoduledata(SB),NOSPLIT|NOFRAME,$0-0
 	// append the argument (passed in R2, as per the ELF ABI) to the
 	// moduledata linked list.
 	MOVD	runtime·lastmoduledatap(SB), R1
-	MOVD	R2, moduledata_next(R1)
+	MOVD	moduledata_state(R1), R1
+	MOVD	R2, modulestate_next(R1)
 	MOVD	R2, runtime·lastmoduledatap(SB)
 
 	// Restore R6-R15.
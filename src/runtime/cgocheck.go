@@ -123,12 +123,12 @@ func cgoCheckTypedBlock(typ *_type, src unsafe.Pointer, off, size uintptr) {
 	for _, datap := range activeModules() {
 		if cgoInRange(src, datap.data, datap.edata) {
 			doff := uintptr(src) - datap.data
-			cgoCheckBits(add(src, -doff), datap.gcdatamask.bytedata, off+doff, size)
+			cgoCheckBits(add(src, -doff), datap.state.gcdatamask.bytedata, off+doff, size)
 			return
 		}
 		if cgoInRange(src, datap.bss, datap.ebss) {
 			boff := uintptr(src) - datap.bss
-			cgoCheckBits(add(src, -boff), datap.gcbssmask.bytedata, off+boff, size)
+			cgoCheckBits(add(src, -boff), datap.state.gcbssmask.bytedata, off+boff, size)
 			return
 		}
 	}
@@ -0,0 +1,67 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import _ "unsafe" // for go:linkname
+
+// Set by the linker, if they are used (see cmd/link/internal/ld/linklayout.go).
+var (
+	textStart, textSize           uintptr
+	rodataStart, rodataSize       uintptr
+	noptrdataStart, noptrdataSize uintptr
+	dataStart, dataSize           uintptr
+	bssStart, bssSize             uintptr
+	noptrbssStart, noptrbssSize   uintptr
+)
+
+//go:linkname textStart go.link.textstart
+//go:linkname textSize go.link.textsize
+//go:linkname rodataStart go.link.rodatastart
+//go:linkname rodataSize go.link.rodatasize
+//go:linkname noptrdataStart go.link.noptrdatastart
+//go:linkname noptrdataSize go.link.noptrdatasize
+//go:linkname dataStart go.link.datastart
+//go:linkname dataSize go.link.datasize
+//go:linkname bssStart go.link.bssstart
+//go:linkname bssSize go.link.bsssize
+//go:linkname noptrbssStart go.link.noptrbssstart
+//go:linkname noptrbssSize go.link.noptrbsssize
+
+// An AddrRange is a range of memory addresses.
+type AddrRange struct {
+	Start uintptr
+	Size  uintptr
+}
+
+// Layout describes where the linker placed the Go code and the global
+// variables of the running program in memory. The ranges do not overlap,
+// but their order varies.
+type Layout struct {
+	Text      AddrRange // machine code
+	ROData    AddrRange // read-only data, excluding type and function metadata
+	NoPtrData AddrRange // initialized variables without pointers
+	Data      AddrRange // initialized variables with pointers
+	BSS       AddrRange // zero-initialized variables with pointers
+	NoPtrBSS  AddrRange // zero-initialized variables without pointers
+}
+
+// ReadLayout returns the layout of the running program, as recorded by
+// the linker. The addresses account for the address the program was
+// loaded at. Code and variables of C libraries linked into the program
+// are not included. The layout is not available in programs built with
+// -linkshared, where the Go code and variables span several modules.
+func ReadLayout() (layout Layout, ok bool) {
+	if textSize == 0 {
+		return Layout{}, false
+	}
+	return Layout{
+		Text:      AddrRange{textStart, textSize},
+		ROData:    AddrRange{rodataStart, rodataSize},
+		NoPtrData: AddrRange{noptrdataStart, noptrdataSize},
+		Data:      AddrRange{dataStart, dataSize},
+		BSS:       AddrRange{bssStart, bssSize},
+		NoPtrBSS:  AddrRange{noptrbssStart, noptrbssSize},
+	}, true
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug_test
+
+import (
+	"reflect"
+	. "runtime/debug"
+	"testing"
+	"unsafe"
+)
+
+var (
+	layoutData      = &layoutNoPtrData
+	layoutNoPtrData = 42
+	layoutBSS       *int
+	layoutNoPtrBSS  [64]byte
+)
+
+const layoutString = "in the read-only data"
+
+func TestReadLayout(t *testing.T) {
+	l, ok := ReadLayout()
+	if !ok {
+		t.Skip("layout not available")
+	}
+	s := layoutString
+	tests := []struct {
+		name string
+		r    AddrRange
+		p    uintptr
+	}{
+		{"Text", l.Text, reflect.ValueOf(TestReadLayout).Pointer()},
+		{"ROData", l.ROData, (*reflect.StringHeader)(unsafe.Pointer(&s)).Data},
+		{"NoPtrData", l.NoPtrData, uintptr(unsafe.Pointer(&layoutNoPtrData))},
+		{"Data", l.Data, uintptr(unsafe.Pointer(&layoutData))},
+		{"BSS", l.BSS, uintptr(unsafe.Pointer(&layoutBSS))},
+		{"NoPtrBSS", l.NoPtrBSS, uintptr(unsafe.Pointer(&layoutNoPtrBSS))},
+	}
+	for _, test := range tests {
+		if test.p < test.r.Start || test.p >= test.r.Start+test.r.Size {
+			t.Errorf("%s is [%#x, %#x), does not contain %#x", test.name, test.r.Start, test.r.Start+test.r.Size, test.p)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import "unsafe"
+
+// Set by the linker, if they are used (see cmd/link/internal/ld/pkgtext.go).
+var pkgTextTab, pkgTextTabSize uintptr
+
+//go:linkname pkgTextTab go.link.pkgtexttab
+//go:linkname pkgTextTabSize go.link.pkgtexttabsize
+
+// PackageForPC returns the import path of the package whose code
+// contains the program counter pc. Code that the linker generates, such
+// as trampolines, belongs to the package "(linker)". Code of C objects
+// linked into the program with cgo belongs to the package that contains
+// them; code of C libraries does not belong to any package.
+//
+// The result is false if pc is not in the Go code of the program, or if
+// the table of packages is not available, as in programs built with
+// -linkshared.
+func PackageForPC(pc uintptr) (pkg string, ok bool) {
+	if pkgTextTabSize == 0 {
+		return "", false
+	}
+	off, ok := pcTextOff(pc)
+	if !ok {
+		return "", false
+	}
+	tab := unsafe.Pointer(pkgTextTab)
+	word := func(i uint32) uint32 {
+		return *(*uint32)(unsafe.Pointer(uintptr(tab) + uintptr(i)*4))
+	}
+	nranges, npkgs := word(0), word(1)
+
+	// Find the first range that ends after off.
+	lo, hi := uint32(0), nranges
+	for lo < hi {
+		m := lo + (hi-lo)/2
+		if word(2+3*m+1) <= off {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	if lo == nranges || off < word(2+3*lo) {
+		return "", false
+	}
+	p := word(2 + 3*lo + 2)
+	offs := 2 + 3*nranges
+	start, end := word(offs+p), word(offs+p+1)
+	paths := uintptr(tab) + uintptr(offs+npkgs+1)*4
+	var path string
+	hdr := (*stringHeader)(unsafe.Pointer(&path))
+	hdr.data = unsafe.Pointer(paths + uintptr(start))
+	hdr.len = int(end - start)
+	return path, true
+}
+
+// stringHeader is the runtime representation of a string. The paths in
+// the table are returned without copying them.
+type stringHeader struct {
+	data unsafe.Pointer
+	len  int
+}
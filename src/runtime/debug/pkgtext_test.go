@@ -0,0 +1,39 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug_test
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	. "runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestPackageForPC(t *testing.T) {
+	if _, ok := PackageForPC(reflect.ValueOf(TestPackageForPC).Pointer()); !ok {
+		t.Skip("package table not available")
+	}
+	tests := []struct {
+		f    interface{}
+		want string
+	}{
+		{TestPackageForPC, "runtime/debug_test"},
+		{PackageForPC, "runtime/debug"},
+		{fmt.Println, "fmt"},
+		{strings.ToUpper, "strings"},
+		{runtime.GC, "runtime"},
+	}
+	for _, test := range tests {
+		pc := reflect.ValueOf(test.f).Pointer()
+		if pkg, ok := PackageForPC(pc); !ok || pkg != test.want {
+			t.Errorf("PackageForPC(%#x) = %q, %v, want %q, true", pc, pkg, ok, test.want)
+		}
+	}
+	if pkg, ok := PackageForPC(0); ok {
+		t.Errorf("PackageForPC(0) = %q, true, want false", pkg)
+	}
+}
@@ -1230,3 +1230,5 @@ func GCTestPointerClass(p unsafe.Pointer) string {
 }
 
 const Raceenabled = raceenabled
+
+var Inflate = inflate
@@ -106,6 +106,13 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	This should only be used as a temporary workaround to diagnose buggy code.
 	The real fix is to not store integers in pointer-typed locations.
 
+	pluginmismatch: setting pluginmismatch=1 causes plugin.Open to print a
+	warning instead of failing when a plugin was built with a different
+	version of a package than the program loading it. This is unsafe: the
+	program and plugin may then disagree about the layout of shared types and
+	values, and the program may crash or silently corrupt memory. It should
+	only be used as a temporary workaround during development.
+
 	sbrk: setting sbrk=1 replaces the memory allocator and garbage collector
 	with a trivial allocator that obtains memory from the operating system and
 	never reclaims any memory.
@@ -441,13 +441,13 @@ func dumproots() {
 	dumpint(tagData)
 	dumpint(uint64(firstmoduledata.data))
 	dumpmemrange(unsafe.Pointer(firstmoduledata.data), firstmoduledata.edata-firstmoduledata.data)
-	dumpfields(firstmoduledata.gcdatamask)
+	dumpfields(firstmoduledata.state.gcdatamask)
 
 	// bss segment
 	dumpint(tagBSS)
 	dumpint(uint64(firstmoduledata.bss))
 	dumpmemrange(unsafe.Pointer(firstmoduledata.bss), firstmoduledata.ebss-firstmoduledata.bss)
-	dumpfields(firstmoduledata.gcbssmask)
+	dumpfields(firstmoduledata.state.gcbssmask)
 
 	// mspan.types
 	for _, s := range mheap_.allspans {
@@ -0,0 +1,33 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"internal/goarch"
+	"unsafe"
+)
+
+// hostInitArray is set by the linker to the bounds of the constructors
+// of the host objects when it links an executable internally, as there
+// is then no C runtime to call them.
+var hostInitArray struct {
+	start, end unsafe.Pointer
+}
+
+// runHostInitArray calls the constructors of the host objects, in order.
+// Like the C runtime, it skips the entries 0 and -1.
+func runHostInitArray() {
+	for p := hostInitArray.start; p != hostInitArray.end; p = add(p, goarch.PtrSize) {
+		fn := *(*unsafe.Pointer)(p)
+		if uintptr(fn) == 0 || uintptr(fn) == ^uintptr(0) {
+			continue
+		}
+		if iscgo {
+			cgocall(fn, nil)
+		} else {
+			asmcgocall(fn, nil)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// With -compress-sections, the linker moves the contents of the files
+// embedded with //go:embed to a zero-filled data symbol, and keeps
+// them only compressed, as one DEFLATE stream, in the read-only data
+// of the module. The moduledata describes both, and the contents are
+// inflated into their place before any package initializer runs.
+//
+// The decoder below follows the structure of zlib's contrib/puff: it
+// reads the Huffman codes one bit at a time, which is slow next to
+// compress/flate but small, and more than fast enough for the few
+// megabytes a program embeds.
+
+// inflateEmbeds inflates the compressed go:embed data of md, if any.
+func inflateEmbeds(md *moduledata) {
+	if len(md.embedz) == 0 {
+		return
+	}
+	if !inflate(md.embeds, md.embedz) {
+		println("runtime: module", md.modulename, "has", len(md.embedz), "bytes of corrupt compressed go:embed data")
+		throw("inflateEmbeds: corrupt data")
+	}
+}
+
+// inflate decompresses the DEFLATE (RFC 1951) stream src into dst,
+// and reports whether src was a valid stream that filled exactly dst.
+func inflate(dst, src []byte) bool {
+	f := inflater{src: src, dst: dst}
+	for {
+		last := f.bits(1)
+		kind := f.bits(2)
+		if f.err {
+			return false
+		}
+		var ok bool
+		switch kind {
+		case 0:
+			ok = f.stored()
+		case 1:
+			ok = f.fixed()
+		case 2:
+			ok = f.dynamic()
+		}
+		if !ok || f.err {
+			return false
+		}
+		if last == 1 {
+			return f.n == len(f.dst)
+		}
+	}
+}
+
+// An inflater holds the state of inflate.
+type inflater struct {
+	src  []byte
+	pos  int    // next byte of src to read
+	buf  uint32 // bits read from src and not yet used
+	nbuf uint   // number of bits in buf
+	dst  []byte
+	n    int  // number of bytes written to dst
+	err  bool // src ended early
+}
+
+// bits returns the next n bits of the stream, or sets f.err.
+func (f *inflater) bits(n uint) uint32 {
+	for f.nbuf < n {
+		if f.pos >= len(f.src) {
+			f.err = true
+			return 0
+		}
+		f.buf |= uint32(f.src[f.pos]) << f.nbuf
+		f.pos++
+		f.nbuf += 8
+	}
+	v := f.buf & (1<<n - 1)
+	f.buf >>= n
+	f.nbuf -= n
+	return v
+}
+
+// stored copies a stored block.
+func (f *inflater) stored() bool {
+	// The block starts on a byte boundary.
+	f.buf, f.nbuf = 0, 0
+	if len(f.src)-f.pos < 4 {
+		return false
+	}
+	p := f.src[f.pos:]
+	n := int(p[0]) | int(p[1])<<8
+	if p[2] != ^p[0] || p[3] != ^p[1] {
+		return false
+	}
+	f.pos += 4
+	if n > len(f.src)-f.pos || n > len(f.dst)-f.n {
+		return false
+	}
+	copy(f.dst[f.n:], f.src[f.pos:f.pos+n])
+	f.pos += n
+	f.n += n
+	return true
+}
+
+// A huffman is a canonical Huffman code: the number of codes of each
+// length, and the symbols ordered by code.
+type huffman struct {
+	count  [16]uint16
+	symbol [288]uint16
+}
+
+// build sets up h from the code lengths of its symbols, and reports
+// whether they make a valid code, which may be incomplete.
+func (h *huffman) build(lengths []uint8) bool {
+	h.count = [16]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	left := 1
+	for l := 1; l < 16; l++ {
+		left = left<<1 - int(h.count[l])
+		if left < 0 {
+			return false
+		}
+	}
+	var offs [16]uint16
+	for l := 1; l < 15; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	for s, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(s)
+			offs[l]++
+		}
+	}
+	return true
+}
+
+// decode returns the next symbol of the stream coded with h, or -1.
+func (f *inflater) decode(h *huffman) int {
+	code, first, index := 0, 0, 0
+	for l := 1; l < 16; l++ {
+		code |= int(f.bits(1))
+		if f.err {
+			return -1
+		}
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first])
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return -1
+}
+
+var (
+	lengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	// codeLengthOrder is the order of the code length code lengths
+	// of a dynamic block.
+	codeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// codes decodes the rest of a block coded with lit and dist.
+func (f *inflater) codes(lit, dist *huffman) bool {
+	for {
+		sym := f.decode(lit)
+		switch {
+		case sym < 0:
+			return false
+		case sym < 256:
+			if f.n == len(f.dst) {
+				return false
+			}
+			f.dst[f.n] = byte(sym)
+			f.n++
+			continue
+		case sym == 256:
+			return true
+		}
+		sym -= 257
+		if sym >= len(lengthBase) {
+			return false
+		}
+		n := int(lengthBase[sym]) + int(f.bits(uint(lengthExtra[sym])))
+		sym = f.decode(dist)
+		if sym < 0 || sym >= len(distBase) {
+			return false
+		}
+		d := int(distBase[sym]) + int(f.bits(uint(distExtra[sym])))
+		if f.err || d > f.n || n > len(f.dst)-f.n {
+			return false
+		}
+		// The copy may overlap what it writes.
+		for i := 0; i < n; i++ {
+			f.dst[f.n] = f.dst[f.n-d]
+			f.n++
+		}
+	}
+}
+
+// fixed decodes a block coded with the fixed Huffman codes.
+func (f *inflater) fixed() bool {
+	var lengths [288 + 30]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		case i < 288:
+			lengths[i] = 8
+		default:
+			lengths[i] = 5
+		}
+	}
+	var lit, dist huffman
+	lit.build(lengths[:288])
+	dist.build(lengths[288:])
+	return f.codes(&lit, &dist)
+}
+
+// dynamic decodes a block that starts with its Huffman codes.
+func (f *inflater) dynamic() bool {
+	nlit := int(f.bits(5)) + 257
+	ndist := int(f.bits(5)) + 1
+	nlen := int(f.bits(4)) + 4
+	if f.err || nlit > 286 || ndist > 30 {
+		return false
+	}
+
+	var lengths [286 + 30]uint8
+	for i := 0; i < nlen; i++ {
+		lengths[codeLengthOrder[i]] = uint8(f.bits(3))
+	}
+	var lit, dist huffman
+	if !lit.build(lengths[:19]) {
+		return false
+	}
+	for i := 0; i < nlit+ndist; {
+		sym := f.decode(&lit)
+		if sym < 0 {
+			return false
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var l uint8
+		var n int
+		switch sym {
+		case 16:
+			if i == 0 {
+				return false
+			}
+			l = lengths[i-1]
+			n = 3 + int(f.bits(2))
+		case 17:
+			n = 3 + int(f.bits(3))
+		default:
+			n = 11 + int(f.bits(7))
+		}
+		if f.err || n > nlit+ndist-i {
+			return false
+		}
+		for ; n > 0; n-- {
+			lengths[i] = l
+			i++
+		}
+	}
+	if lengths[256] == 0 || !lit.build(lengths[:nlit]) || !dist.build(lengths[nlit:nlit+ndist]) {
+		return false
+	}
+	return f.codes(&lit, &dist)
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"math/rand"
+	. "runtime"
+	"strings"
+	"testing"
+)
+
+func TestInflate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 100<<10)
+	r.Read(random)
+	words := strings.Fields("the quick brown fox jumps over the lazy dog embed data compress")
+	var text []byte
+	for len(text) < 300<<10 {
+		text = append(text, words[r.Intn(len(words))]...)
+		text = append(text, ' ')
+	}
+	inputs := map[string][]byte{
+		"empty":  nil,
+		"byte":   {'x'},
+		"zeros":  make([]byte, 200<<10),
+		"random": random,
+		"text":   text,
+	}
+	levels := []int{flate.NoCompression, flate.HuffmanOnly, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression}
+	for name, in := range inputs {
+		for _, level := range levels {
+			var buf bytes.Buffer
+			w, err := flate.NewWriter(&buf, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(in)
+			w.Close()
+			z := buf.Bytes()
+
+			out := make([]byte, len(in))
+			if !Inflate(out, z) {
+				t.Errorf("%s at level %d: inflate failed", name, level)
+				continue
+			}
+			if !bytes.Equal(out, in) {
+				t.Errorf("%s at level %d: inflated data differs", name, level)
+			}
+			if len(in) > 0 {
+				if Inflate(out[:len(out)-1], z) {
+					t.Errorf("%s at level %d: inflated into a short buffer", name, level)
+				}
+				if Inflate(make([]byte, len(in)+1), z) {
+					t.Errorf("%s at level %d: did not fill a long buffer", name, level)
+				}
+			}
+			if Inflate(out, z[:len(z)/2]) {
+				t.Errorf("%s at level %d: inflated a truncated stream", name, level)
+			}
+		}
+	}
+}
+
+func TestInflateCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(bytes.Repeat([]byte("go:embed "), 1000))
+	w.Close()
+	z := buf.Bytes()
+
+	r := rand.New(rand.NewSource(1))
+	out := make([]byte, 9000)
+	for i := 0; i < 1000; i++ {
+		bad := append([]byte(nil), z...)
+		bad[r.Intn(len(bad))] ^= byte(1 + r.Intn(255))
+		Inflate(out, bad) // must not crash
+	}
+}
@@ -578,13 +578,13 @@ func bulkBarrierPreWrite(dst, src, size uintptr) {
 		// execute write barriers.
 		for _, datap := range activeModules() {
 			if datap.data <= dst && dst < datap.edata {
-				bulkBarrierBitmap(dst, src, size, dst-datap.data, datap.gcdatamask.bytedata)
+				bulkBarrierBitmap(dst, src, size, dst-datap.data, datap.state.gcdatamask.bytedata)
 				return
 			}
 		}
 		for _, datap := range activeModules() {
 			if datap.bss <= dst && dst < datap.ebss {
-				bulkBarrierBitmap(dst, src, size, dst-datap.bss, datap.gcbssmask.bytedata)
+				bulkBarrierBitmap(dst, src, size, dst-datap.bss, datap.state.gcbssmask.bytedata)
 				return
 			}
 		}
@@ -1973,7 +1973,7 @@ func getgcmask(ep interface{}) (mask []byte) {
 	for _, datap := range activeModules() {
 		// data
 		if datap.data <= uintptr(p) && uintptr(p) < datap.edata {
-			bitmap := datap.gcdatamask.bytedata
+			bitmap := datap.state.gcdatamask.bytedata
 			n := (*ptrtype)(unsafe.Pointer(t)).elem.size
 			mask = make([]byte, n/goarch.PtrSize)
 			for i := uintptr(0); i < n; i += goarch.PtrSize {
@@ -1985,7 +1985,7 @@ func getgcmask(ep interface{}) (mask []byte) {
 
 		// bss
 		if datap.bss <= uintptr(p) && uintptr(p) < datap.ebss {
-			bitmap := datap.gcbssmask.bytedata
+			bitmap := datap.state.gcbssmask.bytedata
 			n := (*ptrtype)(unsafe.Pointer(t)).elem.size
 			mask = make([]byte, n/goarch.PtrSize)
 			for i := uintptr(0); i < n; i += goarch.PtrSize {
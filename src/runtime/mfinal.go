@@ -365,7 +365,7 @@ func SetFinalizer(obj interface{}, finalizer interface{}) {
 		// The relevant segments are: noptrdata, data, bss, noptrbss.
 		// We cannot assume they are in any order or even contiguous,
 		// due to external linking.
-		for datap := &firstmoduledata; datap != nil; datap = datap.next {
+		for datap := &firstmoduledata; datap != nil; datap = datap.state.next {
 			if datap.noptrdata <= uintptr(e.data) && uintptr(e.data) < datap.enoptrdata ||
 				datap.data <= uintptr(e.data) && uintptr(e.data) < datap.edata ||
 				datap.bss <= uintptr(e.data) && uintptr(e.data) < datap.ebss ||
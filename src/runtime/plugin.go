@@ -9,8 +9,8 @@ import "unsafe"
 //go:linkname plugin_lastmoduleinit plugin.lastmoduleinit
 func plugin_lastmoduleinit() (path string, syms map[string]interface{}, errstr string) {
 	var md *moduledata
-	for pmd := firstmoduledata.next; pmd != nil; pmd = pmd.next {
-		if pmd.bad {
+	for pmd := firstmoduledata.state.next; pmd != nil; pmd = pmd.state.next {
+		if pmd.state.bad {
 			md = nil // we only want the last module
 			continue
 		}
@@ -22,13 +22,13 @@ func plugin_lastmoduleinit() (path string, syms map[string]interface{}, errstr s
 	if md.pluginpath == "" {
 		throw("runtime: plugin has empty pluginpath")
 	}
-	if md.typemap != nil {
+	if md.state.typemap != nil {
 		return "", nil, "plugin already loaded"
 	}
 
 	for _, pmd := range activeModules() {
 		if pmd.pluginpath == md.pluginpath {
-			md.bad = true
+			md.state.bad = true
 			return "", nil, "plugin already loaded"
 		}
 
@@ -50,7 +50,14 @@ func plugin_lastmoduleinit() (path string, syms map[string]interface{}, errstr s
 	}
 	for _, pkghash := range md.pkghashes {
 		if pkghash.linktimehash != *pkghash.runtimehash {
-			md.bad = true
+			if debug.pluginmismatch != 0 {
+				println("WARNING: plugin", md.pluginpath, "was built with a different version of package", pkghash.modulename)
+				println("WARNING: loading it anyway because GODEBUG=pluginmismatch=1 is set.")
+				println("WARNING: the program and the plugin may disagree about the layout of types and values;")
+				println("WARNING: the program may crash or silently corrupt memory. Do not use this in production.")
+				continue
+			}
+			md.state.bad = true
 			return "", nil, "plugin was built with a different version of package " + pkghash.modulename
 		}
 	}
@@ -61,6 +68,7 @@ func plugin_lastmoduleinit() (path string, syms map[string]interface{}, errstr s
 
 	pluginftabverify(md)
 	moduledataverify1(md)
+	inflateEmbeds(md)
 
 	lock(&itabLock)
 	for _, i := range md.itablinks {
@@ -211,6 +211,12 @@ func main() {
 		}
 	}()
 
+	// The go:embed data compressed by the linker must be in place
+	// before any package initializer can read it.
+	for md := &firstmoduledata; md != nil; md = md.state.next {
+		inflateEmbeds(md)
+	}
+
 	gcenable()
 
 	main_init_done = make(chan bool)
@@ -235,6 +241,7 @@ func main() {
 		cgocall(_cgo_notify_runtime_init_done, nil)
 	}
 
+	runHostInitArray()
 	doInit(&main_inittask)
 
 	// Disable init tracing after main init done to avoid overhead
@@ -20,3 +20,12 @@ func setPanicOnFault(new bool) (old bool) {
 	_g_.paniconfault = new
 	return old
 }
+
+//go:linkname pcTextOff runtime/debug.pcTextOff
+func pcTextOff(pc uintptr) (off uint32, ok bool) {
+	md := &firstmoduledata
+	if pc < md.text || pc >= md.etext {
+		return 0, false
+	}
+	return md.textOff(pc)
+}
@@ -310,6 +310,7 @@ var debug struct {
 	gctrace            int32
 	invalidptr         int32
 	madvdontneed       int32 // for Linux; issue 28466
+	pluginmismatch     int32
 	scavtrace          int32
 	scheddetail        int32
 	schedtrace         int32
@@ -337,6 +338,7 @@ var dbgvars = []dbgVar{
 	{"gctrace", &debug.gctrace},
 	{"invalidptr", &debug.invalidptr},
 	{"madvdontneed", &debug.madvdontneed},
+	{"pluginmismatch", &debug.pluginmismatch},
 	{"sbrk", &debug.sbrk},
 	{"scavtrace", &debug.scavtrace},
 	{"scheddetail", &debug.scheddetail},
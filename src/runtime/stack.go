@@ -1352,7 +1352,7 @@ func stkobjinit() {
 	// stackObjectRecord.gcdata() will work correctly with it.
 	ptr := uintptr(unsafe.Pointer(&methodValueCallFrameObjs[0]))
 	var mod *moduledata
-	for datap := &firstmoduledata; datap != nil; datap = datap.next {
+	for datap := &firstmoduledata; datap != nil; datap = datap.state.next {
 		if datap.gofunc <= ptr && ptr < datap.end {
 			mod = datap
 			break
@@ -1397,7 +1397,7 @@ func (r *stackObjectRecord) ptrdata() uintptr {
 func (r *stackObjectRecord) gcdata() *byte {
 	ptr := uintptr(unsafe.Pointer(r))
 	var mod *moduledata
-	for datap := &firstmoduledata; datap != nil; datap = datap.next {
+	for datap := &firstmoduledata; datap != nil; datap = datap.state.next {
 		if datap.gofunc <= ptr && ptr < datap.end {
 			mod = datap
 			break
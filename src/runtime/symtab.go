@@ -281,7 +281,7 @@ func (f *_func) funcInfo() funcInfo {
 	// are safe because we are working with module addresses.
 	ptr := uintptr(unsafe.Pointer(f))
 	var mod *moduledata
-	for datap := &firstmoduledata; datap != nil; datap = datap.next {
+	for datap := &firstmoduledata; datap != nil; datap = datap.state.next {
 		if len(datap.pclntable) == 0 {
 			continue
 		}
@@ -411,6 +411,10 @@ type pcHeader struct {
 // matched changes to the code in cmd/internal/ld/symtab.go:symtab.
 // moduledata is stored in statically allocated non-pointer memory;
 // none of the pointers here are visible to the garbage collector.
+//
+// The runtime does not write to moduledata: what it writes is in
+// modulestate. This lets the linker put the moduledata in read-only
+// memory with -guard-moduledata.
 type moduledata struct {
 	pcHeader     *pcHeader
 	funcnametab  []byte
@@ -435,6 +439,9 @@ type moduledata struct {
 	textsectmap []textsect
 	typelinks   []int32 // offsets from types
 	itablinks   []*itab
+	typeimports []*_type // types left to the program, see typelinksinit
+	embedz      []byte   // compressed go:embed data, see inflateEmbeds
+	embeds      []byte   // where embedz is inflated
 
 	ptab []ptabEntry
 
@@ -446,6 +453,15 @@ type moduledata struct {
 
 	hasmain uint8 // 1 if module contains the main function, 0 otherwise
 
+	state *modulestate
+}
+
+// modulestate holds the parts of a module's data that the runtime
+// writes: the pointer masks and type map, when it initializes the
+// module, bad, when the module fails to load, and next, when another
+// module is loaded after it. The linker allocates it in zeroed
+// non-pointer memory, next to the moduledata.
+type modulestate struct {
 	gcdatamask, gcbssmask bitvector
 
 	typemap map[typeOff]*_type // offset to *_rtype in previous module
@@ -476,14 +492,15 @@ type modulehash struct {
 // pinnedTypemaps are the map[typeOff]*_type from the moduledata objects.
 //
 // These typemap objects are allocated at run time on the heap, but the
-// only direct reference to them is in the moduledata, created by the
-// linker and marked SNOPTRDATA so it is ignored by the GC.
+// only direct reference to them is in the modulestate, created by the
+// linker and marked SNOPTRBSS so it is ignored by the GC.
 //
 // To make sure the map isn't collected, we keep a second reference here.
 var pinnedTypemaps []map[typeOff]*_type
 
 var firstmoduledata moduledata  // linker symbol
 var lastmoduledatap *moduledata // linker symbol
+
 var modulesSlice *[]*moduledata // see activeModules
 
 // activeModules returns a slice of active modules.
@@ -523,14 +540,14 @@ func activeModules() []*moduledata {
 // Only one goroutine may call modulesinit at a time.
 func modulesinit() {
 	modules := new([]*moduledata)
-	for md := &firstmoduledata; md != nil; md = md.next {
-		if md.bad {
+	for md := &firstmoduledata; md != nil; md = md.state.next {
+		if md.state.bad {
 			continue
 		}
 		*modules = append(*modules, md)
-		if md.gcdatamask == (bitvector{}) {
-			md.gcdatamask = progToPointerMask((*byte)(unsafe.Pointer(md.gcdata)), md.edata-md.data)
-			md.gcbssmask = progToPointerMask((*byte)(unsafe.Pointer(md.gcbss)), md.ebss-md.bss)
+		if md.state.gcdatamask == (bitvector{}) {
+			md.state.gcdatamask = progToPointerMask((*byte)(unsafe.Pointer(md.gcdata)), md.edata-md.data)
+			md.state.gcbssmask = progToPointerMask((*byte)(unsafe.Pointer(md.gcbss)), md.ebss-md.bss)
 		}
 	}
 
@@ -584,7 +601,7 @@ type findfuncbucket struct {
 }
 
 func moduledataverify() {
-	for datap := &firstmoduledata; datap != nil; datap = datap.next {
+	for datap := &firstmoduledata; datap != nil; datap = datap.state.next {
 		moduledataverify1(datap)
 	}
 }
@@ -781,7 +798,7 @@ func (f *Func) FileLine(pc uintptr) (file string, line int) {
 //
 //go:nosplit
 func findmoduledatap(pc uintptr) *moduledata {
-	for datap := &firstmoduledata; datap != nil; datap = datap.next {
+	for datap := &firstmoduledata; datap != nil; datap = datap.state.next {
 		if datap.minpc <= pc && pc < datap.maxpc {
 			return datap
 		}
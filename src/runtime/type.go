@@ -190,7 +190,7 @@ func resolveNameOff(ptrInModule unsafe.Pointer, off nameOff) name {
 		return name{}
 	}
 	base := uintptr(ptrInModule)
-	for md := &firstmoduledata; md != nil; md = md.next {
+	for md := &firstmoduledata; md != nil; md = md.state.next {
 		if base >= md.types && base < md.etypes {
 			res := md.types + uintptr(off)
 			if res > md.etypes {
@@ -207,7 +207,7 @@ func resolveNameOff(ptrInModule unsafe.Pointer, off nameOff) name {
 	reflectOffsUnlock()
 	if !found {
 		println("runtime: nameOff", hex(off), "base", hex(base), "not in ranges:")
-		for next := &firstmoduledata; next != nil; next = next.next {
+		for next := &firstmoduledata; next != nil; next = next.state.next {
 			println("\ttypes", hex(next.types), "etypes", hex(next.etypes))
 		}
 		throw("runtime: name offset base pointer out of range")
@@ -227,7 +227,7 @@ func resolveTypeOff(ptrInModule unsafe.Pointer, off typeOff) *_type {
 	}
 	base := uintptr(ptrInModule)
 	var md *moduledata
-	for next := &firstmoduledata; next != nil; next = next.next {
+	for next := &firstmoduledata; next != nil; next = next.state.next {
 		if base >= next.types && base < next.etypes {
 			md = next
 			break
@@ -239,14 +239,14 @@ func resolveTypeOff(ptrInModule unsafe.Pointer, off typeOff) *_type {
 		reflectOffsUnlock()
 		if res == nil {
 			println("runtime: typeOff", hex(off), "base", hex(base), "not in ranges:")
-			for next := &firstmoduledata; next != nil; next = next.next {
+			for next := &firstmoduledata; next != nil; next = next.state.next {
 				println("\ttypes", hex(next.types), "etypes", hex(next.etypes))
 			}
 			throw("runtime: type offset base pointer out of range")
 		}
 		return (*_type)(res)
 	}
-	if t := md.typemap[off]; t != nil {
+	if t := md.state.typemap[off]; t != nil {
 		return t
 	}
 	res := md.types + uintptr(off)
@@ -269,7 +269,7 @@ func (t *_type) textOff(off textOff) unsafe.Pointer {
 	}
 	base := uintptr(unsafe.Pointer(t))
 	var md *moduledata
-	for next := &firstmoduledata; next != nil; next = next.next {
+	for next := &firstmoduledata; next != nil; next = next.state.next {
 		if base >= next.types && base < next.etypes {
 			md = next
 			break
@@ -281,7 +281,7 @@ func (t *_type) textOff(off textOff) unsafe.Pointer {
 		reflectOffsUnlock()
 		if res == nil {
 			println("runtime: textOff", hex(off), "base", hex(base), "not in ranges:")
-			for next := &firstmoduledata; next != nil; next = next.next {
+			for next := &firstmoduledata; next != nil; next = next.state.next {
 				println("\ttypes", hex(next.types), "etypes", hex(next.etypes))
 			}
 			throw("runtime: text offset base pointer out of range")
@@ -499,7 +499,7 @@ func (n name) isBlank() bool {
 // typelinksinit scans the types from extra modules and builds the
 // moduledata typemap used to de-duplicate type pointers.
 func typelinksinit() {
-	if firstmoduledata.next == nil {
+	if firstmoduledata.state.next == nil {
 		return
 	}
 	typehash := make(map[uint32][]*_type, len(firstmoduledata.typelinks))
@@ -511,10 +511,10 @@ func typelinksinit() {
 	collect:
 		for _, tl := range prev.typelinks {
 			var t *_type
-			if prev.typemap == nil {
+			if prev.state.typemap == nil {
 				t = (*_type)(unsafe.Pointer(prev.types + uintptr(tl)))
 			} else {
-				t = prev.typemap[typeOff(tl)]
+				t = prev.state.typemap[typeOff(tl)]
 			}
 			// Add to typehash if not seen before.
 			tlist := typehash[t.hash]
@@ -526,13 +526,20 @@ func typelinksinit() {
 			typehash[t.hash] = append(tlist, t)
 		}
 
-		if md.typemap == nil {
+		if md.state.typemap == nil {
 			// If any of this module's typelinks match a type from a
 			// prior module, prefer that prior type by adding the offset
 			// to this module's typemap.
 			tm := make(map[typeOff]*_type, len(md.typelinks))
 			pinnedTypemaps = append(pinnedTypemaps, tm)
-			md.typemap = tm
+			md.state.typemap = tm
+			// A plugin linked with -pluginhost leaves some types to
+			// the program, which the dynamic linker has bound. The
+			// offsets of those types are the offsets of their entries.
+			for i, t := range md.typeimports {
+				off := uintptr(unsafe.Pointer(&md.typeimports[i])) - md.types
+				md.state.typemap[typeOff(off)] = t
+			}
 			for _, tl := range md.typelinks {
 				t := (*_type)(unsafe.Pointer(md.types + uintptr(tl)))
 				for _, candidate := range typehash[t.hash] {
@@ -542,7 +549,7 @@ func typelinksinit() {
 						break
 					}
 				}
-				md.typemap[typeOff(tl)] = t
+				md.state.typemap[typeOff(tl)] = t
 			}
 		}
 